@@ -0,0 +1,338 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "awsiot", NewAWSIoTChan)
+	dsl.TheChanDocs.Register("awsiot", "An AWS IoT Core MQTT client using SigV4 (WebSocket) or X.509 certificate authentication.", AWSIoTOpts{})
+}
+
+const (
+	// ShadowTopicPrefix is the abbreviation for a thing's shadow
+	// topics.  See AWSIoTOpts.Thing.
+	ShadowTopicPrefix = "$shadow/"
+
+	// AWSIoTService is the SigV4 service name for AWS IoT Core's
+	// data plane.
+	AWSIoTService = "iotdevicegateway"
+)
+
+// AWSIoT is an MQTT client Chan for AWS IoT Core.
+//
+// The channel connects with either SigV4 authentication (via MQTT
+// over a WebSocket) or X.509 client certificate authentication.  When
+// the channel has a Thing, topics starting with ShadowTopicPrefix
+// abbreviate the thing's shadow topics.
+type AWSIoT struct {
+	*MQTT
+
+	opts *AWSIoTOpts
+}
+
+// AWSIoTOpts configures an AWSIoT channel.
+type AWSIoTOpts struct {
+	// Endpoint is the account's AWS IoT Core data endpoint (like
+	// "abc123-ats.iot.us-east-1.amazonaws.com").
+	Endpoint string `json:",omitempty" yaml:",omitempty" doc:"The AWS IoT Core data endpoint (HOST)."`
+
+	// Region is the AWS region for SigV4 signing.
+	//
+	// The default is the region in the Endpoint (if any) or else
+	// the region from the AWS configuration.
+	Region string `json:",omitempty" yaml:",omitempty" doc:"AWS region for SigV4 signing (defaults to the Endpoint's region)."`
+
+	// Auth is either "sigv4" or "cert".
+	//
+	// The default is "cert" if there's a CertFile and "sigv4"
+	// otherwise.  SigV4 authentication uses credentials from the
+	// usual AWS configuration (environment, shared files, and
+	// instance roles).
+	Auth string `json:",omitempty" yaml:",omitempty" doc:"Authentication: 'sigv4' or 'cert' (default 'cert' if there's a certfile)."`
+
+	// Port is the endpoint's port.
+	//
+	// The default is 443 for "sigv4" and 8883 for "cert".
+	Port int `json:",omitempty" yaml:",omitempty" doc:"The endpoint's port (default 443 for sigv4 and 8883 for cert)."`
+
+	// CertFile is the filename for the client's certificate (for
+	// "cert" authentication).
+	CertFile string `json:",omitempty" yaml:",omitempty" doc:"Filename for the client's certificate."`
+
+	// KeyFile is the filename for the client's private key (for
+	// "cert" authentication).
+	KeyFile string `json:",omitempty" yaml:",omitempty" doc:"Filename for the client's private key."`
+
+	// CACertFile is the optional filename for the certificate
+	// authority (like Amazon Root CA 1).
+	CACertFile string `json:",omitempty" yaml:",omitempty" doc:"Filename for the certificate authority."`
+
+	// Expires is the lifetime in seconds of a SigV4 signature,
+	// which only needs to last until the connection is
+	// established.
+	Expires int64 `json:",omitempty" yaml:",omitempty" doc:"Lifetime in seconds of a SigV4 signature." default:"300"`
+
+	// Thing is the optional name of the thing whose shadow topics
+	// ShadowTopicPrefix abbreviates.
+	//
+	// For example, "$shadow/update/accepted" is
+	// "$aws/things/THING/shadow/update/accepted".
+	Thing string `json:",omitempty" yaml:",omitempty" doc:"Thing whose shadow topics '$shadow/' abbreviates."`
+
+	// ShadowName is the optional name of a named shadow, which
+	// makes ShadowTopicPrefix abbreviate
+	// "$aws/things/THING/shadow/name/SHADOWNAME/".
+	ShadowName string `json:",omitempty" yaml:",omitempty" doc:"Named shadow for '$shadow/' topics (default is the classic shadow)."`
+
+	// ClientID is MQTT client id, which AWS IoT policies often
+	// constrain (often to the Thing's name).
+	ClientID string `json:",omitempty" yaml:",omitempty" doc:"The MQTT client id (defaults to the Thing)."`
+
+	// QoS is the MQTT QoS (0 or 1) for Pub and Sub.
+	QoS *byte `json:",omitempty" yaml:",omitempty" doc:"QoS (0 or 1) for pubs and subs." default:"1"`
+
+	// CleanSession, when true, will not resume a previous MQTT
+	// session for this client id.
+	CleanSession bool `json:",omitempty" yaml:",omitempty" doc:"Don't resume a previous session for this client id."`
+
+	// KeepAlive is the duration in seconds between PINGs.
+	KeepAlive int64 `json:",omitempty" yaml:",omitempty" doc:"Seconds between PINGs."`
+
+	// ConnectTimeout is the duration in milliseconds to wait to
+	// connect.
+	ConnectTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds to wait to connect." default:"5000"`
+
+	// BufferSize specifies the capacity of the internal Go
+	// channel.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+func NewAWSIoTChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
+	o := AWSIoTOpts{}
+
+	js, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(js, &o); err != nil {
+		return nil, fmt.Errorf("NewAWSIoTChan: %w", err)
+	}
+
+	if o.Endpoint == "" {
+		return nil, fmt.Errorf("NewAWSIoTChan: no Endpoint")
+	}
+	if o.QoS != nil && 1 < *o.QoS {
+		return nil, fmt.Errorf("NewAWSIoTChan: AWS IoT Core doesn't support QoS %d", *o.QoS)
+	}
+	if o.Auth == "" {
+		o.Auth = "sigv4"
+		if o.CertFile != "" {
+			o.Auth = "cert"
+		}
+	}
+	if o.Expires == 0 {
+		o.Expires = 300
+	}
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = 5000
+	}
+	if o.ClientID == "" {
+		o.ClientID = o.Thing
+	}
+	if o.Region == "" {
+		o.Region = EndpointRegion(o.Endpoint)
+	}
+
+	mo := MQTTOpts{
+		CACertFile:     o.CACertFile,
+		ClientID:       o.ClientID,
+		QoS:            o.QoS,
+		CleanSession:   o.CleanSession,
+		KeepAlive:      o.KeepAlive,
+		ConnectTimeout: o.ConnectTimeout,
+		BufferSize:     o.BufferSize,
+		Overflow:       o.Overflow,
+	}
+
+	switch o.Auth {
+	case "cert":
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, fmt.Errorf("NewAWSIoTChan: cert auth requires CertFile and KeyFile")
+		}
+		port := o.Port
+		if port == 0 {
+			port = 8883
+		}
+		mo.BrokerURL = fmt.Sprintf("ssl://%s:%d", o.Endpoint, port)
+		mo.CertFile = o.CertFile
+		mo.KeyFile = o.KeyFile
+		if port == 443 {
+			// See
+			// https://docs.aws.amazon.com/iot/latest/developerguide/protocols.html.
+			mo.ALPN = "x-amzn-mqtt-ca"
+		}
+	case "sigv4":
+		// The URL is signed when the channel is opened.
+	default:
+		return nil, fmt.Errorf("NewAWSIoTChan: Auth '%s' isn't 'sigv4' or 'cert'", o.Auth)
+	}
+
+	c, err := NewMQTTChan(ctx, mo)
+	if err != nil {
+		return nil, err
+	}
+	m := c.(*MQTT)
+
+	if o.Thing != "" {
+		long := ShadowTopic(o.Thing, o.ShadowName, "")
+		m.topicOut = func(topic string) string {
+			if strings.HasPrefix(topic, ShadowTopicPrefix) {
+				return long + topic[len(ShadowTopicPrefix):]
+			}
+			return topic
+		}
+		m.topicIn = func(topic string) string {
+			if strings.HasPrefix(topic, long) {
+				return ShadowTopicPrefix + topic[len(long):]
+			}
+			return topic
+		}
+	}
+
+	return &AWSIoT{
+		MQTT: m,
+		opts: &o,
+	}, nil
+}
+
+func (c *AWSIoT) Kind() dsl.ChanKind {
+	return "awsiot"
+}
+
+// Open signs a WebSocket URL (for "sigv4" Auth) and connects.
+func (c *AWSIoT) Open(ctx *dsl.Ctx) error {
+	if c.opts.Auth == "sigv4" {
+		creds, region, err := awsIoTCredentials(c.opts.Region)
+		if err != nil {
+			return dsl.NewBroken(fmt.Errorf("AWSIoT credentials: %w", err))
+		}
+		port := c.opts.Port
+		if port == 0 {
+			port = 443
+		}
+		host := c.opts.Endpoint
+		if port != 443 {
+			host = fmt.Sprintf("%s:%d", host, port)
+		}
+		u, err := PresignAWSIoTURL(host, region, creds, time.Duration(c.opts.Expires)*time.Second, time.Now())
+		if err != nil {
+			return dsl.NewBroken(fmt.Errorf("AWSIoT signing: %w", err))
+		}
+		ctx.Logf("AWSIoT %s signed WebSocket URL for %s", c.opts.ClientID, host)
+		c.mopts.Servers = nil
+		c.mopts.AddBroker(u)
+	}
+	return c.MQTT.Open(ctx)
+}
+
+// awsIoTCredentials gets credentials (and the region if the given
+// region is empty) from the AWS configuration.
+func awsIoTCredentials(region string) (credentials.Value, string, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Region: aws.String(region),
+		},
+	})
+	if err != nil {
+		return credentials.Value{}, "", err
+	}
+	if region == "" {
+		region = aws.StringValue(sess.Config.Region)
+	}
+	if region == "" {
+		return credentials.Value{}, "", fmt.Errorf("no region")
+	}
+	creds, err := sess.Config.Credentials.Get()
+	return creds, region, err
+}
+
+// PresignAWSIoTURL returns a SigV4-signed WebSocket URL for MQTT
+// connections to the given AWS IoT Core endpoint.
+//
+// As AWS IoT Core requires, the session token (if any) is added
+// after signing.
+func PresignAWSIoTURL(host, region string, creds credentials.Value, exp time.Duration, at time.Time) (string, error) {
+	req, err := http.NewRequest("GET", "wss://"+host+"/mqtt", nil)
+	if err != nil {
+		return "", err
+	}
+	signer := v4.NewSigner(credentials.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, ""))
+	if _, err = signer.Presign(req, nil, AWSIoTService, region, exp, at); err != nil {
+		return "", err
+	}
+	u := req.URL.String()
+	if creds.SessionToken != "" {
+		u += "&X-Amz-Security-Token=" + url.QueryEscape(creds.SessionToken)
+	}
+	return u, nil
+}
+
+// EndpointRegion returns the region in an AWS IoT Core endpoint
+// (like "abc123-ats.iot.us-east-1.amazonaws.com") or the empty
+// string.
+func EndpointRegion(endpoint string) string {
+	parts := strings.Split(endpoint, ".")
+	for i, part := range parts {
+		if part == "iot" && i+2 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// ShadowTopic returns the topic for the given thing's shadow
+// operation (like "update/accepted").  A named shadow has a
+// non-empty shadowName.
+func ShadowTopic(thing, shadowName, op string) string {
+	t := "$aws/things/" + thing + "/shadow/"
+	if shadowName != "" {
+		t += "name/" + shadowName + "/"
+	}
+	return t + op
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestEndpointRegion(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"abc123-ats.iot.us-east-1.amazonaws.com": "us-east-1",
+		"abc123.iot.eu-west-2.amazonaws.com":     "eu-west-2",
+		"localhost":                              "",
+	} {
+		if got := EndpointRegion(endpoint); got != want {
+			t.Fatalf("%s: %q != %q", endpoint, got, want)
+		}
+	}
+}
+
+func TestPresignAWSIoTURL(t *testing.T) {
+	var (
+		creds = credentials.Value{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			SessionToken:    "token/with+chars",
+		}
+		at = time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	)
+
+	s, err := PresignAWSIoTURL("abc123-ats.iot.us-east-1.amazonaws.com", "us-east-1", creds, time.Minute, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "wss" || u.Path != "/mqtt" {
+		t.Fatal(s)
+	}
+	q := u.Query()
+	if got := q.Get("X-Amz-Credential"); got != "AKIDEXAMPLE/20210203/us-east-1/iotdevicegateway/aws4_request" {
+		t.Fatal(got)
+	}
+	if q.Get("X-Amz-Date") != "20210203T040506Z" || q.Get("X-Amz-Expires") != "60" {
+		t.Fatal(s)
+	}
+	if len(q.Get("X-Amz-Signature")) != 64 {
+		t.Fatal(s)
+	}
+	if q.Get("X-Amz-Security-Token") != creds.SessionToken {
+		t.Fatal(s)
+	}
+	// The token isn't signed.
+	if i, j := strings.Index(s, "X-Amz-Signature"), strings.Index(s, "X-Amz-Security-Token"); j < i {
+		t.Fatal(s)
+	}
+
+	// Signing is deterministic.
+	s2, err := PresignAWSIoTURL("abc123-ats.iot.us-east-1.amazonaws.com", "us-east-1", creds, time.Minute, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != s2 {
+		t.Fatal(s2)
+	}
+}
+
+func TestAWSIoTShadowTopics(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+
+	for _, name := range []string{"", "config"} {
+		c, err := NewAWSIoTChan(ctx, AWSIoTOpts{
+			Endpoint:   "abc123-ats.iot.us-east-1.amazonaws.com",
+			Thing:      "lamp",
+			ShadowName: name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := c.(*AWSIoT).MQTT
+
+		want := "$aws/things/lamp/shadow/update/accepted"
+		if name != "" {
+			want = "$aws/things/lamp/shadow/name/config/update/accepted"
+		}
+		if got := m.topicOut("$shadow/update/accepted"); got != want {
+			t.Fatal(got)
+		}
+		if got := m.topicIn(want); got != "$shadow/update/accepted" {
+			t.Fatal(got)
+		}
+		if got := m.topicOut("lamp/status"); got != "lamp/status" {
+			t.Fatal(got)
+		}
+		if m.opts.ClientID != "lamp" {
+			t.Fatal(m.opts.ClientID)
+		}
+	}
+}
+
+func TestAWSIoTOpts(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+
+	if _, err := NewAWSIoTChan(ctx, AWSIoTOpts{}); err == nil {
+		t.Fatal("no endpoint should be a problem")
+	}
+	if _, err := NewAWSIoTChan(ctx, AWSIoTOpts{
+		Endpoint: "localhost",
+		Auth:     "magic",
+	}); err == nil {
+		t.Fatal("bad auth should be a problem")
+	}
+	if _, err := NewAWSIoTChan(ctx, AWSIoTOpts{
+		Endpoint: "localhost",
+		Auth:     "cert",
+	}); err == nil {
+		t.Fatal("cert without files should be a problem")
+	}
+}
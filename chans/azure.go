@@ -0,0 +1,840 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "servicebus", NewServiceBusChan)
+	dsl.TheChanDocs.Register("servicebus", "An Azure Service Bus queue or topic client (via the REST API).", ServiceBusOpts{})
+
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "eventhubs", NewEventHubsChan)
+	dsl.TheChanDocs.Register("eventhubs", "An Azure Event Hubs client (via the REST API and the Kafka endpoint).", EventHubsOpts{})
+}
+
+var (
+	// AzureAuthorityURL is the base URL for Azure Active
+	// Directory token requests.
+	AzureAuthorityURL = "https://login.microsoftonline.com"
+
+	// AzureServiceBusScope is the AAD scope for Service Bus and
+	// Event Hubs.
+	AzureServiceBusScope = "https://servicebus.azure.net/.default"
+
+	// AzureSASLifetime is the lifetime of a shared access
+	// signature.
+	AzureSASLifetime = time.Hour
+
+	// EventHubsKafkaTimeout bounds each request (other than the
+	// wait for events) to an Event Hubs Kafka endpoint.
+	EventHubsKafkaTimeout = 30 * time.Second
+)
+
+// AzureAuthOpts configures authentication (and the namespace) for
+// Azure Service Bus and Event Hubs channels.
+//
+// Give either a ConnectionString (with a shared access key) or the
+// AAD TenantID, ClientID, and ClientSecret of a service principal.
+type AzureAuthOpts struct {
+	// ConnectionString is a connection string like
+	// "Endpoint=sb://NAMESPACE.servicebus.windows.net/;SharedAccessKeyName=NAME;SharedAccessKey=KEY".
+	//
+	// The connection string's EntityPath (if any) is the default
+	// queue, topic, or event hub.
+	ConnectionString string `json:",omitempty" yaml:",omitempty" doc:"Connection string with a shared access key."`
+
+	// Namespace is the host (like
+	// "NAMESPACE.servicebus.windows.net") for AAD authentication.
+	Namespace string `json:",omitempty" yaml:",omitempty" doc:"Namespace host (for AAD auth)."`
+
+	// TenantID, ClientID, and ClientSecret are the credentials
+	// of an AAD service principal.
+	TenantID     string `json:",omitempty" yaml:",omitempty" doc:"AAD tenant id."`
+	ClientID     string `json:",omitempty" yaml:",omitempty" doc:"AAD client (application) id."`
+	ClientSecret string `json:",omitempty" yaml:",omitempty" doc:"AAD client secret."`
+
+	// BaseURL, when not empty, replaces "https://NAMESPACE" as
+	// the base URL for requests (for emulators and testing).
+	BaseURL string `json:",omitempty" yaml:",omitempty" doc:"Base URL for requests (for emulators and testing)."`
+}
+
+// azureAuth makes requests to a Service Bus or Event Hubs namespace.
+type azureAuth struct {
+	opts *AzureAuthOpts
+
+	// base is the base URL for requests, and host is the
+	// namespace's host (which SAS tokens sign).
+	base, host string
+
+	keyName, key string
+	entity       string
+
+	client *http.Client
+
+	sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newAzureAuth parses the connection string (if any) and checks the
+// options.
+func newAzureAuth(o *AzureAuthOpts) (*azureAuth, error) {
+	a := &azureAuth{
+		opts: o,
+		host: o.Namespace,
+		client: &http.Client{
+			Timeout: time.Minute + 10*time.Second,
+		},
+	}
+
+	if o.ConnectionString != "" {
+		for _, part := range strings.Split(o.ConnectionString, ";") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "Endpoint":
+				u, err := url.Parse(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("connection string Endpoint: %w", err)
+				}
+				a.host = u.Host
+			case "SharedAccessKeyName":
+				a.keyName = kv[1]
+			case "SharedAccessKey":
+				a.key = kv[1]
+			case "EntityPath":
+				a.entity = kv[1]
+			}
+		}
+		if a.host == "" || a.keyName == "" || a.key == "" {
+			return nil, fmt.Errorf("connection string needs Endpoint, SharedAccessKeyName, and SharedAccessKey")
+		}
+	} else if o.TenantID == "" || o.ClientID == "" || o.ClientSecret == "" {
+		return nil, fmt.Errorf("need a ConnectionString or TenantID, ClientID, and ClientSecret")
+	}
+
+	if a.host == "" {
+		return nil, fmt.Errorf("no Namespace")
+	}
+
+	a.base = o.BaseURL
+	if a.base == "" {
+		a.base = "https://" + a.host
+	}
+	a.base = strings.TrimSuffix(a.base, "/")
+
+	return a, nil
+}
+
+// SASToken returns a shared access signature for the resource.
+func SASToken(resource, keyName, key string, expires time.Time) string {
+	var (
+		sr  = url.QueryEscape(resource)
+		se  = strconv.FormatInt(expires.Unix(), 10)
+		mac = hmac.New(sha256.New, []byte(key))
+	)
+	mac.Write([]byte(sr + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s",
+		sr, url.QueryEscape(sig), se, keyName)
+}
+
+// authorization returns the value for the Authorization header.
+func (a *azureAuth) authorization() (string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	now := time.Now()
+	if a.token != "" && now.Add(time.Minute).Before(a.expires) {
+		return a.token, nil
+	}
+
+	if a.key != "" {
+		a.expires = now.Add(AzureSASLifetime)
+		a.token = SASToken("https://"+a.host+"/", a.keyName, a.key, a.expires)
+		return a.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.opts.ClientID},
+		"client_secret": {a.opts.ClientSecret},
+		"scope":         {AzureServiceBusScope},
+	}
+	u := AzureAuthorityURL + "/" + url.PathEscape(a.opts.TenantID) + "/oauth2/v2.0/token"
+	resp, err := a.client.PostForm(u, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("AAD token request: %s: %s", resp.Status, body)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &t); err != nil {
+		return "", fmt.Errorf("AAD token response: %w", err)
+	}
+	a.token = "Bearer " + t.AccessToken
+	a.expires = now.Add(time.Duration(t.ExpiresIn) * time.Second)
+	return a.token, nil
+}
+
+// do makes an authorized request for the path (relative to the
+// namespace) and returns the response, which the caller must close.
+func (a *azureAuth) do(method, path string, body []byte, header http.Header) (*http.Response, error) {
+	auth, err := a.authorization()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, a.base+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Authorization", auth)
+	return a.client.Do(req)
+}
+
+// send posts a message to an entity's messages.
+func (a *azureAuth) send(entity string, payload interface{}, props map[string]interface{}) error {
+	body, err := dsl.MaybeSerialize(payload)
+	if err != nil {
+		return err
+	}
+	h := http.Header{
+		"Content-Type": {"application/atom+xml;type=entry;charset=utf-8"},
+	}
+	if len(props) != 0 {
+		js, err := json.Marshal(props)
+		if err != nil {
+			return err
+		}
+		h.Set("BrokerProperties", string(js))
+	}
+	resp, err := a.do("POST", "/"+entity+"/messages", []byte(body), h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("send to %s: %s: %s", entity, resp.Status, bs)
+	}
+	return nil
+}
+
+// parseAzureBody returns the JSON body as a value or else the body
+// as a string.
+func parseAzureBody(bs []byte) interface{} {
+	var x interface{}
+	if err := json.Unmarshal(bs, &x); err != nil {
+		return string(bs)
+	}
+	return x
+}
+
+// ServiceBusOpts configures a ServiceBusChan.
+type ServiceBusOpts struct {
+	AzureAuthOpts
+
+	// Queue is the queue for Pub and Recv.
+	Queue string `json:",omitempty" yaml:",omitempty" doc:"The queue for pubs and receiving."`
+
+	// Topic is the topic for Pub (instead of a Queue).
+	Topic string `json:",omitempty" yaml:",omitempty" doc:"The topic for pubs (instead of a queue)."`
+
+	// Subscription is the Topic's subscription to receive from.
+	Subscription string `json:",omitempty" yaml:",omitempty" doc:"The topic's subscription for receiving."`
+
+	// WaitTimeSeconds is the timeout for each receive request.
+	WaitTimeSeconds int `json:",omitempty" yaml:",omitempty" doc:"Timeout in seconds for each receive request." default:"10"`
+
+	// NoReceive, when true, disables receiving (for a channel
+	// that only publishes).
+	NoReceive bool `json:",omitempty" yaml:",omitempty" doc:"Don't receive (for a channel that only publishes)."`
+
+	// BufferSize specifies the capacity of the internal Go
+	// channel.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// ServiceBusChan is a Chan for an Azure Service Bus queue or topic.
+//
+// A Pub sends its payload as the body of a message to the queue or
+// topic.  A message's properties (like "Label" or "SessionId") can be
+// given as the payload's "properties" when the payload is an object
+// with a "body" and "properties" (and no other properties).
+//
+// Unless NoReceive, the channel receives (and deletes) messages from
+// the queue or the topic's subscription.  A received message's topic
+// is the queue or subscription path, and its payload is the message's
+// body (parsed as JSON if possible).
+type ServiceBusChan struct {
+	opts *ServiceBusOpts
+	auth *azureAuth
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+	ctl  chan bool
+}
+
+func NewServiceBusChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := ServiceBusOpts{
+		WaitTimeSeconds: 10,
+		BufferSize:      DefaultChanBufferSize,
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+
+	auth, err := newAzureAuth(&opts.AzureAuthOpts)
+	if err != nil {
+		return nil, dsl.NewBroken(fmt.Errorf("NewServiceBusChan: %w", err))
+	}
+	if opts.Queue == "" && opts.Topic == "" {
+		opts.Queue = auth.entity
+	}
+	if opts.Queue == "" && opts.Topic == "" {
+		return nil, dsl.Brokenf("NewServiceBusChan: need a Queue or Topic")
+	}
+	if opts.Topic != "" && opts.Subscription == "" && !opts.NoReceive {
+		return nil, dsl.Brokenf("NewServiceBusChan: need a Subscription to receive from Topic %s", opts.Topic)
+	}
+
+	buf, err := dsl.NewBuffer("servicebus", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceBusChan{
+		opts: &opts,
+		auth: auth,
+		c:    buf.C,
+		buf:  buf,
+		ctl:  make(chan bool),
+	}, nil
+}
+
+func (c *ServiceBusChan) Kind() dsl.ChanKind {
+	return "servicebus"
+}
+
+// entity returns the queue or topic for Pub.
+func (c *ServiceBusChan) entity() string {
+	if c.opts.Queue != "" {
+		return c.opts.Queue
+	}
+	return c.opts.Topic
+}
+
+// source returns the path to receive from.
+func (c *ServiceBusChan) source() string {
+	if c.opts.Queue != "" {
+		return c.opts.Queue
+	}
+	return c.opts.Topic + "/subscriptions/" + c.opts.Subscription
+}
+
+func (c *ServiceBusChan) Open(ctx *dsl.Ctx) error {
+	if !c.opts.NoReceive {
+		go c.consume(ctx)
+	}
+	return nil
+}
+
+func (c *ServiceBusChan) Close(ctx *dsl.Ctx) error {
+	close(c.ctl)
+	return nil
+}
+
+func (c *ServiceBusChan) Sub(ctx *dsl.Ctx, topic string) error {
+	return dsl.Brokenf("Can't Sub on a Service Bus channel (%s)", c.entity())
+}
+
+func (c *ServiceBusChan) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("ServiceBusChan Pub to %s", c.entity())
+	payload, props := azureMessage(m.Payload)
+	return c.auth.send(c.entity(), payload, props)
+}
+
+// azureMessage returns the body and properties of a published
+// payload.  See ServiceBusChan.
+func azureMessage(payload interface{}) (interface{}, map[string]interface{}) {
+	m, is := payload.(map[string]interface{})
+	if !is || len(m) != 2 {
+		return payload, nil
+	}
+	body, have := m["body"]
+	if !have {
+		return payload, nil
+	}
+	props, is := m["properties"].(map[string]interface{})
+	if !is {
+		return payload, nil
+	}
+	return body, props
+}
+
+func (c *ServiceBusChan) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *ServiceBusChan) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("Kill is not supported by a %T", c)
+}
+
+func (c *ServiceBusChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("ServiceBusChan To %s", m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *ServiceBusChan) Overflow() error {
+	return c.buf.Overflow()
+}
+
+// consume receives (and deletes) messages until the channel is
+// closed.
+func (c *ServiceBusChan) consume(ctx *dsl.Ctx) {
+	var (
+		source = c.source()
+		path   = fmt.Sprintf("/%s/messages/head?timeout=%d", source, c.opts.WaitTimeSeconds)
+	)
+	ctx.Logf("ServiceBusChan consuming %s", source)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.ctl:
+			return
+		default:
+		}
+
+		resp, err := c.auth.do("DELETE", path, nil, nil)
+		if err != nil {
+			ctx.Warnf("warning: ServiceBusChan receive from %s: %s", source, err)
+			if !sleep(ctx, c.ctl, time.Second) {
+				return
+			}
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		switch {
+		case err != nil:
+			ctx.Warnf("warning: ServiceBusChan receive from %s: %s", source, err)
+		case resp.StatusCode == http.StatusNoContent:
+			// No message before the timeout.
+			continue
+		case resp.StatusCode != http.StatusOK:
+			ctx.Warnf("warning: ServiceBusChan receive from %s: %s: %s", source, resp.Status, body)
+			if !sleep(ctx, c.ctl, time.Second) {
+				return
+			}
+			continue
+		}
+
+		c.To(ctx, dsl.Msg{
+			Topic:   source,
+			Payload: parseAzureBody(body),
+		})
+	}
+}
+
+// sleep waits for the duration and returns false if interrupted.
+func sleep(ctx *dsl.Ctx, ctl chan bool, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-ctl:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// EventHubsOpts configures an EventHubsChan.
+type EventHubsOpts struct {
+	AzureAuthOpts
+
+	// Hub is the event hub (which defaults to the connection
+	// string's EntityPath).
+	Hub string `json:",omitempty" yaml:",omitempty" doc:"The event hub (defaults to the connection string's EntityPath)."`
+
+	// PartitionKey is the default partition key for events.
+	PartitionKey string `json:",omitempty" yaml:",omitempty" doc:"Default partition key."`
+
+	// KafkaAddr is the Kafka endpoint (HOST:PORT) for receiving.
+	// The default is the namespace's port 9093.
+	KafkaAddr string `json:",omitempty" yaml:",omitempty" doc:"The Kafka endpoint (HOST:PORT) for receiving (defaults to NAMESPACE:9093)."`
+
+	// KafkaPlaintext, when true, doesn't use TLS with the Kafka
+	// endpoint (for emulators and testing).
+	KafkaPlaintext bool `json:",omitempty" yaml:",omitempty" doc:"Don't use TLS with the Kafka endpoint (for emulators and testing)."`
+
+	// StartPosition is where a Sub starts receiving in each
+	// partition: "latest" (the default) or "earliest".
+	StartPosition string `json:",omitempty" yaml:",omitempty" doc:"Where to start receiving: latest or earliest." default:"latest"`
+
+	// MaxWait is the time in milliseconds for the Kafka endpoint
+	// to wait for events.
+	MaxWait int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds for the Kafka endpoint to wait for events." default:"1000"`
+
+	// BufferSize is the capacity of the channel's dsl.Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// EventHubsChan is a Chan for an Azure event hub.
+//
+// A Pub sends its payload as an event (via the REST API).  The
+// message's topic, if not empty, is the event's partition key.
+//
+// The REST API can't receive events, so the channel receives via the
+// Event Hubs Kafka endpoint (see KafkaAddr).  A Sub with a topic that
+// is a partition id starts receiving from that partition, and a Sub
+// with the topic "*" (or "") starts receiving from all of the hub's
+// partitions.  A received message's topic is the event's partition
+// key (or, if the event doesn't have one, its partition id), and its
+// payload is the event's body (parsed as JSON if possible).
+type EventHubsChan struct {
+	opts *EventHubsOpts
+	auth *azureAuth
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+
+	ctl       chan bool
+	closeOnce sync.Once
+
+	sync.Mutex
+	kafka     *kafkaConn
+	consuming bool
+
+	// pending has the starting offsets of partitions that the
+	// consumer hasn't started fetching.
+	pending map[int32]int64
+
+	// subbed has the partitions that Subs have requested.
+	subbed map[int32]bool
+}
+
+func NewEventHubsChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := EventHubsOpts{
+		StartPosition: "latest",
+		MaxWait:       1000,
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+
+	auth, err := newAzureAuth(&opts.AzureAuthOpts)
+	if err != nil {
+		return nil, dsl.NewBroken(fmt.Errorf("NewEventHubsChan: %w", err))
+	}
+	if opts.Hub == "" {
+		opts.Hub = auth.entity
+	}
+	if opts.Hub == "" {
+		return nil, dsl.Brokenf("NewEventHubsChan: need a Hub")
+	}
+	switch opts.StartPosition {
+	case "latest", "earliest":
+	default:
+		return nil, dsl.Brokenf("NewEventHubsChan: StartPosition '%s' isn't latest or earliest", opts.StartPosition)
+	}
+	if opts.KafkaAddr == "" {
+		opts.KafkaAddr = auth.host + ":9093"
+	}
+
+	buf, err := dsl.NewBuffer("eventhubs", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventHubsChan{
+		opts:    &opts,
+		auth:    auth,
+		c:       buf.C,
+		buf:     buf,
+		ctl:     make(chan bool),
+		pending: make(map[int32]int64),
+		subbed:  make(map[int32]bool),
+	}, nil
+}
+
+func (c *EventHubsChan) Kind() dsl.ChanKind {
+	return "eventhubs"
+}
+
+func (c *EventHubsChan) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *EventHubsChan) Close(ctx *dsl.Ctx) error {
+	c.closeOnce.Do(func() {
+		close(c.ctl)
+		c.Lock()
+		if c.kafka != nil {
+			c.kafka.Close()
+		}
+		c.Unlock()
+	})
+	return nil
+}
+
+// Sub starts receiving from a partition (or all partitions).  See
+// EventHubsChan.
+func (c *EventHubsChan) Sub(ctx *dsl.Ctx, topic string) error {
+	ctx.Logf("EventHubsChan Sub %s partition %s", c.opts.Hub, topic)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.kafka == nil {
+		k, err := c.connect(ctx)
+		if err != nil {
+			return err
+		}
+		c.kafka = k
+	}
+
+	ps, err := c.kafka.partitions(c.opts.Hub, EventHubsKafkaTimeout)
+	if err != nil {
+		return err
+	}
+	if topic != "" && topic != "*" {
+		p, err := strconv.ParseInt(topic, 10, 32)
+		if err != nil {
+			return dsl.Brokenf("EventHubsChan Sub topic '%s' isn't a partition id or '*'", topic)
+		}
+		found := false
+		for _, q := range ps {
+			found = found || q == int32(p)
+		}
+		if !found {
+			return fmt.Errorf("event hub %s has no partition %d", c.opts.Hub, p)
+		}
+		ps = []int32{int32(p)}
+	}
+
+	var fresh []int32
+	for _, p := range ps {
+		if !c.subbed[p] {
+			fresh = append(fresh, p)
+		}
+	}
+	if 0 < len(fresh) {
+		offsets, err := c.kafka.offsets(c.opts.Hub, fresh, c.startTimestamp(), EventHubsKafkaTimeout)
+		if err != nil {
+			return err
+		}
+		for p, offset := range offsets {
+			c.subbed[p] = true
+			c.pending[p] = offset
+		}
+	}
+
+	if !c.consuming {
+		c.consuming = true
+		go c.consume(ctx)
+	}
+	return nil
+}
+
+// connect dials the Kafka endpoint and authenticates.
+func (c *EventHubsChan) connect(ctx *dsl.Ctx) (*kafkaConn, error) {
+	var tlsConfig *tls.Config
+	if !c.opts.KafkaPlaintext {
+		tlsConfig = &tls.Config{}
+	}
+	ctx.Logf("EventHubsChan connecting to %s", c.opts.KafkaAddr)
+	k, err := dialKafka(c.opts.KafkaAddr, tlsConfig, EventHubsKafkaTimeout, "plax")
+	if err != nil {
+		return nil, err
+	}
+
+	// With a shared access key, the password is the connection
+	// string.  With AAD, it's the bearer token.
+	mechanism, auth := "PLAIN", []byte("\x00$ConnectionString\x00"+c.opts.ConnectionString)
+	if c.auth.key == "" {
+		token, err := c.auth.authorization()
+		if err != nil {
+			k.Close()
+			return nil, err
+		}
+		mechanism, auth = "OAUTHBEARER", []byte("n,,\x01auth="+token+"\x01\x01")
+	}
+	if err = k.sasl(mechanism, auth, EventHubsKafkaTimeout); err != nil {
+		k.Close()
+		return nil, err
+	}
+	return k, nil
+}
+
+// startTimestamp returns the ListOffsets timestamp for the
+// StartPosition.
+func (c *EventHubsChan) startTimestamp() int64 {
+	if c.opts.StartPosition == "earliest" {
+		return kafkaEarliest
+	}
+	return kafkaLatest
+}
+
+// consume fetches events until the channel is closed.
+func (c *EventHubsChan) consume(ctx *dsl.Ctx) {
+	var (
+		offsets = make(map[int32]int64)
+		maxWait = time.Duration(c.opts.MaxWait) * time.Millisecond
+	)
+	ctx.Logf("EventHubsChan consuming %s", c.opts.Hub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.ctl:
+			return
+		default:
+		}
+
+		c.Lock()
+		for p, offset := range c.pending {
+			offsets[p] = offset
+		}
+		c.pending = make(map[int32]int64)
+		c.Unlock()
+
+		rs, err := c.kafka.fetch(c.opts.Hub, offsets, maxWait, EventHubsKafkaTimeout)
+		for _, r := range rs {
+			topic := strconv.Itoa(int(r.Partition))
+			if r.Key != nil {
+				topic = string(r.Key)
+			}
+			c.To(ctx, dsl.Msg{
+				Topic:   topic,
+				Payload: parseAzureBody(r.Value),
+			})
+		}
+		if err == nil {
+			continue
+		}
+
+		select {
+		case <-c.ctl:
+			return
+		default:
+		}
+		var ke *kafkaError
+		if errors.As(err, &ke) && ke.Code == kafkaOffsetOutOfRange {
+			ctx.Warnf("warning: EventHubsChan %s: %s; resetting offsets", c.opts.Hub, err)
+			ps := make([]int32, 0, len(offsets))
+			for p := range offsets {
+				ps = append(ps, p)
+			}
+			if reset, err := c.kafka.offsets(c.opts.Hub, ps, c.startTimestamp(), EventHubsKafkaTimeout); err == nil {
+				offsets = reset
+				continue
+			}
+		}
+		ctx.Warnf("warning: EventHubsChan receive from %s: %s", c.opts.Hub, err)
+		if !sleep(ctx, c.ctl, time.Second) {
+			return
+		}
+	}
+}
+
+func (c *EventHubsChan) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("EventHubsChan Pub to %s", c.opts.Hub)
+	var props map[string]interface{}
+	key := c.opts.PartitionKey
+	if m.Topic != "" {
+		key = m.Topic
+	}
+	if key != "" {
+		props = map[string]interface{}{
+			"PartitionKey": key,
+		}
+	}
+	return c.auth.send(c.opts.Hub, m.Payload, props)
+}
+
+func (c *EventHubsChan) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *EventHubsChan) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("Kill is not supported by a %T", c)
+}
+
+func (c *EventHubsChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("EventHubsChan To %s", m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *EventHubsChan) Overflow() error {
+	return c.buf.Overflow()
+}
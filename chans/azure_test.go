@@ -0,0 +1,319 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeServiceBus is a tiny imitation of the Service Bus REST API.
+type fakeServiceBus struct {
+	sync.Mutex
+	queues map[string][]string
+	props  []string
+	auths  []string
+}
+
+func (s *fakeServiceBus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.auths = append(s.auths, r.Header.Get("Authorization"))
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(path, "/messages"):
+		bs, _ := ioutil.ReadAll(r.Body)
+		q := strings.TrimSuffix(path, "/messages")
+		s.queues[q] = append(s.queues[q], string(bs))
+		s.props = append(s.props, r.Header.Get("BrokerProperties"))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "DELETE" && strings.HasSuffix(path, "/messages/head"):
+		q := strings.TrimSuffix(path, "/messages/head")
+		if len(s.queues[q]) == 0 {
+			s.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			s.Lock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		body := s.queues[q][0]
+		s.queues[q] = s.queues[q][1:]
+		w.Write([]byte(body))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSASToken(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+	got := SASToken("https://ns.servicebus.windows.net/", "RootManageSharedAccessKey", "secret", at)
+	want := "SharedAccessSignature sr=https%3A%2F%2Fns.servicebus.windows.net%2F&sig="
+	if !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "&se=1600000000&skn=RootManageSharedAccessKey") {
+		t.Fatal(got)
+	}
+	if got != SASToken("https://ns.servicebus.windows.net/", "RootManageSharedAccessKey", "secret", at) {
+		t.Fatal("not deterministic")
+	}
+}
+
+func TestServiceBus(t *testing.T) {
+	var (
+		ctx = dsl.NewCtx(context.Background())
+		fsb = &fakeServiceBus{
+			queues: make(map[string][]string),
+		}
+		s = httptest.NewServer(fsb)
+	)
+	defer s.Close()
+
+	c, err := NewServiceBusChan(ctx, map[string]interface{}{
+		"connectionstring": "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=k;SharedAccessKey=secret;EntityPath=orders",
+		"baseurl":          s.URL,
+		"waittimeseconds":  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Payload: map[string]interface{}{
+			"want": "tacos",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, dsl.Msg{
+		Payload: map[string]interface{}{
+			"body": "chips",
+			"properties": map[string]interface{}{
+				"Label": "snack",
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []interface{}{"tacos", "chips"} {
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		case m := <-c.Recv(ctx):
+			if m.Topic != "orders" {
+				t.Fatal(m.Topic)
+			}
+			if o, is := m.Payload.(map[string]interface{}); is {
+				if o["want"] != want {
+					t.Fatal(m.Payload)
+				}
+			} else if m.Payload != want {
+				t.Fatal(m.Payload)
+			}
+		}
+	}
+
+	fsb.Lock()
+	defer fsb.Unlock()
+	var props map[string]interface{}
+	if err = json.Unmarshal([]byte(fsb.props[1]), &props); err != nil || props["Label"] != "snack" {
+		t.Fatal(fsb.props)
+	}
+	if !strings.HasPrefix(fsb.auths[0], "SharedAccessSignature sr=https%3A%2F%2Fns.servicebus.windows.net%2F&") {
+		t.Fatal(fsb.auths[0])
+	}
+}
+
+func TestEventHubsAAD(t *testing.T) {
+	var (
+		ctx    = dsl.NewCtx(context.Background())
+		tokens = 0
+		fsb    = &fakeServiceBus{
+			queues: make(map[string][]string),
+		}
+		mux = http.NewServeMux()
+		s   = httptest.NewServer(mux)
+	)
+	defer s.Close()
+
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		tokens++
+		if r.FormValue("client_secret") != "shh" || r.FormValue("scope") != AzureServiceBusScope {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+	})
+	mux.Handle("/", fsb)
+
+	was := AzureAuthorityURL
+	AzureAuthorityURL = s.URL
+	defer func() {
+		AzureAuthorityURL = was
+	}()
+
+	c, err := NewEventHubsChan(ctx, EventHubsOpts{
+		AzureAuthOpts: AzureAuthOpts{
+			Namespace:    "ns.servicebus.windows.net",
+			TenantID:     "tenant",
+			ClientID:     "app",
+			ClientSecret: "shh",
+			BaseURL:      s.URL,
+		},
+		Hub: "telemetry",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = c.Pub(ctx, dsl.Msg{
+			Topic:   "device1",
+			Payload: `{"temp":20}`,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsb.Lock()
+	defer fsb.Unlock()
+	if tokens != 1 {
+		t.Fatal(tokens)
+	}
+	if len(fsb.queues["telemetry"]) != 2 || fsb.queues["telemetry"][0] != `{"temp":20}` {
+		t.Fatal(fsb.queues)
+	}
+	if fsb.auths[0] != "Bearer tok" || fsb.props[0] != `{"PartitionKey":"device1"}` {
+		t.Fatal(fsb.auths, fsb.props)
+	}
+}
+
+func TestEventHubsReceive(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+
+	fk := newFakeKafka(t, "telemetry", 2)
+	defer fk.Close()
+	fk.produce(0, []byte("device1"), []byte(`{"temp":20}`), false)
+
+	cs := "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=k;SharedAccessKey=secret;EntityPath=telemetry"
+	c, err := NewEventHubsChan(ctx, EventHubsOpts{
+		AzureAuthOpts: AzureAuthOpts{
+			ConnectionString: cs,
+		},
+		KafkaAddr:      fk.l.Addr().String(),
+		KafkaPlaintext: true,
+		StartPosition:  "earliest",
+		MaxWait:        50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Sub(ctx, "tacos"); err == nil {
+		t.Fatal("expected protest")
+	}
+	if err = c.Sub(ctx, "7"); err == nil {
+		t.Fatal("expected protest")
+	}
+	if err = c.Sub(ctx, "*"); err != nil {
+		t.Fatal(err)
+	}
+	// Another Sub for a partition we already have is harmless.
+	if err = c.Sub(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	recv := func() dsl.Msg {
+		select {
+		case m := <-c.Recv(ctx):
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return dsl.Msg{}
+	}
+
+	m := recv()
+	if m.Topic != "device1" || dsl.JSON(m.Payload) != `{"temp":20}` {
+		t.Fatal(m.Topic, dsl.JSON(m.Payload))
+	}
+
+	fk.produce(1, nil, []byte("hello"), true)
+	m = recv()
+	if m.Topic != "1" || m.Payload != "hello" {
+		t.Fatal(m.Topic, m.Payload)
+	}
+
+	fk.Lock()
+	defer fk.Unlock()
+	if len(fk.auths) != 2 || fk.auths[0] != "PLAIN" || fk.auths[1] != "\x00$ConnectionString\x00"+cs {
+		t.Fatal(fk.auths)
+	}
+}
+
+func TestAzureOpts(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+
+	if _, err := NewServiceBusChan(ctx, ServiceBusOpts{}); err == nil {
+		t.Fatal("no auth should be a problem")
+	}
+	if _, err := NewServiceBusChan(ctx, ServiceBusOpts{
+		AzureAuthOpts: AzureAuthOpts{
+			ConnectionString: "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=k;SharedAccessKey=secret",
+		},
+		Topic: "orders",
+	}); err == nil {
+		t.Fatal("topic without subscription should be a problem")
+	}
+	if _, err := NewEventHubsChan(ctx, EventHubsOpts{
+		AzureAuthOpts: AzureAuthOpts{
+			ConnectionString: "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=k;SharedAccessKey=secret",
+		},
+	}); err == nil {
+		t.Fatal("no hub should be a problem")
+	}
+	if _, err := NewEventHubsChan(ctx, EventHubsOpts{
+		AzureAuthOpts: AzureAuthOpts{
+			ConnectionString: "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=k;SharedAccessKey=secret",
+		},
+		Hub:           "telemetry",
+		StartPosition: "yesterday",
+	}); err == nil {
+		t.Fatal("bad StartPosition should be a problem")
+	}
+}
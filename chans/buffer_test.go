@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestChanBuffers(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+
+	for _, c := range []struct {
+		kind   string
+		make   dsl.ChanMaker
+		config map[string]interface{}
+	}{
+		{"nats", NewNATSChan, nil},
+		{"ssh", NewSSHChan, map[string]interface{}{"Host": "localhost"}},
+		{"docker", NewDockerChan, map[string]interface{}{"Image": "alpine"}},
+		{"k8s", NewK8sChan, nil},
+		{"s3", NewS3Chan, nil},
+		{"fswatch", NewFSWatchChan, nil},
+		{"email", NewEmailChan, nil},
+		{"servicebus", NewServiceBusChan, map[string]interface{}{
+			"ConnectionString": "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=k;SharedAccessKey=secret;EntityPath=orders",
+		}},
+		{"sqs", NewSQSChan, nil},
+		{"kds", NewKDSChan, nil},
+		{"mqttbroker", NewMQTTBrokerChan, nil},
+	} {
+		t.Run(c.kind, func(t *testing.T) {
+			config := func(policy string) map[string]interface{} {
+				acc := map[string]interface{}{
+					"BufferSize": 1,
+					"Overflow":   policy,
+				}
+				for k, v := range c.config {
+					acc[k] = v
+				}
+				return acc
+			}
+
+			if _, err := c.make(ctx, config("tacos")); err == nil {
+				t.Fatal("expected protest")
+			}
+
+			ch, err := c.make(ctx, config(dsl.OverflowDropOldest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, topic := range []string{"a", "b"} {
+				if err := ch.To(ctx, dsl.Msg{Topic: topic}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if m := <-ch.Recv(ctx); m.Topic != "b" {
+				t.Fatal(m.Topic)
+			}
+
+			ch, err = c.make(ctx, config(dsl.OverflowFailTest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ch.To(ctx, dsl.Msg{Topic: "a"})
+			if err := ch.To(ctx, dsl.Msg{Topic: "b"}); err == nil {
+				t.Fatal("expected an overflow")
+			}
+			if err := ch.(dsl.Overflower).Overflow(); err == nil {
+				t.Fatal("expected an overflow")
+			}
+		})
+	}
+}
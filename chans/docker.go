@@ -0,0 +1,411 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "docker", NewDockerChan)
+	dsl.TheChanDocs.Register("docker", "A Docker container (via the docker program) whose logs are received messages.", DockerOpts{})
+}
+
+// DockerOpts configures a Docker channel.
+type DockerOpts struct {
+	// Image is the container's image.
+	Image string `json:",omitempty" yaml:",omitempty" doc:"The container's image."`
+
+	// Name is the container's name, which defaults to a random
+	// name starting with "plax-".
+	Name string `json:",omitempty" yaml:",omitempty" doc:"The container's name (default is random)."`
+
+	// Env gives the container's environment variables.
+	Env map[string]string `json:",omitempty" yaml:",omitempty" doc:"Environment variables for the container."`
+
+	// Ports are port mappings (like "8080:80" or just "80" for a
+	// random host port).
+	Ports []string `json:",omitempty" yaml:",omitempty" doc:"Port mappings (HOSTPORT:CONTAINERPORT or CONTAINERPORT)."`
+
+	// Args are the container's command-line arguments.
+	Args []string `json:",omitempty" yaml:",omitempty" doc:"The container's command-line arguments."`
+
+	// Options are additional 'docker run' options (like
+	// "--network=host").
+	Options []string `json:",omitempty" yaml:",omitempty" doc:"Additional 'docker run' options."`
+
+	// ReadyPattern, when not empty, is a regular expression that
+	// a log line matches when the container is ready.
+	ReadyPattern string `json:",omitempty" yaml:",omitempty" doc:"Regular expression for a log line that indicates readiness."`
+
+	// ReadyHealthcheck, when true, makes the container ready when
+	// its healthcheck reports it's healthy.
+	ReadyHealthcheck bool `json:",omitempty" yaml:",omitempty" doc:"The container is ready when its healthcheck reports healthy."`
+
+	// ReadyTimeout is the timeout in milliseconds for readiness.
+	ReadyTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds to wait for readiness." default:"60000"`
+
+	// Keep, when true, leaves the container when the channel is
+	// closed.
+	Keep bool `json:",omitempty" yaml:",omitempty" doc:"Don't remove the container when the channel closes."`
+
+	// CommandTimeout is the timeout in milliseconds for docker
+	// commands (other than pulling the image).
+	CommandTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds to wait for docker commands." default:"30000"`
+
+	// Program is the docker program.
+	Program string `json:",omitempty" yaml:",omitempty" doc:"The docker program." default:"docker"`
+
+	// BufferSize is the capacity of the channel's dsl.Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// DockerReady is the payload of the message that reports that a
+// container is ready.
+type DockerReady struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Ports maps container ports (like "80/tcp") to host
+	// addresses (like "0.0.0.0:49153").
+	Ports map[string]string `json:"ports"`
+}
+
+// Docker is a channel for a Docker container, which the docker
+// program (see DockerOpts.Program) manages.
+//
+// Open runs the container.  Its log lines arrive as messages with
+// topics "stdout" and "stderr".  When the container is ready (see
+// ReadyPattern and ReadyHealthcheck), a message with topic "ready"
+// has a DockerReady payload.  When the container's logs end (because
+// the container stopped), a message with topic "exit" has the
+// container's exit code.  Close removes the container (unless Keep).
+//
+// A message published with topic "stop", "start", "restart",
+// "pause", or "unpause" does that to the container, and a message
+// with topic "exec" runs its payload as a command (via 'sh -c') in
+// the container and reports the ExecResult with topic "exec".
+type Docker struct {
+	opts  *DockerOpts
+	c     chan dsl.Msg
+	buf   *dsl.Buffer
+	ready *regexp.Regexp
+
+	id   string
+	logs *dsl.Process
+
+	// readied is closed when the container is ready.
+	readied   chan bool
+	readyOnce sync.Once
+}
+
+func NewDockerChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := DockerOpts{
+		ReadyTimeout:   60000,
+		CommandTimeout: 30000,
+		Program:        "docker",
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	if opts.Image == "" {
+		return nil, dsl.Brokenf("NewDockerChan: no Image")
+	}
+	if opts.Name == "" {
+		bs := make([]byte, 6)
+		if _, err := rand.Read(bs); err != nil {
+			return nil, err
+		}
+		opts.Name = "plax-" + hex.EncodeToString(bs)
+	}
+
+	buf, err := dsl.NewBuffer("docker", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Docker{
+		opts:    &opts,
+		c:       buf.C,
+		buf:     buf,
+		readied: make(chan bool),
+	}
+	if opts.ReadyPattern != "" {
+		r, err := regexp.Compile(opts.ReadyPattern)
+		if err != nil {
+			return nil, dsl.Brokenf("NewDockerChan: ReadyPattern: %s", err)
+		}
+		c.ready = r
+	}
+	return c, nil
+}
+
+func (c *Docker) Kind() dsl.ChanKind {
+	return "docker"
+}
+
+// docker runs the docker program with the given arguments.
+func (c *Docker) docker(ctx *dsl.Ctx, timeout time.Duration, args ...string) *ExecResult {
+	ctx.Logf("Docker %s: docker %s", c.opts.Name, strings.Join(args, " "))
+	return runCommand(ctx, strings.Join(args, " "), c.opts.Program, args, nil, nil, timeout)
+}
+
+func (c *Docker) timeout() time.Duration {
+	return time.Duration(c.opts.CommandTimeout) * time.Millisecond
+}
+
+// Open runs the container, starts following its logs, and starts
+// waiting for its readiness.
+func (c *Docker) Open(ctx *dsl.Ctx) error {
+	o := c.opts
+	args := []string{"run", "-d", "--name", o.Name}
+
+	// Sort the environment variables for predictable commands.
+	names := make([]string, 0, len(o.Env))
+	for name := range o.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-e", name+"="+o.Env[name])
+	}
+	for _, p := range o.Ports {
+		args = append(args, "-p", p)
+	}
+	args = append(args, o.Options...)
+	args = append(args, o.Image)
+	args = append(args, o.Args...)
+
+	// Running might need to pull the image, so we use the
+	// ReadyTimeout.
+	x := c.docker(ctx, time.Duration(o.ReadyTimeout)*time.Millisecond, args...)
+	if err := x.problem(); err != nil {
+		return dsl.NewBroken(err)
+	}
+	c.id = x.Stdout
+
+	c.logs = &dsl.Process{
+		Name:    "docker logs " + o.Name,
+		Command: o.Program,
+		Args:    []string{"logs", "-f", o.Name},
+	}
+	if err := c.logs.Start(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line := <-c.logs.Stdout:
+				c.logLine(ctx, "stdout", line)
+			case line := <-c.logs.Stderr:
+				c.logLine(ctx, "stderr", line)
+			case <-c.logs.Exited:
+				c.exited(ctx)
+				return
+			}
+		}
+	}()
+
+	go c.awaitReady(ctx)
+
+	return nil
+}
+
+// logLine delivers a log line and checks it for readiness.
+func (c *Docker) logLine(ctx *dsl.Ctx, topic, line string) {
+	c.To(ctx, dsl.Msg{Topic: topic, Payload: line})
+	if c.ready != nil && c.ready.MatchString(line) {
+		c.readyOnce.Do(func() {
+			close(c.readied)
+		})
+	}
+}
+
+// exited reports the container's exit code.
+func (c *Docker) exited(ctx *dsl.Ctx) {
+	x := c.docker(ctx, c.timeout(), "inspect", "-f", "{{.State.ExitCode}}", c.opts.Name)
+	var code interface{} = x.Stdout
+	if err := x.problem(); err != nil {
+		code = nil
+	} else {
+		var n int
+		if _, err := fmt.Sscanf(x.Stdout, "%d", &n); err == nil {
+			code = n
+		}
+	}
+	c.To(ctx, dsl.Msg{
+		Topic: "exit",
+		Payload: dsl.Canon(map[string]interface{}{
+			"code": code,
+		}),
+	})
+}
+
+// awaitReady waits for readiness and then delivers the "ready"
+// message.
+func (c *Docker) awaitReady(ctx *dsl.Ctx) {
+	var (
+		timeout = time.Duration(c.opts.ReadyTimeout) * time.Millisecond
+		timer   = time.NewTimer(timeout)
+	)
+	defer timer.Stop()
+
+	if c.opts.ReadyHealthcheck {
+		go func() {
+			for {
+				x := c.docker(ctx, c.timeout(), "inspect", "-f", "{{.State.Health.Status}}", c.opts.Name)
+				if x.Stdout == "healthy" {
+					c.readyOnce.Do(func() {
+						close(c.readied)
+					})
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-c.readied:
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}()
+	} else if c.ready == nil {
+		c.readyOnce.Do(func() {
+			close(c.readied)
+		})
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+		ctx.Warnf("warning: Docker %s not ready after %s", c.opts.Name, timeout)
+		return
+	case <-c.readied:
+	}
+
+	r := &DockerReady{
+		ID:    c.id,
+		Name:  c.opts.Name,
+		Ports: make(map[string]string),
+	}
+	x := c.docker(ctx, c.timeout(), "port", c.opts.Name)
+	if err := x.problem(); err != nil {
+		ctx.Warnf("warning: Docker %s ports: %s", c.opts.Name, err)
+	}
+	for _, line := range strings.Split(x.Stdout, "\n") {
+		// Like "80/tcp -> 0.0.0.0:49153".
+		parts := strings.SplitN(line, " -> ", 2)
+		if len(parts) == 2 {
+			if _, have := r.Ports[parts[0]]; !have {
+				r.Ports[parts[0]] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	c.To(ctx, dsl.Msg{
+		Topic:   "ready",
+		Payload: dsl.Canon(r),
+	})
+}
+
+// Close stops following the logs and removes the container (unless
+// Keep).
+func (c *Docker) Close(ctx *dsl.Ctx) error {
+	ctx.Logf("Docker %s Close", c.opts.Name)
+	if c.id == "" {
+		return nil
+	}
+	if c.logs != nil {
+		c.logs.Stop(ctx)
+	}
+	if c.opts.Keep {
+		return nil
+	}
+	return c.docker(ctx, c.timeout(), "rm", "-f", c.opts.Name).problem()
+}
+
+func (c *Docker) Sub(ctx *dsl.Ctx, topic string) error {
+	return fmt.Errorf("%T doesn't support 'sub'", c)
+}
+
+// Pub controls the container or runs a command in it.  See Docker.
+func (c *Docker) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("Docker %s Pub %s", c.opts.Name, m.Topic)
+	switch m.Topic {
+	case "stop", "start", "restart", "pause", "unpause":
+		return c.docker(ctx, c.timeout(), m.Topic, c.opts.Name).problem()
+	case "exec":
+		command, is := m.Payload.(string)
+		if !is {
+			command = dsl.JSON(m.Payload)
+		}
+		go func() {
+			x := c.docker(ctx, c.timeout(), "exec", c.opts.Name, "sh", "-c", command)
+			x.Command = command
+			c.To(ctx, dsl.Msg{
+				Topic:   "exec",
+				Payload: dsl.Canon(x),
+			})
+		}()
+		return nil
+	default:
+		return fmt.Errorf("Docker %s: unknown topic '%s'", c.opts.Name, m.Topic)
+	}
+}
+
+func (c *Docker) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+// Kill kills the container.
+func (c *Docker) Kill(ctx *dsl.Ctx) error {
+	return c.docker(ctx, c.timeout(), "kill", c.opts.Name).problem()
+}
+
+func (c *Docker) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("Docker %s To %s", c.opts.Name, m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *Docker) Overflow() error {
+	return c.buf.Overflow()
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeDocker is a shell script that imitates enough of the docker
+// program, and it records its commands in the file "commands".
+const fakeDocker = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$*" >> "$dir/commands"
+case "$1" in
+run) echo 0123456789ab ;;
+logs) echo starting; echo "warming up" >&2; echo "listening on 80"; sleep 1 ;;
+inspect)
+  case "$3" in
+  *Health*) echo healthy ;;
+  *) echo 0 ;;
+  esac ;;
+port) echo "80/tcp -> 0.0.0.0:49153"; echo "80/tcp -> :::49153" ;;
+exec) shift 2; exec "$@" ;;
+stop|start|rm|kill) ;;
+*) echo "unknown command $1" >&2; exit 1 ;;
+esac
+`
+
+func TestDocker(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+
+	dir, err := ioutil.TempDir("", "plax-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	program := filepath.Join(dir, "docker")
+	if err = ioutil.WriteFile(program, []byte(fakeDocker), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsl.NewCtx(context.Background())
+
+	// Stdout and stderr lines can arrive in any order, so recv
+	// keeps the messages it isn't looking for.
+	var pending []dsl.Msg
+	recv := func(c dsl.Chan, topic string) interface{} {
+		for i, m := range pending {
+			if m.Topic == topic {
+				pending = append(pending[:i], pending[i+1:]...)
+				return m.Payload
+			}
+		}
+		for {
+			select {
+			case m := <-c.Recv(ctx):
+				if m.Topic == topic {
+					return m.Payload
+				}
+				pending = append(pending, m)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for %s", topic)
+			}
+		}
+	}
+
+	c, err := NewDockerChan(ctx, DockerOpts{
+		Image: "nginx",
+		Name:  "web",
+		Env: map[string]string{
+			"B": "2",
+			"A": "1",
+		},
+		Ports:        []string{"80"},
+		ReadyPattern: "listening on",
+		Program:      program,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if x := recv(c, "stderr"); x != "warming up" {
+		t.Fatal(x)
+	}
+	r := recv(c, "ready").(map[string]interface{})
+	if r["id"] != "0123456789ab" || r["ports"].(map[string]interface{})["80/tcp"] != "0.0.0.0:49153" {
+		t.Fatal(r)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "exec",
+		Payload: "echo hi; exit 2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	x := recv(c, "exec").(map[string]interface{})
+	if x["stdout"] != "hi" || x["code"] != 2.0 || x["command"] != "echo hi; exit 2" {
+		t.Fatal(x)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{Topic: "stop"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, dsl.Msg{Topic: "frob"}); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	if x := recv(c, "exit").(map[string]interface{}); x["code"] != 0.0 {
+		t.Fatal(x)
+	}
+
+	if err = c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "commands"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := string(bs)
+	for _, want := range []string{
+		"run -d --name web -e A=1 -e B=2 -p 80 nginx\n",
+		"logs -f web\n",
+		"stop web\n",
+		"rm -f web\n",
+	} {
+		if !strings.Contains(commands, want) {
+			t.Fatalf("%q doesn't have %q", commands, want)
+		}
+	}
+}
+
+func TestDockerHealthcheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+
+	dir, err := ioutil.TempDir("", "plax-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	program := filepath.Join(dir, "docker")
+	if err = ioutil.WriteFile(program, []byte(fakeDocker), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsl.NewCtx(context.Background())
+	c, err := NewDockerChan(ctx, DockerOpts{
+		Image:            "postgres",
+		ReadyHealthcheck: true,
+		Program:          program,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-c.Recv(ctx):
+			if m.Topic == "ready" {
+				name := m.Payload.(map[string]interface{})["name"].(string)
+				if !strings.HasPrefix(name, "plax-") {
+					t.Fatal(name)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout")
+		}
+	}
+}
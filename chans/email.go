@@ -0,0 +1,650 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "email", NewEmailChan)
+	dsl.TheChanDocs.Register("email", "Sends email via SMTP and receives email by polling an IMAP mailbox.", EmailOpts{})
+}
+
+// EmailServerOpts configures the connection to an SMTP or IMAP
+// server.
+type EmailServerOpts struct {
+	// Addr is the server's HOST:PORT.
+	Addr string `json:",omitempty" yaml:",omitempty" doc:"The server's HOST:PORT."`
+
+	// TLS is "tls" (TLS from the start), "starttls", or "none".
+	// The default is "starttls" for SMTP (which is only used if
+	// the server offers it) and "tls" for IMAP.
+	TLS string `json:",omitempty" yaml:",omitempty" doc:"tls, starttls, or none (default starttls for SMTP and tls for IMAP)."`
+
+	Username string `json:",omitempty" yaml:",omitempty" doc:"Username for authentication."`
+	Password string `json:",omitempty" yaml:",omitempty" doc:"Password for authentication."`
+
+	// Insecure, when true, skips verification of the server's
+	// certificate.
+	Insecure bool `json:",omitempty" yaml:",omitempty" doc:"Skip verification of the server's certificate (for testing only)."`
+}
+
+func (o *EmailServerOpts) tlsConfig() *tls.Config {
+	host, _, _ := net.SplitHostPort(o.Addr)
+	return &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: o.Insecure,
+	}
+}
+
+// EmailOpts configures an Email channel.
+type EmailOpts struct {
+	// SMTP is the server for sending (Pub).
+	SMTP EmailServerOpts `json:",omitempty" yaml:",omitempty" doc:"The SMTP server for pub."`
+
+	// IMAP is the server for receiving (Sub).
+	IMAP EmailServerOpts `json:",omitempty" yaml:",omitempty" doc:"The IMAP server for sub."`
+
+	// From is the default sender.
+	From string `json:",omitempty" yaml:",omitempty" doc:"The default sender."`
+
+	// To is the default list of recipients.
+	To []string `json:",omitempty" yaml:",omitempty" doc:"The default recipients."`
+
+	// PollInterval is the interval in milliseconds between checks
+	// of each mailbox.
+	PollInterval int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds between checks of a mailbox." default:"5000"`
+
+	// Existing, when true, reports the messages that are already
+	// in a mailbox when a Sub starts.
+	Existing bool `json:",omitempty" yaml:",omitempty" doc:"Report messages that are in a mailbox when a sub starts."`
+
+	// Timeout is the timeout in milliseconds for each
+	// conversation with a server.
+	Timeout int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds for each conversation with a server." default:"30000"`
+
+	// BufferSize is the size of the underlying channel buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// EmailSend is the payload of a message that Pub sends.
+type EmailSend struct {
+	From    string            `json:"from,omitempty"`
+	To      []string          `json:"to,omitempty"`
+	Cc      []string          `json:"cc,omitempty"`
+	Bcc     []string          `json:"bcc,omitempty"`
+	Subject string            `json:"subject,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// EmailReceived is the payload of a message that reports a received
+// email.
+type EmailReceived struct {
+	Mailbox   string    `json:"mailbox"`
+	UID       uint32    `json:"uid"`
+	MessageID string    `json:"messageid,omitempty"`
+	Date      time.Time `json:"date,omitempty"`
+	From      string    `json:"from,omitempty"`
+	To        []string  `json:"to,omitempty"`
+	Cc        []string  `json:"cc,omitempty"`
+	Subject   string    `json:"subject"`
+
+	// Headers has the first value of each header (decoded).
+	Headers map[string]string `json:"headers,omitempty"`
+
+	Text        string             `json:"text,omitempty"`
+	HTML        string             `json:"html,omitempty"`
+	Attachments []*EmailAttachment `json:"attachments,omitempty"`
+}
+
+// EmailAttachment describes (but doesn't include) an attachment.
+type EmailAttachment struct {
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contenttype"`
+	Size        int    `json:"size"`
+}
+
+// Email is a channel that sends email via SMTP and receives email
+// from an IMAP server.
+//
+// A Pub sends an email.  The payload is an EmailSend or a string,
+// which is the email's text.  The message's topic is the subject if
+// the payload doesn't give one.  Recipients and the sender default
+// to the To and From options.
+//
+// A Sub with a topic that's a mailbox (default "INBOX") starts
+// polling that mailbox, and the channel receives a message (with the
+// mailbox as its topic) for each new email.  See EmailReceived.  The
+// channel doesn't change the mailbox; in particular, it doesn't mark
+// messages as seen.
+type Email struct {
+	opts *EmailOpts
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+
+	ctl       chan bool
+	closeOnce sync.Once
+}
+
+func NewEmailChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := EmailOpts{
+		PollInterval: 5000,
+		Timeout:      30000,
+		BufferSize:   DefaultChanBufferSize,
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	if opts.SMTP.TLS == "" {
+		opts.SMTP.TLS = "starttls"
+	}
+	if opts.IMAP.TLS == "" {
+		opts.IMAP.TLS = "tls"
+	}
+	for _, o := range []*EmailServerOpts{&opts.SMTP, &opts.IMAP} {
+		switch o.TLS {
+		case "tls", "starttls", "none":
+		default:
+			return nil, dsl.Brokenf("NewEmailChan: TLS '%s' isn't tls, starttls, or none", o.TLS)
+		}
+	}
+	if opts.PollInterval <= 0 {
+		return nil, dsl.Brokenf("NewEmailChan: PollInterval %d isn't positive", opts.PollInterval)
+	}
+
+	buf, err := dsl.NewBuffer("email", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Email{
+		opts: &opts,
+		c:    buf.C,
+		buf:  buf,
+		ctl:  make(chan bool),
+	}, nil
+}
+
+func (c *Email) Kind() dsl.ChanKind {
+	return "email"
+}
+
+func (c *Email) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *Email) Close(ctx *dsl.Ctx) error {
+	c.closeOnce.Do(func() {
+		close(c.ctl)
+	})
+	return nil
+}
+
+func (c *Email) timeout() time.Duration {
+	return time.Duration(c.opts.Timeout) * time.Millisecond
+}
+
+// Pub sends an email.  See Email.
+func (c *Email) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	var e EmailSend
+	if s, is := m.Payload.(string); is {
+		e.Text = s
+	} else if err := dsl.As(m.Payload, &e); err != nil {
+		return err
+	}
+	if e.Subject == "" {
+		e.Subject = m.Topic
+	}
+	if e.From == "" {
+		e.From = c.opts.From
+	}
+	if len(e.To) == 0 && len(e.Cc) == 0 && len(e.Bcc) == 0 {
+		e.To = c.opts.To
+	}
+	if e.From == "" {
+		return fmt.Errorf("Email Pub has no sender (from)")
+	}
+
+	rcpts := make([]string, 0, len(e.To)+len(e.Cc)+len(e.Bcc))
+	for _, list := range [][]string{e.To, e.Cc, e.Bcc} {
+		for _, a := range list {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return fmt.Errorf("Email recipient '%s': %w", a, err)
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+	if len(rcpts) == 0 {
+		return fmt.Errorf("Email Pub has no recipients")
+	}
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return fmt.Errorf("Email sender '%s': %w", e.From, err)
+	}
+
+	msg, err := e.message()
+	if err != nil {
+		return err
+	}
+
+	ctx.Logf("Email Pub '%s' to %s", e.Subject, strings.Join(rcpts, ","))
+	return c.send(from.Address, rcpts, msg)
+}
+
+// message renders the email as an RFC 5322 message.
+func (e *EmailSend) message() ([]byte, error) {
+	var (
+		buf = &bytes.Buffer{}
+		id  = make([]byte, 12)
+	)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	header := func(name, value string) {
+		fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+	}
+	header("From", e.From)
+	if 0 < len(e.To) {
+		header("To", strings.Join(e.To, ", "))
+	}
+	if 0 < len(e.Cc) {
+		header("Cc", strings.Join(e.Cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", e.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@plax>")
+	header("MIME-Version", "1.0")
+
+	names := make([]string, 0, len(e.Headers))
+	for name := range e.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(name, mime.QEncoding.Encode("utf-8", e.Headers[name]))
+	}
+
+	if e.HTML == "" || e.Text == "" {
+		ct, body := "text/plain", e.Text
+		if e.HTML != "" {
+			ct, body = "text/html", e.HTML
+		}
+		header("Content-Type", ct+"; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ ct, body string }{
+		{"text/plain", e.Text},
+		{"text/html", e.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.ct + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// send delivers the message via the SMTP server.
+func (c *Email) send(from string, rcpts []string, msg []byte) error {
+	var (
+		o    = &c.opts.SMTP
+		conn net.Conn
+		err  error
+		d    = &net.Dialer{Timeout: c.timeout()}
+	)
+	if o.Addr == "" {
+		return fmt.Errorf("Email has no SMTP server (smtp.addr)")
+	}
+	if o.TLS == "tls" {
+		conn, err = tls.DialWithDialer(d, "tcp", o.Addr, o.tlsConfig())
+	} else {
+		conn, err = d.Dial("tcp", o.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(c.timeout()))
+
+	host, _, _ := net.SplitHostPort(o.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if o.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(o.tlsConfig()); err != nil {
+				return err
+			}
+		}
+	}
+	if o.Username != "" {
+		// PlainAuth refuses to send the password without TLS
+		// (except to localhost).
+		if err = client.Auth(smtp.PlainAuth("", o.Username, o.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range rcpts {
+		if err = client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Sub starts polling a mailbox.  See Email.
+func (c *Email) Sub(ctx *dsl.Ctx, topic string) error {
+	mailbox := topic
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if c.opts.IMAP.Addr == "" {
+		return fmt.Errorf("Email has no IMAP server (imap.addr)")
+	}
+	ctx.Logf("Email Sub %s", mailbox)
+
+	// Get the baseline before returning so that the test's
+	// subsequent steps see new messages.
+	var next uint32 = 1
+	uids, err := c.check(ctx, mailbox, 1, !c.opts.Existing)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if next <= uid {
+			next = uid + 1
+		}
+	}
+
+	go c.poll(ctx, mailbox, next)
+
+	return nil
+}
+
+// poll checks the mailbox every PollInterval.
+func (c *Email) poll(ctx *dsl.Ctx, mailbox string, next uint32) {
+	interval := time.Duration(c.opts.PollInterval) * time.Millisecond
+	for sleep(ctx, c.ctl, interval) {
+		uids, err := c.check(ctx, mailbox, next, false)
+		if err != nil {
+			ctx.Warnf("warning: Email %s: %s", mailbox, err)
+			continue
+		}
+		for _, uid := range uids {
+			if next <= uid {
+				next = uid + 1
+			}
+		}
+	}
+}
+
+// check reports (unless quiet) the messages in the mailbox whose UIDs
+// are at least min, and it returns their UIDs.
+func (c *Email) check(ctx *dsl.Ctx, mailbox string, min uint32, quiet bool) ([]uint32, error) {
+	o := &c.opts.IMAP
+	client, err := dialIMAP(o.Addr, o.TLS, o.tlsConfig(), c.timeout())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if o.Username != "" {
+		if err = client.Login(o.Username, o.Password); err != nil {
+			return nil, err
+		}
+	}
+	if err = client.Examine(mailbox); err != nil {
+		return nil, err
+	}
+	uids, err := client.Search(min)
+	if err != nil {
+		return nil, err
+	}
+	if !quiet {
+		for _, uid := range uids {
+			raw, err := client.Fetch(uid)
+			if err != nil {
+				return nil, err
+			}
+			e, err := ParseEmail(raw)
+			if err != nil {
+				ctx.Warnf("warning: Email %s UID %d: %s", mailbox, uid, err)
+				continue
+			}
+			e.Mailbox = mailbox
+			e.UID = uid
+			c.To(ctx, dsl.Msg{
+				Topic:   mailbox,
+				Payload: dsl.Canon(e),
+			})
+		}
+	}
+	client.Logout()
+	return uids, nil
+}
+
+// ParseEmail parses an RFC 5322 message (with MIME parts).
+func ParseEmail(raw []byte) (*EmailReceived, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dec = &mime.WordDecoder{}
+		e   = &EmailReceived{
+			Headers: make(map[string]string, len(m.Header)),
+		}
+		addresses = func(name string) []string {
+			as, _ := m.Header.AddressList(name)
+			acc := make([]string, 0, len(as))
+			for _, a := range as {
+				acc = append(acc, a.Address)
+			}
+			return acc
+		}
+	)
+
+	for name, vs := range m.Header {
+		if v, err := dec.DecodeHeader(vs[0]); err == nil {
+			e.Headers[name] = v
+		} else {
+			e.Headers[name] = vs[0]
+		}
+	}
+	e.Subject = e.Headers["Subject"]
+	e.MessageID = strings.Trim(m.Header.Get("Message-Id"), "<>")
+	if from := addresses("From"); 0 < len(from) {
+		e.From = from[0]
+	}
+	e.To = addresses("To")
+	e.Cc = addresses("Cc")
+	if t, err := m.Header.Date(); err == nil {
+		e.Date = t.UTC()
+	}
+
+	if err = e.part(textproto.MIMEHeader(m.Header), m.Body); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// part processes one (possibly multipart) MIME part.
+func (e *EmailReceived) part(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err = e.part(p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	// multipart.Reader has already decoded quoted-printable
+	// parts (and removed their Content-Transfer-Encoding).
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	bs, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	var (
+		disposition, dparams, _ = mime.ParseMediaType(header.Get("Content-Disposition"))
+		filename                = dparams["filename"]
+	)
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename != "" {
+		if s, err := (&mime.WordDecoder{}).DecodeHeader(filename); err == nil {
+			filename = s
+		}
+	}
+
+	switch {
+	case disposition == "attachment" || filename != "":
+		e.Attachments = append(e.Attachments, &EmailAttachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Size:        len(bs),
+		})
+	case mediaType == "text/plain" && e.Text == "":
+		e.Text = emailText(bs)
+	case mediaType == "text/html" && e.HTML == "":
+		e.HTML = emailText(bs)
+	}
+	return nil
+}
+
+// emailText normalizes line endings and removes trailing newlines.
+func emailText(bs []byte) string {
+	s := strings.ReplaceAll(string(bs), "\r\n", "\n")
+	return strings.TrimRight(s, "\n")
+}
+
+func (c *Email) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *Email) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("Kill is not supported by a %T", c)
+}
+
+func (c *Email) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("Email To %s", m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *Email) Overflow() error {
+	return c.buf.Overflow()
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeMail is a tiny SMTP server that delivers to a mailbox that a
+// tiny IMAP server serves.
+type fakeMail struct {
+	sync.Mutex
+	messages [][]byte
+	rcpts    []string
+	auth     string
+}
+
+func (f *fakeMail) listen(t *testing.T, serve func(net.Conn)) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func (f *fakeMail) smtp(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "220 fake\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			fmt.Fprintf(conn, "250-fake\r\n250 AUTH PLAIN\r\n")
+		case "AUTH":
+			f.Lock()
+			bs, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[2])
+			f.auth = string(bs)
+			f.Unlock()
+			fmt.Fprintf(conn, "235 ok\r\n")
+		case "RCPT":
+			f.Lock()
+			f.rcpts = append(f.rcpts, line)
+			f.Unlock()
+			fmt.Fprintf(conn, "250 ok\r\n")
+		case "DATA":
+			fmt.Fprintf(conn, "354 go\r\n")
+			var msg []string
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				msg = append(msg, strings.TrimPrefix(line, "."))
+			}
+			f.Lock()
+			f.messages = append(f.messages, []byte(strings.Join(msg, "")))
+			f.Unlock()
+			fmt.Fprintf(conn, "250 ok\r\n")
+		case "QUIT":
+			fmt.Fprintf(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprintf(conn, "250 ok\r\n")
+		}
+	}
+}
+
+// imap serves the messages, whose UIDs are their positions (plus
+// one).
+func (f *fakeMail) imap(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "* OK fake\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		parts := strings.Fields(line)
+		tag, command := parts[0], strings.ToUpper(strings.Join(parts[1:], " "))
+
+		f.Lock()
+		n := len(f.messages)
+		switch {
+		case strings.HasPrefix(command, "LOGIN"):
+			if parts[2] != `"homer"` {
+				fmt.Fprintf(conn, "%s NO bad login\r\n", tag)
+				break
+			}
+			fmt.Fprintf(conn, "%s OK\r\n", tag)
+		case strings.HasPrefix(command, "EXAMINE"):
+			fmt.Fprintf(conn, "* %d EXISTS\r\n%s OK [READ-ONLY]\r\n", n, tag)
+		case strings.HasPrefix(command, "UID SEARCH"):
+			min := 1
+			if strings.HasPrefix(command, "UID SEARCH UID ") {
+				min, _ = strconv.Atoi(strings.TrimSuffix(parts[4], ":*"))
+				if n < min && 0 < n {
+					// Like a real server.
+					min = n
+				}
+			}
+			fmt.Fprintf(conn, "* SEARCH")
+			for uid := min; uid <= n; uid++ {
+				fmt.Fprintf(conn, " %d", uid)
+			}
+			fmt.Fprintf(conn, "\r\n%s OK\r\n", tag)
+		case strings.HasPrefix(command, "UID FETCH"):
+			uid, _ := strconv.Atoi(parts[3])
+			msg := f.messages[uid-1]
+			fmt.Fprintf(conn, "* %d FETCH (UID %d BODY[] {%d}\r\n%s)\r\n%s OK\r\n", uid, uid, len(msg), msg, tag)
+		case strings.HasPrefix(command, "LOGOUT"):
+			fmt.Fprintf(conn, "* BYE\r\n%s OK\r\n", tag)
+			f.Unlock()
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD\r\n", tag)
+		}
+		f.Unlock()
+	}
+}
+
+const testEmailWithAttachment = "From: Alerts <alerts@example.com>\r\n" +
+	"To: ops@example.com\r\n" +
+	"Subject: =?utf-8?q?Disk_=C3=A0_90%?=\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=XX\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"RGlzayBpcyBmdWxsLgo=\r\n" +
+	"--XX\r\n" +
+	"Content-Type: application/pdf; name=\"report.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"AAECAwQ=\r\n" +
+	"--XX--\r\n"
+
+func TestEmail(t *testing.T) {
+	var (
+		ctx   = dsl.NewCtx(context.Background())
+		f     = &fakeMail{messages: [][]byte{[]byte(testEmailWithAttachment)}}
+		smtpL = f.listen(t, f.smtp)
+		imapL = f.listen(t, f.imap)
+	)
+	defer smtpL.Close()
+	defer imapL.Close()
+
+	recv := func(c dsl.Chan) dsl.Msg {
+		select {
+		case m := <-c.Recv(ctx):
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return dsl.Msg{}
+	}
+
+	c, err := NewEmailChan(ctx, EmailOpts{
+		SMTP: EmailServerOpts{
+			Addr:     smtpL.Addr().String(),
+			Username: "homer",
+			Password: "donuts",
+		},
+		IMAP: EmailServerOpts{
+			Addr:     imapL.Addr().String(),
+			TLS:      "none",
+			Username: "homer",
+			Password: "donuts",
+		},
+		From:         "plax@example.com",
+		To:           []string{"Ops <ops@example.com>"},
+		PollInterval: 20,
+		Existing:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Sub(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	m := recv(c)
+	x := m.Payload.(map[string]interface{})
+	if m.Topic != "INBOX" || x["subject"] != "Disk à 90%" || x["text"] != "Disk is full." ||
+		x["from"] != "alerts@example.com" || x["messageid"] != "1@example.com" || x["uid"] != 1.0 {
+		t.Fatal(x)
+	}
+	a := x["attachments"].([]interface{})[0].(map[string]interface{})
+	if a["filename"] != "report.pdf" || a["contenttype"] != "application/pdf" || a["size"] != 5.0 {
+		t.Fatal(a)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Payload: map[string]interface{}{
+			"subject": "Café",
+			"text":    "Hello.\n.Dots.",
+			"html":    "<p>Hello.</p>",
+			"cc":      []interface{}{"boss@example.com"},
+			"headers": map[string]interface{}{
+				"X-Run": "42",
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if x["subject"] != "Café" || x["text"] != "Hello.\n.Dots." || x["html"] != "<p>Hello.</p>" ||
+		x["from"] != "plax@example.com" || x["uid"] != 2.0 || x["headers"].(map[string]interface{})["X-Run"] != "42" {
+		t.Fatal(x)
+	}
+
+	f.Lock()
+	if len(f.rcpts) != 1 || f.rcpts[0] != "RCPT TO:<boss@example.com>" || f.auth != "\x00homer\x00donuts" {
+		t.Fatal(f.rcpts, f.auth)
+	}
+	f.Unlock()
+
+	// A string payload is the text, and the topic is the subject.
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "Status",
+		Payload: "All good.",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if x["subject"] != "Status" || x["text"] != "All good." || x["to"].([]interface{})[0] != "ops@example.com" {
+		t.Fatal(x)
+	}
+
+	// No duplicates.
+	select {
+	case m := <-c.Recv(ctx):
+		t.Fatal(m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEmailBadLogin(t *testing.T) {
+	var (
+		ctx   = dsl.NewCtx(context.Background())
+		f     = &fakeMail{}
+		imapL = f.listen(t, f.imap)
+	)
+	defer imapL.Close()
+
+	c, err := NewEmailChan(ctx, EmailOpts{
+		IMAP: EmailServerOpts{
+			Addr:     imapL.Addr().String(),
+			TLS:      "none",
+			Username: "marge",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Sub(ctx, "INBOX"); err == nil || !strings.Contains(err.Error(), "bad login") {
+		t.Fatal(err)
+	}
+
+	if _, err = NewEmailChan(ctx, EmailOpts{
+		SMTP: EmailServerOpts{
+			TLS: "maybe",
+		},
+	}); err == nil {
+		t.Fatal("should have complained")
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// ExecResult is the result of a command that a channel runs (like an
+// 'ssh' channel's remote command).
+type ExecResult struct {
+	Command string `json:"command"`
+
+	// Stdout and Stderr are the command's output without any
+	// trailing newlines.
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+
+	// Code is the exit code (or -1 if the command didn't exit
+	// normally).
+	Code int `json:"code"`
+
+	// Error reports a problem running the command.
+	Error string `json:"error,omitempty"`
+}
+
+// runCommand runs the program (with the given stdin, which can be
+// nil) and returns its ExecResult, which reports the given command.
+func runCommand(ctx *dsl.Ctx, command, program string, args []string, env map[string]string, stdin io.Reader, timeout time.Duration) *ExecResult {
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(cctx, program, args...)
+	if env != nil {
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, &stdout, &stderr
+
+	err := cmd.Run()
+
+	x := &ExecResult{
+		Command: command,
+		Stdout:  strings.TrimRight(stdout.String(), "\r\n"),
+		Stderr:  strings.TrimRight(stderr.String(), "\r\n"),
+		Code:    -1,
+	}
+	if ps := cmd.ProcessState; ps != nil {
+		x.Code = ps.ExitCode()
+	}
+	if err != nil {
+		if cctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timeout after %s", timeout)
+		}
+		if _, is := err.(*exec.ExitError); !is || cctx.Err() != nil {
+			x.Error = err.Error()
+		}
+	}
+	return x
+}
+
+// problem returns an error for a failed command (or nil).
+func (x *ExecResult) problem() error {
+	switch {
+	case x.Error != "":
+		return fmt.Errorf("%s: %s", x.Command, x.Error)
+	case x.Code != 0:
+		return fmt.Errorf("%s: exit code %d: %s", x.Command, x.Code, x.Stderr)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "fswatch", NewFSWatchChan)
+	dsl.TheChanDocs.Register("fswatch", "Watches files (by polling) for creations, modifications, and deletions, and writes files.", FSWatchOpts{})
+}
+
+// FSWatchOpts configures an FSWatch channel.
+type FSWatchOpts struct {
+	// Dir is the directory that topics are relative to.  A
+	// relative Dir is relative to the test's directory.
+	Dir string `json:",omitempty" yaml:",omitempty" doc:"Directory that topics are relative to (relative to the test's directory)." default:"."`
+
+	// PollInterval is the interval in milliseconds between scans
+	// for each Sub.
+	PollInterval int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds between scans." default:"500"`
+
+	// Existing, when true, reports the files that already exist
+	// when a Sub starts.
+	Existing bool `json:",omitempty" yaml:",omitempty" doc:"Report files that exist when a sub starts."`
+
+	// Fetch, when true, includes the contents of each new or
+	// modified file (parsed as JSON if possible).
+	Fetch bool `json:",omitempty" yaml:",omitempty" doc:"Include the contents of new and modified files."`
+
+	// BufferSize is the size of the underlying channel buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// FSEvent is the payload of a message that reports a file.
+type FSEvent struct {
+	// Event is "existing", "created", "modified", or "deleted".
+	Event string `json:"event"`
+
+	// Path is the file's path relative to the channel's Dir.
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modtime"`
+
+	// Body is the file's contents (see FSWatchOpts.Fetch).
+	Body interface{} `json:"body,omitempty"`
+}
+
+// FSWatch is a channel that watches files by polling.
+//
+// A Sub with a topic that's a glob pattern (like "in/*.csv") or a
+// directory (which means all of the directory's files) starts
+// watching those files, and the channel receives messages (with the
+// files' paths as topics) that report created, modified, and deleted
+// files.  See FSEvent.
+//
+// A Pub writes its payload (a string as is and anything else as
+// JSON) to the file named by the message's topic.  The write is
+// atomic (via a rename), so a watcher doesn't see a partial file.
+type FSWatch struct {
+	opts *FSWatchOpts
+	dir  string
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+
+	ctl       chan bool
+	closeOnce sync.Once
+}
+
+func NewFSWatchChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := FSWatchOpts{
+		Dir:          ".",
+		PollInterval: 500,
+		BufferSize:   DefaultChanBufferSize,
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	if opts.PollInterval <= 0 {
+		return nil, dsl.Brokenf("NewFSWatchChan: PollInterval %d isn't positive", opts.PollInterval)
+	}
+
+	dir := opts.Dir
+	if !filepath.IsAbs(dir) && ctx.Dir != "" {
+		dir = filepath.Join(ctx.Dir, dir)
+	}
+
+	buf, err := dsl.NewBuffer("fswatch", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FSWatch{
+		opts: &opts,
+		dir:  dir,
+		c:    buf.C,
+		buf:  buf,
+		ctl:  make(chan bool),
+	}, nil
+}
+
+func (c *FSWatch) Kind() dsl.ChanKind {
+	return "fswatch"
+}
+
+func (c *FSWatch) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *FSWatch) Close(ctx *dsl.Ctx) error {
+	c.closeOnce.Do(func() {
+		close(c.ctl)
+	})
+	return nil
+}
+
+// Pub writes a file.  See FSWatch.
+func (c *FSWatch) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	if m.Topic == "" {
+		return fmt.Errorf("FSWatch Pub has no filename (topic)")
+	}
+	body, err := dsl.MaybeSerialize(m.Payload)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(c.dir, filepath.FromSlash(m.Topic))
+	ctx.Logf("FSWatch Pub %s", filename)
+
+	dir := filepath.Dir(filename)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".plax-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// Sub starts watching files.  See FSWatch.
+func (c *FSWatch) Sub(ctx *dsl.Ctx, topic string) error {
+	pattern := filepath.Join(c.dir, filepath.FromSlash(topic))
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("FSWatch bad pattern '%s': %w", topic, err)
+	}
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+	ctx.Logf("FSWatch Sub %s", pattern)
+
+	// Get the baseline before returning so that the test's
+	// subsequent steps see changes.
+	seen, err := c.scan(pattern)
+	if err != nil {
+		return err
+	}
+	if c.opts.Existing {
+		for _, e := range seen {
+			c.report(ctx, "existing", e)
+		}
+	}
+
+	go c.poll(ctx, pattern, seen)
+
+	return nil
+}
+
+// scan returns the regular files that match the pattern.
+func (c *FSWatch) scan(pattern string) (map[string]*FSEvent, error) {
+	filenames, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	acc := make(map[string]*FSEvent, len(filenames))
+	for _, filename := range filenames {
+		if filepath.Base(filename)[0] == '.' {
+			// Including our temporary files.
+			continue
+		}
+		info, err := os.Stat(filename)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		rel, err := filepath.Rel(c.dir, filename)
+		if err != nil {
+			rel = filename
+		}
+		acc[filename] = &FSEvent{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+		}
+	}
+	return acc, nil
+}
+
+// poll scans every PollInterval and reports the differences.
+func (c *FSWatch) poll(ctx *dsl.Ctx, pattern string, seen map[string]*FSEvent) {
+	interval := time.Duration(c.opts.PollInterval) * time.Millisecond
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.ctl:
+			return
+		case <-time.After(interval):
+		}
+
+		now, err := c.scan(pattern)
+		if err != nil {
+			ctx.Warnf("warning: FSWatch %s: %s", pattern, err)
+			continue
+		}
+		select {
+		case <-c.ctl:
+			// Closed during the scan, so don't report
+			// (say) a test's cleanup.
+			return
+		default:
+		}
+		for filename, e := range now {
+			was, have := seen[filename]
+			switch {
+			case !have:
+				c.report(ctx, "created", e)
+			case was.Size != e.Size || !was.ModTime.Equal(e.ModTime):
+				c.report(ctx, "modified", e)
+			}
+		}
+		for filename, e := range seen {
+			if _, have := now[filename]; !have {
+				c.report(ctx, "deleted", e)
+			}
+		}
+		seen = now
+	}
+}
+
+// report delivers a message about the file (with its contents if
+// Fetch).
+func (c *FSWatch) report(ctx *dsl.Ctx, event string, e *FSEvent) {
+	x := *e
+	x.Event = event
+	if c.opts.Fetch && event != "deleted" {
+		bs, err := ioutil.ReadFile(filepath.Join(c.dir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			ctx.Warnf("warning: FSWatch %s: %s", e.Path, err)
+		} else {
+			var v interface{}
+			if json.Unmarshal(bs, &v) != nil {
+				v = string(bs)
+			}
+			x.Body = v
+		}
+	}
+	c.To(ctx, dsl.Msg{
+		Topic:   e.Path,
+		Payload: dsl.Canon(&x),
+	})
+}
+
+func (c *FSWatch) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *FSWatch) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("Kill is not supported by a %T", c)
+}
+
+func (c *FSWatch) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("FSWatch To %s", m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *FSWatch) Overflow() error {
+	return c.buf.Overflow()
+}
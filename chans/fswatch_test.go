@@ -0,0 +1,138 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestFSWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-fswatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "in"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "in", "old.json"), []byte(`{"n":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsl.NewCtx(context.Background())
+	ctx.Dir = dir
+
+	recv := func(c dsl.Chan) dsl.Msg {
+		select {
+		case m := <-c.Recv(ctx):
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return dsl.Msg{}
+	}
+
+	c, err := NewFSWatchChan(ctx, FSWatchOpts{
+		PollInterval: 20,
+		Existing:     true,
+		Fetch:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Sub(ctx, "in"); err != nil {
+		t.Fatal(err)
+	}
+	m := recv(c)
+	x := m.Payload.(map[string]interface{})
+	if m.Topic != "in/old.json" || x["event"] != "existing" || x["body"].(map[string]interface{})["n"] != 1.0 {
+		t.Fatal(m)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "in/new.txt",
+		Payload: "hello",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if m.Topic != "in/new.txt" || x["event"] != "created" || x["body"] != "hello" || x["size"] != 5.0 {
+		t.Fatal(m)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "in/new.txt",
+		Payload: map[string]interface{}{"changed": true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if x["event"] != "modified" || x["body"].(map[string]interface{})["changed"] != true {
+		t.Fatal(m)
+	}
+
+	if err = os.Remove(filepath.Join(dir, "in", "old.json")); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if m.Topic != "in/old.json" || x["event"] != "deleted" {
+		t.Fatal(m)
+	}
+
+	// A glob pattern only sees matching files.
+	if err = c.Sub(ctx, "out/*.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "out/ignored.txt",
+		Payload: "no",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "out/data.csv",
+		Payload: "a,b\n",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	if m.Topic != "out/data.csv" {
+		t.Fatal(m)
+	}
+
+	if err = c.Sub(ctx, "[bad"); err == nil {
+		t.Fatal("expected an error for a bad pattern")
+	}
+}
@@ -31,6 +31,7 @@ import (
 
 func init() {
 	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "httpclient", NewHTTPClientChan)
+	dsl.TheChanDocs.Register("httpclient", "Makes HTTP requests and receives their responses.", HTTPClientOpts{})
 }
 
 // HTTPClient is an HTTPClient client Chan
@@ -38,10 +39,17 @@ type HTTPClient struct {
 	opts   *HTTPClientOpts
 	client *http.Client
 	c      chan dsl.Msg
+	buf    *dsl.Buffer
 }
 
 // HTTPClientOpts configures an HTTPClient channel.
 type HTTPClientOpts struct {
+	// BufferSize is the capacity of the channel's dsl.Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
 }
 
 func (c *HTTPClient) Kind() dsl.ChanKind {
@@ -197,17 +205,19 @@ func (c *HTTPClient) To(ctx *dsl.Ctx, m dsl.Msg) error {
 	ctx.Logdf("  %T payload: %s", c, m.Payload)
 
 	m.ReceivedAt = time.Now().UTC()
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
-		ctx.Logf("%T queued message", c)
-		ctx.Logf("%T queued %s", c, dsl.JSON(m))
-	default:
-		panic(fmt.Errorf("Warning: %T channel full", c))
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
 	}
+	ctx.Logf("%T queued %s", c, dsl.JSON(m))
 	return nil
 }
 
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *HTTPClient) Overflow() error {
+	return c.buf.Overflow()
+}
+
 func NewHTTPClientChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
 	o := HTTPClientOpts{}
 
@@ -220,8 +230,14 @@ func NewHTTPClientChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
 		return nil, fmt.Errorf("NewHTTPClientChan: %w", err)
 	}
 
+	buf, err := dsl.NewBuffer("httpclient", o.BufferSize, o.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
 	return &HTTPClient{
 		opts: &o,
-		c:    make(chan dsl.Msg, DefaultMQTTBufferSize),
+		c:    buf.C,
+		buf:  buf,
 	}, nil
 }
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapClient is a minimal IMAP4rev1 client that supports just what
+// the email channel needs: LOGIN, EXAMINE, UID SEARCH, UID FETCH, and
+// LOGOUT.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is one untagged (or tagged) response line with any
+// literals it contains.  In Line, each literal is replaced by "{}".
+type imapResponse struct {
+	Line     string
+	Literals [][]byte
+}
+
+// dialIMAP connects to the server, which has the given TLS mode
+// ("tls", "starttls", or "none"), and reads its greeting.
+func dialIMAP(addr, mode string, tlsConfig *tls.Config, timeout time.Duration) (*imapClient, error) {
+	var (
+		conn net.Conn
+		err  error
+		d    = &net.Dialer{Timeout: timeout}
+	)
+	if mode == "tls" {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c := &imapClient{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+	greeting, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.Line, "* OK") && !strings.HasPrefix(greeting.Line, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP server %s greeting: %s", addr, greeting.Line)
+	}
+
+	if mode == "starttls" {
+		if _, err = c.cmd("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tc := tls.Client(conn, tlsConfig)
+		if err = tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.conn = tc
+		c.r = bufio.NewReader(tc)
+	}
+
+	return c, nil
+}
+
+func (c *imapClient) Close() error {
+	return c.conn.Close()
+}
+
+// imapLiteral matches the announcement of a literal at the end of a
+// line.
+var imapLiteral = regexp.MustCompile(`\{(\d+)\}$`)
+
+// read reads one response, including its literals.
+func (c *imapClient) read() (*imapResponse, error) {
+	r := &imapResponse{}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m := imapLiteral.FindStringSubmatch(line)
+		if m == nil {
+			r.Line += line
+			return r, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		bs := make([]byte, n)
+		if _, err = io.ReadFull(c.r, bs); err != nil {
+			return nil, err
+		}
+		r.Line += line[:len(line)-len(m[0])] + "{}"
+		r.Literals = append(r.Literals, bs)
+	}
+}
+
+// cmd sends the command and returns the untagged responses.  The
+// error reports a tagged response other than OK.
+func (c *imapClient) cmd(command string) ([]*imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("p%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+	var acc []*imapResponse
+	for {
+		r, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(r.Line, tag+" ") {
+			status := strings.TrimPrefix(r.Line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				verb := strings.SplitN(command, " ", 2)[0]
+				return nil, fmt.Errorf("IMAP %s: %s", verb, status)
+			}
+			return acc, nil
+		}
+		acc = append(acc, r)
+	}
+}
+
+// imapQuote returns s as an IMAP quoted string.
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func (c *imapClient) Login(username, password string) error {
+	_, err := c.cmd("LOGIN " + imapQuote(username) + " " + imapQuote(password))
+	return err
+}
+
+// Examine selects the mailbox read-only.
+func (c *imapClient) Examine(mailbox string) error {
+	_, err := c.cmd("EXAMINE " + imapQuote(mailbox))
+	return err
+}
+
+// Search returns the UIDs of the messages whose UIDs are at least
+// min.
+func (c *imapClient) Search(min uint32) ([]uint32, error) {
+	criteria := "ALL"
+	if 1 < min {
+		criteria = fmt.Sprintf("UID %d:*", min)
+	}
+	rs, err := c.cmd("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+	var acc []uint32
+	for _, r := range rs {
+		if !strings.HasPrefix(r.Line, "* SEARCH") {
+			continue
+		}
+		for _, s := range strings.Fields(strings.TrimPrefix(r.Line, "* SEARCH")) {
+			uid, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("IMAP SEARCH: bad UID '%s'", s)
+			}
+			// "N:*" includes the last message even if its
+			// UID is less than N.
+			if uint32(uid) >= min {
+				acc = append(acc, uint32(uid))
+			}
+		}
+	}
+	return acc, nil
+}
+
+// Fetch returns the whole message with the given UID without setting
+// its \Seen flag.
+func (c *imapClient) Fetch(uid uint32) ([]byte, error) {
+	rs, err := c.cmd(fmt.Sprintf("UID FETCH %d BODY.PEEK[]", uid))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		if strings.Contains(r.Line, " FETCH ") && 0 < len(r.Literals) {
+			return r.Literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("IMAP FETCH: no message with UID %d", uid)
+}
+
+func (c *imapClient) Logout() error {
+	_, err := c.cmd("LOGOUT")
+	c.Close()
+	return err
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "k8s", NewK8sChan)
+	dsl.TheChanDocs.Register("k8s", "A Kubernetes client (via kubectl) that applies manifests, watches resources, and execs in and follows logs of pods.", K8sOpts{})
+}
+
+// K8sOpts configures a Kubernetes channel.
+type K8sOpts struct {
+	// Kubeconfig is the kubeconfig filename, which defaults to
+	// kubectl's default.
+	Kubeconfig string `json:",omitempty" yaml:",omitempty" doc:"The kubeconfig filename."`
+
+	// Context is the kubeconfig context, which defaults to the
+	// current context.
+	Context string `json:",omitempty" yaml:",omitempty" doc:"The kubeconfig context."`
+
+	// Namespace is the namespace, which defaults to the
+	// context's namespace.
+	Namespace string `json:",omitempty" yaml:",omitempty" doc:"The namespace."`
+
+	// CommandTimeout is the timeout in milliseconds for kubectl
+	// commands (other than watches and followed logs).
+	CommandTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds to wait for kubectl commands." default:"30000"`
+
+	// Program is the kubectl program.
+	Program string `json:",omitempty" yaml:",omitempty" doc:"The kubectl program." default:"kubectl"`
+
+	// BufferSize is the capacity of the channel's dsl.Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// K8sExec is the payload for a message published with topic "exec"
+// or "logs" to a K8s channel.
+type K8sExec struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+
+	// Command (for "exec") is either a string (run via 'sh -c')
+	// or a list of strings.
+	Command interface{} `json:"command,omitempty"`
+
+	// Tail (for "logs") is the number of recent lines (if
+	// positive).
+	Tail int `json:"tail,omitempty"`
+}
+
+// K8s is a channel for a Kubernetes cluster, which the kubectl
+// program (see K8sOpts.Program) accesses.
+//
+// A message published with topic "apply" or "delete" applies or
+// deletes the manifest in its payload, which is an object, a list of
+// objects, or a YAML string.  A message with topic "exec" runs a
+// command in a pod, and a message with topic "logs" gets a pod's
+// logs.  See K8sExec.  For each of these messages, the channel
+// receives a message with the same topic and an ExecResult payload.
+//
+// A Sub with topic "KIND" or "KIND/NAME" (like "pods" or
+// "widgets.example.com/w1") watches those resources, and the channel
+// receives each watch event (with "type" and "object" properties) as
+// a message with the Sub's topic.  A Sub with topic
+// "logs/POD[/CONTAINER]" follows the pod's logs, whose lines arrive
+// as messages with the Sub's topic.
+type K8s struct {
+	opts *K8sOpts
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+}
+
+func NewK8sChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := K8sOpts{
+		CommandTimeout: 30000,
+		Program:        "kubectl",
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	buf, err := dsl.NewBuffer("k8s", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &K8s{
+		opts: &opts,
+		c:    buf.C,
+		buf:  buf,
+	}, nil
+}
+
+func (c *K8s) Kind() dsl.ChanKind {
+	return "k8s"
+}
+
+// args returns the global arguments followed by the given ones.
+func (c *K8s) args(more ...string) []string {
+	var args []string
+	if c.opts.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.opts.Kubeconfig)
+	}
+	if c.opts.Context != "" {
+		args = append(args, "--context", c.opts.Context)
+	}
+	if c.opts.Namespace != "" {
+		args = append(args, "--namespace", c.opts.Namespace)
+	}
+	return append(args, more...)
+}
+
+func (c *K8s) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+// Close stops all watches and followed logs.
+func (c *K8s) Close(ctx *dsl.Ctx) error {
+	ctx.Logf("K8s Close")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cancel := range c.cancels {
+		cancel()
+	}
+	c.cancels = nil
+	return nil
+}
+
+// Sub starts a watch or follows logs.  See K8s.
+func (c *K8s) Sub(ctx *dsl.Ctx, topic string) error {
+	ctx.Logf("K8s Sub %s", topic)
+
+	parts := strings.Split(topic, "/")
+	if parts[0] == "logs" {
+		if len(parts) < 2 || 3 < len(parts) || parts[1] == "" {
+			return fmt.Errorf("K8s logs topic '%s' isn't logs/POD[/CONTAINER]", topic)
+		}
+		args := c.args("logs", "-f", parts[1])
+		if len(parts) == 3 {
+			args = append(args, "-c", parts[2])
+		}
+		return c.stream(ctx, topic, args, false)
+	}
+
+	if 2 < len(parts) || parts[0] == "" {
+		return fmt.Errorf("K8s watch topic '%s' isn't KIND[/NAME]", topic)
+	}
+	args := c.args("get", parts[0])
+	if len(parts) == 2 {
+		args = append(args, parts[1])
+	}
+	args = append(args, "--watch", "--output-watch-events", "-o", "json")
+	return c.stream(ctx, topic, args, true)
+}
+
+// stream runs kubectl with the given arguments until the channel is
+// closed.  Each JSON value (if events) or line of the output arrives
+// as a message with the given topic.
+func (c *K8s) stream(ctx *dsl.Ctx, topic string, args []string, events bool) error {
+	cctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(cctx, c.opts.Program, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	ctx.Logf("K8s %s: kubectl %s", topic, strings.Join(args, " "))
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+
+	c.mu.Lock()
+	c.cancels = append(c.cancels, cancel)
+	c.mu.Unlock()
+
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			ctx.Warnf("warning: K8s %s: %s", topic, sc.Text())
+		}
+	}()
+
+	go func() {
+		defer cmd.Wait()
+		if events {
+			d := json.NewDecoder(stdout)
+			for {
+				var x interface{}
+				if err := d.Decode(&x); err != nil {
+					if err != io.EOF && cctx.Err() == nil {
+						ctx.Warnf("warning: K8s %s: %s", topic, err)
+					}
+					return
+				}
+				c.To(ctx, dsl.Msg{Topic: topic, Payload: x})
+			}
+		}
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			c.To(ctx, dsl.Msg{Topic: topic, Payload: sc.Text()})
+		}
+	}()
+
+	return nil
+}
+
+// Pub applies or deletes a manifest or runs a command in or gets the
+// logs of a pod.  See K8s.
+func (c *K8s) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("K8s Pub %s", m.Topic)
+
+	var (
+		args  []string
+		stdin io.Reader
+	)
+
+	switch m.Topic {
+	case "apply", "delete":
+		manifest, err := k8sManifest(m.Payload)
+		if err != nil {
+			return err
+		}
+		stdin = strings.NewReader(manifest)
+		args = c.args(m.Topic, "-f", "-")
+		if m.Topic == "delete" {
+			args = append(args, "--ignore-not-found")
+		}
+	case "exec", "logs":
+		var x K8sExec
+		if err := dsl.As(m.Payload, &x); err != nil {
+			return err
+		}
+		if x.Pod == "" {
+			return fmt.Errorf("K8s %s: no pod", m.Topic)
+		}
+		if m.Topic == "logs" {
+			args = c.args("logs", x.Pod)
+			if x.Tail > 0 {
+				args = append(args, fmt.Sprintf("--tail=%d", x.Tail))
+			}
+		} else {
+			args = c.args("exec", x.Pod)
+		}
+		if x.Container != "" {
+			args = append(args, "-c", x.Container)
+		}
+		if m.Topic == "exec" {
+			args = append(args, "--")
+			switch vv := x.Command.(type) {
+			case string:
+				args = append(args, "sh", "-c", vv)
+			case []interface{}:
+				for _, v := range vv {
+					args = append(args, fmt.Sprintf("%v", v))
+				}
+			default:
+				return fmt.Errorf("K8s exec: command should be a string or list of strings")
+			}
+		}
+	default:
+		return fmt.Errorf("K8s: unknown topic '%s'", m.Topic)
+	}
+
+	go func() {
+		command := "kubectl " + strings.Join(args, " ")
+		ctx.Logf("K8s %s", command)
+		x := runCommand(ctx, command, c.opts.Program, args, nil, stdin,
+			time.Duration(c.opts.CommandTimeout)*time.Millisecond)
+		c.To(ctx, dsl.Msg{
+			Topic:   m.Topic,
+			Payload: dsl.Canon(x),
+		})
+	}()
+
+	return nil
+}
+
+// k8sManifest returns the YAML or JSON for the given payload, which
+// is a string, an object, or a list of objects.
+func k8sManifest(payload interface{}) (string, error) {
+	if xs, is := payload.([]interface{}); is {
+		payload = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      xs,
+		}
+	}
+	return dsl.MaybeSerialize(payload)
+}
+
+func (c *K8s) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *K8s) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("Kill is not supported by a %T", c)
+}
+
+func (c *K8s) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("K8s To %s", m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *K8s) Overflow() error {
+	return c.buf.Overflow()
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeKubectl is a shell script that imitates enough of kubectl,
+// and it records its commands in the file "commands" and its stdin
+// in the file "stdin".
+const fakeKubectl = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$*" >> "$dir/commands"
+while [ "$1" = "--namespace" ] || [ "$1" = "--context" ]; do shift 2; done
+case "$1" in
+apply) cat > "$dir/stdin"; echo "widget.example.com/w1 configured" ;;
+get)
+  cat <<EOF
+{
+  "type": "ADDED",
+  "object": {"kind": "Widget", "metadata": {"name": "w1"}, "status": {"phase": "Pending"}}
+}
+{"type": "MODIFIED", "object": {"kind": "Widget", "metadata": {"name": "w1"}, "status": {"phase": "Ready"}}}
+EOF
+  sleep 10 ;;
+logs) echo "line 1"; echo "line 2"; sleep 10 ;;
+exec) while [ "$1" != "--" ]; do shift; done; shift; exec "$@" ;;
+*) echo "unknown command $1" >&2; exit 1 ;;
+esac
+`
+
+func TestK8s(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+
+	dir, err := ioutil.TempDir("", "plax-k8s-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	program := filepath.Join(dir, "kubectl")
+	if err = ioutil.WriteFile(program, []byte(fakeKubectl), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsl.NewCtx(context.Background())
+
+	// Messages on different topics can arrive in any order, so
+	// recv holds the messages with other topics for later.
+	var pending []dsl.Msg
+	recv := func(c dsl.Chan, topic string) interface{} {
+		for i, m := range pending {
+			if m.Topic == topic {
+				pending = append(pending[:i], pending[i+1:]...)
+				return m.Payload
+			}
+		}
+		for {
+			select {
+			case m := <-c.Recv(ctx):
+				if m.Topic == topic {
+					return m.Payload
+				}
+				pending = append(pending, m)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for %s", topic)
+			}
+		}
+	}
+
+	c, err := NewK8sChan(ctx, K8sOpts{
+		Namespace: "test",
+		Program:   program,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Sub(ctx, "widgets.example.com/w1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic: "apply",
+		Payload: []interface{}{
+			map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "w1"},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	x := recv(c, "apply").(map[string]interface{})
+	if x["code"] != 0.0 || x["stdout"] != "widget.example.com/w1 configured" {
+		t.Fatal(x)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `"kind":"List"`) {
+		t.Fatal(string(bs))
+	}
+
+	for _, want := range []string{"Pending", "Ready"} {
+		e := recv(c, "widgets.example.com/w1").(map[string]interface{})
+		status := e["object"].(map[string]interface{})["status"].(map[string]interface{})
+		if status["phase"] != want {
+			t.Fatal(e)
+		}
+	}
+
+	if err = c.Sub(ctx, "logs/web-0/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"line 1", "line 2"} {
+		if line := recv(c, "logs/web-0/nginx"); line != want {
+			t.Fatal(line)
+		}
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic: "exec",
+		Payload: map[string]interface{}{
+			"pod":     "web-0",
+			"command": "echo hi",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if x := recv(c, "exec").(map[string]interface{}); x["stdout"] != "hi" {
+		t.Fatal(x)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "exec",
+		Payload: map[string]interface{}{},
+	}); err == nil {
+		t.Fatal("should have complained")
+	}
+	if err = c.Sub(ctx, "a/b/c"); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	bs, err = ioutil.ReadFile(filepath.Join(dir, "commands"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--namespace test get widgets.example.com w1 --watch --output-watch-events -o json\n",
+		"--namespace test apply -f -\n",
+		"--namespace test logs -f web-0 -c nginx\n",
+		"--namespace test exec web-0 -- sh -c echo hi\n",
+	} {
+		if !strings.Contains(string(bs), want) {
+			t.Fatalf("%q doesn't have %q", bs, want)
+		}
+	}
+}
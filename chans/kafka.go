@@ -0,0 +1,582 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and the versions that kafkaConn uses.
+const (
+	kafkaFetch            = 1
+	kafkaListOffsets      = 2
+	kafkaMetadata         = 3
+	kafkaSaslHandshake    = 17
+	kafkaSaslAuthenticate = 36
+)
+
+var kafkaVersions = map[int16]int16{
+	kafkaFetch:            4,
+	kafkaListOffsets:      1,
+	kafkaMetadata:         1,
+	kafkaSaslHandshake:    1,
+	kafkaSaslAuthenticate: 0,
+}
+
+// Special timestamps for ListOffsets.
+const (
+	kafkaLatest   = -1
+	kafkaEarliest = -2
+)
+
+// kafkaOffsetOutOfRange is the Kafka error code for a fetch offset
+// that the partition doesn't have.
+const kafkaOffsetOutOfRange = 1
+
+// kafkaError is a non-zero Kafka error code.
+type kafkaError struct {
+	What string
+	Code int16
+}
+
+func (e *kafkaError) Error() string {
+	return fmt.Sprintf("Kafka %s error code %d", e.What, e.Code)
+}
+
+// kafkaRecord is a record from a Fetch.
+type kafkaRecord struct {
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// kafkaConn is a minimal Kafka protocol client for one broker: just
+// enough (SASL, Metadata, ListOffsets, and Fetch) to consume a
+// topic.  EventHubsChan uses it with the Event Hubs Kafka endpoint.
+//
+// Requests are serialized.
+type kafkaConn struct {
+	clientID string
+
+	sync.Mutex
+	conn        net.Conn
+	r           *bufio.Reader
+	correlation int32
+}
+
+// dialKafka connects to the broker at addr (HOST:PORT).  A nil
+// tlsConfig gives a plaintext connection.
+func dialKafka(addr string, tlsConfig *tls.Config, timeout time.Duration, clientID string) (*kafkaConn, error) {
+	d := &net.Dialer{
+		Timeout: timeout,
+	}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if tlsConfig == nil {
+		conn, err = d.Dial("tcp", addr)
+	} else {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, tlsConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{
+		clientID: clientID,
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+	}, nil
+}
+
+func (k *kafkaConn) Close() error {
+	return k.conn.Close()
+}
+
+// call sends the request with the given API key and body, and it
+// returns the response's body.  The timeout bounds the entire
+// exchange.
+func (k *kafkaConn) call(api int16, body []byte, timeout time.Duration) (*kafkaReader, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.correlation++
+	w := &kafkaWriter{}
+	w.int16(api)
+	w.int16(kafkaVersions[api])
+	w.int32(k.correlation)
+	w.string(k.clientID)
+	w.buf.Write(body)
+
+	k.conn.SetDeadline(time.Now().Add(timeout))
+	defer k.conn.SetDeadline(time.Time{})
+
+	frame := make([]byte, 4, 4+w.buf.Len())
+	binary.BigEndian.PutUint32(frame, uint32(w.buf.Len()))
+	if _, err := k.conn.Write(append(frame, w.buf.Bytes()...)); err != nil {
+		return nil, err
+	}
+
+	var size int32
+	if err := binary.Read(k.r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("Kafka response size %d is too small", size)
+	}
+	// Let the buffer grow with what actually arrives rather than
+	// trusting the size up front.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, k.r, int64(size)); err != nil {
+		return nil, err
+	}
+	r := &kafkaReader{bs: buf.Bytes()}
+	if c := r.int32(); c != k.correlation {
+		return nil, fmt.Errorf("Kafka response correlation %d (want %d)", c, k.correlation)
+	}
+	return r, nil
+}
+
+// sasl authenticates with the given SASL mechanism and initial
+// response.
+func (k *kafkaConn) sasl(mechanism string, auth []byte, timeout time.Duration) error {
+	w := &kafkaWriter{}
+	w.string(mechanism)
+	r, err := k.call(kafkaSaslHandshake, w.buf.Bytes(), timeout)
+	if err != nil {
+		return err
+	}
+	if code := r.int16(); code != 0 {
+		return &kafkaError{"SASL handshake (" + mechanism + ")", code}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	w = &kafkaWriter{}
+	w.bytes(auth)
+	if r, err = k.call(kafkaSaslAuthenticate, w.buf.Bytes(), timeout); err != nil {
+		return err
+	}
+	code := r.int16()
+	msg := r.nullableString()
+	if r.err != nil {
+		return r.err
+	}
+	if code != 0 {
+		return fmt.Errorf("Kafka SASL authentication: %s (error code %d)", msg, code)
+	}
+	return nil
+}
+
+// partitions returns the topic's partitions.
+func (k *kafkaConn) partitions(topic string, timeout time.Duration) ([]int32, error) {
+	w := &kafkaWriter{}
+	w.int32(1)
+	w.string(topic)
+	r, err := k.call(kafkaMetadata, w.buf.Bytes(), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, n := 0, r.int32(); i < int(n) && r.err == nil; i++ {
+		r.int32()          // node_id
+		r.string()         // host
+		r.int32()          // port
+		r.nullableString() // rack
+	}
+	r.int32() // controller_id
+
+	var acc []int32
+	for i, n := 0, r.int32(); i < int(n) && r.err == nil; i++ {
+		code := r.int16()
+		name := r.string()
+		r.int8() // is_internal
+		if code != 0 && name == topic {
+			return nil, &kafkaError{"metadata for " + topic, code}
+		}
+		for j, m := 0, r.int32(); j < int(m) && r.err == nil; j++ {
+			r.int16() // error_code
+			p := r.int32()
+			r.int32() // leader_id
+			r.int32s()
+			r.int32s()
+			if name == topic {
+				acc = append(acc, p)
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(acc) == 0 {
+		return nil, fmt.Errorf("Kafka topic %s has no partitions", topic)
+	}
+	return acc, nil
+}
+
+// offsets returns the offsets for the given timestamp (kafkaLatest
+// or kafkaEarliest) of the topic's partitions.
+func (k *kafkaConn) offsets(topic string, partitions []int32, timestamp int64, timeout time.Duration) (map[int32]int64, error) {
+	w := &kafkaWriter{}
+	w.int32(-1) // replica_id
+	w.int32(1)
+	w.string(topic)
+	w.int32(int32(len(partitions)))
+	for _, p := range partitions {
+		w.int32(p)
+		w.int64(timestamp)
+	}
+	r, err := k.call(kafkaListOffsets, w.buf.Bytes(), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := make(map[int32]int64, len(partitions))
+	for i, n := 0, r.int32(); i < int(n) && r.err == nil; i++ {
+		r.string()
+		for j, m := 0, r.int32(); j < int(m) && r.err == nil; j++ {
+			p := r.int32()
+			code := r.int16()
+			r.int64() // timestamp
+			offset := r.int64()
+			if code != 0 {
+				return nil, &kafkaError{fmt.Sprintf("offsets for %s partition %d", topic, p), code}
+			}
+			acc[p] = offset
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return acc, nil
+}
+
+// fetch returns the records (from the given offsets) of the topic's
+// partitions, and it advances the offsets.  The broker waits up to
+// maxWait for records.
+func (k *kafkaConn) fetch(topic string, offsets map[int32]int64, maxWait time.Duration, timeout time.Duration) ([]kafkaRecord, error) {
+	w := &kafkaWriter{}
+	w.int32(-1) // replica_id
+	w.int32(int32(maxWait / time.Millisecond))
+	w.int32(1)       // min_bytes
+	w.int32(1 << 24) // max_bytes
+	w.int8(1)        // isolation_level: read_committed
+	w.int32(1)
+	w.string(topic)
+	w.int32(int32(len(offsets)))
+	for p, offset := range offsets {
+		w.int32(p)
+		w.int64(offset)
+		w.int32(1 << 20) // partition_max_bytes
+	}
+	r, err := k.call(kafkaFetch, w.buf.Bytes(), timeout+maxWait)
+	if err != nil {
+		return nil, err
+	}
+
+	var acc []kafkaRecord
+	r.int32() // throttle_time_ms
+	for i, n := 0, r.int32(); i < int(n) && r.err == nil; i++ {
+		r.string()
+		for j, m := 0, r.int32(); j < int(m) && r.err == nil; j++ {
+			p := r.int32()
+			code := r.int16()
+			r.int64() // high_watermark
+			r.int64() // last_stable_offset
+			for a, b := 0, r.int32(); a < int(b) && r.err == nil; a++ {
+				r.int64() // producer_id
+				r.int64() // first_offset
+			}
+			records := r.bytes()
+			if r.err != nil {
+				break
+			}
+			if code != 0 {
+				return acc, &kafkaError{fmt.Sprintf("fetch from %s partition %d", topic, p), code}
+			}
+			rs, next, err := kafkaRecords(p, records, offsets[p])
+			if err != nil {
+				return acc, fmt.Errorf("Kafka %s partition %d: %w", topic, p, err)
+			}
+			offsets[p] = next
+			acc = append(acc, rs...)
+		}
+	}
+	return acc, r.err
+}
+
+// kafkaRecords decodes the record batches (which might end with a
+// partial batch) and returns the records at or after the given
+// offset along with the next offset.
+func kafkaRecords(partition int32, bs []byte, offset int64) ([]kafkaRecord, int64, error) {
+	var acc []kafkaRecord
+	for 12 <= len(bs) {
+		base := int64(binary.BigEndian.Uint64(bs))
+		size := int(int32(binary.BigEndian.Uint32(bs[8:])))
+		if size < 0 {
+			return nil, offset, fmt.Errorf("record batch size %d is negative", size)
+		}
+		if len(bs)-12 < size {
+			// A partial batch.
+			break
+		}
+		batch := &kafkaReader{bs: bs[12 : 12+size]}
+		bs = bs[12+size:]
+
+		batch.int32() // partition_leader_epoch
+		if magic := batch.int8(); magic != 2 {
+			return nil, offset, fmt.Errorf("unsupported record batch version %d", magic)
+		}
+		batch.int32() // crc
+		attrs := batch.int16()
+		lastDelta := batch.int32()
+		firstTimestamp := batch.int64()
+		batch.int64() // max_timestamp
+		batch.int64() // producer_id
+		batch.int16() // producer_epoch
+		batch.int32() // base_sequence
+		n := batch.int32()
+		if batch.err != nil {
+			return nil, offset, batch.err
+		}
+
+		next := base + int64(lastDelta) + 1
+		if attrs&0x20 != 0 || next <= offset {
+			// A control batch or one that we've already seen.
+			if offset < next {
+				offset = next
+			}
+			continue
+		}
+
+		rest := batch.bs[batch.i:]
+		switch attrs & 0x07 {
+		case 0:
+		case 1:
+			z, err := gzip.NewReader(bytes.NewReader(rest))
+			if err != nil {
+				return nil, offset, err
+			}
+			if rest, err = ioutil.ReadAll(z); err != nil {
+				return nil, offset, err
+			}
+		default:
+			return nil, offset, fmt.Errorf("unsupported compression %d", attrs&0x07)
+		}
+
+		rr := &kafkaReader{bs: rest}
+		for i := 0; i < int(n) && rr.err == nil; i++ {
+			rr.varint() // length
+			rr.int8()   // attributes
+			tsDelta := rr.varint()
+			offsetDelta := rr.varint()
+			rec := kafkaRecord{
+				Partition: partition,
+				Offset:    base + offsetDelta,
+				Timestamp: time.Unix(0, (firstTimestamp+tsDelta)*int64(time.Millisecond)).UTC(),
+				Key:       rr.varbytes(),
+				Value:     rr.varbytes(),
+			}
+			if h := rr.varint(); 0 < h {
+				rec.Headers = make(map[string]string)
+				for j := 0; j < int(h) && rr.err == nil; j++ {
+					k := rr.varbytes()
+					rec.Headers[string(k)] = string(rr.varbytes())
+				}
+			}
+			if offset <= rec.Offset {
+				acc = append(acc, rec)
+			}
+		}
+		if rr.err != nil {
+			return nil, offset, rr.err
+		}
+		offset = next
+	}
+	return acc, offset, nil
+}
+
+// kafkaWriter encodes Kafka protocol primitives.
+type kafkaWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *kafkaWriter) int8(x int8) {
+	w.buf.WriteByte(byte(x))
+}
+
+func (w *kafkaWriter) int16(x int16) {
+	binary.Write(&w.buf, binary.BigEndian, x)
+}
+
+func (w *kafkaWriter) int32(x int32) {
+	binary.Write(&w.buf, binary.BigEndian, x)
+}
+
+func (w *kafkaWriter) int64(x int64) {
+	binary.Write(&w.buf, binary.BigEndian, x)
+}
+
+func (w *kafkaWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *kafkaWriter) bytes(bs []byte) {
+	if bs == nil {
+		w.int32(-1)
+		return
+	}
+	w.int32(int32(len(bs)))
+	w.buf.Write(bs)
+}
+
+func (w *kafkaWriter) varint(x int64) {
+	var bs [binary.MaxVarintLen64]byte
+	w.buf.Write(bs[:binary.PutVarint(bs[:], x)])
+}
+
+func (w *kafkaWriter) varbytes(bs []byte) {
+	if bs == nil {
+		w.varint(-1)
+		return
+	}
+	w.varint(int64(len(bs)))
+	w.buf.Write(bs)
+}
+
+// kafkaReader decodes Kafka protocol primitives.  The first error
+// sticks, and later reads return zero values.
+type kafkaReader struct {
+	bs  []byte
+	i   int
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.bs)-r.i < n {
+		r.err = fmt.Errorf("Kafka response truncated at %d", r.i)
+		return nil
+	}
+	bs := r.bs[r.i : r.i+n]
+	r.i += n
+	return bs
+}
+
+func (r *kafkaReader) int8() int8 {
+	if bs := r.next(1); bs != nil {
+		return int8(bs[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if bs := r.next(2); bs != nil {
+		return int16(binary.BigEndian.Uint16(bs))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if bs := r.next(4); bs != nil {
+		return int32(binary.BigEndian.Uint32(bs))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if bs := r.next(8); bs != nil {
+		return int64(binary.BigEndian.Uint64(bs))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32s() []int32 {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	if (len(r.bs)-r.i)/4 < int(n) {
+		r.err = fmt.Errorf("Kafka response truncated at %d", r.i)
+		return nil
+	}
+	acc := make([]int32, 0, n)
+	for i := 0; i < int(n) && r.err == nil; i++ {
+		acc = append(acc, r.int32())
+	}
+	return acc
+}
+
+func (r *kafkaReader) string() string {
+	return r.nullableString()
+}
+
+func (r *kafkaReader) nullableString() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+func (r *kafkaReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := binary.Varint(r.bs[r.i:])
+	if n <= 0 {
+		r.err = fmt.Errorf("Kafka bad varint at %d", r.i)
+		return 0
+	}
+	r.i += n
+	return x
+}
+
+func (r *kafkaReader) varbytes() []byte {
+	n := r.varint()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKafka is a tiny imitation of a Kafka broker that serves one
+// topic.  Each produced record is its own record batch.
+type fakeKafka struct {
+	topic string
+	l     net.Listener
+
+	sync.Mutex
+	// partitions has each partition's batches.
+	partitions [][][]byte
+	auths      []string
+}
+
+func newFakeKafka(t *testing.T, topic string, partitions int) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &fakeKafka{
+		topic:      topic,
+		l:          l,
+		partitions: make([][][]byte, partitions),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go k.serve(conn)
+		}
+	}()
+	return k
+}
+
+func (k *fakeKafka) Close() {
+	k.l.Close()
+}
+
+// produce adds a record to the partition.
+func (k *fakeKafka) produce(partition int, key, value []byte, compress bool) {
+	k.Lock()
+	defer k.Unlock()
+	offset := int64(len(k.partitions[partition]))
+	k.partitions[partition] = append(k.partitions[partition], kafkaBatch(offset, key, value, compress))
+}
+
+// kafkaBatch returns a record batch with one record.
+func kafkaBatch(offset int64, key, value []byte, compress bool) []byte {
+	rec := &kafkaWriter{}
+	rec.int8(0)   // attributes
+	rec.varint(0) // timestamp_delta
+	rec.varint(0) // offset_delta
+	rec.varbytes(key)
+	rec.varbytes(value)
+	rec.varint(0) // headers
+	recs := &kafkaWriter{}
+	recs.varint(int64(rec.buf.Len()))
+	recs.buf.Write(rec.buf.Bytes())
+
+	var attrs int16
+	records := recs.buf.Bytes()
+	if compress {
+		attrs = 1
+		var z bytes.Buffer
+		w := gzip.NewWriter(&z)
+		w.Write(records)
+		w.Close()
+		records = z.Bytes()
+	}
+
+	b := &kafkaWriter{}
+	b.int32(0) // partition_leader_epoch
+	b.int8(2)  // magic
+	b.int32(0) // crc (unchecked)
+	b.int16(attrs)
+	b.int32(0)                                   // last_offset_delta
+	b.int64(time.Now().UnixNano() / 1000 / 1000) // first_timestamp
+	b.int64(0)                                   // max_timestamp
+	b.int64(-1)                                  // producer_id
+	b.int16(-1)                                  // producer_epoch
+	b.int32(-1)                                  // base_sequence
+	b.int32(1)                                   // records
+	b.buf.Write(records)
+
+	w := &kafkaWriter{}
+	w.int64(offset)
+	w.int32(int32(b.buf.Len()))
+	w.buf.Write(b.buf.Bytes())
+	return w.buf.Bytes()
+}
+
+func (k *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		bs := make([]byte, size)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			return
+		}
+		req := &kafkaReader{bs: bs}
+		api := req.int16()
+		req.int16() // api_version
+		correlation := req.int32()
+		req.string() // client_id
+
+		w := &kafkaWriter{}
+		w.int32(correlation)
+		switch api {
+		case kafkaSaslHandshake:
+			mechanism := req.string()
+			k.Lock()
+			k.auths = append(k.auths, mechanism)
+			k.Unlock()
+			w.int16(0)
+			w.int32(1)
+			w.string(mechanism)
+		case kafkaSaslAuthenticate:
+			auth := req.bytes()
+			k.Lock()
+			k.auths = append(k.auths, string(auth))
+			k.Unlock()
+			w.int16(0)
+			w.int16(-1)
+			w.bytes([]byte{})
+		case kafkaMetadata:
+			w.int32(0) // brokers
+			w.int32(0) // controller_id
+			w.int32(1)
+			w.int16(0)
+			w.string(k.topic)
+			w.int8(0)
+			w.int32(int32(len(k.partitions)))
+			for p := range k.partitions {
+				w.int16(0)
+				w.int32(int32(p))
+				w.int32(0)
+				w.int32(0)
+				w.int32(0)
+			}
+		case kafkaListOffsets:
+			req.int32() // replica_id
+			req.int32() // topics
+			req.string()
+			n := req.int32()
+			w.int32(1)
+			w.string(k.topic)
+			w.int32(n)
+			k.Lock()
+			for i := 0; i < int(n); i++ {
+				p := req.int32()
+				ts := req.int64()
+				offset := int64(0)
+				if ts == kafkaLatest {
+					offset = int64(len(k.partitions[p]))
+				}
+				w.int32(p)
+				w.int16(0)
+				w.int64(-1)
+				w.int64(offset)
+			}
+			k.Unlock()
+		case kafkaFetch:
+			req.int32() // replica_id
+			maxWait := time.Duration(req.int32()) * time.Millisecond
+			req.int32() // min_bytes
+			req.int32() // max_bytes
+			req.int8()  // isolation_level
+			req.int32() // topics
+			req.string()
+			n := req.int32()
+			want := make(map[int32]int64, n)
+			order := make([]int32, 0, n)
+			for i := 0; i < int(n); i++ {
+				p := req.int32()
+				want[p] = req.int64()
+				req.int32() // partition_max_bytes
+				order = append(order, p)
+			}
+
+			// Wait (briefly) for something to fetch.
+			for waited := time.Duration(0); ; waited += 10 * time.Millisecond {
+				k.Lock()
+				have := false
+				for p, offset := range want {
+					have = have || offset < int64(len(k.partitions[p]))
+				}
+				k.Unlock()
+				if have || maxWait <= waited {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			w.int32(0) // throttle_time_ms
+			w.int32(1)
+			w.string(k.topic)
+			w.int32(n)
+			k.Lock()
+			for _, p := range order {
+				var records []byte
+				for _, b := range k.partitions[p][want[p]:] {
+					records = append(records, b...)
+				}
+				w.int32(p)
+				w.int16(0)
+				w.int64(int64(len(k.partitions[p])))
+				w.int64(int64(len(k.partitions[p])))
+				w.int32(0) // aborted_transactions
+				w.bytes(records)
+			}
+			k.Unlock()
+		default:
+			return
+		}
+
+		frame := make([]byte, 4)
+		binary.BigEndian.PutUint32(frame, uint32(w.buf.Len()))
+		if _, err := conn.Write(append(frame, w.buf.Bytes()...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestKafkaRecords(t *testing.T) {
+	var bs []byte
+	for i := 0; i < 3; i++ {
+		bs = append(bs, kafkaBatch(int64(i), []byte("k"+strconv.Itoa(i)), []byte("v"), i == 1)...)
+	}
+	// A partial batch at the end is ignored.
+	partial := kafkaBatch(3, nil, []byte("v"), false)
+	bs = append(bs, partial[:len(partial)-2]...)
+
+	rs, next, err := kafkaRecords(0, bs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 3 {
+		t.Fatal(next)
+	}
+	if len(rs) != 2 || rs[0].Offset != 1 || string(rs[0].Key) != "k1" || string(rs[1].Key) != "k2" {
+		t.Fatal(rs)
+	}
+}
+
+func TestKafkaRecordsBad(t *testing.T) {
+	bs := kafkaBatch(0, nil, []byte("v"), false)
+	// A negative batch size.
+	binary.BigEndian.PutUint32(bs[8:], 0xfffffff0)
+	if _, _, err := kafkaRecords(0, bs, 0); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	// A huge array length.
+	r := &kafkaReader{bs: []byte{0x7f, 0xff, 0xff, 0xff, 0, 0, 0, 1}}
+	if xs := r.int32s(); xs != nil || r.err == nil {
+		t.Fatal(xs, r.err)
+	}
+
+	// A huge varbytes length.
+	var w kafkaWriter
+	w.varint(1<<62 + 1)
+	r = &kafkaReader{bs: w.buf.Bytes()}
+	if xs := r.varbytes(); xs != nil || r.err == nil {
+		t.Fatal(xs, r.err)
+	}
+}
@@ -29,20 +29,26 @@ import (
 
 func init() {
 	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "kds", NewKDSChan)
+	dsl.TheChanDocs.Register("kds", "An AWS Kinesis Data Streams client.", KDSOpts{})
 }
 
 // KDSOpts is a configuration for a Kinesis consumer for a given
 // stream.
 type KDSOpts struct {
-	StreamName string
+	StreamName string `doc:"The Kinesis stream."`
 
 	// BufferSize is the size of the underlying channel buffer.
 	// Defaults to DefaultChanBufferSize.
-	BufferSize int
+	BufferSize int `doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
 }
 
 type KDSChan struct {
 	c   chan dsl.Msg
+	buf *dsl.Buffer
 	ctl chan bool
 
 	opts *KDSOpts
@@ -62,8 +68,14 @@ func NewKDSChan(ctx *dsl.Ctx, o interface{}) (dsl.Chan, error) {
 		return nil, dsl.NewBroken(err)
 	}
 
+	buf, err := dsl.NewBuffer("KDS", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
 	return &KDSChan{
-		c:    make(chan dsl.Msg, opts.BufferSize),
+		c:    buf.C,
+		buf:  buf,
 		ctl:  make(chan bool),
 		opts: &opts,
 	}, nil
@@ -101,13 +113,18 @@ func (c *KDSChan) Kill(ctx *dsl.Ctx) error {
 
 func (c *KDSChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
 	ctx.Logf("KDSChan To %s", m.Topic)
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
 	}
 	return nil
 }
 
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *KDSChan) Overflow() error {
+	return c.buf.Overflow()
+}
+
 func (c *KDSChan) Consume(ctx *dsl.Ctx) {
 	ctx.Logf("Consuming KDS %s", c.opts.StreamName)
 
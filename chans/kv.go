@@ -0,0 +1,257 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package chans
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/kv"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "kv", NewKVChan)
+	dsl.TheChanDocs.Register("kv", "A key-value store (in-process or served by plaxrun -serve).", KVOpts{})
+}
+
+// KVOpts configures a KVChan.
+type KVOpts struct {
+	// URL is the base URL for a key-value server (e.g., one
+	// started by 'plaxrun -serve ADDR').  When empty, the channel
+	// uses the in-process kv.Default store.
+	URL string `json:",omitempty" yaml:",omitempty" doc:"Base URL of a plaxrun -serve server (in-process store if empty)."`
+
+	// Namespace, when not empty, is prepended (with a '/') to
+	// every key.
+	Namespace string `json:",omitempty" yaml:",omitempty" doc:"Prefix (followed by /) for keys."`
+
+	// BufferSize is the capacity of the channel's dsl.Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// KVRequest is the payload for a message published to a KVChan.
+type KVRequest struct {
+	// Op is put, get, delete, list, or wait.
+	Op string
+
+	Key   string
+	Value interface{}
+
+	// TTL (in Go syntax) for a put.
+	TTL string
+
+	// Prefix for a list.
+	Prefix string
+
+	// Timeout (in Go syntax) for a wait, which polls (every Poll)
+	// until the key has a value.
+	Timeout, Poll string
+}
+
+// KVChan is a channel to a shared key-value store with TTLs, which
+// tests can use to coordinate.
+//
+// Publish a KVRequest, and then receive a response with the topic
+// given by the request's Op.
+type KVChan struct {
+	opts *KVOpts
+	kv   kv.KV
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+}
+
+func NewKVChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	var opts KVOpts
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+
+	var store kv.KV = kv.Local{Store: kv.Default}
+	if opts.URL != "" {
+		store = kv.NewClient(opts.URL)
+	}
+
+	buf, err := dsl.NewBuffer("kv", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KVChan{
+		opts: &opts,
+		kv:   store,
+		c:    buf.C,
+		buf:  buf,
+	}, nil
+}
+
+func (c *KVChan) Kind() dsl.ChanKind {
+	return "kv"
+}
+
+func (c *KVChan) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *KVChan) Close(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *KVChan) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("%T doesn't support 'Kill'", c)
+}
+
+func (c *KVChan) Sub(ctx *dsl.Ctx, topic string) error {
+	return fmt.Errorf("%T doesn't support 'sub'", c)
+}
+
+func (c *KVChan) key(k string) string {
+	if c.opts.Namespace == "" {
+		return k
+	}
+	return c.opts.Namespace + "/" + k
+}
+
+func parseKVDuration(what, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, dsl.Brokenf("bad kv %s '%s': %s", what, s, err)
+	}
+	return d, nil
+}
+
+// Pub performs the requested operation.  The response is queued for
+// Recv.
+func (c *KVChan) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	var req KVRequest
+	if err := dsl.As(dsl.MaybeParseJSON(m.Payload), &req); err != nil {
+		return dsl.NewBroken(err)
+	}
+
+	key := c.key(req.Key)
+	resp := map[string]interface{}{
+		"op":  req.Op,
+		"key": req.Key,
+	}
+
+	ctx.Logf("%T %s '%s'", c, req.Op, key)
+
+	switch req.Op {
+	case "put":
+		ttl, err := parseKVDuration("TTL", req.TTL, 0)
+		if err != nil {
+			return err
+		}
+		e, err := c.kv.Put(key, req.Value, ttl)
+		if err != nil {
+			return err
+		}
+		resp["ok"] = true
+		if e.Expires != nil {
+			resp["expires"] = e.Expires.Format(time.RFC3339Nano)
+		}
+	case "get":
+		e, found, err := c.kv.Get(key)
+		if err != nil {
+			return err
+		}
+		resp["found"] = found
+		if found {
+			resp["value"] = e.Value
+		}
+	case "delete":
+		found, err := c.kv.Delete(key)
+		if err != nil {
+			return err
+		}
+		resp["found"] = found
+	case "list":
+		es, err := c.kv.List(c.key(req.Prefix))
+		if err != nil {
+			return err
+		}
+		resp["prefix"] = req.Prefix
+		resp["entries"] = dsl.Canon(es)
+	case "wait":
+		timeout, err := parseKVDuration("Timeout", req.Timeout, time.Minute)
+		if err != nil {
+			return err
+		}
+		poll, err := parseKVDuration("Poll", req.Poll, 500*time.Millisecond)
+		if err != nil {
+			return err
+		}
+		// Wait in the background so that the test can
+		// proceed (and eventually recv the response).
+		go func() {
+			deadline := time.Now().Add(timeout)
+			for {
+				e, found, err := c.kv.Get(key)
+				if err != nil {
+					ctx.Warnf("%T wait for '%s': %s", c, key, err)
+				}
+				if found || !time.Now().Before(deadline) {
+					resp["found"] = found
+					if found {
+						resp["value"] = e.Value
+					}
+					c.To(ctx, dsl.Msg{
+						Topic:   req.Op,
+						Payload: resp,
+					})
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(poll):
+				}
+			}
+		}()
+		return nil
+	default:
+		return dsl.Brokenf("unknown kv Op '%s' (want put, get, delete, list, or wait)", req.Op)
+	}
+
+	return c.To(ctx, dsl.Msg{
+		Topic:   req.Op,
+		Payload: resp,
+	})
+}
+
+func (c *KVChan) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *KVChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *KVChan) Overflow() error {
+	return c.buf.Overflow()
+}
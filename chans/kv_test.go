@@ -0,0 +1,91 @@
+package chans
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/kv"
+)
+
+func TestKVChan(t *testing.T) {
+	s := httptest.NewServer(kv.Handler(kv.NewStore()))
+	defer s.Close()
+
+	ctx := dsl.NewCtx(context.Background())
+
+	// Two channels sharing a store as if they were in different
+	// tests on different agents.
+	var cs []dsl.Chan
+	for i := 0; i < 2; i++ {
+		c, err := NewKVChan(ctx, KVOpts{
+			URL:       s.URL,
+			Namespace: "run42",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cs = append(cs, c)
+	}
+	provisioner, consumer := cs[0], cs[1]
+
+	recv := func(c dsl.Chan) map[string]interface{} {
+		select {
+		case m := <-c.Recv(ctx):
+			return m.Payload.(map[string]interface{})
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+		}
+		return nil
+	}
+
+	// The consumer waits for the device that the provisioner
+	// provisions.
+	if err := consumer.Pub(ctx, dsl.Msg{
+		Payload: `{"op":"wait","key":"device","timeout":"2s","poll":"10ms"}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provisioner.Pub(ctx, dsl.Msg{
+		Payload: map[string]interface{}{
+			"op":    "put",
+			"key":   "device",
+			"value": map[string]interface{}{"id": "d1"},
+			"ttl":   "1m",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if r := recv(provisioner); r["ok"] != true || r["expires"] == nil {
+		t.Fatal(r)
+	}
+
+	r := recv(consumer)
+	if r["op"] != "wait" || r["found"] != true {
+		t.Fatal(r)
+	}
+	if v, _ := r["value"].(map[string]interface{}); v["id"] != "d1" {
+		t.Fatal(r)
+	}
+
+	if err := consumer.Pub(ctx, dsl.Msg{
+		Payload: `{"op":"get","key":"nope"}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if r := recv(consumer); r["found"] != false {
+		t.Fatal(r)
+	}
+
+	if err := consumer.Pub(ctx, dsl.Msg{
+		Payload: `{"op":"frob"}`,
+	}); err == nil {
+		t.Fatal("should have complained")
+	}
+}
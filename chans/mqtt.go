@@ -27,6 +27,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/Comcast/plax/dsl"
@@ -38,10 +39,14 @@ var (
 	// DefaultMQTTBufferSize is the default capacity of the
 	// internal Go channel.
 	DefaultMQTTBufferSize = 1024
+
+	// DefaultMQTTQoS is the default MQTTOpts.QoS.
+	DefaultMQTTQoS byte = 1
 )
 
 func init() {
 	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "mqtt", NewMQTTChan)
+	dsl.TheChanDocs.Register("mqtt", "An MQTT client.", MQTTOpts{})
 }
 
 // MQTT is an MQTT client Chan
@@ -50,6 +55,13 @@ type MQTT struct {
 	mopts  *mqtt.ClientOptions
 	client mqtt.Client
 	c      chan dsl.Msg
+	buf    *dsl.Buffer
+
+	// topicOut, when not nil, rewrites the topic of each Sub and
+	// Pub, and topicIn, when not nil, rewrites the topic of each
+	// received message.  See AWSIoT.
+	topicOut func(string) string
+	topicIn  func(string) string
 }
 
 // MQTTOpts is partly subset of mqtt.ClientOptions that can be
@@ -61,17 +73,17 @@ type MQTTOpts struct {
 	// BrokerURL is the URL for the MQTT broker.
 	//
 	// This required value has the form "PROTOCOL://HOST:PORT".
-	BrokerURL string `json:",omitempty" yaml:",omitempty"`
+	BrokerURL string `json:",omitempty" yaml:",omitempty" doc:"The broker's URL (PROTOCOL://HOST:PORT)."`
 
 	// CertFile is the optional filename for the client's certificate.
-	CertFile string `json:",omitempty" yaml:",omitempty"`
+	CertFile string `json:",omitempty" yaml:",omitempty" doc:"Filename for the client's certificate."`
 
 	// CACertFile is the optional filename for the certificate
 	// authority.
-	CACertFile string `json:",omitempty" yaml:",omitempty"`
+	CACertFile string `json:",omitempty" yaml:",omitempty" doc:"Filename for the certificate authority."`
 
 	// KeyFile is the optional filename for the client's private key.
-	KeyFile string `json:",omitempty" yaml:",omitempty"`
+	KeyFile string `json:",omitempty" yaml:",omitempty" doc:"Filename for the client's private key."`
 
 	// Insecure will given the value for the tls.Config InsecureSkipVerify.
 	//
@@ -81,7 +93,7 @@ type MQTTOpts struct {
 	// server and any host name in that certificate. In this mode, TLS
 	// is susceptible to machine-in-the-middle attacks unless custom
 	// verification is used. This should be used only for testing.
-	Insecure bool `json:",omitempty" yaml:",omitempty"`
+	Insecure bool `json:",omitempty" yaml:",omitempty" doc:"Skip verification of the server's certificate (for testing only)."`
 
 	// ALPN gives the
 	// https://en.wikipedia.org/wiki/Application-Layer_Protocol_Negotiation
@@ -89,7 +101,7 @@ type MQTTOpts struct {
 	//
 	// For example, see
 	// https://docs.aws.amazon.com/iot/latest/developerguide/protocols.html.
-	ALPN string `json:",omitempty" yaml:",omitempty"`
+	ALPN string `json:",omitempty" yaml:",omitempty" doc:"Application-Layer Protocol Negotiation protocol."`
 
 	// Token is the optional value for the header given by
 	// TokenHeader.
@@ -99,11 +111,11 @@ type MQTTOpts struct {
 	//
 	// When Token is not empty, then you should probably also
 	// provide AuthorizerName and TokenSig.
-	Token string `json:",omitempty" yaml:",omitempty"`
+	Token string `json:",omitempty" yaml:",omitempty" doc:"Value for the TokenHeader (for an AWS IoT custom authorizer)."`
 
 	// TokenHeader is the name of the header which will have the
 	// value given by Token.
-	TokenHeader string `json:",omitempty" yaml:",omitempty"`
+	TokenHeader string `json:",omitempty" yaml:",omitempty" doc:"Name of the header for the Token."`
 
 	// AuthorizerName is the optional value for the header
 	// "x-amz-customauthorizer-name", which is used when making a
@@ -112,78 +124,92 @@ type MQTTOpts struct {
 	//
 	// See
 	// https://docs.aws.amazon.com/iot/latest/developerguide/custom-authorizer.html.
-	AuthorizerName string `json:",omitempty" yaml:",omitempty"`
+	AuthorizerName string `json:",omitempty" yaml:",omitempty" doc:"AWS IoT custom authorizer name."`
 
 	// TokenSig is the signature for the token for a WebSocket
 	// connection to AWS IoT Core.
 	//
 	// See
 	// https://docs.aws.amazon.com/iot/latest/developerguide/custom-authorizer.html.
-	TokenSig string `json:",omitempty" yaml:",omitempty"`
+	TokenSig string `json:",omitempty" yaml:",omitempty" doc:"Signature for the Token."`
 
 	// BufferSize specifies the capacity of the internal Go
 	// channel.
 	//
 	// The default is DefaultMQTTBufferSize.
-	BufferSize int `json:",omitempty yaml:",omitempty"`
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
 
 	// All durations are given in milliseconds.  Why? Because we
 	// shamelessly transform interface{}s to what we want via
 	// serialization.
 
 	// PubTimeout is the timeout in milliseconds for MQTT PUBACK.
-	PubTimeout int64 `json:",omitempty" yaml:",omitempty"`
+	PubTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Timeout in milliseconds for PUBACK."`
 
 	// SubTimeout is the timeout in milliseconds for MQTT SUBACK.
-	SubTimeout int64 `json:",omitempty" yaml:",omitempty"`
+	SubTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Timeout in milliseconds for SUBACK."`
 
 	// ClientID is MQTT client id.
-	ClientID string `json:",omitempty" yaml:",omitempty"`
+	ClientID string `json:",omitempty" yaml:",omitempty" doc:"The MQTT client id."`
 
 	// Username is the optional MQTT client username.
-	Username string `json:",omitempty" yaml:",omitempty"`
+	Username string `json:",omitempty" yaml:",omitempty" doc:"The MQTT username."`
 
 	// Password is the optional MQTT client password.
-	Password string `json:",omitempty" yaml:",omitempty"`
+	Password string `json:",omitempty" yaml:",omitempty" doc:"The MQTT password."`
+
+	// QoS is the MQTT QoS for Pub and Sub.
+	//
+	// The default is DefaultMQTTQoS.
+	QoS *byte `json:",omitempty" yaml:",omitempty" doc:"QoS for pubs and subs." default:"1"`
+
+	// Retain, when true, makes each Pub a retained message.  (An
+	// empty string payload then clears the topic's retained
+	// message.)
+	Retain bool `json:",omitempty" yaml:",omitempty" doc:"Make each pub a retained message."`
 
 	// CleanSession, when true, will not resume a previous MQTT
 	// session for this client id.
-	CleanSession bool `json:",omitempty" yaml:",omitempty"`
+	CleanSession bool `json:",omitempty" yaml:",omitempty" doc:"Don't resume a previous session for this client id."`
 
 	// WillEnabled, if true, will establish an MQTT Last Will and Testament.
 	//
 	// See WillTopic, WillPayload, WillQoS, and WillRetained.
-	WillEnabled bool `json:",omitempty" yaml:",omitempty"`
+	WillEnabled bool `json:",omitempty" yaml:",omitempty" doc:"Establish a Last Will and Testament."`
 
 	// WillTopic gives the MQTT LW&T topic.
 	//
 	// See WillEnabled.
-	WillTopic string `json:",omitempty" yaml:",omitempty"`
+	WillTopic string `json:",omitempty" yaml:",omitempty" doc:"Last Will and Testament topic."`
 
 	// WillPayload gives the MQTT LW&T payload.
 	//
 	// See WillEnabled.
-	WillPayload string `json:",omitempty" yaml:",omitempty"`
+	WillPayload string `json:",omitempty" yaml:",omitempty" doc:"Last Will and Testament payload."`
 
 	// WillQoS specifies the MQTT LW&T QoS.
 	//
 	// See WillEnabled.
-	WillQoS byte `json:",omitempty" yaml:",omitempty"`
+	WillQoS byte `json:",omitempty" yaml:",omitempty" doc:"Last Will and Testament QoS."`
 
 	// WillRetained specifies the MQTT LW&T retained flag.
 	//
 	// See WillEnabled.
-	WillRetained bool `json:",omitempty" yaml:",omitempty"`
+	WillRetained bool `json:",omitempty" yaml:",omitempty" doc:"Last Will and Testament retained flag."`
 
 	// KeepAlive is the duration in seconds that the MQTT client
 	// should wait before sending a PING request to the broker.
-	KeepAlive int64 `json:",omitempty" yaml:",omitempty"`
+	KeepAlive int64 `json:",omitempty" yaml:",omitempty" doc:"Seconds between PINGs."`
 
 	// PingTimeout is the duration in seconds that the client will
 	// wait after sending a PING request to the broker before
 	// deciding that the connection has been lost.  The default is
 	// 10 seconds.
-	PingTimeout int64 `json:",omitempty" yaml:",omitempty"`
+	PingTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Seconds to wait for a PINGRESP." default:"10"`
 
 	// ConnectTimeout is the duration in seconds that the MQTT
 	// client will wait after attempting to open a connection to
@@ -191,23 +217,23 @@ type MQTTOpts struct {
 	// 30 seconds.
 	//
 	// This property does not apply to WebSocket connections.
-	ConnectTimeout int64 `json:",omitempty" yaml:",omitempty"`
+	ConnectTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Seconds to wait to connect (0 never times out)." default:"30"`
 
 	// MaxReconnectInterval specifies maximum duration in
 	// seconds between reconnection attempts.
-	MaxReconnectInterval int64 `json:",omitempty" yaml:",omitempty"`
+	MaxReconnectInterval int64 `json:",omitempty" yaml:",omitempty" doc:"Maximum seconds between reconnection attempts."`
 
 	// AutoReconnect turns on automation reconnection attempts
 	// when a connection is lost.
-	AutoReconnect bool `json:",omitempty" yaml:",omitempty"`
+	AutoReconnect bool `json:",omitempty" yaml:",omitempty" doc:"Reconnect automatically when a connection is lost."`
 
 	// WriteTimeout is the duration to wait for a PUBACK.
-	WriteTimeout int64 `json:",omitempty" yaml:",omitempty"`
+	WriteTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Duration to wait for a PUBACK."`
 
 	// ResumeSubs enables resuming of stored (un)subscribe
 	// messages when connecting but not reconnecting if
 	// CleanSession is false.
-	ResumeSubs bool `json:",omitempty" yaml:",omitempty"`
+	ResumeSubs bool `json:",omitempty" yaml:",omitempty" doc:"Resume stored (un)subscribes when connecting without CleanSession."`
 }
 
 // dur converts a int64 representing milliseconds to a time.Duration.
@@ -318,6 +344,49 @@ func (o *MQTTOpts) Opts(ctx *dsl.Ctx) (*mqtt.ClientOptions, error) {
 	return &opts, nil
 }
 
+// EnableConnectionEvents makes this channel report its connection
+// events.  See dsl.ConnectionEventer.
+//
+// Set AutoReconnect to see reconnected events.
+func (c *MQTT) EnableConnectionEvents(ctx *dsl.Ctx) {
+	var connections int32
+	c.mopts.OnConnect = func(client mqtt.Client) {
+		event := dsl.ConnectionReconnected
+		if atomic.AddInt32(&connections, 1) == 1 {
+			event = dsl.ConnectionConnected
+		}
+		if err := dsl.EmitConnectionEvent(ctx, c, event, ""); err != nil {
+			ctx.Warnf("warning: MQTT %s connection event: %s", c.opts.ClientID, err)
+		}
+	}
+
+	lost := c.mopts.OnConnectionLost
+	c.mopts.OnConnectionLost = func(client mqtt.Client, err error) {
+		lost(client, err)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		}
+		if err := dsl.EmitConnectionEvent(ctx, c, dsl.ConnectionDisconnected, reason); err != nil {
+			ctx.Warnf("warning: MQTT %s connection event: %s", c.opts.ClientID, err)
+		}
+	}
+}
+
+// Healthy reports an error if the client isn't connected.  See
+// dsl.HealthChecker.
+//
+// With AutoReconnect, the client might be reconnecting on its own.
+func (c *MQTT) Healthy(ctx *dsl.Ctx) error {
+	if c.client == nil {
+		return fmt.Errorf("MQTT %s not opened", c.opts.ClientID)
+	}
+	if !c.client.IsConnectionOpen() {
+		return fmt.Errorf("MQTT %s not connected", c.opts.ClientID)
+	}
+	return nil
+}
+
 func (c *MQTT) Kind() dsl.ChanKind {
 	return "mqtt"
 }
@@ -370,8 +439,19 @@ func (c *MQTT) Close(ctx *dsl.Ctx) error {
 	return nil
 }
 
+// qos returns the QoS for Pub and Sub.
+func (c *MQTT) qos() byte {
+	if c.opts.QoS == nil {
+		return DefaultMQTTQoS
+	}
+	return *c.opts.QoS
+}
+
 func (c *MQTT) Sub(ctx *dsl.Ctx, topic string) error {
-	t := c.client.Subscribe(topic, 1, nil)
+	if c.topicOut != nil {
+		topic = c.topicOut(topic)
+	}
+	t := c.client.Subscribe(topic, c.qos(), nil)
 	if ok := t.WaitTimeout(dur(c.opts.SubTimeout)); !ok {
 		ctx.Warnf("Warning: MQTT wait timeout on Sub: %s", topic)
 	}
@@ -379,12 +459,15 @@ func (c *MQTT) Sub(ctx *dsl.Ctx, topic string) error {
 }
 
 func (c *MQTT) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	if c.topicOut != nil {
+		m.Topic = c.topicOut(m.Topic)
+	}
 	ctx.Logf("MQTT %s Pub %s", c.opts.ClientID, m.Topic)
 	js, err := dsl.MaybeSerialize(m.Payload)
 	if err != nil {
 		return nil
 	}
-	t := c.client.Publish(m.Topic, 1, false, js)
+	t := c.client.Publish(m.Topic, c.qos(), c.opts.Retain, js)
 	t.WaitTimeout(dur(c.opts.PubTimeout))
 
 	return t.Error()
@@ -405,16 +488,19 @@ func (c *MQTT) To(ctx *dsl.Ctx, m dsl.Msg) error {
 	ctx.Logf("MQTT %s To %s", c.opts.ClientID, m.Topic)
 	ctx.Logdf("     %s", m.Payload)
 	m.ReceivedAt = time.Now().UTC()
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
-		ctx.Logf("MQTT %s queued %s", c.opts.ClientID, m.Topic)
-	default:
-		panic("Warning: MQTT channel full")
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
 	}
+	ctx.Logf("MQTT %s queued %s", c.opts.ClientID, m.Topic)
 	return nil
 }
 
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *MQTT) Overflow() error {
+	return c.buf.Overflow()
+}
+
 func NewMQTTChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
 	o := MQTTOpts{}
 
@@ -429,6 +515,10 @@ func NewMQTTChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
 	}
 	log.Printf("debug %#v", o)
 
+	if o.QoS != nil && 2 < *o.QoS {
+		return nil, fmt.Errorf("NewMQTTChan: QoS %d isn't 0, 1, or 2", *o.QoS)
+	}
+
 	if o.PubTimeout == 0 {
 		o.PubTimeout = 1000 // ms
 	}
@@ -451,10 +541,16 @@ func NewMQTTChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
 		bufSize = DefaultMQTTBufferSize
 	}
 
+	buf, err := dsl.NewBuffer("mqtt", bufSize, o.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &MQTT{
 		opts:  &o,
 		mopts: mopts,
-		c:     make(chan dsl.Msg, bufSize),
+		c:     buf.C,
+		buf:   buf,
 	}
 
 	// We use the default handler to process all in-coming
@@ -471,13 +567,18 @@ func NewMQTTChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
 		js := m.Payload()
 		var x interface{}
 		if err := json.Unmarshal(js, &x); err != nil {
-			ctx.Warnf("warning: %s on %s from MQTT.Sub handler", err, js)
-			return
+			// Not JSON, so deliver the payload as a
+			// string (which might be an encrypted or
+			// signed envelope).
+			x = string(js)
 		}
 		msg := dsl.Msg{
 			Topic:   m.Topic(),
 			Payload: x,
 		}
+		if c.topicIn != nil {
+			msg.Topic = c.topicIn(msg.Topic)
+		}
 		go func() {
 			if err := c.To(ctx, msg); err != nil {
 				ctx.Warnf("warning: %s To for %s from MQTT.Sub handler", err, js)
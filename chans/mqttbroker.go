@@ -0,0 +1,233 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/mqttbroker"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "mqttbroker", NewMQTTBrokerChan)
+	dsl.TheChanDocs.Register("mqttbroker", "An embedded MQTT broker that reports the messages it routes.", MQTTBrokerOpts{})
+}
+
+// MQTTBrokerTopic is the topic of the message that an MQTTBroker
+// channel delivers when it starts.  The message's payload is an
+// object with "url" and "addr" properties that give the broker's
+// address (for an 'mqtt' channel's BrokerURL).
+const MQTTBrokerTopic = "plax/broker"
+
+// MQTTBroker is a Chan that runs an in-process MQTT broker (see
+// package mqttbroker).
+//
+// The channel observes the messages that the broker routes: A Sub
+// makes the channel receive messages with topics that match the
+// given filter.  A Pub publishes a message to the broker's clients.
+// A Kill drops every client ungracefully (so their wills are
+// published).
+type MQTTBroker struct {
+	opts   *MQTTBrokerOpts
+	broker *mqttbroker.Broker
+	c      chan dsl.Msg
+	buf    *dsl.Buffer
+
+	sync.Mutex
+	filters []string
+}
+
+// MQTTBrokerOpts configures an MQTTBroker.
+type MQTTBrokerOpts struct {
+	// Addr is the broker's listen address.
+	//
+	// The default is DefaultMQTTBrokerAddr, which picks an
+	// available port.  See MQTTBrokerTopic.
+	Addr string `json:",omitempty" yaml:",omitempty" doc:"The broker's listen address (HOST:PORT)." default:"127.0.0.1:0"`
+
+	// Retain, when true, makes each Pub a retained message.
+	Retain bool `json:",omitempty" yaml:",omitempty" doc:"Make each pub a retained message."`
+
+	// QoS is the QoS for each Pub.
+	QoS byte `json:",omitempty" yaml:",omitempty" doc:"QoS for pubs."`
+
+	// BufferSize specifies the capacity of the internal Go
+	// channel.
+	//
+	// The default is DefaultMQTTBufferSize.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// DefaultMQTTBrokerAddr is the default MQTTBrokerOpts.Addr.
+var DefaultMQTTBrokerAddr = "127.0.0.1:0"
+
+func NewMQTTBrokerChan(ctx *dsl.Ctx, opts interface{}) (dsl.Chan, error) {
+	o := MQTTBrokerOpts{}
+
+	js, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(js, &o); err != nil {
+		return nil, fmt.Errorf("NewMQTTBrokerChan: %w", err)
+	}
+
+	if 1 < o.QoS {
+		return nil, fmt.Errorf("NewMQTTBrokerChan: QoS %d isn't 0 or 1", o.QoS)
+	}
+	if o.Addr == "" {
+		o.Addr = DefaultMQTTBrokerAddr
+	}
+	if o.BufferSize == 0 {
+		o.BufferSize = DefaultMQTTBufferSize
+	}
+
+	buf, err := dsl.NewBuffer("mqttbroker", o.BufferSize, o.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MQTTBroker{
+		opts: &o,
+		c:    buf.C,
+		buf:  buf,
+	}, nil
+}
+
+func (c *MQTTBroker) Kind() dsl.ChanKind {
+	return "mqttbroker"
+}
+
+func (c *MQTTBroker) Open(ctx *dsl.Ctx) error {
+	b := mqttbroker.NewBroker()
+	b.Logf = ctx.Logdf
+	b.Observe = func(m *mqttbroker.Message) {
+		if !c.matches(m.Topic) {
+			return
+		}
+		var x interface{}
+		if err := json.Unmarshal(m.Payload, &x); err != nil {
+			x = string(m.Payload)
+		}
+		c.To(ctx, dsl.Msg{
+			Topic:   m.Topic,
+			Payload: x,
+		})
+	}
+
+	if err := b.Listen(c.opts.Addr); err != nil {
+		return dsl.NewBroken(fmt.Errorf("MQTTBroker listen on %s: %w", c.opts.Addr, err))
+	}
+	c.broker = b
+
+	ctx.Logf("MQTTBroker listening at %s", b.Addr())
+
+	return c.To(ctx, dsl.Msg{
+		Topic: MQTTBrokerTopic,
+		Payload: map[string]interface{}{
+			"url":  b.URL(),
+			"addr": b.Addr(),
+		},
+	})
+}
+
+// matches reports whether the topic matches a subscribed filter.
+func (c *MQTTBroker) matches(topic string) bool {
+	c.Lock()
+	defer c.Unlock()
+	for _, f := range c.filters {
+		if mqttbroker.Match(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *MQTTBroker) Close(ctx *dsl.Ctx) error {
+	ctx.Logf("MQTTBroker closing")
+	if c.broker == nil {
+		return nil
+	}
+	return c.broker.Close()
+}
+
+func (c *MQTTBroker) Sub(ctx *dsl.Ctx, topic string) error {
+	ctx.Logf("MQTTBroker Sub %s", topic)
+	c.Lock()
+	c.filters = append(c.filters, topic)
+	c.Unlock()
+	return nil
+}
+
+func (c *MQTTBroker) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("MQTTBroker Pub %s", m.Topic)
+	if c.broker == nil {
+		return fmt.Errorf("MQTTBroker isn't open")
+	}
+	js, err := dsl.MaybeSerialize(m.Payload)
+	if err != nil {
+		return err
+	}
+	c.broker.Publish(&mqttbroker.Message{
+		Topic:   m.Topic,
+		Payload: []byte(js),
+		QoS:     c.opts.QoS,
+		Retain:  c.opts.Retain,
+	})
+	return nil
+}
+
+func (c *MQTTBroker) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+// Kill drops every client's connection ungracefully, so the broker
+// publishes their wills.
+func (c *MQTTBroker) Kill(ctx *dsl.Ctx) error {
+	ctx.Logf("MQTTBroker Kill")
+	if c.broker == nil {
+		return fmt.Errorf("MQTTBroker isn't open")
+	}
+	c.broker.Drop(false)
+	return nil
+}
+
+func (c *MQTTBroker) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("MQTTBroker To %s", m.Topic)
+	ctx.Logdf("     %s", m.Payload)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *MQTTBroker) Overflow() error {
+	return c.buf.Overflow()
+}
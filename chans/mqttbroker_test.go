@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestMQTTBroker(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+
+	recv := func(c dsl.Chan) dsl.Msg {
+		select {
+		case m := <-c.Recv(ctx):
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return dsl.Msg{}
+	}
+
+	b, err := NewMQTTBrokerChan(ctx, MQTTBrokerOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(ctx)
+
+	m := recv(b)
+	if m.Topic != MQTTBrokerTopic {
+		t.Fatal(m.Topic)
+	}
+	url, _ := m.Payload.(map[string]interface{})["url"].(string)
+	if url == "" {
+		t.Fatal(m.Payload)
+	}
+
+	c, err := NewMQTTChan(ctx, MQTTOpts{
+		BrokerURL:    url,
+		ClientID:     "test",
+		CleanSession: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = b.Sub(ctx, "orders/+"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Sub(ctx, "orders/#"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "orders/1",
+		Payload: `{"want":"tacos"}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []dsl.Chan{b, c} {
+		m := recv(ch)
+		if m.Topic != "orders/1" || m.Payload.(map[string]interface{})["want"] != "tacos" {
+			t.Fatal(m)
+		}
+	}
+
+	// Not observed by the broker channel.
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "orders/1/status",
+		Payload: "queued",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m := recv(c); m.Payload != "queued" {
+		t.Fatal(m)
+	}
+
+	if err = b.Pub(ctx, dsl.Msg{
+		Topic:   "orders/2",
+		Payload: "chips",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m := recv(b); m.Topic != "orders/2" {
+		t.Fatal(m)
+	}
+	if m := recv(c); m.Topic != "orders/2" || m.Payload != "chips" {
+		t.Fatal(m)
+	}
+
+	select {
+	case m := <-b.Recv(ctx):
+		t.Fatal(m)
+	default:
+	}
+}
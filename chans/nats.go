@@ -0,0 +1,542 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "nats", NewNATSChan)
+	dsl.TheChanDocs.Register("nats", "A NATS client with JetStream consumers and request/reply.", NATSOpts{})
+}
+
+// NATSOpts configures a NATS channel.
+type NATSOpts struct {
+	// URL is the server's URL, like "nats://localhost:4222" (or
+	// "tls://..." to require TLS).
+	URL string `json:",omitempty" yaml:",omitempty" doc:"The server's URL (nats://HOST:PORT or tls://HOST:PORT)." default:"nats://localhost:4222"`
+
+	// Name is the optional connection name.
+	Name string `json:",omitempty" yaml:",omitempty" doc:"The connection's name."`
+
+	// User and Password, or Token, are optional credentials.
+	User     string `json:",omitempty" yaml:",omitempty" doc:"The username."`
+	Password string `json:",omitempty" yaml:",omitempty" doc:"The password."`
+	Token    string `json:",omitempty" yaml:",omitempty" doc:"The authentication token."`
+
+	// Insecure skips verification of the server's certificate.
+	Insecure bool `json:",omitempty" yaml:",omitempty" doc:"Skip verification of the server's certificate (for testing only)."`
+
+	// Requests, when true, makes each Pub a request: The
+	// channel receives the reply as a message with the request's
+	// topic.
+	Requests bool `json:",omitempty" yaml:",omitempty" doc:"Make each pub a request whose reply the channel receives with the request's topic."`
+
+	// RequestTimeout is the timeout in milliseconds for JetStream
+	// API requests and for replies to requests.
+	RequestTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Timeout in milliseconds for replies." default:"5000"`
+
+	// Stream, when not empty, makes each Sub create a JetStream
+	// consumer for the stream.  The Sub's topic is the consumer's
+	// filter subject.
+	Stream string `json:",omitempty" yaml:",omitempty" doc:"JetStream stream for consumers (which subs create)."`
+
+	// Durable is the durable name for JetStream consumers.
+	Durable string `json:",omitempty" yaml:",omitempty" doc:"Durable name for JetStream consumers (ephemeral if empty)."`
+
+	// AckPolicy is the JetStream consumer's ack policy: "explicit",
+	// "all", or "none".
+	AckPolicy string `json:",omitempty" yaml:",omitempty" doc:"JetStream ack policy: explicit, all, or none." default:"explicit"`
+
+	// DeliverPolicy is the JetStream consumer's deliver policy
+	// (like "all", "last", or "new").
+	DeliverPolicy string `json:",omitempty" yaml:",omitempty" doc:"JetStream deliver policy: all, last, new, or last_per_subject." default:"all"`
+
+	// NoAck, when true, suppresses acknowledgements of JetStream
+	// messages (to test redelivery).
+	NoAck bool `json:",omitempty" yaml:",omitempty" doc:"Don't acknowledge JetStream messages."`
+
+	// BufferSize specifies the capacity of the internal Go
+	// channel.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// NATS is a Chan for a NATS server.
+//
+// A Sub subscribes to a subject (or, with a Stream, creates a
+// JetStream push consumer), and a Pub publishes a message (or, with
+// Requests, makes a request).  Received messages have their subjects
+// as topics and their payloads parsed as JSON if possible.
+type NATS struct {
+	opts *NATSOpts
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+
+	conn net.Conn
+	r    *bufio.Reader
+
+	// wmu serializes writes.
+	wmu sync.Mutex
+
+	sync.Mutex
+	sid     int
+	subs    map[string]func(subject, reply string, payload []byte)
+	inbox   string
+	replies map[string]func(payload []byte)
+	pongs   chan error
+	closed  bool
+}
+
+func NewNATSChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := NATSOpts{
+		URL:            "nats://localhost:4222",
+		RequestTimeout: 5000,
+		AckPolicy:      "explicit",
+		DeliverPolicy:  "all",
+		BufferSize:     DefaultChanBufferSize,
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	switch opts.AckPolicy {
+	case "explicit", "all", "none":
+	default:
+		return nil, dsl.Brokenf("NewNATSChan: AckPolicy '%s' isn't explicit, all, or none", opts.AckPolicy)
+	}
+
+	buf, err := dsl.NewBuffer("nats", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATS{
+		opts:    &opts,
+		c:       buf.C,
+		buf:     buf,
+		subs:    make(map[string]func(string, string, []byte)),
+		replies: make(map[string]func([]byte)),
+		pongs:   make(chan error, 1),
+	}, nil
+}
+
+func (c *NATS) Kind() dsl.ChanKind {
+	return "nats"
+}
+
+// natsInfo is the part of the server's INFO that we use.
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+func (c *NATS) Open(ctx *dsl.Ctx) error {
+	u, err := url.Parse(c.opts.URL)
+	if err != nil {
+		return dsl.NewBroken(fmt.Errorf("NATS URL: %w", err))
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host += ":4222"
+	}
+
+	ctx.Logf("NATS connecting to %s", host)
+	conn, err := net.DialTimeout("tcp", host, c.timeout())
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(c.timeout()))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("NATS INFO: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("NATS expected INFO but got %q", line)
+	}
+	var info natsInfo
+	if err = json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		conn.Close()
+		return fmt.Errorf("NATS INFO: %w", err)
+	}
+
+	if info.TLSRequired || u.Scheme == "tls" {
+		tc := tls.Client(conn, &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: c.opts.Insecure,
+		})
+		if err = tc.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("NATS TLS: %w", err)
+		}
+		conn = tc
+		r = bufio.NewReader(conn)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	c.conn, c.r = conn, r
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"lang":     "go",
+		"version":  "plax",
+		"protocol": 1,
+		"name":     c.opts.Name,
+	}
+	if c.opts.User != "" {
+		connect["user"] = c.opts.User
+		connect["pass"] = c.opts.Password
+	}
+	if c.opts.Token != "" {
+		connect["auth_token"] = c.opts.Token
+	}
+	js, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+
+	go c.read(ctx)
+
+	if err = c.write("CONNECT " + string(js) + "\r\nPING\r\n"); err != nil {
+		return err
+	}
+	select {
+	case err = <-c.pongs:
+	case <-time.After(c.timeout()):
+		err = fmt.Errorf("no PONG after %s", c.timeout())
+	}
+	if err != nil {
+		c.conn.Close()
+		return fmt.Errorf("NATS connect: %w", err)
+	}
+
+	// One wildcard subscription for all replies.
+	bs := make([]byte, 8)
+	if _, err = rand.Read(bs); err != nil {
+		return err
+	}
+	c.inbox = "_INBOX." + hex.EncodeToString(bs)
+	return c.subscribe(c.inbox+".*", func(subject, reply string, payload []byte) {
+		c.Lock()
+		f, have := c.replies[subject]
+		delete(c.replies, subject)
+		c.Unlock()
+		if have {
+			f(payload)
+		}
+	})
+}
+
+// timeout returns the RequestTimeout.
+func (c *NATS) timeout() time.Duration {
+	return time.Duration(c.opts.RequestTimeout) * time.Millisecond
+}
+
+func (c *NATS) write(s string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+// publish sends a PUB.
+func (c *NATS) publish(subject, reply string, payload []byte) error {
+	head := "PUB " + subject
+	if reply != "" {
+		head += " " + reply
+	}
+	return c.write(head + " " + strconv.Itoa(len(payload)) + "\r\n" + string(payload) + "\r\n")
+}
+
+// subscribe sends a SUB and registers its handler.
+func (c *NATS) subscribe(subject string, f func(subject, reply string, payload []byte)) error {
+	c.Lock()
+	c.sid++
+	sid := strconv.Itoa(c.sid)
+	c.subs[sid] = f
+	c.Unlock()
+	return c.write("SUB " + subject + " " + sid + "\r\n")
+}
+
+// newInbox returns a new reply subject whose reply is given to f.
+func (c *NATS) newInbox(f func(payload []byte)) string {
+	c.Lock()
+	defer c.Unlock()
+	c.sid++
+	inbox := c.inbox + "." + strconv.Itoa(c.sid)
+	c.replies[inbox] = f
+	return inbox
+}
+
+// request publishes a request and waits for its reply.
+func (c *NATS) request(subject string, payload []byte) ([]byte, error) {
+	replies := make(chan []byte, 1)
+	inbox := c.newInbox(func(payload []byte) {
+		replies <- payload
+	})
+	if err := c.publish(subject, inbox, payload); err != nil {
+		return nil, err
+	}
+	select {
+	case bs := <-replies:
+		return bs, nil
+	case <-time.After(c.timeout()):
+		c.Lock()
+		delete(c.replies, inbox)
+		c.Unlock()
+		return nil, fmt.Errorf("no reply to %s after %s", subject, c.timeout())
+	}
+}
+
+// read processes the server's messages until the connection fails.
+func (c *NATS) read(ctx *dsl.Ctx) {
+	err := c.readLoop(ctx)
+	c.Lock()
+	closed := c.closed
+	c.Unlock()
+	if !closed {
+		ctx.Warnf("warning: NATS connection: %s", err)
+		select {
+		case c.pongs <- err:
+		default:
+		}
+	}
+}
+
+func (c *NATS) readLoop(ctx *dsl.Ctx) error {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch op {
+		case "PING":
+			if err = c.write("PONG\r\n"); err != nil {
+				return err
+			}
+		case "PONG":
+			select {
+			case c.pongs <- nil:
+			default:
+			}
+		case "-ERR":
+			err := fmt.Errorf("server error: %s", strings.TrimSpace(line[4:]))
+			ctx.Warnf("warning: NATS %s", err)
+			select {
+			case c.pongs <- err:
+			default:
+			}
+		case "MSG":
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			args := strings.Fields(line)[1:]
+			if len(args) < 3 || 4 < len(args) {
+				return fmt.Errorf("bad MSG %q", line)
+			}
+			n, err := strconv.Atoi(args[len(args)-1])
+			if err != nil {
+				return fmt.Errorf("bad MSG %q", line)
+			}
+			payload := make([]byte, n+2)
+			if _, err = io.ReadFull(c.r, payload); err != nil {
+				return err
+			}
+			var reply string
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			c.Lock()
+			f := c.subs[args[1]]
+			c.Unlock()
+			if f != nil {
+				f(args[0], reply, payload[:n])
+			}
+		case "INFO", "+OK":
+		default:
+			ctx.Logdf("NATS ignoring %q", line)
+		}
+	}
+}
+
+func (c *NATS) Close(ctx *dsl.Ctx) error {
+	ctx.Logf("NATS closing")
+	c.Lock()
+	c.closed = true
+	c.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// deliver gives a received message to the channel.
+func (c *NATS) deliver(ctx *dsl.Ctx, subject string, payload []byte) {
+	var x interface{}
+	if err := json.Unmarshal(payload, &x); err != nil {
+		x = string(payload)
+	}
+	c.To(ctx, dsl.Msg{
+		Topic:   subject,
+		Payload: x,
+	})
+}
+
+// natsConsumerResponse is the part of a JetStream API response that
+// we use.
+type natsConsumerResponse struct {
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func (c *NATS) Sub(ctx *dsl.Ctx, topic string) error {
+	ctx.Logf("NATS Sub %s", topic)
+
+	if c.opts.Stream == "" {
+		return c.subscribe(topic, func(subject, reply string, payload []byte) {
+			c.deliver(ctx, subject, payload)
+		})
+	}
+
+	// A JetStream push consumer that delivers to a new subject.
+	c.Lock()
+	c.sid++
+	deliver := c.inbox + ".js." + strconv.Itoa(c.sid)
+	c.Unlock()
+
+	ack := c.opts.AckPolicy != "none" && !c.opts.NoAck
+	err := c.subscribe(deliver, func(subject, reply string, payload []byte) {
+		// The server delivers the message with its original
+		// subject and with a reply subject for the ack.
+		c.deliver(ctx, subject, payload)
+		if ack && reply != "" {
+			if err := c.publish(reply, "", []byte("+ACK")); err != nil {
+				ctx.Warnf("warning: NATS ack: %s", err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	config := map[string]interface{}{
+		"deliver_subject": deliver,
+		"ack_policy":      c.opts.AckPolicy,
+		"deliver_policy":  c.opts.DeliverPolicy,
+		"filter_subject":  topic,
+	}
+	api := "$JS.API.CONSUMER.CREATE." + c.opts.Stream
+	if c.opts.Durable != "" {
+		config["durable_name"] = c.opts.Durable
+		api = "$JS.API.CONSUMER.DURABLE.CREATE." + c.opts.Stream + "." + c.opts.Durable
+	}
+	js, err := json.Marshal(map[string]interface{}{
+		"stream_name": c.opts.Stream,
+		"config":      config,
+	})
+	if err != nil {
+		return err
+	}
+	bs, err := c.request(api, js)
+	if err != nil {
+		return fmt.Errorf("NATS JetStream consumer: %w", err)
+	}
+	var resp natsConsumerResponse
+	if err = json.Unmarshal(bs, &resp); err != nil {
+		return fmt.Errorf("NATS JetStream consumer: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("NATS JetStream consumer: %s (%d)", resp.Error.Description, resp.Error.Code)
+	}
+	return nil
+}
+
+func (c *NATS) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("NATS Pub %s", m.Topic)
+	s, err := dsl.MaybeSerialize(m.Payload)
+	if err != nil {
+		return err
+	}
+	if !c.opts.Requests {
+		return c.publish(m.Topic, "", []byte(s))
+	}
+
+	inbox := c.newInbox(func(payload []byte) {
+		c.deliver(ctx, m.Topic, payload)
+	})
+	go func() {
+		time.Sleep(c.timeout())
+		c.Lock()
+		_, waiting := c.replies[inbox]
+		delete(c.replies, inbox)
+		c.Unlock()
+		if waiting {
+			ctx.Warnf("warning: NATS no reply to %s after %s", m.Topic, c.timeout())
+		}
+	}()
+	return c.publish(m.Topic, inbox, []byte(s))
+}
+
+func (c *NATS) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+// Kill closes the connection abruptly.
+func (c *NATS) Kill(ctx *dsl.Ctx) error {
+	return c.Close(ctx)
+}
+
+func (c *NATS) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("NATS To %s", m.Topic)
+	ctx.Logdf("     %s", m.Payload)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *NATS) Overflow() error {
+	return c.buf.Overflow()
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeNATS is a tiny NATS server with just enough JetStream to
+// create a consumer for a stream's stored messages.
+type fakeNATS struct {
+	ln net.Listener
+
+	sync.Mutex
+	subs   map[string]fakeNATSSub
+	stream []string
+	acks   []string
+	conns  []net.Conn
+}
+
+type fakeNATSSub struct {
+	subject string
+	w       func(string)
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{
+		ln:   ln,
+		subs: make(map[string]fakeNATSSub),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.conns = append(s.conns, conn)
+			s.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) Close() {
+	s.ln.Close()
+	s.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.Unlock()
+}
+
+// natsMatch reports whether the subject matches the (possibly
+// wildcarded) subscription subject.
+func natsMatch(sub, subject string) bool {
+	var (
+		ps = strings.Split(sub, ".")
+		ts = strings.Split(subject, ".")
+	)
+	for i, p := range ps {
+		if p == ">" {
+			return i < len(ts)
+		}
+		if len(ts) <= i || (p != "*" && p != ts[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(ts)
+}
+
+func (s *fakeNATS) route(subject, reply, payload string) {
+	s.deliver(subject, subject, reply, payload)
+}
+
+// deliver sends the message to subscribers to the target with the
+// given subject (which differs from the target for JetStream
+// deliveries).
+func (s *fakeNATS) deliver(target, subject, reply, payload string) {
+	s.Lock()
+	defer s.Unlock()
+	for sid, sub := range s.subs {
+		if natsMatch(sub.subject, target) {
+			head := "MSG " + subject + " " + strings.SplitN(sid, "/", 2)[1]
+			if reply != "" {
+				head += " " + reply
+			}
+			sub.w(head + " " + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n")
+		}
+	}
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	var (
+		r  = bufio.NewReader(conn)
+		mu sync.Mutex
+		w  = func(s string) {
+			mu.Lock()
+			io.WriteString(conn, s)
+			mu.Unlock()
+		}
+		id = conn.RemoteAddr().String()
+	)
+	w(`INFO {"server_id":"fake","version":"2.2.0","max_payload":1048576}` + "\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "CONNECT":
+			if strings.Contains(line, `"auth_token":"bad"`) {
+				w("-ERR 'Authorization Violation'\r\n")
+			}
+		case "PING":
+			w("PONG\r\n")
+		case "SUB":
+			s.Lock()
+			s.subs[id+"/"+args[len(args)-1]] = fakeNATSSub{args[1], w}
+			s.Unlock()
+		case "PUB":
+			n, _ := strconv.Atoi(args[len(args)-1])
+			bs := make([]byte, n+2)
+			if _, err := io.ReadFull(r, bs); err != nil {
+				return
+			}
+			var (
+				subject = args[1]
+				payload = string(bs[:n])
+				reply   string
+			)
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			switch {
+			case strings.HasPrefix(subject, "$JS.API.CONSUMER."):
+				s.createConsumer(subject, reply, payload)
+			case strings.HasPrefix(subject, "$JS.ACK."):
+				s.Lock()
+				s.acks = append(s.acks, subject+" "+payload)
+				s.Unlock()
+			case strings.HasPrefix(subject, "orders."):
+				s.Lock()
+				s.stream = append(s.stream, subject+" "+payload)
+				s.Unlock()
+				s.route(subject, reply, payload)
+			default:
+				s.route(subject, reply, payload)
+			}
+		}
+	}
+}
+
+func (s *fakeNATS) createConsumer(api, reply, payload string) {
+	var req struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || !strings.HasSuffix(api, ".ORDERS.worker") {
+		s.route(reply, "", `{"error":{"code":404,"description":"stream not found"}}`)
+		return
+	}
+	s.route(reply, "", `{"type":"io.nats.jetstream.api.v1.consumer_create_response"}`)
+
+	s.Lock()
+	stored := append([]string{}, s.stream...)
+	s.Unlock()
+	for i, m := range stored {
+		parts := strings.SplitN(m, " ", 2)
+		if natsMatch(req.Config["filter_subject"].(string), parts[0]) {
+			s.deliver(req.Config["deliver_subject"].(string), parts[0], fmt.Sprintf("$JS.ACK.ORDERS.worker.1.%d.%d.0.0", i+1, i+1), parts[1])
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	var (
+		ctx = dsl.NewCtx(context.Background())
+		s   = newFakeNATS(t)
+		url = "nats://" + s.ln.Addr().String()
+	)
+	defer s.Close()
+
+	recv := func(c dsl.Chan) dsl.Msg {
+		select {
+		case m := <-c.Recv(ctx):
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return dsl.Msg{}
+	}
+
+	open := func(opts NATSOpts) dsl.Chan {
+		opts.URL = url
+		c, err := NewNATSChan(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	t.Run("core", func(t *testing.T) {
+		c := open(NATSOpts{})
+		defer c.Close(ctx)
+		if err := c.Sub(ctx, "orders.>"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Pub(ctx, dsl.Msg{
+			Topic:   "orders.1",
+			Payload: map[string]interface{}{"want": "tacos"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		m := recv(c)
+		if m.Topic != "orders.1" || m.Payload.(map[string]interface{})["want"] != "tacos" {
+			t.Fatal(m)
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		server := open(NATSOpts{})
+		defer server.Close(ctx)
+		ns := server.(*NATS)
+		if err := ns.subscribe("time.now", func(subject, reply string, payload []byte) {
+			ns.publish(reply, "", []byte(`{"now":"`+string(payload)+`"}`))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		c := open(NATSOpts{
+			Requests: true,
+		})
+		defer c.Close(ctx)
+		if err := c.Pub(ctx, dsl.Msg{
+			Topic:   "time.now",
+			Payload: "noon",
+		}); err != nil {
+			t.Fatal(err)
+		}
+		m := recv(c)
+		if m.Topic != "time.now" || m.Payload.(map[string]interface{})["now"] != "noon" {
+			t.Fatal(m)
+		}
+	})
+
+	t.Run("jetstream", func(t *testing.T) {
+		s.Lock()
+		s.stream = nil
+		s.Unlock()
+
+		pub := open(NATSOpts{})
+		defer pub.Close(ctx)
+		for _, topic := range []string{"orders.2", "orders.3"} {
+			if err := pub.Pub(ctx, dsl.Msg{
+				Topic:   topic,
+				Payload: "chips",
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Let the server store the messages.
+		time.Sleep(50 * time.Millisecond)
+
+		c := open(NATSOpts{
+			Stream:  "ORDERS",
+			Durable: "worker",
+		})
+		defer c.Close(ctx)
+		if err := c.Sub(ctx, "orders.>"); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"orders.2", "orders.3"} {
+			if m := recv(c); m.Topic != want || m.Payload != "chips" {
+				t.Fatal(m)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		s.Lock()
+		acks := s.acks
+		s.Unlock()
+		if len(acks) != 2 || !strings.HasSuffix(acks[0], " +ACK") {
+			t.Fatal(acks)
+		}
+
+		bad := open(NATSOpts{
+			Stream: "NOPE",
+		})
+		defer bad.Close(ctx)
+		if err := bad.Sub(ctx, "x"); err == nil {
+			t.Fatal("should have complained")
+		}
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		c, err := NewNATSChan(ctx, NATSOpts{
+			URL:   url,
+			Token: "bad",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Open(ctx); err == nil {
+			t.Fatal("should have complained")
+		}
+	})
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "s3", NewS3Chan)
+	dsl.TheChanDocs.Register("s3", "An S3 (or compatible object storage) client that writes objects and reports new, changed, and deleted objects.", S3Opts{})
+}
+
+// S3Opts configures an S3 channel.
+type S3Opts struct {
+	// Bucket is the default bucket.
+	Bucket string `json:",omitempty" yaml:",omitempty" doc:"The default bucket."`
+
+	// Region is the AWS region, which defaults to the region from
+	// the AWS configuration.
+	Region string `json:",omitempty" yaml:",omitempty" doc:"The AWS region."`
+
+	// Endpoint is an optional endpoint for S3-compatible storage
+	// (like MinIO or LocalStack).
+	Endpoint string `json:",omitempty" yaml:",omitempty" doc:"Endpoint for S3-compatible storage."`
+
+	// PathStyle, when true, uses path-style URLs (which
+	// S3-compatible storage often requires).
+	PathStyle bool `json:",omitempty" yaml:",omitempty" doc:"Use path-style URLs."`
+
+	// PollInterval is the interval in milliseconds between
+	// listings for each Sub.
+	PollInterval int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds between listings." default:"1000"`
+
+	// Existing, when true, reports the objects that already
+	// exist when a Sub starts.
+	Existing bool `json:",omitempty" yaml:",omitempty" doc:"Report objects that exist when a sub starts."`
+
+	// Fetch, when true, includes the contents of each new or
+	// changed object (parsed as JSON if possible).
+	Fetch bool `json:",omitempty" yaml:",omitempty" doc:"Include the contents of new and changed objects."`
+
+	// ContentType is the content type for objects that Pub
+	// writes.
+	ContentType string `json:",omitempty" yaml:",omitempty" doc:"Content type for written objects."`
+
+	// BufferSize is the size of the underlying channel buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// S3Object is the payload of a message that reports an object.
+type S3Object struct {
+	// Event is "existing", "created", "changed", or "deleted".
+	Event string `json:"event"`
+
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastmodified"`
+
+	// Body is the object's contents (see S3Opts.Fetch).
+	Body interface{} `json:"body,omitempty"`
+}
+
+// S3Chan is a channel for S3 buckets.
+//
+// A Pub writes its payload (a string as is and anything else as
+// JSON) to the object named by the message's topic, which is either
+// a key (in the default Bucket) or "s3://BUCKET/KEY".
+//
+// A Sub with a topic that's a key prefix (in the default Bucket) or
+// "s3://BUCKET/PREFIX" polls that prefix, and the channel receives
+// messages (with the objects' keys as topics) that report new,
+// changed, and deleted objects.  See S3Object.
+type S3Chan struct {
+	opts *S3Opts
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+	svc  *s3.S3
+
+	ctl       chan bool
+	closeOnce sync.Once
+}
+
+func NewS3Chan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := S3Opts{
+		PollInterval: 1000,
+		BufferSize:   DefaultChanBufferSize,
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	if opts.PollInterval <= 0 {
+		return nil, dsl.Brokenf("NewS3Chan: PollInterval %d isn't positive", opts.PollInterval)
+	}
+	buf, err := dsl.NewBuffer("s3", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Chan{
+		opts: &opts,
+		c:    buf.C,
+		buf:  buf,
+		ctl:  make(chan bool),
+	}, nil
+}
+
+func (c *S3Chan) Kind() dsl.ChanKind {
+	return "s3"
+}
+
+func (c *S3Chan) Open(ctx *dsl.Ctx) error {
+	cfg := aws.Config{}
+	if c.opts.Region != "" {
+		cfg.Region = aws.String(c.opts.Region)
+	}
+	if c.opts.Endpoint != "" {
+		cfg.Endpoint = aws.String(c.opts.Endpoint)
+	}
+	if c.opts.PathStyle {
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config:            cfg,
+	})
+	if err != nil {
+		return dsl.NewBroken(err)
+	}
+	c.svc = s3.New(sess)
+	return nil
+}
+
+func (c *S3Chan) Close(ctx *dsl.Ctx) error {
+	c.closeOnce.Do(func() {
+		close(c.ctl)
+	})
+	return nil
+}
+
+// location returns the bucket and key (or prefix) for a topic.  See
+// S3Chan.
+func (c *S3Chan) location(topic string) (string, string, error) {
+	if strings.HasPrefix(topic, "s3://") {
+		parts := strings.SplitN(topic[len("s3://"):], "/", 2)
+		if len(parts) == 1 {
+			return parts[0], "", nil
+		}
+		return parts[0], parts[1], nil
+	}
+	if c.opts.Bucket == "" {
+		return "", "", fmt.Errorf("S3 topic '%s' has no bucket, and there's no default Bucket", topic)
+	}
+	return c.opts.Bucket, topic, nil
+}
+
+func (c *S3Chan) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	bucket, key, err := c.location(m.Topic)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("S3 Pub to '%s' has no key", m.Topic)
+	}
+	body, err := dsl.MaybeSerialize(m.Payload)
+	if err != nil {
+		return err
+	}
+	ctx.Logf("S3 Pub s3://%s/%s", bucket, key)
+
+	in := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte(body)),
+	}
+	if c.opts.ContentType != "" {
+		in.ContentType = aws.String(c.opts.ContentType)
+	}
+	_, err = c.svc.PutObjectWithContext(ctx, in)
+	return err
+}
+
+// Sub starts polling the prefix.  See S3Chan.
+func (c *S3Chan) Sub(ctx *dsl.Ctx, topic string) error {
+	bucket, prefix, err := c.location(topic)
+	if err != nil {
+		return err
+	}
+	ctx.Logf("S3 Sub s3://%s/%s", bucket, prefix)
+
+	// Get the baseline before returning so that the test's
+	// subsequent steps see changes.
+	seen, err := c.list(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	if c.opts.Existing {
+		for _, o := range seen {
+			c.report(ctx, "existing", o)
+		}
+	}
+
+	go c.poll(ctx, bucket, prefix, seen)
+
+	return nil
+}
+
+// list returns the objects with the given prefix.
+func (c *S3Chan) list(ctx *dsl.Ctx, bucket, prefix string) (map[string]*S3Object, error) {
+	acc := make(map[string]*S3Object)
+	err := c.svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			key := aws.StringValue(o.Key)
+			acc[key] = &S3Object{
+				Bucket:       bucket,
+				Key:          key,
+				Size:         aws.Int64Value(o.Size),
+				ETag:         strings.Trim(aws.StringValue(o.ETag), `"`),
+				LastModified: aws.TimeValue(o.LastModified),
+			}
+		}
+		return true
+	})
+	return acc, err
+}
+
+// poll lists the prefix every PollInterval and reports the
+// differences.
+func (c *S3Chan) poll(ctx *dsl.Ctx, bucket, prefix string, seen map[string]*S3Object) {
+	interval := time.Duration(c.opts.PollInterval) * time.Millisecond
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.ctl:
+			return
+		case <-time.After(interval):
+		}
+
+		now, err := c.list(ctx, bucket, prefix)
+		if err != nil {
+			ctx.Warnf("warning: S3 list s3://%s/%s: %s", bucket, prefix, err)
+			continue
+		}
+		for key, o := range now {
+			was, have := seen[key]
+			switch {
+			case !have:
+				c.report(ctx, "created", o)
+			case was.ETag != o.ETag || !was.LastModified.Equal(o.LastModified):
+				c.report(ctx, "changed", o)
+			}
+		}
+		for key, o := range seen {
+			if _, have := now[key]; !have {
+				c.report(ctx, "deleted", o)
+			}
+		}
+		seen = now
+	}
+}
+
+// report delivers a message about the object (with its contents if
+// Fetch).
+func (c *S3Chan) report(ctx *dsl.Ctx, event string, o *S3Object) {
+	x := *o
+	x.Event = event
+	if c.opts.Fetch && event != "deleted" {
+		out, err := c.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(o.Bucket),
+			Key:    aws.String(o.Key),
+		})
+		if err == nil {
+			var bs []byte
+			bs, err = ioutil.ReadAll(out.Body)
+			out.Body.Close()
+			if err == nil {
+				var v interface{}
+				if json.Unmarshal(bs, &v) != nil {
+					v = string(bs)
+				}
+				x.Body = v
+			}
+		}
+		if err != nil {
+			ctx.Warnf("warning: S3 get s3://%s/%s: %s", o.Bucket, o.Key, err)
+		}
+	}
+	c.To(ctx, dsl.Msg{
+		Topic:   o.Key,
+		Payload: dsl.Canon(&x),
+	})
+}
+
+func (c *S3Chan) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *S3Chan) Kill(ctx *dsl.Ctx) error {
+	return fmt.Errorf("Kill is not supported by a %T", c)
+}
+
+func (c *S3Chan) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("S3 To %s", m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *S3Chan) Overflow() error {
+	return c.buf.Overflow()
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeS3 is a tiny imitation of S3's PutObject, GetObject,
+// DeleteObject, and ListObjectsV2 for path-style requests.
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	times   map[string]time.Time
+}
+
+type fakeS3Contents struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == "PUT":
+		bs, _ := ioutil.ReadAll(r.Body)
+		s.objects[path] = bs
+		s.times[path] = time.Now().UTC()
+	case r.Method == "DELETE":
+		delete(s.objects, path)
+	case r.Method == "GET" && r.URL.Query().Get("list-type") == "2":
+		var (
+			prefix = path + "/" + r.URL.Query().Get("prefix")
+			keys   []string
+		)
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		result := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			IsTruncated bool
+			Contents    []fakeS3Contents
+		}{
+			Name: path,
+		}
+		for _, k := range keys {
+			sum := md5.Sum(s.objects[k])
+			result.Contents = append(result.Contents, fakeS3Contents{
+				Key:          strings.TrimPrefix(k, path+"/"),
+				LastModified: s.times[k].Format(time.RFC3339Nano),
+				ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+				Size:         len(s.objects[k]),
+			})
+		}
+		bs, _ := xml.Marshal(&result)
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(bs)
+	case r.Method == "GET":
+		bs, have := s.objects[path]
+		if !have {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bs)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestS3(t *testing.T) {
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	} {
+		was, had := os.LookupEnv(k)
+		os.Setenv(k, v)
+		defer func(k string) {
+			if had {
+				os.Setenv(k, was)
+			} else {
+				os.Unsetenv(k)
+			}
+		}(k)
+	}
+
+	var (
+		ctx = dsl.NewCtx(context.Background())
+		fs3 = &fakeS3{
+			objects: map[string][]byte{
+				"outputs/old/1.json": []byte(`{"n":1}`),
+			},
+			times: map[string]time.Time{
+				"outputs/old/1.json": time.Now().UTC(),
+			},
+		}
+		s = httptest.NewServer(fs3)
+	)
+	defer s.Close()
+
+	recv := func(c dsl.Chan) dsl.Msg {
+		select {
+		case m := <-c.Recv(ctx):
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		return dsl.Msg{}
+	}
+
+	c, err := NewS3Chan(ctx, S3Opts{
+		Bucket:       "outputs",
+		Region:       "us-east-1",
+		Endpoint:     s.URL,
+		PathStyle:    true,
+		PollInterval: 20,
+		Existing:     true,
+		Fetch:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Sub(ctx, "old/"); err != nil {
+		t.Fatal(err)
+	}
+	m := recv(c)
+	x := m.Payload.(map[string]interface{})
+	if m.Topic != "old/1.json" || x["event"] != "existing" || x["body"].(map[string]interface{})["n"] != 1.0 {
+		t.Fatal(m)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "old/2.txt",
+		Payload: "hello",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if m.Topic != "old/2.txt" || x["event"] != "created" || x["body"] != "hello" || x["size"] != 5.0 {
+		t.Fatal(m)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "s3://outputs/old/2.txt",
+		Payload: map[string]interface{}{"changed": true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m = recv(c)
+	x = m.Payload.(map[string]interface{})
+	if x["event"] != "changed" || x["body"].(map[string]interface{})["changed"] != true {
+		t.Fatal(m)
+	}
+
+	fs3.Lock()
+	delete(fs3.objects, "outputs/old/1.json")
+	fs3.Unlock()
+	m = recv(c)
+	if x = m.Payload.(map[string]interface{}); m.Topic != "old/1.json" || x["event"] != "deleted" {
+		t.Fatal(m)
+	}
+
+	// Not under the prefix.
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "new/1.txt",
+		Payload: "ignored",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-c.Recv(ctx):
+		t.Fatal(m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -30,6 +30,7 @@ import (
 
 func init() {
 	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "sqs", NewSQSChan)
+	dsl.TheChanDocs.Register("sqs", "An AWS SQS client.", SQSOpts{})
 }
 
 var (
@@ -47,39 +48,43 @@ type SQSOpts struct {
 	// Endpoint is optional AWS service endpoint, which can be
 	// provided to point to a non-standard endpoint (like a local
 	// implementation).
-	Endpoint string
+	Endpoint string `doc:"Optional AWS service endpoint."`
 
 	// QueueURL is the target SQS queue URL.
-	QueueURL string
+	QueueURL string `doc:"The SQS queue URL."`
 
 	// DelaySeconds is the publishing delay in seconds.
 	//
 	// Defaults to zero.
-	DelaySeconds int64
+	DelaySeconds int64 `doc:"Publishing delay in seconds." default:"0"`
 
 	// VisibilityTimeout is the default timeout for a message reappearing after a receive operation and before a delete operation.  Defaults to 10 seconds.
-	VisibilityTimeout int64
+	VisibilityTimeout int64 `doc:"Seconds before a received message reappears." default:"10"`
 
 	// MaxMessages is the maximum number of message to request.
 	//
 	// Defaults to 1.
-	MaxMessages int
+	MaxMessages int `doc:"Maximum number of messages per request." default:"1"`
 
 	// DoNotDelete turns off automatic message deletion upon receipt.
-	DoNotDelete bool
+	DoNotDelete bool `doc:"Don't delete messages upon receipt."`
 
 	// BufferSize is the size of the underlying channel buffer.
 	// Defaults to DefaultChanBufferSize.
-	BufferSize int
+	BufferSize int `doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
 
 	// MsgDelaySeconds enables extraction of DelaySeconds from
 	// published message's payload.
-	MsgDelaySeconds bool
+	MsgDelaySeconds bool `doc:"Get DelaySeconds from a published message's payload."`
 
 	// WaitTimeSeconds is the SQS receive wait time.
 	//
 	// Defaults to one second.
-	WaitTimeSeconds int64
+	WaitTimeSeconds int64 `doc:"Receive wait time in seconds." default:"1"`
 }
 
 // SQSOpts is an SQS consumer/producer.
@@ -88,6 +93,7 @@ type SQSOpts struct {
 // ignored.
 type SQSChan struct {
 	c   chan dsl.Msg
+	buf *dsl.Buffer
 	ctl chan bool
 	svc *sqs.SQS
 
@@ -111,8 +117,14 @@ func NewSQSChan(ctx *dsl.Ctx, o interface{}) (dsl.Chan, error) {
 		return nil, dsl.NewBroken(err)
 	}
 
+	buf, err := dsl.NewBuffer("SQS", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
 	return &SQSChan{
-		c:    make(chan dsl.Msg, opts.BufferSize),
+		c:    buf.C,
+		buf:  buf,
 		ctl:  make(chan bool),
 		opts: &opts,
 	}, nil
@@ -199,13 +211,18 @@ func (c *SQSChan) Kill(ctx *dsl.Ctx) error {
 
 func (c *SQSChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
 	ctx.Logf("SQSChan To %s", m.Topic)
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
 	}
 	return nil
 }
 
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *SQSChan) Overflow() error {
+	return c.buf.Overflow()
+}
+
 func (c *SQSChan) Consume(ctx *dsl.Ctx) {
 	ctx.Logf("Consuming SQS %s", c.opts.QueueURL)
 
@@ -0,0 +1,373 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "ssh", NewSSHChan)
+	dsl.TheChanDocs.Register("ssh", "An SSH session (via the ssh program) with a persistent shell and remote commands.", SSHOpts{})
+}
+
+// SSHPasswordEnv is the environment variable that gives the password
+// to the SSH_ASKPASS program that an SSH channel uses for password
+// authentication.
+const SSHPasswordEnv = "PLAX_SSH_PASSWORD"
+
+// SSHOpts configures an SSH channel.
+type SSHOpts struct {
+	// Host is the remote host.
+	Host string `json:",omitempty" yaml:",omitempty" doc:"The remote host."`
+
+	// Port is the remote port.
+	Port int `json:",omitempty" yaml:",omitempty" doc:"The remote port." default:"22"`
+
+	// User is the remote user.
+	User string `json:",omitempty" yaml:",omitempty" doc:"The remote user."`
+
+	// KeyFile is the filename of a private key for authentication.
+	KeyFile string `json:",omitempty" yaml:",omitempty" doc:"Filename of a private key."`
+
+	// Password is a password for authentication.
+	Password string `json:",omitempty" yaml:",omitempty" doc:"Password (via SSH_ASKPASS)."`
+
+	// KnownHostsFile is the filename of the known hosts, which
+	// defaults to the ssh program's default.
+	KnownHostsFile string `json:",omitempty" yaml:",omitempty" doc:"Filename of the known hosts."`
+
+	// StrictHostKeyChecking is the ssh program's
+	// StrictHostKeyChecking option: "yes", "no", or "accept-new".
+	StrictHostKeyChecking string `json:",omitempty" yaml:",omitempty" doc:"StrictHostKeyChecking: yes, no, or accept-new." default:"accept-new"`
+
+	// Options are additional ssh options (like
+	// "ServerAliveInterval=10").
+	Options []string `json:",omitempty" yaml:",omitempty" doc:"Additional ssh options (NAME=VALUE)."`
+
+	// NoShell, when true, doesn't start a remote shell, so the
+	// channel only runs remote commands.
+	NoShell bool `json:",omitempty" yaml:",omitempty" doc:"Don't start a persistent remote shell."`
+
+	// ConnectTimeout is the timeout in seconds for connecting.
+	ConnectTimeout int `json:",omitempty" yaml:",omitempty" doc:"Seconds to wait to connect." default:"10"`
+
+	// ExecTimeout is the timeout in milliseconds for a remote
+	// command.
+	ExecTimeout int64 `json:",omitempty" yaml:",omitempty" doc:"Milliseconds to wait for a remote command." default:"60000"`
+
+	// Program is the ssh program.
+	Program string `json:",omitempty" yaml:",omitempty" doc:"The ssh program." default:"ssh"`
+
+	// BufferSize is the capacity of the channel's dsl.Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the overflow policy of the channel's
+	// dsl.Buffer.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// SSH is a channel for an SSH session, which the ssh program (see
+// SSHOpts.Program) implements.
+//
+// Open establishes a connection that runs a remote shell (unless
+// NoShell).  The shell's stdout and stderr lines arrive as messages
+// with topics "stdout" and "stderr", and a message with topic "exit"
+// reports the session's end.
+//
+// A message published with topic "exec" runs its payload as a remote
+// command (over the same connection), and a message with topic
+// "exec" reports the command's result as an ExecResult.  A message with
+// topic "eof" closes the shell's stdin.  Other messages are written
+// to the shell's stdin.
+type SSH struct {
+	opts *SSHOpts
+	c    chan dsl.Msg
+	buf  *dsl.Buffer
+
+	// dir has the control socket and SSH_ASKPASS program.
+	dir  string
+	args []string
+	env  map[string]string
+
+	p *dsl.Process
+
+	mu    sync.Mutex
+	eofed bool
+}
+
+func NewSSHChan(ctx *dsl.Ctx, cfg interface{}) (dsl.Chan, error) {
+	opts := SSHOpts{
+		Port:                  22,
+		StrictHostKeyChecking: "accept-new",
+		ConnectTimeout:        10,
+		ExecTimeout:           60000,
+		Program:               "ssh",
+	}
+	if err := dsl.As(cfg, &opts); err != nil {
+		return nil, dsl.NewBroken(err)
+	}
+	if opts.Host == "" {
+		return nil, dsl.Brokenf("NewSSHChan: no Host")
+	}
+	switch opts.StrictHostKeyChecking {
+	case "yes", "no", "accept-new":
+	default:
+		return nil, dsl.Brokenf("NewSSHChan: StrictHostKeyChecking '%s' isn't yes, no, or accept-new", opts.StrictHostKeyChecking)
+	}
+	for _, o := range opts.Options {
+		if !strings.Contains(o, "=") {
+			return nil, dsl.Brokenf("NewSSHChan: option '%s' isn't NAME=VALUE", o)
+		}
+	}
+
+	buf, err := dsl.NewBuffer("ssh", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSH{
+		opts: &opts,
+		c:    buf.C,
+		buf:  buf,
+	}, nil
+}
+
+func (c *SSH) Kind() dsl.ChanKind {
+	return "ssh"
+}
+
+// dest returns the ssh destination.
+func (c *SSH) dest() string {
+	if c.opts.User == "" {
+		return c.opts.Host
+	}
+	return c.opts.User + "@" + c.opts.Host
+}
+
+// setup makes the control directory and the common arguments and
+// environment.
+func (c *SSH) setup() error {
+	dir, err := ioutil.TempDir("", "plax-ssh")
+	if err != nil {
+		return err
+	}
+	c.dir = dir
+
+	o := c.opts
+	args := []string{
+		"-p", strconv.Itoa(o.Port),
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(dir, "control"),
+		"-o", "StrictHostKeyChecking=" + o.StrictHostKeyChecking,
+		"-o", "ConnectTimeout=" + strconv.Itoa(o.ConnectTimeout),
+	}
+	if o.KeyFile != "" {
+		args = append(args, "-i", o.KeyFile)
+	}
+	if o.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+o.KnownHostsFile)
+	}
+	for _, opt := range o.Options {
+		args = append(args, "-o", opt)
+	}
+
+	if o.Password == "" {
+		args = append(args, "-o", "BatchMode=yes")
+	} else {
+		askpass := filepath.Join(dir, "askpass")
+		script := "#!/bin/sh\nprintf '%s\\n' \"$" + SSHPasswordEnv + "\"\n"
+		if err = ioutil.WriteFile(askpass, []byte(script), 0700); err != nil {
+			return err
+		}
+		c.env = map[string]string{
+			SSHPasswordEnv:        o.Password,
+			"SSH_ASKPASS":         askpass,
+			"SSH_ASKPASS_REQUIRE": "force",
+			"DISPLAY":             "plax",
+		}
+	}
+	c.args = args
+	return nil
+}
+
+// Open starts the ssh program, which connects (and starts the shell
+// unless NoShell).
+func (c *SSH) Open(ctx *dsl.Ctx) error {
+	if err := c.setup(); err != nil {
+		return dsl.NewBroken(err)
+	}
+
+	args := append([]string{}, c.args...)
+	args = append(args, "-T")
+	if c.opts.NoShell {
+		args = append(args, "-N")
+	}
+	args = append(args, "--", c.dest())
+
+	c.p = &dsl.Process{
+		Name:    "ssh " + c.dest(),
+		Command: c.opts.Program,
+		Args:    args,
+		Env:     c.env,
+	}
+	if err := c.p.Start(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line := <-c.p.Stdout:
+				c.To(ctx, dsl.Msg{Topic: "stdout", Payload: line})
+			case line := <-c.p.Stderr:
+				c.To(ctx, dsl.Msg{Topic: "stderr", Payload: line})
+			case x := <-c.p.Exited:
+				c.To(ctx, dsl.Msg{Topic: "exit", Payload: dsl.Canon(x)})
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close closes the shell's stdin, stops the ssh program, and removes
+// the control directory.
+func (c *SSH) Close(ctx *dsl.Ctx) error {
+	ctx.Logf("SSH %s Close", c.dest())
+	if c.p != nil {
+		c.eof()
+		// The shell might have already exited.
+		c.p.Stop(ctx)
+	}
+	if c.dir != "" {
+		os.RemoveAll(c.dir)
+	}
+	return nil
+}
+
+// eof closes the shell's stdin (if it's not already closed).
+func (c *SSH) eof() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.eofed {
+		c.eofed = true
+		close(c.p.Stdin)
+	}
+}
+
+func (c *SSH) Sub(ctx *dsl.Ctx, topic string) error {
+	return fmt.Errorf("%T doesn't support 'sub'", c)
+}
+
+// Pub runs a remote command (topic "exec"), closes the shell's stdin
+// (topic "eof"), or writes to the shell's stdin.  See SSH.
+func (c *SSH) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("SSH %s Pub %s", c.dest(), m.Topic)
+
+	line, is := m.Payload.(string)
+	if !is {
+		line = dsl.JSON(m.Payload)
+	}
+
+	switch m.Topic {
+	case "exec":
+		go c.exec(ctx, line)
+		return nil
+	case "eof":
+		c.eof()
+		return nil
+	}
+
+	if c.opts.NoShell {
+		return fmt.Errorf("SSH %s has no shell", c.dest())
+	}
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.eofed {
+		return fmt.Errorf("SSH %s: stdin is closed", c.dest())
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case c.p.Stdin <- line:
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("SSH %s: timeout writing to stdin", c.dest())
+	}
+	return nil
+}
+
+// exec runs the remote command and delivers its ExecResult.
+func (c *SSH) exec(ctx *dsl.Ctx, command string) {
+	args := append([]string{}, c.args...)
+	args = append(args, "-T", "--", c.dest(), command)
+
+	ctx.Logf("SSH %s exec %s", c.dest(), command)
+	x := runCommand(ctx, command, c.opts.Program, args, c.env, nil,
+		time.Duration(c.opts.ExecTimeout)*time.Millisecond)
+
+	c.To(ctx, dsl.Msg{
+		Topic:   "exec",
+		Payload: dsl.Canon(x),
+	})
+}
+
+func (c *SSH) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+// Kill kills the ssh program, which abruptly ends the session.
+func (c *SSH) Kill(ctx *dsl.Ctx) error {
+	if c.p == nil {
+		return fmt.Errorf("SSH %s isn't open", c.dest())
+	}
+	return c.p.Stop(ctx)
+}
+
+func (c *SSH) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	ctx.Logf("SSH %s To %s", c.dest(), m.Topic)
+	m.ReceivedAt = time.Now().UTC()
+	if err := c.buf.Put(ctx, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Overflow reports an overflow of the channel's dsl.Buffer.  See
+// dsl.Overflower.
+func (c *SSH) Overflow() error {
+	return c.buf.Overflow()
+}
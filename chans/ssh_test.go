@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package chans
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// fakeSSH is a shell script that imitates the ssh program by running
+// the remote command (or a shell) locally.
+const fakeSSH = `#!/bin/sh
+while [ "$#" -gt 0 ] && [ "$1" != "--" ]; do shift; done
+shift; shift
+if [ "$#" -gt 0 ]; then exec sh -c "$*"; fi
+exec sh
+`
+
+func TestSSH(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh")
+	}
+
+	dir, err := ioutil.TempDir("", "plax-ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	program := filepath.Join(dir, "ssh")
+	if err = ioutil.WriteFile(program, []byte(fakeSSH), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsl.NewCtx(context.Background())
+
+	recv := func(c dsl.Chan, topic string) interface{} {
+		for {
+			select {
+			case m := <-c.Recv(ctx):
+				if m.Topic == topic {
+					return m.Payload
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout")
+			}
+		}
+	}
+
+	c, err := NewSSHChan(ctx, SSHOpts{
+		Host:     "device",
+		User:     "homer",
+		Password: "donuts",
+		Program:  program,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if err = c.Pub(ctx, dsl.Msg{Payload: "echo hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if x := recv(c, "stdout"); x != "hello" {
+		t.Fatal(x)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{
+		Topic:   "exec",
+		Payload: `echo "$PLAX_SSH_PASSWORD"; echo oops >&2; exit 3`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	x := recv(c, "exec").(map[string]interface{})
+	if x["stdout"] != "donuts" || x["stderr"] != "oops" || x["code"] != 3.0 || x["error"] != nil {
+		t.Fatal(x)
+	}
+
+	if err = c.Pub(ctx, dsl.Msg{Topic: "eof"}); err != nil {
+		t.Fatal(err)
+	}
+	if x := recv(c, "exit").(map[string]interface{}); x["code"] != 0.0 {
+		t.Fatal(x)
+	}
+}
+
+func TestSSHOpts(t *testing.T) {
+	ctx := dsl.NewCtx(context.Background())
+	for _, opts := range []SSHOpts{
+		{},
+		{Host: "device", StrictHostKeyChecking: "maybe"},
+		{Host: "device", Options: []string{"Compression"}},
+	} {
+		if _, err := NewSSHChan(ctx, opts); err == nil {
+			t.Fatal(opts)
+		}
+	}
+}
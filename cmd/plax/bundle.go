@@ -0,0 +1,192 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+)
+
+// bundleMain implements 'plax bundle [FLAGS] DIR', which packs a
+// suite into a bundle (or an executable with an embedded bundle)
+// that 'plax run-bundle' runs.  The result is the exit code.
+func bundleMain(args []string) int {
+	var (
+		fs          = flag.NewFlagSet("bundle", flag.ExitOnError)
+		includeDirs = IncludeDirs{}
+		output      = fs.String("o", "suite.plax", "Output filename")
+		test        = fs.String("test", "", "Spec (relative to DIR) to run instead of every spec in DIR")
+		embed       = fs.Bool("embed", false, "Write a plax executable with the bundle embedded")
+	)
+	fs.Var(&includeDirs, "I", "YAML include directory to add to the bundle")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: plax bundle [FLAGS] DIR\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	b := &invoke.Bundle{
+		Dir:         fs.Arg(0),
+		Test:        *test,
+		IncludeDirs: includeDirs,
+		Version:     Version,
+	}
+
+	var buf bytes.Buffer
+	m, err := b.Write(&buf)
+	if err != nil {
+		log.Printf("bundle: %s", err)
+		return 1
+	}
+
+	mode := os.FileMode(0644)
+	if *embed {
+		mode = 0755
+	}
+	f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		log.Printf("bundle: %s", err)
+		return 1
+	}
+	defer f.Close()
+
+	if *embed {
+		exe, err := os.Executable()
+		if err == nil {
+			err = invoke.EmbedBundle(f, exe, buf.Bytes())
+		}
+		if err != nil {
+			log.Printf("bundle: %s", err)
+			return 1
+		}
+	} else if _, err = f.Write(buf.Bytes()); err != nil {
+		log.Printf("bundle: %s", err)
+		return 1
+	}
+
+	log.Printf("Wrote %s with %d files", *output, m.Files)
+	return 0
+}
+
+// runBundleMain implements 'plax run-bundle [FLAGS] [BUNDLE]', which
+// runs a bundle made by 'plax bundle'.  Without a BUNDLE, the bundle
+// embedded in this executable (if any) runs.  The result is the
+// exit code.
+func runBundleMain(args []string) int {
+	var (
+		fs                = flag.NewFlagSet("run-bundle", flag.ExitOnError)
+		bindings          = make(dsl.Bindings)
+		labels            = fs.String("labels", "", "Optional list of required test labels ('!LABEL' excludes LABEL)")
+		priority          = fs.Int("priority", -1, "Optional lowest priority (where larger numbers mean lower priority!); negative means all")
+		testSuiteName     = fs.String("test-suite", "NA", "Name for JUnit test suite")
+		emitJSON          = fs.Bool("json", false, "Emit docs suitable for indexing")
+		nonzeroOnAnyError = fs.Bool("error-exit-code", false, "Return non-zero on any test failure")
+		logLevel          = fs.String("log", "info", "log level (info, debug, none)")
+		keep              = fs.Bool("keep", false, "Don't remove the extracted bundle (and print its directory)")
+	)
+	fs.Var(&bindings, "p", "Parameter values: PARAM=VALUE")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: plax run-bundle [FLAGS] [BUNDLE]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var (
+		r   io.Reader
+		err error
+	)
+	switch fs.NArg() {
+	case 0:
+		exe, err := os.Executable()
+		if err == nil {
+			r, err = invoke.EmbeddedBundle(exe)
+		}
+		if err == nil && r == nil {
+			err = fmt.Errorf("no BUNDLE given and none embedded")
+		}
+	case 1:
+		var f *os.File
+		if f, err = os.Open(fs.Arg(0)); err == nil {
+			defer f.Close()
+			r = f
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		log.Printf("run-bundle: %s", err)
+		return 1
+	}
+
+	dir, err := ioutil.TempDir("", "plax-bundle")
+	if err != nil {
+		log.Printf("run-bundle: %s", err)
+		return 1
+	}
+	if *keep {
+		log.Printf("Extracting bundle in %s", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	m, err := invoke.ExtractBundle(r, dir)
+	if err != nil {
+		log.Printf("run-bundle: %s", err)
+		return 1
+	}
+	log.Printf("Running bundle made by plax %s at %s", m.Plax, m.Created.Format("2006-01-02T15:04:05Z"))
+
+	iv := m.Invocation(dir, invoke.Invocation{
+		SuiteName:         *testSuiteName,
+		Bindings:          bindings,
+		IncludeDirs:       []string{filepath.Join(dir, invoke.BundleSuiteDir)},
+		Priority:          *priority,
+		Labels:            *labels,
+		LogLevel:          *logLevel,
+		EmitJSON:          *emitJSON,
+		NonzeroOnAnyError: *nonzeroOnAnyError,
+	})
+
+	err = iv.Exec(context.Background())
+	if ps, is := err.(*invoke.Problems); is {
+		log.Printf("Tests had %s", ps)
+		return ps.ExitCode()
+	}
+	if err != nil {
+		log.Printf("Invocation broken: %s", err)
+		return 1
+	}
+	return 0
+}
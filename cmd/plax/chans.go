@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// chansMain implements 'plax chans [FLAGS] [KIND...]', which
+// documents the registered channel types and their options.  The
+// result is the exit code.
+func chansMain(args []string) int {
+	var (
+		fs       = flag.NewFlagSet("chans", flag.ExitOnError)
+		asJSON   = fs.Bool("json", false, "Write JSON")
+		markdown = fs.Bool("markdown", false, "Write Markdown")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: plax chans [FLAGS] [KIND...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	kinds := make([]dsl.ChanKind, 0, len(dsl.TheChanRegistry))
+	if fs.NArg() == 0 {
+		for kind := range dsl.TheChanRegistry {
+			kinds = append(kinds, kind)
+		}
+		sort.Slice(kinds, func(i, j int) bool {
+			return kinds[i] < kinds[j]
+		})
+	} else {
+		for _, s := range fs.Args() {
+			kind := dsl.ChanKind(s)
+			if _, have := dsl.TheChanRegistry[kind]; !have {
+				fmt.Fprintf(os.Stderr, "unknown channel type '%s'\n", kind)
+				return 1
+			}
+			kinds = append(kinds, kind)
+		}
+	}
+
+	specs := make([]*dsl.DocSpec, 0, len(kinds))
+	for _, kind := range kinds {
+		d, have := dsl.TheChanDocs[kind]
+		if !have {
+			d = &dsl.DocSpec{
+				Kind: kind,
+				Doc:  "(no documentation)",
+			}
+		}
+		specs = append(specs, d)
+	}
+
+	switch {
+	case *asJSON:
+		js, err := json.MarshalIndent(specs, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		fmt.Printf("%s\n", js)
+	case *markdown:
+		fmt.Printf("# Channel types\n\n")
+		fmt.Printf("This document is generated by `plax chans -markdown`.\n\n")
+		for _, d := range specs {
+			d.WriteMarkdown(os.Stdout)
+		}
+	default:
+		for i, d := range specs {
+			if 0 < i {
+				fmt.Println()
+			}
+			d.WriteText(os.Stdout)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Comcast/plax/conformance"
+)
+
+// conformanceMain implements 'plax conformance mqtt [FLAGS]', which
+// writes a conformance pack (a directory of tests) for an MQTT
+// broker.  The result is the exit code.
+func conformanceMain(args []string) int {
+	if len(args) == 0 || args[0] != "mqtt" {
+		fmt.Fprintf(os.Stderr, "usage: plax conformance mqtt [FLAGS]\n")
+		return 2
+	}
+
+	var (
+		fs     = flag.NewFlagSet("conformance mqtt", flag.ExitOnError)
+		broker = fs.String("broker", "tcp://localhost:1883", "MQTT broker URL")
+		dir    = fs.String("o", "mqtt-conformance", "Output directory")
+		prefix = fs.String("prefix", conformance.DefaultMQTTTopicPrefix, "Prefix for topics")
+		client = fs.String("client", conformance.DefaultMQTTClientPrefix, "Prefix for MQTT client ids")
+		limit  = fs.String("timeout", conformance.DefaultMQTTTimeout, "Timeout for each recv")
+		will   = fs.String("will-command", conformance.DefaultMQTTWillCommand, "Command-line MQTT client (like mosquitto_sub) for the will test")
+	)
+	fs.Parse(args[1:])
+
+	p := &conformance.MQTTPack{
+		BrokerURL:    *broker,
+		TopicPrefix:  *prefix,
+		ClientPrefix: *client,
+		Timeout:      *limit,
+		WillCommand:  *will,
+	}
+
+	filenames, err := p.Write(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, filename := range filenames {
+		fmt.Println(filename)
+	}
+
+	return 0
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+)
+
+// expandMain implements 'plax expand [FLAGS] FILENAME...', which
+// prints each test's spec after complete substitution (including
+// '@@' files and '!!' Javascript) with the given parameters.  The
+// result is the exit code.
+func expandMain(args []string) int {
+	var (
+		fs          = flag.NewFlagSet("expand", flag.ExitOnError)
+		bindings    = make(dsl.Bindings)
+		includeDirs = IncludeDirs{"."}
+		registries  = IncludeDirs{}
+		redact      = fs.Bool("redact", true, "Redact the values of secret bindings")
+		logLevel    = fs.String("log", "none", "log level (info, debug, none)")
+	)
+	fs.Var(&bindings, "p", "Parameter values: PARAM=VALUE")
+	fs.Var(&includeDirs, "I", "YAML include directories")
+	fs.Var(&registries, "registry", "Package registry (directory or URL)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: plax expand [FLAGS] FILENAME...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, filename := range fs.Args() {
+		iv := invoke.Invocation{
+			Bindings:    bindings,
+			Filename:    filename,
+			IncludeDirs: includeDirs,
+			Registries:  registries,
+			LogLevel:    *logLevel,
+			Expand:      true,
+			Redact:      *redact,
+		}
+		if err := iv.Exec(dsl.NewCtx(nil)); err != nil {
+			if ps, is := err.(*invoke.Problems); is {
+				code = ps.ExitCode()
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			code = 1
+		}
+	}
+
+	return code
+}
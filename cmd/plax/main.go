@@ -20,13 +20,19 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	_ "github.com/Comcast/plax/chans"
 	"github.com/Comcast/plax/dsl"
 	"github.com/Comcast/plax/invoke"
+	"github.com/Comcast/plax/lsp"
+	_ "github.com/Comcast/plax/secrets"
 )
 
 // Version of plax
@@ -41,16 +47,67 @@ func main() {
 
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
+	// Channel plugins (from PLAX_PLUGINS) are available to every
+	// subcommand.
+	if _, err := dsl.LoadPluginsFromEnv(dsl.NewCtx(nil)); err != nil {
+		log.Fatal(err)
+	}
+
+	// Subcommands
+	if 1 < len(os.Args) {
+		switch os.Args[1] {
+		case "schema":
+			// plax schema [test|run]
+			name := "test"
+			if 2 < len(os.Args) {
+				name = os.Args[2]
+			}
+			js, err := Schema(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s\n", js)
+			return
+		case "conformance":
+			// plax conformance mqtt [FLAGS]
+			os.Exit(conformanceMain(os.Args[2:]))
+		case "expand":
+			// plax expand [FLAGS] FILENAME...
+			os.Exit(expandMain(os.Args[2:]))
+		case "bundle":
+			// plax bundle [FLAGS] DIR
+			os.Exit(bundleMain(os.Args[2:]))
+		case "run-bundle":
+			// plax run-bundle [FLAGS] [BUNDLE]
+			os.Exit(runBundleMain(os.Args[2:]))
+		case "chans":
+			// plax chans [FLAGS] [KIND...]
+			os.Exit(chansMain(os.Args[2:]))
+		case "lsp":
+			// plax lsp: A language server over stdio.
+			s := lsp.NewServer(os.Stdin, os.Stdout)
+			s.Logf = log.Printf
+			if err := s.Serve(); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	var (
 		// params are command-line provide test parameters.
 		//
 		// We make then their own type to enable flag.Var to parse multiple values.
 		bindings          = make(dsl.Bindings)
 		includeDirs       = IncludeDirs{"."}
+		registries        = IncludeDirs{}
+		profiles          = IncludeDirs{}
 		specFilename      = flag.String("test", "test.yaml", "Filename for test specification")
 		dir               = flag.String("dir", "", "Directory containing test specs")
 		list              = flag.Bool("list", false, "Show report of known tests; don't run anything.  Assumes -dir.")
-		labels            = flag.String("labels", "", "Optional list of required test labels")
+		lint              = flag.Bool("lint", false, "Check tests for problems (like misspelled properties and unknown phases and channels); don't run anything")
+		dryRun            = flag.Bool("dry-run", false, "Check tests (as with -lint) and print their specs with parameters substituted; don't run anything")
+		labels            = flag.String("labels", "", "Optional list of required test labels ('!LABEL' excludes LABEL)")
 		priority          = flag.Int("priority", -1, "Optional lowest priority (where larger numbers mean lower priority!); negative means all")
 		verbose           = flag.Bool("v", true, "Verbosity")
 		version           = flag.Bool("version", false, "Print version and then exit")
@@ -59,20 +116,50 @@ func main() {
 		emitJSON          = flag.Bool("json", false, "Emit docs suitable for indexing")
 		testSuiteName     = flag.String("test-suite", "NA", "Name for JUnit test suite")
 		logLevel          = flag.String("log", "info", "log level (info, debug, none)")
+		logFormat         = flag.String("log-format", "text", "Log format (text, json)")
+		logDir            = flag.String("log-dir", "", "Write each test's log to its own file (with an index.jsonl) in this directory")
+		logSink           = flag.String("log-sink", "stderr", "Log destination (stderr, stdout, syslog, syslog:TAG, or a filename)")
 		retry             = flag.String("retry", "", `Specify retries: number or {"N":N,"Delay":"1s","DelayFactor":1.5}`)
+		instances         = flag.Int("instances", 0, "Number of concurrent copies of each test to run (overrides a test's Instances)")
+		record            = flag.String("record", "", "Append all channel messages to this file (for a later 'replay' channel)")
+		trace             = flag.String("trace", "", "Write a JSON Lines trace of every step execution to this file")
+		htmlReport        = flag.String("html", "", "Also write an HTML report (with step traces and timings) to this file")
+		debug             = flag.Bool("debug", false, "Pause before each step for interactive debugging (commands from stdin)")
+		soak              = flag.Bool("soak", false, "Run tests repeatedly (see -soak-for) and write periodic JSON reports (see -soak-report)")
+		soakFor           = flag.Duration("soak-for", 0, "Duration of a soak (zero means until interrupted)")
+		soakReport        = flag.Duration("soak-report", invoke.DefaultSoakInterval, "Time between a soak's interim reports")
+		events            = flag.String("events", "", "Send CloudEvents for test lifecycle events to this sink (http(s)://..., kafka://PROXY/TOPIC, or file:FILENAME)")
+		eventSource       = flag.String("event-source", invoke.DefaultEventSource, "CloudEvents source for -events")
+		plugins           = flag.String("plugins", "", "Load channel plugins from this directory")
+		failOnLeaks       = flag.Bool("fail-on-leaks", false, "Fail tests that leak channels or goroutines")
 	)
 
 	flag.Var(&bindings, "p", "Parameter values: PARAM=VALUE")
 	flag.Var(&includeDirs, "I", "YAML include directories")
+	flag.Var(&registries, "registry", "Package registry (directory or URL)")
+	flag.Var(&profiles, "profiles", "File of channel profiles")
 
 	flag.Parse()
 
-	log.Printf("plax version %s", Version)
+	if err := dsl.ConfigureLogging(*logFormat, *logSink); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("plax version %s (test format versions %d through %d)",
+		Version, dsl.DefaultVersion, dsl.CurrentVersion)
 
 	if *version {
 		return
 	}
 
+	if *plugins != "" {
+		kinds, err := dsl.LoadPlugins(dsl.NewCtx(nil), *plugins)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Plugins registered channel types %v", kinds)
+	}
+
 	iv := invoke.Invocation{
 		SuiteName:         *testSuiteName,
 		Bindings:          bindings,
@@ -85,12 +172,67 @@ func main() {
 		Labels:            *labels,
 		LogLevel:          *logLevel,
 		List:              *list,
+		Lint:              *lint,
+		DryRun:            *dryRun,
+		Registries:        registries,
+		Profiles:          profiles,
+		LogDir:            *logDir,
+		LogFormat:         *logFormat,
 		EmitJSON:          *emitJSON,
 		NonzeroOnAnyError: *nonzeroOnAnyError,
 		Retry:             *retry,
+		Instances:         *instances,
+		Record:            *record,
+		Trace:             *trace,
+		Debug:             *debug,
+		FailOnLeaks:       *failOnLeaks,
+	}
+
+	if *events != "" {
+		sink, err := invoke.OpenEventSink(*events)
+		if err != nil {
+			log.Fatal(err)
+		}
+		iv.Events = invoke.NewEmitter(sink, *eventSource)
+		defer iv.Events.Close()
+	}
+
+	if *htmlReport != "" {
+		iv.HTML = invoke.NewHTMLReport(*testSuiteName)
 	}
 
-	err := iv.Exec(context.Background())
+	ctx := context.Background()
+
+	if *soak {
+		iv.Soak = &invoke.Soak{
+			Duration: *soakFor,
+			Interval: *soakReport,
+		}
+
+		// An interrupt ends the soak (with a final report).
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			log.Printf("Ending soak")
+			cancel()
+		}()
+	}
+
+	err := iv.Exec(ctx)
+	dsl.ClosePlugins(dsl.NewCtx(nil))
+	if iv.HTML != nil {
+		if err := iv.HTML.WriteFile(*htmlReport); err != nil {
+			log.Printf("HTML report not written: %s", err)
+		}
+	}
+	if ps, is := err.(*invoke.Problems); is {
+		log.Printf("Tests had %s", ps)
+		os.Exit(ps.ExitCode())
+	}
 	if err != nil {
 		log.Fatalf("Invocation broken: %s", err)
 	}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Comcast/plax/dsl"
+
+	plaxrun "github.com/Comcast/plax/cmd/plaxrun/dsl"
+)
+
+// Schemas maps names to generators of JSON Schemas.
+var Schemas = map[string]func() map[string]interface{}{
+	"test": func() map[string]interface{} {
+		return dsl.JSONSchema(dsl.Test{}, "Plax test")
+	},
+	"run": func() map[string]interface{} {
+		return dsl.JSONSchema(plaxrun.TestRun{}, "Plaxrun run specification")
+	},
+}
+
+// Schema returns the (indented) JSON Schema with the given name.
+func Schema(name string) ([]byte, error) {
+	gen, have := Schemas[name]
+	if !have {
+		return nil, fmt.Errorf("unknown schema '%s' (want 'test' or 'run')", name)
+	}
+	return json.MarshalIndent(gen(), "", "  ")
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestSchemas checks that the published schemas are up to date.
+//
+// To update them:
+//
+//	go run . schema test > ../../doc/schema/plax-test.schema.json
+//	go run . schema run > ../../doc/schema/plaxrun.schema.json
+func TestSchemas(t *testing.T) {
+	for name, filename := range map[string]string{
+		"test": "../../doc/schema/plax-test.schema.json",
+		"run":  "../../doc/schema/plaxrun.schema.json",
+	} {
+		t.Run(name, func(t *testing.T) {
+			js, err := Schema(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			published, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(published), js) {
+				t.Fatalf("%s is out of date", filename)
+			}
+		})
+	}
+
+	if _, err := Schema("tacos"); err == nil || !strings.Contains(err.Error(), "tacos") {
+		t.Fatal(err)
+	}
+}
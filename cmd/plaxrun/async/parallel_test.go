@@ -54,16 +54,16 @@ func badFunc() (string, string, error) {
 }
 
 var (
-	testFuncs = []TaskFunc{
+	testFuncs = []*TaskFunc{
 		{
-			Name: "sleepAndSay", 
-			Func: func() string { 
+			Name: "sleepAndSay",
+			Func: func() string {
 				return sleepAndSay("I like tacos!")
-			}
+			},
 		},
 		{
-			Name: "sleepAndError", 
-			Func: func() error { 
+			Name: "sleepAndError",
+			Func: func() error {
 				return sleepAndError(fmt.Errorf("tacos are bad"))
 			},
 		},
@@ -75,17 +75,16 @@ var (
 		},
 		{
 			Name: "sleepAndSayWithProvidedError",
-			Func: func() (string, error) { 
+			Func: func() (string, error) {
 				return sleepAndSayWithError("I like tacos!", nil)
 			},
 		},
 		{
 			Name: "sleep",
-			Func: func() { 
+			Func: func() {
 				sleep()
-			}
+			},
 		},
-	},
 	}
 )
 
@@ -109,7 +108,10 @@ func TestParallel(t *testing.T) {
 }
 
 func TestParallelWithBadFunc(t *testing.T) {
-	testFuncs := append(testFuncs, badFunc)
+	testFuncs := append(testFuncs, &TaskFunc{
+		Name: "badFunc",
+		Func: badFunc,
+	})
 
 	// Output will be array of results or an error
 	_, err := Parallel(context.Background(), testFuncs...)
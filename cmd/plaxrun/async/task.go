@@ -26,7 +26,7 @@ import (
 
 // TaskFunc is a function that returns nothing (empty), an error, or a result and error
 type TaskFunc struct {
-	Func func() error
+	Func interface{}
 	Name string
 }
 
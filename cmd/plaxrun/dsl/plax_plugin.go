@@ -24,6 +24,8 @@ import (
 	"strings"
 
 	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+	"github.com/Comcast/plax/metrics"
 )
 
 const (
@@ -53,6 +55,36 @@ const (
 	PluginDefNonzeroOnAnyErrorKey = "NonzeroOnAnyErrorKey"
 	// PluginDefRetryKey of the PluginDef map
 	PluginDefRetryKey = "Retry"
+	// PluginDefInstancesKey of the PluginDef map
+	PluginDefInstancesKey = "Instances"
+	// PluginDefEmitParamsKey of the PluginDef map
+	PluginDefEmitParamsKey = "EmitParams"
+	// PluginDefEnvKey of the PluginDef map
+	PluginDefEnvKey = "Env"
+	// PluginDefLatencyKey of the PluginDef map
+	PluginDefLatencyKey = "Latency"
+	// PluginDefOwnersKey of the PluginDef map
+	PluginDefOwnersKey = "Owners"
+	// PluginDefMetricsKey of the PluginDef map
+	PluginDefMetricsKey = "Metrics"
+	// PluginDefProfilesKey of the PluginDef map
+	PluginDefProfilesKey = "Profiles"
+	// PluginDefExtraLabelsKey of the PluginDef map
+	PluginDefExtraLabelsKey = "ExtraLabels"
+	// PluginDefChanOverlaysKey of the PluginDef map
+	PluginDefChanOverlaysKey = "ChanOverlays"
+	// PluginDefLogDirKey of the PluginDef map
+	PluginDefLogDirKey = "LogDir"
+	// PluginDefLogFormatKey of the PluginDef map
+	PluginDefLogFormatKey = "LogFormat"
+	// PluginDefHTMLKey of the PluginDef map
+	PluginDefHTMLKey = "HTML"
+	// PluginDefKeepGoingKey of the PluginDef map
+	PluginDefKeepGoingKey = "KeepGoing"
+	// PluginDefFailOnLeaksKey of the PluginDef map
+	PluginDefFailOnLeaksKey = "FailOnLeaks"
+	// PluginDefEventsKey of the PluginDef map
+	PluginDefEventsKey = "Events"
 )
 
 var (
@@ -215,6 +247,231 @@ func (pd PluginDef) GetPluginDefRetry() (string, error) {
 	return strconv.Itoa(ret), nil
 }
 
+// GetPluginDefInstances returns the Instances
+func (pd PluginDef) GetPluginDefInstances() (int, error) {
+	value, ok := pd[PluginDefInstancesKey]
+	if !ok {
+		return 0, nil
+	}
+
+	ret, ok := value.(int)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a int", PluginDefInstancesKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefEmitParams returns the EmitParams flag
+func (pd PluginDef) GetPluginDefEmitParams() (bool, error) {
+	value, ok := pd[PluginDefEmitParamsKey]
+	if !ok {
+		return false, nil
+	}
+
+	ret, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s is not a bool", PluginDefEmitParamsKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefEnv returns the Env, which is optional
+func (pd PluginDef) GetPluginDefEnv() (map[string]string, error) {
+	value, ok := pd[PluginDefEnvKey]
+	if !ok {
+		return nil, nil
+	}
+
+	ret, ok := value.(map[string]string)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a map[string]string", PluginDefEnvKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefLatency returns the LatencyParams, which are optional
+func (pd PluginDef) GetPluginDefLatency() (*LatencyParams, error) {
+	value, ok := pd[PluginDefLatencyKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.(*LatencyParams)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a *LatencyParams", PluginDefLatencyKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefMetrics returns the metrics.Registry, which is optional
+func (pd PluginDef) GetPluginDefMetrics() (*metrics.Registry, error) {
+	value, ok := pd[PluginDefMetricsKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.(*metrics.Registry)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a *metrics.Registry", PluginDefMetricsKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefEvents returns the invoke.Emitter, which is optional
+func (pd PluginDef) GetPluginDefEvents() (*invoke.Emitter, error) {
+	value, ok := pd[PluginDefEventsKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.(*invoke.Emitter)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a *invoke.Emitter", PluginDefEventsKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefProfiles returns the Profiles, which are optional
+func (pd PluginDef) GetPluginDefProfiles() ([]string, error) {
+	value, ok := pd[PluginDefProfilesKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.([]string)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a []string", PluginDefProfilesKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefExtraLabels returns the ExtraLabels, which are optional
+func (pd PluginDef) GetPluginDefExtraLabels() ([]string, error) {
+	value, ok := pd[PluginDefExtraLabelsKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.([]string)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a []string", PluginDefExtraLabelsKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefHTML returns the HTML report, which is optional
+func (pd PluginDef) GetPluginDefHTML() (*invoke.HTMLReport, error) {
+	value, ok := pd[PluginDefHTMLKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.(*invoke.HTMLReport)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a *invoke.HTMLReport", PluginDefHTMLKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefKeepGoing returns the KeepGoing, which is optional
+func (pd PluginDef) GetPluginDefKeepGoing() (bool, error) {
+	value, ok := pd[PluginDefKeepGoingKey]
+	if !ok || value == nil {
+		return false, nil
+	}
+
+	ret, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s is not a bool", PluginDefKeepGoingKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefFailOnLeaks returns the FailOnLeaks, which is optional
+func (pd PluginDef) GetPluginDefFailOnLeaks() (bool, error) {
+	value, ok := pd[PluginDefFailOnLeaksKey]
+	if !ok || value == nil {
+		return false, nil
+	}
+
+	ret, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s is not a bool", PluginDefFailOnLeaksKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefChanOverlays returns the ChanOverlays, which are optional
+func (pd PluginDef) GetPluginDefChanOverlays() (map[dsl.ChanKind]interface{}, error) {
+	value, ok := pd[PluginDefChanOverlaysKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.(map[dsl.ChanKind]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a map[dsl.ChanKind]interface{}", PluginDefChanOverlaysKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefLogDir returns the LogDir, which is optional
+func (pd PluginDef) GetPluginDefLogDir() (string, error) {
+	value, ok := pd[PluginDefLogDirKey]
+	if !ok || value == nil {
+		return "", nil
+	}
+
+	ret, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", PluginDefLogDirKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefLogFormat returns the LogFormat, which is optional
+func (pd PluginDef) GetPluginDefLogFormat() (string, error) {
+	value, ok := pd[PluginDefLogFormatKey]
+	if !ok || value == nil {
+		return "", nil
+	}
+
+	ret, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", PluginDefLogFormatKey)
+	}
+
+	return ret, nil
+}
+
+// GetPluginDefOwners returns the Owners, which are optional
+func (pd PluginDef) GetPluginDefOwners() ([]string, error) {
+	value, ok := pd[PluginDefOwnersKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	ret, ok := value.([]string)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a []string", PluginDefOwnersKey)
+	}
+
+	return ret, nil
+}
+
 // GetPluginDefList returns the List flag
 func (pd PluginDef) GetPluginDefList() (bool, error) {
 	value, ok := pd[PluginDefListKey]
@@ -19,9 +19,10 @@ package dsl
 
 // TestConstraints used to constrain the tests run
 type TestConstraints struct {
-	Labels   []string     `yaml:"labels"`
-	Priority *int         `yaml:"priority,omitempty"`
-	Retry    int          `yaml:"retry"`
-	Seed     int64        `yaml:"seed"`
-	Iterate  *TestIterate `yaml:"iterate,omitempty"`
+	Labels    []string     `yaml:"labels"`
+	Priority  *int         `yaml:"priority,omitempty"`
+	Retry     int          `yaml:"retry"`
+	Instances int          `yaml:"instances,omitempty"`
+	Seed      int64        `yaml:"seed"`
+	Iterate   *TestIterate `yaml:"iterate,omitempty"`
 }
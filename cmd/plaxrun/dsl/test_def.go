@@ -20,7 +20,10 @@ package dsl
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/Comcast/plax/cmd/plaxrun/async"
 	plaxDsl "github.com/Comcast/plax/dsl"
@@ -31,6 +34,27 @@ type TestDef struct {
 	Path   string                  `yaml:"path"`
 	Module PluginModule            `yaml:"version"`
 	Params TestParamDependencyList `yaml:"params"`
+	// Owners are the owners of the tests that don't specify
+	// their own.
+	Owners []string `yaml:"owners,omitempty"`
+	// Labels are labels that the tests get in addition to their
+	// own.  See TestRunParams.Labels and TestGroup.Select.
+	Labels []string `yaml:"labels,omitempty"`
+}
+
+// excluded reports whether the test definition's own labels exclude
+// it according to the given labels (like "!slow").  See
+// plaxDsl.LabelsMatch.
+//
+// Since the tests can have more labels, other requirements are left
+// to plax.
+func (td TestDef) excluded(labels []string) bool {
+	for _, label := range labels {
+		if strings.HasPrefix(label, "!") && !plaxDsl.LabelsMatch(td.Labels, []string{label}) {
+			return true
+		}
+	}
+	return false
 }
 
 // TestDefMap is a map of TestDefs
@@ -54,12 +78,23 @@ func (tdrl TestDefRefList) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun, name strin
 
 		n := fmt.Sprintf("%s:%s", name, tdr.Name)
 
-		err := tdr.Params.bind(ctx, bs)
+		if td, ok := tr.Tests[tdr.Name]; ok && tr.trps != nil && td.excluded(tr.trps.Labels) {
+			ctx.Logf("labels excluded %s", n)
+			continue
+		}
+
+		// A test reference's params only apply to that test.
+		tbs, err := bs.Copy()
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy bindings for test %s: %w", n, err)
+		}
+
+		err = tdr.Params.bind(ctx, tr, tbs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to substitute test ref parameters: %w", err)
 		}
 
-		run, err := tdr.Guard.Satisfied(ctx, tr, bs)
+		run, err := tdr.Guard.Satisfied(ctx, tr, tbs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to guard %s test: %w", name, err)
 		}
@@ -69,17 +104,40 @@ func (tdrl TestDefRefList) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun, name strin
 			return tl, nil
 		}
 
-		tf, err := tdr.getTaskFunc(ctx, tr, n, bs)
+		tf, err := tdr.getTaskFunc(ctx, tr, n, tbs)
 		if err != nil {
 			return nil, err
 		}
 
+		// Keep the values of global params (which might have
+		// required a prompt) for the remaining tests.
+		for k, v := range *tbs {
+			if _, ok := (*bs)[k]; ok {
+				continue
+			}
+			if _, ok := tdr.Params[k]; ok {
+				continue
+			}
+			(*bs)[k] = v
+		}
+
 		tl = append(tl, tf)
 	}
 
 	return tl, nil
 }
 
+// labels returns the labels that the referenced tests need: The
+// reference's own labels and the run's labels.
+func (tdr TestDefRef) labels(tr TestRun) []string {
+	acc := make([]string, 0, len(tdr.Labels))
+	acc = append(acc, tdr.Labels...)
+	if tr.trps != nil {
+		acc = append(acc, tr.trps.Labels...)
+	}
+	return acc
+}
+
 func (tdr TestDefRef) getTaskFunc(ctx *plaxDsl.Ctx, tr TestRun, name string, bs *plaxDsl.Bindings) (*async.TaskFunc, error) {
 	td, ok := tr.Tests[tdr.Name]
 	if !ok {
@@ -88,11 +146,17 @@ func (tdr TestDefRef) getTaskFunc(ctx *plaxDsl.Ctx, tr TestRun, name string, bs
 
 	fmt.Fprintf(os.Stderr, "\nProcessing parameters for %s\n\n", name)
 
-	for _, tpd := range td.Params {
-		err := tpd.process(ctx, tr.Params, bs)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process test params: %w", err)
-		}
+	if err := td.Params.process(ctx, tr, bs); err != nil {
+		return nil, err
+	}
+
+	if tr.trps.ShowParams {
+		reportParams(ctx, name, bs)
+	}
+
+	env, err := tr.Env.resolve(ctx, bs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve env for %s: %w", name, err)
 	}
 
 	priority := -1
@@ -101,15 +165,54 @@ func (tdr TestDefRef) getTaskFunc(ctx *plaxDsl.Ctx, tr TestRun, name string, bs
 	}
 
 	def := PluginDef{
-		PluginDefNameKey:     name,
-		PluginDefParamsKey:   bs,
-		PluginDefSeedKey:     tdr.Seed,
-		PluginDefPriorityKey: priority,
-		PluginDefLabelsKey:   tdr.Labels,
-		PluginDefRetryKey:    strconv.Itoa(tdr.Retry),
-		PluginDefVerboseKey:  tr.trps.Verbose,
-		PluginDefLogLevelKey: tr.trps.LogLevel,
-		PluginDefEmitJSONKey: tr.trps.EmitJSON,
+		PluginDefNameKey:       name,
+		PluginDefParamsKey:     bs,
+		PluginDefSeedKey:       tdr.Seed,
+		PluginDefPriorityKey:   priority,
+		PluginDefLabelsKey:     tdr.labels(tr),
+		PluginDefRetryKey:      strconv.Itoa(tdr.Retry),
+		PluginDefInstancesKey:  tdr.Instances,
+		PluginDefVerboseKey:    tr.trps.Verbose,
+		PluginDefLogLevelKey:   tr.trps.LogLevel,
+		PluginDefEmitJSONKey:   tr.trps.EmitJSON,
+		PluginDefEmitParamsKey: tr.trps.ShowParams,
+		PluginDefEnvKey:        env,
+		PluginDefOwnersKey:     td.Owners,
+		PluginDefProfilesKey:   tr.trps.Profiles,
+		PluginDefLogDirKey:     tr.trps.LogDir,
+		PluginDefLogFormatKey:  tr.trps.LogFormat,
+	}
+
+	if tr.trps.Latency != nil {
+		def[PluginDefLatencyKey] = tr.trps.Latency
+	}
+
+	if tr.trps.Metrics != nil {
+		def[PluginDefMetricsKey] = tr.trps.Metrics
+	}
+
+	if tr.trps.ChanOverlays != nil {
+		def[PluginDefChanOverlaysKey] = tr.trps.ChanOverlays
+	}
+
+	if td.Labels != nil {
+		def[PluginDefExtraLabelsKey] = td.Labels
+	}
+
+	if tr.html != nil {
+		def[PluginDefHTMLKey] = tr.html
+	}
+
+	if tr.trps.KeepGoing {
+		def[PluginDefKeepGoingKey] = true
+	}
+
+	if tr.trps.FailOnLeaks {
+		def[PluginDefFailOnLeaksKey] = true
+	}
+
+	if tr.trps.Events != nil {
+		def[PluginDefEventsKey] = tr.trps.Events
 	}
 
 	path := td.Path
@@ -134,12 +237,41 @@ func (tdr TestDefRef) getTaskFunc(ctx *plaxDsl.Ctx, tr TestRun, name string, bs
 		return nil, err
 	}
 
-	return &async.TaskFunc{
+	tf := &async.TaskFunc{
 		Name: name,
 		Func: func() error {
 			return plugin.Invoke(ctx)
 		},
-	}, nil
+	}
+
+	if tr.paths != nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			tr.paths[tf] = abs
+		}
+	}
+
+	return tf, nil
+}
+
+// reportParams writes the effective parameters for a test to stderr.
+//
+// Secrets are redacted.
+func reportParams(ctx *plaxDsl.Ctx, name string, bs *plaxDsl.Bindings) {
+	ks := make([]string, 0, len(*bs))
+	for k := range *bs {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	fmt.Fprintf(os.Stderr, "\nEffective parameters for %s\n\n", name)
+	for _, k := range ks {
+		v := fmt.Sprintf("%v", (*bs)[k])
+		if plaxDsl.IsSecretBinding(k) {
+			v = plaxDsl.Redacted
+		}
+		fmt.Fprintf(os.Stderr, "  %s=%s\n", k, ctx.Redactor.Redact(v))
+	}
+	fmt.Fprintf(os.Stderr, "\n")
 }
 
 // TestList are the individual tests to execute
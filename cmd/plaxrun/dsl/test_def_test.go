@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefLabels(t *testing.T) {
+	tr := TestRun{
+		Tests: TestDefMap{
+			"basic":  {Path: "basic.yaml", Labels: []string{"smoke"}},
+			"soak":   {Path: "soak.yaml", Labels: []string{"smoke", "slow"}},
+			"wait":   {Path: "wait.yaml", Labels: []string{"slow"}},
+			"others": {Path: "."},
+		},
+		trps: &TestRunParams{
+			Labels: []string{"mqtt", "!slow"},
+		},
+	}
+
+	names := func(tdrl TestDefRefList) string {
+		acc := make([]string, 0, len(tdrl))
+		for _, tdr := range tdrl {
+			acc = append(acc, tdr.Name)
+		}
+		return strings.Join(acc, ",")
+	}
+
+	for _, c := range []struct {
+		sel  []string
+		want string
+	}{
+		{nil, "others"},
+		{[]string{"smoke"}, "others,basic,soak"},
+		{[]string{"smoke", "!slow"}, "others,basic"},
+		{[]string{"!smoke"}, "others,others,wait"},
+	} {
+		tg := TestGroup{
+			Tests:  TestDefRefList{{Name: "others"}},
+			Select: c.sel,
+		}
+		if got := names(tg.tests(tr)); got != c.want {
+			t.Fatalf("%v: %s != %s", c.sel, got, c.want)
+		}
+	}
+
+	for name, want := range map[string]bool{
+		"basic":  false,
+		"soak":   true,
+		"wait":   true,
+		"others": false,
+	} {
+		if got := tr.Tests[name].excluded(tr.trps.Labels); got != want {
+			t.Fatalf("%s: %v", name, got)
+		}
+	}
+
+	tdr := TestDefRef{
+		TestConstraints: TestConstraints{
+			Labels: []string{"selftest"},
+		},
+	}
+	if got := strings.Join(tdr.labels(tr), ","); got != "selftest,mqtt,!slow" {
+		t.Fatal(got)
+	}
+}
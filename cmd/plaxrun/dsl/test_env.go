@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+// TestRunEnvMap maps environment variable names to (non-substituted)
+// values.
+//
+// These environment variables are exported to all param commands
+// and to the subprocesses (like exec steps and channels) that tests
+// start.
+type TestRunEnvMap map[string]string
+
+// resolve substitutes the bindings into the values.
+//
+// The value of a variable with a secret name (see
+// plaxDsl.IsSecretBinding) is redacted from logs, and so is any
+// secret binding that a value uses.
+func (trem TestRunEnvMap) resolve(ctx *plaxDsl.Ctx, bs *plaxDsl.Bindings) (map[string]string, error) {
+	if len(trem) == 0 {
+		return nil, nil
+	}
+
+	ctx.Redactor.AddBindings(*bs)
+
+	env := make(map[string]string, len(trem))
+	for k, v := range trem {
+		s, err := bs.StringSub(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to substitute env %s: %w", k, err)
+		}
+		if plaxDsl.IsSecretBinding(k) {
+			ctx.Redactor.Add(s)
+		}
+		env[k] = s
+	}
+
+	return env, nil
+}
+
+// environ returns the current process's environment with the
+// resolved variables added.
+func (trem TestRunEnvMap) environ(ctx *plaxDsl.Ctx, bs *plaxDsl.Bindings) ([]string, error) {
+	env, err := trem.resolve(ctx, bs)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := make([]string, 0, len(env))
+	for k := range env {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	acc := os.Environ()
+	for _, k := range ks {
+		ctx.Logdf("run env %s=%s", k, env[k])
+		acc = append(acc, k+"="+env[k])
+	}
+
+	return acc, nil
+}
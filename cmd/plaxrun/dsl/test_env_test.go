@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"strings"
+	"testing"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+func TestRunEnv(t *testing.T) {
+	var (
+		ctx = plaxDsl.NewCtx(nil)
+		tr  = TestRun{
+			Env: TestRunEnvMap{
+				"GREETING":     "hello {?WHO}",
+				"SECRET_TOKEN": "{?TOKEN}",
+			},
+			Params: TestParamBindingMap{
+				"?HEARD": TestParamBinding{
+					Cmd:  "sh",
+					Args: []string{"-c", `echo "$KEY=$GREETING"`},
+				},
+				"?SHADOWED": TestParamBinding{
+					Cmd:  "sh",
+					Args: []string{"-c", `echo "$KEY=$GREETING"`},
+					Envs: TestParamEnvMap{
+						"GREETING": "hi",
+					},
+				},
+			},
+		}
+		bs = plaxDsl.Bindings{
+			"?WHO":   "world",
+			"?TOKEN": "shh-tacos",
+		}
+	)
+	ctx.Redactor = plaxDsl.NewRedactor()
+
+	env, err := tr.Env.resolve(ctx, &bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := env["GREETING"]; got != "hello world" {
+		t.Fatal(got)
+	}
+	if got := ctx.Redactor.Redact("token shh-tacos"); strings.Contains(got, "shh-tacos") {
+		t.Fatal(got)
+	}
+
+	deps := TestParamDependencyList{"?HEARD", "?SHADOWED"}
+	if err := deps.process(ctx, tr, &bs); err != nil {
+		t.Fatal(err)
+	}
+	if got := bs["?HEARD"]; got != "hello world" {
+		t.Fatal(got)
+	}
+	// A param's own envs take precedence.
+	if got := bs["?SHADOWED"]; got != "hi" {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+// TestRunEnvironment is a named environment (like "dev" or "stage")
+// that a test run can target.  See TestRunParams.Environment.
+//
+// An environment's params and env take precedence over the run's
+// own, but a parameter given on the command line still takes
+// precedence over an environment's.
+type TestRunEnvironment struct {
+	Doc string `yaml:"doc,omitempty"`
+
+	// Params are parameter values for the environment.
+	Params TestParamMap `yaml:"params,omitempty"`
+
+	// Env gives environment variables that are merged over the
+	// run's Env.
+	Env TestRunEnvMap `yaml:"env,omitempty"`
+
+	// Profiles are files (relative to the run file's directory)
+	// of channel profiles for every test.  See
+	// plaxDsl.ChanProfile.
+	Profiles []string `yaml:"profiles,omitempty"`
+
+	// Chans maps channel types to configurations that are merged
+	// over the configuration of every channel of that type.  See
+	// plaxDsl.Ctx.ChanOverlays.
+	Chans map[plaxDsl.ChanKind]interface{} `yaml:"chans,omitempty"`
+}
+
+// TestRunEnvironmentMap maps names to TestRunEnvironments.
+type TestRunEnvironmentMap map[string]*TestRunEnvironment
+
+// names returns the environments' names in order.
+func (trem TestRunEnvironmentMap) names() []string {
+	acc := make([]string, 0, len(trem))
+	for name := range trem {
+		acc = append(acc, name)
+	}
+	sort.Strings(acc)
+	return acc
+}
+
+// useEnvironment applies the named environment to the TestRun and
+// its TestRunParams.  The given dir is the run file's directory.
+func (tr *TestRun) useEnvironment(ctx *plaxDsl.Ctx, name string, dir string) error {
+	e, have := tr.Environments[name]
+	if !have || e == nil {
+		return fmt.Errorf("unknown environment '%s' (have: %s)",
+			name, strings.Join(tr.Environments.names(), ", "))
+	}
+
+	ctx.Logf("Using environment %s", name)
+
+	if tr.trps.Bindings == nil {
+		tr.trps.Bindings = make(plaxDsl.Bindings)
+	}
+	// Bind the params before substituting them so that a param
+	// can use another.
+	ks := make([]string, 0, len(e.Params))
+	for k, v := range e.Params {
+		if _, have := tr.trps.Bindings[k]; have {
+			ctx.Logdf("param %s was given on the command line; ignoring environment's %s", k, v)
+			continue
+		}
+		tr.trps.Bindings[k] = v
+		ks = append(ks, k)
+	}
+	for _, k := range ks {
+		pv, err := tr.trps.Bindings.StringSub(ctx, e.Params[k])
+		if err != nil {
+			return fmt.Errorf("failed to substitute environment param %s: %w", k, err)
+		}
+		tr.trps.Bindings.SetKeyValue(k, pv)
+	}
+
+	if 0 < len(e.Env) {
+		env := make(TestRunEnvMap, len(tr.Env)+len(e.Env))
+		for k, v := range tr.Env {
+			env[k] = v
+		}
+		for k, v := range e.Env {
+			env[k] = v
+		}
+		tr.Env = env
+	}
+
+	for _, filename := range e.Profiles {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		tr.trps.Profiles = append(tr.trps.Profiles, filename)
+	}
+
+	if 0 < len(e.Chans) {
+		overlays := make(map[plaxDsl.ChanKind]interface{}, len(tr.trps.ChanOverlays)+len(e.Chans))
+		for kind, config := range tr.trps.ChanOverlays {
+			overlays[kind] = config
+		}
+		for kind, config := range e.Chans {
+			overlays[kind] = plaxDsl.MergeConfig(overlays[kind], config)
+		}
+		tr.trps.ChanOverlays = overlays
+	}
+
+	return nil
+}
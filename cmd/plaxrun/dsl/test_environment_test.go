@@ -0,0 +1,151 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"path/filepath"
+	"testing"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+func TestRunEnvironments(t *testing.T) {
+	var (
+		ctx = plaxDsl.NewCtx(nil)
+		tr  = TestRun{
+			Env: TestRunEnvMap{
+				"REGION": "east",
+				"MODE":   "test",
+			},
+			Environments: TestRunEnvironmentMap{
+				"stage": {
+					Params: TestParamMap{
+						"URL":  "https://{HOST}/",
+						"HOST": "stage.example.com",
+						"WAIT": "100",
+					},
+					Env: TestRunEnvMap{
+						"REGION": "west",
+					},
+					Profiles: []string{"profiles/stage.yaml"},
+					Chans: map[plaxDsl.ChanKind]interface{}{
+						"httpclient": map[string]interface{}{
+							"Insecure": true,
+						},
+					},
+				},
+			},
+			trps: &TestRunParams{
+				Bindings: plaxDsl.Bindings{
+					"WAIT": 200,
+				},
+			},
+		}
+	)
+
+	if err := tr.useEnvironment(ctx, "prod", "/tmp"); err == nil {
+		t.Fatal("expected protest")
+	}
+
+	if err := tr.useEnvironment(ctx, "stage", "/tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	bs := tr.trps.Bindings
+	if got := bs["HOST"]; got != "stage.example.com" {
+		t.Fatal(got)
+	}
+	if got := bs["URL"]; got != "https://stage.example.com/" {
+		t.Fatal(got)
+	}
+	// A command-line param takes precedence.
+	if got := bs["WAIT"]; got != 200 {
+		t.Fatal(got)
+	}
+
+	if tr.Env["REGION"] != "west" || tr.Env["MODE"] != "test" {
+		t.Fatal(tr.Env)
+	}
+
+	if len(tr.trps.Profiles) != 1 || tr.trps.Profiles[0] != filepath.Join("/tmp", "profiles/stage.yaml") {
+		t.Fatal(tr.trps.Profiles)
+	}
+
+	if got := plaxDsl.JSON(tr.trps.ChanOverlays); got != `{"httpclient":{"Insecure":true}}` {
+		t.Fatal(got)
+	}
+
+	// A param can use the environment's params.
+	if err := (TestParamMap{"GREETING": "hello {HOST}"}).bind(ctx, tr, &bs); err != nil {
+		t.Fatal(err)
+	}
+	if got := bs["GREETING"]; got != "hello stage.example.com" {
+		t.Fatal(got)
+	}
+}
+
+func TestRunEnvironmentOverlayCase(t *testing.T) {
+	var (
+		ctx = plaxDsl.NewCtx(nil)
+		tr  = TestRun{
+			Environments: TestRunEnvironmentMap{
+				"stage": {
+					Chans: map[plaxDsl.ChanKind]interface{}{
+						"mqtt": map[string]interface{}{
+							"BrokerURL": "tcp://stage:1883",
+						},
+					},
+				},
+			},
+			trps: &TestRunParams{
+				ChanOverlays: map[plaxDsl.ChanKind]interface{}{
+					"mqtt": map[string]interface{}{
+						"brokerurl": "tcp://run:1883",
+						"clientid":  "plax",
+					},
+				},
+			},
+		}
+	)
+
+	if err := tr.useEnvironment(ctx, "stage", "/tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay := tr.trps.ChanOverlays["mqtt"]
+	if got := plaxDsl.JSON(overlay); got != `{"BrokerURL":"tcp://stage:1883","clientid":"plax"}` {
+		t.Fatal(got)
+	}
+
+	// The overlay is merged over a spec's channel config, whose
+	// keys might use a different case.
+	spec := map[string]interface{}{
+		"brokerurl": "tcp://spec:1883",
+	}
+	var opts struct {
+		BrokerURL string
+		ClientID  string
+	}
+	if err := plaxDsl.As(plaxDsl.MergeConfig(spec, overlay), &opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.BrokerURL != "tcp://stage:1883" || opts.ClientID != "plax" {
+		t.Fatal(opts)
+	}
+}
@@ -19,6 +19,7 @@ package dsl
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/Comcast/plax/cmd/plaxrun/async"
 	plaxDsl "github.com/Comcast/plax/dsl"
@@ -42,7 +43,14 @@ func (tgr TestGroupRef) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun, name string,
 
 	name = fmt.Sprintf("%s:%s", name, tgr.Name)
 
-	err := tgr.Params.bind(ctx, bs)
+	// The group's own params override inherited params, and the
+	// group reference's params override the group's own params.
+	err := tg.Params.bind(ctx, tr, bs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to substitute %s group parameters: %w", name, err)
+	}
+
+	err = tgr.Params.bind(ctx, tr, bs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to substitute %s group ref parameters: %w", name, err)
 	}
@@ -94,6 +102,38 @@ type TestGroup struct {
 	Params  TestParamMap     `yaml:"params"`
 	Tests   TestDefRefList   `yaml:"tests"`
 	Groups  TestGroupRefList `yaml:"groups"`
+	// Select adds the tests (in name order) whose definitions'
+	// labels match these labels (like "smoke" or "!slow").  See
+	// TestDef.Labels.
+	Select []string `yaml:"select,omitempty"`
+	// Notify, when not nil, replaces the run's notifications
+	// (see TestRun.Notify) when this group is a top-level group.
+	// An empty list disables notifications for the group.
+	Notify TestNotifyList `yaml:"notify,omitempty"`
+}
+
+// tests returns the group's Tests followed by its selected tests.
+func (tg TestGroup) tests(tr TestRun) TestDefRefList {
+	if len(tg.Select) == 0 {
+		return tg.Tests
+	}
+
+	names := make([]string, 0, len(tr.Tests))
+	for name, td := range tr.Tests {
+		if plaxDsl.LabelsMatch(td.Labels, tg.Select) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	acc := make(TestDefRefList, 0, len(tg.Tests)+len(names))
+	acc = append(acc, tg.Tests...)
+	for _, name := range names {
+		acc = append(acc, TestDefRef{
+			Name: name,
+		})
+	}
+	return acc
 }
 
 func (tg TestGroup) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun, name string, bs *plaxDsl.Bindings) ([]*async.TaskFunc, error) {
@@ -102,8 +142,6 @@ func (tg TestGroup) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun, name string, bs *
 		err   error
 	)
 
-	tg.Params.bind(ctx, bs)
-
 	if tg.Iterate != nil {
 		tibsl, err = tg.Iterate.getBindings(ctx, tr, bs)
 		if err != nil {
@@ -123,7 +161,7 @@ func (tg TestGroup) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun, name string, bs *
 			n = fmt.Sprintf("%s:%s", name, tibs.name)
 		}
 
-		tfs, err := tg.Tests.getTaskFuncs(ctx, tr, n, tibs.bs)
+		tfs, err := tg.tests(tr).getTaskFuncs(ctx, tr, n, tibs.bs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get test def tasks: %w", err)
 		}
@@ -177,8 +215,7 @@ func (tgl *TestGroupList) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun) ([]*async.T
 	tfs := make([]*async.TaskFunc, 0)
 
 	for _, n := range *tgl {
-		tg, ok := tr.Groups[n]
-		if !ok {
+		if _, ok := tr.Groups[n]; !ok {
 			return nil, fmt.Errorf("failed to find test group %s", n)
 		}
 
@@ -189,8 +226,7 @@ func (tgl *TestGroupList) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun) ([]*async.T
 
 		name := fmt.Sprintf("%s-%s", tr.Name, tr.Version)
 		tgr := TestGroupRef{
-			Name:   n,
-			Params: tg.Params,
+			Name: n,
 		}
 
 		gtfs, err := tgr.getTaskFuncs(ctx, tr, name, bs)
@@ -198,6 +234,12 @@ func (tgl *TestGroupList) getTaskFuncs(ctx *plaxDsl.Ctx, tr TestRun) ([]*async.T
 			return nil, fmt.Errorf("failed to get tasks for test group %s: %w", n, err)
 		}
 
+		if tr.groupOf != nil {
+			for _, tf := range gtfs {
+				tr.groupOf[tf.Name] = n
+			}
+		}
+
 		tfs = append(tfs, gtfs...)
 	}
 
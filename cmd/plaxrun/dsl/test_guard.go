@@ -40,7 +40,7 @@ func getLibrary(ctx *plaxDsl.Ctx, filename string) (string, error) {
 		fn := path.Join(dir, filename)
 		js, err := ioutil.ReadFile(fn)
 		if err != nil {
-			ctx.Logdf("error reading library '%s': %w", fn, err)
+			ctx.Logdf("error reading library '%s': %s", fn, err)
 			continue
 		}
 		return string(js), nil
@@ -91,7 +91,7 @@ func (tg *TestGuard) Satisfied(ctx *plaxDsl.Ctx, tr TestRun, bs *plaxDsl.Binding
 		return false, err
 	}
 
-	err = tg.DependsOn.process(ctx, tr.Params, ebs)
+	err = tg.DependsOn.process(ctx, tr, ebs)
 	if err != nil {
 		return false, err
 	}
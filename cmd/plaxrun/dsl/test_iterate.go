@@ -52,7 +52,7 @@ func trimQuotes(s string) string {
 }
 
 func (ti TestIterate) getBindings(ctx *plaxDsl.Ctx, tr TestRun, bs *plaxDsl.Bindings) (TestIterateBindingsList, error) {
-	err := ti.DependsOn.process(ctx, tr.Params, bs)
+	err := ti.DependsOn.process(ctx, tr, bs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process dependencies: %w", err)
 	}
@@ -0,0 +1,354 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+)
+
+// NotifyTimeout is the timeout for posting a notification.
+var NotifyTimeout = 10 * time.Second
+
+// NotifyMaxFailures is the maximum number of failures that a chat
+// (Slack or Teams) notification lists.
+var NotifyMaxFailures = 20
+
+// TestNotify posts a summary of a run's results to a webhook.
+//
+// A top-level group (one given with -g) can have its own
+// notifications, which replace the run's for that group's tests.
+type TestNotify struct {
+	// URL is the webhook's URL, which can use bindings (like
+	// '{SLACK_WEBHOOK}').
+	URL string `yaml:"url"`
+	// Format is "slack", "teams", or "webhook" (the default),
+	// which posts a RunSummary as JSON.
+	Format string `yaml:"format,omitempty"`
+	// On is "always" (the default), "failure", or "success".
+	On string `yaml:"on,omitempty"`
+	// Params are parameters for the URL and the Links.
+	Params TestParamDependencyList `yaml:"params,omitempty"`
+	// Links are included in the notification.
+	Links []TestNotifyLink `yaml:"links,omitempty"`
+}
+
+// TestNotifyLink is a link (like one to a report) in a notification.
+// The name and the URL can use bindings.
+type TestNotifyLink struct {
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+}
+
+// TestNotifyList are notifications.
+type TestNotifyList []TestNotify
+
+// RunSummary is what a notification reports, and it's what a
+// "webhook" TestNotify posts.
+type RunSummary struct {
+	Run     string    `json:"run"`
+	Version string    `json:"version"`
+	Group   string    `json:"group,omitempty"`
+	Time    time.Time `json:"time"`
+
+	// Text is a one-line summary.
+	Text string `json:"text"`
+
+	Tests   int `json:"tests"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+
+	Failures []RunFailure     `json:"failures,omitempty"`
+	Links    []TestNotifyLink `json:"links,omitempty"`
+}
+
+// RunFailure is a test that failed or had an error.
+type RunFailure struct {
+	Suite   string `json:"suite"`
+	Test    string `json:"test"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+// ok reports whether every test passed (or was skipped).
+func (s *RunSummary) ok() bool {
+	return s.Failed == 0 && s.Errors == 0
+}
+
+// newRunSummary summarizes the results.
+func newRunSummary(tr *TestRun, group string, results []*invoke.TestEventData) *RunSummary {
+	s := &RunSummary{
+		Run:     tr.Name,
+		Version: tr.Version,
+		Group:   group,
+		Time:    time.Now().UTC(),
+		Tests:   len(results),
+	}
+	for _, r := range results {
+		switch r.Result {
+		case "passed":
+			s.Passed++
+		case "skipped":
+			s.Skipped++
+		case "failed":
+			s.Failed++
+		default:
+			s.Errors++
+		}
+		if r.Result == "failed" || r.Result == "error" {
+			s.Failures = append(s.Failures, RunFailure{
+				Suite:   r.Suite,
+				Test:    r.Test,
+				Result:  r.Result,
+				Message: r.Message,
+			})
+		}
+	}
+
+	name := fmt.Sprintf("%s-%s", tr.Name, tr.Version)
+	if group != "" {
+		name += ":" + group
+	}
+	status := "passed"
+	if !s.ok() {
+		status = "FAILED"
+	}
+	s.Text = fmt.Sprintf("%s %s: %d passed, %d failed, %d errors, %d skipped",
+		name, status, s.Passed, s.Failed, s.Errors, s.Skipped)
+
+	return s
+}
+
+// notify sends the notifications for the results.  Tests in a
+// top-level group that has its own notifications are reported
+// separately.  Problems are logged (rather than failing the run).
+func (tr *TestRun) notify(ctx *plaxDsl.Ctx, results []*invoke.TestEventData) {
+	if tr.trps.NoNotify {
+		return
+	}
+
+	var (
+		byGroup = make(map[string][]*invoke.TestEventData)
+		groups  = make([]string, 0, 2)
+	)
+	for _, r := range results {
+		g := tr.groupOf[r.Suite]
+		if tg, have := tr.Groups[g]; !have || tg.Notify == nil {
+			// The run's notifications.
+			g = ""
+		}
+		if _, have := byGroup[g]; !have {
+			groups = append(groups, g)
+		}
+		byGroup[g] = append(byGroup[g], r)
+	}
+	sort.Strings(groups)
+
+	for _, g := range groups {
+		ns := tr.Notify
+		if g != "" {
+			ns = tr.Groups[g].Notify
+		}
+		if len(ns) == 0 {
+			continue
+		}
+		s := newRunSummary(tr, g, byGroup[g])
+		for _, n := range ns {
+			if err := n.send(ctx, tr, s); err != nil {
+				ctx.Warnf("Notification for %s not sent: %s", s.Text, ctx.Redactor.Redact(err.Error()))
+			}
+		}
+	}
+}
+
+// notifying reports whether the run (or any group) has notifications.
+func (tr *TestRun) notifying() bool {
+	if tr.trps.NoNotify {
+		return false
+	}
+	if 0 < len(tr.Notify) {
+		return true
+	}
+	for _, tg := range tr.Groups {
+		if 0 < len(tg.Notify) {
+			return true
+		}
+	}
+	return false
+}
+
+// send posts the summary (if the notification wants it).
+func (n TestNotify) send(ctx *plaxDsl.Ctx, tr *TestRun, s *RunSummary) error {
+	switch n.On {
+	case "", "always":
+	case "failure":
+		if s.ok() {
+			return nil
+		}
+	case "success":
+		if !s.ok() {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown notification 'on' '%s'", n.On)
+	}
+
+	bs, err := (&tr.trps.Bindings).Copy()
+	if err != nil {
+		return err
+	}
+	if err := n.Params.process(ctx, *tr, bs); err != nil {
+		return err
+	}
+	ctx.Redactor.AddBindings(*bs)
+
+	u, err := bs.StringSub(ctx, n.URL)
+	if err != nil {
+		return err
+	}
+
+	// Every notification gets its own links.
+	c := *s
+	c.Links = make([]TestNotifyLink, 0, len(n.Links))
+	for _, l := range n.Links {
+		name, err := bs.StringSub(ctx, l.Name)
+		if err != nil {
+			return err
+		}
+		href, err := bs.StringSub(ctx, l.URL)
+		if err != nil {
+			return err
+		}
+		c.Links = append(c.Links, TestNotifyLink{
+			Name: name,
+			URL:  href,
+		})
+	}
+
+	var body interface{}
+	switch n.Format {
+	case "", "webhook":
+		body = &c
+	case "slack":
+		body = slackMessage(&c)
+	case "teams":
+		body = teamsMessage(&c)
+	default:
+		return fmt.Errorf("unknown notification format '%s'", n.Format)
+	}
+
+	ctx.Logf("Notifying (%s) %s", n.Format, c.Text)
+
+	return postNotification(u, body)
+}
+
+func postNotification(u string, body interface{}) error {
+	js, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Timeout: NotifyTimeout,
+	}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// chatFailures returns a line for each failure (up to
+// NotifyMaxFailures).
+func chatFailures(s *RunSummary, format string) []string {
+	acc := make([]string, 0, len(s.Failures)+1)
+	for i, f := range s.Failures {
+		if i == NotifyMaxFailures {
+			acc = append(acc, fmt.Sprintf("... and %d more", len(s.Failures)-i))
+			break
+		}
+		msg := strings.SplitN(strings.TrimSpace(f.Message), "\n", 2)[0]
+		acc = append(acc, fmt.Sprintf(format, f.Result, f.Test, f.Suite, msg))
+	}
+	return acc
+}
+
+// slackMessage makes a Slack incoming webhook message.
+func slackMessage(s *RunSummary) map[string]interface{} {
+	lines := []string{"*" + s.Text + "*"}
+	for _, line := range chatFailures(s, "• %s: `%s` (%s) %s") {
+		lines = append(lines, line)
+	}
+	if 0 < len(s.Links) {
+		links := make([]string, len(s.Links))
+		for i, l := range s.Links {
+			links[i] = fmt.Sprintf("<%s|%s>", l.URL, l.Name)
+		}
+		lines = append(lines, strings.Join(links, " | "))
+	}
+	return map[string]interface{}{
+		"text": strings.Join(lines, "\n"),
+	}
+}
+
+// teamsMessage makes a Microsoft Teams incoming webhook (legacy
+// MessageCard) message.
+func teamsMessage(s *RunSummary) map[string]interface{} {
+	color := "2E7D32"
+	if !s.ok() {
+		color = "C62828"
+	}
+	actions := make([]interface{}, len(s.Links))
+	for i, l := range s.Links {
+		actions[i] = map[string]interface{}{
+			"@type": "OpenUri",
+			"name":  l.Name,
+			"targets": []interface{}{
+				map[string]interface{}{
+					"os":  "default",
+					"uri": l.URL,
+				},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"@type":           "MessageCard",
+		"@context":        "http://schema.org/extensions",
+		"summary":         s.Text,
+		"title":           s.Text,
+		"themeColor":      color,
+		"text":            strings.Join(chatFailures(s, "- %s: `%s` (%s) %s"), "\n\n"),
+		"potentialAction": actions,
+	}
+}
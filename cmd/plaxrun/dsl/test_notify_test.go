@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+)
+
+func TestNotifications(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		posts = make(map[string]map[string]interface{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		var x map[string]interface{}
+		if err := json.Unmarshal(bs, &x); err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		posts[r.URL.Path] = x
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	tr := &TestRun{
+		Name:    "r",
+		Version: "1",
+		Notify: TestNotifyList{
+			{
+				URL:    "{HOOK}/run",
+				Format: "slack",
+				Links: []TestNotifyLink{
+					{Name: "Report", URL: "{HOOK}/report.html"},
+				},
+			},
+			{
+				URL: "{HOOK}/failures",
+				On:  "failure",
+			},
+		},
+		Groups: TestGroupMap{
+			"g": TestGroup{
+				Notify: TestNotifyList{
+					{URL: "{HOOK}/g", Format: "teams"},
+					{URL: "{HOOK}/g-webhook", On: "failure"},
+				},
+			},
+			"quiet": TestGroup{
+				Notify: TestNotifyList{},
+			},
+			"x": TestGroup{},
+		},
+		trps: &TestRunParams{
+			Bindings: plaxDsl.Bindings{
+				"HOOK": server.URL,
+			},
+		},
+		groupOf: map[string]string{
+			"r-1:g:a":     "g",
+			"r-1:quiet:b": "quiet",
+			"r-1:x:c":     "x",
+		},
+	}
+
+	if !tr.notifying() {
+		t.Fatal("not notifying")
+	}
+
+	tr.notify(plaxDsl.NewCtx(nil), []*invoke.TestEventData{
+		{Suite: "r-1:g:a", Test: "a.yaml", Result: "failed", Message: "nope"},
+		{Suite: "r-1:quiet:b", Test: "b.yaml", Result: "passed"},
+		{Suite: "r-1:x:c", Test: "c.yaml", Result: "passed"},
+	})
+
+	if len(posts) != 3 {
+		t.Fatal(posts)
+	}
+
+	slack := posts["/run"]["text"].(string)
+	if !strings.Contains(slack, "r-1 passed: 1 passed, 0 failed") ||
+		!strings.Contains(slack, "<"+server.URL+"/report.html|Report>") {
+		t.Fatal(slack)
+	}
+
+	teams := posts["/g"]
+	if teams["@type"] != "MessageCard" || teams["themeColor"] != "C62828" ||
+		!strings.Contains(teams["text"].(string), "failed: `a.yaml` (r-1:g:a) nope") {
+		t.Fatal(teams)
+	}
+
+	hook := posts["/g-webhook"]
+	if hook["group"] != "g" || hook["failed"] != 1.0 || len(hook["failures"].([]interface{})) != 1 {
+		t.Fatal(hook)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		tr.trps.NoNotify = true
+		if tr.notifying() {
+			t.Fatal("notifying")
+		}
+	})
+}
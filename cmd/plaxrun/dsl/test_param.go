@@ -19,10 +19,12 @@ package dsl
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	plaxDsl "github.com/Comcast/plax/dsl"
 )
@@ -37,9 +39,20 @@ type TestParamDependency string
 type TestParamDependencyList []TestParamDependency
 
 // process the TestParamDependencyList
-func (tpdl TestParamDependencyList) process(ctx *plaxDsl.Ctx, tpbm TestParamBindingMap, bs *plaxDsl.Bindings) error {
+//
+// When tr.trps.ParamParallel is greater than one, parameters that
+// don't depend on each other are processed concurrently.
+func (tpdl TestParamDependencyList) process(ctx *plaxDsl.Ctx, tr TestRun, bs *plaxDsl.Bindings) error {
+	if tr.trps != nil && 1 < tr.trps.ParamParallel {
+		r := newParamResolver(ctx, tr, bs, tr.trps.ParamParallel)
+		if err := r.resolveAll(tpdl, nil); err != nil {
+			return fmt.Errorf("failed to process test params: %w", err)
+		}
+		return nil
+	}
+
 	for _, tpd := range tpdl {
-		err := tpd.process(ctx, tpbm, bs)
+		err := tpd.process(ctx, tr, bs)
 		if err != nil {
 			return fmt.Errorf("failed to process test params: %w", err)
 		}
@@ -52,8 +65,17 @@ func (tpdl TestParamDependencyList) process(ctx *plaxDsl.Ctx, tpbm TestParamBind
 type TestParamMap map[string]string
 
 // bind the TestParams from the TestParamMap to the bs Bindings
-func (tpm TestParamMap) bind(ctx *plaxDsl.Ctx, bs *plaxDsl.Bindings) error {
+//
+// A parameter given on the command line (or by the run's
+// environment) takes precedence, so bind will not override it.
+func (tpm TestParamMap) bind(ctx *plaxDsl.Ctx, tr TestRun, bs *plaxDsl.Bindings) error {
 	for tpk, tpv := range tpm {
+		if tr.trps != nil {
+			if _, ok := tr.trps.Bindings[tpk]; ok {
+				ctx.Logdf("param %s was given on the command line or by the environment; ignoring %s", tpk, tpv)
+				continue
+			}
+		}
 		pv, err := bs.StringSub(ctx, tpv)
 		if err != nil {
 			return fmt.Errorf("failed to substitute test parameter: %w", err)
@@ -65,20 +87,20 @@ func (tpm TestParamMap) bind(ctx *plaxDsl.Ctx, bs *plaxDsl.Bindings) error {
 }
 
 // process the TestParamDependency
-func (tpd TestParamDependency) process(ctx *plaxDsl.Ctx, tpbm TestParamBindingMap, bs *plaxDsl.Bindings) error {
+func (tpd TestParamDependency) process(ctx *plaxDsl.Ctx, tr TestRun, bs *plaxDsl.Bindings) error {
 	tpk := string(tpd)
-	pbm, ok := tpbm[string(tpk)]
+	pbm, ok := tr.Params[string(tpk)]
 	if !ok {
 		return fmt.Errorf("failed to find test param %s", tpk)
 	}
 
 	for _, tpd := range pbm.DependsOn {
-		if err := tpd.process(ctx, tpbm, bs); err != nil {
+		if err := tpd.process(ctx, tr, bs); err != nil {
 			return fmt.Errorf("failed to process dependent param for %s: %v", tpk, err)
 		}
 	}
 
-	err := pbm.process(ctx, tpk, bs)
+	err := pbm.process(ctx, tpk, tr.Env, bs)
 	if err != nil {
 		return fmt.Errorf("failed to process param %s: %v", tpk, err)
 	}
@@ -109,11 +131,62 @@ type TestParamBinding struct {
 
 	// tpem is the map of environemnt variables to pass into the Run script
 	Envs TestParamEnvMap `json:"envs" yaml:"envs"`
+
+	// Secret, if not nil, gets the parameter's value from a
+	// secret provider (instead of running a command).
+	//
+	// The Name and Key are subject to expansion.
+	Secret *plaxDsl.SecretRef `json:"secret,omitempty" yaml:"secret,omitempty"`
+
+	// FromEnv, if not empty, is the name of an environment
+	// variable that gives the parameter's value (instead of
+	// running a command).
+	//
+	// Subject to expansion.
+	FromEnv string `json:"fromEnv,omitempty" yaml:"fromEnv,omitempty"`
+
+	// FromFile, if not empty, is a file whose contents (without a
+	// trailing newline) give the parameter's value (instead of
+	// running a command).
+	//
+	// Subject to expansion.
+	FromFile string `json:"fromFile,omitempty" yaml:"fromFile,omitempty"`
+
+	// FromData, if not nil, gets the parameter's value from a
+	// JSON or YAML file (instead of running a command).
+	FromData *TestParamData `json:"fromData,omitempty" yaml:"fromData,omitempty"`
+
+	// JS, if not empty, is a Javascript expression that gives the
+	// parameter's value (instead of running a command).  The
+	// expression can use 'bs', which has the current bindings.
+	//
+	// Subject to expansion.
+	JS string `json:"js,omitempty" yaml:"js,omitempty"`
+
+	// Cache, if not nil, caches the command's output.
+	Cache *TestParamCache `json:"cache,omitempty" yaml:"cache,omitempty"`
+
+	// Timeout, when not empty, is the maximum time (as a Go
+	// duration like "30s") for each attempt to get the value.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Retries is the number of times to retry after a failed
+	// attempt.
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+
+	// RetryDelay (a Go duration) is the time to wait before each
+	// retry.  The default is one second.
+	RetryDelay string `json:"retryDelay,omitempty" yaml:"retryDelay,omitempty"`
 }
 
 // environment set the environment fo the script execution
-func (tpb *TestParamBinding) environment(ctx *plaxDsl.Ctx, key string, bs *plaxDsl.Bindings) error {
-	tpb.ec.Env = os.Environ()
+//
+// The command's own Envs take precedence over the test run's env.
+func (tpb *TestParamBinding) environment(ctx *plaxDsl.Ctx, key string, env TestRunEnvMap, bs *plaxDsl.Bindings) error {
+	var err error
+	if tpb.ec.Env, err = env.environ(ctx, bs); err != nil {
+		return err
+	}
 
 	tpb.ec.Env = append(tpb.ec.Env, fmt.Sprintf("KEY=%s", key))
 
@@ -142,17 +215,75 @@ func (tpb *TestParamBinding) substitute(ctx *plaxDsl.Ctx, bs *plaxDsl.Bindings)
 		tpem[k] = s
 	}
 
+	var secret *plaxDsl.SecretRef
+	if tpb.Secret != nil {
+		name, err := bs.StringSub(ctx, tpb.Secret.Name)
+		if err != nil {
+			return nil, err
+		}
+		key, err := bs.StringSub(ctx, tpb.Secret.Key)
+		if err != nil {
+			return nil, err
+		}
+		var opts map[string]interface{}
+		if tpb.Secret.Opts != nil {
+			opts = make(map[string]interface{}, len(tpb.Secret.Opts))
+			for k, v := range tpb.Secret.Opts {
+				if s, is := v.(string); is {
+					if v, err = bs.StringSub(ctx, s); err != nil {
+						return nil, err
+					}
+				}
+				opts[k] = v
+			}
+		}
+		secret = &plaxDsl.SecretRef{
+			Provider: tpb.Secret.Provider,
+			Name:     name,
+			Key:      key,
+			Opts:     opts,
+		}
+	}
+
 	return &TestParamBinding{
-		DependsOn: tpb.DependsOn,
-		Cmd:       tpb.Cmd,
-		Args:      tpb.Args,
-		Envs:      tpem,
-		ec:        tpb.ec,
+		DependsOn:  tpb.DependsOn,
+		Cmd:        tpb.Cmd,
+		Args:       tpb.Args,
+		Envs:       tpem,
+		Secret:     secret,
+		FromEnv:    tpb.FromEnv,
+		FromFile:   tpb.FromFile,
+		FromData:   tpb.FromData,
+		JS:         tpb.JS,
+		Cache:      tpb.Cache,
+		Timeout:    tpb.Timeout,
+		Retries:    tpb.Retries,
+		RetryDelay: tpb.RetryDelay,
+		ec:         tpb.ec,
 	}, nil
 }
 
+// resolve the secret to process parameter binding
+func (tpb *TestParamBinding) resolve(ctx *plaxDsl.Ctx, key string, bs *plaxDsl.Bindings) error {
+	tpb, err := tpb.substitute(ctx, bs)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logdf("Param %s from secret provider %s", key, tpb.Secret.Provider)
+
+	s, err := plaxDsl.TheSecretProviders.Resolve(ctx, tpb.Secret)
+	if err != nil {
+		return err
+	}
+
+	(*bs)[key] = s
+
+	return nil
+}
+
 // run the command to process parameter binding
-func (tpb *TestParamBinding) run(ctx *plaxDsl.Ctx, key string, bs *plaxDsl.Bindings) error {
+func (tpb *TestParamBinding) run(ctx *plaxDsl.Ctx, key string, env TestRunEnvMap, bs *plaxDsl.Bindings) error {
 	var err error
 
 	// Substitute the parameter and run command bindings
@@ -161,11 +292,31 @@ func (tpb *TestParamBinding) run(ctx *plaxDsl.Ctx, key string, bs *plaxDsl.Bindi
 		return err
 	}
 
+	var cacheKey string
+	if tpb.Cache != nil {
+		resolved, err := env.resolve(ctx, bs)
+		if err != nil {
+			return err
+		}
+		if cacheKey, err = paramCacheKey(tpb.Cmd, tpb.Args, key, resolved, tpb.Envs); err != nil {
+			return err
+		}
+		output, have, err := theParamCache.get(ctx, tpb.Cache, cacheKey)
+		if err != nil {
+			return err
+		}
+		if have {
+			ctx.Logdf("Param binding command %s output from cache", key)
+			tpb.bind(ctx, output, bs)
+			return nil
+		}
+	}
+
 	// Build the execution command
-	tpb.ec = exec.Command(tpb.Cmd, tpb.Args...)
+	tpb.ec = exec.CommandContext(ctx, tpb.Cmd, tpb.Args...)
 
 	// Setup the environment with the substitute parameters
-	if err := tpb.environment(ctx, key, bs); err != nil {
+	if err := tpb.environment(ctx, key, env, bs); err != nil {
 		return err
 	}
 
@@ -174,37 +325,122 @@ func (tpb *TestParamBinding) run(ctx *plaxDsl.Ctx, key string, bs *plaxDsl.Bindi
 	var stdout bytes.Buffer
 	tpb.ec.Stdout = &stdout
 
-	if err := tpb.ec.Run(); err != nil {
+	if err := tpb.ec.Start(); err != nil {
 		ctx.Logdf("Param binding command %s error on run: %s\n", key, err)
 		return err
 	}
 
+	// The command is killed when the ctx is done (see Timeout),
+	// but its children might still have its stdout open, so
+	// we don't wait for them.
+	done := make(chan error, 1)
+	go func() {
+		done <- tpb.ec.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			ctx.Logdf("Param binding command %s error on run: %s\n", key, err)
+			return err
+		}
+	case <-ctx.Done():
+		ctx.Logdf("Param binding command %s error on run: %s\n", key, ctx.Err())
+		return ctx.Err()
+	}
+
 	if tpb.ec.ProcessState.ExitCode() != 0 {
 		return fmt.Errorf("Param binding process termintated with exit code %d", tpb.ec.ProcessState.ExitCode())
 	}
 
 	output := strings.TrimSuffix(stdout.String(), "\n") // removing only the trailing newline
 
+	if tpb.Cache != nil {
+		if err := theParamCache.put(ctx, tpb.Cache, cacheKey, output); err != nil {
+			return fmt.Errorf("failed to cache output for %s: %w", key, err)
+		}
+	}
+
+	tpb.bind(ctx, output, bs)
+
+	return nil
+}
+
+// bind sets the bindings that the command's output gives.
+func (tpb *TestParamBinding) bind(ctx *plaxDsl.Ctx, output string, bs *plaxDsl.Bindings) {
 	values := strings.Split(output, "\n")
 	for _, value := range values {
 		ctx.Logdf("Binding %s", value)
 		bs.Set(value)
 	}
-
-	return nil
 }
 
 // Process the test param binding
-func (tpb *TestParamBinding) process(ctx *plaxDsl.Ctx, pk string, bs *plaxDsl.Bindings) error {
+func (tpb *TestParamBinding) process(ctx *plaxDsl.Ctx, pk string, env TestRunEnvMap, bs *plaxDsl.Bindings) error {
 	// If paramater binding already exists just return
 	if _, ok := (*bs)[pk]; ok {
 		return nil
 	}
 
-	// Process the parameter binding run command
-	if err := tpb.run(ctx, pk, bs); err != nil {
+	if err := tpb.checkSources(); err != nil {
+		return fmt.Errorf("param %s: %w", pk, err)
+	}
+
+	timeout, err := parseParamDuration("timeout", tpb.Timeout, 0)
+	if err != nil {
+		return err
+	}
+	delay, err := parseParamDuration("retryDelay", tpb.RetryDelay, time.Second)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	attempt := func() error {
+		ctx := ctx
+		if 0 < timeout {
+			var cancel func()
+			ctx, cancel = ctx.WithTimeout(timeout)
+			defer cancel()
+		}
+
+		var err error
+		if tpb.Secret != nil {
+			err = tpb.resolve(ctx, pk, bs)
+		} else if tpb.builtin() {
+			err = tpb.provide(ctx, pk, bs)
+		} else {
+			// Process the parameter binding run command
+			err = tpb.run(ctx, pk, env, bs)
+		}
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil || tpb.Retries <= i {
+			return err
+		}
+		ctx.Logf("Param %s attempt %d failed (%s); retrying in %s", pk, i+1, err, delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// parseParamDuration parses the named duration, which has the given
+// default value when empty.
+func parseParamDuration(name, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s '%s': %w", name, s, err)
+	}
+	return d, nil
 }
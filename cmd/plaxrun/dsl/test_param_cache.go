@@ -0,0 +1,196 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+// TestParamCache configures caching for a parameter command's output
+// so that an expensive command (like one that fetches a token) runs
+// once rather than for every test that needs the parameter.
+//
+// The output is cached by the command, its arguments, and its
+// (substituted) environment.
+type TestParamCache struct {
+	// TTL is how long (as a Go duration like "10m") the output is
+	// reused.  An empty TTL means the output doesn't expire.
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+
+	// File, when not empty, is a file that keeps cached outputs
+	// across runs.  A relative filename is relative to the test
+	// directory.
+	//
+	// Since outputs can be secrets, the file is only readable by
+	// its owner.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// ttl parses the TTL.  The result is zero for an empty TTL.
+func (c *TestParamCache) ttl() (time.Duration, error) {
+	return parseParamDuration("cache ttl", c.TTL, 0)
+}
+
+// paramCacheKey returns the cache key for a command.
+func paramCacheKey(cmd string, args []string, key string, env map[string]string, envs TestParamEnvMap) (string, error) {
+	js, err := json.Marshal(map[string]interface{}{
+		"cmd":  cmd,
+		"args": args,
+		"key":  key,
+		"env":  env,
+		"envs": envs,
+	})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(js)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// paramCacheEntry is a command's cached output.
+type paramCacheEntry struct {
+	Output string
+	Time   time.Time
+}
+
+// paramCache has cached outputs by filename ("" for outputs that are
+// only in memory) and then by key.
+type paramCache struct {
+	sync.Mutex
+	files map[string]map[string]*paramCacheEntry
+}
+
+func newParamCache() *paramCache {
+	return &paramCache{
+		files: make(map[string]map[string]*paramCacheEntry),
+	}
+}
+
+// theParamCache is the cache for all parameter commands.
+var theParamCache = newParamCache()
+
+// entries returns the (possibly loaded) entries for the filename.
+//
+// The caller should hold the lock.
+func (pc *paramCache) entries(filename string) (map[string]*paramCacheEntry, error) {
+	if es, have := pc.files[filename]; have {
+		return es, nil
+	}
+	es := make(map[string]*paramCacheEntry)
+	if filename != "" {
+		js, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(js, &es); err != nil {
+				return nil, fmt.Errorf("param cache %s: %w", filename, err)
+			}
+		}
+	}
+	pc.files[filename] = es
+	return es, nil
+}
+
+// filename returns the absolute filename (if any) for the cache.
+func (c *TestParamCache) filename() (string, error) {
+	if c.File == "" {
+		return "", nil
+	}
+	return filepath.Abs(c.File)
+}
+
+// get returns the unexpired cached output (if any) for the key.
+func (pc *paramCache) get(ctx *plaxDsl.Ctx, c *TestParamCache, key string) (string, bool, error) {
+	ttl, err := c.ttl()
+	if err != nil {
+		return "", false, err
+	}
+	filename, err := c.filename()
+	if err != nil {
+		return "", false, err
+	}
+
+	pc.Lock()
+	defer pc.Unlock()
+
+	es, err := pc.entries(filename)
+	if err != nil {
+		return "", false, err
+	}
+	e, have := es[key]
+	if !have {
+		return "", false, nil
+	}
+	if 0 < ttl && ttl < time.Now().Sub(e.Time) {
+		ctx.Logdf("param cache entry %s expired", key)
+		return "", false, nil
+	}
+	return e.Output, true, nil
+}
+
+// put caches the output for the key (and writes the cache's file if
+// it has one).
+func (pc *paramCache) put(ctx *plaxDsl.Ctx, c *TestParamCache, key string, output string) error {
+	filename, err := c.filename()
+	if err != nil {
+		return err
+	}
+
+	pc.Lock()
+	defer pc.Unlock()
+
+	es, err := pc.entries(filename)
+	if err != nil {
+		return err
+	}
+	es[key] = &paramCacheEntry{
+		Output: output,
+		Time:   time.Now().UTC(),
+	}
+
+	if filename == "" {
+		return nil
+	}
+
+	js, err := json.MarshalIndent(es, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	// Write a temporary file and rename it so that a reader
+	// never sees a partial cache.
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, js, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+// paramResolver resolves parameters concurrently.  Parameters that
+// don't depend on each other are resolved at the same time, and at
+// most a given number of their commands run at once.
+//
+// See TestRunParams.ParamParallel.
+type paramResolver struct {
+	ctx *plaxDsl.Ctx
+	tr  TestRun
+	bs  *plaxDsl.Bindings
+
+	// sem limits the number of commands that run at once.
+	sem chan struct{}
+
+	sync.Mutex
+
+	// calls has a paramCall for every parameter that has been
+	// (or is being) resolved.
+	calls map[string]*paramCall
+}
+
+// paramCall is the resolution of one parameter, which other
+// parameters that depend on it can wait for.
+type paramCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newParamResolver(ctx *plaxDsl.Ctx, tr TestRun, bs *plaxDsl.Bindings, n int) *paramResolver {
+	return &paramResolver{
+		ctx:   ctx,
+		tr:    tr,
+		bs:    bs,
+		sem:   make(chan struct{}, n),
+		calls: make(map[string]*paramCall),
+	}
+}
+
+// resolveAll resolves the given parameters concurrently.  The path
+// is the chain of parameters that depend on these parameters.
+func (r *paramResolver) resolveAll(tpdl TestParamDependencyList, path []string) error {
+	var (
+		errs = make([]error, len(tpdl))
+		wg   sync.WaitGroup
+	)
+	for i, tpd := range tpdl {
+		wg.Add(1)
+		go func(i int, pk string) {
+			defer wg.Done()
+			errs[i] = r.resolve(pk, path)
+		}(i, string(tpd))
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve resolves the parameter (once) or waits for another
+// resolution of it.
+func (r *paramResolver) resolve(pk string, path []string) error {
+	for _, at := range path {
+		if at == pk {
+			return fmt.Errorf("param %s depends on itself (%s)",
+				pk, strings.Join(append(path, pk), " -> "))
+		}
+	}
+
+	r.Lock()
+	if c, have := r.calls[pk]; have {
+		r.Unlock()
+		<-c.done
+		return c.err
+	}
+	c := &paramCall{
+		done: make(chan struct{}),
+	}
+	r.calls[pk] = c
+	r.Unlock()
+
+	// Copy the path so that concurrent resolutions don't share
+	// its backing array.
+	here := make([]string, len(path), len(path)+1)
+	copy(here, path)
+
+	c.err = r.exec(pk, append(here, pk))
+	close(c.done)
+	return c.err
+}
+
+// exec resolves the parameter's dependencies and then the parameter
+// itself.
+func (r *paramResolver) exec(pk string, path []string) error {
+	tpb, ok := r.tr.Params[pk]
+	if !ok {
+		return fmt.Errorf("failed to find test param %s", pk)
+	}
+
+	if err := r.resolveAll(tpb.DependsOn, path); err != nil {
+		return fmt.Errorf("failed to process dependent param for %s: %v", pk, err)
+	}
+
+	// The command gets its own copy of the bindings, and then we
+	// add any new bindings it made.
+	r.Lock()
+	bs := make(plaxDsl.Bindings, len(*r.bs))
+	for k, v := range *r.bs {
+		bs[k] = v
+	}
+	r.Unlock()
+
+	r.sem <- struct{}{}
+	err := tpb.process(r.ctx, pk, r.tr.Env, &bs)
+	<-r.sem
+	if err != nil {
+		return fmt.Errorf("failed to process param %s: %v", pk, err)
+	}
+
+	r.Lock()
+	for k, v := range bs {
+		if _, have := (*r.bs)[k]; !have {
+			(*r.bs)[k] = v
+		}
+	}
+	r.Unlock()
+
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+// TestParamData gets a parameter's value from a JSON or YAML file.
+type TestParamData struct {
+	// File is the name of the JSON or YAML file.
+	//
+	// Subject to expansion.
+	File string `json:"file" yaml:"file"`
+
+	// Key is a dot-separated path (like "db.hosts.0") to the
+	// value in the file.  An empty Key gives the entire file.
+	//
+	// Subject to expansion.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// builtin reports whether the parameter gets its value from a
+// built-in source (rather than a command or a secret provider).
+func (tpb *TestParamBinding) builtin() bool {
+	return tpb.FromEnv != "" || tpb.FromFile != "" || tpb.FromData != nil || tpb.JS != ""
+}
+
+// checkSources complains if the parameter has more than one source
+// for its value.
+func (tpb *TestParamBinding) checkSources() error {
+	var acc []string
+	for name, have := range map[string]bool{
+		"cmd":      tpb.Cmd != "",
+		"secret":   tpb.Secret != nil,
+		"fromEnv":  tpb.FromEnv != "",
+		"fromFile": tpb.FromFile != "",
+		"fromData": tpb.FromData != nil,
+		"js":       tpb.JS != "",
+	} {
+		if have {
+			acc = append(acc, name)
+		}
+	}
+	if 1 < len(acc) {
+		sort.Strings(acc)
+		return fmt.Errorf("more than one source (%s)", strings.Join(acc, ", "))
+	}
+	return nil
+}
+
+// provide binds the parameter's value from its built-in source.
+func (tpb *TestParamBinding) provide(ctx *plaxDsl.Ctx, key string, bs *plaxDsl.Bindings) error {
+	sub := func(s string) (string, error) {
+		return bs.StringSub(ctx, s)
+	}
+
+	switch {
+	case tpb.FromEnv != "":
+		name, err := sub(tpb.FromEnv)
+		if err != nil {
+			return err
+		}
+		ctx.Logdf("Param %s from environment variable %s", key, name)
+		val, have := os.LookupEnv(name)
+		if !have {
+			return fmt.Errorf("environment variable %s isn't set", name)
+		}
+		bs.SetKeyValue(key, val)
+
+	case tpb.FromFile != "":
+		filename, err := sub(tpb.FromFile)
+		if err != nil {
+			return err
+		}
+		ctx.Logdf("Param %s from file %s", key, filename)
+		bytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		bs.SetKeyValue(key, strings.TrimSuffix(string(bytes), "\n"))
+
+	case tpb.FromData != nil:
+		filename, err := sub(tpb.FromData.File)
+		if err != nil {
+			return err
+		}
+		path, err := sub(tpb.FromData.Key)
+		if err != nil {
+			return err
+		}
+		ctx.Logdf("Param %s from %s in %s", key, path, filename)
+		bytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		var x interface{}
+		if err := yaml.Unmarshal(bytes, &x); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		if x, err = dataAt(x, path); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		(*bs)[key] = x
+
+	case tpb.JS != "":
+		src, err := sub(tpb.JS)
+		if err != nil {
+			return err
+		}
+		ctx.Logdf("Param %s from Javascript", key)
+		x, err := plaxDsl.JSExec(ctx, src, map[string]interface{}{
+			"bs": *bs,
+		})
+		if err != nil {
+			return err
+		}
+		(*bs)[key] = x
+	}
+
+	return nil
+}
+
+// dataAt returns the value at the dot-separated path in x.
+func dataAt(x interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return x, nil
+	}
+	at := x
+	for _, k := range strings.Split(path, ".") {
+		switch vv := at.(type) {
+		case map[string]interface{}:
+			v, have := vv[k]
+			if !have {
+				return nil, fmt.Errorf("no '%s' in '%s'", k, path)
+			}
+			at = v
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || len(vv) <= i {
+				return nil, fmt.Errorf("bad index '%s' in '%s'", k, path)
+			}
+			at = vv[i]
+		default:
+			return nil, fmt.Errorf("can't get '%s' in '%s' from a %T", k, path, at)
+		}
+	}
+	return at, nil
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	plaxDsl "github.com/Comcast/plax/dsl"
+)
+
+func TestParamPrecedence(t *testing.T) {
+	var (
+		ctx = plaxDsl.NewCtx(nil)
+		tr  = TestRun{
+			trps: &TestRunParams{
+				Bindings: plaxDsl.Bindings{
+					"CLI": "cli",
+				},
+			},
+		}
+		bs = plaxDsl.Bindings{
+			"CLI": "cli",
+		}
+	)
+
+	group := TestParamMap{
+		"CLI":   "group",
+		"GROUP": "group",
+		"TEST":  "group",
+	}
+	if err := group.bind(ctx, tr, &bs); err != nil {
+		t.Fatal(err)
+	}
+
+	test := TestParamMap{
+		"CLI":  "test",
+		"TEST": "test",
+	}
+	if err := test.bind(ctx, tr, &bs); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, want := range map[string]string{
+		"CLI":   "cli",
+		"GROUP": "group",
+		"TEST":  "test",
+	} {
+		if got := bs[k]; got != want {
+			t.Fatalf("%s: %v != %v", k, got, want)
+		}
+	}
+}
+
+func TestParamCaching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plaxrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		ctx     = plaxDsl.NewCtx(nil)
+		counter = filepath.Join(dir, "runs")
+		cache   = &TestParamCache{}
+		tpb     = TestParamBinding{
+			Cmd:   "sh",
+			Args:  []string{"-c", `echo run >> "$COUNTER"; echo "$KEY=$VALUE"`},
+			Envs:  TestParamEnvMap{"COUNTER": counter, "VALUE": "{?V}"},
+			Cache: cache,
+		}
+	)
+
+	runs := func() int {
+		bs, err := ioutil.ReadFile(counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(bs), "run")
+	}
+
+	process := func(v string) interface{} {
+		bs := plaxDsl.Bindings{"?V": v}
+		if err := tpb.process(ctx, "TOKEN", nil, &bs); err != nil {
+			t.Fatal(err)
+		}
+		return bs["TOKEN"]
+	}
+
+	defer func(pc *paramCache) {
+		theParamCache = pc
+	}(theParamCache)
+	theParamCache = newParamCache()
+
+	if got := process("a"); got != "a" {
+		t.Fatal(got)
+	}
+	if got := process("a"); got != "a" {
+		t.Fatal(got)
+	}
+	if n := runs(); n != 1 {
+		t.Fatal(n)
+	}
+
+	// A different environment is a different key.
+	if got := process("b"); got != "b" {
+		t.Fatal(got)
+	}
+	if n := runs(); n != 2 {
+		t.Fatal(n)
+	}
+
+	// Expired.
+	cache.TTL = "1ns"
+	time.Sleep(time.Millisecond)
+	process("a")
+	if n := runs(); n != 3 {
+		t.Fatal(n)
+	}
+
+	cache.TTL = "bad"
+	bs := plaxDsl.Bindings{"?V": "a"}
+	if err := tpb.process(ctx, "TOKEN", nil, &bs); err == nil {
+		t.Fatal("expected protest")
+	}
+
+	// A cache file survives a new (in-memory) cache.
+	cache.TTL = "1h"
+	cache.File = filepath.Join(dir, "cache", "params.json")
+	process("c")
+	if n := runs(); n != 4 {
+		t.Fatal(n)
+	}
+	theParamCache = newParamCache()
+	if got := process("c"); got != "c" {
+		t.Fatal(got)
+	}
+	if n := runs(); n != 4 {
+		t.Fatal(n)
+	}
+	info, err := os.Stat(cache.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("%o", mode)
+	}
+}
+
+func TestParamTimeoutRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plaxrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := plaxDsl.NewCtx(nil)
+
+	slow := TestParamBinding{
+		Cmd:     "sh",
+		Args:    []string{"-c", `sleep 5 2>/dev/null; echo "$KEY=slow"`},
+		Timeout: "100ms",
+	}
+	then := time.Now()
+	bs := plaxDsl.Bindings{}
+	err = slow.process(ctx, "SLOW", nil, &bs)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatal(err)
+	}
+	if elapsed := time.Now().Sub(then); 2*time.Second < elapsed {
+		t.Fatal(elapsed)
+	}
+
+	// Fails the first two times.
+	flaky := TestParamBinding{
+		Cmd: "sh",
+		Args: []string{"-c", `echo run >> "$COUNTER"
+if [ $(wc -l < "$COUNTER") -lt 3 ]; then exit 1; fi
+echo "$KEY=ok"`},
+		Envs:       TestParamEnvMap{"COUNTER": filepath.Join(dir, "runs")},
+		Retries:    2,
+		RetryDelay: "10ms",
+	}
+	if err := flaky.process(ctx, "FLAKY", nil, &bs); err != nil {
+		t.Fatal(err)
+	}
+	if got := bs["FLAKY"]; got != "ok" {
+		t.Fatal(got)
+	}
+
+	flaky.Envs["COUNTER"] = filepath.Join(dir, "more")
+	flaky.Retries = 1
+	if err := flaky.process(ctx, "FLAKIER", nil, &bs); err == nil {
+		t.Fatal("expected protest")
+	}
+}
+
+func TestParamParallel(t *testing.T) {
+	var (
+		ctx   = plaxDsl.NewCtx(nil)
+		sleep = func(value string) TestParamBinding {
+			return TestParamBinding{
+				Cmd:  "sh",
+				Args: []string{"-c", `sleep 0.3; echo "$KEY=` + value + `"`},
+			}
+		}
+		tr = TestRun{
+			Params: TestParamBindingMap{
+				"A": sleep("a"),
+				"B": sleep("b"),
+				"C": TestParamBinding{
+					DependsOn: TestParamDependencyList{"A", "B"},
+					Cmd:       "sh",
+					Args:      []string{"-c", `echo "$KEY=$X"`},
+					Envs:      TestParamEnvMap{"X": "{A}{B}"},
+				},
+				"D": sleep("d"),
+				"LOOP": TestParamBinding{
+					DependsOn: TestParamDependencyList{"POOL"},
+				},
+				"POOL": TestParamBinding{
+					DependsOn: TestParamDependencyList{"LOOP"},
+				},
+			},
+			trps: &TestRunParams{
+				ParamParallel: 4,
+			},
+		}
+		bs = plaxDsl.Bindings{}
+	)
+
+	then := time.Now()
+	if err := (TestParamDependencyList{"C", "D", "A"}).process(ctx, tr, &bs); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Now().Sub(then); 550*time.Millisecond < elapsed {
+		t.Fatal(elapsed)
+	}
+	for k, want := range map[string]string{
+		"A": "a",
+		"B": "b",
+		"C": "ab",
+		"D": "d",
+	} {
+		if got := bs[k]; got != want {
+			t.Fatalf("%s: %v != %v", k, got, want)
+		}
+	}
+
+	err := (TestParamDependencyList{"LOOP"}).process(ctx, tr, &bs)
+	if err == nil || !strings.Contains(err.Error(), "depends on itself") {
+		t.Fatal(err)
+	}
+}
+
+func TestParamSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plaxrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		ctx   = plaxDsl.NewCtx(nil)
+		token = filepath.Join(dir, "token")
+		data  = filepath.Join(dir, "config.yaml")
+	)
+
+	if err := ioutil.WriteFile(token, []byte("shh\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(data, []byte("db:\n  hosts:\n    - a.example.com\n    - b.example.com\n  port: 5432\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PLAXRUN_TEST_PORT", "8080")
+	defer os.Unsetenv("PLAXRUN_TEST_PORT")
+
+	bs := plaxDsl.Bindings{
+		"WHICH": "1",
+	}
+	for pk, tpb := range map[string]TestParamBinding{
+		"PORT":  {FromEnv: "PLAXRUN_TEST_PORT"},
+		"TOKEN": {FromFile: token},
+		"HOST":  {FromData: &TestParamData{File: data, Key: "db.hosts.{WHICH}"}},
+		"DB":    {FromData: &TestParamData{File: data, Key: "db"}},
+		"SUM":   {JS: "1 + bs.WHICH"},
+	} {
+		if err := tpb.process(ctx, pk, nil, &bs); err != nil {
+			t.Fatalf("%s: %s", pk, err)
+		}
+	}
+
+	for k, want := range map[string]string{
+		"PORT":  "8080",
+		"TOKEN": `"shh"`,
+		"HOST":  `"b.example.com"`,
+		"DB":    `{"hosts":["a.example.com","b.example.com"],"port":5432}`,
+		"SUM":   `"11"`,
+	} {
+		if got := plaxDsl.JSON(bs[k]); got != want {
+			t.Fatalf("%s: %s != %s", k, got, want)
+		}
+	}
+
+	for pk, tpb := range map[string]TestParamBinding{
+		"UNSET":   {FromEnv: "PLAXRUN_TEST_UNSET"},
+		"MISSING": {FromData: &TestParamData{File: data, Key: "db.users"}},
+		"INDEX":   {FromData: &TestParamData{File: data, Key: "db.hosts.2"}},
+		"BOTH":    {FromEnv: "PLAXRUN_TEST_PORT", Cmd: "echo"},
+	} {
+		if err := tpb.process(ctx, pk, nil, &bs); err == nil {
+			t.Fatalf("%s: expected protest", pk)
+		}
+	}
+}
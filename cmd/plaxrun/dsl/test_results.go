@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/invoke"
+)
+
+// resultSink is an invoke.EventSink that collects the results of
+// tests.  Events are passed on to the next sink (if any).
+type resultSink struct {
+	sync.Mutex
+
+	next    invoke.EventSink
+	results []*invoke.TestEventData
+}
+
+// results returns the TestRunParams' resultSink, which is installed
+// (in front of any existing sink) in Events if necessary.  The sink
+// needs to be installed before NewTestRun makes the tests.
+func (trps *TestRunParams) results() *resultSink {
+	if trps.sink != nil {
+		return trps.sink
+	}
+	trps.sink = &resultSink{}
+	if trps.Events == nil {
+		trps.Events = invoke.NewEmitter(trps.sink, "")
+	} else {
+		trps.sink.next = trps.Events.Sink
+		trps.Events.Sink = trps.sink
+	}
+	return trps.sink
+}
+
+// Send records the event's result (if any) and passes on the event.
+func (s *resultSink) Send(e *invoke.Event) error {
+	if e.Type == invoke.EventTestFinished {
+		if data, is := e.Data.(*invoke.TestEventData); is {
+			s.Lock()
+			s.results = append(s.results, data)
+			s.Unlock()
+		}
+	}
+	if s.next != nil {
+		return s.next.Send(e)
+	}
+	return nil
+}
+
+// Close closes the next sink (if any).
+func (s *resultSink) Close() error {
+	if s.next != nil {
+		return s.next.Close()
+	}
+	return nil
+}
+
+// take returns the results so far and then forgets them.
+func (s *resultSink) take() []*invoke.TestEventData {
+	s.Lock()
+	defer s.Unlock()
+	acc := s.results
+	s.results = nil
+	return acc
+}
+
+// TimingParams configure recording tests' durations and results in
+// an invoke.TimingDB.
+type TimingParams struct {
+	// DB is the filename for the TimingDB.
+	DB string
+	// Window is the number of recent runs to keep for each test.
+	Window int
+}
+
+// record adds the results to the TimingDB.  A test is identified by
+// its suite name and its filename relative to the working directory
+// (which is the test directory).
+func (ps *TimingParams) record(results []*invoke.TestEventData) error {
+	db, err := invoke.ReadTimingDB(ps.DB)
+	if err != nil {
+		return err
+	}
+	var (
+		now   = time.Now().UTC()
+		wd, _ = os.Getwd()
+	)
+	for _, r := range results {
+		filename := r.Filename
+		if rel, err := filepath.Rel(wd, filename); err == nil && wd != "" {
+			filename = rel
+		}
+		db.Add(r.Suite+":"+filename, invoke.TimingRun{
+			Time:     now,
+			Duration: r.Duration,
+			Result:   r.Result,
+		}, ps.Window)
+	}
+	return db.Write(ps.DB)
+}
@@ -29,6 +29,8 @@ import (
 	"github.com/Comcast/plax/cmd/plaxrun/async"
 
 	plaxDsl "github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+	"github.com/Comcast/plax/metrics"
 )
 
 // Ctx is the context type
@@ -50,8 +52,23 @@ type TestRun struct {
 	Tests   TestDefMap          `yaml:"tests"`
 	Groups  TestGroupMap        `yaml:"groups"`
 	Params  TestParamBindingMap `yaml:"params"`
-	trps    *TestRunParams
-	tfs     []*async.TaskFunc
+	Env     TestRunEnvMap       `yaml:"env"`
+	// Environments are named environments that the run can
+	// target.  See TestRunParams.Environment.
+	Environments TestRunEnvironmentMap `yaml:"environments"`
+	// Notify are notifications of the run's results.  See
+	// TestGroup.Notify.
+	Notify TestNotifyList `yaml:"notify,omitempty"`
+	trps   *TestRunParams
+	tfs    []*async.TaskFunc
+	// groupOf maps tasks' names to their top-level groups.
+	groupOf map[string]string
+	// html, when not nil, is the HTML report.  See
+	// TestRunParams.HTML.
+	html *invoke.HTMLReport
+	// paths maps each task to its test's absolute path.  See
+	// Watch.
+	paths map[*async.TaskFunc]string
 }
 
 // NewTestRun makes a new TestRun with the given TestRunParams
@@ -105,6 +122,24 @@ func NewTestRun(ctx *Ctx, trps *TestRunParams) (*TestRun, error) {
 
 	tr.trps = trps
 
+	if trps.Environment != "" {
+		if err := tr.useEnvironment(ctx.Ctx, trps.Environment, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	tr.paths = make(map[*async.TaskFunc]string)
+	tr.groupOf = make(map[string]string)
+
+	if trps.Timing != nil || tr.notifying() {
+		// The tests' emitter has to collect results.
+		trps.results()
+	}
+
+	if trps.HTML != "" {
+		tr.html = invoke.NewHTMLReport(fmt.Sprintf("%s-%s", tr.Name, tr.Version))
+	}
+
 	tfs, err := trps.Groups.getTaskFuncs(ctx.Ctx, tr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process test groups to execute: %w", err)
@@ -119,6 +154,10 @@ func NewTestRun(ctx *Ctx, trps *TestRunParams) (*TestRun, error) {
 
 	tr.tfs = append(tr.tfs, tfs...)
 
+	if trps.Shard != nil {
+		tr.tfs = trps.Shard.selectTasks(ctx.Ctx, tr.tfs)
+	}
+
 	return &tr, nil
 }
 
@@ -129,6 +168,25 @@ func (tr *TestRun) Exec(ctx *Ctx) error {
 		return fmt.Errorf("failed to execute tasks: %w", err)
 	}
 
+	if err := tr.writeHTML(); err != nil {
+		return err
+	}
+
+	var results []*invoke.TestEventData
+	if tr.trps.sink != nil {
+		results = tr.trps.sink.take()
+	}
+
+	if tr.trps.Timing != nil {
+		if err := tr.trps.Timing.record(results); err != nil {
+			return fmt.Errorf("failed to record timings: %w", err)
+		}
+	}
+
+	if tr.notifying() {
+		tr.notify(ctx.Ctx, results)
+	}
+
 	if taskResults.HasError() {
 		ctx.Logdf("TaskResult Error: %s", taskResults.Error())
 		return fmt.Errorf(taskResults.Error())
@@ -137,6 +195,17 @@ func (tr *TestRun) Exec(ctx *Ctx) error {
 	return nil
 }
 
+// writeHTML writes the HTML report (if any).
+func (tr *TestRun) writeHTML() error {
+	if tr.html == nil {
+		return nil
+	}
+	if err := tr.html.WriteFile(tr.trps.HTML); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
 // IncludeDirList are the directories to search when YAML-including.
 //
 // We make an explicit type to enable flag.Var to parse multiple
@@ -165,4 +234,69 @@ type TestRunParams struct {
 	EmitJSON    *bool
 	Verbose     *bool
 	LogLevel    *string
+	// HTML, when not empty, is the file for an HTML report.
+	HTML string
+	// NoNotify, when true, disables notifications.  See
+	// TestRun.Notify.
+	NoNotify bool
+	// Timing, when not nil, records tests' durations and results.
+	Timing *TimingParams
+	// Shard, when not nil, selects a partition of the tests.
+	Shard *TestShard
+	// Latency, when not nil, gates step latencies.
+	Latency *LatencyParams
+	// Metrics, when not nil, gets metrics for every test.  See
+	// invoke.Invocation.Metrics.
+	Metrics *metrics.Registry
+	// Profiles are files of channel profiles for every test.
+	// See plaxDsl.ChanProfile.
+	Profiles []string
+	// Labels are the labels (like "smoke" or "!slow") that tests
+	// must have.  See plaxDsl.LabelsMatch.
+	Labels []string
+	// ParamParallel is the maximum number of parameter commands
+	// to run at once.  When greater than one, parameters that
+	// don't depend on each other are processed concurrently.
+	ParamParallel int
+	// Environment, when not empty, names the run's environment to
+	// use.  See TestRun.Environments.
+	Environment string
+	// ChanOverlays are channel configurations by channel type for
+	// every test.  See plaxDsl.Ctx.ChanOverlays.
+	ChanOverlays map[plaxDsl.ChanKind]interface{}
+	// LogDir, when not empty, is a directory for each test's
+	// log.  See invoke.Invocation.LogDir.
+	LogDir string
+	// LogFormat is the format of the logs in LogDir.
+	LogFormat string
+	// KeepGoing, when true, reports a test that doesn't load as
+	// an error instead of exiting.  See invoke.Invocation.KeepGoing.
+	KeepGoing bool
+	// FailOnLeaks, when true, fails tests that leak channels or
+	// goroutines.  See invoke.Invocation.FailOnLeaks.
+	FailOnLeaks bool
+	// Events, when not nil, gets CloudEvents for every test.  See
+	// invoke.Invocation.Events.
+	Events *invoke.Emitter
+	// ShowParams, when true, writes each test's effective
+	// parameters to stderr and adds them to the test output.
+	ShowParams bool
+
+	// sink collects the tests' results.  See results().
+	sink *resultSink
+}
+
+// LatencyParams configure latency regression gating, which compares
+// each test's step latencies to their trailing baselines in a
+// history file.  See invoke.LatencyGate.
+type LatencyParams struct {
+	// DB is the filename for the latency history.
+	DB string
+	// Threshold is the percentage over the baseline that's a
+	// regression.
+	Threshold float64
+	// Window is the number of trailing runs in a baseline.
+	Window int
+	// Warn, when true, reports regressions without failing.
+	Warn bool
 }
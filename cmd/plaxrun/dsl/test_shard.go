@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Comcast/plax/cmd/plaxrun/async"
+	plaxDsl "github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+)
+
+// TestShard selects one of Count partitions of a run's tests, so a
+// large suite can be split across CI jobs.  Every job gets the same
+// partitions as long as the jobs select the same tests.
+type TestShard struct {
+	// Index is the partition (starting at 1) to run.
+	Index int
+	// Count is the number of partitions.
+	Count int
+	// Weights, when not empty, maps tests (by their suite names)
+	// to their durations in seconds.  Tests are then assigned to
+	// balance the partitions' total durations.  See
+	// ReadShardWeights.
+	Weights map[string]float64
+}
+
+// ParseTestShard parses "i/n" (like "2/3").
+func ParseTestShard(s string) (*TestShard, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("shard '%s' isn't i/n", s)
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("shard '%s' index: %w", s, err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("shard '%s' count: %w", s, err)
+	}
+	if n < 1 || i < 1 || n < i {
+		return nil, fmt.Errorf("shard '%s' needs 1 <= i <= n", s)
+	}
+	return &TestShard{
+		Index: i,
+		Count: n,
+	}, nil
+}
+
+// ReadShardWeights reads the durations of tests from reports (JUnit
+// XML or JSON) that plaxrun wrote.  A test's weight is the total
+// duration of its suite's test cases, with each test case counting
+// for at least a second.
+func ReadShardWeights(filenames ...string) (map[string]float64, error) {
+	ws := make(map[string]float64)
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		tss, err := invoke.ReadReports(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("report %s: %w", filename, err)
+		}
+		for _, ts := range tss {
+			if ts.Name == "" {
+				continue
+			}
+			var w float64
+			for _, tc := range ts.TestCases {
+				if tc.Time < 1 {
+					w++
+				} else {
+					w += float64(tc.Time)
+				}
+			}
+			// A later report replaces an earlier one.
+			ws[ts.Name] = w
+		}
+	}
+	return ws, nil
+}
+
+// selectTasks returns this shard's tasks in their original order.
+//
+// Without Weights, the tasks are sorted by name and dealt out in
+// turn.  With Weights, the heaviest remaining task goes to the
+// lightest partition (with ties going to the lower partition).  A
+// task without a weight gets the average weight of the tasks that
+// have one.
+func (s *TestShard) selectTasks(ctx *plaxDsl.Ctx, tfs []*async.TaskFunc) []*async.TaskFunc {
+	order := make([]int, len(tfs))
+	for i := range order {
+		order[i] = i
+	}
+
+	var (
+		weights = make([]float64, len(tfs))
+		known   = 0
+		total   = 0.0
+	)
+	for i, tf := range tfs {
+		if w, have := s.Weights[tf.Name]; have {
+			weights[i] = w
+			total += w
+			known++
+		}
+	}
+	if 0 < known {
+		avg := total / float64(known)
+		for i, tf := range tfs {
+			if _, have := s.Weights[tf.Name]; !have {
+				weights[i] = avg
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if weights[a] != weights[b] {
+			return weights[a] > weights[b]
+		}
+		return tfs[a].Name < tfs[b].Name
+	})
+
+	var (
+		loads = make([]float64, s.Count)
+		mine  = make([]bool, len(tfs))
+	)
+	for n, i := range order {
+		p := n % s.Count
+		if 0 < known {
+			p = 0
+			for q := range loads {
+				if loads[q] < loads[p] {
+					p = q
+				}
+			}
+			loads[p] += weights[i]
+		}
+		mine[i] = p == s.Index-1
+	}
+
+	acc := make([]*async.TaskFunc, 0, len(tfs)/s.Count+1)
+	for i, tf := range tfs {
+		if mine[i] {
+			acc = append(acc, tf)
+		}
+	}
+
+	ctx.Logf("Shard %d/%d runs %d of %d tests", s.Index, s.Count, len(acc), len(tfs))
+
+	return acc
+}
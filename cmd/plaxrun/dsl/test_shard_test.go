@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Comcast/plax/cmd/plaxrun/async"
+	plaxDsl "github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+	"github.com/Comcast/plax/junit"
+)
+
+func TestSharding(t *testing.T) {
+	ctx := plaxDsl.NewCtx(nil)
+
+	t.Run("parse", func(t *testing.T) {
+		s, err := ParseTestShard("2/3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Index != 2 || s.Count != 3 {
+			t.Fatal(s)
+		}
+		for _, bad := range []string{"", "2", "0/3", "4/3", "1/0", "a/3", "1/2/3"} {
+			if _, err := ParseTestShard(bad); err == nil {
+				t.Fatal(bad)
+			}
+		}
+	})
+
+	tfs := make([]*async.TaskFunc, 0, 7)
+	for i := 0; i < 7; i++ {
+		tfs = append(tfs, &async.TaskFunc{
+			Name: fmt.Sprintf("run-1:t%d", i),
+		})
+	}
+
+	// partition runs all of the shards and checks that every task
+	// is in exactly one shard (and in its original order).
+	partition := func(t *testing.T, n int, ws map[string]float64) [][]string {
+		var (
+			seen = make(map[string]bool)
+			acc  = make([][]string, 0, n)
+		)
+		for i := 1; i <= n; i++ {
+			s := &TestShard{
+				Index:   i,
+				Count:   n,
+				Weights: ws,
+			}
+			var names []string
+			for _, tf := range s.selectTasks(ctx, tfs) {
+				if seen[tf.Name] {
+					t.Fatalf("%s in more than one shard", tf.Name)
+				}
+				seen[tf.Name] = true
+				if 0 < len(names) && tf.Name < names[len(names)-1] {
+					t.Fatalf("%s out of order", tf.Name)
+				}
+				names = append(names, tf.Name)
+			}
+			acc = append(acc, names)
+		}
+		if len(seen) != len(tfs) {
+			t.Fatal(seen)
+		}
+		return acc
+	}
+
+	t.Run("unweighted", func(t *testing.T) {
+		ps := partition(t, 3, nil)
+		if len(ps[0]) != 3 || len(ps[1]) != 2 || len(ps[2]) != 2 {
+			t.Fatal(ps)
+		}
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		ws := map[string]float64{
+			"run-1:t0": 60,
+			"run-1:t1": 10,
+			"run-1:t2": 10,
+			"run-1:t3": 10,
+			"run-1:t4": 10,
+			// t5 and t6 get the average (20), and the
+			// shards each get 70.
+		}
+		ps := partition(t, 2, ws)
+		if fmt.Sprint(ps) != "[[run-1:t0 run-1:t3] [run-1:t1 run-1:t2 run-1:t4 run-1:t5 run-1:t6]]" {
+			t.Fatal(ps)
+		}
+	})
+
+	t.Run("weights", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "plaxrun")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		var buf bytes.Buffer
+		for _, c := range []struct {
+			name  string
+			times []int64
+		}{
+			{"run-1:t0", []int64{0, 5}},
+			{"run-1:t1", []int64{0}},
+		} {
+			ts := junit.NewTestSuite()
+			ts.Name = c.name
+			for _, d := range c.times {
+				tc := junit.NewTestCase("x")
+				tc.Time = d
+				ts.Add(*tc)
+			}
+			if err := invoke.WriteReport(&buf, ts, nil, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		filename := filepath.Join(dir, "report.xml")
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		ws, err := ReadShardWeights(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ws) != 2 || ws["run-1:t0"] != 6 || ws["run-1:t1"] != 1 {
+			t.Fatal(ws)
+		}
+	})
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/cmd/plaxrun/async"
+	"github.com/Comcast/plax/invoke"
+)
+
+// DefaultWatchInterval is how often Watch looks for changes.
+var DefaultWatchInterval = time.Second
+
+// Watch runs the tests that the TestRunParams specify and then
+// watches the test directory and the run file's directory.  When
+// files change, Watch runs the tests again.  If every changed file
+// is part of some test (for example, a spec in a test's directory),
+// Watch only runs those tests.  Otherwise (for example, when the run
+// file changes) Watch runs all of the tests.
+//
+// After each run, Watch writes a summary to w.  Tests' reports still
+// go to stdout.
+//
+// A test that doesn't load (see TestRunParams.KeepGoing) or a run
+// file that doesn't parse is reported without stopping Watch, which
+// only returns when the context is done.
+func Watch(ctx context.Context, trps *TestRunParams, interval time.Duration, w io.Writer) error {
+	// NewTestRun changes the working directory, so we need
+	// absolute paths.
+	for _, p := range []*string{trps.Filename, trps.Dir} {
+		if p == nil {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return err
+		}
+		*p = abs
+	}
+
+	if trps.Dir == nil || trps.Filename == nil {
+		return fmt.Errorf("watching requires TestRunParams.Dir and Filename")
+	}
+
+	trps.KeepGoing = true
+
+	sink := trps.results()
+
+	roots := []string{*trps.Dir}
+	if dir := filepath.Dir(*trps.Filename); dir != *trps.Dir {
+		roots = append(roots, dir)
+	}
+
+	// nil means everything changed.
+	var changed []string
+
+	for {
+		watchRun(ctx, trps, sink, changed, w)
+
+		// Files that the run itself wrote are in this
+		// snapshot, so they don't trigger another run.
+		before := takeWatchSnapshot(roots)
+		fmt.Fprintf(w, "Watching %s for changes\n", strings.Join(roots, ", "))
+
+		for changed = nil; len(changed) == 0; {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+			changed = before.changes(takeWatchSnapshot(roots))
+		}
+
+		fmt.Fprintf(w, "\nChanged: %s\n", strings.Join(changed, ", "))
+	}
+}
+
+// watchRun runs the tests affected by the changed files (or all tests
+// if changed is nil) and writes a summary to w.
+func watchRun(ctx context.Context, trps *TestRunParams, sink *resultSink, changed []string, w io.Writer) {
+	var (
+		c    = NewCtx(ctx)
+		then = time.Now()
+	)
+
+	sink.take()
+
+	tr, err := NewTestRun(c, trps)
+	if err != nil {
+		fmt.Fprintf(w, "Test run broken: %s\n", err)
+		return
+	}
+
+	tfs := tr.affected(changed)
+	if len(tfs) == 0 {
+		fmt.Fprintf(w, "No tests affected\n")
+		return
+	}
+
+	trs, err := async.Sequential(c, tfs...)
+	if err != nil {
+		fmt.Fprintf(w, "Test run broken: %s\n", err)
+		return
+	}
+
+	results := sink.take()
+	writeWatchSummary(w, results, time.Now().Sub(then))
+
+	if err := tr.writeHTML(); err != nil {
+		fmt.Fprintf(w, "%s\n", err)
+	}
+
+	// A task can fail without any test reporting a problem (for
+	// example, when a test's directory doesn't exist).
+	if trs.HasError() && countWatchResults(results)["passed"] == len(results) {
+		fmt.Fprintf(w, "  %s\n", trs.Error())
+	}
+}
+
+// affected returns the tasks for the tests whose paths contain a
+// changed file.  If a changed file isn't in any test's path, or if
+// changed is nil, all of the tasks are affected.
+func (tr *TestRun) affected(changed []string) []*async.TaskFunc {
+	if changed == nil {
+		return tr.tfs
+	}
+
+	for _, name := range changed {
+		hit := false
+		for _, tf := range tr.tfs {
+			if within(name, tr.paths[tf]) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return tr.tfs
+		}
+	}
+
+	acc := make([]*async.TaskFunc, 0, len(tr.tfs))
+	for _, tf := range tr.tfs {
+		for _, name := range changed {
+			if within(name, tr.paths[tf]) {
+				acc = append(acc, tf)
+				break
+			}
+		}
+	}
+	return acc
+}
+
+// within reports whether the file is the given path or is in the
+// directory at that path.
+func within(filename, path string) bool {
+	if path == "" {
+		return false
+	}
+	return filename == path || strings.HasPrefix(filename, path+string(filepath.Separator))
+}
+
+// watchStamp is what Watch knows about a file.
+type watchStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// watchSnapshot maps filenames to their watchStamps.
+type watchSnapshot map[string]watchStamp
+
+// takeWatchSnapshot walks the given directories.  Hidden files and
+// directories (like .git) are ignored, and so are errors (since a
+// file can disappear during the walk).
+func takeWatchSnapshot(roots []string) watchSnapshot {
+	s := make(watchSnapshot)
+	for _, root := range roots {
+		filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path != root && strings.HasPrefix(fi.Name(), ".") {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !fi.IsDir() {
+				s[path] = watchStamp{
+					mod:  fi.ModTime(),
+					size: fi.Size(),
+				}
+			}
+			return nil
+		})
+	}
+	return s
+}
+
+// changes returns the sorted names of the files that were added,
+// removed, or modified between s and later.
+func (s watchSnapshot) changes(later watchSnapshot) []string {
+	acc := make([]string, 0)
+	for name, stamp := range later {
+		if was, have := s[name]; !have || !was.mod.Equal(stamp.mod) || was.size != stamp.size {
+			acc = append(acc, name)
+		}
+	}
+	for name := range s {
+		if _, have := later[name]; !have {
+			acc = append(acc, name)
+		}
+	}
+	sort.Strings(acc)
+	return acc
+}
+
+// countWatchResults counts results by their Result ("passed",
+// "failed", "error", or "skipped").
+func countWatchResults(results []*invoke.TestEventData) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Result]++
+	}
+	return counts
+}
+
+// writeWatchSummary writes a line with counts followed by a line for
+// each test that didn't pass.
+func writeWatchSummary(w io.Writer, results []*invoke.TestEventData, d time.Duration) {
+	counts := countWatchResults(results)
+	fmt.Fprintf(w, "\n%s  %d passed, %d failed, %d errors, %d skipped (%s)\n",
+		time.Now().Format("15:04:05"),
+		counts["passed"], counts["failed"], counts["error"], counts["skipped"],
+		d.Round(time.Millisecond))
+
+	for _, r := range results {
+		if r.Result == "passed" {
+			continue
+		}
+		msg := strings.SplitN(strings.TrimSpace(r.Message), "\n", 2)[0]
+		fmt.Fprintf(w, "  %-7s %s (%s)", strings.ToUpper(r.Result), r.Test, r.Suite)
+		if msg != "" {
+			fmt.Fprintf(w, ": %s", msg)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
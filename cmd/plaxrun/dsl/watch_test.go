@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/cmd/plaxrun/async"
+	"github.com/Comcast/plax/invoke"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plaxrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		a      = filepath.Join(dir, "a.yaml")
+		b      = filepath.Join(dir, "b", "spec.yaml")
+		run    = filepath.Join(dir, "run.yaml")
+		hidden = filepath.Join(dir, ".git", "index")
+	)
+	for _, filename := range []string{a, b, run, hidden} {
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("snapshot", func(t *testing.T) {
+		before := takeWatchSnapshot([]string{dir})
+		if len(before) != 3 {
+			t.Fatal(before)
+		}
+
+		if err := ioutil.WriteFile(a, []byte("xx"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(hidden, []byte("xx"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(run); err != nil {
+			t.Fatal(err)
+		}
+
+		got := before.changes(takeWatchSnapshot([]string{dir}))
+		if strings.Join(got, ",") != a+","+run {
+			t.Fatal(got)
+		}
+	})
+
+	t.Run("affected", func(t *testing.T) {
+		var (
+			ta = &async.TaskFunc{Name: "a"}
+			tb = &async.TaskFunc{Name: "b"}
+			tr = &TestRun{
+				tfs: []*async.TaskFunc{ta, tb},
+				paths: map[*async.TaskFunc]string{
+					ta: a,
+					tb: filepath.Dir(b),
+				},
+			}
+		)
+
+		names := func(tfs []*async.TaskFunc) string {
+			acc := make([]string, 0, len(tfs))
+			for _, tf := range tfs {
+				acc = append(acc, tf.Name)
+			}
+			return strings.Join(acc, ",")
+		}
+
+		for _, c := range []struct {
+			changed []string
+			want    string
+		}{
+			{nil, "a,b"},
+			{[]string{a}, "a"},
+			{[]string{b}, "b"},
+			{[]string{filepath.Join(dir, "b", "lib.js")}, "b"},
+			{[]string{filepath.Join(dir, "bb.yaml")}, "a,b"},
+			{[]string{a, run}, "a,b"},
+		} {
+			if got := names(tr.affected(c.changed)); got != c.want {
+				t.Fatalf("%v: %s", c.changed, got)
+			}
+		}
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		var (
+			next = &resultSink{}
+			sink = &resultSink{next: next}
+			e    = invoke.NewEmitter(sink, "")
+		)
+		for _, d := range []*invoke.TestEventData{
+			{Suite: "s", Test: "a", Result: "passed"},
+			{Suite: "s", Test: "b", Result: "failed", Message: "nope\nmore"},
+			{Suite: "s", Test: "c", Result: "error", Message: "broken"},
+		} {
+			e.Emit(invoke.EventTestFinished, d.Test, d)
+		}
+		e.Emit(invoke.EventTestStarted, "d", &invoke.TestEventData{Test: "d"})
+
+		if len(next.take()) != 3 {
+			t.Fatal("events weren't passed on")
+		}
+
+		var buf bytes.Buffer
+		writeWatchSummary(&buf, sink.take(), time.Second)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatal(buf.String())
+		}
+		if !strings.HasSuffix(lines[0], "1 passed, 1 failed, 1 errors, 0 skipped (1s)") {
+			t.Fatal(lines[0])
+		}
+		if lines[1] != "  FAILED  b (s): nope" {
+			t.Fatal(lines[1])
+		}
+		if lines[2] != "  ERROR   c (s): broken" {
+			t.Fatal(lines[2])
+		}
+		if len(sink.take()) != 0 {
+			t.Fatal("results weren't taken")
+		}
+	})
+}
@@ -22,9 +22,16 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	plaxDsl "github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/invoke"
+	"github.com/Comcast/plax/kv"
+	"github.com/Comcast/plax/metrics"
 
 	"github.com/Comcast/plax/cmd/plaxrun/dsl"
 	_ "github.com/Comcast/plax/cmd/plaxrun/plugins"
@@ -36,7 +43,19 @@ const Version = "1.0.0"
 func main() {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Fatalf("failed to get current working directory: %w", err)
+		log.Fatalf("failed to get current working directory: %s", err)
+	}
+
+	// Subcommands
+	if 1 < len(os.Args) {
+		switch os.Args[1] {
+		case "merge-reports":
+			// plaxrun merge-reports [FLAGS] FILE...
+			os.Exit(mergeReports(os.Args[2:]))
+		case "timing-report":
+			// plaxrun timing-report [FLAGS]
+			os.Exit(timingReport(os.Args[2:]))
+		}
 	}
 
 	var (
@@ -50,26 +69,202 @@ func main() {
 			Verbose:     flag.Bool("v", true, "Verbosity"),
 			LogLevel:    flag.String("log", "info", "Log level (info, debug, none)"),
 		}
-		version = flag.Bool("version", false, "Print version and then exit")
+		latencyDB        = flag.String("latency-db", "", "Gate step latencies against their history in this file (created if necessary)")
+		latencyThreshold = flag.Float64("latency-threshold", 50, "Percentage over a step's latency baseline that's a regression")
+		latencyWindow    = flag.Int("latency-window", invoke.DefaultLatencyWindow, "Number of trailing runs in a latency baseline")
+		latencyWarn      = flag.Bool("latency-warn", false, "Only warn about (rather than fail) latency regressions")
+		notify           = flag.Bool("notify", true, "Send the run file's notifications")
+		htmlReport       = flag.String("html", "", "Also write an HTML report (with step traces and timings) to this file")
+		timingDB         = flag.String("timing-db", "", "Record tests' durations and results in this file (created if necessary); see 'plaxrun timing-report'")
+		timingWindow     = flag.Int("timing-window", invoke.DefaultTimingWindow, "Number of recent runs to keep for each test in -timing-db")
+		version          = flag.Bool("version", false, "Print version and then exit")
+		logFormat        = flag.String("log-format", "text", "Log format (text, json)")
+		logSink          = flag.String("log-sink", "stderr", "Log destination (stderr, stdout, syslog, syslog:TAG, or a filename)")
+		logDir           = flag.String("log-dir", "", "Write each test's log to its own file (with an index.jsonl) in this directory")
+		serve            = flag.String("serve", "", "Server mode: serve the shared key-value store at this address (e.g., ':8080')")
+		profiles         = dsl.IncludeDirList{}
+		environment      = flag.String("env", "", "Environment (from the run file's environments) to use")
+		labels           = flag.String("labels", "", "Only run tests with these labels (comma-separated; '!LABEL' excludes LABEL)")
+		paramParallel    = flag.Int("param-parallel", 1, "Maximum number of param commands to run at once")
+		metricsAddr      = flag.String("metrics", "", "Serve Prometheus metrics at this address (e.g., ':9090') under /metrics")
+		metricsPush      = flag.String("metrics-push", "", "Push Prometheus metrics to this Pushgateway URL when the run finishes")
+		metricsJob       = flag.String("metrics-job", "plaxrun", "Pushgateway job name for -metrics-push")
+		events           = flag.String("events", "", "Send CloudEvents for test lifecycle events to this sink (http(s)://..., kafka://PROXY/TOPIC, or file:FILENAME)")
+		eventSource      = flag.String("event-source", invoke.DefaultEventSource, "CloudEvents source for -events")
+		plugins          = flag.String("plugins", "", "Load channel plugins from this directory")
+		shard            = flag.String("shard", "", "Only run this partition (like '2/3') of the selected tests")
+		showParams       = flag.Bool("show-params", false, "Write each test's effective parameters to stderr and add them to the test output")
+		shardWeights     = dsl.IncludeDirList{}
+		watch            = flag.Bool("watch", false, "Watch mode: run again (only affected tests when possible) whenever a test or run file changes")
+		watchInterval    = flag.Duration("watch-interval", dsl.DefaultWatchInterval, "How often -watch looks for changes")
+		failOnLeaks      = flag.Bool("fail-on-leaks", false, "Fail tests that leak channels or goroutines")
 	)
 
 	flag.Var(&trps.Bindings, "p", fmt.Sprintf("Parameter Bindings: %s", trps.Bindings.String()))
 	flag.Var(&trps.IncludeDirs, "I", "YAML include directories")
 	flag.Var(&trps.Groups, "g", fmt.Sprintf("Groups to execute: %s", trps.Groups.String()))
+	flag.Var(&profiles, "profiles", "File of channel profiles")
+	flag.Var(&shardWeights, "shard-weights", "Report (from a previous run) with test durations for balancing -shard")
 	flag.Var(&trps.Tests, "t", fmt.Sprintf("Tests to execute: %s", trps.Tests.String()))
 
 	flag.Parse()
 
+	if err := plaxDsl.ConfigureLogging(*logFormat, *logSink); err != nil {
+		log.Fatal(err)
+	}
+
 	log.Printf("plax version %s", Version)
 
 	if *version {
 		return
 	}
 
+	if _, err := plaxDsl.LoadPluginsFromEnv(plaxDsl.NewCtx(nil)); err != nil {
+		log.Fatal(err)
+	}
+
+	if *plugins != "" {
+		kinds, err := plaxDsl.LoadPlugins(plaxDsl.NewCtx(nil), *plugins)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Plugins registered channel types %v", kinds)
+	}
+
+	if *latencyDB != "" {
+		// Relative to the working directory (rather than the
+		// test directory).
+		filename, err := filepath.Abs(*latencyDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trps.Latency = &dsl.LatencyParams{
+			DB:        filename,
+			Threshold: *latencyThreshold,
+			Window:    *latencyWindow,
+			Warn:      *latencyWarn,
+		}
+	}
+
+	if *htmlReport != "" {
+		// Relative to the working directory (rather than the
+		// test directory).
+		if trps.HTML, err = filepath.Abs(*htmlReport); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *timingDB != "" {
+		// Relative to the working directory (rather than the
+		// test directory).
+		filename, err := filepath.Abs(*timingDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trps.Timing = &dsl.TimingParams{
+			DB:     filename,
+			Window: *timingWindow,
+		}
+	}
+
+	trps.FailOnLeaks = *failOnLeaks
+
+	if *logDir != "" {
+		dir, err := filepath.Abs(*logDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trps.LogDir = dir
+		trps.LogFormat = *logFormat
+	}
+
+	if *shard != "" {
+		if trps.Shard, err = dsl.ParseTestShard(*shard); err != nil {
+			log.Fatal(err)
+		}
+		if 0 < len(shardWeights) {
+			if trps.Shard.Weights, err = dsl.ReadShardWeights(shardWeights...); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	trps.NoNotify = !*notify
+	trps.Environment = *environment
+	trps.ParamParallel = *paramParallel
+	trps.ShowParams = *showParams
+
+	for _, label := range strings.Split(*labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			trps.Labels = append(trps.Labels, label)
+		}
+	}
+
+	for _, filename := range profiles {
+		// Relative to the working directory (rather than the
+		// test directory).
+		filename, err := filepath.Abs(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trps.Profiles = append(trps.Profiles, filename)
+	}
+
+	if *serve != "" {
+		// Server mode: Serve the shared key-value store that
+		// 'kv' channels can use (via their URL option).
+		l, err := net.Listen("tcp", *serve)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving key-value store at %s", l.Addr())
+		done := make(chan error, 1)
+		go func() {
+			done <- http.Serve(l, kv.Handler(kv.Default))
+		}()
+		if len(trps.Groups) == 0 && len(trps.Tests) == 0 {
+			// Just serve.
+			log.Fatal(<-done)
+		}
+	}
+
 	if len(trps.Groups) == 0 && len(trps.Tests) == 0 {
 		log.Fatal(fmt.Errorf("at least 1 test or test group must be specified"))
 	}
 
+	if *metricsAddr != "" || *metricsPush != "" {
+		trps.Metrics = metrics.NewRegistry()
+	}
+
+	if *metricsAddr != "" {
+		l, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving metrics at %s/metrics", l.Addr())
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(trps.Metrics))
+		go func() {
+			log.Fatal(http.Serve(l, mux))
+		}()
+	}
+
+	if *events != "" {
+		sink, err := invoke.OpenEventSink(*events)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trps.Events = invoke.NewEmitter(sink, *eventSource)
+		defer trps.Events.Close()
+	}
+
+	if *watch {
+		if err := dsl.Watch(context.Background(), trps, *watchInterval, os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	ctx := dsl.NewCtx(context.Background())
 
 	testRun, err := dsl.NewTestRun(ctx, trps)
@@ -78,6 +273,14 @@ func main() {
 	}
 
 	err = testRun.Exec(ctx)
+	plaxDsl.ClosePlugins(plaxDsl.NewCtx(nil))
+
+	if *metricsPush != "" {
+		if err := metrics.Push(trps.Metrics, *metricsPush, *metricsJob); err != nil {
+			log.Printf("metrics push failed: %s", err)
+		}
+	}
+
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/Comcast/plax/invoke"
+	"github.com/Comcast/plax/junit"
+)
+
+// mergeReports implements 'plaxrun merge-reports [FLAGS] FILE...',
+// which merges JSON and/or JUnit XML reports (for example, from
+// shards) into one report.  The result is the exit code.
+func mergeReports(args []string) int {
+	var (
+		fs       = flag.NewFlagSet("merge-reports", flag.ExitOnError)
+		emitJSON = fs.Bool("json", false, "Emit JSON test output; instead of JUnit XML")
+		out      = fs.String("o", "-", "Output filename ('-' for stdout)")
+		name     = fs.String("test-suite", "NA", "Name for the merged test suite")
+		nonzero  = fs.Bool("error-exit-code", false, "Return non-zero if any merged test failed")
+		owners   = fs.String("owners", "", "Also write the failures grouped by owner as JSON to this file")
+		notify   = fs.String("owner-notifications", "", "Also write a JSON notification for each owner with failures to this directory")
+	)
+	fs.Parse(args)
+
+	filenames := fs.Args()
+	if len(filenames) == 0 {
+		filenames = []string{"-"}
+	}
+
+	var suites []*junit.TestSuite
+	for _, filename := range filenames {
+		var r io.Reader = os.Stdin
+		if filename != "-" {
+			f, err := os.Open(filename)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			r = f
+		}
+		tss, err := invoke.ReadReports(r)
+		if err != nil {
+			log.Fatalf("report %s: %s", filename, err)
+		}
+		suites = append(suites, tss...)
+	}
+
+	var (
+		merged             = junit.Merge(*name, suites...)
+		problems           = invoke.ProblemsOf(merged)
+		w        io.Writer = os.Stdout
+	)
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := invoke.WriteReport(w, merged, problems.Categories, *emitJSON); err != nil {
+		log.Fatal(err)
+	}
+
+	if *owners != "" {
+		js, err := json.MarshalIndent(invoke.FailuresByOwner(merged), "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = ioutil.WriteFile(*owners, js, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *notify != "" {
+		ns := invoke.OwnerNotifications(merged)
+		if err := invoke.WriteOwnerNotifications(*notify, ns); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote %d owner notification(s) to %s", len(ns), *notify)
+	}
+
+	log.Printf("merged %d report(s): %d tests, %d failures, %d errors, %d skipped",
+		len(suites), merged.Tests, merged.Failures, merged.Errors, merged.Skipped)
+
+	if *nonzero && problems.First != "" {
+		return problems.ExitCode()
+	}
+	return 0
+}
@@ -23,7 +23,9 @@ import (
 
 	// Import required to dynamically register channels
 	_ "github.com/Comcast/plax/chans"
+	// Import required to dynamically register secret providers
 	plaxInvoke "github.com/Comcast/plax/invoke"
+	_ "github.com/Comcast/plax/secrets"
 
 	"github.com/Comcast/plax/cmd/plaxrun/dsl"
 )
@@ -96,6 +98,81 @@ func init() {
 
 			retry, err := def.GetPluginDefRetry()
 
+			instances, err := def.GetPluginDefInstances()
+			if err != nil {
+				return nil, err
+			}
+
+			emitParams, err := def.GetPluginDefEmitParams()
+			if err != nil {
+				return nil, err
+			}
+
+			env, err := def.GetPluginDefEnv()
+			if err != nil {
+				return nil, err
+			}
+
+			latency, err := def.GetPluginDefLatency()
+			if err != nil {
+				return nil, err
+			}
+
+			owners, err := def.GetPluginDefOwners()
+			if err != nil {
+				return nil, err
+			}
+
+			registry, err := def.GetPluginDefMetrics()
+			if err != nil {
+				return nil, err
+			}
+
+			profiles, err := def.GetPluginDefProfiles()
+			if err != nil {
+				return nil, err
+			}
+
+			extraLabels, err := def.GetPluginDefExtraLabels()
+			if err != nil {
+				return nil, err
+			}
+
+			overlays, err := def.GetPluginDefChanOverlays()
+			if err != nil {
+				return nil, err
+			}
+
+			logDir, err := def.GetPluginDefLogDir()
+			if err != nil {
+				return nil, err
+			}
+
+			logFormat, err := def.GetPluginDefLogFormat()
+			if err != nil {
+				return nil, err
+			}
+
+			html, err := def.GetPluginDefHTML()
+			if err != nil {
+				return nil, err
+			}
+
+			keepGoing, err := def.GetPluginDefKeepGoing()
+			if err != nil {
+				return nil, err
+			}
+
+			failOnLeaks, err := def.GetPluginDefFailOnLeaks()
+			if err != nil {
+				return nil, err
+			}
+
+			events, err := def.GetPluginDefEvents()
+			if err != nil {
+				return nil, err
+			}
+
 			i := plaxInvoke.Invocation{
 				SuiteName:         name,
 				Bindings:          bps,
@@ -103,11 +180,34 @@ func init() {
 				Verbose:           verbose,
 				Priority:          priority,
 				Labels:            labels,
+				ExtraLabels:       extraLabels,
+				Owners:            owners,
 				LogLevel:          logLevel,
 				List:              list,
 				EmitJSON:          emitJSON,
 				NonzeroOnAnyError: nonZeroOnAnyError,
 				Retry:             retry,
+				Instances:         instances,
+				EmitParams:        emitParams,
+				Env:               env,
+				Metrics:           registry,
+				Profiles:          profiles,
+				ChanOverlays:      overlays,
+				LogDir:            logDir,
+				LogFormat:         logFormat,
+				Events:            events,
+				KeepGoing:         keepGoing,
+				FailOnLeaks:       failOnLeaks,
+				HTML:              html,
+			}
+
+			if latency != nil {
+				i.Latency = &plaxInvoke.LatencyGate{
+					Filename:  latency.DB,
+					Threshold: latency.Threshold,
+					Window:    latency.Window,
+					Warn:      latency.Warn,
+				}
 			}
 
 			i.Dir, err = def.GetPluginDefDir()
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Comcast/plax/invoke"
+)
+
+// timingReport implements 'plaxrun timing-report [FLAGS]', which
+// summarizes a timing DB (see -timing-db): the slowest tests, the
+// tests whose durations regressed, and the flaky tests.  The result
+// is the exit code.
+func timingReport(args []string) int {
+	var (
+		fs        = flag.NewFlagSet("timing-report", flag.ExitOnError)
+		db        = fs.String("db", "timing.json", "Timing DB (from -timing-db)")
+		top       = fs.Int("top", 10, "Maximum number of tests in each list (0 for all)")
+		threshold = fs.Float64("threshold", 50, "Percentage over a test's baseline that's a regression")
+		emitJSON  = fs.Bool("json", false, "Emit JSON rather than text")
+		nonzero   = fs.Bool("error-exit-code", false, "Return non-zero if any test's duration regressed")
+	)
+	fs.Parse(args)
+
+	tdb, err := invoke.ReadTimingDB(*db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := tdb.Report(invoke.TimingReportParams{
+		Top:       *top,
+		Threshold: *threshold,
+	})
+
+	if *emitJSON {
+		js, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(append(js, '\n'))
+	} else {
+		r.WriteText(os.Stdout)
+	}
+
+	if *nonzero && 0 < len(r.Regressions) {
+		return 1
+	}
+	return 0
+}
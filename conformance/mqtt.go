@@ -0,0 +1,413 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+// Package conformance generates suites of Plax tests that exercise
+// the behaviors of a service (like an MQTT broker).
+//
+// Each suite serves both as a conformance pack and as a set of
+// examples of Plax features.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// MQTTPack describes an MQTT broker conformance pack.
+type MQTTPack struct {
+	// BrokerURL is the broker's URL (like "tcp://localhost:1883").
+	BrokerURL string
+
+	// TopicPrefix is the prefix for all of the pack's topics.
+	//
+	// Defaults to DefaultMQTTTopicPrefix.
+	TopicPrefix string
+
+	// ClientPrefix is the prefix for all of the pack's MQTT
+	// client ids.
+	//
+	// Defaults to DefaultMQTTClientPrefix.
+	ClientPrefix string
+
+	// Timeout is the timeout for each recv.
+	//
+	// Defaults to DefaultMQTTTimeout.
+	Timeout string
+
+	// WillCommand is a command-line MQTT client (compatible with
+	// mosquitto_sub) that the will test kills ungracefully.
+	//
+	// Defaults to DefaultMQTTWillCommand.
+	WillCommand string
+}
+
+var (
+	// DefaultMQTTTopicPrefix is the default MQTTPack.TopicPrefix.
+	DefaultMQTTTopicPrefix = "plax/conformance"
+
+	// DefaultMQTTClientPrefix is the default MQTTPack.ClientPrefix.
+	DefaultMQTTClientPrefix = "plax-conformance"
+
+	// DefaultMQTTTimeout is the default MQTTPack.Timeout.
+	DefaultMQTTTimeout = "5s"
+
+	// DefaultMQTTWillCommand is the default MQTTPack.WillCommand.
+	DefaultMQTTWillCommand = "mosquitto_sub"
+)
+
+// mqttData is the data for the templates.
+type mqttData struct {
+	MQTTPack
+	Host, Port string
+	QoS        int
+}
+
+// Specs returns the pack's test specifications (as YAML) by
+// filename.
+func (p *MQTTPack) Specs() (map[string][]byte, error) {
+	if p.BrokerURL == "" {
+		return nil, fmt.Errorf("need a BrokerURL")
+	}
+	u, err := url.Parse(p.BrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("bad BrokerURL '%s': %w", p.BrokerURL, err)
+	}
+
+	d := mqttData{
+		MQTTPack: *p,
+		Host:     u.Hostname(),
+		Port:     u.Port(),
+	}
+	if d.TopicPrefix == "" {
+		d.TopicPrefix = DefaultMQTTTopicPrefix
+	}
+	if d.ClientPrefix == "" {
+		d.ClientPrefix = DefaultMQTTClientPrefix
+	}
+	if d.Timeout == "" {
+		d.Timeout = DefaultMQTTTimeout
+	}
+	if d.WillCommand == "" {
+		d.WillCommand = DefaultMQTTWillCommand
+	}
+	if d.Port == "" {
+		d.Port = "1883"
+	}
+
+	t, err := template.New("mqtt").Funcs(templateFuncs).Parse(mqttTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make(map[string][]byte)
+	execute := func(filename, name string, d mqttData) error {
+		var buf bytes.Buffer
+		buf.WriteString("# Generated by 'plax conformance mqtt'.\n\n")
+		if err := t.ExecuteTemplate(&buf, name, d); err != nil {
+			return err
+		}
+		specs[filename] = buf.Bytes()
+		return nil
+	}
+
+	for qos := 0; qos <= 2; qos++ {
+		d.QoS = qos
+		if err := execute(fmt.Sprintf("mqtt-qos%d.yaml", qos), "qos", d); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range []string{"retained", "session", "will"} {
+		if err := execute("mqtt-"+name+".yaml", name, d); err != nil {
+			return nil, err
+		}
+	}
+
+	return specs, nil
+}
+
+// Write writes the pack's specifications to the given directory
+// (which is created if necessary) and returns their filenames.
+func (p *MQTTPack) Write(dir string) ([]string, error) {
+	specs, err := p.Specs()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	filenames := make([]string, 0, len(specs))
+	for name := range specs {
+		filenames = append(filenames, filepath.Join(dir, name))
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		if err := ioutil.WriteFile(filename, specs[filepath.Base(filename)], 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return filenames, nil
+}
+
+// templateFuncs are the functions for templates.
+var templateFuncs = template.FuncMap{
+	// map makes a map from alternating keys and values.
+	"map": func(kvs ...interface{}) (map[string]interface{}, error) {
+		if len(kvs)%2 != 0 {
+			return nil, fmt.Errorf("map needs an even number of arguments")
+		}
+		m := make(map[string]interface{}, len(kvs)/2)
+		for i := 0; i < len(kvs); i += 2 {
+			k, is := kvs[i].(string)
+			if !is {
+				return nil, fmt.Errorf("map key %v isn't a string", kvs[i])
+			}
+			m[k] = kvs[i+1]
+		}
+		return m, nil
+	},
+	// seq returns 1, 2, ..., n.
+	"seq": func(n int) []int {
+		acc := make([]int, n)
+		for i := range acc {
+			acc[i] = i + 1
+		}
+		return acc
+	},
+}
+
+// mqttTemplates are the templates for the MQTT pack.
+//
+// Topics use the '?!PREFIX' binding, and the channels use the
+// '?!ENDPOINT' binding, so a test can be run against a different
+// broker with (for example) "-p '?!ENDPOINT=tcp://broker:1883'".
+var mqttTemplates = `
+{{define "header"}}labels:
+  - mqtt
+  - conformance
+bindings:
+  '?!ENDPOINT': '{{.BrokerURL}}'
+  '?!PREFIX': '{{.TopicPrefix}}'
+{{end}}
+
+{{define "make"}}        - pub:
+            doc: Ask Mother to make the '{{.name}}' channel.
+            chan: mother
+            payload:
+              make:
+                name: {{.name}}
+                type: mqtt
+                config:
+                  brokerurl: '?!ENDPOINT'
+                  clientid: {{.clientid}}
+{{- range $k, $v := .config}}
+                  {{$k}}: {{$v}}
+{{- end}}
+        - recv:
+            chan: mother
+            pattern:
+              success: true
+{{end}}
+
+{{define "qos"}}doc: |
+  MQTT conformance: QoS {{.QoS}} delivery.
+
+  A subscriber receives messages published at QoS {{.QoS}} in
+  order{{if eq .QoS 2}} and exactly once{{end}}.
+{{template "header" .}}spec:
+  phases:
+    phase1:
+      steps:
+{{template "make" (map "name" "subscriber" "clientid" (printf "%s-qos%d-sub" .ClientPrefix .QoS) "config" (map "qos" .QoS "cleansession" true))}}{{template "make" (map "name" "publisher" "clientid" (printf "%s-qos%d-pub" .ClientPrefix .QoS) "config" (map "qos" .QoS "cleansession" true))}}        - sub:
+            chan: subscriber
+            topic: '{?!PREFIX}/qos{{.QoS}}'
+{{- range $i := seq 3}}
+        - pub:
+            chan: publisher
+            topic: '{?!PREFIX}/qos{{$.QoS}}'
+            payload:
+              seq: {{$i}}
+{{- end}}
+{{- range $i := seq 3}}
+        - recv:
+            chan: subscriber
+            topic: '{?!PREFIX}/qos{{$.QoS}}'
+            pattern:
+              seq: {{$i}}
+            timeout: {{$.Timeout}}
+{{- end}}
+        - inspect:
+            doc: The messages arrived in order without duplicates.
+            chan: subscriber
+            min: 3
+            unique: seq
+            ordered: seq
+{{- if eq .QoS 2}}
+        - recv:
+            doc: No duplicate arrives late.
+            fails: true
+            chan: subscriber
+            pattern: {}
+            timeout: 1s
+{{- end}}
+{{end}}
+
+{{define "retained"}}doc: |
+  MQTT conformance: retained messages.
+
+  A new subscriber receives a topic's retained message, and an empty
+  retained message clears it.
+{{template "header" .}}spec:
+  phases:
+    phase1:
+      steps:
+{{template "make" (map "name" "publisher" "clientid" (printf "%s-retained-pub" .ClientPrefix) "config" (map "retain" true "cleansession" true))}}        - pub:
+            doc: Clear any retained message from a previous run.
+            chan: publisher
+            topic: '{?!PREFIX}/retained'
+            payload: ""
+        - pub:
+            chan: publisher
+            topic: '{?!PREFIX}/retained'
+            payload:
+              retained: true
+{{template "make" (map "name" "late" "clientid" (printf "%s-retained-late" .ClientPrefix) "config" (map "cleansession" true))}}        - sub:
+            chan: late
+            topic: '{?!PREFIX}/retained'
+        - recv:
+            doc: A subscriber that arrives later gets the retained message.
+            chan: late
+            pattern:
+              retained: true
+            timeout: {{.Timeout}}
+        - pub:
+            doc: Clear the retained message.
+            chan: publisher
+            topic: '{?!PREFIX}/retained'
+            payload: ""
+{{template "make" (map "name" "later" "clientid" (printf "%s-retained-later" .ClientPrefix) "config" (map "cleansession" true))}}        - sub:
+            chan: later
+            topic: '{?!PREFIX}/retained'
+        - recv:
+            doc: After the clearing, a new subscriber gets nothing.
+            fails: true
+            chan: later
+            pattern: {}
+            timeout: 1s
+{{end}}
+
+{{define "session"}}doc: |
+  MQTT conformance: persistent sessions.
+
+  A client that connects with a client id that has a persistent
+  session (cleansession false) resumes that session's subscriptions,
+  and a clean session discards them.
+{{template "header" .}}spec:
+  phases:
+    phase1:
+      steps:
+{{template "make" (map "name" "first" "clientid" (printf "%s-session" .ClientPrefix) "config" (map "cleansession" false))}}        - sub:
+            chan: first
+            topic: '{?!PREFIX}/session'
+{{template "make" (map "name" "resumed" "clientid" (printf "%s-session" .ClientPrefix) "config" (map "cleansession" false))}}{{template "make" (map "name" "publisher" "clientid" (printf "%s-session-pub" .ClientPrefix) "config" (map "cleansession" true))}}        - pub:
+            chan: publisher
+            topic: '{?!PREFIX}/session'
+            payload:
+              n: 1
+        - recv:
+            doc: The resumed session has the subscription.
+            chan: resumed
+            pattern:
+              n: 1
+            timeout: {{.Timeout}}
+{{template "make" (map "name" "clean" "clientid" (printf "%s-session" .ClientPrefix) "config" (map "cleansession" true))}}        - pub:
+            chan: publisher
+            topic: '{?!PREFIX}/session'
+            payload:
+              n: 2
+        - recv:
+            doc: A clean session has no subscriptions.
+            fails: true
+            chan: clean
+            pattern: {}
+            timeout: 1s
+{{end}}
+
+{{define "will"}}doc: |
+  MQTT conformance: will delivery.
+
+  When a client with a will disconnects ungracefully, the broker
+  publishes its will.  The client is '{{.WillCommand}}' (via a 'cmd'
+  channel), which this test kills.
+
+  Since that client is a separate program, its broker ({{.Host}}:{{.Port}})
+  and topics don't use the '?!ENDPOINT' and '?!PREFIX' bindings.
+{{template "header" .}}spec:
+  phases:
+    phase1:
+      steps:
+{{template "make" (map "name" "watcher" "clientid" (printf "%s-will-watcher" .ClientPrefix) "config" (map "cleansession" true))}}        - sub:
+            chan: watcher
+            topic: {{.TopicPrefix}}/will
+        - pub:
+            doc: Ask Mother to start a client with a will.
+            chan: mother
+            payload:
+              make:
+                name: doomed
+                type: cmd
+                config:
+                  command: {{.WillCommand}}
+                  args:
+                    - -h
+                    - '{{.Host}}'
+                    - -p
+                    - '{{.Port}}'
+                    - -i
+                    - {{.ClientPrefix}}-will-doomed
+                    - -t
+                    - {{.TopicPrefix}}/will/ignored
+                    - --will-topic
+                    - {{.TopicPrefix}}/will
+                    - --will-payload
+                    - delivered
+                    - --will-qos
+                    - "1"
+                  killsignal: KILL
+        - recv:
+            chan: mother
+            pattern:
+              success: true
+        - wait: 1s
+        - kill:
+            chan: doomed
+        - recv:
+            doc: The broker published the will.
+            chan: watcher
+            topic: {{.TopicPrefix}}/will
+            pattern: delivered
+            timeout: {{.Timeout}}
+{{end}}
+`
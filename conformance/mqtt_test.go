@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMQTTPack(t *testing.T) {
+	p := &MQTTPack{
+		BrokerURL: "tcp://localhost:1883",
+	}
+
+	specs, err := p.Specs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 6 {
+		t.Fatalf("got %d specs", len(specs))
+	}
+
+	ctx := dsl.NewCtx(context.Background())
+
+	for filename, bs := range specs {
+		t.Run(filename, func(t *testing.T) {
+			tst := dsl.NewTest(ctx, filename, nil)
+			if err := yaml.Unmarshal(bs, &tst); err != nil {
+				t.Fatal(err)
+			}
+			if errs := tst.Validate(ctx); 0 < len(errs) {
+				t.Fatal(errs)
+			}
+
+			// The checked-in pack should be current.
+			got, err := ioutil.ReadFile(filepath.Join("../demos/mqtt-conformance", filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, bs) {
+				t.Fatalf("../demos/mqtt-conformance/%s is stale", filename)
+			}
+		})
+	}
+}
+
+func TestMQTTPackBadURL(t *testing.T) {
+	p := &MQTTPack{
+		BrokerURL: "::nope",
+	}
+	if _, err := p.Specs(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
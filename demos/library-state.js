@@ -0,0 +1,8 @@
+// A library with state that persists across steps.
+
+var tally = {};
+
+function count(what) {
+    tally[what] = (tally[what] || 0) + 1;
+    return tally[what];
+}
@@ -0,0 +1,7 @@
+// assertPositive returns a Failure unless x is a positive number.
+function assertPositive(what, x) {
+    if (typeof x != "number" || x <= 0) {
+        return Failure(what + " isn't positive: " + JSON.stringify(x));
+    }
+    return true;
+}
@@ -0,0 +1,318 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// AvroSpec specifies Avro schemas for PayloadFormat "avro".
+//
+// Payloads use the Confluent Schema Registry wire format: a zero
+// byte, the schema ID (four bytes, big-endian), and then the Avro
+// binary encoding.
+type AvroSpec struct {
+	// Registry is the (optional) base URL of a Confluent Schema
+	// Registry, which resolves schema IDs to schemas.
+	Registry string `json:",omitempty" yaml:",omitempty"`
+
+	// Subject is the registry subject that provides the schema
+	// (and its ID) for a Pub.
+	Subject string `json:",omitempty" yaml:",omitempty"`
+
+	// Version is the Subject's version.  The default is the
+	// latest version.
+	Version int `json:",omitempty" yaml:",omitempty"`
+
+	// Id is a schema ID.  A Pub uses this schema when there's no
+	// Subject.
+	Id int `json:",omitempty" yaml:",omitempty"`
+
+	// Schema is an optional schema (a JSON string or the
+	// structure itself) for Id, which then doesn't require a
+	// Registry.
+	Schema interface{} `json:",omitempty" yaml:",omitempty"`
+}
+
+// Substitute performs bindings substitution on the Registry and
+// Subject.
+func (s *AvroSpec) Substitute(ctx *Ctx, bs *Bindings) (*AvroSpec, error) {
+	if s == nil {
+		return nil, nil
+	}
+	reg, err := bs.StringSub(ctx, s.Registry)
+	if err != nil {
+		return nil, err
+	}
+	subj, err := bs.StringSub(ctx, s.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSpec{
+		Registry: reg,
+		Subject:  subj,
+		Version:  s.Version,
+		Id:       s.Id,
+		Schema:   s.Schema,
+	}, nil
+}
+
+// SchemaRegistry is a minimal client for a Confluent Schema
+// Registry.  It caches schemas by ID.
+type SchemaRegistry struct {
+	URL    string
+	Client *http.Client
+
+	sync.Mutex
+	codecs map[int]*goavro.Codec
+}
+
+// NewSchemaRegistry makes a SchemaRegistry for the given base URL.
+func NewSchemaRegistry(u string) *SchemaRegistry {
+	return &SchemaRegistry{
+		URL: strings.TrimRight(u, "/"),
+		Client: &http.Client{
+			Timeout: DefaultFetchTimeout,
+		},
+		codecs: make(map[int]*goavro.Codec),
+	}
+}
+
+// registrySchema is the relevant part of a Schema Registry response.
+type registrySchema struct {
+	Id         int    `json:"id"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+func (r *SchemaRegistry) get(path string) (*registrySchema, error) {
+	resp, err := r.Client.Get(r.URL + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema registry %s: status %d: %s", path, resp.StatusCode, body)
+	}
+	var s registrySchema
+	if err = json.Unmarshal(body, &s); err != nil {
+		return nil, fmt.Errorf("schema registry %s: %w", path, err)
+	}
+	if s.SchemaType != "" && s.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("schema registry %s: schema type %s isn't AVRO", path, s.SchemaType)
+	}
+	return &s, nil
+}
+
+// Codec returns the Avro codec for the schema with the given ID.
+func (r *SchemaRegistry) Codec(id int) (*goavro.Codec, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if c, have := r.codecs[id]; have {
+		return c, nil
+	}
+	s, err := r.get("/schemas/ids/" + strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	c, err := goavro.NewCodec(s.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	r.codecs[id] = c
+	return c, nil
+}
+
+// Subject returns the schema ID and codec for the given subject and
+// version (or the latest version if the version is zero).
+func (r *SchemaRegistry) Subject(subject string, version int) (int, *goavro.Codec, error) {
+	v := "latest"
+	if 0 < version {
+		v = strconv.Itoa(version)
+	}
+	s, err := r.get("/subjects/" + url.PathEscape(subject) + "/versions/" + v)
+	if err != nil {
+		return 0, nil, err
+	}
+	c, err := goavro.NewCodec(s.Schema)
+	if err != nil {
+		return 0, nil, fmt.Errorf("subject %s: %w", subject, err)
+	}
+
+	r.Lock()
+	r.codecs[s.Id] = c
+	r.Unlock()
+
+	return s.Id, c, nil
+}
+
+// avroCodec converts between Avro payloads in the Schema Registry
+// wire format and the structure of their Avro JSON encodings.
+type avroCodec struct {
+	reg *SchemaRegistry
+
+	// id and codec are the schema (if known) for encoding.
+	id    int
+	codec *goavro.Codec
+}
+
+func (t *Test) avroCodec(ctx *Ctx, spec *AvroSpec) (*avroCodec, error) {
+	c := &avroCodec{
+		id: spec.Id,
+	}
+
+	if spec.Registry != "" {
+		if t.registries == nil {
+			t.registries = make(map[string]*SchemaRegistry)
+		}
+		reg, have := t.registries[spec.Registry]
+		if !have {
+			reg = NewSchemaRegistry(spec.Registry)
+			t.registries[spec.Registry] = reg
+		}
+		c.reg = reg
+	}
+
+	if spec.Schema != nil {
+		s, is := spec.Schema.(string)
+		if !is {
+			js, err := json.Marshal(&spec.Schema)
+			if err != nil {
+				return nil, Brokenf("Avro schema: %s", err)
+			}
+			s = string(js)
+		}
+		codec, err := goavro.NewCodec(s)
+		if err != nil {
+			return nil, Brokenf("Avro schema: %s", err)
+		}
+		c.codec = codec
+	}
+
+	if spec.Subject != "" {
+		if c.reg == nil {
+			return nil, Brokenf("Avro Subject requires a Registry")
+		}
+		id, codec, err := c.reg.Subject(spec.Subject, spec.Version)
+		if err != nil {
+			return nil, Categorize(CategoryChannel, err)
+		}
+		c.id, c.codec = id, codec
+	}
+
+	if c.reg == nil && c.codec == nil {
+		return nil, Brokenf("Avro requires a Registry or a Schema")
+	}
+
+	return c, nil
+}
+
+// schema returns the codec for the given schema ID.
+func (c *avroCodec) schema(id int) (*goavro.Codec, error) {
+	if c.codec != nil && id == c.id {
+		return c.codec, nil
+	}
+	if c.reg == nil {
+		return nil, fmt.Errorf("unknown Avro schema %d (and no Registry)", id)
+	}
+	return c.reg.Codec(id)
+}
+
+// Encode accepts a structured payload or a JSON string in the Avro
+// JSON encoding.
+func (c *avroCodec) Encode(x interface{}) (string, error) {
+	if c.codec == nil && c.id == 0 {
+		return "", Brokenf("Avro encoding requires a Subject or Id")
+	}
+	codec, err := c.schema(c.id)
+	if err != nil {
+		return "", err
+	}
+
+	js, is := x.(string)
+	if !is {
+		bs, err := json.Marshal(&x)
+		if err != nil {
+			return "", err
+		}
+		js = string(bs)
+	}
+
+	native, _, err := codec.NativeFromTextual([]byte(js))
+	if err != nil {
+		return "", fmt.Errorf("Avro encoding: %w", err)
+	}
+
+	acc := make([]byte, 5, 64)
+	binary.BigEndian.PutUint32(acc[1:], uint32(c.id))
+	acc, err = codec.BinaryFromNative(acc, native)
+	if err != nil {
+		return "", fmt.Errorf("Avro encoding: %w", err)
+	}
+	return string(acc), nil
+}
+
+func (c *avroCodec) Decode(x interface{}) (interface{}, error) {
+	var bs []byte
+	switch vv := x.(type) {
+	case string:
+		bs = []byte(vv)
+	case []byte:
+		bs = vv
+	default:
+		return nil, fmt.Errorf("Avro payload is a %T and not bytes", x)
+	}
+
+	if len(bs) < 5 || bs[0] != 0 {
+		return nil, fmt.Errorf("Avro payload doesn't have the Schema Registry header")
+	}
+	id := int(binary.BigEndian.Uint32(bs[1:5]))
+
+	codec, err := c.schema(id)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromBinary(bs[5:])
+	if err != nil {
+		return nil, fmt.Errorf("Avro schema %d decoding: %w", id, err)
+	}
+	js, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, err
+	}
+	var y interface{}
+	if err = json.Unmarshal(js, &y); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAvroSchema = `{"type":"record","name":"Order","fields":[{"name":"id","type":"int"},{"name":"items","type":{"type":"array","items":"string"}},{"name":"note","type":["null","string"],"default":null}]}`
+
+func TestAvroCodec(t *testing.T) {
+	var (
+		ctx  = NewCtx(nil)
+		gets = 0
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		switch r.URL.Path {
+		case "/subjects/orders-value/versions/latest", "/schemas/ids/7":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"subject": "orders-value",
+				"version": 1,
+				"id":      7,
+				"schema":  testAvroSchema,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	pub, err := NewTest(ctx, "pub", nil).codec(ctx, PayloadFormatAvro, "", nil, &AvroSpec{
+		Registry: srv.URL,
+		Subject:  "orders-value",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := pub.Encode(dejson(`{"id":42,"items":["taco"],"note":{"string":"hot"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s[:5] != "\x00\x00\x00\x00\x07" {
+		t.Fatalf("bad header %q", s[:5])
+	}
+
+	recv, err := NewTest(ctx, "recv", nil).codec(ctx, PayloadFormatAvro, "", nil, &AvroSpec{
+		Registry: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		x, err := recv.Decode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if js := JSON(x); js != `{"id":42,"items":["taco"],"note":{"string":"hot"}}` {
+			t.Fatal(js)
+		}
+	}
+	if gets != 2 {
+		t.Fatalf("registry gets: %d", gets)
+	}
+
+	if _, err = recv.Decode("nope"); err == nil {
+		t.Fatal("should have complained")
+	}
+	if _, err = recv.Encode(dejson(`{"id":1}`)); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	// A Schema for an Id doesn't need a registry.
+	pinned, err := NewTest(ctx, "pinned", nil).codec(ctx, PayloadFormatAvro, "", nil, &AvroSpec{
+		Id:     7,
+		Schema: testAvroSchema,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := pinned.Encode(`{"id":42,"items":["taco"],"note":{"string":"hot"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 != s {
+		t.Fatalf("%q != %q", s2, s)
+	}
+	if _, err = pinned.Decode("\x00\x00\x00\x00\x08\x02"); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	if _, err = NewTest(ctx, "bad", nil).codec(ctx, PayloadFormatAvro, "", nil, &AvroSpec{}); err == nil {
+		t.Fatal("should have complained")
+	}
+	if _, err = NewTest(ctx, "bad", nil).codec(ctx, PayloadFormatJSON, "", nil, &AvroSpec{}); err == nil {
+		t.Fatal("should have complained")
+	}
+}
@@ -131,11 +131,16 @@ func (bs *Bindings) Sub(ctx *Ctx, src, target interface{}, maybeJSON bool) error
 // SubOnce the bindings
 func (bs *Bindings) SubOnce(ctx *Ctx, src, target interface{}, maybeJSON bool) error {
 	// If we are given a string, perform string-based expansion on
-	// that string.
+	// that string unless it's a JSON object or array, which gets
+	// structured substitution (below) instead.
 	if s, is := src.(string); is {
-		var err error
-		if src, err = bs.StringSub(ctx, s); err != nil {
-			return err
+		if x, is := structure(s, maybeJSON); is {
+			src = x
+		} else {
+			var err error
+			if src, err = bs.StringSub(ctx, s); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -153,6 +158,12 @@ func (bs *Bindings) SubOnce(ctx *Ctx, src, target interface{}, maybeJSON bool) e
 		}
 	}
 	// Perform structured bindings substitution.
+	if _, is := src.(string); !is {
+		var err error
+		if src, err = bs.spliceAll(ctx, src); err != nil {
+			return err
+		}
+	}
 	src = bs.Bind(ctx, src)
 
 	// Attempt to deserialize the result into the target.
@@ -206,7 +217,6 @@ func (bs *Bindings) StringSub(ctx *Ctx, s string) (string, error) {
 //
 // This method does not call Bind (structured bindings substitution).
 func (bs *Bindings) StringSubOnce(ctx *Ctx, s string) (string, error) {
-	b := *bs
 	// Maybe read a file.
 	if strings.HasPrefix(s, "@@") {
 		ctx.Inddf("    Expansion: file '%s'", short(s[2:]))
@@ -235,9 +245,13 @@ func (bs *Bindings) StringSubOnce(ctx *Ctx, s string) (string, error) {
 		s = str
 	}
 
-	// Bindings are substituted textually with added braces: a
-	// binding B=V will substitute V for {B} in the given string.
-	for k, v := range b {
+	return bs.braceSub(ctx, s)
+}
+
+// braceSub substitutes bindings textually with added braces: a
+// binding B=V will substitute V for {B} in the given string.
+func (bs *Bindings) braceSub(ctx *Ctx, s string) (string, error) {
+	for k, v := range *bs {
 		str, is := v.(string)
 		if !is {
 			js, err := json.Marshal(&v)
@@ -256,6 +270,66 @@ func (bs *Bindings) StringSubOnce(ctx *Ctx, s string) (string, error) {
 	return s, nil
 }
 
+// Expand returns a copy of x with exact variables replaced by their
+// bindings (as in Bind), strings that are exactly '{B}' replaced by
+// B's binding (as in splice), and bindings substituted into other
+// strings with added braces (as in StringSub).
+//
+// When eval is false, Expand doesn't read '@@' files or execute '!!'
+// Javascript, so it can show what a spec would look like without
+// doing any work.  When eval is true, every string gets the complete
+// StringSub treatment.
+func (bs *Bindings) Expand(ctx *Ctx, x interface{}, eval bool) (interface{}, error) {
+	switch vv := x.(type) {
+	case string:
+		if match.DefaultMatcher.IsVariable(vv) {
+			if binding, have := (*bs)[vv]; have {
+				return binding, nil
+			}
+		}
+		if binding, have := bs.braced(vv); have {
+			return binding, nil
+		}
+		if eval {
+			return bs.StringSub(ctx, vv)
+		}
+		limit := 10
+		for i := 0; i < limit; i++ {
+			s, err := bs.braceSub(ctx, vv)
+			if err != nil {
+				return nil, err
+			}
+			if s == vv {
+				return s, nil
+			}
+			vv = s
+		}
+		return nil, fmt.Errorf("expansion limit (%d) exceeded at '%s'", limit, vv)
+	case map[string]interface{}:
+		acc := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			y, err := bs.Expand(ctx, v, eval)
+			if err != nil {
+				return nil, err
+			}
+			acc[k] = y
+		}
+		return acc, nil
+	case []interface{}:
+		acc := make([]interface{}, len(vv))
+		for i, v := range vv {
+			y, err := bs.Expand(ctx, v, eval)
+			if err != nil {
+				return nil, err
+			}
+			acc[i] = y
+		}
+		return acc, nil
+	default:
+		return x, nil
+	}
+}
+
 // replaceBindings replaces all variables in x with their
 // corresponding values in bs (if any).
 //
@@ -291,3 +365,99 @@ func (bs *Bindings) replaceBindings(ctx *Ctx, x interface{}) interface{} {
 func (bs *Bindings) Bind(ctx *Ctx, x interface{}) interface{} {
 	return bs.replaceBindings(ctx, x)
 }
+
+// structure returns the JSON object or array that the given string
+// represents (if maybeJSON and if the string is such JSON).  A
+// string that starts with '@@' or '!!' is never structure.
+func structure(s string, maybeJSON bool) (interface{}, bool) {
+	if !maybeJSON || strings.HasPrefix(s, "@@") || strings.HasPrefix(s, "!!") {
+		return nil, false
+	}
+	var x interface{}
+	if err := json.Unmarshal([]byte(s), &x); err != nil {
+		return nil, false
+	}
+	switch x.(type) {
+	case map[string]interface{}, []interface{}:
+		return x, true
+	}
+	return nil, false
+}
+
+// braced returns the binding for B if the given string is exactly
+// '{B}' for a bound variable B.
+func (bs *Bindings) braced(s string) (interface{}, bool) {
+	if len(s) < 3 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, false
+	}
+	binding, have := (*bs)[s[1:len(s)-1]]
+	return binding, have
+}
+
+// spliceAll computes the fixed point of splice, so a spliced binding
+// can itself refer to other bindings.
+func (bs *Bindings) spliceAll(ctx *Ctx, x interface{}) (interface{}, error) {
+	limit := 10
+	for i := 0; i < limit; i++ {
+		y, err := bs.splice(ctx, x)
+		if err != nil {
+			return nil, err
+		}
+		if JSON(y) == JSON(x) {
+			return y, nil
+		}
+		x = y
+	}
+	return nil, fmt.Errorf("expansion limit (%d) exceeded at '%s'", limit, JSON(x))
+}
+
+// splice substitutes bindings into the strings in the given
+// structured value.
+//
+// A string that's exactly '{B}' for a bound variable B becomes B's
+// binding as a value, so an object stays an object and a number
+// stays a number (without the quoting that textual substitution
+// would give).  Other strings, including map keys, get textual
+// substitution as in braceSub.  Two keys that substitute to the same
+// key are an error.
+func (bs *Bindings) splice(ctx *Ctx, x interface{}) (interface{}, error) {
+	switch vv := x.(type) {
+	case string:
+		if binding, have := bs.braced(vv); have {
+			ctx.Inddf("    Expansion: splicing '%s'", vv)
+			return binding, nil
+		}
+		return bs.braceSub(ctx, vv)
+	case map[string]interface{}:
+		acc := make(map[string]interface{}, len(vv))
+		from := make(map[string]string, len(vv))
+		for k, v := range vv {
+			key, err := bs.braceSub(ctx, k)
+			if err != nil {
+				return nil, err
+			}
+			if other, have := from[key]; have {
+				return nil, fmt.Errorf("keys '%s' and '%s' both substitute to '%s'", other, k, key)
+			}
+			from[key] = k
+			y, err := bs.splice(ctx, v)
+			if err != nil {
+				return nil, err
+			}
+			acc[key] = y
+		}
+		return acc, nil
+	case []interface{}:
+		acc := make([]interface{}, len(vv))
+		for i, v := range vv {
+			y, err := bs.splice(ctx, v)
+			if err != nil {
+				return nil, err
+			}
+			acc[i] = y
+		}
+		return acc, nil
+	default:
+		return x, nil
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/json"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Breakpoint makes a Step pause execution with a Debugger or, without
+// one, makes the Step log a Snapshot.
+//
+// In YAML, a Breakpoint can be a boolean, a string (the If
+// condition), or an object with the fields below.
+type Breakpoint struct {
+	// If is optional Javascript that should return a boolean.
+	// When given, the Breakpoint only applies if the code returns
+	// true.
+	//
+	// Subject to bindings substitution.
+	If string `json:",omitempty" yaml:",omitempty"`
+
+	// off is true for 'breakpoint: false'.
+	off bool
+}
+
+// UnmarshalYAML accepts a boolean, a string (the If condition), or
+// an object.
+func (b *Breakpoint) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		var on bool
+		if n.Tag == "!!bool" && n.Decode(&on) == nil {
+			b.off = !on
+			return nil
+		}
+		b.If = n.Value
+		return nil
+	}
+	type breakpoint Breakpoint
+	return n.Decode((*breakpoint)(b))
+}
+
+// MarshalYAML gives true or false for a Breakpoint without a
+// condition.
+func (b *Breakpoint) MarshalYAML() (interface{}, error) {
+	if b.If == "" {
+		return !b.off, nil
+	}
+	type breakpoint Breakpoint
+	return (*breakpoint)(b), nil
+}
+
+// UnmarshalJSON accepts a boolean, a string (the If condition), or
+// an object.
+func (b *Breakpoint) UnmarshalJSON(js []byte) error {
+	var x interface{}
+	if err := json.Unmarshal(js, &x); err != nil {
+		return err
+	}
+	switch vv := x.(type) {
+	case bool:
+		b.off = !vv
+		return nil
+	case string:
+		b.If = vv
+		return nil
+	}
+	type breakpoint Breakpoint
+	return json.Unmarshal(js, (*breakpoint)(b))
+}
+
+// MarshalJSON gives true or false for a Breakpoint without a
+// condition.
+func (b *Breakpoint) MarshalJSON() ([]byte, error) {
+	if b.If == "" {
+		return json.Marshal(!b.off)
+	}
+	type breakpoint Breakpoint
+	return json.Marshal((*breakpoint)(b))
+}
+
+// SchemaAlternatives gives the YAML representations other than an
+// object for JSONSchema().
+func (b *Breakpoint) SchemaAlternatives() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"type": "boolean"},
+		map[string]interface{}{"type": "string"},
+	}
+}
+
+// Check reports whether the Breakpoint applies.
+//
+// A nil Breakpoint never applies.
+func (b *Breakpoint) Check(ctx *Ctx, t *Test) (bool, error) {
+	if b == nil || b.off {
+		return false, nil
+	}
+	if b.If == "" {
+		return true, nil
+	}
+
+	code, err := t.Bindings.StringSub(ctx, b.If)
+	if err != nil {
+		return false, err
+	}
+	src, err := t.prepareSource(ctx, code)
+	if err != nil {
+		return false, err
+	}
+	x, err := t.JSExec(ctx, src, t.jsEnv(ctx))
+	if err != nil {
+		return false, err
+	}
+	on, is := x.(bool)
+	if !is {
+		return false, Brokenf("Breakpoint If Javascript returned a %T (%v) and not a bool", x, x)
+	}
+	return on, nil
+}
+
+// Snapshot is the state of a Test at a Breakpoint.
+type Snapshot struct {
+	Phase    string
+	Step     int
+	Bindings Bindings
+
+	// Pending are the messages that have arrived on channels but
+	// that no Recv has consumed.
+	Pending []PendingMsg
+
+	// Paused counts the messages buffered for each paused
+	// channel.  See Pause.
+	Paused map[string]int `json:",omitempty"`
+}
+
+// PendingMsg is a pending message and the name of its channel.
+type PendingMsg struct {
+	Chan string
+	Msg  Msg
+}
+
+// Snapshot returns the state of the Test before step i of the
+// current phase.
+//
+// Since Snapshot has to examine the pending messages, it sets them
+// aside (like a Recv with Topics does) for subsequent Recvs.
+func (t *Test) Snapshot(ctx *Ctx, i int) *Snapshot {
+	s := &Snapshot{
+		Phase:    t.phase,
+		Step:     i,
+		Bindings: CopyBindings(t.Bindings),
+		Pending:  t.pending(ctx),
+	}
+	for name, b := range t.paused {
+		if s.Paused == nil {
+			s.Paused = make(map[string]int, len(t.paused))
+		}
+		s.Paused[name] = b.size()
+	}
+	return s
+}
+
+// pending sets aside the messages that have arrived on each channel
+// and returns all of the pending messages (in order by channel
+// name).
+func (t *Test) pending(ctx *Ctx) []PendingMsg {
+	names := make([]string, 0, len(t.Chans))
+	for name := range t.Chans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var acc []PendingMsg
+	for _, name := range names {
+		in := t.inbound(ctx, t.Chans[name])
+	DRAIN:
+		for {
+			select {
+			case m := <-in:
+				// A message that the channel's filter
+				// rejects isn't pending, but one that
+				// the filter can't judge is.
+				if admit, err := t.admit(ctx, name, &m); err == nil && !admit {
+					continue
+				}
+				// After any previously held messages.
+				if t.held == nil {
+					t.held = make(map[string][]Msg)
+				}
+				t.held[name] = append(t.held[name], m)
+			default:
+				break DRAIN
+			}
+		}
+		for _, m := range t.held[name] {
+			acc = append(acc, PendingMsg{name, m})
+		}
+	}
+	return acc
+}
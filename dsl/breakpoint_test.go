@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBreakpointYAML(t *testing.T) {
+	ctx, _, tst := newTest(t)
+	tst.Bindings["?n"] = 3
+
+	for _, c := range []struct {
+		src  string
+		want bool
+	}{
+		{`breakpoint: true`, true},
+		{`breakpoint: false`, false},
+		{`breakpoint: 'return bs["?n"] == 3'`, true},
+		{`breakpoint: 'return bs["?n"] == 4'`, false},
+		{`breakpoint: {if: 'return {?n} < 10'}`, true},
+		{`run: 'return true'`, false},
+	} {
+		t.Run(c.src, func(t *testing.T) {
+			var s Step
+			if err := yaml.Unmarshal([]byte(c.src), &s); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Breakpoint.Check(ctx, tst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Fatal(got)
+			}
+
+			// Round trip.
+			bs, err := yaml.Marshal(&s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var s2 Step
+			if err := yaml.Unmarshal(bs, &s2); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ = s2.Breakpoint.Check(ctx, tst); got != c.want {
+				t.Fatal(string(bs))
+			}
+		})
+	}
+
+	t.Run("bad", func(t *testing.T) {
+		b := &Breakpoint{If: "return 42"}
+		if _, err := b.Check(ctx, tst); err == nil {
+			t.Fatal("should have complained")
+		}
+	})
+}
+
+func TestBreakpointConditional(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "breakpoint", NewSpec())
+		out bytes.Buffer
+	)
+	tst.Spec.Phases["phase1"] = &Phase{
+		Steps: []*Step{
+			{Set: Set{"?x": 1}},
+			{Set: Set{"?y": 2}, Breakpoint: &Breakpoint{If: `return bs["?x"] == 2`}},
+			{Set: Set{"?z": 3}, Breakpoint: &Breakpoint{If: `return bs["?y"] == 2`}},
+		},
+	}
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tst.Debugger = NewDebugger(strings.NewReader("c\nc\n"), &out)
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+
+	got := out.String()
+	if strings.Contains(got, "step 1:") {
+		t.Fatalf("paused at step 1:\n%s", got)
+	}
+	if !strings.Contains(got, "breakpoint\nphase phase1 step 2:") {
+		t.Fatalf("didn't pause at the breakpoint:\n%s", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+	p.AddStep(ctx, &Step{
+		Pub: &Pub{
+			Payload: `{"want":"tacos"}`,
+		},
+	})
+	p.AddStep(ctx, &Step{
+		Breakpoint: &Breakpoint{},
+		Recv: &Recv{
+			Pattern: `{"want":"?want"}`,
+		},
+	})
+
+	run(t, ctx, tst)
+
+	// The snapshot didn't consume the message.
+	if tst.Bindings["?want"] != "tacos" {
+		t.Fatal(tst.Bindings)
+	}
+
+	tst.Bindings["?secret_x"] = "x"
+	snap := tst.Snapshot(ctx, 3)
+	if snap.Phase != "phase1" || snap.Step != 3 {
+		t.Fatal(snap)
+	}
+	if snap.Bindings["?want"] != "tacos" {
+		t.Fatal(snap.Bindings)
+	}
+	if len(snap.Pending) != 0 {
+		t.Fatal(snap.Pending)
+	}
+
+	if err := tst.Chans["mock1"].To(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	snap = tst.Snapshot(ctx, 3)
+	if len(snap.Pending) != 1 || snap.Pending[0].Chan != "mock1" {
+		t.Fatal(snap.Pending)
+	}
+	// The message is still pending.
+	if snap = tst.Snapshot(ctx, 3); len(snap.Pending) != 1 {
+		t.Fatal(snap.Pending)
+	}
+}
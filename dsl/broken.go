@@ -61,6 +61,10 @@ func (b *Broken) Error() string {
 	return fmt.Sprintf("Broken: %s", b.Err)
 }
 
+func (b *Broken) Unwrap() error {
+	return b.Err
+}
+
 func (b *Broken) String() string {
 	return b.Error()
 }
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Comcast/plax/metrics"
+)
+
+// DefaultBufferSize is the default capacity of a Buffer.
+var DefaultBufferSize = 1024
+
+// Overflow policies say what a Buffer does with a message when the
+// Buffer is full.
+const (
+	// OverflowBlock waits until there's room for the message.
+	OverflowBlock = "block"
+
+	// OverflowDropOldest discards the oldest buffered message to
+	// make room for the new one.
+	OverflowDropOldest = "drop-oldest"
+
+	// OverflowDropNew discards the new message.
+	OverflowDropNew = "drop-new"
+
+	// OverflowFailTest discards the new message and fails the
+	// test's next Recv on the channel.  See Overflower.
+	OverflowFailTest = "fail-test"
+)
+
+// DefaultOverflow is the default overflow policy.
+var DefaultOverflow = OverflowFailTest
+
+// Overflower is implemented by a Chan that can report that its
+// Buffer overflowed with the OverflowFailTest policy.
+type Overflower interface {
+	Overflow() error
+}
+
+// Buffer holds a channel's inbound messages until Recvs consume
+// them, and the Buffer's overflow policy says what to do when the
+// Buffer is full.
+//
+// Dropped messages are counted by the metrics.ChanDropped counter.
+type Buffer struct {
+	// C is the Go channel that a Chan's Recv returns.
+	C chan Msg
+
+	kind   ChanKind
+	policy string
+
+	// mu serializes drop-oldest puts and protects the fields
+	// below.
+	mu sync.Mutex
+
+	// dropped counts the messages that the Buffer discarded.
+	dropped int
+
+	// err is the first overflow with OverflowFailTest.
+	err error
+}
+
+// NewBuffer makes a Buffer for a channel of the given kind.  A size
+// that isn't positive gives DefaultBufferSize, and an empty policy
+// gives DefaultOverflow.
+func NewBuffer(kind ChanKind, size int, policy string) (*Buffer, error) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	if policy == "" {
+		policy = DefaultOverflow
+	}
+	switch policy {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNew, OverflowFailTest:
+	default:
+		return nil, Brokenf("unknown overflow policy '%s' (want %s, %s, %s, or %s)",
+			policy, OverflowBlock, OverflowDropOldest, OverflowDropNew, OverflowFailTest)
+	}
+	return &Buffer{
+		C:      make(chan Msg, size),
+		kind:   kind,
+		policy: policy,
+	}, nil
+}
+
+// Put adds the message to the Buffer according to the overflow
+// policy.  With OverflowFailTest, Put returns an error for a message
+// that didn't fit.
+func (b *Buffer) Put(ctx *Ctx, m Msg) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case b.C <- m:
+		return nil
+	default:
+	}
+
+	switch b.policy {
+	case OverflowBlock:
+		ctx.Logf("%s buffer full; waiting to add message on %s", b.kind, m.Topic)
+		select {
+		case <-ctx.Done():
+		case b.C <- m:
+		}
+		return nil
+	case OverflowDropOldest:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for {
+			select {
+			case b.C <- m:
+				return nil
+			default:
+			}
+			select {
+			case old := <-b.C:
+				b.drop(ctx, old)
+			default:
+			}
+		}
+	case OverflowDropNew:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(ctx, m)
+		return nil
+	default:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(ctx, m)
+		err := fmt.Errorf("%s buffer overflowed (capacity %d) with message on %s", b.kind, cap(b.C), m.Topic)
+		if b.err == nil {
+			b.err = err
+		}
+		return err
+	}
+}
+
+// drop counts and logs a discarded message.  Caller holds b.mu.
+func (b *Buffer) drop(ctx *Ctx, m Msg) {
+	b.dropped++
+	ctx.Warnf("warning: %s buffer full (%s); dropping message on %s", b.kind, b.policy, m.Topic)
+	ctx.Metrics.Add(metrics.ChanDropped, metrics.Labels{
+		"kind":   string(b.kind),
+		"policy": b.policy,
+	}, 1)
+}
+
+// Dropped returns the number of messages that the Buffer discarded.
+func (b *Buffer) Dropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Overflow returns the error for the first overflow with
+// OverflowFailTest, if any.  See Overflower.
+func (b *Buffer) Overflow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// overflowed returns a channel error if the given Chan's Buffer
+// overflowed with OverflowFailTest.
+func (t *Test) overflowed(c Chan) error {
+	o, is := c.(Overflower)
+	if !is {
+		return nil
+	}
+	if err := o.Overflow(); err != nil {
+		return Categorize(CategoryChannel, fmt.Errorf("channel %s: %w", t.chanName(c), err))
+	}
+	return nil
+}
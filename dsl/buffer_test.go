@@ -0,0 +1,155 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/metrics"
+)
+
+func TestBuffer(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	ctx.Metrics = metrics.NewRegistry()
+
+	put := func(b *Buffer, topics ...string) error {
+		for _, topic := range topics {
+			if err := b.Put(ctx, Msg{Topic: topic}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	topics := func(b *Buffer) string {
+		var acc []string
+		for 0 < len(b.C) {
+			acc = append(acc, (<-b.C).Topic)
+		}
+		return strings.Join(acc, ",")
+	}
+
+	t.Run("drop-oldest", func(t *testing.T) {
+		b, err := NewBuffer("mock", 2, OverflowDropOldest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := put(b, "a", "b", "c"); err != nil {
+			t.Fatal(err)
+		}
+		if got := topics(b); got != "b,c" {
+			t.Fatal(got)
+		}
+		if b.Dropped() != 1 || b.Overflow() != nil {
+			t.Fatal(b.Dropped())
+		}
+	})
+
+	t.Run("drop-new", func(t *testing.T) {
+		b, err := NewBuffer("mock", 2, OverflowDropNew)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := put(b, "a", "b", "c"); err != nil {
+			t.Fatal(err)
+		}
+		if got := topics(b); got != "a,b" {
+			t.Fatal(got)
+		}
+	})
+
+	t.Run("fail-test", func(t *testing.T) {
+		b, err := NewBuffer("mock", 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := put(b, "a", "b"); err == nil {
+			t.Fatal("expected an overflow")
+		}
+		if err := b.Overflow(); err == nil || !strings.Contains(err.Error(), "overflowed") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		b, err := NewBuffer("mock", 1, OverflowBlock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() {
+			done <- put(b, "a", "b")
+		}()
+		if m := <-b.C; m.Topic != "a" {
+			t.Fatal(m.Topic)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if got := topics(b); got != "b" {
+			t.Fatal(got)
+		}
+	})
+
+	if _, err := NewBuffer("mock", 1, "panic"); err == nil {
+		t.Fatal("expected an error for an unknown policy")
+	}
+
+	if n := ctx.Metrics.Counter(metrics.ChanDropped, metrics.Labels{"kind": "mock", "policy": OverflowDropNew}); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestBufferOverflowFailsRecv(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", &Spec{
+		Phases: map[string]*Phase{
+			"phase1": {
+				Steps: []*Step{
+					{
+						Recv: &Recv{
+							Chan:    "c",
+							Topic:   "wanted",
+							Timeout: time.Minute,
+						},
+					},
+				},
+			},
+		},
+	})
+
+	c, err := NewMockChan(ctx, map[string]interface{}{
+		"BufferSize": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.To(ctx, Msg{Topic: "other"})
+	c.To(ctx, Msg{Topic: "wanted"})
+
+	tst.Chans = map[string]Chan{
+		"c": c,
+	}
+	err = tst.Run(ctx)
+	if CategoryOf(err) != CategoryChannel || !strings.Contains(err.Error(), "overflowed") {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// CanonSpec configures normalization that a Recv applies to messages
+// (and to its pattern) before matching.
+//
+// The zero value does nothing.
+type CanonSpec struct {
+	// Precision, when given, rounds numbers to that many digits
+	// after the decimal point.
+	Precision *int `json:",omitempty" yaml:",omitempty"`
+
+	// Timestamps, when true, rewrites strings that are
+	// timestamps (see TimestampLayouts) as RFC3339 in UTC.
+	Timestamps bool `json:",omitempty" yaml:",omitempty"`
+
+	// Keys is "lower" or "upper" to fold the case of map keys.
+	Keys string `json:",omitempty" yaml:",omitempty"`
+}
+
+// TimestampLayouts are the layouts that CanonSpec.Timestamps
+// recognizes.  A layout without a zone means UTC.
+var TimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.ANSIC,
+}
+
+// Check returns an error if the CanonSpec is bad.
+func (c *CanonSpec) Check() error {
+	if c == nil {
+		return nil
+	}
+	if c.Precision != nil && *c.Precision < 0 {
+		return Brokenf("Canon Precision %d is negative", *c.Precision)
+	}
+	switch c.Keys {
+	case "", "lower", "upper":
+	default:
+		return Brokenf("Canon Keys '%s' isn't 'lower' or 'upper'", c.Keys)
+	}
+	return nil
+}
+
+// Normalize returns a normalized copy of the given (canonical)
+// value.
+//
+// Folding the case of keys can make two keys the same, which is an
+// error.
+func (c *CanonSpec) Normalize(x interface{}) (interface{}, error) {
+	if c == nil {
+		return x, nil
+	}
+	switch vv := x.(type) {
+	case map[string]interface{}:
+		acc := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			switch c.Keys {
+			case "lower":
+				k = strings.ToLower(k)
+			case "upper":
+				k = strings.ToUpper(k)
+			}
+			if _, have := acc[k]; have {
+				return nil, fmt.Errorf("duplicate key '%s' after case folding", k)
+			}
+			y, err := c.Normalize(v)
+			if err != nil {
+				return nil, err
+			}
+			acc[k] = y
+		}
+		return acc, nil
+	case []interface{}:
+		acc := make([]interface{}, len(vv))
+		for i, v := range vv {
+			y, err := c.Normalize(v)
+			if err != nil {
+				return nil, err
+			}
+			acc[i] = y
+		}
+		return acc, nil
+	case float64:
+		if c.Precision != nil {
+			p := math.Pow10(*c.Precision)
+			return math.Round(vv*p) / p, nil
+		}
+	case string:
+		if c.Timestamps {
+			if t, ok := parseTimestamp(vv); ok {
+				return t.UTC().Format(time.RFC3339Nano), nil
+			}
+		}
+	}
+	return x, nil
+}
+
+// parseTimestamp tries each of the TimestampLayouts.
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range TimestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestCanonSpec(t *testing.T) {
+	two := 2
+
+	c := &CanonSpec{
+		Precision:  &two,
+		Timestamps: true,
+		Keys:       "lower",
+	}
+	if err := c.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := c.Normalize(dejson(`{"Temp":21.4567,"At":"2021-03-04T05:06:07.000-02:00","Readings":[{"N":1.005,"Name":"Homer"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"at":"2021-03-04T07:06:07Z","readings":[{"n":1,"name":"Homer"}],"temp":21.46}`
+	if js := JSON(x); js != want {
+		t.Fatal(js)
+	}
+
+	if _, err = c.Normalize(dejson(`{"A":1,"a":2}`)); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	var nothing *CanonSpec
+	if x, _ := nothing.Normalize("Mon Jan  2 15:04:05 2006"); x != "Mon Jan  2 15:04:05 2006" {
+		t.Fatal(x)
+	}
+
+	neg := -1
+	for _, bad := range []*CanonSpec{{Precision: &neg}, {Keys: "title"}} {
+		if err := bad.Check(); err == nil {
+			t.Fatalf("%s should have failed", JSON(bad))
+		}
+	}
+}
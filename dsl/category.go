@@ -0,0 +1,166 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"errors"
+	"sort"
+)
+
+// Category classifies a problem for reports.
+type Category string
+
+const (
+	// CategoryTimeout is a Recv that timed out.
+	CategoryTimeout Category = "timeout"
+
+	// CategoryGuard is a Recv guard that returned a Failure.
+	CategoryGuard Category = "guard"
+
+	// CategoryChannel is a channel I/O problem.
+	CategoryChannel Category = "channel"
+
+	// CategoryJavascript is a Javascript error (but not a
+	// Failure).
+	CategoryJavascript Category = "javascript"
+
+	// CategorySchema is a test that didn't parse or validate or a
+	// payload that didn't validate against its JSON Schema.
+	CategorySchema Category = "schema"
+
+	// CategoryLatency is a step latency that regressed beyond the
+	// threshold that a latency gate allows.
+	CategoryLatency Category = "latency"
+
+	// CategoryCoverage is a test that executed fewer assertions
+	// than its Spec.MinAssertions.
+	CategoryCoverage Category = "coverage"
+
+	// CategoryLeak is a test that left channels or goroutines
+	// behind.  See Test.Finalize and Test.FailOnLeaks.
+	CategoryLeak Category = "leak"
+
+	// CategoryBroken is any other Broken problem.
+	CategoryBroken Category = "broken"
+
+	// CategoryFailure is any other failure.
+	CategoryFailure Category = "failure"
+)
+
+// ExitCodes maps each Category to a process exit code.
+var ExitCodes = map[Category]int{
+	CategoryFailure:    1,
+	CategoryBroken:     2,
+	CategoryTimeout:    3,
+	CategoryGuard:      4,
+	CategoryChannel:    5,
+	CategoryJavascript: 6,
+	CategorySchema:     7,
+	CategoryLatency:    8,
+	CategoryCoverage:   9,
+	CategoryLeak:       10,
+}
+
+// ExitCode returns the exit code for the Category, which is 1 if
+// the Category is unknown.
+func (c Category) ExitCode() int {
+	if n, have := ExitCodes[c]; have {
+		return n
+	}
+	return 1
+}
+
+// Categorized is an error with a Category.
+type Categorized struct {
+	Category Category
+	Err      error
+}
+
+// Categorize gives the error a Category.
+//
+// A *Broken stays a *Broken (with a categorized Err), and a nil
+// error stays nil.
+func Categorize(c Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	if b, is := err.(*Broken); is {
+		return NewBroken(&Categorized{
+			Category: c,
+			Err:      b.Err,
+		})
+	}
+	return &Categorized{
+		Category: c,
+		Err:      err,
+	}
+}
+
+func (c *Categorized) Error() string {
+	return c.Err.Error()
+}
+
+func (c *Categorized) Unwrap() error {
+	return c.Err
+}
+
+// CategoryOf returns the Category of the given error, which is ""
+// for a nil error.
+//
+// An error without an explicit Category is CategoryBroken (if
+// Broken) or CategoryFailure.  For Errors, the first problem
+// determines the Category.
+func CategoryOf(err error) Category {
+	if err == nil {
+		return ""
+	}
+
+	if es, is := err.(*Errors); is {
+		if es == nil {
+			return ""
+		}
+		if c := CategoryOf(es.InitErr); c != "" {
+			return c
+		}
+		if c := CategoryOf(es.Err); c != "" {
+			return c
+		}
+		names := make([]string, 0, len(es.FinalErrors))
+		for name := range es.FinalErrors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if c := CategoryOf(es.FinalErrors[name]); c != "" {
+				return c
+			}
+		}
+		return ""
+	}
+
+	var c *Categorized
+	if errors.As(err, &c) {
+		return c.Category
+	}
+
+	if _, is := IsBroken(err); is {
+		return CategoryBroken
+	}
+
+	return CategoryFailure
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCategoryOf(t *testing.T) {
+	timeout := Categorize(CategoryTimeout, fmt.Errorf("timeout"))
+
+	for _, c := range []struct {
+		name string
+		err  error
+		want Category
+	}{
+		{"nil", nil, ""},
+		{"plain", fmt.Errorf("oops"), CategoryFailure},
+		{"failure", Failure("no"), CategoryFailure},
+		{"broken", Brokenf("oops"), CategoryBroken},
+		{"timeout", timeout, CategoryTimeout},
+		{"wrapped", fmt.Errorf("phase p: %w", fmt.Errorf("step 1: %w", timeout)), CategoryTimeout},
+		{"broken-js", NewBroken(fmt.Errorf("step 1: %w", Categorize(CategoryJavascript, Brokenf("js")))), CategoryJavascript},
+		{"errors", &Errors{FinalErrors: map[string]error{"b": Brokenf("b"), "a": timeout}}, CategoryTimeout},
+		{"errors-fine", NewErrors(), ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := CategoryOf(c.err); got != c.want {
+				t.Fatal(got)
+			}
+		})
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	if Categorize(CategoryChannel, nil) != nil {
+		t.Fatal("nil")
+	}
+
+	err := Categorize(CategoryChannel, Brokenf("unsupported"))
+	if _, is := IsBroken(err); !is {
+		t.Fatal("should still be broken")
+	}
+	if err.Error() != "Broken: unsupported" {
+		t.Fatal(err.Error())
+	}
+	if c := CategoryOf(err); c != CategoryChannel {
+		t.Fatal(c)
+	}
+
+	if n := Category("nope").ExitCode(); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestJSCategory(t *testing.T) {
+	_, err := JSExec(NewCtx(nil), "nope(", nil)
+	if c := CategoryOf(err); c != CategoryJavascript {
+		t.Fatal(c)
+	}
+}
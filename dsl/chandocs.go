@@ -0,0 +1,214 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DocSpec documents a channel type and its options.
+//
+// A DocSpec is generated (see NewDocSpec) from the struct that the
+// channel type's options are deserialized into.  Each option's
+// description comes from the field's "doc" tag, and its default
+// comes from the "default" tag.
+type DocSpec struct {
+	Kind ChanKind  `json:"kind"`
+	Doc  string    `json:"doc,omitempty"`
+	Opts []*OptDoc `json:"opts,omitempty"`
+}
+
+// OptDoc documents a channel option.
+type OptDoc struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default,omitempty"`
+	Doc     string `json:"doc,omitempty"`
+
+	// Opts documents the fields of an option that is itself a
+	// struct.
+	Opts []*OptDoc `json:"opts,omitempty"`
+}
+
+// ChanDocs maps channel types to their DocSpecs.
+type ChanDocs map[ChanKind]*DocSpec
+
+// TheChanDocs has the documentation for channel types in
+// TheChanRegistry.
+var TheChanDocs = make(ChanDocs)
+
+// Register generates and registers the DocSpec for the given channel
+// type, whose options are deserialized into a value like opts (which
+// can be nil for a type without options).
+func (ds ChanDocs) Register(kind ChanKind, doc string, opts interface{}) {
+	ds[kind] = NewDocSpec(kind, doc, opts)
+}
+
+// NewDocSpec generates a DocSpec via reflection on opts, which
+// should be a struct (or a pointer to one) or nil.
+func NewDocSpec(kind ChanKind, doc string, opts interface{}) *DocSpec {
+	d := &DocSpec{
+		Kind: kind,
+		Doc:  doc,
+	}
+	if opts != nil {
+		d.Opts = optDocs(reflect.TypeOf(opts))
+	}
+	return d
+}
+
+func optDocs(t reflect.Type) []*OptDoc {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	acc := make([]*OptDoc, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			acc = append(acc, optDocs(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		name := f.Name
+		if tag, have := f.Tag.Lookup("json"); have {
+			if tag == "-" {
+				continue
+			}
+			if s := strings.Split(tag, ",")[0]; s != "" {
+				name = s
+			}
+		}
+		typ, sub := optType(f.Type)
+		if typ == "" {
+			continue
+		}
+		acc = append(acc, &OptDoc{
+			Name:    name,
+			Type:    typ,
+			Default: f.Tag.Get("default"),
+			Doc:     f.Tag.Get("doc"),
+			Opts:    sub,
+		})
+	}
+	return acc
+}
+
+// optType returns a name for the type of an option (and the
+// documentation for the fields of a struct).  The name is empty for
+// types (like channels) that can't be options.
+func optType(t reflect.Type) (string, []*OptDoc) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer", nil
+	case reflect.Float32, reflect.Float64:
+		return "number", nil
+	case reflect.Interface:
+		return "any", nil
+	case reflect.Slice, reflect.Array:
+		elem, _ := optType(t.Elem())
+		return "list of " + elem, nil
+	case reflect.Map:
+		elem, _ := optType(t.Elem())
+		return "map to " + elem, nil
+	case reflect.Struct:
+		return "object", optDocs(t)
+	default:
+		return "", nil
+	}
+}
+
+// Kinds returns the documented channel types in order.
+func (ds ChanDocs) Kinds() []ChanKind {
+	acc := make([]ChanKind, 0, len(ds))
+	for kind := range ds {
+		acc = append(acc, kind)
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		return acc[i] < acc[j]
+	})
+	return acc
+}
+
+// WriteText writes a plain-text summary of the DocSpec.
+func (d *DocSpec) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: %s\n", d.Kind, d.Doc)
+	writeOptsText(w, d.Opts, "  ")
+}
+
+func writeOptsText(w io.Writer, opts []*OptDoc, indent string) {
+	for _, o := range opts {
+		fmt.Fprintf(w, "%s%s (%s", indent, o.Name, o.Type)
+		if o.Default != "" {
+			fmt.Fprintf(w, ", default %s", o.Default)
+		}
+		fmt.Fprintf(w, ")")
+		if o.Doc != "" {
+			fmt.Fprintf(w, ": %s", o.Doc)
+		}
+		fmt.Fprintf(w, "\n")
+		writeOptsText(w, o.Opts, indent+"  ")
+	}
+}
+
+// WriteMarkdown writes a Markdown section for the DocSpec.
+func (d *DocSpec) WriteMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "## `%s`\n\n", d.Kind)
+	if d.Doc != "" {
+		fmt.Fprintf(w, "%s\n\n", d.Doc)
+	}
+	if len(d.Opts) == 0 {
+		fmt.Fprintf(w, "No options.\n\n")
+		return
+	}
+	fmt.Fprintf(w, "| Option | Type | Default | Description |\n")
+	fmt.Fprintf(w, "| --- | --- | --- | --- |\n")
+	writeOptsMarkdown(w, d.Opts, "")
+	fmt.Fprintf(w, "\n")
+}
+
+func writeOptsMarkdown(w io.Writer, opts []*OptDoc, prefix string) {
+	for _, o := range opts {
+		def := o.Default
+		if def != "" {
+			def = "`" + def + "`"
+		}
+		fmt.Fprintf(w, "| `%s%s` | %s | %s | %s |\n",
+			prefix, o.Name, o.Type, def, strings.ReplaceAll(o.Doc, "|", `\|`))
+		writeOptsMarkdown(w, o.Opts, prefix+o.Name+".")
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChanDocs(t *testing.T) {
+	type Inner struct {
+		Level int `json:"level" doc:"How much." default:"3"`
+	}
+	type Opts struct {
+		Process
+		Label   string   `json:"label,omitempty" doc:"The label."`
+		Tags    []string `doc:"Some tags."`
+		Inner   *Inner   `doc:"Nested."`
+		Ignored string   `json:"-"`
+		hidden  string
+		C       chan Msg
+	}
+
+	d := NewDocSpec("test", "A test channel.", Opts{})
+
+	var names []string
+	for _, o := range d.Opts {
+		names = append(names, o.Name)
+	}
+	if got, want := strings.Join(names, ","), "name,command,args,env,dir,label,Tags,Inner"; got != want {
+		t.Fatalf("got %s, wanted %s", got, want)
+	}
+
+	o := d.Opts[6]
+	if o.Type != "list of string" || o.Doc != "Some tags." {
+		t.Fatal(o)
+	}
+
+	o = d.Opts[7]
+	if o.Type != "object" || len(o.Opts) != 1 {
+		t.Fatal(o)
+	}
+	if sub := o.Opts[0]; sub.Name != "level" || sub.Type != "integer" || sub.Default != "3" {
+		t.Fatal(sub)
+	}
+
+	var buf bytes.Buffer
+	d.WriteMarkdown(&buf)
+	if !strings.Contains(buf.String(), "| `Inner.level` | integer | `3` | How much. |") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestChanDocsRegistered(t *testing.T) {
+	for kind := range TheChanRegistry {
+		if _, have := TheChanDocs[kind]; !have {
+			t.Errorf("no DocSpec for '%s'", kind)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"sync"
+	"time"
+)
+
+// ClockSpec configures a test's clock, which provides the time for
+// Javascript (now(), nowMs(), and elapsed) and test.T.
+type ClockSpec struct {
+	// Fake, when true, uses a virtual clock that moves only when
+	// advanced by a Wait step or by the Javascript advance().
+	//
+	// Channel timestamps and Recv timeouts still use real time.
+	Fake bool `json:",omitempty" yaml:",omitempty"`
+
+	// Start is the fake clock's initial time (RFC3339).  Defaults
+	// to the current time.
+	Start string `json:",omitempty" yaml:",omitempty"`
+}
+
+// FakeClock is a virtual clock.
+type FakeClock struct {
+	sync.Mutex
+	t time.Time
+}
+
+// NewFakeClock makes a FakeClock set to the given time.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{
+		t: t.UTC(),
+	}
+}
+
+// Now returns the clock's time.
+func (c *FakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward.
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.Lock()
+	defer c.Unlock()
+	c.t = c.t.Add(d)
+	return c.t
+}
+
+// initClock makes the fake clock (if any) for a Run.
+func (t *Test) initClock() error {
+	t.clock = nil
+	if t.Clock == nil || !t.Clock.Fake {
+		return nil
+	}
+	start := time.Now()
+	if t.Clock.Start != "" {
+		s, err := time.Parse(time.RFC3339Nano, t.Clock.Start)
+		if err != nil {
+			return Brokenf("bad Clock Start '%s': %s", t.Clock.Start, err)
+		}
+		start = s
+	}
+	t.clock = NewFakeClock(start)
+	t.T = t.clock.Now()
+	return nil
+}
+
+// Now returns the time according to the test's clock.
+func (t *Test) Now() time.Time {
+	if t.clock != nil {
+		return t.clock.Now()
+	}
+	return time.Now().UTC()
+}
+
+// wait sleeps for the given duration or, with a fake clock, advances
+// the clock.
+func (t *Test) wait(ctx *Ctx, d time.Duration) {
+	if t.clock == nil {
+		time.Sleep(d)
+		return
+	}
+	ctx.Indf("    Advancing fake clock %s", d)
+	t.clock.Advance(d)
+}
+
+// jsClockFuncs returns now(), nowMs(), and advance(duration), which
+// use the test's clock.
+func (t *Test) jsClockFuncs(ctx *Ctx) map[string]interface{} {
+	return map[string]interface{}{
+		"now": func() string {
+			return t.Now().Format(time.RFC3339Nano)
+		},
+		"nowMs": func() int64 {
+			return t.Now().UnixNano() / 1000 / 1000
+		},
+		"advance": func(s string) (string, error) {
+			if t.clock == nil {
+				return "", Brokenf("advance() requires a fake clock")
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return "", err
+			}
+			return t.clock.Advance(d).Format(time.RFC3339Nano), nil
+		},
+	}
+}
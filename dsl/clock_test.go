@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJSTimeFuncs(t *testing.T) {
+	ctx := NewCtx(nil)
+
+	for src, want := range map[string]interface{}{
+		`isoTime(tsMs("2021-01-02T03:04:05.678Z"))`:  "2021-01-02T03:04:05.678Z",
+		`parseDuration("1m30s") == 90000`:            true,
+		`formatDuration(90000)`:                      "1m30s",
+		`addDuration("2021-01-02T03:04:05Z", "-1h")`: "2021-01-02T02:04:05Z",
+		`Math.abs(nowMs() - tsMs(now())) < 1000`:     true,
+	} {
+		x, err := JSExec(ctx, src, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", src, err)
+		}
+		if x != want {
+			t.Fatalf("%s: %#v != %#v", src, x, want)
+		}
+	}
+
+	if _, err := JSExec(ctx, `parseDuration("soon")`, nil); err == nil {
+		t.Fatal("should have thrown")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	tst.Clock = &ClockSpec{
+		Fake:  true,
+		Start: "2021-01-02T03:04:05Z",
+	}
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+
+	p.AddStep(ctx, &Step{
+		Run: `if (now() != "2021-01-02T03:04:05Z") { return Failure(now()); }`,
+	})
+	p.AddStep(ctx, &Step{
+		// A fake clock doesn't sleep.
+		Wait: "1h",
+	})
+	p.AddStep(ctx, &Step{
+		Run: `
+if (elapsed != 3600000) { return Failure("elapsed " + elapsed); }
+advance("1m");
+if (now() != "2021-01-02T04:05:05Z") { return Failure(now()); }`,
+	})
+
+	then := time.Now()
+	run(t, ctx, tst)
+	if time.Second < time.Now().Sub(then) {
+		t.Fatal("fake clock slept")
+	}
+
+	t.Run("real", func(t *testing.T) {
+		ctx, s, tst := newTest(t)
+		p := &Phase{}
+		s.Phases["phase1"] = p
+		p.AddStep(ctx, &Step{
+			Run: `advance("1m");`,
+		})
+		if err := tst.Run(ctx); err == nil {
+			t.Fatal("advance() should require a fake clock")
+		}
+	})
+}
@@ -19,30 +19,80 @@ package dsl
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 )
 
 func init() {
 	TheChanRegistry.Register(NewCtx(nil), "cmd", NewCmdChan)
+	TheChanDocs.Register("cmd", "A subprocess whose stdin receives published messages and whose stdout lines are received messages.", CmdOpts{})
+}
+
+// CmdOpts configures a CmdChan.
+type CmdOpts struct {
+	Process
+
+	// KillSignal is the signal that Kill sends.  Defaults to
+	// "KILL".
+	KillSignal string `json:"killsignal,omitempty" yaml:"killsignal,omitempty" doc:"The signal that kill sends." default:"KILL"`
+
+	// BufferSize is the capacity of the channel's Buffer.
+	BufferSize int `json:"buffersize,omitempty" yaml:"buffersize,omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the Buffer's overflow policy for messages
+	// delivered with To.  Output from the subprocess waits for
+	// room in the Buffer.
+	Overflow string `json:"overflow,omitempty" yaml:"overflow,omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
 }
 
 // CmdChan is a channel that's backed by a subprocess.
+//
+// The subprocess's stdout and stderr lines arrive as messages with
+// topics "stdout" and "stderr".  When the subprocess terminates, a
+// final message with topic "exit" has a ProcessExit payload.
+//
+// A message published with topic "eof" closes the subprocess's
+// stdin, and a message with topic "signal" sends the signal named
+// by its payload (see ParseSignal).  Other messages are written to
+// the subprocess's stdin.
 type CmdChan struct {
-	p *Process
-	c chan Msg
+	p   *Process
+	c   chan Msg
+	buf *Buffer
+
+	killSignal string
+
+	// mu protects eofed.
+	mu sync.Mutex
+
+	// eofed reports whether the subprocess's stdin is closed.
+	eofed bool
 }
 
 // NewCmdChan obviously makes a new CmdChan.
 //
-// The cfg should represent a Process.
+// The cfg should represent a CmdOpts.
 func NewCmdChan(ctx *Ctx, cfg interface{}) (Chan, error) {
-	var p Process
-	if err := As(cfg, &p); err != nil {
+	var opts CmdOpts
+	if err := As(cfg, &opts); err != nil {
+		return nil, err
+	}
+	if opts.KillSignal == "" {
+		opts.KillSignal = "KILL"
+	}
+	if _, err := ParseSignal(opts.KillSignal); err != nil {
+		return nil, err
+	}
+	buf, err := NewBuffer("cmd", opts.BufferSize, opts.Overflow)
+	if err != nil {
 		return nil, err
 	}
 	return &CmdChan{
-		p: &p,
-		c: make(chan Msg, 1024),
+		p:          &opts.Process,
+		c:          buf.C,
+		buf:        buf,
+		killSignal: opts.KillSignal,
 	}, nil
 }
 
@@ -58,10 +108,11 @@ func (c *CmdChan) Open(ctx *Ctx) error {
 	}
 
 	go func() {
-		pub := func(topic, payload string) {
+		pub := func(topic string, payload interface{}) {
 			msg := Msg{
-				Topic:   topic,
-				Payload: payload,
+				Topic:      topic,
+				Payload:    payload,
+				ReceivedAt: time.Now().UTC(),
 			}
 			select {
 			case <-ctx.Done():
@@ -70,14 +121,22 @@ func (c *CmdChan) Open(ctx *Ctx) error {
 			}
 		}
 
+		var (
+			stdout = c.p.Stdout
+			stderr = c.p.Stderr
+		)
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case line := <-c.p.Stdout:
+			case line := <-stdout:
 				pub("stdout", line)
-			case line := <-c.p.Stderr:
+			case line := <-stderr:
 				pub("stderr", line)
+			case x := <-c.p.Exited:
+				// All output has been consumed.
+				pub("exit", Canon(x))
+				return
 			}
 		}
 	}()
@@ -88,24 +147,68 @@ func (c *CmdChan) Open(ctx *Ctx) error {
 // Close currently just closes the subprocess's stdin.
 func (c *CmdChan) Close(ctx *Ctx) error {
 	ctx.Logf("CmdChan %s Close", c.p.Name)
-	close(c.p.Stdin)
+	c.eof()
 	return nil
 }
 
+// eof closes the subprocess's stdin (if it's not already closed).
+func (c *CmdChan) eof() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.eofed {
+		c.eofed = true
+		close(c.p.Stdin)
+	}
+}
+
 // Sub doesn't currently do anything.
-//
-// ToDo: Have stdout and stderr "topics".
 func (c *CmdChan) Sub(ctx *Ctx, topic string) error {
 	ctx.Logf("CmdChan %s Sub", c.p.Name)
 	return nil
 }
 
-// Pub sends the given message payload to the subprocess's stdin.
+// Pub sends the given message payload to the subprocess's stdin
+// (with a terminating newline if needed).  A payload that isn't a
+// string is written as JSON.
 //
-// The topic is ignored.
+// The topics "eof" and "signal" are special.  See CmdChan.
 func (c *CmdChan) Pub(ctx *Ctx, m Msg) error {
-	ctx.Logf("CmdChan %s Pub", c.p.Name)
-	return c.To(ctx, m)
+	ctx.Logf("CmdChan %s Pub %s", c.p.Name, m.Topic)
+
+	switch m.Topic {
+	case "eof":
+		c.eof()
+		return nil
+	case "signal":
+		name, is := m.Payload.(string)
+		if !is {
+			name = JSON(m.Payload)
+		}
+		return c.p.Signal(ctx, strings.Trim(name, `"`))
+	}
+
+	line, is := m.Payload.(string)
+	if !is {
+		line = JSON(m.Payload)
+	}
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.eofed {
+		return fmt.Errorf("CmdChan %s: stdin is closed", c.p.Name)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case c.p.Stdin <- line:
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("CmdChan %s: timeout writing to stdin", c.p.Name)
+	}
+	return nil
 }
 
 func (c *CmdChan) Recv(ctx *Ctx) chan Msg {
@@ -113,24 +216,20 @@ func (c *CmdChan) Recv(ctx *Ctx) chan Msg {
 	return c.c
 }
 
-// Kill is not currently supported.  (It should be.)
-//
-// ToDo: Terminate the subprocess ungracefully.
+// Kill sends the subprocess the configured KillSignal.
 func (c *CmdChan) Kill(ctx *Ctx) error {
-	return fmt.Errorf("CmdChan %s: Kill is not yet supported", c.p.Name)
+	return c.p.Signal(ctx, c.killSignal)
 }
 
-// To sends the given message payload to the subprocess's stdin.
-//
-// The topic is ignored.
+// To delivers the given message as if it came from the subprocess.
 func (c *CmdChan) To(ctx *Ctx, m Msg) error {
 	ctx.Logf("CmdChan %s To", c.p.Name)
 	m.ReceivedAt = time.Now().UTC()
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
-	default:
-		panic("Warning: CmdChan channel full")
-	}
-	return nil
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of the channel's Buffer.  See
+// Overflower.
+func (c *CmdChan) Overflow() error {
+	return c.buf.Overflow()
 }
@@ -70,3 +70,96 @@ func TestNewCmdChan(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCmdChanKill(t *testing.T) {
+	ctx := NewCtx(nil)
+
+	c, err := NewCmdChan(ctx, map[string]interface{}{
+		"name":       "test-sleep",
+		"command":    "sleep",
+		"args":       []string{"10"},
+		"killsignal": "TERM",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Kill(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-c.Recv(ctx):
+		if m.Topic != "exit" {
+			t.Fatal(m.Topic)
+		}
+		if js := JSON(m.Payload); js != `{"code":-1,"status":"signal: terminated"}` {
+			t.Fatal(js)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exit")
+	}
+
+	if err = c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, Msg{Payload: "late"}); err == nil {
+		t.Fatal("should have complained")
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"TERM", "sigint", "KILL", "9"} {
+		if _, err := ParseSignal(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ParseSignal("nope"); err == nil {
+		t.Fatal("should have complained")
+	}
+}
+
+func TestCmdChanCtxEnv(t *testing.T) {
+	ctx := NewCtx(nil)
+	ctx.Env = map[string]string{
+		"PLAX_DISH":  "tacos",
+		"PLAX_DRINK": "water",
+	}
+
+	c, err := NewCmdChan(ctx, map[string]interface{}{
+		"name":    "test-env",
+		"command": "sh",
+		"args":    []string{"-c", "echo $PLAX_DISH $PLAX_DRINK"},
+		"env": map[string]string{
+			// The Process's Env takes precedence.
+			"PLAX_DRINK": "tea",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	for {
+		select {
+		case m := <-c.Recv(ctx):
+			if m.Topic != "stdout" {
+				continue
+			}
+			if m.Payload != "tacos tea" {
+				t.Fatal(m.Payload)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("no output")
+		}
+	}
+}
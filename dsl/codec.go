@@ -0,0 +1,272 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Payload formats for Pub.PayloadFormat and Recv.PayloadFormat.
+const (
+	PayloadFormatJSON     = "json"
+	PayloadFormatXML      = "xml"
+	PayloadFormatProtobuf = "protobuf"
+	PayloadFormatAvro     = "avro"
+)
+
+// PayloadEncodingBase64 is the PayloadEncoding for raw bytes
+// represented (in a test) as base64.
+const PayloadEncodingBase64 = "base64"
+
+// checkPayloadFormat returns an error if the format isn't known.
+func checkPayloadFormat(format string) error {
+	switch format {
+	case "", PayloadFormatJSON, PayloadFormatXML, PayloadFormatProtobuf, PayloadFormatAvro:
+		return nil
+	}
+	return Brokenf("unknown PayloadFormat '%s'", format)
+}
+
+// Codec converts between structured payloads, which patterns and
+// bindings use, and the payloads that channels carry.
+type Codec interface {
+	// Encode converts a structured payload to a channel payload.
+	Encode(x interface{}) (string, error)
+
+	// Decode converts a channel payload to a structured payload.
+	Decode(x interface{}) (interface{}, error)
+}
+
+// checkCodecSpecs returns an error if the format doesn't have the
+// spec it needs or if there's a spec the format doesn't use.
+func checkCodecSpecs(format, encoding string, proto *ProtoSpec, avro *AvroSpec) error {
+	if err := checkPayloadFormat(format); err != nil {
+		return err
+	}
+	switch encoding {
+	case "":
+	case PayloadEncodingBase64:
+		if format != "" && format != PayloadFormatJSON {
+			return Brokenf("PayloadEncoding %s can't be used with PayloadFormat %s", encoding, format)
+		}
+	default:
+		return Brokenf("unknown PayloadEncoding '%s'", encoding)
+	}
+	if (format == PayloadFormatProtobuf) != (proto != nil) {
+		return Brokenf("Proto requires PayloadFormat %s (and vice versa)", PayloadFormatProtobuf)
+	}
+	if (format == PayloadFormatAvro) != (avro != nil) {
+		return Brokenf("Avro requires PayloadFormat %s (and vice versa)", PayloadFormatAvro)
+	}
+	return nil
+}
+
+// codec returns the Codec (if any) for the given format and
+// encoding.  A nil Codec means JSON.
+func (t *Test) codec(ctx *Ctx, format, encoding string, proto *ProtoSpec, avro *AvroSpec) (Codec, error) {
+	if err := checkCodecSpecs(format, encoding, proto, avro); err != nil {
+		return nil, err
+	}
+	if encoding == PayloadEncodingBase64 {
+		return base64Codec{}, nil
+	}
+	switch format {
+	case PayloadFormatXML:
+		return xmlCodec{}, nil
+	case PayloadFormatProtobuf:
+		return t.protoCodec(ctx, proto)
+	case PayloadFormatAvro:
+		return t.avroCodec(ctx, avro)
+	}
+	return nil, nil
+}
+
+// xmlCodec uses FormatXML and ParseXML.
+type xmlCodec struct {
+}
+
+// Encode uses a string as is and otherwise calls FormatXML.
+func (c xmlCodec) Encode(x interface{}) (string, error) {
+	if s, is := x.(string); is {
+		return s, nil
+	}
+	return FormatXML(x)
+}
+
+func (c xmlCodec) Decode(x interface{}) (interface{}, error) {
+	s, is := x.(string)
+	if !is {
+		return nil, fmt.Errorf("XML payload is a %T and not a string", x)
+	}
+	return ParseXML(s)
+}
+
+// base64Codec converts between raw bytes and their (standard)
+// base64 representations.
+type base64Codec struct {
+}
+
+// Encode decodes the base64 string to get the raw bytes.
+//
+// Since bindings substitution might have parsed a base64 string
+// (like "1234") as JSON, a payload that isn't a string is serialized
+// as JSON first.
+func (c base64Codec) Encode(x interface{}) (string, error) {
+	s, is := x.(string)
+	if !is {
+		js, err := json.Marshal(&x)
+		if err != nil {
+			return "", err
+		}
+		s = string(js)
+	}
+	bs, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("base64 payload: %w", err)
+	}
+	return string(bs), nil
+}
+
+// Decode returns the base64 representation of the raw bytes.
+func (c base64Codec) Decode(x interface{}) (interface{}, error) {
+	switch vv := x.(type) {
+	case string:
+		return base64.StdEncoding.EncodeToString([]byte(vv)), nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(vv), nil
+	}
+	return nil, fmt.Errorf("base64 payload is a %T and not bytes", x)
+}
+
+// ProtoSpec specifies a protobuf message type.
+type ProtoSpec struct {
+	// Descriptors is the name of a file that contains a
+	// serialized FileDescriptorSet, which
+	//
+	//   protoc --include_imports --descriptor_set_out=FILE ...
+	//
+	// can generate.  A relative filename is relative to the
+	// test's directory.
+	Descriptors string
+
+	// Message is the full name of the message type (for example,
+	// "demo.Order").
+	Message string
+}
+
+// protoCodec converts between protobuf payloads and the structure of
+// their JSON representations (with the field names from the .proto
+// file).
+type protoCodec struct {
+	desc protoreflect.MessageDescriptor
+}
+
+func (t *Test) protoCodec(ctx *Ctx, spec *ProtoSpec) (*protoCodec, error) {
+	filename := t.testFile(spec.Descriptors)
+
+	if t.protoFiles == nil {
+		t.protoFiles = make(map[string]*protoregistry.Files)
+	}
+	files, have := t.protoFiles[filename]
+	if !have {
+		bs, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, Brokenf("proto descriptors: %s", err)
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err = proto.Unmarshal(bs, &fds); err != nil {
+			return nil, Brokenf("proto descriptors %s: %s", filename, err)
+		}
+		if files, err = protodesc.NewFiles(&fds); err != nil {
+			return nil, Brokenf("proto descriptors %s: %s", filename, err)
+		}
+		t.protoFiles[filename] = files
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(spec.Message))
+	if err != nil {
+		return nil, Brokenf("proto message %s: %s", spec.Message, err)
+	}
+	md, is := d.(protoreflect.MessageDescriptor)
+	if !is {
+		return nil, Brokenf("proto %s isn't a message", spec.Message)
+	}
+
+	return &protoCodec{
+		desc: md,
+	}, nil
+}
+
+// Encode accepts a structured payload or a JSON string.
+func (c *protoCodec) Encode(x interface{}) (string, error) {
+	js, is := x.(string)
+	if !is {
+		bs, err := json.Marshal(&x)
+		if err != nil {
+			return "", err
+		}
+		js = string(bs)
+	}
+
+	m := dynamicpb.NewMessage(c.desc)
+	if err := protojson.Unmarshal([]byte(js), m); err != nil {
+		return "", fmt.Errorf("protobuf %s encoding: %w", c.desc.FullName(), err)
+	}
+	bs, err := proto.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func (c *protoCodec) Decode(x interface{}) (interface{}, error) {
+	var bs []byte
+	switch vv := x.(type) {
+	case string:
+		bs = []byte(vv)
+	case []byte:
+		bs = vv
+	default:
+		return nil, fmt.Errorf("protobuf payload is a %T and not bytes", x)
+	}
+
+	m := dynamicpb.NewMessage(c.desc)
+	if err := proto.Unmarshal(bs, m); err != nil {
+		return nil, fmt.Errorf("protobuf %s decoding: %w", c.desc.FullName(), err)
+	}
+	js, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var y interface{}
+	if err = json.Unmarshal(js, &y); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
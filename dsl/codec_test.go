@@ -0,0 +1,112 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestProtoCodec(t *testing.T) {
+	tst := NewTest(NewCtx(nil), "test", nil)
+	tst.Dir = "../demos"
+
+	c, err := tst.codec(NewCtx(nil), PayloadFormatProtobuf, "", &ProtoSpec{
+		Descriptors: "order.desc",
+		Message:     "demo.Order",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := c.Encode(dejson(`{"id":42,"items":["taco","queso"],"customer":{"name":"Homer"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := c.Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if js := JSON(x); js != `{"customer":{"name":"Homer"},"id":42,"items":["taco","queso"]}` {
+		t.Fatal(js)
+	}
+
+	if _, err = c.Encode(`{"id":"nope"}`); err == nil {
+		t.Fatal("should have complained")
+	}
+	if _, err = c.Decode(42); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	if _, err = tst.codec(NewCtx(nil), PayloadFormatProtobuf, "", &ProtoSpec{
+		Descriptors: "order.desc",
+		Message:     "demo.Nope",
+	}, nil); err == nil {
+		t.Fatal("should have complained")
+	}
+	if _, err = tst.codec(NewCtx(nil), PayloadFormatProtobuf, "", nil, nil); err == nil {
+		t.Fatal("should have complained")
+	}
+}
+
+func TestBase64Codec(t *testing.T) {
+	c, err := NewTest(NewCtx(nil), "", nil).codec(NewCtx(nil), "", PayloadEncodingBase64, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := "\x89PNG\r\n\x1a\n\x00\xff"
+	x, err := c.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != "iVBORw0KGgoA/w==" {
+		t.Fatal(x)
+	}
+	if x, err = c.Decode([]byte(raw)); err != nil || x != "iVBORw0KGgoA/w==" {
+		t.Fatal(x, err)
+	}
+
+	s, err := c.Encode("iVBORw0KGgoA/w==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != raw {
+		t.Fatalf("%q", s)
+	}
+
+	// A base64 string that looks like a number.
+	if s, err = c.Encode(float64(1234)); err != nil || s != "\xd7m\xf8" {
+		t.Fatalf("%q %v", s, err)
+	}
+
+	if _, err = c.Encode("not base64!"); err == nil {
+		t.Fatal("should have complained")
+	}
+	if _, err = c.Decode(42); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	for _, format := range []string{PayloadFormatXML, PayloadFormatProtobuf} {
+		if err := checkCodecSpecs(format, PayloadEncodingBase64, nil, nil); err == nil {
+			t.Fatalf("%s: should have complained", format)
+		}
+	}
+	if err := checkCodecSpecs("", "hex", nil, nil); err == nil {
+		t.Fatal("should have complained")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// bindingCheck matches a condition that just names a binding (like
+// "?ready").
+var bindingCheck = regexp.MustCompile(`^\?\S+$`)
+
+// returns matches Javascript that returns its own value.
+var returns = regexp.MustCompile(`\breturn\b`)
+
+// condition evaluates a Step's If or Unless.
+//
+// A condition that's just a binding name (like "?ready") holds when
+// that variable is bound to something other than false, null, 0, or
+// "".  Otherwise the condition is Javascript (subject to bindings
+// substitution), which is either an expression or, if it says
+// 'return', a function body (like a Branch).  The Javascript's
+// value is interpreted the same way.
+func (t *Test) condition(ctx *Ctx, cond string) (bool, error) {
+	cond = strings.TrimSpace(cond)
+	if bindingCheck.MatchString(cond) {
+		return truthy(t.Bindings[cond]), nil
+	}
+
+	code, err := t.Bindings.StringSub(ctx, cond)
+	if err != nil {
+		return false, err
+	}
+	if !returns.MatchString(code) {
+		code = "return (" + code + ");"
+	}
+	src, err := t.prepareSource(ctx, code)
+	if err != nil {
+		return false, err
+	}
+	x, err := t.JSExec(ctx, src, t.jsEnv(ctx))
+	if err != nil {
+		return false, err
+	}
+	return truthy(x), nil
+}
+
+// truthy reports whether x is something other than nil, false, zero,
+// or the empty string.
+func truthy(x interface{}) bool {
+	switch vv := x.(type) {
+	case nil:
+		return false
+	case bool:
+		return vv
+	case string:
+		return vv != ""
+	case int:
+		return vv != 0
+	case int64:
+		return vv != 0
+	case float64:
+		return vv != 0
+	}
+	return true
+}
+
+// conditionsHold reports whether the Step's If and Unless (if any)
+// allow the Step to execute.
+func (s *Step) conditionsHold(ctx *Ctx, t *Test) (bool, error) {
+	if s.If != "" {
+		holds, err := t.condition(ctx, s.If)
+		if err != nil || !holds {
+			return false, err
+		}
+	}
+	if s.Unless != "" {
+		holds, err := t.condition(ctx, s.Unless)
+		if err != nil || holds {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStepConditions(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	for _, c := range []struct {
+		name   string
+		step   *Step
+		wanted bool
+	}{
+		{"binding", &Step{If: "?ready"}, true},
+		{"unbound", &Step{If: "?missing"}, false},
+		{"false binding", &Step{If: "?off"}, false},
+		{"expression", &Step{If: `bs["?n"] > 2`}, true},
+		{"substituted", &Step{If: `"{?mode}" == "fast"`}, true},
+		{"body", &Step{If: `return bs["?n"] < 2;`}, false},
+		{"unless", &Step{Unless: "?ready"}, false},
+		{"unless unbound", &Step{Unless: "?missing"}, true},
+		{"both", &Step{If: "?ready", Unless: "?off"}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.step.Run = "test.State.ran = true;"
+			tst := NewTest(ctx, "a", &Spec{
+				Phases: map[string]*Phase{
+					"phase1": {
+						Steps: []*Step{c.step},
+					},
+				},
+			})
+			tst.Bindings = Bindings{
+				"?ready": "yes",
+				"?off":   false,
+				"?n":     3,
+				"?mode":  "fast",
+			}
+			if err := tst.Run(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, ran := tst.State["ran"]; ran != c.wanted {
+				t.Fatal(ran)
+			}
+			if len(tst.Skipped) != 0 {
+				t.Fatal(tst.Skipped)
+			}
+		})
+	}
+}
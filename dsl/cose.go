@@ -0,0 +1,498 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// COSE (RFC 8152) message tags, header labels, and algorithm
+// identifiers.
+const (
+	coseEncrypt0Tag = 16
+	coseMac0Tag     = 17
+	coseSign1Tag    = 18
+
+	coseAlgLabel = 1
+	coseKidLabel = 4
+	coseIVLabel  = 5
+)
+
+var coseAlgs = map[string]int64{
+	"ES256":   -7,
+	"RS256":   -257,
+	"HS256":   5,
+	"A128GCM": 1,
+	"A192GCM": 2,
+	"A256GCM": 3,
+}
+
+// coseProtect is Protect for the "cose" format.
+func (c *Crypto) coseProtect(ctx *Ctx, s string) (string, error) {
+	if c.Sign == nil && c.Encrypt == nil {
+		return s, nil
+	}
+
+	var (
+		bs  = []byte(s)
+		err error
+	)
+
+	if c.Sign != nil {
+		ctx.Inddf("    Signing payload (%s)", c.Sign.Alg)
+		if bs, err = c.Sign.coseSign(bs); err != nil {
+			return "", err
+		}
+	}
+
+	if c.Encrypt != nil {
+		ctx.Inddf("    Encrypting payload (%s)", c.Encrypt.Alg)
+		if bs, err = c.Encrypt.coseEncrypt(bs); err != nil {
+			return "", err
+		}
+	}
+
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
+
+// coseUnprotect is Unprotect for the "cose" format.
+//
+// The payload is usually base64, but a payload that isn't base64 is
+// taken to be the COSE message itself.
+func (c *Crypto) coseUnprotect(s string) (interface{}, error) {
+	if c.Sign == nil && c.Encrypt == nil {
+		return MaybeParseJSON(s), nil
+	}
+
+	bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		bs = []byte(s)
+	}
+
+	if c.Encrypt != nil {
+		if bs, err = c.Encrypt.coseDecrypt(bs); err != nil {
+			return nil, cryptoFailed("decryption", err)
+		}
+	}
+
+	if c.Sign != nil {
+		if bs, err = c.Sign.coseVerify(bs); err != nil {
+			return nil, cryptoFailed("verification", err)
+		}
+	}
+
+	return MaybeParseJSON(string(bs)), nil
+}
+
+// coseHeaders returns the encoded protected header (which carries the
+// algorithm) and the unprotected header (which carries any key id).
+func (k *CryptoKey) coseHeaders() ([]byte, map[interface{}]interface{}, error) {
+	alg, have := coseAlgs[k.Alg]
+	if !have {
+		return nil, nil, Brokenf("unsupported COSE algorithm '%s'", k.Alg)
+	}
+	protected, err := cborEncode(map[interface{}]interface{}{
+		int64(coseAlgLabel): alg,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	unprotected := map[interface{}]interface{}{}
+	if k.KeyId != "" {
+		unprotected[int64(coseKidLabel)] = []byte(k.KeyId)
+	}
+	return protected, unprotected, nil
+}
+
+// coseSignContext returns the message tag and the Sig_structure (or
+// MAC_structure) context string for the key's algorithm.
+func (k *CryptoKey) coseSignContext() (uint64, string) {
+	if k.Alg == "HS256" {
+		return coseMac0Tag, "MAC0"
+	}
+	return coseSign1Tag, "Signature1"
+}
+
+// coseSign returns a COSE_Sign1 (or, for HS256, a COSE_Mac0) message
+// for the given payload.
+func (k *CryptoKey) coseSign(payload []byte) ([]byte, error) {
+	protected, unprotected, err := k.coseHeaders()
+	if err != nil {
+		return nil, err
+	}
+	tag, context := k.coseSignContext()
+	tbs, err := cborEncode([]interface{}{context, protected, []byte{}, payload})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := k.sign(tbs)
+	if err != nil {
+		return nil, err
+	}
+	return cborEncode(cborTag{
+		Num: tag,
+		Val: []interface{}{protected, unprotected, payload, sig},
+	})
+}
+
+// coseVerify checks a COSE_Sign1 (or COSE_Mac0) message and returns
+// its payload.
+func (k *CryptoKey) coseVerify(bs []byte) ([]byte, error) {
+	tag, context := k.coseSignContext()
+	parts, err := k.coseMessage(bs, tag, 4)
+	if err != nil {
+		return nil, err
+	}
+	payload, is := parts[2].([]byte)
+	if !is {
+		return nil, fmt.Errorf("COSE payload is a %T (detached payloads aren't supported)", parts[2])
+	}
+	sig, is := parts[3].([]byte)
+	if !is {
+		return nil, fmt.Errorf("COSE signature is a %T", parts[3])
+	}
+	tbs, err := cborEncode([]interface{}{context, parts[0], []byte{}, payload})
+	if err != nil {
+		return nil, err
+	}
+	if err = k.verify(tbs, sig); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// coseEncrypt returns a COSE_Encrypt0 message for the given
+// plaintext.
+func (k *CryptoKey) coseEncrypt(plaintext []byte) ([]byte, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	protected, unprotected, err := k.coseHeaders()
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(iv); err != nil {
+		return nil, err
+	}
+	unprotected[int64(coseIVLabel)] = iv
+	aad, err := cborEncode([]interface{}{"Encrypt0", protected, []byte{}})
+	if err != nil {
+		return nil, err
+	}
+	return cborEncode(cborTag{
+		Num: coseEncrypt0Tag,
+		Val: []interface{}{protected, unprotected, gcm.Seal(nil, iv, plaintext, aad)},
+	})
+}
+
+// coseDecrypt decrypts a COSE_Encrypt0 message.
+func (k *CryptoKey) coseDecrypt(bs []byte) ([]byte, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	parts, err := k.coseMessage(bs, coseEncrypt0Tag, 3)
+	if err != nil {
+		return nil, err
+	}
+	unprotected, _ := parts[1].(map[interface{}]interface{})
+	iv, is := unprotected[int64(coseIVLabel)].([]byte)
+	if !is || len(iv) != gcm.NonceSize() {
+		return nil, fmt.Errorf("COSE_Encrypt0 needs a %d-byte IV", gcm.NonceSize())
+	}
+	ciphertext, is := parts[2].([]byte)
+	if !is {
+		return nil, fmt.Errorf("COSE ciphertext is a %T", parts[2])
+	}
+	aad, err := cborEncode([]interface{}{"Encrypt0", parts[0], []byte{}})
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, iv, ciphertext, aad)
+}
+
+// coseMessage decodes a COSE message with the given tag (which is
+// optional) and number of parts.  The first part (the protected
+// header) must specify the key's algorithm.
+func (k *CryptoKey) coseMessage(bs []byte, tag uint64, n int) ([]interface{}, error) {
+	want, have := coseAlgs[k.Alg]
+	if !have {
+		return nil, Brokenf("unsupported COSE algorithm '%s'", k.Alg)
+	}
+	x, err := cborDecode(bs)
+	if err != nil {
+		return nil, err
+	}
+	if t, is := x.(cborTag); is {
+		if t.Num != tag {
+			return nil, fmt.Errorf("COSE tag %d isn't %d", t.Num, tag)
+		}
+		x = t.Val
+	}
+	parts, is := x.([]interface{})
+	if !is || len(parts) != n {
+		return nil, fmt.Errorf("COSE message isn't an array of %d items", n)
+	}
+	protected, is := parts[0].([]byte)
+	if !is {
+		return nil, fmt.Errorf("COSE protected header is a %T", parts[0])
+	}
+	var headers map[interface{}]interface{}
+	if 0 < len(protected) {
+		h, err := cborDecode(protected)
+		if err != nil {
+			return nil, err
+		}
+		if headers, is = h.(map[interface{}]interface{}); !is {
+			return nil, fmt.Errorf("COSE protected header is a %T", h)
+		}
+	}
+	if alg, _ := headers[int64(coseAlgLabel)].(int64); alg != want {
+		return nil, fmt.Errorf("COSE algorithm %v isn't %s (%d)", headers[int64(coseAlgLabel)], k.Alg, want)
+	}
+	return parts, nil
+}
+
+// cborTag is a CBOR tagged value.
+type cborTag struct {
+	Num uint64
+	Val interface{}
+}
+
+// cborEncode encodes the subset of CBOR (RFC 7049) that COSE uses:
+// integers, byte strings, text strings, arrays, maps, and tags.  Map
+// keys are sorted by their encodings.
+func cborEncode(x interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cborWrite(&buf, x); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= 0xff:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= 0xffff:
+		buf.Write([]byte{major | 25, byte(n >> 8), byte(n)})
+	case n <= 0xffffffff:
+		buf.Write([]byte{major | 26, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	default:
+		buf.WriteByte(major | 27)
+		for i := 56; 0 <= i; i -= 8 {
+			buf.WriteByte(byte(n >> uint(i)))
+		}
+	}
+}
+
+func cborWrite(buf *bytes.Buffer, x interface{}) error {
+	switch vv := x.(type) {
+	case int:
+		return cborWrite(buf, int64(vv))
+	case int64:
+		if vv < 0 {
+			cborHead(buf, 1, uint64(-1-vv))
+		} else {
+			cborHead(buf, 0, uint64(vv))
+		}
+	case uint64:
+		cborHead(buf, 0, vv)
+	case []byte:
+		cborHead(buf, 2, uint64(len(vv)))
+		buf.Write(vv)
+	case string:
+		cborHead(buf, 3, uint64(len(vv)))
+		buf.WriteString(vv)
+	case []interface{}:
+		cborHead(buf, 4, uint64(len(vv)))
+		for _, y := range vv {
+			if err := cborWrite(buf, y); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		type entry struct{ k, v []byte }
+		entries := make([]entry, 0, len(vv))
+		for k, v := range vv {
+			kbs, err := cborEncode(k)
+			if err != nil {
+				return err
+			}
+			vbs, err := cborEncode(v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{kbs, vbs})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].k, entries[j].k
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return bytes.Compare(a, b) < 0
+		})
+		cborHead(buf, 5, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.k)
+			buf.Write(e.v)
+		}
+	case cborTag:
+		cborHead(buf, 6, vv.Num)
+		return cborWrite(buf, vv.Val)
+	case bool:
+		if vv {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case nil:
+		buf.WriteByte(0xf6)
+	default:
+		return fmt.Errorf("can't CBOR-encode a %T", x)
+	}
+	return nil
+}
+
+// cborDecode decodes a single CBOR item (in the subset that
+// cborEncode writes).  Integers become int64s, and maps become
+// map[interface{}]interface{}.
+func cborDecode(bs []byte) (interface{}, error) {
+	x, rest, err := cborRead(bs, 0)
+	if err != nil {
+		return nil, err
+	}
+	if 0 < len(rest) {
+		return nil, fmt.Errorf("%d bytes of trailing CBOR", len(rest))
+	}
+	return x, nil
+}
+
+// cborMaxDepth limits the nesting that cborRead will follow.
+const cborMaxDepth = 16
+
+func cborRead(bs []byte, depth int) (interface{}, []byte, error) {
+	if cborMaxDepth < depth {
+		return nil, nil, fmt.Errorf("CBOR nested too deeply")
+	}
+	if len(bs) == 0 {
+		return nil, nil, fmt.Errorf("truncated CBOR")
+	}
+	major, info := bs[0]>>5, bs[0]&0x1f
+	bs = bs[1:]
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(bs) < size {
+			return nil, nil, fmt.Errorf("truncated CBOR")
+		}
+		for _, b := range bs[:size] {
+			n = n<<8 | uint64(b)
+		}
+		bs = bs[size:]
+	default:
+		return nil, nil, fmt.Errorf("unsupported CBOR additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		if n>>63 != 0 {
+			return nil, nil, fmt.Errorf("CBOR integer %d too large", n)
+		}
+		return int64(n), bs, nil
+	case 1:
+		if n>>63 != 0 {
+			return nil, nil, fmt.Errorf("CBOR integer -1-%d too small", n)
+		}
+		return -1 - int64(n), bs, nil
+	case 2, 3:
+		if uint64(len(bs)) < n {
+			return nil, nil, fmt.Errorf("truncated CBOR")
+		}
+		if major == 2 {
+			return append([]byte{}, bs[:n]...), bs[n:], nil
+		}
+		return string(bs[:n]), bs[n:], nil
+	case 4:
+		if uint64(len(bs)) < n {
+			return nil, nil, fmt.Errorf("truncated CBOR")
+		}
+		xs := make([]interface{}, n)
+		for i := range xs {
+			x, rest, err := cborRead(bs, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			xs[i], bs = x, rest
+		}
+		return xs, bs, nil
+	case 5:
+		// Each entry needs at least two bytes.
+		if uint64(len(bs))/2 < n {
+			return nil, nil, fmt.Errorf("truncated CBOR")
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, rest, err := cborRead(bs, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("unsupported CBOR map key type %T", k)
+			}
+			v, rest, err := cborRead(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[k], bs = v, rest
+		}
+		return m, bs, nil
+	case 6:
+		x, rest, err := cborRead(bs, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cborTag{Num: n, Val: x}, rest, nil
+	default:
+		switch info {
+		case 20:
+			return false, bs, nil
+		case 21:
+			return true, bs, nil
+		case 22:
+			return nil, bs, nil
+		}
+		return nil, nil, fmt.Errorf("unsupported CBOR simple value %d", info)
+	}
+}
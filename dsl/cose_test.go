@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestCBOR(t *testing.T) {
+	x := cborTag{
+		Num: 18,
+		Val: []interface{}{
+			int64(0), int64(23), int64(24), int64(-1), int64(-25),
+			int64(65536), int64(-1 << 40), "tacos", []byte{1, 2},
+			map[interface{}]interface{}{
+				int64(1): int64(-7),
+				"kid":    []byte("k1"),
+			},
+			true, nil,
+		},
+	}
+	bs, err := cborEncode(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := cborDecode(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs2, err := cborEncode(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, bs2) {
+		t.Fatalf("%x != %x", bs, bs2)
+	}
+
+	// RFC 7049 Appendix A.
+	if bs, _ = cborEncode([]interface{}{int64(1000000), int64(-100)}); !bytes.Equal(bs, []byte{0x82, 0x1a, 0x00, 0x0f, 0x42, 0x40, 0x38, 0x63}) {
+		t.Fatalf("%x", bs)
+	}
+}
+
+func TestCBORBad(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, cborMaxDepth+2)
+	deep = append(deep, 0x00)
+
+	for name, bad := range map[string][]byte{
+		"empty":          {},
+		"short-array":    {0x82, 0x01},
+		"indefinite":     {0x5f},
+		"trailing":       {0x01, 0x02},
+		"float":          {0xfb},
+		"short-head":     {0x19, 0x01},
+		"short-bytes":    {0x43, 0x01, 0x02},
+		"short-string":   {0x63, 'a'},
+		"short-map":      {0xa2, 0x01, 0x02, 0x03},
+		"short-tag":      {0xd2},
+		"huge-bytes":     {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge-array":     {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"huge-map":       {0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"half-map":       {0xbb, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x01},
+		"huge-int":       {0x1b, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"huge-negative":  {0x3b, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"array-map-key":  {0xa1, 0x80, 0x01},
+		"deep":           deep,
+		"unknown-simple": {0xf7},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if x, err := cborDecode(bad); err == nil {
+				t.Fatalf("%x decoded as %#v", bad, x)
+			}
+		})
+	}
+}
+
+func TestCoseUnprotectBad(t *testing.T) {
+	ctx := NewCtx(nil)
+	c := &Crypto{
+		Format: "cose",
+		Sign:   &CryptoKey{Alg: "HS256", Key: "secret"},
+	}
+	s, err := c.Protect(ctx, `{"want":"tacos"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every truncation should fail cleanly.
+	for i := 0; i < len(bs); i++ {
+		if _, err := c.Unprotect(ctx, base64.StdEncoding.EncodeToString(bs[:i])); err == nil {
+			t.Fatalf("truncation at %d of %d", i, len(bs))
+		}
+	}
+	// So should a message that isn't a COSE structure.
+	for _, bad := range [][]byte{{0x01}, {0xd8, 0x11, 0x01}, {0xd1, 0x80}} {
+		if _, err := c.Unprotect(ctx, base64.StdEncoding.EncodeToString(bad)); err == nil {
+			t.Fatalf("%x should have failed", bad)
+		}
+	}
+}
@@ -0,0 +1,645 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Crypto specifies how a payload is protected (encrypted and/or
+// signed) by a Pub and how a payload is unprotected (decrypted
+// and/or verified) by a Recv.
+//
+// When both Sign and Encrypt are given, a Pub signs first and then
+// encrypts the signed result.  A Recv does the reverse.
+type Crypto struct {
+	// Format is "jose" (the default), "raw", or "cose".
+	//
+	// With "jose", a signed payload is a JWS in compact
+	// serialization, and an encrypted payload is a JWE in compact
+	// serialization using direct ("dir") key agreement.
+	//
+	// With "raw", an encrypted payload is the base64 encoding of
+	// nonce||ciphertext||tag, and a signed payload is a JSON
+	// object {"payload":PAYLOAD,"sig":SIGNATURE} where SIGNATURE
+	// is the base64 encoding of the signature of the PAYLOAD
+	// string.
+	//
+	// With "cose", a payload is the base64 encoding of a CBOR COSE
+	// message (RFC 8152): COSE_Sign1 (or COSE_Mac0 for HS256) for
+	// signing and COSE_Encrypt0 for encryption.  When both are
+	// given, the COSE_Encrypt0 plaintext is the COSE_Sign1 (or
+	// COSE_Mac0) message.
+	Format string `json:",omitempty" yaml:",omitempty"`
+
+	// Encrypt specifies optional AES-GCM payload encryption.
+	Encrypt *CryptoKey `json:",omitempty" yaml:",omitempty"`
+
+	// Sign specifies an optional payload signature.
+	Sign *CryptoKey `json:",omitempty" yaml:",omitempty"`
+}
+
+// CryptoKey specifies an algorithm and a key.
+type CryptoKey struct {
+	// Alg is the algorithm.
+	//
+	// For encryption: A128GCM, A192GCM, or A256GCM.
+	//
+	// For signatures: HS256, RS256, or ES256.
+	Alg string
+
+	// Key is the key material, which is typically given by a
+	// binding (e.g., "{?!deviceKey}").
+	//
+	// An AES key is given in base64 or hex.  An HMAC key is
+	// used as given.  An RSA or ECDSA key is PEM.  For
+	// verification, a public key, a certificate, or a private
+	// key (from which the public key is derived) can be given.
+	Key string
+
+	// KeyId is the optional JOSE "kid".
+	KeyId string `json:",omitempty" yaml:",omitempty"`
+}
+
+// Substitute performs bindings substitution on the key specifications.
+func (c *Crypto) Substitute(ctx *Ctx, bs *Bindings) (*Crypto, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	sub := func(k *CryptoKey) (*CryptoKey, error) {
+		if k == nil {
+			return nil, nil
+		}
+		alg, err := bs.StringSub(ctx, k.Alg)
+		if err != nil {
+			return nil, err
+		}
+		key, err := bs.StringSub(ctx, k.Key)
+		if err != nil {
+			return nil, err
+		}
+		kid, err := bs.StringSub(ctx, k.KeyId)
+		if err != nil {
+			return nil, err
+		}
+		return &CryptoKey{
+			Alg:   alg,
+			Key:   key,
+			KeyId: kid,
+		}, nil
+	}
+
+	enc, err := sub(c.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sub(c.Sign)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Crypto{
+		Format:  c.Format,
+		Encrypt: enc,
+		Sign:    sig,
+	}, nil
+}
+
+func (c *Crypto) format() (string, error) {
+	switch f := strings.ToLower(c.Format); f {
+	case "":
+		return "jose", nil
+	case "jose", "raw", "cose":
+		return f, nil
+	default:
+		return "", Brokenf("unknown Crypto format '%s'", c.Format)
+	}
+}
+
+// Protect signs and/or encrypts the given payload.
+//
+// If the payload isn't a string, it's JSON-serialized first.
+func (c *Crypto) Protect(ctx *Ctx, payload interface{}) (string, error) {
+	s, err := MaybeSerialize(payload)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := c.format()
+	if err != nil {
+		return "", err
+	}
+	if format == "cose" {
+		return c.coseProtect(ctx, s)
+	}
+	jose := format == "jose"
+
+	if c.Sign != nil {
+		ctx.Inddf("    Signing payload (%s)", c.Sign.Alg)
+		if jose {
+			s, err = c.Sign.jwsSign(s, c.Encrypt == nil)
+		} else {
+			s, err = c.Sign.rawSign(s)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if c.Encrypt != nil {
+		ctx.Inddf("    Encrypting payload (%s)", c.Encrypt.Alg)
+		if jose {
+			s, err = c.Encrypt.jweEncrypt(s, c.Sign != nil)
+		} else {
+			s, err = c.Encrypt.rawEncrypt(s)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return s, nil
+}
+
+// Unprotect decrypts and/or verifies the given payload.
+//
+// The result is parsed as JSON if possible.
+func (c *Crypto) Unprotect(ctx *Ctx, payload interface{}) (interface{}, error) {
+	s, err := MaybeSerialize(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := c.format()
+	if err != nil {
+		return nil, err
+	}
+	if format == "cose" {
+		return c.coseUnprotect(s)
+	}
+	jose := format == "jose"
+
+	if c.Encrypt != nil {
+		if jose {
+			s, err = c.Encrypt.jweDecrypt(s)
+		} else {
+			s, err = c.Encrypt.rawDecrypt(s)
+		}
+		if err != nil {
+			return nil, cryptoFailed("decryption", err)
+		}
+	}
+
+	if c.Sign != nil {
+		if jose {
+			s, err = c.Sign.jwsVerify(s)
+		} else {
+			s, err = c.Sign.rawVerify(s)
+		}
+		if err != nil {
+			return nil, cryptoFailed("verification", err)
+		}
+	}
+
+	return MaybeParseJSON(s), nil
+}
+
+// cryptoFailed wraps a decryption or verification error unless the
+// error is Broken.
+func cryptoFailed(what string, err error) error {
+	if _, is := IsBroken(err); is {
+		return err
+	}
+	return fmt.Errorf("%s failed: %w", what, err)
+}
+
+var b64url = base64.RawURLEncoding
+
+// decodeKeyBytes tries hex and then base64 (standard and URL).
+func decodeKeyBytes(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if bs, err := hex.DecodeString(s); err == nil {
+		return bs, nil
+	}
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		if bs, err := enc.DecodeString(s); err == nil {
+			return bs, nil
+		}
+	}
+	return nil, Brokenf("key isn't hex or base64")
+}
+
+func (k *CryptoKey) aead() (cipher.AEAD, error) {
+	var size int
+	switch k.Alg {
+	case "A128GCM":
+		size = 16
+	case "A192GCM":
+		size = 24
+	case "A256GCM":
+		size = 32
+	default:
+		return nil, Brokenf("unsupported encryption algorithm '%s'", k.Alg)
+	}
+	key, err := decodeKeyBytes(k.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != size {
+		return nil, Brokenf("%s needs a %d-byte key (not %d bytes)", k.Alg, size, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, NewBroken(err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k *CryptoKey) rawEncrypt(s string) (string, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	bs := gcm.Seal(nonce, nonce, []byte(s), nil)
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
+
+func (k *CryptoKey) rawDecrypt(s string) (string, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	n := gcm.NonceSize()
+	if len(bs) < n {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, bs[:n], bs[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (k *CryptoKey) header(fields map[string]interface{}) string {
+	if k.KeyId != "" {
+		fields["kid"] = k.KeyId
+	}
+	js, _ := json.Marshal(fields)
+	return b64url.EncodeToString(js)
+}
+
+func (k *CryptoKey) jweEncrypt(s string, nested bool) (string, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	fields := map[string]interface{}{
+		"alg": "dir",
+		"enc": k.Alg,
+	}
+	if nested {
+		fields["cty"] = "JWT"
+	}
+	hdr := k.header(fields)
+	iv := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, []byte(s), []byte(hdr))
+	var (
+		tagAt = len(sealed) - gcm.Overhead()
+		ct    = sealed[:tagAt]
+		tag   = sealed[tagAt:]
+	)
+	return strings.Join([]string{
+		hdr,
+		"",
+		b64url.EncodeToString(iv),
+		b64url.EncodeToString(ct),
+		b64url.EncodeToString(tag),
+	}, "."), nil
+}
+
+func (k *CryptoKey) jweDecrypt(s string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("JWE has %d parts (not 5)", len(parts))
+	}
+	var hdr map[string]interface{}
+	js, err := b64url.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	if err = json.Unmarshal(js, &hdr); err != nil {
+		return "", err
+	}
+	if alg, _ := hdr["alg"].(string); alg != "dir" {
+		return "", fmt.Errorf("JWE alg '%s' isn't 'dir'", alg)
+	}
+	if enc, _ := hdr["enc"].(string); enc != k.Alg {
+		return "", fmt.Errorf("JWE enc '%s' isn't '%s'", enc, k.Alg)
+	}
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	iv, err := b64url.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	ct, err := b64url.DecodeString(parts[3])
+	if err != nil {
+		return "", err
+	}
+	tag, err := b64url.DecodeString(parts[4])
+	if err != nil {
+		return "", err
+	}
+	if len(iv) != gcm.NonceSize() {
+		return "", fmt.Errorf("bad JWE IV length %d", len(iv))
+	}
+	plain, err := gcm.Open(nil, iv, append(ct, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (k *CryptoKey) jwsSign(s string, typed bool) (string, error) {
+	fields := map[string]interface{}{
+		"alg": k.Alg,
+	}
+	if typed {
+		fields["typ"] = "JWT"
+	}
+	input := k.header(fields) + "." + b64url.EncodeToString([]byte(s))
+	sig, err := k.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64url.EncodeToString(sig), nil
+}
+
+func (k *CryptoKey) jwsVerify(s string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("JWS has %d parts (not 3)", len(parts))
+	}
+	var hdr map[string]interface{}
+	js, err := b64url.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	if err = json.Unmarshal(js, &hdr); err != nil {
+		return "", err
+	}
+	if alg, _ := hdr["alg"].(string); alg != k.Alg {
+		return "", fmt.Errorf("JWS alg '%s' isn't '%s'", alg, k.Alg)
+	}
+	sig, err := b64url.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	if err = k.verify([]byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return "", err
+	}
+	payload, err := b64url.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// rawSigned is the envelope for a "raw" signed payload.
+type rawSigned struct {
+	Payload string `json:"payload"`
+	Sig     string `json:"sig"`
+}
+
+func (k *CryptoKey) rawSign(s string) (string, error) {
+	sig, err := k.sign([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	js, err := json.Marshal(rawSigned{
+		Payload: s,
+		Sig:     base64.StdEncoding.EncodeToString(sig),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(js), nil
+}
+
+func (k *CryptoKey) rawVerify(s string) (string, error) {
+	var env rawSigned
+	if err := json.Unmarshal([]byte(s), &env); err != nil {
+		return "", err
+	}
+	sig, err := base64.StdEncoding.DecodeString(env.Sig)
+	if err != nil {
+		return "", err
+	}
+	if err = k.verify([]byte(env.Payload), sig); err != nil {
+		return "", err
+	}
+	return env.Payload, nil
+}
+
+func (k *CryptoKey) sign(input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+	switch k.Alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(k.Key))
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case "RS256":
+		priv, err := parsePrivateKey(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		rk, is := priv.(*rsa.PrivateKey)
+		if !is {
+			return nil, Brokenf("RS256 needs an RSA key (not a %T)", priv)
+		}
+		return rsa.SignPKCS1v15(rand.Reader, rk, crypto.SHA256, digest[:])
+	case "ES256":
+		priv, err := parsePrivateKey(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		ek, is := priv.(*ecdsa.PrivateKey)
+		if !is {
+			return nil, Brokenf("ES256 needs an ECDSA key (not a %T)", priv)
+		}
+		if ek.Curve != elliptic.P256() {
+			return nil, Brokenf("ES256 needs a P-256 key (not %s)", ek.Curve.Params().Name)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, ek, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JOSE wants fixed-width R||S rather than ASN.1.
+		sig := make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+		return sig, nil
+	default:
+		return nil, Brokenf("unsupported signature algorithm '%s'", k.Alg)
+	}
+}
+
+func (k *CryptoKey) verify(input, sig []byte) error {
+	digest := sha256.Sum256(input)
+	switch k.Alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(k.Key))
+		mac.Write(input)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("bad HS256 signature")
+		}
+		return nil
+	case "RS256":
+		pub, err := parsePublicKey(k.Key)
+		if err != nil {
+			return err
+		}
+		rk, is := pub.(*rsa.PublicKey)
+		if !is {
+			return Brokenf("RS256 needs an RSA key (not a %T)", pub)
+		}
+		return rsa.VerifyPKCS1v15(rk, crypto.SHA256, digest[:], sig)
+	case "ES256":
+		pub, err := parsePublicKey(k.Key)
+		if err != nil {
+			return err
+		}
+		ek, is := pub.(*ecdsa.PublicKey)
+		if !is {
+			return Brokenf("ES256 needs an ECDSA key (not a %T)", pub)
+		}
+		if ek.Curve != elliptic.P256() {
+			return Brokenf("ES256 needs a P-256 key (not %s)", ek.Curve.Params().Name)
+		}
+		if len(sig) != 64 {
+			return fmt.Errorf("bad ES256 signature length %d", len(sig))
+		}
+		var (
+			r = new(big.Int).SetBytes(sig[:32])
+			s = new(big.Int).SetBytes(sig[32:])
+		)
+		if !ecdsa.Verify(ek, digest[:], r, s) {
+			return fmt.Errorf("bad ES256 signature")
+		}
+		return nil
+	default:
+		return Brokenf("unsupported signature algorithm '%s'", k.Alg)
+	}
+}
+
+func pemBlock(s string) (*pem.Block, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, Brokenf("key isn't PEM")
+	}
+	return block, nil
+}
+
+func parsePrivateKey(s string) (interface{}, error) {
+	block, err := pemBlock(s)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, Brokenf("can't parse private key (%s)", block.Type)
+}
+
+func parsePublicKey(s string) (interface{}, error) {
+	block, err := pemBlock(s)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, NewBroken(err)
+		}
+		return cert.PublicKey, nil
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, NewBroken(err)
+		}
+		return k, nil
+	case "RSA PUBLIC KEY":
+		k, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, NewBroken(err)
+		}
+		return k, nil
+	}
+	// Maybe we were given a private key.
+	priv, err := parsePrivateKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if signer, is := priv.(crypto.Signer); is {
+		return signer.Public(), nil
+	}
+	return nil, Brokenf("can't derive a public key from a %T", priv)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestCrypto(t *testing.T) {
+	ctx := NewCtx(nil)
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rk),
+	}))
+
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(ek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: der,
+	}))
+	pubDER, err := x509.MarshalPKIXPublicKey(&ek.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPubPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubDER,
+	}))
+
+	aes256 := "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+	roundtrip := func(t *testing.T, protect, unprotect *Crypto) string {
+		s, err := protect.Protect(ctx, `{"want":"tacos"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := unprotect.Unprotect(ctx, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, is := x.(map[string]interface{})
+		if !is {
+			t.Fatalf("%T", x)
+		}
+		if m["want"] != "tacos" {
+			t.Fatal(m)
+		}
+		return s
+	}
+
+	t.Run("jws-hs256", func(t *testing.T) {
+		c := &Crypto{
+			Sign: &CryptoKey{Alg: "HS256", Key: "secret"},
+		}
+		s := roundtrip(t, c, c)
+		if n := strings.Count(s, "."); n != 2 {
+			t.Fatal(s)
+		}
+	})
+
+	t.Run("jws-rs256", func(t *testing.T) {
+		c := &Crypto{
+			Sign: &CryptoKey{Alg: "RS256", Key: rsaPEM},
+		}
+		roundtrip(t, c, c)
+	})
+
+	t.Run("jws-es256-public", func(t *testing.T) {
+		roundtrip(t,
+			&Crypto{Sign: &CryptoKey{Alg: "ES256", Key: ecPEM}},
+			&Crypto{Sign: &CryptoKey{Alg: "ES256", Key: ecPubPEM}})
+	})
+
+	t.Run("jwe-nested", func(t *testing.T) {
+		c := &Crypto{
+			Encrypt: &CryptoKey{Alg: "A256GCM", Key: aes256, KeyId: "k1"},
+			Sign:    &CryptoKey{Alg: "HS256", Key: "secret"},
+		}
+		s := roundtrip(t, c, c)
+		if n := strings.Count(s, "."); n != 4 {
+			t.Fatal(s)
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		c := &Crypto{
+			Format:  "raw",
+			Encrypt: &CryptoKey{Alg: "A256GCM", Key: aes256},
+			Sign:    &CryptoKey{Alg: "ES256", Key: ecPEM},
+		}
+		roundtrip(t, c, c)
+	})
+
+	t.Run("cose-sign1", func(t *testing.T) {
+		roundtrip(t,
+			&Crypto{Format: "cose", Sign: &CryptoKey{Alg: "ES256", Key: ecPEM, KeyId: "k1"}},
+			&Crypto{Format: "cose", Sign: &CryptoKey{Alg: "ES256", Key: ecPubPEM}})
+	})
+
+	t.Run("cose-mac0", func(t *testing.T) {
+		c := &Crypto{
+			Format: "cose",
+			Sign:   &CryptoKey{Alg: "HS256", Key: "secret"},
+		}
+		s := roundtrip(t, c, c)
+		bs, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Check the MAC against a MAC_structure that's spelled
+		// out here: ["MAC0", h'A10105', h'', payload].
+		payload := `{"want":"tacos"}`
+		tbm := append([]byte{0x84, 0x64, 'M', 'A', 'C', '0', 0x43, 0xa1, 0x01, 0x05, 0x40,
+			0x40 | byte(len(payload))}, payload...)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(tbm)
+		want := append([]byte{0xd1, 0x84, 0x43, 0xa1, 0x01, 0x05, 0xa0,
+			0x40 | byte(len(payload))}, payload...)
+		want = append(append(want, 0x58, 0x20), mac.Sum(nil)...)
+		if !bytes.Equal(bs, want) {
+			t.Fatalf("%x", bs)
+		}
+	})
+
+	t.Run("cose-nested", func(t *testing.T) {
+		c := &Crypto{
+			Format:  "cose",
+			Encrypt: &CryptoKey{Alg: "A128GCM", Key: aes256[:32], KeyId: "k1"},
+			Sign:    &CryptoKey{Alg: "RS256", Key: rsaPEM},
+		}
+		s := roundtrip(t, c, c)
+		bs, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Raw COSE bytes work too.
+		if _, err = c.Unprotect(ctx, string(bs)); err != nil {
+			t.Fatal(err)
+		}
+		x, err := cborDecode(bs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag, is := x.(cborTag); !is || tag.Num != coseEncrypt0Tag {
+			t.Fatal(x)
+		}
+	})
+
+	t.Run("cose-wrong-alg", func(t *testing.T) {
+		s, err := (&Crypto{
+			Format: "cose",
+			Sign:   &CryptoKey{Alg: "HS256", Key: "secret"},
+		}).Protect(ctx, `{"want":"tacos"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &Crypto{
+			Format: "cose",
+			Sign:   &CryptoKey{Alg: "ES256", Key: ecPEM},
+		}
+		if _, err = c.Unprotect(ctx, s); err == nil {
+			t.Fatal("should have complained")
+		}
+		if _, is := IsBroken(err); is {
+			t.Fatal("shouldn't be broken")
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		c := &Crypto{
+			Sign: &CryptoKey{Alg: "HS256", Key: "secret"},
+		}
+		s, err := c.Protect(ctx, `{"want":"tacos"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := &Crypto{
+			Sign: &CryptoKey{Alg: "HS256", Key: "other"},
+		}
+		if _, err = other.Unprotect(ctx, s); err == nil {
+			t.Fatal("should have complained")
+		}
+		if _, is := IsBroken(err); is {
+			t.Fatal("shouldn't be broken")
+		}
+	})
+
+	t.Run("es256-p384", func(t *testing.T) {
+		k, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &Crypto{
+			Sign: &CryptoKey{Alg: "ES256", Key: string(pem.EncodeToMemory(&pem.Block{
+				Type:  "EC PRIVATE KEY",
+				Bytes: der,
+			}))},
+		}
+		_, err = c.Protect(ctx, `{"want":"tacos"}`)
+		if _, is := IsBroken(err); !is {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("jwe-alg", func(t *testing.T) {
+		c := &Crypto{
+			Encrypt: &CryptoKey{Alg: "A256GCM", Key: aes256},
+		}
+		s, err := c.Protect(ctx, `{"want":"tacos"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(s, ".")
+		parts[0] = b64url.EncodeToString([]byte(`{"alg":"A256KW","enc":"A256GCM"}`))
+		_, err = c.Unprotect(ctx, strings.Join(parts, "."))
+		if err == nil || !strings.Contains(err.Error(), "A256KW") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("badkey", func(t *testing.T) {
+		c := &Crypto{
+			Encrypt: &CryptoKey{Alg: "A256GCM", Key: "00"},
+		}
+		_, err := c.Protect(ctx, `{"want":"tacos"}`)
+		if _, is := IsBroken(err); !is {
+			t.Fatal(err)
+		}
+	})
+}
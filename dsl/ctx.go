@@ -23,6 +23,8 @@ import (
 	"log"
 	"strings"
 	"time"
+
+	"github.com/Comcast/plax/metrics"
 )
 
 var (
@@ -39,6 +41,39 @@ type Ctx struct {
 	IncludeDirs []string
 	Dir         string
 	LogLevel    string
+
+	// Redactor removes secrets from log lines.
+	Redactor *Redactor
+
+	// Env optionally gives environment variables for the
+	// subprocesses that tests start.  See Process.
+	Env map[string]string
+
+	// Registries are directories or (HTTP or HTTPS) base URLs
+	// for resolving a test's Packages.  See Package.
+	Registries []string
+
+	// Tracer, when not nil, gets a TraceEvent for each step
+	// execution.
+	Tracer *Tracer
+
+	// Metrics, when not nil, counts messages published and
+	// received and records Recv wait times.
+	Metrics *metrics.Registry
+
+	// Fields are added to each LogRecord when the Logger is a
+	// StructuredLogger.  See WithFields.
+	Fields map[string]interface{}
+
+	// Profiles are channel profiles that every test can use.
+	// See ChanProfile.
+	Profiles ChanProfiles
+
+	// ChanOverlays maps channel types to configurations that are
+	// merged over the configuration of each channel of that type
+	// that a test makes (as for an environment).  See
+	// MergeConfig.
+	ChanOverlays map[ChanKind]interface{}
 }
 
 // NewCtx build a new dsl.Ctx
@@ -52,29 +87,24 @@ func NewCtx(ctx context.Context) *Ctx {
 		LogLevel:    DefaultLogLevel,
 		IncludeDirs: make([]string, 0, 1),
 		Dir:         ".",
+		Redactor:    DefaultRedactor,
 	}
 }
 
 // WithCancel builds a new dsl.Ctx WithCancel
 func (c *Ctx) WithCancel() (*Ctx, func()) {
-	ctx, cancel := context.WithCancel(c.Context)
-	return &Ctx{
-		Context:     ctx,
-		Logger:      DefaultLogger,
-		LogLevel:    c.LogLevel,
-		IncludeDirs: c.IncludeDirs,
-	}, cancel
+	ctx := *c
+	var cancel func()
+	ctx.Context, cancel = context.WithCancel(c.Context)
+	return &ctx, cancel
 }
 
 // WithTimeout builds a new dsl.Ctx WithTimeout
 func (c *Ctx) WithTimeout(d time.Duration) (*Ctx, func()) {
-	ctx, cancel := context.WithTimeout(c.Context, d)
-	return &Ctx{
-		Context:     ctx,
-		Logger:      DefaultLogger,
-		LogLevel:    c.LogLevel,
-		IncludeDirs: c.IncludeDirs,
-	}, cancel
+	ctx := *c
+	var cancel func()
+	ctx.Context, cancel = context.WithTimeout(c.Context, d)
+	return &ctx, cancel
 }
 
 // SetLogLevel sets the dsl.Ctx LogLevel
@@ -91,12 +121,53 @@ func (c *Ctx) SetLogLevel(level string) error {
 	return nil
 }
 
+// WithFields returns a copy of the Ctx with the given Fields added
+// to its own.
+func (c *Ctx) WithFields(fields map[string]interface{}) *Ctx {
+	fs := make(map[string]interface{}, len(c.Fields)+len(fields))
+	for k, v := range c.Fields {
+		fs[k] = v
+	}
+	for k, v := range fields {
+		fs[k] = v
+	}
+	ctx := *c
+	ctx.Fields = fs
+	return &ctx
+}
+
+// emit redacts and logs a line via the Logger, which gets a
+// LogRecord if it's a StructuredLogger.
+func (c *Ctx) emit(level, mark, format string, args ...interface{}) {
+	msg := c.Redactor.Redact(fmt.Sprintf(format, args...))
+	if l, is := c.Logger.(StructuredLogger); is {
+		l.Log(LogRecord{
+			Time:   time.Now().UTC(),
+			Level:  level,
+			Mark:   mark,
+			Msg:    msg,
+			Fields: c.Fields,
+		})
+		return
+	}
+	if mark != "" {
+		msg = mark + " " + msg
+	}
+	c.Logger.Printf("%s", msg)
+}
+
+// Printf emits a log line (via the Logger) after redacting any
+// secrets.
+func (c *Ctx) Printf(format string, args ...interface{}) {
+	c.emit(LevelInfo, "", format, args...)
+}
+
 // Indf emits a log line starting with a '|' when ctx.LogLevel isn't 'none'.
 func (c *Ctx) Indf(format string, args ...interface{}) {
 	switch c.LogLevel {
 	case "none", "NONE":
 	default:
-		c.Printf("| "+format, args...)
+		c.emit(LevelInfo, "|", format, args...)
 	}
 }
 
@@ -106,13 +177,13 @@ func (c *Ctx) Indf(format string, args ...interface{}) {
 func (c *Ctx) Inddf(format string, args ...interface{}) {
 	switch c.LogLevel {
 	case "debug", "DEBUG":
-		c.Printf("| "+format, args...)
+		c.emit(LevelDebug, "|", format, args...)
 	}
 }
 
 // Warnf emits a log  with a '!' prefix.
 func (c *Ctx) Warnf(format string, args ...interface{}) {
-	c.Printf("! "+format, args...)
+	c.emit(LevelWarn, "!", format, args...)
 }
 
 // Logf emits a log line starting with a '>' when ctx.LogLevel isn't 'none'.
@@ -120,7 +191,7 @@ func (c *Ctx) Logf(format string, args ...interface{}) {
 	switch c.LogLevel {
 	case "none", "NONE":
 	default:
-		c.Printf("> "+format, args...)
+		c.emit(LevelInfo, ">", format, args...)
 	}
 }
 
@@ -130,7 +201,7 @@ func (c *Ctx) Logf(format string, args ...interface{}) {
 func (c *Ctx) Logdf(format string, args ...interface{}) {
 	switch c.LogLevel {
 	case "debug", "DEBUG":
-		c.Printf("> "+format, args...)
+		c.emit(LevelDebug, ">", format, args...)
 	}
 }
 
@@ -18,6 +18,7 @@
 package dsl
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -41,3 +42,28 @@ func TestCtxTimeout(t *testing.T) {
 		t.Fatal("didn't time out")
 	}
 }
+
+func TestCtxCopies(t *testing.T) {
+	ctx := NewCtx(nil)
+	ctx.Dir = "demos"
+	ctx.Env = map[string]string{"WANT": "tacos"}
+	ctx.Registries = []string{"registry"}
+	ctx.Fields = map[string]interface{}{"test": "a"}
+	ctx.ChanOverlays = map[ChanKind]interface{}{"mock": nil}
+
+	same := func(t *testing.T, c *Ctx) {
+		x, y := *ctx, *c
+		x.Context, y.Context = nil, nil
+		if !reflect.DeepEqual(x, y) {
+			t.Fatalf("%#v != %#v", y, x)
+		}
+	}
+
+	c, cancel := ctx.WithCancel()
+	defer cancel()
+	same(t, c)
+
+	c, cancel = ctx.WithTimeout(time.Second)
+	defer cancel()
+	same(t, c)
+}
@@ -0,0 +1,379 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	TheChanRegistry.Register(NewCtx(nil), "dataset", NewDatasetChan)
+	TheChanDocs.Register("dataset", "Delivers the records of a CSV, JSON Lines, or Parquet file as messages.", DatasetOpts{})
+}
+
+// DatasetDecoder reads the records of a dataset file.
+type DatasetDecoder interface {
+	// Next returns the next record or io.EOF.
+	Next() (interface{}, error)
+}
+
+// DatasetFormat makes a DatasetDecoder for a file.
+type DatasetFormat func(f *os.File) (DatasetDecoder, error)
+
+// DatasetFormats maps format names to DatasetFormats.
+//
+// "csv", "jsonl", and "parquet" are built in.
+var DatasetFormats = map[string]DatasetFormat{
+	"csv":     newCSVDecoder,
+	"jsonl":   newJSONLDecoder,
+	"parquet": newParquetDecoder,
+}
+
+// DatasetOpts configures a DatasetChan.
+type DatasetOpts struct {
+	// File is the dataset to deliver.  A relative filename is
+	// resolved with respect to ctx.Dir.
+	File string `json:",omitempty" yaml:",omitempty" doc:"The dataset file (relative to the test's directory)."`
+
+	// Format is a DatasetFormats name.  The default is the
+	// File's extension ("csv", "jsonl", or "parquet"), and
+	// ".json" and ".ndjson" files are "jsonl".
+	Format string `json:",omitempty" yaml:",omitempty" doc:"csv, jsonl, or parquet (or another registered format).  Defaults to the file's extension."`
+
+	// Topic is the topic for each message.
+	Topic string `json:",omitempty" yaml:",omitempty" doc:"The topic for each message."`
+
+	// TopicField, if not empty, names the column (or property
+	// of a JSON object) that has the topic for each record.
+	TopicField string `json:",omitempty" yaml:",omitempty" doc:"The field that has each message's topic."`
+
+	// Rate, when positive, limits delivery to this many
+	// messages per second.
+	Rate float64 `json:",omitempty" yaml:",omitempty" doc:"Maximum messages per second."`
+
+	// Limit, when positive, is the maximum number of records to
+	// deliver.
+	Limit int `json:",omitempty" yaml:",omitempty" doc:"Maximum number of records to deliver."`
+
+	// Output, if not empty, is a file to which published
+	// messages are appended as JSON Lines.  A relative filename
+	// is resolved with respect to ctx.Dir.
+	Output string `json:",omitempty" yaml:",omitempty" doc:"File to which published messages are appended as JSON Lines."`
+}
+
+// DatasetChan delivers the records of a dataset file as messages and
+// appends published messages to an output file.
+//
+// A CSV row is delivered as a JSON object whose properties are the
+// columns (from the first row).  A value that's JSON (like 42 or
+// true) is that value, and other values are strings.  Each line of a
+// JSON Lines file is delivered as is.  A Parquet row is delivered as
+// an object whose properties are the columns (see parquetDecoder).
+type DatasetChan struct {
+	opts *DatasetOpts
+	c    chan Msg
+
+	// mu protects out.
+	mu  sync.Mutex
+	out *os.File
+}
+
+// DatasetOutput is a line in a DatasetChan's Output.
+type DatasetOutput struct {
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload"`
+	At      time.Time   `json:"at"`
+}
+
+// NewDatasetChan checks the options and opens the Output (if any).
+func NewDatasetChan(ctx *Ctx, cfg interface{}) (Chan, error) {
+	var opts DatasetOpts
+	if err := As(cfg, &opts); err != nil {
+		return nil, NewBroken(err)
+	}
+	if opts.File == "" && opts.Output == "" {
+		return nil, Brokenf("dataset channel needs a File or an Output")
+	}
+	if opts.File != "" {
+		if opts.Format == "" {
+			opts.Format = datasetFormat(opts.File)
+		}
+		if _, have := DatasetFormats[opts.Format]; !have {
+			known := make([]string, 0, len(DatasetFormats))
+			for name := range DatasetFormats {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, Brokenf("dataset channel has unsupported Format '%s' (not in %s)",
+				opts.Format, strings.Join(known, ", "))
+		}
+	}
+
+	if opts.File != "" {
+		opts.File = datasetFile(ctx, opts.File)
+	}
+
+	c := &DatasetChan{
+		opts: &opts,
+		c:    make(chan Msg, 1024),
+	}
+
+	if opts.Output != "" {
+		f, err := os.OpenFile(datasetFile(ctx, opts.Output), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, NewBroken(err)
+		}
+		c.out = f
+	}
+
+	return c, nil
+}
+
+// datasetFormat returns the format name for the filename's
+// extension.
+func datasetFormat(filename string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")); ext {
+	case "json", "ndjson":
+		return "jsonl"
+	default:
+		return ext
+	}
+}
+
+func datasetFile(ctx *Ctx, filename string) string {
+	if !filepath.IsAbs(filename) && ctx.Dir != "" {
+		filename = filepath.Join(ctx.Dir, filename)
+	}
+	return filename
+}
+
+func (c *DatasetChan) Kind() ChanKind {
+	return "dataset"
+}
+
+// Open starts delivering the dataset's records (if any).
+func (c *DatasetChan) Open(ctx *Ctx) error {
+	if c.opts.File == "" {
+		return nil
+	}
+
+	f, err := os.Open(c.opts.File)
+	if err != nil {
+		return NewBroken(err)
+	}
+	dec, err := DatasetFormats[c.opts.Format](f)
+	if err != nil {
+		f.Close()
+		return Brokenf("dataset %s: %s", c.opts.File, err)
+	}
+
+	var interval time.Duration
+	if 0 < c.opts.Rate {
+		interval = time.Duration(float64(time.Second) / c.opts.Rate)
+	}
+
+	go func() {
+		defer f.Close()
+		for n := 0; c.opts.Limit <= 0 || n < c.opts.Limit; n++ {
+			x, err := dec.Next()
+			if err == io.EOF {
+				ctx.Logf("DatasetChan delivered %d records", n)
+				return
+			}
+			if err != nil {
+				ctx.Warnf("DatasetChan %s record %d: %s", c.opts.File, n, err)
+				return
+			}
+			if 0 < n && 0 < interval {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+			m := Msg{
+				Topic:   c.opts.Topic,
+				Payload: JSON(x),
+			}
+			if c.opts.TopicField != "" {
+				if obj, is := x.(map[string]interface{}); is {
+					if topic, is := obj[c.opts.TopicField].(string); is {
+						m.Topic = topic
+					}
+				}
+			}
+			m.ReceivedAt = time.Now().UTC()
+			// Block (rather than drop) when the buffer is
+			// full.
+			select {
+			case <-ctx.Done():
+				return
+			case c.c <- m:
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *DatasetChan) Close(ctx *Ctx) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out == nil {
+		return nil
+	}
+	err := c.out.Close()
+	c.out = nil
+	return err
+}
+
+func (c *DatasetChan) Kill(ctx *Ctx) error {
+	return Brokenf("Kill is not supported by a %T", c)
+}
+
+func (c *DatasetChan) Sub(ctx *Ctx, topic string) error {
+	ctx.Logf("DatasetChan Sub %s (ignored)", topic)
+	return nil
+}
+
+// Pub appends the message to the Output (if any).  A payload that's
+// a string of JSON is written as that JSON.
+func (c *DatasetChan) Pub(ctx *Ctx, m Msg) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out == nil {
+		ctx.Logf("DatasetChan Pub topic %s (discarded)", m.Topic)
+		return nil
+	}
+
+	out := DatasetOutput{
+		Topic:   m.Topic,
+		Payload: m.Payload,
+		At:      time.Now().UTC(),
+	}
+	if s, is := m.Payload.(string); is {
+		var x interface{}
+		if err := json.Unmarshal([]byte(s), &x); err == nil {
+			out.Payload = x
+		}
+	}
+	js, err := json.Marshal(&out)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.out, "%s\n", js)
+	return err
+}
+
+func (c *DatasetChan) Recv(ctx *Ctx) chan Msg {
+	return c.c
+}
+
+func (c *DatasetChan) To(ctx *Ctx, m Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	select {
+	case <-ctx.Done():
+	case c.c <- m:
+	}
+	return nil
+}
+
+// csvDecoder reads CSV rows as objects.
+type csvDecoder struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVDecoder(f *os.File) (DatasetDecoder, error) {
+	r := csv.NewReader(f)
+	columns, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &csvDecoder{
+		r:       r,
+		columns: columns,
+	}, nil
+}
+
+func (d *csvDecoder) Next() (interface{}, error) {
+	record, err := d.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{}, len(d.columns))
+	for i, s := range record {
+		obj[d.columns[i]] = csvValue(s)
+	}
+	return obj, nil
+}
+
+// csvValue returns the JSON value of the string if it's JSON and
+// the string itself otherwise.
+func csvValue(s string) interface{} {
+	var x interface{}
+	if err := json.Unmarshal([]byte(s), &x); err != nil {
+		return s
+	}
+	return x
+}
+
+// jsonlDecoder reads JSON Lines.
+type jsonlDecoder struct {
+	in *bufio.Scanner
+}
+
+func newJSONLDecoder(f *os.File) (DatasetDecoder, error) {
+	in := bufio.NewScanner(f)
+	in.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &jsonlDecoder{
+		in: in,
+	}, nil
+}
+
+func (d *jsonlDecoder) Next() (interface{}, error) {
+	for d.in.Scan() {
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			continue
+		}
+		var x interface{}
+		if err := json.Unmarshal([]byte(line), &x); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	if err := d.in.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
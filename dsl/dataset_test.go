@@ -0,0 +1,180 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func datasetMsgs(t *testing.T, ctx *Ctx, c Chan, n int) []Msg {
+	var (
+		acc []Msg
+		in  = c.Recv(ctx)
+		tm  = time.NewTimer(2 * time.Second)
+	)
+	defer tm.Stop()
+	for len(acc) < n {
+		select {
+		case m := <-in:
+			acc = append(acc, m)
+		case <-tm.C:
+			t.Fatalf("only got %d messages", len(acc))
+		}
+	}
+	return acc
+}
+
+func TestDatasetChan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := NewCtx(nil)
+	ctx.Dir = dir
+
+	write := func(filename, src string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("orders.csv", "kind,dish,n\norder,tacos,1\ncancel,\"queso, blanco\",2\norder,chips,3\n")
+	write("orders.ndjson", "{\"dish\":\"tacos\"}\n\n[1,2]\n")
+
+	t.Run("csv", func(t *testing.T) {
+		c, err := NewDatasetChan(ctx, map[string]interface{}{
+			"File":       "orders.csv",
+			"TopicField": "kind",
+			"Limit":      2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		ms := datasetMsgs(t, ctx, c, 2)
+		if ms[1].Topic != "cancel" {
+			t.Fatal(ms[1].Topic)
+		}
+		var x map[string]interface{}
+		if err = json.Unmarshal([]byte(ms[1].Payload.(string)), &x); err != nil {
+			t.Fatal(err)
+		}
+		if x["dish"] != "queso, blanco" || x["n"] != 2.0 {
+			t.Fatal(x)
+		}
+
+		// Limit
+		select {
+		case m := <-c.Recv(ctx):
+			t.Fatal(m)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		c, err := NewDatasetChan(ctx, map[string]interface{}{
+			"File":  "orders.ndjson",
+			"Topic": "orders",
+			"Rate":  20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		then := time.Now()
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		ms := datasetMsgs(t, ctx, c, 2)
+		if elapsed := time.Now().Sub(then); elapsed < 40*time.Millisecond {
+			t.Fatalf("too fast: %s", elapsed)
+		}
+		if ms[0].Topic != "orders" || ms[1].Payload != "[1,2]" {
+			t.Fatal(ms)
+		}
+	})
+
+	t.Run("output", func(t *testing.T) {
+		cfg := map[string]interface{}{
+			"Output": "out.jsonl",
+		}
+		for i := 0; i < 2; i++ {
+			c, err := NewDatasetChan(ctx, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = c.Open(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err = c.Pub(ctx, Msg{Topic: "t", Payload: `{"n":1}`}); err != nil {
+				t.Fatal(err)
+			}
+			if err = c.Pub(ctx, Msg{Topic: "t", Payload: "not json"}); err != nil {
+				t.Fatal(err)
+			}
+			if err = c.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		f, err := os.Open(filepath.Join(dir, "out.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var outs []DatasetOutput
+		in := bufio.NewScanner(f)
+		for in.Scan() {
+			var out DatasetOutput
+			if err = json.Unmarshal(in.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			outs = append(outs, out)
+		}
+		// Appended
+		if len(outs) != 4 {
+			t.Fatal(outs)
+		}
+		if x, is := outs[2].Payload.(map[string]interface{}); !is || x["n"] != 1.0 {
+			t.Fatal(outs[2])
+		}
+		if outs[3].Payload != "not json" {
+			t.Fatal(outs[3])
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		if _, err := NewDatasetChan(ctx, map[string]interface{}{}); err == nil {
+			t.Fatal("should have complained")
+		}
+		_, err := NewDatasetChan(ctx, map[string]interface{}{"File": "x.orc"})
+		if err == nil || !strings.Contains(err.Error(), "csv, jsonl, parquet") {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Comcast/sheens/match"
+	"gopkg.in/yaml.v3"
+)
+
+// Debugger is an interactive step-through debugger.  When a Test has
+// a Debugger, the Debugger pauses before each step and reads
+// commands until one resumes execution.  After 'continue', the
+// Debugger only pauses before steps whose Breakpoints apply.  The
+// Debugger also pauses after a step fails, so that the step can be
+// retried (or its failure ignored).
+//
+// The pending messages are the messages that have arrived on
+// channels but that no Recv has consumed.  The Debugger sets them
+// aside (like a Recv with Topics does) so that it can show them
+// without consuming them.
+type Debugger struct {
+	In  *bufio.Scanner
+	Out io.Writer
+
+	// running is true after 'continue' (until a Breakpoint).
+	running bool
+}
+
+// NewDebugger makes a Debugger that reads commands from in and
+// writes to out.
+func NewDebugger(in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		In:  bufio.NewScanner(in),
+		Out: out,
+	}
+}
+
+// DebuggerHelp describes the Debugger's commands.
+var DebuggerHelp = `Commands:
+  s, step, or RETURN    Execute this step and pause before the next one
+  c, continue           Execute steps without pausing until a breakpoint
+  k, skip               Skip this step (or, after it failed, ignore the
+                        failure) and pause before the next one
+  r, rerun              Execute the previous step again (or, after this
+                        step failed, retry it)
+  b, bindings           Show the bindings
+  p, pending            Show the pending messages
+  i, inspect N          Show pending message N
+  m, match N [PATTERN]  Match PATTERN (YAML or JSON, default this recv's
+                        pattern) against pending message N (without
+                        binding anything)
+  e, eval JS            Evaluate the Javascript expression JS in the
+                        test's environment (as in a 'run' step)
+  w, where              Show this step
+  q, quit               Stop the test (which is then broken)
+  h, help               Show this help
+`
+
+// debugAction is what a Debugger's user wants to do with a step.
+type debugAction int
+
+const (
+	debugStep debugAction = iota
+	debugSkip
+	debugRetry
+)
+
+func (d *Debugger) printf(format string, args ...interface{}) {
+	fmt.Fprintf(d.Out, format, args...)
+}
+
+// BeforeStep pauses before the given step (unless the Debugger is
+// running and the step's Breakpoint, if any, doesn't apply).
+//
+// The result reports whether the user wants to skip the step, and
+// the error is non-nil if the user quits.
+func (d *Debugger) BeforeStep(ctx *Ctx, t *Test, i int, s *Step, breakpoint bool) (bool, error) {
+	if breakpoint {
+		d.running = false
+	}
+	if d.running {
+		return false, nil
+	}
+
+	if breakpoint {
+		d.printf("\nbreakpoint")
+	}
+	d.printf("\nphase %s step %d: %s\n", t.phase, i, JSON(brief(s)))
+	d.bindings(t)
+	d.pending(ctx, t)
+
+	a, err := d.prompt(ctx, t, i, s, false)
+	return a == debugSkip, err
+}
+
+// StepFailed pauses after the given step failed (even if the
+// Debugger is running).
+//
+// The result reports whether the user wants to retry the step.  The
+// error is the given failure, nil if the user wants to ignore it, or
+// a Broken error if the user quits.
+func (d *Debugger) StepFailed(ctx *Ctx, t *Test, i int, s *Step, failure error) (bool, error) {
+	d.running = false
+
+	d.printf("\nphase %s step %d failed: %s\n", t.phase, i, failure)
+	d.bindings(t)
+	d.pending(ctx, t)
+
+	a, err := d.prompt(ctx, t, i, s, true)
+	if err != nil {
+		return false, err
+	}
+	switch a {
+	case debugRetry:
+		return true, nil
+	case debugSkip:
+		return false, nil
+	}
+	return false, failure
+}
+
+// prompt reads commands until one resumes execution.
+//
+// When failed is true, the step has already been executed (and
+// failed), so 'rerun' retries this step rather than the previous
+// one.
+func (d *Debugger) prompt(ctx *Ctx, t *Test, i int, s *Step, failed bool) (debugAction, error) {
+	for {
+		d.printf("debug> ")
+		if !d.In.Scan() {
+			// No more input, so just run.
+			d.printf("\n")
+			d.running = true
+			return debugStep, nil
+		}
+
+		var (
+			line   = strings.TrimSpace(d.In.Text())
+			parts  = strings.SplitN(line, " ", 3)
+			cmd    = parts[0]
+			args   = parts[1:]
+			number = func() (int, bool) {
+				if len(args) == 0 {
+					d.printf("need a message number\n")
+					return 0, false
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil {
+					d.printf("bad message number '%s'\n", args[0])
+					return 0, false
+				}
+				return n, true
+			}
+		)
+
+		switch cmd {
+		case "", "s", "step":
+			return debugStep, nil
+		case "c", "continue":
+			d.running = true
+			return debugStep, nil
+		case "k", "skip":
+			return debugSkip, nil
+		case "r", "rerun":
+			if failed {
+				return debugRetry, nil
+			}
+			d.rerun(ctx, t, i)
+		case "b", "bindings":
+			d.bindings(t)
+		case "p", "pending":
+			d.pending(ctx, t)
+		case "i", "inspect":
+			if n, ok := number(); ok {
+				if m, ok := d.message(ctx, t, n); ok {
+					js, _ := json.MarshalIndent(m, "", "  ")
+					d.printf("%s\n", js)
+				}
+			}
+		case "m", "match":
+			if n, ok := number(); ok {
+				if m, ok := d.message(ctx, t, n); ok {
+					d.match(ctx, t, s, m, args[1:])
+				}
+			}
+		case "e", "eval":
+			d.eval(ctx, t, strings.TrimSpace(line[len(cmd):]))
+		case "w", "where":
+			js, _ := json.MarshalIndent(brief(s), "", "  ")
+			d.printf("phase %s step %d:\n%s\n", t.phase, i, js)
+		case "q", "quit":
+			return debugStep, Brokenf("debugger quit")
+		case "h", "help", "?":
+			d.printf("%s", DebuggerHelp)
+		default:
+			d.printf("unknown command '%s' (try 'help')\n", cmd)
+		}
+	}
+}
+
+// rerun executes the step before step i (in the current phase)
+// again and reports the outcome.
+func (d *Debugger) rerun(ctx *Ctx, t *Test, i int) {
+	p, have := t.Spec.Phases[t.phase]
+	if !have || i == 0 {
+		d.printf("no previous step to rerun\n")
+		return
+	}
+	d.printf("rerunning step %d\n", i-1)
+	if _, err := p.Steps[i-1].exec(ctx, t); err != nil {
+		d.printf("step %d failed: %s\n", i-1, err)
+		return
+	}
+	d.printf("step %d succeeded\n", i-1)
+	d.bindings(t)
+}
+
+// eval evaluates the Javascript expression in the test's
+// environment.
+func (d *Debugger) eval(ctx *Ctx, t *Test, expr string) {
+	if expr == "" {
+		d.printf("need a Javascript expression\n")
+		return
+	}
+	src, err := t.prepareSource(ctx, "return ("+expr+");")
+	if err == nil {
+		var x interface{}
+		if x, err = t.JSExec(ctx, src, t.jsEnv(ctx)); err == nil {
+			d.printf("%s\n", JSON(x))
+			return
+		}
+	}
+	d.printf("error: %s\n", err)
+}
+
+func (d *Debugger) bindings(t *Test) {
+	d.printf("bindings: %s\n", JSON(t.Bindings))
+}
+
+func (d *Debugger) pending(ctx *Ctx, t *Test) {
+	ms := t.pending(ctx)
+	if len(ms) == 0 {
+		d.printf("pending: none\n")
+		return
+	}
+	d.printf("pending:\n")
+	for i, m := range ms {
+		d.printf("  [%d] %s '%s' %s\n", i, m.Chan, m.Msg.Topic, short(JSON(m.Msg.Payload)))
+	}
+}
+
+func (d *Debugger) message(ctx *Ctx, t *Test, n int) (Msg, bool) {
+	ms := t.pending(ctx)
+	if n < 0 || len(ms) <= n {
+		d.printf("no pending message %d\n", n)
+		return Msg{}, false
+	}
+	return ms[n].Msg, true
+}
+
+// match reports the result of matching the pattern (or, without
+// one, the step's Recv's pattern) against the message.
+func (d *Debugger) match(ctx *Ctx, t *Test, s *Step, m Msg, args []string) {
+	var (
+		pat    interface{}
+		target = "payload"
+	)
+	if s.Recv != nil {
+		pat = s.Recv.Pattern
+		if s.Recv.Target == "msg" || s.Recv.Target == "message" || s.Recv.Target == "Message" {
+			target = "msg"
+		}
+	}
+	if 0 < len(args) {
+		if err := yaml.Unmarshal([]byte(args[0]), &pat); err != nil {
+			d.printf("bad pattern: %s\n", err)
+			return
+		}
+	}
+	if pat == nil {
+		d.printf("need a pattern (this step isn't a recv)\n")
+		return
+	}
+
+	var x interface{}
+	if err := t.Bindings.Sub(ctx, pat, &x, true); err != nil {
+		d.printf("pattern substitution: %s\n", err)
+		return
+	}
+	pat = x
+
+	var msg interface{} = MaybeParseJSON(m.Payload)
+	if target == "msg" {
+		msg = map[string]interface{}{
+			"Topic":   m.Topic,
+			"Payload": msg,
+		}
+	}
+
+	bss, err := match.Match(pat, Canon(msg), match.NewBindings())
+	if err != nil {
+		d.printf("match error: %s\n", err)
+		return
+	}
+	d.printf("pattern: %s\n", JSON(pat))
+	if len(bss) == 0 {
+		d.printf("no match\n")
+		return
+	}
+	d.printf("match: %s\n", JSON(bss))
+}
+
+// brief returns the given step's canonical representation without
+// the zero-valued properties of the step and its operation.
+func brief(s *Step) interface{} {
+	m, is := Canon(s).(map[string]interface{})
+	if !is {
+		return s
+	}
+	dropZeros(m)
+	for k, v := range m {
+		// A Set's values are bindings, which might be zero.
+		if op, is := v.(map[string]interface{}); is && k != "Set" {
+			dropZeros(op)
+		}
+	}
+	return m
+}
+
+func dropZeros(m map[string]interface{}) {
+	for k, v := range m {
+		switch v {
+		case nil, "", false, 0.0:
+			delete(m, k)
+		}
+	}
+}
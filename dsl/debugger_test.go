@@ -0,0 +1,190 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugger(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "debug", NewSpec())
+		out bytes.Buffer
+	)
+	tst.Spec.Phases["phase1"] = &Phase{
+		Steps: []*Step{
+			{Pub: &Pub{Chan: "mother", Payload: `{"make":{"name":"mock","type":"mock"}}`}},
+			{Recv: &Recv{Chan: "mother", Pattern: `{"success":true}`}},
+			{Set: Set{"?x": 0}},
+		},
+	}
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	in := strings.Join([]string{
+		"",                      // step 0
+		"p",                     // mother's reply is pending
+		"i 0",                   // inspect it
+		"m 0",                   // the recv's pattern
+		`m 0 {"success":"?ok"}`, // another pattern
+		`m 0 {"success":false}`, // no match
+		"m 1",                   // no such message
+		"nope",                  // unknown command
+		"s",                     // step 1
+		"c",                     // continue
+	}, "\n")
+	tst.Debugger = NewDebugger(strings.NewReader(in), &out)
+
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		`phase phase1 step 0:`,
+		`[0] mother ''`,
+		`"success": true`,
+		`match: [{}]`,
+		`match: [{"?ok":true}]`,
+		`no match`,
+		`no pending message 1`,
+		`unknown command 'nope'`,
+		`"Set":{"?x":0}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("output doesn't contain %s:\n%s", want, got)
+		}
+	}
+	// The recv still got the pending message.
+	if i := strings.Index(got, "phase phase1 step 2:"); i < 0 || !strings.Contains(got[i:], "pending: none") {
+		t.Fatal(got)
+	}
+
+	tst.Debugger = NewDebugger(strings.NewReader("q\n"), &out)
+	if errs := tst.Run(ctx); errs == nil {
+		t.Fatal("should have quit")
+	}
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "breakpoint", NewSpec())
+		out bytes.Buffer
+	)
+	tst.Spec.Phases["phase1"] = &Phase{
+		Steps: []*Step{
+			{Set: Set{"?x": 1}},
+			{Set: Set{"?y": 2}},
+			{Set: Set{"?z": 3}, Breakpoint: &Breakpoint{}},
+			{Set: Set{"?w": 4}},
+		},
+	}
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tst.Debugger = NewDebugger(strings.NewReader("c\nb\nc\n"), &out)
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+
+	got := out.String()
+	if strings.Contains(got, "step 1:") {
+		t.Fatalf("paused at step 1:\n%s", got)
+	}
+	if !strings.Contains(got, "breakpoint\nphase phase1 step 2:") {
+		t.Fatalf("didn't pause at the breakpoint:\n%s", got)
+	}
+	if !strings.Contains(got, `"?x":1,"?y":2}`) {
+		t.Fatal(got)
+	}
+	if strings.Contains(got, "step 3:") {
+		t.Fatalf("paused at step 3:\n%s", got)
+	}
+
+	// Without a Debugger, a Breakpoint just logs a snapshot.
+	tst.Debugger = nil
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+}
+
+func TestDebuggerSkipRerunEval(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "rerun", NewSpec())
+		out bytes.Buffer
+	)
+	tst.Spec.Phases["phase1"] = &Phase{
+		Steps: []*Step{
+			{Pub: &Pub{Chan: "mother", Payload: `{"make":{"name":"mock","type":"mock"}}`}},
+			{Recv: &Recv{Chan: "mother", Pattern: `{"success":true}`}},
+			{Pub: &Pub{Chan: "mock", Payload: `"hello"`}},
+			{Recv: &Recv{Chan: "mock", Pattern: `"never"`, Timeout: 10 * time.Millisecond}},
+			{Set: Set{"?done": true}},
+		},
+	}
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	in := strings.Join([]string{
+		"",        // step 0
+		"",        // step 1
+		"",        // step 2
+		"r",       // rerun step 2
+		"p",       // two pending messages now
+		"e 6 * 7", // eval
+		"e 6 *",   // bad Javascript
+		"",        // step 3, which fails
+		"r",       // retry step 3, which fails again
+		"k",       // ignore the failure
+		"k",       // skip step 4
+	}, "\n")
+	tst.Debugger = NewDebugger(strings.NewReader(in), &out)
+
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"rerunning step 2",
+		"step 2 succeeded",
+		`[1] mock ''`,
+		"debug> 42\n",
+		"error: ",
+		"phase phase1 step 3 failed: ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("output doesn't contain %s:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "step 3 failed"); n != 2 {
+		t.Fatalf("step 3 failed %d times:\n%s", n, got)
+	}
+	if _, have := tst.Bindings["?done"]; have {
+		t.Fatal("step 4 should have been skipped")
+	}
+}
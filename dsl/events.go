@@ -0,0 +1,74 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"time"
+)
+
+// ConnectionEventsTopic is the reserved topic for the messages that
+// report a channel's connection events.  See ConnectionEvent.
+const ConnectionEventsTopic = "plax/connection"
+
+const (
+	// ConnectionConnected is the event for the first connection.
+	ConnectionConnected = "connected"
+
+	// ConnectionDisconnected is the event for a lost connection.
+	// The ConnectionEvent's Reason says why, if known.
+	ConnectionDisconnected = "disconnected"
+
+	// ConnectionReconnected is the event for each subsequent
+	// connection.
+	ConnectionReconnected = "reconnected"
+)
+
+// ConnectionEvent is the payload of a message (on
+// ConnectionEventsTopic) that reports a change in a channel's
+// connection.
+type ConnectionEvent struct {
+	Event  string    `json:"event"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// ConnectionEventer is implemented by a Chan that can report its
+// connection events.
+//
+// When a MotherMakeRequest asks for ConnectionEvents, Mother calls
+// EnableConnectionEvents before opening the Chan.  Then the Chan
+// should report each ConnectionEvent with EmitConnectionEvent.
+type ConnectionEventer interface {
+	EnableConnectionEvents(ctx *Ctx)
+}
+
+// EmitConnectionEvent sends (via To) a message with a
+// ConnectionEvent on ConnectionEventsTopic to the given channel.
+func EmitConnectionEvent(ctx *Ctx, c Chan, event, reason string) error {
+	ctx.Logf("Connection event for %s: %s %s", c.Kind(), event, reason)
+	e := ConnectionEvent{
+		Event:  event,
+		Reason: reason,
+		At:     time.Now().UTC(),
+	}
+	return c.To(ctx, Msg{
+		Topic:   ConnectionEventsTopic,
+		Payload: Canon(&e),
+	})
+}
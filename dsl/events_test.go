@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"testing"
+)
+
+func TestMockConnectionEvents(t *testing.T) {
+	ctx := NewCtx(nil)
+	c, err := NewMockChan(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(ConnectionEventer).EnableConnectionEvents(ctx)
+
+	expect := func(event, reason string) {
+		t.Helper()
+		m := <-c.Recv(ctx)
+		if m.Topic != ConnectionEventsTopic {
+			t.Fatal(m.Topic)
+		}
+		e := m.Payload.(map[string]interface{})
+		if e["event"] != event {
+			t.Fatal(e)
+		}
+		if got, _ := e["reason"].(string); got != reason {
+			t.Fatal(e)
+		}
+	}
+
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect(ConnectionConnected, "")
+
+	if err = c.Kill(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect(ConnectionDisconnected, "killed")
+
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect(ConnectionReconnected, "")
+}
+
+// eventlessChan doesn't implement ConnectionEventer.
+type eventlessChan struct {
+	Chan
+}
+
+func TestMotherConnectionEvents(t *testing.T) {
+	TheChanRegistry.Register(NewCtx(nil), "eventless", func(ctx *Ctx, def interface{}) (Chan, error) {
+		c, err := NewMockChan(ctx, def)
+		return &eventlessChan{c}, err
+	})
+
+	ctx, _, tst := newTest(t)
+	if err := tst.InitChans(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m := tst.Chans["mother"]
+
+	makeChan := func(typ string) MotherResponse {
+		t.Helper()
+		err := m.Pub(ctx, Msg{
+			Payload: dejson(`{"make":{"name":"` + typ + `","type":"` + typ + `","connectionEvents":true}}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp MotherResponse
+		if err := As((<-m.Recv(ctx)).Payload, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := makeChan("mock"); !resp.Success {
+		t.Fatal(resp.Error)
+	}
+	if m := <-tst.Chans["mock"].Recv(ctx); m.Topic != ConnectionEventsTopic {
+		t.Fatal(m.Topic)
+	}
+
+	if resp := makeChan("eventless"); resp.Success {
+		t.Fatal("eventless channel shouldn't support connection events")
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// Extract evaluates the expression against the (canonicalized)
+// value.
+//
+// An expression that starts with '$' is a JSONPath expression, and
+// other expressions are JMESPath expressions.  The result is nil if
+// the expression doesn't find anything.
+//
+// Only basic JSONPath is supported: '$', '.NAME', "['NAME']", '[N]'
+// (with negative N counting from the end), and the wildcards '.*'
+// and '[*]'.  A path with a wildcard gives an array of results.
+func Extract(expr string, x interface{}) (interface{}, error) {
+	x = Canon(x)
+	if strings.HasPrefix(expr, "$") {
+		return jsonPath(expr, x)
+	}
+	y, err := jmespath.Search(expr, x)
+	if err != nil {
+		return nil, Brokenf("bad JMESPath '%s': %s", expr, err)
+	}
+	return y, nil
+}
+
+// jsonPath evaluates a basic JSONPath expression.  See Extract.
+func jsonPath(expr string, x interface{}) (interface{}, error) {
+	var (
+		nodes    = []interface{}{x}
+		wildcard bool
+		s        = expr[1:]
+	)
+
+	bad := func(why string) error {
+		return Brokenf("bad JSONPath '%s': %s", expr, why)
+	}
+
+	for s != "" {
+		var (
+			key   string
+			index *int
+			all   bool
+		)
+		switch {
+		case strings.HasPrefix(s, ".."):
+			return nil, bad("recursive descent isn't supported")
+		case strings.HasPrefix(s, ".*"):
+			all, s = true, s[2:]
+		case s[0] == '.':
+			s = s[1:]
+			n := strings.IndexAny(s, ".[")
+			if n < 0 {
+				n = len(s)
+			}
+			if n == 0 {
+				return nil, bad("missing name")
+			}
+			key, s = s[:n], s[n:]
+		case s[0] == '[':
+			n := strings.Index(s, "]")
+			if n < 0 {
+				return nil, bad("missing ']'")
+			}
+			sel := s[1:n]
+			s = s[n+1:]
+			switch {
+			case sel == "*":
+				all = true
+			case 2 <= len(sel) && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				key = sel[1 : len(sel)-1]
+			default:
+				i, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, bad(fmt.Sprintf("bad selector '%s'", sel))
+				}
+				index = &i
+			}
+		default:
+			return nil, bad(fmt.Sprintf("unexpected '%s'", s))
+		}
+
+		if all {
+			wildcard = true
+		}
+
+		acc := make([]interface{}, 0, len(nodes))
+		for _, node := range nodes {
+			switch vv := node.(type) {
+			case map[string]interface{}:
+				if all {
+					ks := make([]string, 0, len(vv))
+					for k := range vv {
+						ks = append(ks, k)
+					}
+					sort.Strings(ks)
+					for _, k := range ks {
+						acc = append(acc, vv[k])
+					}
+				} else if index == nil {
+					if y, have := vv[key]; have {
+						acc = append(acc, y)
+					}
+				}
+			case []interface{}:
+				if all {
+					acc = append(acc, vv...)
+				} else if index != nil {
+					i := *index
+					if i < 0 {
+						i += len(vv)
+					}
+					if 0 <= i && i < len(vv) {
+						acc = append(acc, vv[i])
+					}
+				}
+			}
+		}
+		nodes = acc
+	}
+
+	if wildcard {
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	return nodes[0], nil
+}
+
+// extract evaluates the Recv's Extract expressions against the
+// target.  The result is nil if any expression didn't find
+// anything.
+func (r *Recv) extract(ctx *Ctx, target interface{}) (map[string]interface{}, error) {
+	acc := make(map[string]interface{}, len(r.Extract))
+	for p, expr := range r.Extract {
+		x, err := Extract(expr, target)
+		if err != nil {
+			return nil, err
+		}
+		if x == nil {
+			ctx.Indf("    Recv extract %s found nothing", p)
+			return nil, nil
+		}
+		ctx.Inddf("    Recv extract %s: %s", p, JSON(x))
+		acc[p] = x
+	}
+	return acc, nil
+}
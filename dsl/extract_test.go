@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	x := dejson(`{"data":{"items":[{"id":"a","n":1},{"id":"b","n":2}],"the key":"k"}}`)
+
+	for _, c := range []struct {
+		expr string
+		want string
+	}{
+		{"$.data.items[0].id", `"a"`},
+		{"$.data.items[-1].id", `"b"`},
+		{"$['data']['the key']", `"k"`},
+		{"$.data.items[*].id", `["a","b"]`},
+		{"$.data.items[2].id", `null`},
+		{"$.data.nope", `null`},
+		{"$", JSON(x)},
+		{"data.items[0].id", `"a"`},
+		{"data.items[?n > `1`].id", `["b"]`},
+		{"data.nope", `null`},
+	} {
+		got, err := Extract(c.expr, x)
+		if err != nil {
+			t.Fatalf("%s: %s", c.expr, err)
+		}
+		if js := JSON(got); js != c.want {
+			t.Fatalf("%s: %s", c.expr, js)
+		}
+	}
+
+	for _, expr := range []string{"$..id", "$.data[x]", "$.", "data.[", "$.data.items[0"} {
+		if _, err := Extract(expr, x); err == nil {
+			t.Fatalf("%s: should have complained", expr)
+		}
+	}
+}
+
+func TestRecvExtract(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "", nil)
+		r   = &Recv{
+			Target: "payload",
+			Extract: map[string]string{
+				"?id": "$.items[0].id",
+			},
+		}
+	)
+
+	ok, err := r.consider(ctx, tst, &Msg{Payload: `{"items":[]}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("should not have been satisfied")
+	}
+
+	if ok, err = r.consider(ctx, tst, &Msg{Payload: `{"items":[{"id":"a"}]}`}); err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("should have been satisfied")
+	}
+	if id := tst.Bindings["?id"]; id != "a" {
+		t.Fatal(id)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func init() {
+	TheChanRegistry.Register(NewCtx(nil), "faulty", NewFaultChan)
+	TheChanDocs.Register("faulty", "Wraps another channel and injects delays, drops, duplicates, and reordering.", FaultOpts{})
+}
+
+// FaultOpts configures a FaultChan.
+type FaultOpts struct {
+	// Kind is the type of the wrapped channel.
+	Kind ChanKind `doc:"The type of the wrapped channel."`
+
+	// Opts is the configuration for the wrapped channel.
+	Opts interface{} `json:",omitempty" yaml:",omitempty" doc:"The configuration for the wrapped channel."`
+
+	// Seed seeds the pseudo-random number generator that decides
+	// which faults to inject, so a given Seed gives the same
+	// faults for the same traffic.
+	Seed int64 `json:",omitempty" yaml:",omitempty" doc:"Seed for deciding which faults to inject."`
+
+	// Pub specifies faults for outbound messages.
+	Pub *Faults `json:",omitempty" yaml:",omitempty" doc:"Faults for outbound messages."`
+
+	// Recv specifies faults for inbound messages.
+	Recv *Faults `json:",omitempty" yaml:",omitempty" doc:"Faults for inbound messages."`
+}
+
+// Faults specifies the faults to inject in one direction.
+//
+// Probabilities are between 0 and 1.
+type Faults struct {
+	// Delay is a fixed delay (in Go syntax) for each message.
+	Delay string `json:",omitempty" yaml:",omitempty" doc:"Fixed delay (in Go syntax) for each message."`
+
+	// Jitter is the maximum additional random delay (in Go
+	// syntax).
+	Jitter string `json:",omitempty" yaml:",omitempty" doc:"Maximum additional random delay (in Go syntax)."`
+
+	// Drop is the probability of dropping a message.
+	Drop float64 `json:",omitempty" yaml:",omitempty" doc:"Probability of dropping a message."`
+
+	// Duplicate is the probability of delivering a message
+	// twice.
+	Duplicate float64 `json:",omitempty" yaml:",omitempty" doc:"Probability of delivering a message twice."`
+
+	// Reorder is the probability of holding a message back
+	// until after the next message.
+	Reorder float64 `json:",omitempty" yaml:",omitempty" doc:"Probability of holding a message back until after the next one."`
+
+	delay, jitter time.Duration
+	held          *Msg
+}
+
+func (f *Faults) parse() error {
+	if f == nil {
+		return nil
+	}
+	var err error
+	if f.Delay != "" {
+		if f.delay, err = time.ParseDuration(f.Delay); err != nil {
+			return Brokenf("bad fault Delay '%s': %s", f.Delay, err)
+		}
+	}
+	if f.Jitter != "" {
+		if f.jitter, err = time.ParseDuration(f.Jitter); err != nil {
+			return Brokenf("bad fault Jitter '%s': %s", f.Jitter, err)
+		}
+	}
+	return nil
+}
+
+// FaultChan wraps another Chan and injects delays, drops,
+// duplicates, and reordering.
+type FaultChan struct {
+	opts  *FaultOpts
+	inner Chan
+	c     chan Msg
+
+	// mu protects rng and the Faults' held messages.
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewFaultChan makes a FaultChan and the Chan it wraps.
+func NewFaultChan(ctx *Ctx, cfg interface{}) (Chan, error) {
+	var opts FaultOpts
+	if err := As(cfg, &opts); err != nil {
+		return nil, NewBroken(err)
+	}
+
+	if opts.Kind == "" {
+		return nil, Brokenf("faulty channel needs a Kind")
+	}
+
+	if err := opts.Pub.parse(); err != nil {
+		return nil, err
+	}
+	if err := opts.Recv.parse(); err != nil {
+		return nil, err
+	}
+
+	maker, have := TheChanRegistry[opts.Kind]
+	if !have {
+		return nil, Brokenf("unknown Chan kind: '%s'", opts.Kind)
+	}
+
+	inner, err := maker(ctx, opts.Opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FaultChan{
+		opts:  &opts,
+		inner: inner,
+		c:     make(chan Msg, 1024),
+		rng:   rand.New(rand.NewSource(opts.Seed)),
+	}, nil
+}
+
+func (c *FaultChan) Kind() ChanKind {
+	return "faulty"
+}
+
+// Open opens the wrapped channel and starts forwarding its
+// messages.
+func (c *FaultChan) Open(ctx *Ctx) error {
+	if err := c.inner.Open(ctx); err != nil {
+		return err
+	}
+
+	in := c.inner.Recv(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-in:
+				c.inject(ctx, c.opts.Recv, m, func(m Msg) error {
+					select {
+					case <-ctx.Done():
+					case c.c <- m:
+					}
+					return nil
+				})
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *FaultChan) Close(ctx *Ctx) error {
+	return c.inner.Close(ctx)
+}
+
+// Overflow reports an overflow of the wrapped channel's Buffer (if
+// any).  See Overflower.
+func (c *FaultChan) Overflow() error {
+	if o, is := c.inner.(Overflower); is {
+		return o.Overflow()
+	}
+	return nil
+}
+
+func (c *FaultChan) Kill(ctx *Ctx) error {
+	return c.inner.Kill(ctx)
+}
+
+func (c *FaultChan) Sub(ctx *Ctx, topic string) error {
+	return c.inner.Sub(ctx, topic)
+}
+
+// Pub publishes the given message via the wrapped channel subject to
+// the Pub faults.
+func (c *FaultChan) Pub(ctx *Ctx, m Msg) error {
+	return c.inject(ctx, c.opts.Pub, m, func(m Msg) error {
+		return c.inner.Pub(ctx, m)
+	})
+}
+
+func (c *FaultChan) Recv(ctx *Ctx) chan Msg {
+	return c.c
+}
+
+// To sends the given message to the wrapped channel, so Recv faults
+// apply.
+func (c *FaultChan) To(ctx *Ctx, m Msg) error {
+	return c.inner.To(ctx, m)
+}
+
+// roll reports whether an event with the given probability happens.
+func (c *FaultChan) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64() < p
+}
+
+func (c *FaultChan) wait(f *Faults) {
+	d := f.delay
+	if 0 < f.jitter {
+		c.mu.Lock()
+		d += time.Duration(c.rng.Int63n(int64(f.jitter)))
+		c.mu.Unlock()
+	}
+	if 0 < d {
+		time.Sleep(d)
+	}
+}
+
+// inject applies the given faults to a message and then calls
+// deliver zero or more times.
+func (c *FaultChan) inject(ctx *Ctx, f *Faults, m Msg, deliver func(Msg) error) error {
+	if f == nil {
+		return deliver(m)
+	}
+
+	if c.roll(f.Drop) {
+		ctx.Logf("FaultChan dropping message on '%s'", m.Topic)
+		return nil
+	}
+
+	c.wait(f)
+
+	c.mu.Lock()
+	held := f.held
+	f.held = nil
+	c.mu.Unlock()
+
+	if held == nil && c.roll(f.Reorder) {
+		ctx.Logf("FaultChan holding message on '%s'", m.Topic)
+		c.mu.Lock()
+		f.held = &m
+		c.mu.Unlock()
+		return nil
+	}
+
+	if err := deliver(m); err != nil {
+		return err
+	}
+
+	if c.roll(f.Duplicate) {
+		ctx.Logf("FaultChan duplicating message on '%s'", m.Topic)
+		if err := deliver(m); err != nil {
+			return err
+		}
+	}
+
+	if held != nil {
+		ctx.Logf("FaultChan releasing held message on '%s'", held.Topic)
+		return deliver(*held)
+	}
+
+	return nil
+}
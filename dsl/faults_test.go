@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFaultChan(t *testing.T) {
+	open := func(t *testing.T, opts *FaultOpts) (*Ctx, Chan) {
+		ctx, cancel := NewCtx(nil).WithCancel()
+		t.Cleanup(cancel)
+		c, err := NewFaultChan(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if "faulty" != c.Kind() {
+			t.Fatal(c.Kind())
+		}
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return ctx, c
+	}
+
+	recv := func(ctx *Ctx, c Chan) (Msg, bool) {
+		select {
+		case m := <-c.Recv(ctx):
+			return m, true
+		case <-time.After(100 * time.Millisecond):
+			return Msg{}, false
+		}
+	}
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx, c := open(t, &FaultOpts{Kind: "mock"})
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		m, ok := recv(ctx, c)
+		if !ok {
+			t.Fatal("nothing received")
+		}
+		if m.Payload != "hi" {
+			t.Fatal(m.Payload)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		ctx, c := open(t, &FaultOpts{
+			Kind: "mock",
+			Pub: &Faults{
+				Drop: 1,
+			},
+		})
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := recv(ctx, c); ok {
+			t.Fatal(m)
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		ctx, c := open(t, &FaultOpts{
+			Kind: "mock",
+			Recv: &Faults{
+				Duplicate: 1,
+			},
+		})
+		if err := c.To(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, ok := recv(ctx, c); !ok {
+				t.Fatal(i)
+			}
+		}
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		ctx, c := open(t, &FaultOpts{
+			Kind: "mock",
+			Pub: &Faults{
+				Reorder: 1,
+			},
+		})
+		for _, s := range []string{"1", "2"} {
+			if err := c.Pub(ctx, Msg{Topic: "t", Payload: s}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, s := range []string{"2", "1"} {
+			m, ok := recv(ctx, c)
+			if !ok {
+				t.Fatal(s)
+			}
+			if m.Payload != s {
+				t.Fatal(m.Payload)
+			}
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		ctx, c := open(t, &FaultOpts{
+			Kind: "mock",
+			Pub: &Faults{
+				Delay: "50ms",
+			},
+		})
+		then := time.Now()
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Now().Sub(then); elapsed < 50*time.Millisecond {
+			t.Fatal(elapsed)
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		ctx := NewCtx(nil)
+		if _, err := NewFaultChan(ctx, &FaultOpts{}); err == nil {
+			t.Fatal("should have complained about missing Kind")
+		}
+		if _, err := NewFaultChan(ctx, &FaultOpts{Kind: "mock", Pub: &Faults{Delay: "soon"}}); err == nil {
+			t.Fatal("should have complained about Delay")
+		}
+	})
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultFetchTimeout is the default timeout for the Javascript
+// fetch function.
+var DefaultFetchTimeout = 10 * time.Second
+
+// FetchOpts are the options for the Javascript function fetch(url,
+// opts).
+type FetchOpts struct {
+	// Method defaults to GET.
+	Method string
+
+	// Headers maps header names to a string or an array of
+	// strings.
+	Headers map[string]interface{}
+
+	// Body is the request body.  If Body isn't a string, it'll be
+	// JSON-serialized.
+	Body interface{}
+
+	// Timeout (in Go syntax) defaults to DefaultFetchTimeout.
+	Timeout string
+
+	// Insecure, when true, skips verification of the server's
+	// certificate.  Use only for testing.
+	Insecure bool
+
+	// CACertFile is the optional filename for the certificate
+	// authority.
+	CACertFile string
+
+	// CertFile and KeyFile are optional filenames for the client's
+	// certificate and private key.
+	CertFile, KeyFile string
+}
+
+// fetch returns a Javascript function fetch(url, opts) that makes an
+// HTTP request synchronously.
+//
+// The result is an object with 'status' (a number), 'ok' (true for
+// a 2xx status), 'headers' (an object mapping header names to their
+// first values), 'body' (a string), and 'json' (the parsed body, if
+// it's JSON, or else null).
+//
+// Relative filenames in the options are relative to the test's Dir.
+func (t *Test) fetch(ctx *Ctx) func(string, interface{}) (map[string]interface{}, error) {
+	return func(u string, x interface{}) (map[string]interface{}, error) {
+		var opts FetchOpts
+		if x != nil {
+			if err := As(x, &opts); err != nil {
+				return nil, fmt.Errorf("fetch options: %w", err)
+			}
+		}
+		return t.doFetch(ctx, u, &opts)
+	}
+}
+
+// testFile resolves a filename relative to the test's Dir.
+func (t *Test) testFile(filename string) string {
+	if filename == "" || filepath.IsAbs(filename) || t.Dir == "" {
+		return filename
+	}
+	return filepath.Join(t.Dir, filename)
+}
+
+func (t *Test) doFetch(ctx *Ctx, u string, opts *FetchOpts) (map[string]interface{}, error) {
+	timeout := DefaultFetchTimeout
+	if opts.Timeout != "" {
+		d, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("bad fetch Timeout '%s': %w", opts.Timeout, err)
+		}
+		timeout = d
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.Insecure,
+	}
+	if opts.CACertFile != "" {
+		bs, err := ioutil.ReadFile(t.testFile(opts.CACertFile))
+		if err != nil {
+			return nil, fmt.Errorf("fetch CACertFile: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return nil, fmt.Errorf("fetch CACertFile '%s' has no certificates", opts.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.testFile(opts.CertFile), t.testFile(opts.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("fetch CertFile/KeyFile: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	var body io.Reader
+	if opts.Body != nil {
+		s, is := opts.Body.(string)
+		if !is {
+			js, err := json.Marshal(&opts.Body)
+			if err != nil {
+				return nil, fmt.Errorf("fetch Body: %w", err)
+			}
+			s = string(js)
+		}
+		body = strings.NewReader(s)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts.Headers {
+		switch vv := v.(type) {
+		case string:
+			req.Header.Add(k, vv)
+		case []interface{}:
+			for _, x := range vv {
+				req.Header.Add(k, fmt.Sprintf("%v", x))
+			}
+		default:
+			req.Header.Add(k, fmt.Sprintf("%v", vv))
+		}
+	}
+
+	ctx.Indf("    fetch %s %s", method, u)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Inddf("    fetch status %d body %s", resp.StatusCode, bs)
+
+	headers := make(map[string]interface{}, len(resp.Header))
+	for k := range resp.Header {
+		headers[k] = resp.Header.Get(k)
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(bs, &parsed); err != nil {
+		parsed = nil
+	}
+
+	return map[string]interface{}{
+		"status":  resp.StatusCode,
+		"ok":      200 <= resp.StatusCode && resp.StatusCode < 300,
+		"headers": headers,
+		"body":    string(bs),
+		"json":    parsed,
+	}, nil
+}
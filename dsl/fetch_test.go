@@ -0,0 +1,148 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/echo":
+			bs, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"method":"` + r.Method + `","auth":"` + r.Header.Get("Authorization") + `","body":` + string(bs) + `}`))
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "a", nil)
+	)
+
+	exec := func(t *testing.T, src string) (interface{}, error) {
+		src, err := tst.prepareSource(ctx, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tst.JSExec(ctx, src, tst.jsEnv(ctx))
+	}
+
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	t.Run("get", func(t *testing.T) {
+		x, err := exec(t, `
+var r = fetch("`+s.URL+`/hi");
+return r.ok && r.status == 200 && r.body == "hello" && r.json === null;`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x != true {
+			t.Fatal(x)
+		}
+	})
+
+	t.Run("post", func(t *testing.T) {
+		x, err := exec(t, `
+var r = fetch("`+s.URL+`/echo", {
+  method: "POST",
+  headers: {Authorization: "Bearer tacos"},
+  body: {want: "queso"}
+});
+return r.json.method == "POST" && r.json.auth == "Bearer tacos" && r.json.body.want == "queso" &&
+  r.headers["Content-Type"] == "application/json";`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x != true {
+			t.Fatal(x)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, err := exec(t, `fetch("`+s.URL+`/slow", {timeout: "10ms"});`)
+		if err == nil {
+			t.Fatal("expected a timeout")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		cctx, cancel := ctx.WithCancel()
+		cancel()
+		if _, err := tst.doFetch(cctx, s.URL+"/hi", &FetchOpts{}); err == nil {
+			t.Fatal("expected a cancellation")
+		}
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		ts := httptest.NewTLSServer(handler)
+		defer ts.Close()
+
+		if _, err := exec(t, `fetch("`+ts.URL+`/hi");`); err == nil {
+			t.Fatal("expected a certificate problem")
+		} else if !strings.Contains(err.Error(), "certificate") {
+			t.Fatal(err)
+		}
+
+		x, err := exec(t, `return fetch("`+ts.URL+`/hi", {insecure: true}).body;`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x != "hello" {
+			t.Fatal(x)
+		}
+	})
+}
+
+func TestFetchPubRun(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer s.Close()
+
+	ctx, spec, tst := newTest(t)
+
+	p := &Phase{}
+	spec.Phases["phase1"] = p
+	addMock(t, ctx, p)
+
+	p.AddStep(ctx, &Step{
+		Pub: &Pub{
+			Payload: `"tacos"`,
+			Run:     `fetch("` + s.URL + `/hi");`,
+		},
+	})
+	run(t, ctx, tst)
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatal(n)
+	}
+}
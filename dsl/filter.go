@@ -0,0 +1,222 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/Comcast/sheens/match"
+)
+
+// DefaultDedupeWindow is the default Dedupe.Window.
+var DefaultDedupeWindow = time.Minute
+
+// InboundFilter admits only some of a channel's inbound messages.
+// The test applies the filter before Recvs (and RecvSeqs and
+// windows) see the messages, so noisy traffic doesn't slow or
+// confuse their pattern matching.
+//
+// A message must satisfy both the Pattern and Admit (when given).
+type InboundFilter struct {
+	// Pattern, if given, admits only messages that match it.
+	Pattern interface{} `json:"pattern,omitempty"`
+
+	// Target is "payload" (the default), which matches the
+	// Pattern against a message's payload, or "msg", which
+	// matches the Pattern against {"Topic":TOPIC,"Payload":PAYLOAD}.
+	Target string `json:"target,omitempty"`
+
+	// Admit, if given, is a Javascript expression that admits a
+	// message (available as 'msg') if the expression's value is
+	// truthy.
+	Admit string `json:"admit,omitempty"`
+}
+
+func (f *InboundFilter) check() error {
+	switch f.Target {
+	case "payload", "Payload", "":
+		f.Target = "payload"
+	case "msg", "message", "Message":
+		f.Target = "msg"
+	default:
+		return Brokenf("bad filter Target '%s'", f.Target)
+	}
+	return nil
+}
+
+// Dedupe discards a channel's inbound messages that duplicate a
+// message that arrived within the Window.
+//
+// By default, messages are duplicates if they have the same topic
+// and (canonical) payload.  With a Key, messages are duplicates if
+// Key extracts the same value from their payloads.
+type Dedupe struct {
+	// Window (in Go syntax) is how long a message is remembered.
+	// The default is DefaultDedupeWindow.
+	Window string `json:"window,omitempty"`
+
+	// Key, if given, is a JSONPath (starting with '$') or
+	// JMESPath expression that extracts a message's identity
+	// from its payload.  See Extract.
+	Key string `json:"key,omitempty"`
+
+	window time.Duration
+}
+
+func (d *Dedupe) check() error {
+	d.window = DefaultDedupeWindow
+	if d.Window != "" {
+		w, err := time.ParseDuration(d.Window)
+		if err != nil {
+			return Brokenf("bad dedupe Window '%s': %s", d.Window, err)
+		}
+		d.window = w
+	}
+	return nil
+}
+
+// chanFilter is the filtering state for one channel.
+type chanFilter struct {
+	filter *InboundFilter
+	dedupe *Dedupe
+
+	// seen maps a message's identity to the time it arrived.
+	seen map[string]time.Time
+}
+
+// addFilter prepares and registers the given channel's
+// InboundFilter and Dedupe (either of which can be nil).
+func (t *Test) addFilter(name string, f *InboundFilter, d *Dedupe) error {
+	if f == nil && d == nil {
+		return nil
+	}
+	if f != nil {
+		if err := f.check(); err != nil {
+			return err
+		}
+	}
+	if d != nil {
+		if err := d.check(); err != nil {
+			return err
+		}
+	}
+	if t.filters == nil {
+		t.filters = make(map[string]*chanFilter)
+	}
+	t.filters[name] = &chanFilter{
+		filter: f,
+		dedupe: d,
+		seen:   make(map[string]time.Time),
+	}
+	return nil
+}
+
+// admit reports whether the message that arrived on the named
+// channel passes the channel's InboundFilter and Dedupe (if any).
+//
+// First, admit rewrites the message's topic according to the
+// channel's TopicRules (if any), so filters see the topic as the
+// spec wrote it.
+func (t *Test) admit(ctx *Ctx, name string, m *Msg) (bool, error) {
+	t.inboundTopic(name, m)
+
+	cf, have := t.filters[name]
+	if !have {
+		return true, nil
+	}
+
+	payload := MaybeParseJSON(m.Payload)
+	msg := map[string]interface{}{
+		"Topic":   m.Topic,
+		"Payload": payload,
+	}
+
+	if f := cf.filter; f != nil {
+		if f.Pattern != nil {
+			var target interface{} = msg
+			if f.Target == "payload" {
+				target = payload
+			}
+			bss, err := match.Match(Canon(f.Pattern), Canon(target), match.NewBindings())
+			if err != nil {
+				return false, NewBroken(fmt.Errorf("filter pattern: %w", err))
+			}
+			if len(bss) == 0 {
+				ctx.Indf("    Channel %s filtered message on '%s'", name, m.Topic)
+				return false, nil
+			}
+		}
+		if f.Admit != "" {
+			src, err := t.prepareSource(ctx, "return ("+f.Admit+");")
+			if err != nil {
+				return false, err
+			}
+			env := t.jsEnv(ctx)
+			env["msg"] = msg
+			x, err := t.JSExec(ctx, src, env)
+			if err != nil {
+				return false, Categorize(CategoryJavascript, fmt.Errorf("filter admit: %w", err))
+			}
+			if !truthy(x) {
+				ctx.Indf("    Channel %s filtered message on '%s'", name, m.Topic)
+				return false, nil
+			}
+		}
+	}
+
+	if d := cf.dedupe; d != nil {
+		id, err := d.identity(m.Topic, payload)
+		if err != nil {
+			return false, err
+		}
+		if id == "" {
+			// No identity, so not a duplicate.
+			return true, nil
+		}
+		now := time.Now()
+		for k, then := range cf.seen {
+			if d.window < now.Sub(then) {
+				delete(cf.seen, k)
+			}
+		}
+		if _, have := cf.seen[id]; have {
+			ctx.Indf("    Channel %s discarded duplicate message on '%s'", name, m.Topic)
+			return false, nil
+		}
+		cf.seen[id] = now
+	}
+
+	return true, nil
+}
+
+// identity returns a message's identity for deduplication, which is
+// empty if the Key doesn't find anything.
+func (d *Dedupe) identity(topic string, payload interface{}) (string, error) {
+	if d.Key != "" {
+		x, err := Extract(d.Key, payload)
+		if err != nil || x == nil {
+			return "", err
+		}
+		return JSON(x), nil
+	}
+	h := sha256.Sum256([]byte(topic + "\n" + JSON(Canon(payload))))
+	return hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdmit(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	admits := func(t *testing.T, tst *Test, m Msg, want bool) {
+		t.Helper()
+		got, err := tst.admit(ctx, "c", &m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("admit(%s %s) = %v; wanted %v", m.Topic, JSON(m.Payload), got, want)
+		}
+	}
+
+	newTest := func(t *testing.T, f *InboundFilter, d *Dedupe) *Test {
+		tst := NewTest(ctx, "a", &Spec{})
+		if err := tst.addFilter("c", f, d); err != nil {
+			t.Fatal(err)
+		}
+		return tst
+	}
+
+	t.Run("unfiltered", func(t *testing.T) {
+		tst := newTest(t, nil, nil)
+		admits(t, tst, Msg{Payload: `{"x":1}`}, true)
+		admits(t, tst, Msg{Payload: `{"x":1}`}, true)
+	})
+
+	t.Run("pattern", func(t *testing.T) {
+		tst := newTest(t, &InboundFilter{
+			Pattern: map[string]interface{}{"want": "?x"},
+		}, nil)
+		admits(t, tst, Msg{Payload: `{"want":"tacos"}`}, true)
+		admits(t, tst, Msg{Payload: `{"heartbeat":true}`}, false)
+		admits(t, tst, Msg{Payload: `not json`}, false)
+	})
+
+	t.Run("msg", func(t *testing.T) {
+		tst := newTest(t, &InboundFilter{
+			Pattern: map[string]interface{}{"Topic": "data"},
+			Target:  "msg",
+		}, nil)
+		admits(t, tst, Msg{Topic: "data", Payload: `{}`}, true)
+		admits(t, tst, Msg{Topic: "noise", Payload: `{}`}, false)
+	})
+
+	t.Run("admit", func(t *testing.T) {
+		tst := newTest(t, &InboundFilter{
+			Admit: "msg.Payload.n % 2 == 0",
+		}, nil)
+		admits(t, tst, Msg{Payload: `{"n":2}`}, true)
+		admits(t, tst, Msg{Payload: `{"n":3}`}, false)
+	})
+
+	t.Run("bad-admit", func(t *testing.T) {
+		tst := newTest(t, &InboundFilter{
+			Admit: "msg.Payload.no.such",
+		}, nil)
+		if _, err := tst.admit(ctx, "c", &Msg{Payload: `{}`}); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("bad-target", func(t *testing.T) {
+		tst := NewTest(ctx, "a", &Spec{})
+		if err := tst.addFilter("c", &InboundFilter{Target: "headers"}, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("dedupe", func(t *testing.T) {
+		tst := newTest(t, nil, &Dedupe{})
+		admits(t, tst, Msg{Topic: "a", Payload: `{"x":1,"y":2}`}, true)
+		// Same canonical payload.
+		admits(t, tst, Msg{Topic: "a", Payload: `{"y":2, "x":1}`}, false)
+		// Different topic.
+		admits(t, tst, Msg{Topic: "b", Payload: `{"x":1,"y":2}`}, true)
+		admits(t, tst, Msg{Topic: "a", Payload: `{"x":1,"y":3}`}, true)
+	})
+
+	t.Run("dedupe-key", func(t *testing.T) {
+		tst := newTest(t, nil, &Dedupe{
+			Key: "$.id",
+		})
+		admits(t, tst, Msg{Payload: `{"id":1,"n":1}`}, true)
+		admits(t, tst, Msg{Payload: `{"id":1,"n":2}`}, false)
+		admits(t, tst, Msg{Payload: `{"id":2,"n":3}`}, true)
+		// No identity.
+		admits(t, tst, Msg{Payload: `{"n":4}`}, true)
+		admits(t, tst, Msg{Payload: `{"n":4}`}, true)
+	})
+
+	t.Run("dedupe-window", func(t *testing.T) {
+		tst := newTest(t, nil, &Dedupe{
+			Window: "50ms",
+		})
+		admits(t, tst, Msg{Payload: `{"x":1}`}, true)
+		admits(t, tst, Msg{Payload: `{"x":1}`}, false)
+		time.Sleep(100 * time.Millisecond)
+		admits(t, tst, Msg{Payload: `{"x":1}`}, true)
+	})
+
+	t.Run("bad-window", func(t *testing.T) {
+		tst := NewTest(ctx, "a", &Spec{})
+		if err := tst.addFilter("c", nil, &Dedupe{Window: "soon"}); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
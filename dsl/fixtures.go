@@ -0,0 +1,74 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+// subFixture performs bindings substitution on the named fixture
+// (or, without a name, on src) into target.
+//
+// The given With bindings (after their own substitution) apply only
+// to the fixture, and they take precedence over the test's bindings.
+func (t *Test) subFixture(ctx *Ctx, name string, with map[string]interface{}, src, target interface{}) error {
+	if name == "" {
+		if with != nil {
+			return Brokenf("With requires a Fixture")
+		}
+		return t.Bindings.Sub(ctx, src, target, true)
+	}
+
+	if src != nil {
+		return Brokenf("can't have both a Fixture and a payload or pattern")
+	}
+
+	var fixture interface{}
+	if t.Spec != nil {
+		fixture = t.Spec.Fixtures[name]
+	}
+	if fixture == nil {
+		return Brokenf("unknown Fixture '%s'", name)
+	}
+	ctx.Inddf("    Fixture %s: %s", name, JSON(fixture))
+
+	bs := Bindings(CopyBindings(t.Bindings))
+	for p, v := range with {
+		var x interface{}
+		if err := t.Bindings.Sub(ctx, v, &x, false); err != nil {
+			return err
+		}
+		bs[p] = x
+	}
+
+	return bs.Sub(ctx, fixture, target, true)
+}
+
+// checkFixture returns an error if the reference to a fixture isn't
+// good.
+func (s *Spec) checkFixture(name string, with map[string]interface{}, src interface{}) error {
+	if name == "" {
+		if with != nil {
+			return Brokenf("With requires a Fixture")
+		}
+		return nil
+	}
+	if src != nil {
+		return Brokenf("can't have both a Fixture and a payload or pattern")
+	}
+	if _, have := s.Fixtures[name]; !have {
+		return Brokenf("unknown Fixture '%s'", name)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	var (
+		ctx  = NewCtx(nil)
+		spec = NewSpec()
+		tst  = NewTest(ctx, "", spec)
+	)
+	spec.Fixtures = map[string]interface{}{
+		"order": map[string]interface{}{
+			"want": "?want",
+			"n":    "?n",
+		},
+	}
+	tst.Bindings = map[string]interface{}{
+		"?want": "tacos",
+		"?n":    2,
+		"?m":    3,
+	}
+
+	var x interface{}
+	if err := tst.subFixture(ctx, "order", nil, nil, &x); err != nil {
+		t.Fatal(err)
+	}
+	if js := JSON(x); js != `{"n":2,"want":"tacos"}` {
+		t.Fatal(js)
+	}
+
+	// With takes precedence, and its values get substitution.
+	with := map[string]interface{}{"?want": "queso", "?n": "?m"}
+	if err := tst.subFixture(ctx, "order", with, nil, &x); err != nil {
+		t.Fatal(err)
+	}
+	if js := JSON(x); js != `{"n":3,"want":"queso"}` {
+		t.Fatal(js)
+	}
+	// With doesn't change the test's bindings.
+	if tst.Bindings["?want"] != "tacos" {
+		t.Fatal(tst.Bindings["?want"])
+	}
+
+	if err := tst.subFixture(ctx, "nope", nil, nil, &x); err == nil {
+		t.Fatal("should have complained")
+	}
+	if err := tst.subFixture(ctx, "order", nil, "payload", &x); err == nil {
+		t.Fatal("should have complained")
+	}
+	if err := tst.subFixture(ctx, "", with, "payload", &x); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	for _, c := range []struct {
+		name string
+		with map[string]interface{}
+		src  interface{}
+		ok   bool
+	}{
+		{"", nil, "payload", true},
+		{"order", with, nil, true},
+		{"nope", nil, nil, false},
+		{"order", nil, "payload", false},
+		{"", with, nil, false},
+	} {
+		if err := spec.checkFixture(c.name, c.with, c.src); (err == nil) != c.ok {
+			t.Fatalf("%#v: %v", c, err)
+		}
+	}
+}
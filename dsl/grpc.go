@@ -0,0 +1,249 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/net/http2"
+)
+
+// This file has just enough gRPC (over HTTP/2 without TLS) for the
+// channel plugin protocol: unary and server-streaming calls with
+// uncompressed messages.
+
+// gRPC status codes that the plugin protocol uses.
+const (
+	grpcOK              = 0
+	grpcUnknown         = 2
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+)
+
+// grpcError is a gRPC status other than OK.
+type grpcError struct {
+	Code    int
+	Message string
+}
+
+func (e *grpcError) Error() string {
+	return fmt.Sprintf("gRPC status %d: %s", e.Code, e.Message)
+}
+
+// grpcFrame returns the length-prefixed message.
+func grpcFrame(msg []byte) []byte {
+	bs := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(bs[1:], uint32(len(msg)))
+	return append(bs, msg...)
+}
+
+// grpcReadFrame reads a length-prefixed message.  It returns io.EOF
+// when there are no more messages.
+func grpcReadFrame(r io.Reader) ([]byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated gRPC message")
+		}
+		return nil, err
+	}
+	if head[0] != 0 {
+		return nil, fmt.Errorf("compressed gRPC messages aren't supported")
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(head[1:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("truncated gRPC message")
+	}
+	return msg, nil
+}
+
+// grpcClient calls methods on a gRPC server at the given address.
+type grpcClient struct {
+	client *http.Client
+}
+
+func newGRPCClient(network, addr string) *grpcClient {
+	t := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(string, string, *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	return &grpcClient{
+		client: &http.Client{Transport: t},
+	}
+}
+
+// grpcStream is the response to a call.
+type grpcStream struct {
+	resp *http.Response
+}
+
+// stream calls the method (like "/plax.plugin.Chan/Recv") and returns
+// the stream of response messages.
+func (c *grpcClient) stream(ctx context.Context, method string, msg []byte) (*grpcStream, error) {
+	req, err := http.NewRequest("POST", "http://plugin"+method, bytes.NewReader(grpcFrame(msg)))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("gRPC call %s: HTTP status %d", method, resp.StatusCode)
+	}
+	return &grpcStream{resp: resp}, nil
+}
+
+// Recv returns the next message or, at the end of the stream, either
+// io.EOF or the grpcError.
+func (s *grpcStream) Recv() ([]byte, error) {
+	msg, err := grpcReadFrame(s.resp.Body)
+	if err != io.EOF {
+		return msg, err
+	}
+	// A response without messages can have its status in its
+	// headers rather than its trailers.
+	h := s.resp.Trailer
+	if h.Get("Grpc-Status") == "" {
+		h = s.resp.Header
+	}
+	code, err := strconv.Atoi(h.Get("Grpc-Status"))
+	if err != nil {
+		return nil, fmt.Errorf("bad gRPC status '%s'", h.Get("Grpc-Status"))
+	}
+	if code == grpcOK {
+		return nil, io.EOF
+	}
+	text, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		text = h.Get("Grpc-Message")
+	}
+	return nil, &grpcError{
+		Code:    code,
+		Message: text,
+	}
+}
+
+func (s *grpcStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// call calls a unary method.
+func (c *grpcClient) call(ctx context.Context, method string, msg []byte) ([]byte, error) {
+	s, err := c.stream(ctx, method, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	resp, err := s.Recv()
+	if err == io.EOF {
+		return nil, fmt.Errorf("gRPC call %s: no response", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.Recv(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("gRPC call %s: more than one response", method)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// grpcMethod handles a call.  A unary method calls send once.
+type grpcMethod func(ctx context.Context, msg []byte, send func([]byte) error) error
+
+// grpcServer is an http.Handler for gRPC methods, which are keyed by
+// path (like "/plax.plugin.Chan/Recv").
+type grpcServer map[string]grpcMethod
+
+func (s grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	if f, is := w.(http.Flusher); is {
+		f.Flush()
+	}
+
+	err := s.serve(w, r)
+	code := grpcOK
+	if err != nil {
+		code = grpcUnknown
+		if e, is := err.(*grpcError); is {
+			code = e.Code
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(err.Error()))
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+}
+
+func (s grpcServer) serve(w http.ResponseWriter, r *http.Request) error {
+	m, have := s[r.URL.Path]
+	if !have {
+		return &grpcError{
+			Code:    grpcUnimplemented,
+			Message: "unknown method " + r.URL.Path,
+		}
+	}
+	msg, err := grpcReadFrame(r.Body)
+	if err != nil {
+		return err
+	}
+	send := func(msg []byte) error {
+		if _, err := w.Write(grpcFrame(msg)); err != nil {
+			return err
+		}
+		if f, is := w.(http.Flusher); is {
+			f.Flush()
+		}
+		return nil
+	}
+	return m(r.Context(), msg, send)
+}
+
+// serveGRPC serves the gRPC methods on the listener (without TLS)
+// until the listener is closed.
+func serveGRPC(l net.Listener, s grpcServer) error {
+	h2 := &http2.Server{}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go h2.ServeConn(conn, &http2.ServeConnOpts{
+			Handler: s,
+		})
+	}
+}
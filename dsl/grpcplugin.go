@@ -0,0 +1,847 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// A gRPC channel plugin is a program that serves the Chan service in
+// plugins/proto/chan.proto.  Plax starts the program as HashiCorp
+// go-plugin does, so a plugin can be written with go-plugin (using
+// PluginCookieKey, PluginCookieValue, and PluginProtocolVersion as
+// its HandshakeConfig) or with ServeChanPlugin.
+
+const (
+	// PluginCookieKey is the environment variable that tells a
+	// program that plax started it as a plugin.
+	PluginCookieKey = "PLAX_PLUGIN"
+
+	// PluginCookieValue is the value of PluginCookieKey.
+	PluginCookieValue = "0f8bb5a0-plax-chan-plugin"
+
+	// PluginProtocolVersion is the version of the Chan service.
+	PluginProtocolVersion = 1
+)
+
+// PluginStartTimeout is how long LoadGRPCPlugin waits for a plugin
+// to announce its address.
+var PluginStartTimeout = 10 * time.Second
+
+// pluginRequest is a plax.plugin.Request.
+type pluginRequest struct {
+	ID    uint64
+	Kind  string
+	Opts  string
+	Topic string
+	Msg   *pluginMsg
+}
+
+// pluginResponse is a plax.plugin.Response.
+type pluginResponse struct {
+	ID    uint64
+	Kinds []*pluginKind
+	Msg   *pluginMsg
+}
+
+// pluginKind is a plax.plugin.Kind.
+type pluginKind struct {
+	Name string
+	Doc  string
+}
+
+// pluginMsg is a plax.plugin.Msg.
+type pluginMsg struct {
+	Topic      string
+	Payload    string
+	ReceivedAt int64
+}
+
+func pbString(bs []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return bs
+	}
+	bs = protowire.AppendTag(bs, num, protowire.BytesType)
+	return protowire.AppendString(bs, s)
+}
+
+func pbVarint(bs []byte, num protowire.Number, n uint64) []byte {
+	if n == 0 {
+		return bs
+	}
+	bs = protowire.AppendTag(bs, num, protowire.VarintType)
+	return protowire.AppendVarint(bs, n)
+}
+
+func pbMessage(bs []byte, num protowire.Number, msg []byte) []byte {
+	bs = protowire.AppendTag(bs, num, protowire.BytesType)
+	return protowire.AppendBytes(bs, msg)
+}
+
+// pbFields calls f with each field's number and either its bytes or
+// its varint.  Fields of other types are skipped.
+func pbFields(bs []byte, f func(num protowire.Number, v []byte, n uint64) error) error {
+	for 0 < len(bs) {
+		num, typ, k := protowire.ConsumeTag(bs)
+		if k < 0 {
+			return protowire.ParseError(k)
+		}
+		bs = bs[k:]
+		var (
+			v []byte
+			n uint64
+		)
+		switch typ {
+		case protowire.VarintType:
+			n, k = protowire.ConsumeVarint(bs)
+		case protowire.BytesType:
+			v, k = protowire.ConsumeBytes(bs)
+		default:
+			k = protowire.ConsumeFieldValue(num, typ, bs)
+		}
+		if k < 0 {
+			return protowire.ParseError(k)
+		}
+		bs = bs[k:]
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			if err := f(num, v, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *pluginMsg) marshal() []byte {
+	var bs []byte
+	bs = pbString(bs, 1, m.Topic)
+	bs = pbString(bs, 2, m.Payload)
+	return pbVarint(bs, 3, uint64(m.ReceivedAt))
+}
+
+func (m *pluginMsg) unmarshal(bs []byte) error {
+	return pbFields(bs, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Topic = string(v)
+		case 2:
+			m.Payload = string(v)
+		case 3:
+			m.ReceivedAt = int64(n)
+		}
+		return nil
+	})
+}
+
+func (r *pluginRequest) marshal() []byte {
+	var bs []byte
+	bs = pbVarint(bs, 1, r.ID)
+	bs = pbString(bs, 2, r.Kind)
+	bs = pbString(bs, 3, r.Opts)
+	bs = pbString(bs, 4, r.Topic)
+	if r.Msg != nil {
+		bs = pbMessage(bs, 5, r.Msg.marshal())
+	}
+	return bs
+}
+
+func (r *pluginRequest) unmarshal(bs []byte) error {
+	return pbFields(bs, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			r.ID = n
+		case 2:
+			r.Kind = string(v)
+		case 3:
+			r.Opts = string(v)
+		case 4:
+			r.Topic = string(v)
+		case 5:
+			r.Msg = &pluginMsg{}
+			return r.Msg.unmarshal(v)
+		}
+		return nil
+	})
+}
+
+func (r *pluginResponse) marshal() []byte {
+	var bs []byte
+	bs = pbVarint(bs, 1, r.ID)
+	for _, k := range r.Kinds {
+		var kbs []byte
+		kbs = pbString(kbs, 1, k.Name)
+		kbs = pbString(kbs, 2, k.Doc)
+		bs = pbMessage(bs, 2, kbs)
+	}
+	if r.Msg != nil {
+		bs = pbMessage(bs, 3, r.Msg.marshal())
+	}
+	return bs
+}
+
+func (r *pluginResponse) unmarshal(bs []byte) error {
+	return pbFields(bs, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			r.ID = n
+		case 2:
+			k := &pluginKind{}
+			r.Kinds = append(r.Kinds, k)
+			return pbFields(v, func(num protowire.Number, v []byte, n uint64) error {
+				switch num {
+				case 1:
+					k.Name = string(v)
+				case 2:
+					k.Doc = string(v)
+				}
+				return nil
+			})
+		case 3:
+			r.Msg = &pluginMsg{}
+			return r.Msg.unmarshal(v)
+		}
+		return nil
+	})
+}
+
+// grpcPlugin is a running plugin program.
+type grpcPlugin struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	client *grpcClient
+}
+
+var (
+	// grpcPlugins are the running plugins.  See ClosePlugins.
+	grpcPlugins []*grpcPlugin
+
+	// grpcPluginsMu protects grpcPlugins.
+	grpcPluginsMu sync.Mutex
+)
+
+// LoadGRPCPlugin starts a gRPC plugin program (see ServeChanPlugin)
+// and registers the channel types that it provides.  The program
+// runs until ClosePlugins.
+//
+// A file that isn't executable is ignored.
+func LoadGRPCPlugin(ctx *Ctx, filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&0111 == 0 {
+		ctx.Logdf("Ignoring %s, which isn't executable", filename)
+		return nil
+	}
+
+	p := &grpcPlugin{
+		name: info.Name(),
+		cmd:  exec.Command(filename),
+	}
+	p.cmd.Env = append(os.Environ(),
+		PluginCookieKey+"="+PluginCookieValue,
+		fmt.Sprintf("PLUGIN_PROTOCOL_VERSIONS=%d", PluginProtocolVersion),
+		"PLUGIN_MIN_PORT=10000",
+		"PLUGIN_MAX_PORT=25000")
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := p.cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = p.cmd.Start(); err != nil {
+		return err
+	}
+
+	go p.log(ctx, stderr)
+
+	lines := make(chan string, 1)
+	go func() {
+		in := bufio.NewScanner(stdout)
+		if in.Scan() {
+			lines <- in.Text()
+		}
+		close(lines)
+		for in.Scan() {
+			ctx.Logf("plugin %s: %s", p.name, in.Text())
+		}
+	}()
+
+	var line string
+	select {
+	case line = <-lines:
+	case <-time.After(PluginStartTimeout):
+	}
+
+	if err = p.start(ctx, line); err != nil {
+		p.cmd.Process.Kill()
+		p.cmd.Wait()
+		return err
+	}
+
+	grpcPluginsMu.Lock()
+	grpcPlugins = append(grpcPlugins, p)
+	grpcPluginsMu.Unlock()
+
+	return nil
+}
+
+// start connects to the plugin at the address in the plugin's
+// handshake line ("CORE-VERSION|APP-VERSION|NETWORK|ADDR|PROTOCOL")
+// and registers its channel types.
+func (p *grpcPlugin) start(ctx *Ctx, line string) error {
+	if line == "" {
+		return fmt.Errorf("no handshake from plugin %s", p.name)
+	}
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) < 5 {
+		return fmt.Errorf("bad handshake '%s' from plugin %s", line, p.name)
+	}
+	if parts[0] != "1" {
+		return fmt.Errorf("plugin %s has unsupported core protocol version %s", p.name, parts[0])
+	}
+	if parts[1] != fmt.Sprintf("%d", PluginProtocolVersion) {
+		return fmt.Errorf("plugin %s has protocol version %s (not %d)", p.name, parts[1], PluginProtocolVersion)
+	}
+	if parts[4] != "grpc" {
+		return fmt.Errorf("plugin %s uses protocol %s (not grpc)", p.name, parts[4])
+	}
+	if 5 < len(parts) && parts[5] != "" {
+		return fmt.Errorf("plugin %s wants TLS, which isn't supported", p.name)
+	}
+
+	p.client = newGRPCClient(parts[2], parts[3])
+	go p.stdio(ctx)
+
+	bs, err := p.client.call(ctx, "/plax.plugin.Chan/Kinds", nil)
+	if err != nil {
+		return fmt.Errorf("plugin %s Kinds: %w", p.name, err)
+	}
+	var resp pluginResponse
+	if err = resp.unmarshal(bs); err != nil {
+		return err
+	}
+
+	for _, k := range resp.Kinds {
+		kind := ChanKind(k.Name)
+		d := &DocSpec{
+			Kind: kind,
+		}
+		if k.Doc != "" {
+			if err := json.Unmarshal([]byte(k.Doc), d); err != nil {
+				return fmt.Errorf("plugin %s doc for %s: %w", p.name, kind, err)
+			}
+		}
+		TheChanRegistry.Register(ctx, kind, p.maker(kind))
+		TheChanDocs[kind] = d
+	}
+
+	return nil
+}
+
+// log logs the lines from the plugin's stderr.
+func (p *grpcPlugin) log(ctx *Ctx, r io.Reader) {
+	in := bufio.NewScanner(r)
+	for in.Scan() {
+		ctx.Logf("plugin %s: %s", p.name, in.Text())
+	}
+}
+
+// stdio logs what a go-plugin plugin writes to its stdout and stderr,
+// which go-plugin sends via its GRPCStdio service.
+func (p *grpcPlugin) stdio(ctx *Ctx) {
+	s, err := p.client.stream(context.Background(), "/plugin.GRPCStdio/StreamStdio", nil)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	for {
+		bs, err := s.Recv()
+		if err != nil {
+			return
+		}
+		var data []byte
+		pbFields(bs, func(num protowire.Number, v []byte, n uint64) error {
+			if num == 2 {
+				data = v
+			}
+			return nil
+		})
+		ctx.Logf("plugin %s: %s", p.name, strings.TrimRight(string(data), "\n"))
+	}
+}
+
+// call calls a Chan method.  An InvalidArgument status becomes a
+// Broken error.
+func (p *grpcPlugin) call(ctx *Ctx, method string, req *pluginRequest) (*pluginResponse, error) {
+	bs, err := p.client.call(ctx, "/plax.plugin.Chan/"+method, req.marshal())
+	if err != nil {
+		if e, is := err.(*grpcError); is {
+			if e.Code == grpcInvalidArgument {
+				return nil, Brokenf("%s", e.Message)
+			}
+			return nil, fmt.Errorf("%s", e.Message)
+		}
+		return nil, fmt.Errorf("plugin %s %s: %w", p.name, method, err)
+	}
+	var resp pluginResponse
+	if err = resp.unmarshal(bs); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// shutdown asks the plugin to exit (via go-plugin's GRPCController
+// service) and closes its stdin.  If the plugin doesn't exit
+// promptly, it's killed.
+func (p *grpcPlugin) shutdown(ctx *Ctx) {
+	cctx, cancel := context.WithTimeout(ctx, time.Second)
+	p.client.call(cctx, "/plugin.GRPCController/Shutdown", nil)
+	cancel()
+	p.stdin.Close()
+
+	done := make(chan bool)
+	go func() {
+		p.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		ctx.Logf("Killing plugin %s", p.name)
+		p.cmd.Process.Kill()
+		<-done
+	}
+}
+
+// ClosePlugins stops the plugin programs that LoadGRPCPlugin
+// started.
+func ClosePlugins(ctx *Ctx) {
+	grpcPluginsMu.Lock()
+	ps := grpcPlugins
+	grpcPlugins = nil
+	grpcPluginsMu.Unlock()
+
+	for _, p := range ps {
+		p.shutdown(ctx)
+	}
+}
+
+// GRPCPluginOpts are the options that a GRPCPluginChan uses itself.
+// All of a channel's options go to the plugin.
+type GRPCPluginOpts struct {
+	// BufferSize is the capacity of the channel's Buffer.
+	BufferSize int `json:"buffersize,omitempty" yaml:"buffersize,omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the Buffer's overflow policy.
+	Overflow string `json:"overflow,omitempty" yaml:"overflow,omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// GRPCPluginChan is a channel implemented by a gRPC plugin.
+type GRPCPluginChan struct {
+	p    *grpcPlugin
+	kind ChanKind
+	id   uint64
+	buf  *Buffer
+
+	// cancel stops the stream of messages from the plugin.
+	cancel context.CancelFunc
+}
+
+func (p *grpcPlugin) maker(kind ChanKind) ChanMaker {
+	return func(ctx *Ctx, def interface{}) (Chan, error) {
+		var opts GRPCPluginOpts
+		if err := As(def, &opts); err != nil {
+			return nil, err
+		}
+		buf, err := NewBuffer(kind, opts.BufferSize, opts.Overflow)
+		if err != nil {
+			return nil, err
+		}
+		js, err := json.Marshal(def)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := p.call(ctx, "New", &pluginRequest{
+			Kind: string(kind),
+			Opts: string(js),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &GRPCPluginChan{
+			p:    p,
+			kind: kind,
+			id:   resp.ID,
+			buf:  buf,
+		}, nil
+	}
+}
+
+func (c *GRPCPluginChan) Kind() ChanKind {
+	return c.kind
+}
+
+// Open opens the plugin's channel and starts receiving its
+// messages.
+func (c *GRPCPluginChan) Open(ctx *Ctx) error {
+	if _, err := c.p.call(ctx, "Open", &pluginRequest{ID: c.id}); err != nil {
+		return err
+	}
+
+	// A server might not send the response's headers until the
+	// first message, so the stream starts in the background.
+	sctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	go func() {
+		s, err := c.p.client.stream(sctx, "/plax.plugin.Chan/Recv", (&pluginRequest{ID: c.id}).marshal())
+		if err != nil {
+			if sctx.Err() == nil {
+				ctx.Logf("%s Recv: %s", c.kind, err)
+			}
+			return
+		}
+		defer s.Close()
+		for {
+			bs, err := s.Recv()
+			if err != nil {
+				if err != io.EOF && sctx.Err() == nil {
+					ctx.Logf("%s Recv: %s", c.kind, err)
+				}
+				return
+			}
+			var resp pluginResponse
+			if err := resp.unmarshal(bs); err != nil || resp.Msg == nil {
+				ctx.Logf("%s Recv: bad message", c.kind)
+				continue
+			}
+			m := Msg{
+				Topic:      resp.Msg.Topic,
+				ReceivedAt: time.Unix(0, resp.Msg.ReceivedAt).UTC(),
+			}
+			if resp.Msg.ReceivedAt == 0 {
+				m.ReceivedAt = time.Now().UTC()
+			}
+			if err := json.Unmarshal([]byte(resp.Msg.Payload), &m.Payload); err != nil {
+				ctx.Logf("%s Recv: bad payload: %s", c.kind, err)
+				continue
+			}
+			c.buf.Put(ctx, m)
+		}
+	}()
+
+	return nil
+}
+
+func (c *GRPCPluginChan) Close(ctx *Ctx) error {
+	_, err := c.p.call(ctx, "Close", &pluginRequest{ID: c.id})
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return err
+}
+
+func (c *GRPCPluginChan) Kill(ctx *Ctx) error {
+	_, err := c.p.call(ctx, "Kill", &pluginRequest{ID: c.id})
+	return err
+}
+
+func (c *GRPCPluginChan) Sub(ctx *Ctx, topic string) error {
+	_, err := c.p.call(ctx, "Sub", &pluginRequest{
+		ID:    c.id,
+		Topic: topic,
+	})
+	return err
+}
+
+func (c *GRPCPluginChan) Pub(ctx *Ctx, m Msg) error {
+	js, err := json.Marshal(m.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = c.p.call(ctx, "Pub", &pluginRequest{
+		ID: c.id,
+		Msg: &pluginMsg{
+			Topic:   m.Topic,
+			Payload: string(js),
+		},
+	})
+	return err
+}
+
+func (c *GRPCPluginChan) Recv(ctx *Ctx) chan Msg {
+	return c.buf.C
+}
+
+// To delivers the given message as if it came from the plugin.
+func (c *GRPCPluginChan) To(ctx *Ctx, m Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of the channel's Buffer.  See
+// Overflower.
+func (c *GRPCPluginChan) Overflow() error {
+	return c.buf.Overflow()
+}
+
+// pluginChan is a channel that a plugin program is serving.
+type pluginChan struct {
+	c      Chan
+	ctx    *Ctx
+	cancel context.CancelFunc
+}
+
+// ServeChanPlugin serves the given channel types (from
+// TheChanRegistry and TheChanDocs) as a gRPC plugin.  A plugin
+// program's main function should call ServeChanPlugin after
+// registering its channel types.
+//
+// ServeChanPlugin returns after plax asks the plugin to shut down or
+// closes the plugin's stdin.
+func ServeChanPlugin(kinds ...ChanKind) error {
+	if os.Getenv(PluginCookieKey) != PluginCookieValue {
+		return fmt.Errorf("this program is a plax channel plugin; see 'Channel plugins' in the plax manual")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	var (
+		mu    sync.Mutex
+		chans = make(map[uint64]*pluginChan)
+		next  uint64
+		done  = make(chan bool)
+		once  sync.Once
+	)
+
+	stop := func() {
+		once.Do(func() { close(done) })
+	}
+
+	get := func(msg []byte) (*pluginRequest, *pluginChan, error) {
+		var req pluginRequest
+		if err := req.unmarshal(msg); err != nil {
+			return nil, nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		c, have := chans[req.ID]
+		if !have {
+			return nil, nil, &grpcError{
+				Code:    grpcNotFound,
+				Message: fmt.Sprintf("no channel %d", req.ID),
+			}
+		}
+		return &req, c, nil
+	}
+
+	// status converts a Broken error to InvalidArgument.
+	status := func(err error) error {
+		if _, is := IsBroken(err); is {
+			return &grpcError{
+				Code:    grpcInvalidArgument,
+				Message: err.Error(),
+			}
+		}
+		return err
+	}
+
+	// method makes a unary method that calls f with the request's
+	// channel.
+	method := func(f func(req *pluginRequest, c *pluginChan) error) grpcMethod {
+		return func(ctx context.Context, msg []byte, send func([]byte) error) error {
+			req, c, err := get(msg)
+			if err != nil {
+				return err
+			}
+			if err := f(req, c); err != nil {
+				return status(err)
+			}
+			return send(nil)
+		}
+	}
+
+	s := grpcServer{
+		"/plax.plugin.Chan/Kinds": func(ctx context.Context, msg []byte, send func([]byte) error) error {
+			var resp pluginResponse
+			for _, kind := range kinds {
+				d, have := TheChanDocs[kind]
+				if !have {
+					d = &DocSpec{Kind: kind}
+				}
+				js, err := json.Marshal(d)
+				if err != nil {
+					return err
+				}
+				resp.Kinds = append(resp.Kinds, &pluginKind{
+					Name: string(kind),
+					Doc:  string(js),
+				})
+			}
+			return send(resp.marshal())
+		},
+		"/plax.plugin.Chan/New": func(ctx context.Context, msg []byte, send func([]byte) error) error {
+			var req pluginRequest
+			if err := req.unmarshal(msg); err != nil {
+				return err
+			}
+			var maker ChanMaker
+			for _, kind := range kinds {
+				if string(kind) == req.Kind {
+					maker = TheChanRegistry[kind]
+				}
+			}
+			if maker == nil {
+				return status(Brokenf("plugin doesn't provide channel type '%s'", req.Kind))
+			}
+			var opts interface{}
+			if req.Opts != "" {
+				if err := json.Unmarshal([]byte(req.Opts), &opts); err != nil {
+					return status(NewBroken(err))
+				}
+			}
+			cctx, cancel := context.WithCancel(context.Background())
+			pc := &pluginChan{
+				ctx:    NewCtx(cctx),
+				cancel: cancel,
+			}
+			c, err := maker(pc.ctx, opts)
+			if err != nil {
+				cancel()
+				return status(err)
+			}
+			pc.c = c
+			mu.Lock()
+			next++
+			id := next
+			chans[id] = pc
+			mu.Unlock()
+			return send((&pluginResponse{ID: id}).marshal())
+		},
+		"/plax.plugin.Chan/Open": method(func(req *pluginRequest, c *pluginChan) error {
+			return c.c.Open(c.ctx)
+		}),
+		"/plax.plugin.Chan/Close": method(func(req *pluginRequest, c *pluginChan) error {
+			mu.Lock()
+			delete(chans, req.ID)
+			mu.Unlock()
+			defer c.cancel()
+			return c.c.Close(c.ctx)
+		}),
+		"/plax.plugin.Chan/Kill": method(func(req *pluginRequest, c *pluginChan) error {
+			return c.c.Kill(c.ctx)
+		}),
+		"/plax.plugin.Chan/Sub": method(func(req *pluginRequest, c *pluginChan) error {
+			return c.c.Sub(c.ctx, req.Topic)
+		}),
+		"/plax.plugin.Chan/Pub": method(func(req *pluginRequest, c *pluginChan) error {
+			if req.Msg == nil {
+				return Brokenf("Pub without a message")
+			}
+			m := Msg{
+				Topic: req.Msg.Topic,
+			}
+			if err := json.Unmarshal([]byte(req.Msg.Payload), &m.Payload); err != nil {
+				return NewBroken(err)
+			}
+			return c.c.Pub(c.ctx, m)
+		}),
+		"/plax.plugin.Chan/Recv": func(ctx context.Context, msg []byte, send func([]byte) error) error {
+			req, c, err := get(msg)
+			if err != nil {
+				return err
+			}
+			in := c.c.Recv(c.ctx)
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-c.ctx.Done():
+					return nil
+				case m := <-in:
+					js, err := json.Marshal(m.Payload)
+					if err != nil {
+						return err
+					}
+					resp := &pluginResponse{
+						ID: req.ID,
+						Msg: &pluginMsg{
+							Topic:      m.Topic,
+							Payload:    string(js),
+							ReceivedAt: m.ReceivedAt.UnixNano(),
+						},
+					}
+					if err := send(resp.marshal()); err != nil {
+						return err
+					}
+				}
+			}
+		},
+		// Like go-plugin's GRPCController.
+		"/plugin.GRPCController/Shutdown": func(ctx context.Context, msg []byte, send func([]byte) error) error {
+			defer stop()
+			return send(nil)
+		},
+	}
+
+	go serveGRPC(l, s)
+
+	// Plax closes the plugin's stdin when plax exits.
+	go func() {
+		io.Copy(ioutil.Discard, os.Stdin)
+		stop()
+	}()
+
+	fmt.Printf("1|%d|tcp|%s|grpc\n", PluginProtocolVersion, l.Addr())
+
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, c := range chans {
+		c.c.Close(c.ctx)
+		c.cancel()
+	}
+
+	return nil
+}
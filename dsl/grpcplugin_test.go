@@ -0,0 +1,623 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// TestGRPCPluginProcess is the plugin program for TestGRPCPlugin.
+func TestGRPCPluginProcess(t *testing.T) {
+	if os.Getenv("PLAX_TEST_GRPC_PLUGIN") == "" {
+		t.Skip("only runs as a plugin")
+	}
+	TheChanRegistry.Register(NewCtx(nil), "grpc-mock", NewMockChan)
+	TheChanDocs.Register("grpc-mock", "A mock channel from a plugin.", MockOpts{})
+	if err := ServeChanPlugin("grpc-mock"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The plugin program is this test binary.
+	script := fmt.Sprintf("#!/bin/sh\nPLAX_TEST_GRPC_PLUGIN=1 exec %s -test.run='^TestGRPCPluginProcess$'\n", os.Args[0])
+	if err = ioutil.WriteFile(filepath.Join(dir, "plugin"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewCtx(nil)
+	defer func() {
+		ClosePlugins(ctx)
+		delete(TheChanRegistry, "grpc-mock")
+		delete(TheChanDocs, "grpc-mock")
+	}()
+
+	kinds, err := LoadPlugins(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kinds, []ChanKind{"grpc-mock"}) {
+		t.Fatal(kinds)
+	}
+	if d := TheChanDocs["grpc-mock"]; d == nil || d.Doc != "A mock channel from a plugin." || len(d.Opts) == 0 {
+		t.Fatal(d)
+	}
+
+	if _, err = TheChanRegistry["grpc-mock"](ctx, map[string]interface{}{
+		"overflow": "nope",
+	}); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	c, err := TheChanRegistry["grpc-mock"](ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Sub(ctx, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, Msg{
+		Topic:   "t",
+		Payload: map[string]interface{}{"want": "tacos"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-c.Recv(ctx):
+		if m.Topic != "t" || JSON(m.Payload) != `{"want":"tacos"}` || m.ReceivedAt.IsZero() {
+			t.Fatal(m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+
+	err = c.Kill(ctx)
+	if _, is := IsBroken(err); !is {
+		t.Fatal(err)
+	}
+
+	if err = c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, Msg{Payload: "late"}); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	ClosePlugins(ctx)
+	if len(grpcPlugins) != 0 {
+		t.Fatal(grpcPlugins)
+	}
+}
+
+func TestPluginProto(t *testing.T) {
+	req := &pluginRequest{
+		ID:    42,
+		Kind:  "k",
+		Opts:  `{"a":1}`,
+		Topic: "t",
+		Msg: &pluginMsg{
+			Topic:      "u",
+			Payload:    `"p"`,
+			ReceivedAt: 1234567890,
+		},
+	}
+	var req2 pluginRequest
+	if err := req2.unmarshal(req.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(req, &req2) {
+		t.Fatal(req2)
+	}
+
+	resp := &pluginResponse{
+		ID:    7,
+		Kinds: []*pluginKind{{Name: "a", Doc: "{}"}, {Name: "b"}},
+	}
+	var resp2 pluginResponse
+	if err := resp2.unmarshal(resp.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp, &resp2) {
+		t.Fatal(resp2)
+	}
+
+	if err := req2.unmarshal([]byte{0x0a, 0x05}); err == nil {
+		t.Fatal("should have complained")
+	}
+}
+
+var (
+	protoMessage = regexp.MustCompile(`(?s)\nmessage (\w+) \{(.*?)\n\}`)
+	protoField   = regexp.MustCompile(`(?m)^\s*(repeated )?(\w+) (\w+) = (\d+);`)
+	protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+		"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+		"bytes":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+		"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		"uint64": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	}
+)
+
+// chanProto returns the message descriptors from
+// plugins/proto/chan.proto, which has only the simple fields that
+// this small parser understands.
+func chanProto(t *testing.T) map[string]protoreflect.MessageDescriptor {
+	src, err := ioutil.ReadFile("../plugins/proto/chan.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("chan.proto"),
+		Package: proto.String("plax.plugin"),
+		Syntax:  proto.String("proto3"),
+	}
+	for _, m := range protoMessage.FindAllStringSubmatch(string(src), -1) {
+		d := &descriptorpb.DescriptorProto{
+			Name: proto.String(m[1]),
+		}
+		for _, f := range protoField.FindAllStringSubmatch(m[2], -1) {
+			num, _ := strconv.Atoi(f[4])
+			fdp := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(f[3]),
+				Number: proto.Int32(int32(num)),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if f[1] != "" {
+				fdp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			if typ, have := protoScalars[f[2]]; have {
+				fdp.Type = typ.Enum()
+			} else {
+				fdp.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				fdp.TypeName = proto.String(".plax.plugin." + f[2])
+			}
+			d.Field = append(d.Field, fdp)
+		}
+		fd.MessageType = append(fd.MessageType, d)
+	}
+	f, err := protodesc.NewFile(fd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := make(map[string]protoreflect.MessageDescriptor)
+	for i := 0; i < f.Messages().Len(); i++ {
+		d := f.Messages().Get(i)
+		acc[string(d.Name())] = d
+	}
+	for _, name := range []string{"Request", "Response", "Kind", "Msg"} {
+		if acc[name] == nil {
+			t.Fatalf("no %s in chan.proto", name)
+		}
+	}
+	return acc
+}
+
+// TestPluginProtoInterop checks the plugin messages against a
+// standard protobuf implementation of plugins/proto/chan.proto.
+func TestPluginProtoInterop(t *testing.T) {
+	types := chanProto(t)
+
+	req := &pluginRequest{
+		ID:    42,
+		Kind:  "k",
+		Opts:  `{"a":1}`,
+		Topic: "t",
+		Msg: &pluginMsg{
+			Topic:      "u",
+			Payload:    `"p"`,
+			ReceivedAt: -1,
+		},
+	}
+	m := dynamicpb.NewMessage(types["Request"])
+	if err := proto.Unmarshal(req.marshal(), m); err != nil {
+		t.Fatal(err)
+	}
+	fs := m.Descriptor().Fields()
+	if m.Get(fs.ByName("id")).Uint() != 42 || m.Get(fs.ByName("kind")).String() != "k" ||
+		m.Get(fs.ByName("opts")).String() != `{"a":1}` || m.Get(fs.ByName("topic")).String() != "t" {
+		t.Fatal(m)
+	}
+	msg := m.Get(fs.ByName("msg")).Message()
+	mfs := msg.Descriptor().Fields()
+	if msg.Get(mfs.ByName("topic")).String() != "u" || msg.Get(mfs.ByName("payload")).String() != `"p"` ||
+		msg.Get(mfs.ByName("received_at")).Int() != -1 {
+		t.Fatal(msg)
+	}
+
+	resp := dynamicpb.NewMessage(types["Response"])
+	fs = resp.Descriptor().Fields()
+	resp.Set(fs.ByName("id"), protoreflect.ValueOfUint64(7))
+	kinds := resp.Mutable(fs.ByName("kinds")).List()
+	for _, name := range []string{"a", "b"} {
+		k := kinds.NewElement()
+		kfs := k.Message().Descriptor().Fields()
+		k.Message().Set(kfs.ByName("name"), protoreflect.ValueOfString(name))
+		k.Message().Set(kfs.ByName("doc"), protoreflect.ValueOfString("{}"))
+		kinds.Append(k)
+	}
+	msg = resp.Mutable(fs.ByName("msg")).Message()
+	msg.Set(mfs.ByName("payload"), protoreflect.ValueOfString(`{"want":"tacos"}`))
+	msg.Set(mfs.ByName("received_at"), protoreflect.ValueOfInt64(1600000000000000000))
+	bs, err := proto.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A field from a future version of the protocol.
+	bs = protowire.AppendTag(bs, 99, protowire.BytesType)
+	bs = protowire.AppendString(bs, "later")
+
+	var got pluginResponse
+	if err := got.unmarshal(bs); err != nil {
+		t.Fatal(err)
+	}
+	want := &pluginResponse{
+		ID:    7,
+		Kinds: []*pluginKind{{Name: "a", Doc: "{}"}, {Name: "b", Doc: "{}"}},
+		Msg: &pluginMsg{
+			Payload:    `{"want":"tacos"}`,
+			ReceivedAt: 1600000000000000000,
+		},
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Fatal(JSON(got))
+	}
+}
+
+// goPluginServer is an independent implementation of a plugin built
+// with HashiCorp go-plugin and grpc-go.  It checks requests the way
+// grpc-go does, sends response headers only with the first message,
+// sends errors as trailers-only responses, serves go-plugin's
+// GRPCStdio and GRPCController services, and uses standard protobuf
+// messages for plugins/proto/chan.proto.
+type goPluginServer struct {
+	types    map[string]protoreflect.MessageDescriptor
+	pubs     chan protoreflect.Message
+	shutdown chan bool
+	once     sync.Once
+}
+
+// status writes a grpc-go status.  Without any messages, the status
+// is in the headers (a trailers-only response).
+func (s *goPluginServer) status(w http.ResponseWriter, sent bool, code int, msg string) {
+	prefix := ""
+	if sent {
+		prefix = http.TrailerPrefix
+	} else {
+		w.Header().Set("Content-Type", "application/grpc")
+	}
+	// grpc-go percent-encodes only '%' and unprintable bytes.
+	w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(prefix+"Grpc-Message", strings.Replace(msg, "%", "%25", -1))
+	}
+	if !sent {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *goPluginServer) send(w http.ResponseWriter, m protoreflect.Message) error {
+	bs, err := proto.Marshal(m.Interface())
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 5, 5+len(bs))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(bs)))
+	w.Header().Set("Content-Type", "application/grpc")
+	if _, err = w.Write(append(frame, bs...)); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+func (s *goPluginServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.ProtoMajor != 2 ||
+		!strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.Header.Get("Te") != "trailers" {
+		s.status(w, false, 13, "missing te: trailers")
+		return
+	}
+
+	var hdr [5]byte
+	if _, err := io.ReadFull(r.Body, hdr[:]); err != nil || hdr[0] != 0 {
+		s.status(w, false, 13, "bad request frame")
+		return
+	}
+	bs := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+	if _, err := io.ReadFull(r.Body, bs); err != nil {
+		s.status(w, false, 13, "truncated request")
+		return
+	}
+
+	var (
+		req    = dynamicpb.NewMessage(s.types["Request"])
+		resp   = dynamicpb.NewMessage(s.types["Response"])
+		fs     = req.Descriptor().Fields()
+		rfs    = resp.Descriptor().Fields()
+		method = strings.TrimPrefix(r.URL.Path, "/plax.plugin.Chan/")
+	)
+	if strings.HasPrefix(r.URL.Path, "/plax.plugin.Chan/") {
+		if err := proto.Unmarshal(bs, req); err != nil {
+			s.status(w, false, 13, err.Error())
+			return
+		}
+	}
+
+	switch r.URL.Path {
+	case "/plugin.GRPCStdio/StreamStdio":
+		// StdioData{channel: STDOUT, data: ...}
+		var out []byte
+		out = protowire.AppendTag(out, 1, protowire.VarintType)
+		out = protowire.AppendVarint(out, 1)
+		out = protowire.AppendTag(out, 2, protowire.BytesType)
+		out = protowire.AppendString(out, "hello from stdio\n")
+		frame := make([]byte, 5, 5+len(out))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(out)))
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write(append(frame, out...))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		return
+	case "/plugin.GRPCController/Shutdown":
+		s.send(w, dynamicpb.NewMessage(s.types["Msg"]))
+		s.status(w, true, 0, "")
+		s.once.Do(func() { close(s.shutdown) })
+		return
+	}
+
+	switch method {
+	case "Kinds":
+		k := dynamicpb.NewMessage(s.types["Kind"])
+		kfs := k.Descriptor().Fields()
+		k.Set(kfs.ByName("name"), protoreflect.ValueOfString("interop"))
+		k.Set(kfs.ByName("doc"), protoreflect.ValueOfString(`{"doc":"An interop channel."}`))
+		resp.Mutable(rfs.ByName("kinds")).List().Append(protoreflect.ValueOfMessage(k))
+	case "New":
+		var opts map[string]interface{}
+		if req.Get(fs.ByName("kind")).String() != "interop" ||
+			json.Unmarshal([]byte(req.Get(fs.ByName("opts")).String()), &opts) != nil {
+			s.status(w, false, 3, "bad New")
+			return
+		}
+		resp.Set(rfs.ByName("id"), protoreflect.ValueOfUint64(7))
+	case "Open", "Sub", "Close":
+		if req.Get(fs.ByName("id")).Uint() != 7 {
+			s.status(w, false, 5, "no such channel")
+			return
+		}
+	case "Pub":
+		s.pubs <- req.Get(fs.ByName("msg")).Message()
+	case "Kill":
+		s.status(w, false, 3, "100% unsupported: kill")
+		return
+	case "Recv":
+		// Like grpc-go, no headers until the first message.
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case m := <-s.pubs:
+				mfs := m.Descriptor().Fields()
+				m.Set(mfs.ByName("received_at"), protoreflect.ValueOfInt64(1600000000000000000))
+				resp.Set(rfs.ByName("msg"), protoreflect.ValueOfMessage(m))
+				if err := s.send(w, resp); err != nil {
+					return
+				}
+			}
+		}
+	default:
+		s.status(w, false, 12, "unknown method "+r.URL.Path)
+		return
+	}
+
+	if err := s.send(w, resp); err != nil {
+		return
+	}
+	s.status(w, true, 0, "")
+}
+
+// TestGRPCPluginInteropProcess is the plugin program for
+// TestGRPCPluginInterop.
+func TestGRPCPluginInteropProcess(t *testing.T) {
+	if os.Getenv("PLAX_TEST_GRPC_INTEROP") == "" {
+		t.Skip("only runs as a plugin")
+	}
+	if os.Getenv(PluginCookieKey) != PluginCookieValue || os.Getenv("PLUGIN_PROTOCOL_VERSIONS") != "1" {
+		t.Fatal("bad environment")
+	}
+
+	dir, err := ioutil.TempDir("", "plax-interop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "plugin.sock")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := &goPluginServer{
+		types:    chanProto(t),
+		pubs:     make(chan protoreflect.Message, 8),
+		shutdown: make(chan bool),
+	}
+	go func() {
+		h2 := &http2.Server{}
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go h2.ServeConn(conn, &http2.ServeConnOpts{Handler: s})
+		}
+	}()
+
+	// go-plugin's handshake.
+	fmt.Printf("1|1|unix|%s|grpc\n", addr)
+
+	// Unlike ServeChanPlugin, go-plugin doesn't watch stdin.
+	select {
+	case <-s.shutdown:
+	case <-time.After(time.Minute):
+		t.Fatal("no shutdown")
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+// syncLogger collects log lines from several goroutines.
+type syncLogger struct {
+	sync.Mutex
+	acc []string
+}
+
+func (l *syncLogger) Printf(format string, args ...interface{}) {
+	l.Lock()
+	l.acc = append(l.acc, fmt.Sprintf(format, args...))
+	l.Unlock()
+}
+
+func (l *syncLogger) has(s string) bool {
+	l.Lock()
+	defer l.Unlock()
+	for _, line := range l.acc {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestGRPCPluginInterop uses a plugin that works like one built with
+// go-plugin and grpc-go.
+func TestGRPCPluginInterop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := fmt.Sprintf("#!/bin/sh\nPLAX_TEST_GRPC_INTEROP=1 exec %s -test.run='^TestGRPCPluginInteropProcess$'\n", os.Args[0])
+	if err = ioutil.WriteFile(filepath.Join(dir, "plugin"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		l   = &syncLogger{}
+		ctx = NewCtx(nil)
+	)
+	ctx.Logger = l
+	defer func() {
+		ClosePlugins(ctx)
+		delete(TheChanRegistry, "interop")
+		delete(TheChanDocs, "interop")
+	}()
+
+	kinds, err := LoadPlugins(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kinds, []ChanKind{"interop"}) {
+		t.Fatal(kinds)
+	}
+	if d := TheChanDocs["interop"]; d == nil || d.Doc != "An interop channel." {
+		t.Fatal(d)
+	}
+
+	c, err := TheChanRegistry["interop"](ctx, map[string]interface{}{"want": "tacos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Sub(ctx, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Pub(ctx, Msg{
+		Topic:   "t",
+		Payload: map[string]interface{}{"want": "tacos"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-c.Recv(ctx):
+		if m.Topic != "t" || JSON(m.Payload) != `{"want":"tacos"}` || m.ReceivedAt.UnixNano() != 1600000000000000000 {
+			t.Fatal(m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+
+	// A trailers-only error with an encoded message.
+	err = c.Kill(ctx)
+	if _, is := IsBroken(err); !is || !strings.Contains(err.Error(), "100% unsupported: kill") {
+		t.Fatal(err)
+	}
+
+	if err = c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ClosePlugins(ctx)
+	if !l.has("plugin plugin: hello from stdio") {
+		t.Fatal(l.acc)
+	}
+	if l.has("Killing plugin") {
+		t.Fatal("plugin didn't shut down")
+	}
+}
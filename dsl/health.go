@@ -0,0 +1,240 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"time"
+)
+
+// HealthChecker is implemented by a Chan that can report whether its
+// connection is healthy.
+//
+// A Health step checks a channel's health, and a Recv on a channel
+// with a ReconnectPolicy checks its channel's health periodically.
+type HealthChecker interface {
+	// Healthy returns an error that says what's wrong with an
+	// unhealthy channel.
+	Healthy(ctx *Ctx) error
+}
+
+var (
+	// DefaultReconnectAttempts is the default
+	// ReconnectPolicy.MaxAttempts.
+	DefaultReconnectAttempts = 3
+
+	// DefaultReconnectBackoff is the default
+	// ReconnectPolicy.Backoff.
+	DefaultReconnectBackoff = time.Second
+
+	// DefaultReconnectMaxBackoff is the default
+	// ReconnectPolicy.MaxBackoff.
+	DefaultReconnectMaxBackoff = 30 * time.Second
+
+	// DefaultHealthInterval is the default
+	// ReconnectPolicy.Interval.
+	DefaultHealthInterval = time.Second
+)
+
+// ReconnectPolicy says how to reconnect a channel that has become
+// unhealthy.  See HealthChecker.
+//
+// Attempts are separated by a backoff that starts at Backoff and
+// doubles after each failed attempt up to MaxBackoff.
+type ReconnectPolicy struct {
+	// MaxAttempts is the maximum number of attempts to reconnect
+	// before giving up.
+	MaxAttempts int `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+
+	// Backoff is the initial wait (in Go syntax) between
+	// attempts.
+	Backoff string `json:"backoff,omitempty"`
+
+	// MaxBackoff is the maximum wait (in Go syntax) between
+	// attempts.
+	MaxBackoff string `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty"`
+
+	// Interval is how often (in Go syntax) a Recv on the channel
+	// checks the channel's health.
+	Interval string `json:"interval,omitempty"`
+
+	backoff, maxBackoff, interval time.Duration
+}
+
+func (p *ReconnectPolicy) parse() error {
+	if p.MaxAttempts < 0 {
+		return Brokenf("bad reconnect MaxAttempts %d", p.MaxAttempts)
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultReconnectAttempts
+	}
+	parse := func(name, s string, def time.Duration, dst *time.Duration) error {
+		if s == "" {
+			*dst = def
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return Brokenf("bad reconnect %s '%s': %s", name, s, err)
+		}
+		*dst = d
+		return nil
+	}
+	if err := parse("Backoff", p.Backoff, DefaultReconnectBackoff, &p.backoff); err != nil {
+		return err
+	}
+	if err := parse("MaxBackoff", p.MaxBackoff, DefaultReconnectMaxBackoff, &p.maxBackoff); err != nil {
+		return err
+	}
+	if err := parse("Interval", p.Interval, DefaultHealthInterval, &p.interval); err != nil {
+		return err
+	}
+	if p.interval <= 0 {
+		return Brokenf("bad reconnect Interval '%s'", p.Interval)
+	}
+	return nil
+}
+
+// Health is a Step that checks a channel's health.  If the channel
+// is unhealthy and has a ReconnectPolicy, the step tries to
+// reconnect the channel.  Otherwise an unhealthy channel fails the
+// step.
+type Health struct {
+	Chan string
+
+	ch Chan
+}
+
+func (h *Health) Substitute(ctx *Ctx, t *Test) (*Health, error) {
+	name, err := t.Bindings.StringSub(ctx, h.Chan)
+	if err != nil {
+		return nil, err
+	}
+	return &Health{
+		Chan: name,
+	}, nil
+}
+
+func (h *Health) Exec(ctx *Ctx, t *Test) error {
+	ctx.Indf("    Health %s", h.Chan)
+
+	if _, is := h.ch.(HealthChecker); !is {
+		return Brokenf("%s channels don't report their health", h.ch.Kind())
+	}
+	return t.ensureHealthy(ctx, h.ch)
+}
+
+// ensureHealthy checks the channel's health and, if the channel is
+// unhealthy, reconnects it according to its ReconnectPolicy.
+//
+// A channel that isn't a HealthChecker is considered healthy.
+func (t *Test) ensureHealthy(ctx *Ctx, c Chan) error {
+	hc, is := c.(HealthChecker)
+	if !is {
+		return nil
+	}
+	cause := hc.Healthy(ctx)
+	if cause == nil {
+		return nil
+	}
+
+	name := t.chanName(c)
+	ctx.Indf("    Channel %s unhealthy: %s", name, cause)
+
+	p, have := t.reconnects[name]
+	if !have {
+		return Categorize(CategoryChannel, fmt.Errorf("channel %s unhealthy: %w", name, cause))
+	}
+	return t.reconnect(ctx, name, c, p, cause)
+}
+
+// reconnect tries to reopen (and resubscribe) the given unhealthy
+// channel according to the ReconnectPolicy.
+func (t *Test) reconnect(ctx *Ctx, name string, c Chan, p *ReconnectPolicy, cause error) error {
+	var (
+		hc      = c.(HealthChecker)
+		backoff = p.backoff
+		err     = cause
+	)
+	for i := 1; i <= p.MaxAttempts; i++ {
+		if 1 < i {
+			select {
+			case <-ctx.Done():
+				return Categorize(CategoryChannel, fmt.Errorf("channel %s reconnect interrupted", name))
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; p.maxBackoff < backoff {
+				backoff = p.maxBackoff
+			}
+		}
+		ctx.Indf("    Channel %s reconnecting (attempt %d of %d)", name, i, p.MaxAttempts)
+		if err = t.reopen(ctx, name, c); err == nil {
+			if err = hc.Healthy(ctx); err == nil {
+				ctx.Indf("    Channel %s reconnected", name)
+				return nil
+			}
+		}
+		ctx.Indf("    Channel %s reconnect attempt %d failed: %s", name, i, err)
+	}
+	return Categorize(CategoryChannel, fmt.Errorf("channel %s unhealthy (%s) after %d reconnect attempts: %w",
+		name, cause, p.MaxAttempts, err))
+}
+
+// reopen opens the channel and renews its subscriptions.
+func (t *Test) reopen(ctx *Ctx, name string, c Chan) error {
+	if err := c.Open(ctx); err != nil {
+		return err
+	}
+	for _, topic := range t.subs[name] {
+		if err := c.Sub(ctx, topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribed remembers the channel's subscription so that a
+// reconnection can renew it.
+func (t *Test) subscribed(name, topic string) {
+	for _, have := range t.subs[name] {
+		if have == topic {
+			return
+		}
+	}
+	if t.subs == nil {
+		t.subs = make(map[string][]string)
+	}
+	t.subs[name] = append(t.subs[name], topic)
+}
+
+// healthChecks returns a channel that ticks when a Recv on the given
+// channel should check that channel's health.  The channel is nil
+// when the channel has no ReconnectPolicy.
+//
+// Call the returned function to release resources.
+func (t *Test) healthChecks(c Chan) (<-chan time.Time, func()) {
+	if _, is := c.(HealthChecker); !is {
+		return nil, func() {}
+	}
+	p, have := t.reconnects[t.chanName(c)]
+	if !have {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(p.interval)
+	return ticker.C, ticker.Stop
+}
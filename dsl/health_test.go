@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// downChan is a MockChan that never reconnects.
+type downChan struct {
+	MockChan
+	opens int
+}
+
+func (c *downChan) Open(ctx *Ctx) error {
+	c.opens++
+	return fmt.Errorf("broker unavailable")
+}
+
+func (c *downChan) Healthy(ctx *Ctx) error {
+	return fmt.Errorf("disconnected")
+}
+
+func newMockChan(ctx *Ctx) *MockChan {
+	c, err := NewMockChan(ctx, nil)
+	if err != nil {
+		panic(err)
+	}
+	return c.(*MockChan)
+}
+
+func healthTest(ctx *Ctx, c Chan, p *ReconnectPolicy) (*Test, error) {
+	tst := NewTest(ctx, "a", &Spec{
+		Phases: map[string]*Phase{
+			"phase1": {
+				Steps: []*Step{
+					{
+						Health: &Health{
+							Chan: "c",
+						},
+					},
+				},
+			},
+		},
+	})
+	tst.Chans = map[string]Chan{
+		"c": c,
+	}
+	if p != nil {
+		if err := p.parse(); err != nil {
+			return nil, err
+		}
+		tst.reconnects = map[string]*ReconnectPolicy{
+			"c": p,
+		}
+	}
+	return tst, nil
+}
+
+func TestHealth(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	t.Run("healthy", func(t *testing.T) {
+		c, _ := NewMockChan(ctx, nil)
+		tst, err := healthTest(ctx, c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tst.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("nopolicy", func(t *testing.T) {
+		c := newMockChan(ctx)
+		c.killed = true
+		tst, err := healthTest(ctx, c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tst.Run(ctx)
+		if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		c := newMockChan(ctx)
+		c.killed = true
+		tst, err := healthTest(ctx, c, &ReconnectPolicy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tst.subs = map[string][]string{
+			"c": {"a", "b"},
+		}
+		if err := tst.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if c.killed {
+			t.Fatal("still killed")
+		}
+	})
+
+	t.Run("giveup", func(t *testing.T) {
+		c := &downChan{
+			MockChan: *newMockChan(ctx),
+		}
+		tst, err := healthTest(ctx, c, &ReconnectPolicy{
+			MaxAttempts: 3,
+			Backoff:     "1ms",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tst.Run(ctx)
+		if err == nil || !strings.Contains(err.Error(), "after 3 reconnect attempts") {
+			t.Fatal(err)
+		}
+		if c.opens != 3 {
+			t.Fatal(c.opens)
+		}
+	})
+
+	t.Run("recv", func(t *testing.T) {
+		c := &downChan{
+			MockChan: *newMockChan(ctx),
+		}
+		tst, err := healthTest(ctx, c, &ReconnectPolicy{
+			MaxAttempts: 1,
+			Interval:    "10ms",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tst.Spec.Phases["phase1"].Steps[0] = &Step{
+			Recv: &Recv{
+				Chan:    "c",
+				Timeout: time.Minute,
+			},
+		}
+		// The Recv should fail quickly instead of waiting for
+		// its timeout.
+		err = tst.Run(ctx)
+		if err == nil || !strings.Contains(err.Error(), "reconnect attempts") {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestReconnectPolicyParse(t *testing.T) {
+	for _, p := range []*ReconnectPolicy{
+		{MaxAttempts: -1},
+		{Backoff: "soon"},
+		{MaxBackoff: "later"},
+		{Interval: "0s"},
+	} {
+		if err := p.parse(); err == nil {
+			t.Fatal(JSON(p))
+		}
+	}
+
+	p := &ReconnectPolicy{}
+	if err := p.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxAttempts != DefaultReconnectAttempts || p.interval != DefaultHealthInterval {
+		t.Fatal(JSON(p))
+	}
+}
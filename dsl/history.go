@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"sync"
+
+	"github.com/Comcast/plax/metrics"
+)
+
+// DefaultHistory is the default number of received messages per
+// channel that a Test remembers.  See Test.History.
+var DefaultHistory = 100
+
+// History remembers recently received messages for each channel.
+type History struct {
+	sync.Mutex
+
+	// Max is the maximum number of messages per channel.
+	Max int
+
+	msgs map[string][]Msg
+}
+
+// NewHistory makes a History that remembers up to max messages per
+// channel.
+func NewHistory(max int) *History {
+	return &History{
+		Max:  max,
+		msgs: make(map[string][]Msg),
+	}
+}
+
+// Add remembers a message received on the named channel.
+//
+// A nil History does nothing.
+func (h *History) Add(name string, m Msg) {
+	if h == nil || h.Max <= 0 {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	ms := append(h.msgs[name], m)
+	if h.Max < len(ms) {
+		ms = ms[len(ms)-h.Max:]
+	}
+	h.msgs[name] = ms
+}
+
+// Last returns (a copy of) the named channel's last n messages, with
+// the most recent message last.  If n isn't positive, Last returns
+// all of the remembered messages.
+func (h *History) Last(name string, n int) []Msg {
+	if h == nil {
+		return nil
+	}
+	h.Lock()
+	defer h.Unlock()
+	ms := h.msgs[name]
+	if 0 < n && n < len(ms) {
+		ms = ms[len(ms)-n:]
+	}
+	acc := make([]Msg, len(ms))
+	copy(acc, ms)
+	return acc
+}
+
+// chanName returns the name of the given channel.
+func (t *Test) chanName(c Chan) string {
+	for name, x := range t.Chans {
+		if x == c {
+			return name
+		}
+	}
+	return ""
+}
+
+// chanLabels returns the metrics.Labels for the given channel.
+func (t *Test) chanLabels(c Chan) metrics.Labels {
+	ls := metrics.Labels{
+		"chan": t.chanName(c),
+	}
+	if c != nil {
+		ls["kind"] = string(c.Kind())
+	}
+	return ls
+}
+
+// jsHistory returns a Javascript function history(chan, n) that
+// returns the last n messages (all if n isn't given) received on
+// the named channel by Recvs.
+//
+// If the test has only one channel (other than mother), the channel
+// name can be omitted (or null or "").
+func (t *Test) jsHistory(ctx *Ctx) func(interface{}, int) (interface{}, error) {
+	return func(x interface{}, n int) (interface{}, error) {
+		name, _ := x.(string)
+		if name == "" {
+			var c Chan
+			if err := t.ensureChan(ctx, "", &c); err != nil {
+				return nil, err
+			}
+			name = t.chanName(c)
+		}
+		return Canon(t.history.Last(name, n)), nil
+	}
+}
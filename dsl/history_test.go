@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryLast(t *testing.T) {
+	h := NewHistory(2)
+	for _, s := range []string{"a", "b", "c"} {
+		h.Add("c1", Msg{Payload: s})
+	}
+	ms := h.Last("c1", 0)
+	if len(ms) != 2 || ms[0].Payload != "b" || ms[1].Payload != "c" {
+		t.Fatal(JSON(ms))
+	}
+	if ms = h.Last("c1", 1); len(ms) != 1 || ms[0].Payload != "c" {
+		t.Fatal(JSON(ms))
+	}
+	if ms = h.Last("c2", 1); len(ms) != 0 {
+		t.Fatal(JSON(ms))
+	}
+
+	var nope *History
+	nope.Add("c1", Msg{})
+	if ms = nope.Last("c1", 0); len(ms) != 0 {
+		t.Fatal(JSON(ms))
+	}
+}
+
+func TestHistoryGuard(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+
+	for _, x := range []string{`"tacos"`, `"chips"`, `"tacos"`, `"queso"`} {
+		p.AddStep(ctx, &Step{
+			Pub: &Pub{
+				Payload: x,
+			},
+		})
+	}
+
+	// Accept only a first occurrence.
+	p.AddStep(ctx, &Step{
+		Recv: &Recv{
+			Pattern: `"?x"`,
+			Timeout: time.Second,
+			Guard: `
+var seen = history("mock1").map(function(m) { return m.payload; });
+return seen.indexOf(bs["?x"]) < 0 && bs["?x"] != "chips";`,
+		},
+	})
+	// The guard accepted "tacos", and now we skip "chips" (not
+	// pleasing the guard) and "tacos" (seen).
+	p.AddStep(ctx, &Step{
+		Recv: &Recv{
+			Pattern: `"?y"`,
+			Timeout: time.Second,
+			Guard:   `return history(null, 10).length == 3;`,
+		},
+	})
+	p.AddStep(ctx, &Step{
+		Run: `if (bs["?y"] != "queso") { return Failure("got " + bs["?y"]); }`,
+	})
+
+	run(t, ctx, tst)
+
+	if n := len(tst.history.Last("mock1", 0)); n != 4 {
+		t.Fatal(n)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+
+	for _, x := range []string{`{"n":1,"id":"a"}`, `{"n":2,"id":"b"}`, `{"n":2,"id":"a"}`} {
+		p.AddStep(ctx, &Step{
+			Pub: &Pub{
+				Payload: dejson(x),
+			},
+		})
+		p.AddStep(ctx, &Step{
+			Recv: &Recv{
+				Pattern: `{}`,
+				Timeout: time.Second,
+			},
+		})
+	}
+	run(t, ctx, tst)
+
+	inspect := func(i *Inspect) error {
+		_, err := (&Step{Inspect: i}).exec(ctx, tst)
+		return err
+	}
+	ok := func(i *Inspect) {
+		if err := inspect(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fails := func(i *Inspect) {
+		err := inspect(i)
+		if err == nil {
+			t.Fatalf("%s should have failed", JSON(i))
+		}
+		if _, broke := IsBroken(err); broke {
+			t.Fatal(err)
+		}
+	}
+
+	ok(&Inspect{Min: 3, Ordered: "n"})
+	ok(&Inspect{Min: 2, Unique: "$.id", Last: 2})
+	ok(&Inspect{Run: `return msgs.length == 3 && msgs[2].payload.id == "a";`})
+	fails(&Inspect{Min: 4})
+	fails(&Inspect{Unique: "id"})
+	fails(&Inspect{Ordered: "id", Last: 2})
+	fails(&Inspect{Run: `return Failure("nope");`})
+
+	// Values that can't be compared.
+	err := inspect(&Inspect{Ordered: "[n,id]"})
+	if _, broke := IsBroken(err); !broke {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// IdempotencyKey returns a UUID-shaped key for the named logical
+// operation.
+//
+// The key is stable for the life of the Test, so retries (which run
+// the same Test again) send the same key, and an idempotent API can
+// recognize a retried request.  A new Test (for example, a new
+// invocation of plax or another instance) gets different keys.
+func (t *Test) IdempotencyKey(op string) (string, error) {
+	if t.idempotencySeed == "" {
+		seed, err := NewUUID()
+		if err != nil {
+			return "", err
+		}
+		t.idempotencySeed = seed
+	}
+
+	digest := sha256.Sum256([]byte(t.idempotencySeed + "\x00" + t.Id + "\x00" + op))
+	bs := digest[:16]
+	// Variant and version bits as in a version 4 UUID.
+	bs[6] = (bs[6] & 0x0f) | 0x40
+	bs[8] = (bs[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:]), nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	var (
+		ctx  = NewCtx(nil)
+		tst  = NewTest(ctx, "test", nil)
+		uuid = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	)
+
+	key := func(t *testing.T, tst *Test, op string) string {
+		k, err := tst.IdempotencyKey(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuid.MatchString(k) {
+			t.Fatalf("bad key %s", k)
+		}
+		return k
+	}
+
+	k := key(t, tst, "create")
+
+	if key(t, tst, "create") != k {
+		t.Fatal("key changed")
+	}
+	if key(t, tst, "delete") == k {
+		t.Fatal("same key for different operations")
+	}
+	if key(t, NewTest(ctx, "test", nil), "create") == k {
+		t.Fatal("same key for different tests")
+	}
+
+	x, err := tst.JSExec(ctx, `idempotencyKey("create")`, tst.jsEnv(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != k {
+		t.Fatalf("Javascript key %v", x)
+	}
+}
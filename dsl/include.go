@@ -187,8 +187,6 @@ func Include(ctx *Ctx, x interface{}, at []string) (interface{}, error) {
 	default:
 		return x, nil
 	}
-
-	return x, nil
 }
 
 // IncludeYAML surrounds Include() with YAML (un)marshaling.
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+)
+
+// Inspect is a step that checks the messages that Recvs have
+// recently received on a channel.  See History.
+type Inspect struct {
+	Chan string
+
+	// Last is the number of most recent messages to inspect.
+	// Zero means all of the remembered messages.
+	Last int `json:",omitempty" yaml:",omitempty"`
+
+	// Min is the minimum number of messages.
+	Min int `json:",omitempty" yaml:",omitempty"`
+
+	// Unique is an optional expression (see Extract) whose
+	// values for the messages must be distinct.
+	Unique string `json:",omitempty" yaml:",omitempty"`
+
+	// Ordered is an optional expression (see Extract) whose
+	// values for the messages must be in (non-decreasing) order.
+	// The values must all be numbers or all be strings.
+	Ordered string `json:",omitempty" yaml:",omitempty"`
+
+	// Run is optional Javascript (like a Run step) that can
+	// check the messages, which are bound to 'msgs' (with the
+	// most recent message last).
+	Run string `json:",omitempty" yaml:",omitempty"`
+
+	ch Chan
+}
+
+func (i *Inspect) Substitute(ctx *Ctx, t *Test) (*Inspect, error) {
+	unique, err := t.Bindings.StringSub(ctx, i.Unique)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered, err := t.Bindings.StringSub(ctx, i.Ordered)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := t.Bindings.StringSub(ctx, i.Run)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Inspect{
+		Chan:    i.Chan,
+		Last:    i.Last,
+		Min:     i.Min,
+		Unique:  unique,
+		Ordered: ordered,
+		Run:     run,
+		ch:      i.ch,
+	}, nil
+}
+
+func (i *Inspect) Exec(ctx *Ctx, t *Test) error {
+	var (
+		name = t.chanName(i.ch)
+		msgs = t.history.Last(name, i.Last)
+	)
+	ctx.Inddf("    Inspecting %d messages on %s", len(msgs), name)
+
+	if len(msgs) < i.Min {
+		return fmt.Errorf("Inspect found %d messages on %s (want at least %d)",
+			len(msgs), name, i.Min)
+	}
+
+	values := func(expr string) ([]interface{}, error) {
+		acc := make([]interface{}, len(msgs))
+		for j, m := range msgs {
+			x, err := Extract(expr, m.Payload)
+			if err != nil {
+				return nil, err
+			}
+			acc[j] = x
+		}
+		return acc, nil
+	}
+
+	if i.Unique != "" {
+		xs, err := values(i.Unique)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]int, len(xs))
+		for j, x := range xs {
+			js := JSON(x)
+			if k, have := seen[js]; have {
+				return fmt.Errorf("Inspect Unique: messages %d and %d both have %s", k, j, js)
+			}
+			seen[js] = j
+		}
+	}
+
+	if i.Ordered != "" {
+		xs, err := values(i.Ordered)
+		if err != nil {
+			return err
+		}
+		for j := 1; j < len(xs); j++ {
+			less, err := inspectLess(xs[j], xs[j-1])
+			if err != nil {
+				return Brokenf("Inspect Ordered: message %d: %s", j, err)
+			}
+			if less {
+				return fmt.Errorf("Inspect Ordered: message %d (%s) is out of order after %s",
+					j, JSON(xs[j]), JSON(xs[j-1]))
+			}
+		}
+	}
+
+	if i.Run != "" {
+		src, err := t.prepareSource(ctx, i.Run)
+		if err != nil {
+			return err
+		}
+		env := t.jsEnv(ctx)
+		env["msgs"] = Canon(msgs)
+		if _, err = t.JSExec(ctx, src, env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inspectLess reports whether x < y for two numbers or two strings.
+func inspectLess(x, y interface{}) (bool, error) {
+	switch vx := x.(type) {
+	case float64:
+		if vy, is := y.(float64); is {
+			return vx < vy, nil
+		}
+	case string:
+		if vy, is := y.(string); is {
+			return vx < vy, nil
+		}
+	}
+	return false, fmt.Errorf("can't compare %s and %s", JSON(x), JSON(y))
+}
@@ -27,24 +27,56 @@ import (
 
 // JSExec executes the javascript source with the given context and environment mappings
 func JSExec(ctx *Ctx, src string, env map[string]interface{}) (interface{}, error) {
-	x, err := jsExec(ctx, src, env)
+	return jsResult(jsExec(ctx, src, env))
+}
+
+// jsResult wraps a non-Failure error as Broken (with
+// CategoryJavascript).
+func jsResult(x interface{}, err error) (interface{}, error) {
 	if err != nil {
 		if _, is := IsFailure(err); is {
 			return x, err
 		}
-		return nil, Brokenf("Javascript problem: %s", err)
+		return nil, Categorize(CategoryJavascript, Brokenf("Javascript problem: %s", err))
 	}
 	return x, nil
 }
 
 func jsExec(ctx *Ctx, src string, env map[string]interface{}) (interface{}, error) {
+	return jsRun(ctx, goja.New(), src, env)
+}
+
+// jsRun executes the source in the given runtime after installing
+// the standard functions and the environment.
+func jsRun(ctx *Ctx, js *goja.Runtime, src string, env map[string]interface{}) (interface{}, error) {
 
-	js := goja.New()
+	jsFuncs(ctx, js)
 
 	for k, v := range env {
 		js.Set(k, v)
 	}
 
+	v, err := js.RunString(src)
+	if v != nil {
+		x := v.Export()
+		if f, is := IsFailure(x); is {
+			return nil, f
+		}
+	}
+	if err != nil {
+		if f, is := IsFailure(err); is {
+			return nil, f
+		}
+		return nil, err
+	}
+
+	return v.Export(), nil
+}
+
+// jsFuncs installs the standard functions (print, now, match,
+// Failure, tsMs, time helpers, extract, and those from
+// jsCryptoFuncs), which use the given Ctx.
+func jsFuncs(ctx *Ctx, js *goja.Runtime) {
 	js.Set("print", func(args ...interface{}) {
 		var acc string
 		for i, x := range args {
@@ -90,19 +122,71 @@ func jsExec(ctx *Ctx, src string, env map[string]interface{}) (interface{}, erro
 		return t.UnixNano() / 1000 / 1000
 	})
 
-	v, err := js.RunString(src)
-	if v != nil {
-		x := v.Export()
-		if f, is := IsFailure(x); is {
-			return nil, f
+	js.Set("nowMs", func() int64 {
+		return time.Now().UnixNano() / 1000 / 1000
+	})
+
+	js.Set("isoTime", func(ms int64) string {
+		return time.Unix(0, ms*1000*1000).UTC().Format(time.RFC3339Nano)
+	})
+
+	js.Set("parseDuration", func(s string) (float64, error) {
+		d, err := time.ParseDuration(s)
+		return float64(d) / float64(time.Millisecond), err
+	})
+
+	js.Set("formatDuration", func(ms float64) string {
+		return time.Duration(ms * float64(time.Millisecond)).String()
+	})
+
+	js.Set("addDuration", func(ts, s string) (string, error) {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return "", err
 		}
-	}
-	if err != nil {
-		if f, is := IsFailure(err); is {
-			return nil, f
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return "", err
 		}
-		return nil, err
+		return t.Add(d).UTC().Format(time.RFC3339Nano), nil
+	})
+
+	js.Set("extract", func(x interface{}, expr string) (interface{}, error) {
+		return Extract(expr, x)
+	})
+
+	jsCryptoFuncs(js)
+}
+
+// JSExec executes the Javascript source in the test's Javascript
+// environment, which persists for the duration of a Run.
+//
+// The first execution loads the test's Libraries, so functions and
+// other globals that libraries (or steps) define are available to
+// later steps.  The given environment mappings are removed after
+// execution.
+func (t *Test) JSExec(ctx *Ctx, src string, env map[string]interface{}) (interface{}, error) {
+	t.jsMu.Lock()
+	defer t.jsMu.Unlock()
+
+	if t.js == nil {
+		libs, err := t.getLibraries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		js := goja.New()
+		jsFuncs(ctx, js)
+		if _, err = js.RunString(libs); err != nil {
+			return nil, Categorize(CategoryJavascript, Brokenf("Javascript library problem: %s", err))
+		}
+		t.js = js
 	}
 
-	return v.Export(), nil
+	defer func() {
+		for k := range env {
+			t.js.GlobalObject().Delete(k)
+		}
+	}()
+
+	return jsResult(jsRun(ctx, t.js, src, env))
 }
@@ -92,3 +92,32 @@ bss[0]["?x"] == "queso";
 	})
 
 }
+
+func TestTestJSExec(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "a", nil)
+	)
+
+	if _, err := tst.JSExec(ctx, "function twice(x) { return 2*x; }; n = 1;", map[string]interface{}{
+		"x": 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := tst.JSExec(ctx, "twice(n)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, is := x.(int64); !is || n != 2 {
+		t.Fatalf("%T %v", x, x)
+	}
+
+	// The environment mappings shouldn't persist.
+	if x, err = tst.JSExec(ctx, "typeof x", nil); err != nil {
+		t.Fatal(err)
+	}
+	if x != "undefined" {
+		t.Fatal(x)
+	}
+}
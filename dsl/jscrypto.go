@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// jsCryptoFuncs installs encoding and crypto helpers:
+//
+//	base64Encode(s), base64Decode(s)
+//	base64UrlEncode(s), base64UrlDecode(s) (unpadded)
+//	hexEncode(s), hexDecode(s)
+//	sha256(s, encoding), hmacSHA256(key, s, encoding)
+//	uuid()
+//	jwtDecode(token), jwtSign(claims, opts), jwtVerify(token, opts)
+//
+// An encoding is "hex" (the default), "base64", or "base64url".  JWT
+// opts are a CryptoKey ({alg, key, keyid}), and alg defaults to
+// HS256.
+//
+// Problems are thrown.
+func jsCryptoFuncs(js *goja.Runtime) {
+	js.Set("base64Encode", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	})
+
+	js.Set("base64Decode", func(s string) (string, error) {
+		bs, err := base64.StdEncoding.DecodeString(s)
+		return string(bs), err
+	})
+
+	js.Set("base64UrlEncode", func(s string) string {
+		return b64url.EncodeToString([]byte(s))
+	})
+
+	js.Set("base64UrlDecode", func(s string) (string, error) {
+		bs, err := b64url.DecodeString(strings.TrimRight(s, "="))
+		return string(bs), err
+	})
+
+	js.Set("hexEncode", func(s string) string {
+		return hex.EncodeToString([]byte(s))
+	})
+
+	js.Set("hexDecode", func(s string) (string, error) {
+		bs, err := hex.DecodeString(s)
+		return string(bs), err
+	})
+
+	js.Set("sha256", func(s string, enc string) (string, error) {
+		digest := sha256.Sum256([]byte(s))
+		return encodeBytes(digest[:], enc)
+	})
+
+	js.Set("hmacSHA256", func(key, s string, enc string) (string, error) {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(s))
+		return encodeBytes(mac.Sum(nil), enc)
+	})
+
+	js.Set("uuid", func() (string, error) {
+		return NewUUID()
+	})
+
+	js.Set("jwtDecode", func(token string) (map[string]interface{}, error) {
+		return jwtDecode(token)
+	})
+
+	js.Set("jwtSign", func(claims interface{}, opts interface{}) (string, error) {
+		k, err := jwtKey(opts)
+		if err != nil {
+			return "", err
+		}
+		s, is := claims.(string)
+		if !is {
+			js, err := json.Marshal(&claims)
+			if err != nil {
+				return "", err
+			}
+			s = string(js)
+		}
+		return k.jwsSign(s, true)
+	})
+
+	js.Set("jwtVerify", func(token string, opts interface{}) (interface{}, error) {
+		k, err := jwtKey(opts)
+		if err != nil {
+			return nil, err
+		}
+		s, err := k.jwsVerify(token)
+		if err != nil {
+			return nil, err
+		}
+		return MaybeParseJSON(s), nil
+	})
+}
+
+// encodeBytes encodes bytes as "hex" (the default), "base64", or
+// "base64url" (unpadded).
+func encodeBytes(bs []byte, enc string) (string, error) {
+	switch enc {
+	case "", "hex":
+		return hex.EncodeToString(bs), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(bs), nil
+	case "base64url":
+		return b64url.EncodeToString(bs), nil
+	}
+	return "", fmt.Errorf("unknown encoding '%s'", enc)
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	bs[6] = (bs[6] & 0x0f) | 0x40
+	bs[8] = (bs[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:]), nil
+}
+
+func jwtKey(opts interface{}) (*CryptoKey, error) {
+	var k CryptoKey
+	if err := As(opts, &k); err != nil {
+		return nil, err
+	}
+	if k.Alg == "" {
+		k.Alg = "HS256"
+	}
+	return &k, nil
+}
+
+// jwtDecode parses a JWT without verifying its signature.
+func jwtDecode(token string) (map[string]interface{}, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("JWT has %d parts (not 3)", len(parts))
+	}
+	acc := make(map[string]interface{}, 3)
+	for i, name := range []string{"header", "payload"} {
+		js, err := b64url.DecodeString(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("JWT %s: %w", name, err)
+		}
+		var x interface{}
+		if err = json.Unmarshal(js, &x); err != nil {
+			return nil, fmt.Errorf("JWT %s: %w", name, err)
+		}
+		acc[name] = x
+	}
+	acc["signature"] = parts[2]
+	return acc, nil
+}
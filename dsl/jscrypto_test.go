@@ -0,0 +1,74 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestJSCryptoFuncs(t *testing.T) {
+	ctx := NewCtx(nil)
+
+	for src, want := range map[string]interface{}{
+		`base64Encode("tacos")`:       "dGFjb3M=",
+		`base64Decode("dGFjb3M=")`:    "tacos",
+		`base64UrlEncode("tacos?")`:   "dGFjb3M_",
+		`base64UrlDecode("dGFjb3M_")`: "tacos?",
+		`hexEncode("hi")`:             "6869",
+		`hexDecode("6869")`:           "hi",
+		`sha256("")`:                  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		`sha256("", "base64")`:        "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		`hmacSHA256("key", "The quick brown fox jumps over the lazy dog")`:      "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		`jwtDecode(jwtSign({sub:"homer"}, {key:"secret"})).payload.sub`:         "homer",
+		`jwtDecode(jwtSign({sub:"homer"}, {key:"secret"})).header.alg`:          "HS256",
+		`jwtVerify(jwtSign({sub:"homer"}, {key:"secret"}), {key:"secret"}).sub`: "homer",
+	} {
+		x, err := JSExec(ctx, src, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", src, err)
+		}
+		if x != want {
+			t.Fatalf("%s: %v != %v", src, x, want)
+		}
+	}
+
+	t.Run("uuid", func(t *testing.T) {
+		x, err := JSExec(ctx, "uuid()", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, _ := x.(string)
+		if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(s) {
+			t.Fatal(x)
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		for _, src := range []string{
+			`hexDecode("xyz")`,
+			`sha256("", "rot13")`,
+			`jwtVerify(jwtSign({sub:"homer"}, {key:"secret"}), {key:"other"})`,
+			`jwtDecode("a.b")`,
+		} {
+			if _, err := JSExec(ctx, src, nil); err == nil {
+				t.Fatalf("%s should have thrown", src)
+			}
+		}
+	})
+}
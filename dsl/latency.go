@@ -0,0 +1,35 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"time"
+)
+
+// StepLatency is the (wall-clock) duration of a step's execution.
+type StepLatency struct {
+	Phase   string
+	Step    int
+	Latency time.Duration
+}
+
+// Key identifies the step as "PHASE/STEP".
+func (l StepLatency) Key() string {
+	return fmt.Sprintf("%s/%d", l.Phase, l.Step)
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencies(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+	p.AddStep(ctx, &Step{
+		Wait: "10ms",
+	})
+	run(t, ctx, tst)
+
+	if n := len(tst.Latencies); n != 3 {
+		t.Fatal(n)
+	}
+	l := tst.Latencies[2]
+	if l.Key() != "phase1/2" {
+		t.Fatal(l.Key())
+	}
+	if l.Latency < 10*time.Millisecond {
+		t.Fatal(l.Latency)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// LeakGrace is how long LeakedGoroutines waits for goroutines to
+// exit.
+var LeakGrace = 2 * time.Second
+
+// sortedChanNames returns the names of the test's channels in order.
+func (t *Test) sortedChanNames() []string {
+	names := make([]string, 0, len(t.Chans))
+	for name := range t.Chans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// closeChan closes the named channel unless it's already closed.
+func (t *Test) closeChan(ctx *Ctx, name string, c Chan) error {
+	if t.closed[name] {
+		return nil
+	}
+	if t.closed == nil {
+		t.closed = make(map[string]bool)
+	}
+	t.closed[name] = true
+
+	return safeClose(ctx, name, c)
+}
+
+// safeClose closes the channel and returns a panic in the channel's
+// Close as an error.
+func safeClose(ctx *Ctx, name string, c Chan) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic closing channel %s: %v", name, r)
+		}
+	}()
+
+	return c.Close(ctx)
+}
+
+// Finalize closes every channel that the test hasn't already closed
+// and then forgets the test's channels, so that a retry starts
+// fresh.
+//
+// Call Finalize at the end of every execution of a test, however
+// the execution ended: success, failure, a Broken error, or a panic.
+// A channel that couldn't be closed is a leak, which Finalize
+// reports in Leaks.
+func (t *Test) Finalize(ctx *Ctx) {
+	t.unpause()
+
+	t.Leaks = nil
+	for _, name := range t.sortedChanNames() {
+		if t.closed[name] {
+			continue
+		}
+		c := t.Chans[name]
+		ctx.Indf("Finalize closing channel %s", name)
+		if err := t.closeChan(ctx, name, c); err != nil {
+			leak := fmt.Sprintf("channel %s (%s): %s", name, c.Kind(), err)
+			ctx.Warnf("warning: test %s leaked %s", t.Id, leak)
+			t.Leaks = append(t.Leaks, leak)
+		}
+	}
+
+	if t.recorder != nil {
+		if err := t.recorder.Close(); err != nil {
+			ctx.Warnf("warning: test %s recorder close: %s", t.Id, err)
+		}
+		t.recorder = nil
+	}
+
+	t.Chans = nil
+	t.closed = nil
+	t.canons = nil
+	t.reconnects = nil
+	t.subs = nil
+	t.filters = nil
+	t.topicRules = nil
+}
+
+// LeakedGoroutines waits up to LeakGrace for the number of
+// goroutines to fall to the given baseline, and then it returns the
+// number of goroutines (if any) over that baseline.
+//
+// The result is only meaningful when nothing else (like another
+// test) is starting or stopping goroutines at the same time.
+func LeakedGoroutines(baseline int) int {
+	deadline := time.Now().Add(LeakGrace)
+	for {
+		n := runtime.NumGoroutine() - baseline
+		if n <= 0 {
+			return 0
+		}
+		if time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// CheckLeaks, when FailOnLeaks, adds any leaked goroutines (compared
+// to the given baseline) to Leaks and then returns an error for any
+// Leaks.  Call CheckLeaks after Finalize.
+func (t *Test) CheckLeaks(ctx *Ctx, baseline int) error {
+	if !t.FailOnLeaks {
+		return nil
+	}
+	if n := LeakedGoroutines(baseline); 0 < n {
+		leak := fmt.Sprintf("%d goroutines", n)
+		ctx.Warnf("warning: test %s leaked %s", t.Id, leak)
+		t.Leaks = append(t.Leaks, leak)
+	}
+	if 0 < len(t.Leaks) {
+		return Categorize(CategoryLeak, fmt.Errorf("test leaked %d resources: %v", len(t.Leaks), t.Leaks))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closingChan is a MockChan that counts its Closes and that can fail
+// or panic when closing.
+type closingChan struct {
+	MockChan
+	closes int
+	err    error
+	panics bool
+}
+
+func (c *closingChan) Close(ctx *Ctx) error {
+	c.closes++
+	if c.panics {
+		panic("bad close")
+	}
+	return c.err
+}
+
+func TestFinalize(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	var (
+		fine    = &closingChan{}
+		fails   = &closingChan{err: fmt.Errorf("broker gone")}
+		panicky = &closingChan{panics: true}
+	)
+
+	tst := NewTest(ctx, "a", &Spec{})
+	tst.Chans = map[string]Chan{
+		"fine":    fine,
+		"fails":   fails,
+		"panicky": panicky,
+	}
+
+	// Close closes every channel despite problems.
+	err := tst.Close(ctx)
+	if err == nil || !strings.Contains(err.Error(), "broker gone") {
+		t.Fatal(err)
+	}
+	if fine.closes != 1 || fails.closes != 1 || panicky.closes != 1 {
+		t.Fatal(fine.closes, fails.closes, panicky.closes)
+	}
+
+	// Finalize doesn't close them again.
+	tst.Finalize(ctx)
+	if fine.closes != 1 || 0 < len(tst.Leaks) || tst.Chans != nil {
+		t.Fatal(fine.closes, tst.Leaks)
+	}
+
+	// Without a Close, Finalize closes the channels and reports
+	// the ones that it couldn't close.
+	tst.Chans = map[string]Chan{
+		"fine":    fine,
+		"panicky": panicky,
+	}
+	tst.Finalize(ctx)
+	if fine.closes != 2 || len(tst.Leaks) != 1 || !strings.Contains(tst.Leaks[0], "panic closing channel panicky") {
+		t.Fatal(fine.closes, tst.Leaks)
+	}
+	if tst.Chans != nil {
+		t.Fatal(tst.Chans)
+	}
+
+	// Leaks matter only with FailOnLeaks.
+	if err := tst.CheckLeaks(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	tst.FailOnLeaks = true
+	if err := tst.CheckLeaks(ctx, 1<<20); CategoryOf(err) != CategoryLeak {
+		t.Fatal(err)
+	}
+}
+
+func TestLeakedGoroutines(t *testing.T) {
+	defer func(d time.Duration) {
+		LeakGrace = d
+	}(LeakGrace)
+	LeakGrace = 50 * time.Millisecond
+
+	var (
+		baseline = runtime.NumGoroutine()
+		done     = make(chan bool)
+	)
+	go func() {
+		<-done
+	}()
+	if n := LeakedGoroutines(baseline); n != 1 {
+		t.Fatal(n)
+	}
+	close(done)
+	if n := LeakedGoroutines(baseline); n != 0 {
+		t.Fatal(n)
+	}
+}
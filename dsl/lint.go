@@ -0,0 +1,387 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lint checks the test's Spec for problems that would otherwise only
+// appear during execution:
+//
+//  1. A Goto or Branch that targets a phase that doesn't exist.
+//
+//  2. A step after a Goto.
+//
+//  3. A phase that can't be reached from the InitialPhase or a
+//     FinalPhase.
+//
+//  4. A step that uses a channel that no step makes (via Mother or a
+//     MakeChan).
+//
+// A Branch's targets are the string literals that it returns
+// (perhaps via '?:').  If a Branch returns anything else, Lint
+// can't know its targets, so it doesn't report unreachable phases.
+// Similarly, if a channel's name is computed (via bindings) or
+// Javascript makes channels (via makeChan), Lint doesn't report
+// unknown channels.
+func (t *Test) Lint(ctx *Ctx) []error {
+	var (
+		errs  []error
+		s     = t.Spec
+		names = make([]string, 0, len(s.Phases))
+	)
+	for name := range s.Phases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		// edges maps each phase to the phases it can go to.
+		edges = make(map[string][]string, len(s.Phases))
+
+		// dynamic is true if we can't know all of the edges.
+		dynamic bool
+	)
+
+	target := func(name string, i int, op, to string) {
+		if HappyTerminalPhase(to) {
+			return
+		}
+		if _, have := s.Phases[to]; !have {
+			errs = append(errs,
+				fmt.Errorf("No phase '%s', which is targeted by %s step %d in phase '%s'",
+					to, op, i, name))
+			return
+		}
+		edges[name] = append(edges[name], to)
+	}
+
+	for _, name := range names {
+		p := s.Phases[name]
+		for i, step := range p.Steps {
+			if step.Goto != "" {
+				if i < len(p.Steps)-1 {
+					errs = append(errs,
+						fmt.Errorf("Goto step %d in phase '%s' is not the last step",
+							i, name))
+				}
+				target(name, i, "Goto", step.Goto)
+			}
+			if step.Branch != "" {
+				tos, ok := branchTargets(step.Branch)
+				if !ok {
+					dynamic = true
+				}
+				for _, to := range tos {
+					target(name, i, "Branch", to)
+				}
+			}
+		}
+	}
+
+	// Check reachability.
+	if !dynamic {
+		reached := make(map[string]bool, len(s.Phases))
+		var visit func(name string)
+		visit = func(name string) {
+			if reached[name] {
+				return
+			}
+			reached[name] = true
+			for _, to := range edges[name] {
+				visit(to)
+			}
+		}
+		initial := s.InitialPhase
+		if initial == "" {
+			initial = DefaultInitialPhase
+		}
+		visit(initial)
+		for _, name := range s.FinalPhases {
+			visit(name)
+		}
+		for _, name := range names {
+			if !reached[name] {
+				errs = append(errs, fmt.Errorf("Phase '%s' is unreachable", name))
+			}
+		}
+	}
+
+	errs = append(errs, t.lintChans(names)...)
+
+	return errs
+}
+
+// lintChans reports steps that use channels that no step makes.
+func (t *Test) lintChans(names []string) []error {
+	var (
+		errs  []error
+		s     = t.Spec
+		known = map[string]bool{
+			"mother": true,
+		}
+	)
+
+	// Find the channels that are made by requests to mother or
+	// by MakeChans.
+	for _, name := range names {
+		for _, step := range s.Phases[name].Steps {
+			if strings.Contains(JSON(step), "makeChan(") {
+				// Javascript makes channels, so we can't
+				// know.
+				return nil
+			}
+			if step.MakeChan != nil {
+				if strings.ContainsAny(step.MakeChan.Name, "?{") {
+					return nil
+				}
+				known[step.MakeChan.Name] = true
+				continue
+			}
+			if step.Pub == nil {
+				continue
+			}
+			m, is := step.Pub.Payload.(map[string]interface{})
+			if !is {
+				continue
+			}
+			mk, is := m["make"].(map[string]interface{})
+			if !is {
+				continue
+			}
+			chanName, is := mk["name"].(string)
+			if !is || strings.ContainsAny(chanName, "?{") {
+				// Can't know.
+				return nil
+			}
+			known[chanName] = true
+		}
+	}
+
+	for _, name := range names {
+		for i, step := range s.Phases[name].Steps {
+			for _, chanName := range step.chans() {
+				if chanName == "" || known[chanName] {
+					continue
+				}
+				errs = append(errs,
+					fmt.Errorf("No channel '%s', which step %d in phase '%s' uses",
+						chanName, i, name))
+			}
+		}
+	}
+
+	return errs
+}
+
+// chans returns the channel names that the step uses.
+func (s *Step) chans() []string {
+	var acc []string
+	if s.Pub != nil {
+		acc = append(acc, s.Pub.Chan)
+		acc = append(acc, literalChans(s.Pub.Chans)...)
+	}
+	if s.Sub != nil {
+		acc = append(acc, s.Sub.Chan)
+		acc = append(acc, literalChans(s.Sub.Chans)...)
+	}
+	if s.Recv != nil {
+		acc = append(acc, s.Recv.Chan)
+		acc = append(acc, literalChans(s.Recv.Chans)...)
+	}
+	if s.RecvSeq != nil {
+		acc = append(acc, s.RecvSeq.Chan)
+	}
+	if s.Kill != nil {
+		acc = append(acc, s.Kill.Chan)
+	}
+	if s.Reconnect != nil {
+		acc = append(acc, s.Reconnect.Chan)
+	}
+	if s.Health != nil {
+		acc = append(acc, literalChans([]string{s.Health.Chan})...)
+	}
+	if s.Pause != nil {
+		acc = append(acc, s.Pause.Chan)
+	}
+	if s.Resume != nil {
+		acc = append(acc, s.Resume.Chan)
+	}
+	if s.Ingest != nil {
+		acc = append(acc, s.Ingest.Chan)
+	}
+	if s.Inspect != nil {
+		acc = append(acc, s.Inspect.Chan)
+	}
+	if s.WaitFor != nil {
+		if s.WaitFor.Pub != nil {
+			acc = append(acc, s.WaitFor.Pub.Chan)
+		}
+		if s.WaitFor.Recv != nil {
+			acc = append(acc, s.WaitFor.Recv.Chan)
+		}
+	}
+	return acc
+}
+
+// literalChans returns the channel names that aren't globs (or
+// computed via bindings).  See Test.chanNames.
+func literalChans(names []string) []string {
+	var acc []string
+	for _, name := range names {
+		if !strings.ContainsAny(name, "*?[{") {
+			acc = append(acc, name)
+		}
+	}
+	return acc
+}
+
+// branchTargets returns the phase names that the given Branch
+// source returns as string literals (perhaps via '?:').  The result
+// is false if the source returns anything else.
+func branchTargets(src string) ([]string, bool) {
+	var (
+		acc []string
+		ok  = true
+	)
+	for _, expr := range returnExprs(src) {
+		tos, known := literals(expr)
+		if !known {
+			ok = false
+		}
+		acc = append(acc, tos...)
+	}
+	return acc, ok
+}
+
+// returnExprs finds the expressions in the return statements in the
+// given Javascript.
+//
+// This scanner only knows about strings and comments, but that's
+// enough for typical Branch code.
+func returnExprs(src string) []string {
+	var acc []string
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '"' || c == '\'' || c == '`':
+			i = skipString(src, i)
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "return") && boundary(src, i, i+6):
+			j := i + 6
+			for ; j < len(src); j++ {
+				c := src[j]
+				if c == ';' || c == '\n' || c == '}' {
+					break
+				}
+				if c == '"' || c == '\'' || c == '`' {
+					j = skipString(src, j)
+				}
+			}
+			acc = append(acc, strings.TrimSpace(src[i+6:j]))
+			i = j
+		}
+	}
+	return acc
+}
+
+// boundary reports whether src[i:j] is a whole word.
+func boundary(src string, i, j int) bool {
+	word := func(c byte) bool {
+		return c == '_' || c == '$' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+	}
+	return (i == 0 || !word(src[i-1])) && (j == len(src) || !word(src[j]))
+}
+
+// skipString returns the index of the closing quote of the string
+// that starts at src[i].
+func skipString(src string, i int) int {
+	q := src[i]
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case q:
+			return i
+		}
+	}
+	return i
+}
+
+// literals returns the string literals that the expression can
+// evaluate to.  The result is false if the expression isn't a string
+// literal or a conditional expression with literal branches.
+func literals(expr string) ([]string, bool) {
+	expr = strings.TrimSpace(expr)
+	for 2 <= len(expr) && expr[0] == '(' && expr[len(expr)-1] == ')' {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	if expr == "" {
+		// Just 'return', which continues.
+		return nil, true
+	}
+
+	if q := expr[0]; q == '"' || q == '\'' {
+		if skipString(expr, 0) == len(expr)-1 && !strings.Contains(expr, "\\") {
+			return []string{expr[1 : len(expr)-1]}, true
+		}
+		return nil, false
+	}
+
+	// COND ? X : Y at the top level.
+	var (
+		depth    = 0
+		question = -1
+		nested   = 0
+	)
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; c {
+		case '"', '\'', '`':
+			i = skipString(expr, i)
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '?':
+			if depth == 0 {
+				if question < 0 {
+					question = i
+				} else {
+					nested++
+				}
+			}
+		case ':':
+			if depth == 0 && 0 <= question {
+				if 0 < nested {
+					nested--
+					continue
+				}
+				xs, okx := literals(expr[question+1 : i])
+				ys, oky := literals(expr[i+1:])
+				return append(xs, ys...), okx && oky
+			}
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBranchTargets(t *testing.T) {
+	for src, want := range map[string][]string{
+		`return "phase1";`: {"phase1"},
+		`// Don't return "x".
+return 0 == test.State.n ? "done" : 'listen';`: {"done", "listen"},
+		`if (bs["?x"]) { return "a" } return (x ? (y ? "b" : "c") : "");`: {"a", "b", "c", ""},
+		`return x ? y ? "b" : "c" : "d";`:                                 {"b", "c", "d"},
+		`test.State.n++; return;`:                                         nil,
+	} {
+		got, ok := branchTargets(src)
+		if !ok {
+			t.Fatalf("%s: dynamic", src)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: %q", src, got)
+		}
+	}
+
+	for _, src := range []string{
+		`return test.State.next;`,
+		`return x ? "a" : next;`,
+		`return "a" + "b";`,
+	} {
+		if _, ok := branchTargets(src); ok {
+			t.Fatalf("%s: not dynamic", src)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	lint := func(src string) []string {
+		ctx := NewCtx(nil)
+		tst := NewTest(ctx, "", nil)
+		if err := yaml.Unmarshal([]byte(src), &tst); err != nil {
+			t.Fatal(err)
+		}
+		var acc []string
+		for _, err := range tst.Lint(ctx) {
+			acc = append(acc, err.Error())
+		}
+		return acc
+	}
+
+	got := lint(`
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            chan: mother
+            payload: {"make":{"name":"mock","type":"mock"}}
+        - recv:
+            chan: mocky
+            pattern: {}
+        - branch: |
+            return bs["?x"] ? "phase2" : "phase3";
+    phase2:
+      steps:
+        - goto: done
+        - recv:
+            chan: mock
+            pattern: {}
+    orphan:
+      steps:
+        - goto: phase1
+`)
+	want := []string{
+		"No phase 'phase3', which is targeted by Branch step 2 in phase 'phase1'",
+		"Goto step 0 in phase 'phase2' is not the last step",
+		"Phase 'orphan' is unreachable",
+		"No channel 'mocky', which step 1 in phase 'phase1' uses",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(strings.Join(got, "\n"))
+	}
+
+	// A dynamic Branch and a computed channel name.
+	got = lint(`
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            chan: mother
+            payload: {"make":{"name":"{?name}","type":"mock"}}
+        - recv:
+            chan: whatever
+            pattern: {}
+        - branch: |
+            return test.State.next;
+    phase2:
+      steps:
+        - goto: phase1
+`)
+	if 0 < len(got) {
+		t.Fatal(got)
+	}
+}
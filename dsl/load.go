@@ -0,0 +1,49 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// ParseTest makes a Test from its YAML (or JSON) source.
+//
+// The source's includes are processed (see IncludeYAML) via the
+// Ctx's IncludeDirs, and the result is checked against its version
+// (see Test.CheckVersion).  Finally the Spec's Metadata (if any) is
+// applied (see Test.ApplyMetadata).
+func ParseTest(ctx *Ctx, id string, bs []byte) (*Test, error) {
+	t := NewTest(ctx, id, nil)
+
+	bs, err := IncludeYAML(ctx, bs)
+	if err != nil {
+		return nil, Categorize(CategorySchema, Brokenf("spec parse: %w", err))
+	}
+
+	if err := yaml.Unmarshal(bs, &t); err != nil {
+		return nil, Categorize(CategorySchema, Brokenf("spec parse: %w", err))
+	}
+
+	if err := t.CheckVersion(ctx); err != nil {
+		return nil, Categorize(CategorySchema, Brokenf("spec version: %w", err))
+	}
+
+	t.ApplyMetadata()
+
+	return t, nil
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log levels for LogRecords.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+)
+
+// LogRecord is one structured log line.
+type LogRecord struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+
+	// Mark is the prefix for the human format: "|" for test
+	// execution (see Ctx.Indf), ">" for details like channel
+	// operations (see Ctx.Logf), and "!" for warnings.
+	Mark string `json:"-"`
+
+	Msg string `json:"msg"`
+
+	// Fields are from the Ctx (see Ctx.WithFields), like the
+	// test's id.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// StructuredLogger is a Logger that can also receive LogRecords.
+// When a Ctx's Logger is a StructuredLogger, Ctx logging methods
+// call Log rather than Printf.
+type StructuredLogger interface {
+	Logger
+	Log(r LogRecord)
+}
+
+// LogFormats are the names of the formats for NewLogger.
+var LogFormats = []string{"text", "json"}
+
+// NewLogger makes a StructuredLogger that writes to the given sink
+// in the given format: "text" (the default), which is the indented
+// human format, or "json", which writes one JSON object per line.
+func NewLogger(sink io.Writer, format string) (StructuredLogger, error) {
+	switch format {
+	case "", "text":
+		return &TextLogger{
+			logger: log.New(sink, "", log.LstdFlags|log.Lmicroseconds),
+		}, nil
+	case "json":
+		return &JSONLogger{
+			w: sink,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format '%s' (not in %s)", format, strings.Join(LogFormats, ", "))
+	}
+}
+
+// TextLogger renders LogRecords in the human format (like GoLogger).
+type TextLogger struct {
+	logger *log.Logger
+}
+
+// Printf logs.
+func (l *TextLogger) Printf(format string, args ...interface{}) {
+	l.logger.Printf(format, args...)
+}
+
+// Log logs the record with its Mark.
+func (l *TextLogger) Log(r LogRecord) {
+	if r.Mark == "" {
+		l.logger.Print(r.Msg)
+		return
+	}
+	l.logger.Print(r.Mark + " " + r.Msg)
+}
+
+// JSONLogger writes each LogRecord as a line of JSON.
+//
+// The indentation of a message (which suggests its nesting in the
+// human format) is removed.
+type JSONLogger struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// Printf logs at LevelInfo.
+func (l *JSONLogger) Printf(format string, args ...interface{}) {
+	l.Log(LogRecord{
+		Time:  time.Now().UTC(),
+		Level: LevelInfo,
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Log writes the record.
+func (l *JSONLogger) Log(r LogRecord) {
+	r.Msg = strings.TrimSpace(r.Msg)
+	js, err := json.Marshal(&r)
+	if err != nil {
+		// Probably an unmarshalable field value.
+		r.Fields = map[string]interface{}{
+			"error": err.Error(),
+		}
+		js, _ = json.Marshal(&r)
+	}
+	l.Lock()
+	l.w.Write(append(js, '\n'))
+	l.Unlock()
+}
+
+// OpenLogSink opens a sink for NewLogger: "stdout", "stderr" (the
+// default), "syslog" (or "syslog:TAG"), or a filename (which is
+// opened for appending).
+func OpenLogSink(spec string) (io.WriteCloser, error) {
+	switch {
+	case spec == "" || spec == "stderr":
+		return nopCloser{os.Stderr}, nil
+	case spec == "stdout":
+		return nopCloser{os.Stdout}, nil
+	case spec == "syslog":
+		return openSyslog("plax")
+	case strings.HasPrefix(spec, "syslog:"):
+		return openSyslog(strings.TrimPrefix(spec, "syslog:"))
+	default:
+		return os.OpenFile(spec, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// SetDefaultLogger makes the given logger the DefaultLogger
+// and sends the standard logger's output to it as well.
+func SetDefaultLogger(l StructuredLogger) {
+	DefaultLogger = l
+	log.SetFlags(0)
+	log.SetOutput(LogWriter(l))
+}
+
+// ConfigureLogging sets the DefaultLogger (see SetDefaultLogger) for
+// the given format and sink (see NewLogger and OpenLogSink) unless
+// the defaults (text to stderr) suffice.
+func ConfigureLogging(format, sink string) error {
+	if (format == "" || format == "text") && (sink == "" || sink == "stderr") {
+		return nil
+	}
+	w, err := OpenLogSink(sink)
+	if err != nil {
+		return err
+	}
+	l, err := NewLogger(w, format)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	SetDefaultLogger(l)
+	return nil
+}
+
+// LogWriter returns an io.Writer that logs each line written to it
+// via the given Logger.  Use with log.SetOutput so that the standard
+// logger's output (from invoke, for example) goes to the same sink
+// in the same format.
+func LogWriter(l Logger) io.Writer {
+	return logWriter{l}
+}
+
+type logWriter struct {
+	l Logger
+}
+
+func (w logWriter) Write(bs []byte) (int, error) {
+	msg := strings.TrimSuffix(string(bs), "\n")
+	if sl, is := w.l.(StructuredLogger); is {
+		sl.Log(LogRecord{
+			Time:  time.Now().UTC(),
+			Level: LevelInfo,
+			Msg:   msg,
+		})
+	} else {
+		w.l.Printf("%s", msg)
+	}
+	return len(bs), nil
+}
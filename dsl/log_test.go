@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewCtx(nil)
+	ctx.Logger = l
+	ctx.Redactor = NewRedactor()
+	ctx.Redactor.AddBindings(Bindings{
+		"?!secret": "shh",
+	})
+	ctx = ctx.WithFields(map[string]interface{}{
+		"test": "tacos",
+	})
+	ctx.Indf("    Recv %s", "shh")
+	ctx.Inddf("hidden")
+	ctx.Warnf("uh oh")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal(buf.String())
+	}
+
+	var r LogRecord
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Level != LevelInfo || r.Fields["test"] != "tacos" || strings.Contains(r.Msg, "shh") || !strings.HasPrefix(r.Msg, "Recv") {
+		t.Fatal(lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Level != LevelWarn || r.Msg != "uh oh" {
+		t.Fatal(lines[1])
+	}
+}
+
+func TestLogText(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewCtx(nil)
+	ctx.Logger = l
+	ctx.Logf("want tacos")
+	ctx.Printf("plain")
+
+	if s := buf.String(); !strings.Contains(s, " > want tacos\n") || !strings.Contains(s, " plain\n") {
+		t.Fatal(s)
+	}
+
+	if _, err = NewLogger(&buf, "xml"); err == nil {
+		t.Fatal("expected protest")
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := NewLogger(&buf, "json")
+	LogWriter(l).Write([]byte("Running test tacos.yaml\n"))
+
+	var r LogRecord
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Msg != "Running test tacos.yaml" {
+		t.Fatal(r.Msg)
+	}
+}
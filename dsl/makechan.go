@@ -0,0 +1,97 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+)
+
+// MakeChan is a Step that makes a channel, which is like a
+// MotherMakeRequest published to Mother except that a failure fails
+// the step (so no Recv from Mother is needed).
+//
+// The Name, Type, Profile, Config, and Topics' Prefix are subject to
+// bindings substitution, so a test can make a channel with a name and
+// a configuration computed at runtime (say, a connection for each
+// device that the test provisioned).
+type MakeChan MotherMakeRequest
+
+func (m *MakeChan) Substitute(ctx *Ctx, t *Test) (*MotherMakeRequest, error) {
+	req := MotherMakeRequest(*m)
+
+	var err error
+	if req.Name, err = t.Bindings.StringSub(ctx, m.Name); err != nil {
+		return nil, err
+	}
+	typ, err := t.Bindings.StringSub(ctx, string(m.Type))
+	if err != nil {
+		return nil, err
+	}
+	req.Type = ChanKind(typ)
+	if req.Profile, err = t.Bindings.StringSub(ctx, m.Profile); err != nil {
+		return nil, err
+	}
+	if m.Config != nil {
+		if err := t.Bindings.Sub(ctx, m.Config, &req.Config, false); err != nil {
+			return nil, err
+		}
+	}
+	if req.Topics, err = m.Topics.Substitute(ctx, t); err != nil {
+		return nil, err
+	}
+
+	if req.Name == "" {
+		return nil, Brokenf("MakeChan needs a Name")
+	}
+	if req.Type == "" && req.Profile == "" {
+		return nil, Brokenf("MakeChan %s needs a Type or a Profile", req.Name)
+	}
+	return &req, nil
+}
+
+func (m *MakeChan) Exec(ctx *Ctx, t *Test) error {
+	req, err := m.Substitute(ctx, t)
+	if err != nil {
+		return err
+	}
+	ctx.Indf("    MakeChan %s (%s)", req.Name, req.Type)
+	if err := t.makeChanFor(ctx, req); err != nil {
+		return Categorize(CategoryChannel, fmt.Errorf("MakeChan %s: %w", req.Name, err))
+	}
+	return nil
+}
+
+// jsMakeChan returns a Javascript function makeChan(req) that makes a
+// channel.  The req has the form of a MotherMakeRequest (name, type,
+// config, etc.).  The function returns the channel's name.
+func (t *Test) jsMakeChan(ctx *Ctx) func(interface{}) (string, error) {
+	return func(x interface{}) (string, error) {
+		var req MotherMakeRequest
+		if err := As(x, &req); err != nil {
+			return "", fmt.Errorf("makeChan: %w", err)
+		}
+		if req.Name == "" {
+			return "", fmt.Errorf("makeChan needs a name")
+		}
+		ctx.Indf("    makeChan %s (%s)", req.Name, req.Type)
+		if err := t.makeChanFor(ctx, &req); err != nil {
+			return "", fmt.Errorf("makeChan %s: %w", req.Name, err)
+		}
+		return req.Name, nil
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMakeChan(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", &Spec{
+		Phases: map[string]*Phase{
+			"phase1": {
+				Steps: []*Step{
+					{
+						MakeChan: &MakeChan{
+							Name: "device-{?id}",
+							Type: "mock",
+						},
+					},
+					{
+						Run: `makeChan({name: "js-" + bs["?id"], type: "mock"});`,
+					},
+					{
+						MakeChan: &MakeChan{
+							Name: "js-{?id}",
+							Type: "mock",
+						},
+					},
+				},
+			},
+		},
+	})
+	tst.Bindings["?id"] = "A17"
+
+	err := tst.Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "Already have chan 'js-A17'") {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"device-A17", "js-A17"} {
+		if _, have := tst.Chans[name]; !have {
+			t.Fatal(name)
+		}
+	}
+}
+
+func TestLintMakeChan(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", &Spec{
+		Phases: map[string]*Phase{
+			"phase1": {
+				Steps: []*Step{
+					{
+						MakeChan: &MakeChan{
+							Name: "store",
+							Type: "mock",
+						},
+					},
+					{
+						Recv: &Recv{
+							Chan: "store",
+						},
+					},
+					{
+						Recv: &Recv{
+							Chan: "depot",
+						},
+					},
+				},
+			},
+		},
+	})
+	errs := tst.Lint(ctx)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "'depot'") {
+		t.Fatal(errs)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+// Metadata describes a test for reports and filters.  A Spec's
+// Metadata complements (and, where noted, takes precedence over) the
+// Test's own Doc, Labels, Owners, and Priority.  See
+// Test.ApplyMetadata.
+type Metadata struct {
+	// Name is a concise, human-friendly name for the test.
+	// Reports use it in addition to the test's Id, which usually
+	// comes from the test's filename.
+	Name string `json:",omitempty" yaml:",omitempty"`
+
+	// Description is an optional description of the test, which
+	// serves as the Test's Doc when that's empty.
+	Description string `json:",omitempty" yaml:",omitempty"`
+
+	// Owners are added to the Test's Owners.
+	Owners []string `json:",omitempty" yaml:",omitempty"`
+
+	// Tags are added to the Test's Labels, so the -labels
+	// option can select tests by tag.
+	Tags []string `json:",omitempty" yaml:",omitempty"`
+
+	// Priority, when given, overrides the Test's Priority.
+	Priority *int `json:",omitempty" yaml:",omitempty"`
+
+	// Tickets are the IDs of issues (or requirements) that the
+	// test covers (e.g., "PLAX-123").
+	Tickets []string `json:",omitempty" yaml:",omitempty"`
+}
+
+// ApplyMetadata merges the Spec's Metadata (if any) into the Test.
+func (t *Test) ApplyMetadata() {
+	if t.Spec == nil || t.Spec.Metadata == nil {
+		return
+	}
+	m := t.Spec.Metadata
+	if t.Doc == "" {
+		t.Doc = m.Description
+	}
+	t.Labels = union(t.Labels, m.Tags)
+	t.Owners = union(t.Owners, m.Owners)
+	if m.Priority != nil {
+		t.Priority = *m.Priority
+	}
+}
+
+// Name returns the test's Metadata name, which defaults to the
+// test's Id.
+func (t *Test) Name() string {
+	if t.Spec != nil && t.Spec.Metadata != nil && t.Spec.Metadata.Name != "" {
+		return t.Spec.Metadata.Name
+	}
+	return t.Id
+}
+
+// Tickets returns the test's Metadata tickets (if any).
+func (t *Test) Tickets() []string {
+	if t.Spec == nil || t.Spec.Metadata == nil {
+		return nil
+	}
+	return t.Spec.Metadata.Tickets
+}
+
+// union appends the strings in more that aren't already in have.
+func union(have, more []string) []string {
+	for _, s := range more {
+		found := false
+		for _, h := range have {
+			if h == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			have = append(have, s)
+		}
+	}
+	return have
+}
@@ -19,6 +19,7 @@ package dsl
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -26,15 +27,46 @@ import (
 
 func init() {
 	TheChanRegistry.Register(NewCtx(nil), "mock", NewMockChan)
+	TheChanDocs.Register("mock", "An in-memory channel that receives the messages published to it.", MockOpts{})
+}
+
+// MockOpts configures a MockChan.
+type MockOpts struct {
+	// BufferSize is the capacity of the channel's Buffer.
+	BufferSize int `json:",omitempty" yaml:",omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the Buffer's overflow policy.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
 }
 
 type MockChan struct {
-	c chan Msg
+	c   chan Msg
+	buf *Buffer
+
+	// events, when true, makes this channel simulate connection
+	// events.  See EnableConnectionEvents.
+	events bool
+	opened bool
+
+	// killed, when true, makes this channel unhealthy until the
+	// next Open.  See Healthy.
+	killed bool
 }
 
-func NewMockChan(ctx *Ctx, _ interface{}) (Chan, error) {
+func NewMockChan(ctx *Ctx, cfg interface{}) (Chan, error) {
+	var opts MockOpts
+	if cfg != nil {
+		if err := As(cfg, &opts); err != nil {
+			return nil, err
+		}
+	}
+	buf, err := NewBuffer("mock", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
 	return &MockChan{
-		c: make(chan Msg, 1024),
+		c:   buf.C,
+		buf: buf,
 	}, nil
 }
 
@@ -43,9 +75,26 @@ func (c *MockChan) Kind() ChanKind {
 }
 
 func (c *MockChan) Open(ctx *Ctx) error {
+	event := ConnectionConnected
+	if c.opened {
+		event = ConnectionReconnected
+	}
+	c.opened = true
+	c.killed = false
+	if c.events {
+		return EmitConnectionEvent(ctx, c, event, "")
+	}
 	return nil
 }
 
+// EnableConnectionEvents makes this channel simulate connection
+// events: The first Open reports connected, Kill reports
+// disconnected, and subsequent Opens (via a Reconnect step) report
+// reconnected.
+func (c *MockChan) EnableConnectionEvents(ctx *Ctx) {
+	c.events = true
+}
+
 func (c *MockChan) Close(ctx *Ctx) error {
 	return nil
 }
@@ -66,21 +115,36 @@ func (c *MockChan) Recv(ctx *Ctx) chan Msg {
 	return c.c
 }
 
+// Kill is only supported when connection events are enabled (see
+// EnableConnectionEvents).
 func (c *MockChan) Kill(ctx *Ctx) error {
-	return Brokenf("Kill is not supported by a %T", c)
+	if !c.events {
+		return Brokenf("Kill is not supported by a %T", c)
+	}
+	c.killed = true
+	return EmitConnectionEvent(ctx, c, ConnectionDisconnected, "killed")
+}
+
+// Healthy reports an error after a Kill until the next Open.  See
+// HealthChecker.
+func (c *MockChan) Healthy(ctx *Ctx) error {
+	if c.killed {
+		return fmt.Errorf("killed")
+	}
+	return nil
 }
 
 func (c *MockChan) To(ctx *Ctx, m Msg) error {
 	ctx.Logf("MockChan To topic %s", m.Topic)
 	ctx.Logdf("            payload %s", JSON(m.Payload))
 	m.ReceivedAt = time.Now().UTC()
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
-	default:
-		panic("Warning: MockChan channel full")
-	}
-	return nil
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of the channel's Buffer.  See
+// Overflower.
+func (c *MockChan) Overflow() error {
+	return c.buf.Overflow()
 }
 
 // Read is a utility function to read input for a MockChan.
@@ -110,6 +174,4 @@ func (c *MockChan) Read(ctx *Ctx, in *bufio.Reader) error {
 			return err
 		}
 	}
-
-	return nil
 }
@@ -37,14 +37,17 @@ func TestMock(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	errs := make(chan error, 1)
 	go func() {
 		m := c.(*MockChan)
 		in := bufio.NewReader(strings.NewReader("topic payload"))
-		if err = m.Read(ctx, in); err != nil {
-			t.Fatal(err)
-		}
+		errs <- m.Read(ctx, in)
 	}()
 
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+
 	msg := <-c.Recv(ctx)
 	if msg.Topic != "topic" {
 		t.Fatal(msg.Topic)
@@ -46,6 +46,39 @@ type MotherMakeRequest struct {
 	//
 	// This value is usually deserialized from YAML.
 	Config interface{} `json:"config"`
+
+	// Profile optionally names a ChanProfile that gives the
+	// Type and a Config, over which this Config is merged.
+	Profile string `json:"profile,omitempty"`
+
+	// Canon optionally specifies normalization for messages that
+	// Recvs get from this channel.  A Recv's own Canon takes
+	// precedence.
+	Canon *CanonSpec `json:"canon,omitempty"`
+
+	// ConnectionEvents, when true, asks the channel to report
+	// its connection events (connected, disconnected, and
+	// reconnected) as messages on ConnectionEventsTopic.  The
+	// channel's type must support this feature.  See
+	// ConnectionEventer.
+	ConnectionEvents bool `json:"connectionEvents,omitempty" yaml:"connectionEvents,omitempty"`
+
+	// Reconnect optionally says how to reconnect the channel
+	// when it becomes unhealthy.  The channel's type must
+	// support this feature.  See HealthChecker.
+	Reconnect *ReconnectPolicy `json:"reconnect,omitempty"`
+
+	// Filter optionally admits only some of the channel's
+	// inbound messages.  See InboundFilter.
+	Filter *InboundFilter `json:"filter,omitempty"`
+
+	// Dedupe optionally discards the channel's duplicate inbound
+	// messages.  See Dedupe.
+	Dedupe *Dedupe `json:"dedupe,omitempty"`
+
+	// Topics optionally rewrites the channel's topics.  See
+	// TopicRules.
+	Topics *TopicRules `json:"topics,omitempty"`
 }
 
 // MotherResponse is the structure of the generic response to a
@@ -66,13 +99,19 @@ type MotherResponse struct {
 //
 // A Mother can make channels, and a Mother is itself a Channel.
 type Mother struct {
-	t *Test
-	c chan Msg
+	t   *Test
+	c   chan Msg
+	buf *Buffer
 }
 
 func NewMother(ctx *Ctx, _ interface{}) (*Mother, error) {
+	buf, err := NewBuffer("mother", 0, "")
+	if err != nil {
+		return nil, err
+	}
 	return &Mother{
-		c: make(chan Msg, 1024),
+		c:   buf.C,
+		buf: buf,
 	}, nil
 }
 
@@ -133,33 +172,97 @@ func (c *Mother) Pub(ctx *Ctx, m Msg) error {
 		return punt(fmt.Errorf("Only 'make' supported"))
 	}
 
-	if _, have := c.t.Chans[req.Make.Name]; have {
-		return punt(fmt.Errorf("Already have chan '%s'", req.Make.Name))
+	if err := c.t.makeChanFor(ctx, req.Make); err != nil {
+		return punt(err)
 	}
 
+	resp.Success = true
+	return punt(nil)
+}
+
+// makeChanFor makes, opens, and registers the requested channel.
+func (t *Test) makeChanFor(ctx *Ctx, req *MotherMakeRequest) error {
+	if _, have := t.Chans[req.Name]; have {
+		return fmt.Errorf("Already have chan '%s'", req.Name)
+	}
+
+	if err := req.Canon.Check(); err != nil {
+		return err
+	}
+
+	if err := t.addFilter(req.Name, req.Filter, req.Dedupe); err != nil {
+		return err
+	}
+
+	if err := t.addTopicRules(req.Name, req.Topics); err != nil {
+		return err
+	}
+
+	if err := t.applyProfile(ctx, req); err != nil {
+		return err
+	}
+
+	applyOverlay(ctx, req)
+
 	// Special cases
-	switch req.Make.Type {
+	switch req.Type {
 	case "cmd":
-		if m, is := req.Make.Config.(map[string]interface{}); is {
-			m["name"] = req.Make.Name
+		if m, is := req.Config.(map[string]interface{}); is {
+			m["name"] = req.Name
 		}
 	}
 
-	log.Printf("debug Make.Type %v", req.Make.Type)
-	ch, err := c.t.makeChan(ctx, req.Make.Type, req.Make.Config)
+	log.Printf("debug Make.Type %v", req.Type)
+	ch, err := t.makeChan(ctx, req.Type, req.Config)
 	if err != nil {
-		return punt(err)
+		return err
 	}
 	log.Printf("debug made %v", ch)
 
+	if req.ConnectionEvents {
+		ce, is := ch.(ConnectionEventer)
+		if !is {
+			return fmt.Errorf("%s channels don't report connection events", req.Type)
+		}
+		ce.EnableConnectionEvents(ctx)
+	}
+
+	if req.Reconnect != nil {
+		if _, is := ch.(HealthChecker); !is {
+			return fmt.Errorf("%s channels don't report their health", req.Type)
+		}
+		if err := req.Reconnect.parse(); err != nil {
+			return err
+		}
+	}
+
+	if t.recorder != nil {
+		ch = t.recorder.Wrap(req.Name, ch)
+	}
+
 	if err := ch.Open(ctx); err != nil {
-		return punt(err)
+		// Release whatever the failed Open acquired.
+		if cerr := safeClose(ctx, req.Name, ch); cerr != nil {
+			ctx.Warnf("warning: closing channel %s after failed open: %s", req.Name, cerr)
+		}
+		return err
 	}
 
-	resp.Success = true
-	c.t.Chans[req.Make.Name] = ch
+	t.Chans[req.Name] = ch
+	if req.Canon != nil {
+		if t.canons == nil {
+			t.canons = make(map[string]*CanonSpec)
+		}
+		t.canons[req.Name] = req.Canon
+	}
+	if req.Reconnect != nil {
+		if t.reconnects == nil {
+			t.reconnects = make(map[string]*ReconnectPolicy)
+		}
+		t.reconnects[req.Name] = req.Reconnect
+	}
 
-	return punt(nil)
+	return nil
 }
 
 func (c *Mother) Recv(ctx *Ctx) chan Msg {
@@ -174,11 +277,10 @@ func (c *Mother) Kill(ctx *Ctx) error {
 func (c *Mother) To(ctx *Ctx, m Msg) error {
 	ctx.Logf("Mother To %s", JSON(m.Payload))
 	m.ReceivedAt = time.Now().UTC()
-	select {
-	case <-ctx.Done():
-	case c.c <- m:
-	default:
-		panic("Warning: Mother channel full")
-	}
-	return nil
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of Mother's Buffer.  See Overflower.
+func (c *Mother) Overflow() error {
+	return c.buf.Overflow()
 }
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ChanPolicyAll requires every one of a Recv's Chans to
+	// satisfy the Recv.
+	ChanPolicyAll = "all"
+
+	// ChanPolicyAny requires just one of a Recv's Chans to
+	// satisfy the Recv.
+	ChanPolicyAny = "any"
+)
+
+// AnyChanInterval is how long a Recv with ChanPolicyAny waits on
+// one of its channels before trying the next one.
+var AnyChanInterval = 100 * time.Millisecond
+
+// chanNames expands a list of channel names and globs (see
+// path.Match) over the test's channels.
+//
+// Each element is subject to bindings substitution.  A glob (like
+// "device*") matches the channels that exist when the step executes
+// except for mother.  A glob that doesn't match any channel is an
+// error.  The result doesn't have duplicates.
+func (t *Test) chanNames(ctx *Ctx, patterns []string) ([]string, error) {
+	have := make([]string, 0, len(t.Chans))
+	for name := range t.Chans {
+		if name != "mother" {
+			have = append(have, name)
+		}
+	}
+	sort.Strings(have)
+
+	var (
+		acc  = make([]string, 0, len(patterns))
+		seen = make(map[string]bool, len(patterns))
+		add  = func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				acc = append(acc, name)
+			}
+		}
+	)
+	for _, pattern := range patterns {
+		pattern, err := t.Bindings.StringSub(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+			continue
+		}
+		var matched bool
+		for _, name := range have {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, Brokenf("bad channel glob '%s': %w", pattern, err)
+			}
+			if ok {
+				matched = true
+				add(name)
+			}
+		}
+		if !matched {
+			return nil, Brokenf("no channels match '%s'", pattern)
+		}
+	}
+	return acc, nil
+}
+
+// fanOut calls f for each of the named channels (see chanNames) in
+// order or, without any patterns, just for the given channel.
+func (t *Test) fanOut(ctx *Ctx, name string, patterns []string, f func(name string) error) error {
+	if len(patterns) == 0 {
+		return f(name)
+	}
+	names, err := t.chanNames(ctx, patterns)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := f(name); err != nil {
+			return fmt.Errorf("chan %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// execRecvs executes the Recv on its Chans (if any) according to its
+// ChanPolicy.
+//
+// With ChanPolicyAll, the Recv executes on each channel in order, so
+// bindings from one channel's message apply to the next channel's
+// pattern, and each channel gets the whole Timeout.
+//
+// With ChanPolicyAny, the Recv waits on each channel in turn (for at
+// most AnyChanInterval) until one of them satisfies the Recv or the
+// Timeout passes.
+func (t *Test) execRecvs(ctx *Ctx, r *Recv) error {
+	if len(r.Chans) == 0 {
+		return t.execRecv(ctx, r)
+	}
+
+	timeout, err := t.Bindings.durationSub(ctx, "Recv Timeout", r.Timeout, r.timeout)
+	if err != nil {
+		return err
+	}
+
+	on := func(name string, timeout time.Duration) *Recv {
+		e := *r
+		e.Chan, e.Chans, e.Timeout, e.timeout = name, nil, timeout, ""
+		return &e
+	}
+
+	switch r.ChanPolicy {
+	case "", ChanPolicyAll:
+		return t.fanOut(ctx, "", r.Chans, func(name string) error {
+			return t.execRecv(ctx, on(name, timeout))
+		})
+	case ChanPolicyAny:
+	default:
+		return Brokenf("unknown Recv ChanPolicy '%s'", r.ChanPolicy)
+	}
+
+	names, err := t.chanNames(ctx, r.Chans)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return Brokenf("Recv has no Chans")
+	}
+
+	var deadline time.Time
+	if 0 < timeout {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		for _, name := range names {
+			wait := AnyChanInterval
+			if !deadline.IsZero() {
+				left := deadline.Sub(time.Now())
+				if left <= 0 {
+					return Categorize(CategoryTimeout,
+						fmt.Errorf("timeout after %s waiting for %s on any of %s",
+							timeout, JSON(r.Pattern), strings.Join(names, ", ")))
+				}
+				if left < wait {
+					wait = left
+				}
+			}
+			err := t.execRecv(ctx, on(name, wait))
+			if err == nil {
+				ctx.Indf("    Recv satisfied on %s", name)
+				return nil
+			}
+			if CategoryOf(err) != CategoryTimeout {
+				return fmt.Errorf("chan %s: %w", name, err)
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+		}
+	}
+}
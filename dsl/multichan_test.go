@@ -0,0 +1,74 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestChanNames(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", nil)
+	for _, name := range []string{"mother", "store-1", "store-2", "warehouse"} {
+		tst.Chans[name] = nil
+	}
+	tst.Bindings["?w"] = "warehouse"
+
+	got, err := tst.chanNames(ctx, []string{"store-*", "{?w}", "store-1", "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"store-1", "store-2", "warehouse", "other"}; !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+
+	if got, err = tst.chanNames(ctx, []string{"*"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"store-1", "store-2", "warehouse"}; !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+
+	if _, err = tst.chanNames(ctx, []string{"depot-*"}); err == nil {
+		t.Fatal("wanted an error")
+	}
+}
+
+func TestChanPolicyValidate(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", &Spec{
+		Phases: map[string]*Phase{
+			"phase1": {
+				Steps: []*Step{
+					{
+						Recv: &Recv{
+							Chan:       "a",
+							Chans:      []string{"b"},
+							ChanPolicy: "most",
+						},
+					},
+				},
+			},
+		},
+	})
+	if errs := tst.Validate(ctx); len(errs) < 2 {
+		t.Fatal(errs)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PackageManifest is the name of the file that describes a Package.
+var PackageManifest = "plax-package.yaml"
+
+// Package is a named, versioned collection of Javascript libraries
+// and fixtures that tests can share.
+//
+// A package is a directory with a manifest (see PackageManifest).
+// The manifest gives the package's name and version, the filenames
+// (relative to that directory) of its libraries, and its fixtures.
+//
+// A test uses packages by reference: "NAME@VERSION" or just "NAME".
+// A registry is a directory or an (HTTP or HTTPS) base URL.  A
+// package is at REGISTRY/NAME/VERSION, and, in a directory, a
+// reference without a version gets the highest version (or
+// REGISTRY/NAME if that has a manifest).  A reference to a package
+// in a remote registry needs a version.
+//
+// The registries are the "packages" directory in the test's
+// directory followed by Ctx.Registries.
+type Package struct {
+	Name    string
+	Version string `json:",omitempty" yaml:",omitempty"`
+	Doc     string `json:",omitempty" yaml:",omitempty"`
+
+	// Libraries are the filenames of Javascript libraries, which
+	// are loaded before the test's own Libraries.
+	Libraries []string `json:",omitempty" yaml:",omitempty"`
+
+	// Fixtures are available to the test as "NAME.FIXTURE".  See
+	// Spec.Fixtures.
+	Fixtures map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// src is the Javascript from the Libraries.
+	src string
+}
+
+// ParsePackageRef parses "NAME@VERSION" or "NAME".
+func ParsePackageRef(ref string) (name, version string, err error) {
+	parts := strings.SplitN(ref, "@", 2)
+	name = strings.TrimSpace(parts[0])
+	if 1 < len(parts) {
+		version = strings.TrimSpace(parts[1])
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(version, "..") || strings.ContainsAny(version, `/\`) {
+		return "", "", fmt.Errorf("bad package reference '%s'", ref)
+	}
+	return name, version, nil
+}
+
+// packageRegistries returns the registries for the test.
+func (t *Test) packageRegistries(ctx *Ctx) []string {
+	dir := t.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return append([]string{filepath.Join(dir, "packages")}, ctx.Registries...)
+}
+
+// ResolvePackage finds and loads the referenced package.
+func ResolvePackage(ctx *Ctx, registries []string, ref string) (*Package, error) {
+	name, version, err := ParsePackageRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range registries {
+		var (
+			p   *Package
+			err error
+		)
+		if isURL(r) {
+			if version == "" {
+				continue
+			}
+			p, err = loadPackage(ctx, strings.TrimSuffix(r, "/")+"/"+name+"/"+version, fetchURL)
+		} else {
+			var dir string
+			if dir, err = packageDir(r, name, version); err != nil {
+				return nil, err
+			}
+			if dir == "" {
+				continue
+			}
+			p, err = loadPackage(ctx, dir, readFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", ref, err)
+		}
+		if p == nil {
+			continue
+		}
+		if p.Name != name {
+			return nil, fmt.Errorf("package %s has name '%s'", ref, p.Name)
+		}
+		if version != "" && p.Version != version {
+			return nil, fmt.Errorf("package %s has version '%s'", ref, p.Version)
+		}
+		ctx.Indf("Package %s@%s from %s", p.Name, p.Version, r)
+		return p, nil
+	}
+	return nil, fmt.Errorf("can't find package %s", ref)
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// packageDir returns the directory (if any) for the package in the
+// registry directory.
+func packageDir(registry, name, version string) (string, error) {
+	base := filepath.Join(registry, name)
+	if version != "" {
+		return existingPackage(filepath.Join(base, version)), nil
+	}
+
+	// Without a version, use the highest one.
+	fs, err := ioutil.ReadDir(base)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	for _, f := range fs {
+		if !f.IsDir() || existingPackage(filepath.Join(base, f.Name())) == "" {
+			continue
+		}
+		if best == "" || compareVersions(best, f.Name()) < 0 {
+			best = f.Name()
+		}
+	}
+	if best != "" {
+		return filepath.Join(base, best), nil
+	}
+	return existingPackage(base), nil
+}
+
+// existingPackage returns the directory if it has a manifest.
+func existingPackage(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, PackageManifest)); err != nil {
+		return ""
+	}
+	return dir
+}
+
+// compareVersions compares dotted versions (like "1.10.2")
+// numerically where possible.
+func compareVersions(a, b string) int {
+	var (
+		as = strings.Split(strings.TrimPrefix(a, "v"), ".")
+		bs = strings.Split(strings.TrimPrefix(b, "v"), ".")
+	)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, errx := strconv.Atoi(as[i])
+		y, erry := strconv.Atoi(bs[i])
+		switch {
+		case errx == nil && erry == nil && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		case (errx != nil || erry != nil) && as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// reader gets the contents of a file or URL.
+type reader func(ctx *Ctx, location string) ([]byte, error)
+
+func readFile(ctx *Ctx, filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
+
+func fetchURL(ctx *Ctx, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// loadPackage reads the manifest and the libraries at the given
+// location.  The result is nil if there's no manifest.
+func loadPackage(ctx *Ctx, location string, read reader) (*Package, error) {
+	join := func(name string) string {
+		if isURL(location) {
+			return location + "/" + name
+		}
+		return filepath.Join(location, name)
+	}
+
+	bs, err := read(ctx, join(PackageManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p Package
+	if err := yaml.Unmarshal(bs, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", PackageManifest, err)
+	}
+
+	for _, filename := range p.Libraries {
+		if filepath.IsAbs(filename) || strings.Contains(filename, "..") {
+			return nil, fmt.Errorf("bad library filename '%s'", filename)
+		}
+		js, err := read(ctx, join(filename))
+		if err != nil {
+			return nil, fmt.Errorf("error reading library '%s': %w", filename, err)
+		}
+		p.src += fmt.Sprintf("// package: %s@%s library: %s\n\n", p.Name, p.Version, filename) +
+			string(js) + "\n"
+	}
+
+	return &p, nil
+}
+
+// loadPackages resolves the test's Packages (once) and adds their
+// fixtures to the Spec.
+func (t *Test) loadPackages(ctx *Ctx) error {
+	if t.packages != nil || len(t.Packages) == 0 {
+		return nil
+	}
+
+	var (
+		registries = t.packageRegistries(ctx)
+		ps         = make([]*Package, 0, len(t.Packages))
+	)
+	for _, ref := range t.Packages {
+		p, err := ResolvePackage(ctx, registries, ref)
+		if err != nil {
+			return NewBroken(err)
+		}
+		ps = append(ps, p)
+
+		if 0 < len(p.Fixtures) && t.Spec != nil {
+			if t.Spec.Fixtures == nil {
+				t.Spec.Fixtures = make(map[string]interface{}, len(p.Fixtures))
+			}
+			for name, x := range p.Fixtures {
+				t.Spec.Fixtures[p.Name+"."+name] = x
+			}
+		}
+	}
+	t.packages = ps
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePackage(t *testing.T, dir, name, version string) {
+	dir = filepath.Join(dir, name, version)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := "name: " + name + "\nversion: " + version + "\nlibraries: [lib.js]\nfixtures:\n  x: {\"v\":\"" + version + "\"}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, PackageManifest), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	js := "function version() { return \"" + version + "\"; }\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.js"), []byte(js), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	registry := filepath.Join(dir, "packages")
+	writePackage(t, registry, "helpers", "1.2.0")
+	writePackage(t, registry, "helpers", "1.10.0")
+	writePackage(t, registry, "helpers", "1.9.3")
+
+	ctx := NewCtx(nil)
+
+	t.Run("latest", func(t *testing.T) {
+		p, err := ResolvePackage(ctx, []string{registry}, "helpers")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != "1.10.0" {
+			t.Fatal(p.Version)
+		}
+	})
+
+	t.Run("test", func(t *testing.T) {
+		tst := NewTest(ctx, "", NewSpec())
+		tst.Dir = dir
+		tst.Packages = []string{"helpers@1.9.3"}
+		if err := tst.Init(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, have := tst.Spec.Fixtures["helpers.x"]; !have {
+			t.Fatal(tst.Spec.Fixtures)
+		}
+		x, err := tst.JSExec(ctx, `version()`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x != "1.9.3" {
+			t.Fatal(x)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		for _, ref := range []string{"helpers@2.0.0", "nope", "../helpers", "helpers@../1", ""} {
+			if _, err := ResolvePackage(ctx, []string{registry}, ref); err == nil {
+				t.Fatal(ref)
+			}
+		}
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		s := httptest.NewServer(http.FileServer(http.Dir(registry)))
+		defer s.Close()
+
+		p, err := ResolvePackage(ctx, []string{s.URL}, "helpers@1.2.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(p.src, `return "1.2.0"`) {
+			t.Fatal(p.src)
+		}
+
+		// A remote registry needs a version.
+		if _, err = ResolvePackage(ctx, []string{s.URL}, "helpers"); err == nil {
+			t.Fatal("should have failed")
+		}
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.10.0", -1},
+		{"1.10.0", "1.9", 1},
+		{"v2", "2", 0},
+		{"1.0", "1.0.1", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+	} {
+		got := compareVersions(c.a, c.b)
+		if (got < 0) != (c.want < 0) || (got > 0) != (c.want > 0) {
+			t.Fatalf("%s vs %s: %d", c.a, c.b, got)
+		}
+	}
+}
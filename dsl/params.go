@@ -0,0 +1,146 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Param declares a binding that a test expects.
+type Param struct {
+	// Doc is an optional documentation string.
+	Doc string `json:",omitempty" yaml:",omitempty"`
+
+	// Type, if not empty, is the required type of the binding's
+	// value: "string", "number", "integer", "boolean", "object",
+	// "array", or "duration" (a string in Go syntax).  The aliases
+	// "int" and "bool" also work.  The type also applies to
+	// later bindings of the variable.  See Test.checkTypes.
+	Type string `json:",omitempty" yaml:",omitempty"`
+
+	// Default, if not nil, is the value for the binding when the
+	// binding is missing.
+	Default interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Required means the binding must be present (unless there
+	// is a Default).
+	Required bool `json:",omitempty" yaml:",omitempty"`
+}
+
+// ParamTypes are the legal values for Param.Type.
+var ParamTypes = []string{"string", "number", "integer", "boolean", "object", "array", "duration"}
+
+// validType reports whether the Param's Type is legal.
+func (p *Param) validType() bool {
+	return p.Type == "" || validType(p.Type)
+}
+
+// hasType reports whether the given value has the Param's Type.
+func (p *Param) hasType(x interface{}) bool {
+	switch canonicalType(p.Type) {
+	case "":
+		return true
+	case "string":
+		_, is := x.(string)
+		return is
+	case "number":
+		switch x.(type) {
+		case float64, float32, int, int64, int32:
+			return true
+		}
+	case "integer":
+		switch vv := x.(type) {
+		case int, int64, int32:
+			return true
+		case float64:
+			return vv == math.Trunc(vv)
+		}
+	case "boolean":
+		_, is := x.(bool)
+		return is
+	case "object":
+		_, is := x.(map[string]interface{})
+		return is
+	case "array":
+		_, is := x.([]interface{})
+		return is
+	case "duration":
+		s, is := x.(string)
+		if !is {
+			return false
+		}
+		_, err := time.ParseDuration(s)
+		return err == nil
+	}
+	return false
+}
+
+// CheckParams checks the given bindings against the Spec's Params.
+//
+// A missing binding with a Default gets that Default.  A missing
+// Required binding or a binding with the wrong Type results in a
+// Broken error that reports all such problems.
+func (s *Spec) CheckParams(ctx *Ctx, bs Bindings) error {
+	if s == nil || len(s.Params) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(s.Params))
+	for name := range s.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, 0, len(names))
+	for _, name := range names {
+		p := s.Params[name]
+		if p == nil {
+			continue
+		}
+		x, have := bs[name]
+		if !have {
+			if p.Default != nil {
+				ctx.Logdf("Param %s defaulting to %s", name, JSON(p.Default))
+				bs[name] = p.Default
+				continue
+			}
+			if p.Required {
+				problem := fmt.Sprintf("required param '%s' is missing", name)
+				if p.Doc != "" {
+					problem += fmt.Sprintf(" (%s)", strings.TrimSpace(p.Doc))
+				}
+				problems = append(problems, problem)
+			}
+			continue
+		}
+		if !p.hasType(x) {
+			problems = append(problems,
+				fmt.Sprintf("param '%s' should be a %s but is %s", name, p.Type, JSON(x)))
+		}
+	}
+
+	if 0 < len(problems) {
+		return Brokenf("bad params: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckParams(t *testing.T) {
+	ctx := NewCtx(nil)
+
+	s := &Spec{
+		Params: map[string]*Param{
+			"?n": {
+				Type:     "integer",
+				Required: true,
+			},
+			"?who": {
+				Type:    "string",
+				Default: "homer",
+			},
+			"?opt": {
+				Type: "boolean",
+			},
+		},
+	}
+
+	t.Run("happy", func(t *testing.T) {
+		bs := Bindings{"?n": float64(3)}
+		if err := s.CheckParams(ctx, bs); err != nil {
+			t.Fatal(err)
+		}
+		if bs["?who"] != "homer" {
+			t.Fatal(bs["?who"])
+		}
+		if _, have := bs["?opt"]; have {
+			t.Fatal("?opt shouldn't be bound")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		err := s.CheckParams(ctx, Bindings{})
+		if _, is := IsBroken(err); !is {
+			t.Fatal(err)
+		}
+		if !strings.Contains(err.Error(), "?n") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("type", func(t *testing.T) {
+		err := s.CheckParams(ctx, Bindings{"?n": 3.5, "?opt": "yes"})
+		if _, is := IsBroken(err); !is {
+			t.Fatal(err)
+		}
+		if !strings.Contains(err.Error(), "?opt") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		tst := NewTest(ctx, "params", &Spec{
+			Params: map[string]*Param{
+				"?x": {
+					Type: "tacos",
+				},
+			},
+		})
+		if errs := tst.Validate(ctx); len(errs) != 1 {
+			t.Fatal(errs)
+		}
+	})
+}
@@ -0,0 +1,783 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/snappy"
+)
+
+// parquetDecoder reads the rows of a Parquet file as objects whose
+// properties are the columns.
+//
+// The decoder handles flat schemas (columns that are optional or
+// required primitives), v1 and v2 data pages, the PLAIN and
+// dictionary encodings, and uncompressed, Snappy, and gzip pages.
+// Values with logical types for strings, dates, timestamps, and
+// decimals become strings, strings, RFC 3339 strings, and numbers.
+// Other byte arrays that aren't UTF-8 become base64 strings.
+type parquetDecoder struct {
+	f       *os.File
+	size    int64
+	columns []*parquetColumn
+	groups  []thriftStruct
+
+	// group is the index of the next row group, and rows holds
+	// the current row group's values by column.
+	group int
+	rows  [][]interface{}
+	row   int
+}
+
+// parquetColumn is a column of a flat schema.
+type parquetColumn struct {
+	name     string
+	typ      int64
+	length   int64
+	optional bool
+
+	converted int64
+	logical   thriftStruct
+	scale     int64
+}
+
+// Parquet physical types.
+const (
+	parquetBoolean = iota
+	parquetInt32
+	parquetInt64
+	parquetInt96
+	parquetFloat
+	parquetDouble
+	parquetByteArray
+	parquetFixedLenByteArray
+)
+
+// Parquet converted types (that the decoder uses).
+const (
+	parquetUTF8            = 0
+	parquetEnum            = 4
+	parquetDecimal         = 5
+	parquetDate            = 6
+	parquetTimestampMillis = 9
+	parquetTimestampMicros = 10
+	parquetJSON            = 19
+)
+
+// Parquet page types, encodings, and codecs.
+const (
+	parquetDataPage       = 0
+	parquetDictionaryPage = 2
+	parquetDataPageV2     = 3
+
+	parquetPlain           = 0
+	parquetPlainDictionary = 2
+	parquetRLE             = 3
+	parquetRLEDictionary   = 8
+
+	parquetUncompressed = 0
+	parquetSnappy       = 1
+	parquetGzip         = 2
+)
+
+func newParquetDecoder(f *os.File) (DatasetDecoder, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < 12 {
+		return nil, fmt.Errorf("not a Parquet file (too small)")
+	}
+
+	tail := make([]byte, 8)
+	if _, err = f.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != "PAR1" {
+		return nil, fmt.Errorf("not a Parquet file (no PAR1 trailer)")
+	}
+	n := int64(binary.LittleEndian.Uint32(tail))
+	if size-8 < n+4 {
+		return nil, fmt.Errorf("bad Parquet footer length %d", n)
+	}
+	footer := make([]byte, n)
+	if _, err = f.ReadAt(footer, size-8-n); err != nil {
+		return nil, err
+	}
+	r := &thriftReader{bs: footer}
+	meta := r.readStruct()
+	if r.err != nil {
+		return nil, fmt.Errorf("Parquet footer: %w", r.err)
+	}
+
+	d := &parquetDecoder{
+		f:      f,
+		size:   size,
+		groups: meta.structs(4),
+	}
+
+	schema := meta.structs(2)
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("Parquet file has no schema")
+	}
+	for _, e := range schema[1:] {
+		name := e.str(4)
+		if 0 < e.int(5) {
+			return nil, fmt.Errorf("Parquet column '%s' is a group (only flat schemas are supported)", name)
+		}
+		rep := e.int(3)
+		if rep == 2 {
+			return nil, fmt.Errorf("Parquet column '%s' is repeated (only flat schemas are supported)", name)
+		}
+		converted, have := e[6].(int64)
+		if !have {
+			converted = -1
+		}
+		logical, _ := e[10].(thriftStruct)
+		d.columns = append(d.columns, &parquetColumn{
+			name:      name,
+			typ:       e.int(1),
+			length:    e.int(2),
+			optional:  rep == 1,
+			converted: converted,
+			logical:   logical,
+			scale:     e.int(7),
+		})
+	}
+	if int64(len(d.columns)) != schema[0].int(5) {
+		return nil, fmt.Errorf("Parquet schema root has %d children, but there are %d columns (only flat schemas are supported)",
+			schema[0].int(5), len(d.columns))
+	}
+
+	return d, nil
+}
+
+func (d *parquetDecoder) Next() (interface{}, error) {
+	for len(d.rows) == 0 || len(d.rows[0]) <= d.row {
+		if len(d.groups) <= d.group {
+			return nil, io.EOF
+		}
+		if err := d.readGroup(d.groups[d.group]); err != nil {
+			return nil, fmt.Errorf("Parquet row group %d: %w", d.group, err)
+		}
+		d.group++
+		d.row = 0
+		if len(d.columns) == 0 {
+			return nil, io.EOF
+		}
+	}
+
+	obj := make(map[string]interface{}, len(d.columns))
+	for i, c := range d.columns {
+		obj[c.name] = d.rows[i][d.row]
+	}
+	d.row++
+	return obj, nil
+}
+
+// readGroup reads all of the row group's values.
+func (d *parquetDecoder) readGroup(g thriftStruct) error {
+	var (
+		chunks = g.structs(1)
+		rows   = g.int(3)
+	)
+	if len(chunks) != len(d.columns) {
+		return fmt.Errorf("%d column chunks for %d columns", len(chunks), len(d.columns))
+	}
+	d.rows = make([][]interface{}, len(d.columns))
+	for i, c := range d.columns {
+		vs, err := d.readChunk(c, chunks[i])
+		if err != nil {
+			return fmt.Errorf("column '%s': %w", c.name, err)
+		}
+		if int64(len(vs)) != rows {
+			return fmt.Errorf("column '%s' has %d values for %d rows", c.name, len(vs), rows)
+		}
+		d.rows[i] = vs
+	}
+	return nil
+}
+
+// readChunk reads the column chunk's values.
+func (d *parquetDecoder) readChunk(c *parquetColumn, chunk thriftStruct) ([]interface{}, error) {
+	meta, have := chunk[3].(thriftStruct)
+	if !have {
+		return nil, fmt.Errorf("no column metadata")
+	}
+	if p := chunk.str(1); p != "" {
+		return nil, fmt.Errorf("column data in another file (%s) isn't supported", p)
+	}
+
+	var (
+		codec  = meta.int(4)
+		count  = meta.int(5)
+		start  = meta.int(9)
+		length = meta.int(7)
+	)
+	if dict, have := meta[11].(int64); have && 0 < dict && dict < start {
+		start = dict
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("bad value count %d", count)
+	}
+	if start < 0 || length < 0 || d.size-start < length {
+		return nil, fmt.Errorf("column chunk (%d bytes at %d) isn't in the file", length, start)
+	}
+	bs := make([]byte, length)
+	if _, err := d.f.ReadAt(bs, start); err != nil {
+		return nil, err
+	}
+
+	var (
+		acc  []interface{}
+		dict []interface{}
+		r    = &thriftReader{bs: bs}
+	)
+	for int64(len(acc)) < count {
+		h := r.readStruct()
+		if r.err != nil {
+			return nil, fmt.Errorf("page header: %w", r.err)
+		}
+		size := int(h.int(3))
+		if size < 0 || len(bs) < r.i+size {
+			return nil, fmt.Errorf("page extends past the column chunk")
+		}
+		page := bs[r.i : r.i+size]
+		r.i += size
+
+		switch h.int(1) {
+		case parquetDictionaryPage:
+			dh, _ := h[7].(thriftStruct)
+			data, err := parquetDecompress(codec, page, int(h.int(2)))
+			if err != nil {
+				return nil, err
+			}
+			if dict, _, err = c.plain(data, int(dh.int(1))); err != nil {
+				return nil, fmt.Errorf("dictionary page: %w", err)
+			}
+		case parquetDataPage:
+			dh, _ := h[5].(thriftStruct)
+			data, err := parquetDecompress(codec, page, int(h.int(2)))
+			if err != nil {
+				return nil, err
+			}
+			n := int(dh.int(1))
+			var defs []int
+			if c.optional {
+				if len(data) < 4 {
+					return nil, fmt.Errorf("data page too short")
+				}
+				m := int(binary.LittleEndian.Uint32(data))
+				if len(data) < 4+m {
+					return nil, fmt.Errorf("definition levels extend past the page")
+				}
+				if defs, err = rleHybrid(data[4:4+m], 1, n); err != nil {
+					return nil, fmt.Errorf("definition levels: %w", err)
+				}
+				data = data[4+m:]
+			}
+			vs, err := c.values(data, dh.int(2), n, defs, dict)
+			if err != nil {
+				return nil, err
+			}
+			acc = append(acc, vs...)
+		case parquetDataPageV2:
+			dh, _ := h[8].(thriftStruct)
+			var (
+				n        = int(dh.int(1))
+				defLen   = int(dh.int(5))
+				repLen   = int(dh.int(6))
+				defs     []int
+				data     = page
+				err      error
+				compress = true
+			)
+			if b, have := dh[7].(bool); have {
+				compress = b
+			}
+			if defLen < 0 || repLen < 0 || len(data)-repLen < defLen {
+				return nil, fmt.Errorf("levels extend past the page")
+			}
+			if c.optional {
+				if defs, err = rleHybrid(data[repLen:repLen+defLen], 1, n); err != nil {
+					return nil, fmt.Errorf("definition levels: %w", err)
+				}
+			}
+			data = data[repLen+defLen:]
+			if compress {
+				if data, err = parquetDecompress(codec, data, int(h.int(2))-repLen-defLen); err != nil {
+					return nil, err
+				}
+			}
+			vs, err := c.values(data, dh.int(4), n, defs, dict)
+			if err != nil {
+				return nil, err
+			}
+			acc = append(acc, vs...)
+		default:
+			// Index pages (and anything else) aren't needed.
+		}
+	}
+	return acc, nil
+}
+
+// values decodes a data page's n values, which are nulls where the
+// definition levels (if any) are zero.
+func (c *parquetColumn) values(data []byte, encoding int64, n int, defs []int, dict []interface{}) ([]interface{}, error) {
+	present := n
+	if defs != nil {
+		present = 0
+		for _, def := range defs {
+			present += def
+		}
+	}
+
+	var (
+		vs  []interface{}
+		err error
+	)
+	switch encoding {
+	case parquetPlain:
+		vs, _, err = c.plain(data, present)
+	case parquetPlainDictionary, parquetRLEDictionary:
+		if dict == nil {
+			return nil, fmt.Errorf("dictionary encoding without a dictionary page")
+		}
+		if len(data) < 1 {
+			return nil, fmt.Errorf("no dictionary index bit width")
+		}
+		var is []int
+		if is, err = rleHybrid(data[1:], int(data[0]), present); err != nil {
+			return nil, fmt.Errorf("dictionary indexes: %w", err)
+		}
+		vs = make([]interface{}, present)
+		for j, i := range is {
+			if i < 0 || len(dict) <= i {
+				return nil, fmt.Errorf("dictionary index %d out of range", i)
+			}
+			vs[j] = dict[i]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %d", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if defs == nil {
+		return vs, nil
+	}
+	acc := make([]interface{}, n)
+	j := 0
+	for i, def := range defs {
+		if def != 0 {
+			acc[i] = vs[j]
+			j++
+		}
+	}
+	return acc, nil
+}
+
+// plain decodes n PLAIN values and returns them along with the
+// number of bytes they used.
+func (c *parquetColumn) plain(data []byte, n int) ([]interface{}, int, error) {
+	if n < 0 {
+		return nil, 0, fmt.Errorf("bad value count %d", n)
+	}
+	var (
+		acc = make([]interface{}, 0, n)
+		i   = 0
+	)
+	need := func(k int) error {
+		if len(data) < i+k {
+			return fmt.Errorf("%d values extend past the page", n)
+		}
+		return nil
+	}
+	for j := 0; j < n; j++ {
+		var x interface{}
+		switch c.typ {
+		case parquetBoolean:
+			if len(data) <= j/8 {
+				return nil, 0, fmt.Errorf("%d values extend past the page", n)
+			}
+			x = data[j/8]&(1<<uint(j%8)) != 0
+			i = j/8 + 1
+		case parquetInt32:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			x = c.int(int64(int32(binary.LittleEndian.Uint32(data[i:]))))
+			i += 4
+		case parquetInt64:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			x = c.int(int64(binary.LittleEndian.Uint64(data[i:])))
+			i += 8
+		case parquetInt96:
+			if err := need(12); err != nil {
+				return nil, 0, err
+			}
+			var (
+				nanos = int64(binary.LittleEndian.Uint64(data[i:]))
+				day   = int64(binary.LittleEndian.Uint32(data[i+8:]))
+			)
+			// Julian day 2440588 is 1970-01-01.
+			t := time.Unix((day-2440588)*86400, nanos).UTC()
+			x = t.Format(time.RFC3339Nano)
+			i += 12
+		case parquetFloat:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			x = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i:])))
+			i += 4
+		case parquetDouble:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			x = math.Float64frombits(binary.LittleEndian.Uint64(data[i:]))
+			i += 8
+		case parquetByteArray:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			k := int(binary.LittleEndian.Uint32(data[i:]))
+			i += 4
+			if err := need(k); err != nil {
+				return nil, 0, err
+			}
+			x = c.bytes(data[i : i+k])
+			i += k
+		case parquetFixedLenByteArray:
+			k := int(c.length)
+			if err := need(k); err != nil {
+				return nil, 0, err
+			}
+			x = c.bytes(data[i : i+k])
+			i += k
+		default:
+			return nil, 0, fmt.Errorf("unsupported type %d", c.typ)
+		}
+		acc = append(acc, x)
+	}
+	return acc, i, nil
+}
+
+// int returns the value of an integer according to the column's
+// logical type.
+func (c *parquetColumn) int(n int64) interface{} {
+	if ts, have := c.logical[8].(thriftStruct); have {
+		unit, _ := ts[2].(thriftStruct)
+		switch {
+		case unit[1] != nil:
+			return parquetTime(n * int64(time.Millisecond))
+		case unit[2] != nil:
+			return parquetTime(n * int64(time.Microsecond))
+		case unit[3] != nil:
+			return parquetTime(n)
+		}
+	}
+	switch {
+	case c.converted == parquetDate || c.logical[6] != nil:
+		return time.Unix(n*86400, 0).UTC().Format("2006-01-02")
+	case c.converted == parquetTimestampMillis:
+		return parquetTime(n * int64(time.Millisecond))
+	case c.converted == parquetTimestampMicros:
+		return parquetTime(n * int64(time.Microsecond))
+	case c.converted == parquetDecimal || c.logical[5] != nil:
+		return float64(n) / math.Pow10(int(c.scale))
+	}
+	return float64(n)
+}
+
+// bytes returns the value of a byte array according to the column's
+// logical type.
+func (c *parquetColumn) bytes(bs []byte) interface{} {
+	if c.converted == parquetDecimal || c.logical[5] != nil {
+		n := new(big.Int).SetBytes(bs)
+		if 0 < len(bs) && bs[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(bs))))
+		}
+		f, _ := new(big.Float).Quo(new(big.Float).SetInt(n),
+			new(big.Float).SetFloat64(math.Pow10(int(c.scale)))).Float64()
+		return f
+	}
+	if c.converted == parquetJSON || c.logical[12] != nil {
+		return csvValue(string(bs))
+	}
+	if utf8.Valid(bs) {
+		return string(bs)
+	}
+	return base64.StdEncoding.EncodeToString(bs)
+}
+
+// parquetTime formats nanoseconds since the epoch.
+func parquetTime(nanos int64) string {
+	return time.Unix(0, nanos).UTC().Format(time.RFC3339Nano)
+}
+
+// parquetDecompress decompresses a page.
+func parquetDecompress(codec int64, bs []byte, size int) ([]byte, error) {
+	switch codec {
+	case parquetUncompressed:
+		return bs, nil
+	case parquetSnappy:
+		if size < 0 {
+			size = 0
+		}
+		return snappy.Decode(make([]byte, 0, size), bs)
+	case parquetGzip:
+		z, err := gzip.NewReader(bytes.NewReader(bs))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(z)
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", codec)
+	}
+}
+
+// rleHybrid decodes n values with the given bit width from the
+// RLE/bit-packing hybrid encoding.
+func rleHybrid(bs []byte, width int, n int) ([]int, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("bad value count %d", n)
+	}
+	var (
+		acc = make([]int, 0, n)
+		i   = 0
+	)
+	for len(acc) < n {
+		h, k := binary.Uvarint(bs[i:])
+		if k <= 0 {
+			return nil, fmt.Errorf("bad run header")
+		}
+		i += k
+		if h&1 == 0 {
+			// A run of one value.
+			count := int(h >> 1)
+			size := (width + 7) / 8
+			if len(bs) < i+size {
+				return nil, fmt.Errorf("run extends past the data")
+			}
+			v := 0
+			for b := 0; b < size; b++ {
+				v |= int(bs[i+b]) << (8 * b)
+			}
+			i += size
+			for j := 0; j < count && len(acc) < n; j++ {
+				acc = append(acc, v)
+			}
+			continue
+		}
+		// Groups of eight bit-packed values.
+		groups := int(h >> 1)
+		if groups < 0 || 0 < width && (len(bs)-i)/width < groups {
+			return nil, fmt.Errorf("bit-packed run extends past the data")
+		}
+		count := groups * 8
+		size := groups * width
+		if len(bs) < i+size {
+			return nil, fmt.Errorf("bit-packed run extends past the data")
+		}
+		for j := 0; j < count && len(acc) < n; j++ {
+			v := 0
+			for b := 0; b < width; b++ {
+				bit := j*width + b
+				if bs[i+bit/8]&(1<<uint(bit%8)) != 0 {
+					v |= 1 << b
+				}
+			}
+			acc = append(acc, v)
+		}
+		i += size
+	}
+	return acc, nil
+}
+
+// thriftStruct is a Thrift struct (decoded with the compact
+// protocol) that maps field ids to values: bools, int64s,
+// float64s, []bytes, []interface{}s, and thriftStructs.
+type thriftStruct map[int16]interface{}
+
+func (s thriftStruct) int(id int16) int64 {
+	n, _ := s[id].(int64)
+	return n
+}
+
+func (s thriftStruct) str(id int16) string {
+	bs, _ := s[id].([]byte)
+	return string(bs)
+}
+
+func (s thriftStruct) structs(id int16) []thriftStruct {
+	xs, _ := s[id].([]interface{})
+	acc := make([]thriftStruct, 0, len(xs))
+	for _, x := range xs {
+		if t, is := x.(thriftStruct); is {
+			acc = append(acc, t)
+		}
+	}
+	return acc
+}
+
+// thriftReader decodes the Thrift compact protocol.  The first error
+// sticks.
+type thriftReader struct {
+	bs  []byte
+	i   int
+	err error
+}
+
+func (r *thriftReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (r *thriftReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.bs) <= r.i {
+		r.fail("Thrift data truncated")
+		return 0
+	}
+	b := r.bs[r.i]
+	r.i++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(r.bs[r.i:])
+	if n <= 0 {
+		r.fail("bad Thrift varint at %d", r.i)
+		return 0
+	}
+	r.i += n
+	return x
+}
+
+func (r *thriftReader) varint() int64 {
+	x := r.uvarint()
+	return int64(x>>1) ^ -int64(x&1)
+}
+
+func (r *thriftReader) readStruct() thriftStruct {
+	acc := make(thriftStruct)
+	var id int16
+	for r.err == nil {
+		h := r.byte()
+		typ := h & 0x0f
+		if typ == 0 {
+			break
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		switch typ {
+		case 1:
+			acc[id] = true
+		case 2:
+			acc[id] = false
+		default:
+			acc[id] = r.value(typ)
+		}
+	}
+	return acc
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		// A bool in a list or map.
+		return r.byte() == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		if len(r.bs) < r.i+8 {
+			r.fail("Thrift data truncated")
+			return nil
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(r.bs[r.i:]))
+		r.i += 8
+		return f
+	case 8:
+		n := int(r.uvarint())
+		if n < 0 || len(r.bs)-r.i < n {
+			r.fail("Thrift data truncated")
+			return nil
+		}
+		bs := r.bs[r.i : r.i+n]
+		r.i += n
+		return bs
+	case 9, 10:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		if n < 0 || len(r.bs)-r.i < n {
+			r.fail("Thrift list truncated")
+			return nil
+		}
+		acc := make([]interface{}, 0, n)
+		for j := 0; j < n && r.err == nil; j++ {
+			acc = append(acc, r.value(h&0x0f))
+		}
+		return acc
+	case 11:
+		n := int(r.uvarint())
+		if n == 0 {
+			return nil
+		}
+		kv := r.byte()
+		for j := 0; j < n && r.err == nil; j++ {
+			r.value(kv >> 4)
+			r.value(kv & 0x0f)
+		}
+		return nil
+	case 12:
+		return r.readStruct()
+	}
+	r.fail("unknown Thrift type %d", typ)
+	return nil
+}
@@ -0,0 +1,579 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// tfield is a Thrift struct field for thriftWrite.
+type tfield struct {
+	id int16
+	v  interface{}
+}
+
+// tstruct is a Thrift struct for thriftWrite.
+type tstruct []tfield
+
+// thriftType returns the compact protocol type of a value.
+func thriftType(v interface{}) byte {
+	switch vv := v.(type) {
+	case bool:
+		if vv {
+			return 1
+		}
+		return 2
+	case int32:
+		return 5
+	case int64:
+		return 6
+	case string:
+		return 8
+	case []interface{}:
+		return 9
+	case tstruct:
+		return 12
+	}
+	panic(v)
+}
+
+// thriftWrite writes the value with the Thrift compact protocol.
+func thriftWrite(w *bytes.Buffer, v interface{}) {
+	varint := func(x int64) {
+		var bs [binary.MaxVarintLen64]byte
+		w.Write(bs[:binary.PutUvarint(bs[:], uint64((x<<1)^(x>>63)))])
+	}
+	switch vv := v.(type) {
+	case bool:
+		if vv {
+			w.WriteByte(1)
+		} else {
+			w.WriteByte(2)
+		}
+	case int32:
+		varint(int64(vv))
+	case int64:
+		varint(vv)
+	case string:
+		var bs [binary.MaxVarintLen64]byte
+		w.Write(bs[:binary.PutUvarint(bs[:], uint64(len(vv)))])
+		w.WriteString(vv)
+	case []interface{}:
+		typ := byte(5)
+		if 0 < len(vv) {
+			typ = thriftType(vv[0])
+			if typ == 2 {
+				typ = 1
+			}
+		}
+		if len(vv) < 15 {
+			w.WriteByte(byte(len(vv))<<4 | typ)
+		} else {
+			w.WriteByte(0xf0 | typ)
+			var bs [binary.MaxVarintLen64]byte
+			w.Write(bs[:binary.PutUvarint(bs[:], uint64(len(vv)))])
+		}
+		for _, x := range vv {
+			thriftWrite(w, x)
+		}
+	case tstruct:
+		last := int16(0)
+		for _, f := range vv {
+			typ := thriftType(f.v)
+			if delta := f.id - last; 0 < delta && delta <= 15 {
+				w.WriteByte(byte(delta)<<4 | typ)
+			} else {
+				w.WriteByte(typ)
+				varint(int64(f.id))
+			}
+			last = f.id
+			if _, is := f.v.(bool); !is {
+				thriftWrite(w, f.v)
+			}
+		}
+		w.WriteByte(0)
+	}
+}
+
+// testParquetColumn describes a column for writeParquet.
+type testParquetColumn struct {
+	schema tstruct
+	typ    int32
+	opt    bool
+	dict   bool
+	v2     bool
+
+	// plain encodes a non-null value.
+	plain func(w *bytes.Buffer, x interface{})
+}
+
+// bitPacked encodes the values (of the given bit width) as one
+// bit-packed run.
+func bitPacked(vs []int, width int) []byte {
+	groups := (len(vs) + 7) / 8
+	var w bytes.Buffer
+	var bs [binary.MaxVarintLen64]byte
+	w.Write(bs[:binary.PutUvarint(bs[:], uint64(groups<<1|1))])
+	packed := make([]byte, groups*width)
+	for j, v := range vs {
+		for b := 0; b < width; b++ {
+			if v&(1<<uint(b)) != 0 {
+				bit := j*width + b
+				packed[bit/8] |= 1 << uint(bit%8)
+			}
+		}
+	}
+	w.Write(packed)
+	return w.Bytes()
+}
+
+// rleRuns encodes the values as runs of one value each.
+func rleRuns(vs []int, width int) []byte {
+	var w bytes.Buffer
+	var bs [binary.MaxVarintLen64]byte
+	for _, v := range vs {
+		w.Write(bs[:binary.PutUvarint(bs[:], uint64(1<<1))])
+		for b := 0; b < (width+7)/8; b++ {
+			w.WriteByte(byte(v >> (8 * uint(b))))
+		}
+	}
+	return w.Bytes()
+}
+
+// writeParquet writes a Parquet file with the columns and row groups
+// of rows (with nil for nulls).
+func writeParquet(t *testing.T, filename string, codec int32, columns []*testParquetColumn, groups [][][]interface{}) {
+	compress := func(bs []byte) []byte {
+		switch codec {
+		case parquetSnappy:
+			return snappy.Encode(nil, bs)
+		case parquetGzip:
+			var z bytes.Buffer
+			w := gzip.NewWriter(&z)
+			w.Write(bs)
+			w.Close()
+			return z.Bytes()
+		}
+		return bs
+	}
+
+	var (
+		out    bytes.Buffer
+		rgs    []interface{}
+		nrows  int64
+		header = func(h tstruct) []byte {
+			var w bytes.Buffer
+			thriftWrite(&w, h)
+			return w.Bytes()
+		}
+	)
+	out.WriteString("PAR1")
+
+	for _, rows := range groups {
+		var chunks []interface{}
+		for i, c := range columns {
+			var (
+				start   = int64(out.Len())
+				defs    = make([]int, len(rows))
+				present []interface{}
+				dictOff int64
+				encs    = []interface{}{int32(parquetPlain), int32(parquetRLE)}
+				values  bytes.Buffer
+				enc     = int32(parquetPlain)
+				uncomp  int64
+			)
+			for j, row := range rows {
+				if row[i] != nil {
+					defs[j] = 1
+					present = append(present, row[i])
+				}
+			}
+
+			if c.dict {
+				var (
+					dict  []interface{}
+					index = map[interface{}]int{}
+					is    []int
+					dw    bytes.Buffer
+				)
+				for _, x := range present {
+					k, have := index[x]
+					if !have {
+						k = len(dict)
+						index[x] = k
+						dict = append(dict, x)
+						c.plain(&dw, x)
+					}
+					is = append(is, k)
+				}
+				data := compress(dw.Bytes())
+				h := header(tstruct{
+					{1, int32(parquetDictionaryPage)},
+					{2, int32(dw.Len())},
+					{3, int32(len(data))},
+					{7, tstruct{{1, int32(len(dict))}, {2, int32(parquetPlain)}}},
+				})
+				dictOff = int64(out.Len())
+				out.Write(h)
+				out.Write(data)
+				uncomp += int64(len(h) + dw.Len())
+
+				width := 1
+				for 1<<uint(width) < len(dict) {
+					width++
+				}
+				values.WriteByte(byte(width))
+				values.Write(rleRuns(is, width))
+				enc = parquetRLEDictionary
+				encs = append(encs, int32(parquetRLEDictionary))
+			} else if c.typ == parquetBoolean {
+				packed := make([]byte, (len(present)+7)/8)
+				for j, x := range present {
+					if x.(bool) {
+						packed[j/8] |= 1 << uint(j%8)
+					}
+				}
+				values.Write(packed)
+			} else {
+				for _, x := range present {
+					c.plain(&values, x)
+				}
+			}
+
+			dataOff := int64(out.Len())
+			var levels []byte
+			if c.opt {
+				levels = bitPacked(defs, 1)
+			}
+			if c.v2 {
+				data := compress(values.Bytes())
+				h := header(tstruct{
+					{1, int32(parquetDataPageV2)},
+					{2, int32(len(levels) + values.Len())},
+					{3, int32(len(levels) + len(data))},
+					{8, tstruct{
+						{1, int32(len(rows))},
+						{2, int32(len(rows) - len(present))},
+						{3, int32(len(rows))},
+						{4, enc},
+						{5, int32(len(levels))},
+						{6, int32(0)},
+					}},
+				})
+				out.Write(h)
+				out.Write(levels)
+				out.Write(data)
+				uncomp += int64(len(h) + len(levels) + values.Len())
+			} else {
+				var page bytes.Buffer
+				if c.opt {
+					binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+					page.Write(levels)
+				}
+				page.Write(values.Bytes())
+				data := compress(page.Bytes())
+				h := header(tstruct{
+					{1, int32(parquetDataPage)},
+					{2, int32(page.Len())},
+					{3, int32(len(data))},
+					{5, tstruct{
+						{1, int32(len(rows))},
+						{2, enc},
+						{3, int32(parquetRLE)},
+						{4, int32(parquetRLE)},
+					}},
+				})
+				out.Write(h)
+				out.Write(data)
+				uncomp += int64(len(h) + page.Len())
+			}
+
+			name := ""
+			for _, f := range c.schema {
+				if f.id == 4 {
+					name = f.v.(string)
+				}
+			}
+			meta := tstruct{
+				{1, c.typ},
+				{2, encs},
+				{3, []interface{}{name}},
+				{4, codec},
+				{5, int64(len(rows))},
+				{6, uncomp},
+				{7, int64(out.Len()) - start},
+				{9, dataOff},
+			}
+			if c.dict {
+				meta = append(meta, tfield{11, dictOff})
+			}
+			chunks = append(chunks, tstruct{{2, start}, {3, meta}})
+		}
+		rgs = append(rgs, tstruct{
+			{1, chunks},
+			{2, int64(out.Len())},
+			{3, int64(len(rows))},
+		})
+		nrows += int64(len(rows))
+	}
+
+	schema := []interface{}{tstruct{{4, "schema"}, {5, int32(len(columns))}}}
+	for _, c := range columns {
+		schema = append(schema, c.schema)
+	}
+	footer := header(tstruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, nrows},
+		{4, rgs},
+	})
+	out.Write(footer)
+	binary.Write(&out, binary.LittleEndian, uint32(len(footer)))
+	out.WriteString("PAR1")
+
+	if err := ioutil.WriteFile(filename, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParquet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		int32s = func(w *bytes.Buffer, x interface{}) {
+			binary.Write(w, binary.LittleEndian, int32(x.(int)))
+		}
+		int64s = func(w *bytes.Buffer, x interface{}) {
+			binary.Write(w, binary.LittleEndian, int64(x.(int)))
+		}
+		strs = func(w *bytes.Buffer, x interface{}) {
+			binary.Write(w, binary.LittleEndian, uint32(len(x.(string))))
+			w.WriteString(x.(string))
+		}
+		doubles = func(w *bytes.Buffer, x interface{}) {
+			binary.Write(w, binary.LittleEndian, math.Float64bits(x.(float64)))
+		}
+		required, optional = int32(0), int32(1)
+
+		columns = []*testParquetColumn{
+			{
+				schema: tstruct{{1, int32(parquetInt64)}, {3, required}, {4, "id"}},
+				typ:    parquetInt64,
+				plain:  int64s,
+			},
+			{
+				schema: tstruct{{1, int32(parquetByteArray)}, {3, optional}, {4, "name"},
+					{6, int32(parquetUTF8)}, {10, tstruct{{1, tstruct{}}}}},
+				typ:   parquetByteArray,
+				opt:   true,
+				dict:  true,
+				plain: strs,
+			},
+			{
+				schema: tstruct{{1, int32(parquetBoolean)}, {3, optional}, {4, "ok"}},
+				typ:    parquetBoolean,
+				opt:    true,
+				v2:     true,
+			},
+			{
+				schema: tstruct{{1, int32(parquetInt64)}, {3, required}, {4, "ts"},
+					{10, tstruct{{8, tstruct{{1, true}, {2, tstruct{{1, tstruct{}}}}}}}}},
+				typ:   parquetInt64,
+				v2:    true,
+				plain: int64s,
+			},
+			{
+				schema: tstruct{{1, int32(parquetInt32)}, {3, required}, {4, "price"},
+					{6, int32(parquetDecimal)}, {7, int32(2)}, {8, int32(9)}},
+				typ:   parquetInt32,
+				plain: int32s,
+			},
+			{
+				schema: tstruct{{1, int32(parquetInt32)}, {3, optional}, {4, "day"},
+					{6, int32(parquetDate)}},
+				typ:   parquetInt32,
+				opt:   true,
+				dict:  true,
+				plain: int32s,
+			},
+			{
+				schema: tstruct{{1, int32(parquetDouble)}, {3, required}, {4, "score"}},
+				typ:    parquetDouble,
+				plain:  doubles,
+			},
+		}
+
+		groups = [][][]interface{}{
+			{
+				{1, "tacos", true, 1600000000000, 1299, 18000, 0.5},
+				{2, nil, false, 1600000000001, -5, nil, 1.25},
+				{3, "tacos", nil, 1600000000002, 0, 18000, -2.0},
+			},
+			{
+				{4, "chips", true, 1600000000003, 100000, 18001, 3.0},
+			},
+		}
+
+		want = []string{
+			`{"day":"2019-04-14","id":1,"name":"tacos","ok":true,"price":12.99,"score":0.5,"ts":"2020-09-13T12:26:40Z"}`,
+			`{"day":null,"id":2,"name":null,"ok":false,"price":-0.05,"score":1.25,"ts":"2020-09-13T12:26:40.001Z"}`,
+			`{"day":"2019-04-14","id":3,"name":"tacos","ok":null,"price":0,"score":-2,"ts":"2020-09-13T12:26:40.002Z"}`,
+			`{"day":"2019-04-15","id":4,"name":"chips","ok":true,"price":1000,"score":3,"ts":"2020-09-13T12:26:40.003Z"}`,
+		}
+	)
+
+	for _, codec := range []int32{parquetUncompressed, parquetSnappy, parquetGzip} {
+		filename := filepath.Join(dir, "data.parquet")
+		writeParquet(t, filename, codec, columns, groups)
+
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := DatasetFormats[datasetFormat(filename)](f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for {
+			x, err := dec.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(codec, err)
+			}
+			got = append(got, JSON(x))
+		}
+		f.Close()
+
+		if len(got) != len(want) {
+			t.Fatal(codec, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("codec %d row %d: got %s; wanted %s", codec, i, got[i], want[i])
+			}
+		}
+	}
+
+	t.Run("bad", func(t *testing.T) {
+		filename := filepath.Join(dir, "bad.parquet")
+		if err := ioutil.WriteFile(filename, []byte("id,name\n1,tacos\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := newParquetDecoder(f); err == nil {
+			t.Fatal("expected protest")
+		}
+	})
+}
+
+func TestParquetCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	page := func(h tstruct, body []byte) []byte {
+		var w bytes.Buffer
+		thriftWrite(&w, h)
+		w.Write(body)
+		return w.Bytes()
+	}
+	v2 := func(n, defLen, repLen int32) []byte {
+		return page(tstruct{
+			{1, int32(parquetDataPageV2)},
+			{2, int32(4)},
+			{3, int32(4)},
+			{8, tstruct{{1, n}, {4, int32(parquetPlain)}, {5, defLen}, {6, repLen}}},
+		}, []byte{0, 0, 0, 0})
+	}
+	v1 := func(n int32) []byte {
+		return page(tstruct{
+			{1, int32(parquetDataPage)},
+			{2, int32(4)},
+			{3, int32(4)},
+			{5, tstruct{{1, n}, {2, int32(parquetPlain)}}},
+		}, []byte{0, 0, 0, 0})
+	}
+
+	for name, test := range map[string]struct {
+		bs              []byte
+		count, at, size int64
+		optional        bool
+	}{
+		"negative-length":  {bs: v1(1), count: 1, size: -1},
+		"huge-length":      {bs: v1(1), count: 1, size: 1 << 40},
+		"negative-start":   {bs: v1(1), count: 1, at: -8},
+		"negative-count":   {bs: v1(1), count: -1},
+		"negative-values":  {bs: v1(-1), count: 1},
+		"negative-def-len": {bs: v2(1, -4, 0), count: 1, optional: true},
+		"negative-rep-len": {bs: v2(1, 2, -2), count: 1},
+		"huge-levels":      {bs: v2(1, 1<<30, 1<<30), count: 1},
+		"negative-v2":      {bs: v2(-1, 0, 0), count: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name+".parquet")
+			if err := ioutil.WriteFile(filename, test.bs, 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			size := test.size
+			if size == 0 {
+				size = int64(len(test.bs))
+			}
+			d := &parquetDecoder{f: f, size: int64(len(test.bs))}
+			c := &parquetColumn{typ: parquetInt32, optional: test.optional}
+			chunk := thriftStruct{3: thriftStruct{
+				4: int64(parquetUncompressed),
+				5: test.count,
+				7: size,
+				9: test.at,
+			}}
+			if _, err := d.readChunk(c, chunk); err == nil {
+				t.Fatal("expected protest")
+			}
+		})
+	}
+}
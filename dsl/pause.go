@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"sync"
+)
+
+// Pause is a step that stops delivering a channel's inbound
+// messages to Recvs (and RecvSeqs and windows).  Until a Resume, the
+// messages are buffered in the order they arrive, so a test can
+// create a controlled backlog.
+//
+// Messages that a Recv set aside before the Pause (see Recv.Topics)
+// are still available.
+type Pause struct {
+	Chan string
+
+	ch Chan
+}
+
+func (p *Pause) Substitute(ctx *Ctx, t *Test) (*Pause, error) {
+	return p, nil
+}
+
+func (p *Pause) Exec(ctx *Ctx, t *Test) error {
+	ctx.Indf("    Pause %s", JSON(p))
+
+	name := t.chanName(p.ch)
+	if _, have := t.paused[name]; have {
+		ctx.Indf("    Pause: %s is already paused", name)
+		return nil
+	}
+
+	if t.paused == nil {
+		t.paused = make(map[string]*pauseBuffer)
+	}
+	t.paused[name] = newPauseBuffer(ctx, p.ch)
+
+	return nil
+}
+
+// Resume is a step that resumes the delivery of a paused channel's
+// inbound messages.  The messages buffered during the Pause are
+// delivered first, in the order they arrived.
+type Resume struct {
+	Chan string
+
+	ch Chan
+}
+
+func (p *Resume) Substitute(ctx *Ctx, t *Test) (*Resume, error) {
+	return p, nil
+}
+
+func (p *Resume) Exec(ctx *Ctx, t *Test) error {
+	ctx.Indf("    Resume %s", JSON(p))
+
+	name := t.chanName(p.ch)
+	b, have := t.paused[name]
+	if !have {
+		ctx.Indf("    Resume: %s isn't paused", name)
+		return nil
+	}
+	delete(t.paused, name)
+
+	var ms []Msg
+	for _, m := range b.stop() {
+		admit, err := t.admit(ctx, name, &m)
+		if err != nil {
+			return err
+		}
+		if admit {
+			ms = append(ms, m)
+		}
+	}
+	ctx.Indf("    Resume %s delivering %d buffered message(s)", name, len(ms))
+
+	// After any messages that a Recv set aside.
+	if 0 < len(ms) {
+		if t.held == nil {
+			t.held = make(map[string][]Msg)
+		}
+		t.held[name] = append(t.held[name], ms...)
+	}
+
+	return nil
+}
+
+// pauseBuffer collects a paused channel's inbound messages.
+type pauseBuffer struct {
+	sync.Mutex
+
+	ms   []Msg
+	quit chan bool
+	done chan bool
+}
+
+func newPauseBuffer(ctx *Ctx, c Chan) *pauseBuffer {
+	b := &pauseBuffer{
+		quit: make(chan bool),
+		done: make(chan bool),
+	}
+
+	in := c.Recv(ctx)
+	go func() {
+		defer close(b.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.quit:
+				return
+			case m, ok := <-in:
+				if !ok {
+					return
+				}
+				b.Lock()
+				b.ms = append(b.ms, m)
+				b.Unlock()
+			}
+		}
+	}()
+
+	return b
+}
+
+// stop stops buffering and returns the buffered messages.
+func (b *pauseBuffer) stop() []Msg {
+	close(b.quit)
+	<-b.done
+	b.Lock()
+	defer b.Unlock()
+	return b.ms
+}
+
+// size returns the number of buffered messages.
+func (b *pauseBuffer) size() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.ms)
+}
+
+// inbound returns the channel's inbound messages, which is nil (and
+// therefore never delivers anything) when the channel is paused.
+func (t *Test) inbound(ctx *Ctx, c Chan) chan Msg {
+	if _, have := t.paused[t.chanName(c)]; have {
+		return nil
+	}
+	return c.Recv(ctx)
+}
+
+// unpause stops buffering for all paused channels and discards
+// their buffered messages.
+func (t *Test) unpause() {
+	for _, b := range t.paused {
+		b.stop()
+	}
+	t.paused = nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+
+	p.AddStep(ctx, &Step{
+		Pause: &Pause{},
+	})
+	for _, n := range []string{"1", "2", "3"} {
+		p.AddStep(ctx, &Step{
+			Pub: &Pub{
+				Payload: dejson(`{"n":` + n + `}`),
+			},
+		})
+	}
+	// Nothing is delivered while paused.
+	zero := 0
+	p.AddStep(ctx, &Step{
+		Recv: &Recv{
+			Pattern: dejson(`{"n":"?n"}`),
+			Window: &Window{
+				Duration: 100 * time.Millisecond,
+				Counts: []*WindowCount{
+					{Pattern: dejson(`{}`), Count: &zero},
+				},
+			},
+		},
+	})
+	p.AddStep(ctx, &Step{
+		Resume: &Resume{},
+	})
+	p.AddStep(ctx, &Step{
+		Pub: &Pub{
+			Payload: dejson(`{"n":4}`),
+		},
+	})
+	// The backlog arrives in order and before later messages.
+	p.AddStep(ctx, &Step{
+		RecvSeq: &RecvSeq{
+			Patterns: []interface{}{
+				dejson(`{"n":1}`),
+				dejson(`{"n":2}`),
+				dejson(`{"n":3}`),
+				dejson(`{"n":4}`),
+			},
+			Timeout: time.Second,
+		},
+	})
+
+	run(t, ctx, tst)
+
+	if len(tst.paused) != 0 {
+		t.Fatal(tst.paused)
+	}
+}
+
+func TestPauseSnapshot(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+
+	run(t, ctx, tst)
+
+	var (
+		ch    = tst.Chans["mock1"]
+		pause = &Pause{Chan: "mock1", ch: ch}
+	)
+	if err := pause.Exec(ctx, tst); err != nil {
+		t.Fatal(err)
+	}
+	// A second Pause is harmless.
+	if err := pause.Exec(ctx, tst); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.To(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for tst.paused["mock1"].size() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	snap := tst.Snapshot(ctx, 0)
+	if len(snap.Pending) != 0 || snap.Paused["mock1"] != 1 {
+		t.Fatal(JSON(snap))
+	}
+
+	resume := &Resume{Chan: "mock1", ch: ch}
+	if err := resume.Exec(ctx, tst); err != nil {
+		t.Fatal(err)
+	}
+	if snap = tst.Snapshot(ctx, 0); len(snap.Pending) != 1 || snap.Paused != nil {
+		t.Fatal(JSON(snap))
+	}
+
+	if err := tst.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
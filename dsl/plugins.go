@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+)
+
+// PluginsEnv is the environment variable that can name a directory
+// of channel plugins.  See LoadPlugins.
+const PluginsEnv = "PLAX_PLUGINS"
+
+// PluginLoader loads a channel plugin from a file.  A loader
+// typically registers channel types in TheChanRegistry.
+type PluginLoader func(ctx *Ctx, filename string) error
+
+// PluginLoaders maps filename extensions to PluginLoaders.
+//
+// ".so" files are Go plugins (see LoadGoPlugin), and executables
+// without an extension are gRPC plugins (see LoadGRPCPlugin).  A
+// program can register loaders for other kinds of plugins.  Files
+// with other extensions are ignored.
+var PluginLoaders = map[string]PluginLoader{
+	".so": LoadGoPlugin,
+	"":    LoadGRPCPlugin,
+}
+
+// LoadGoPlugin opens a Go plugin (built with '-buildmode=plugin'),
+// whose init functions should register channel types in
+// TheChanRegistry (and optionally document them in TheChanDocs).
+//
+// If the plugin exports a function 'PlaxRegister' with the
+// signature 'func(ChanRegistry, ChanDocs) error', that function is
+// also called.
+//
+// A Go plugin must be built with the same Go version and the same
+// versions of the packages (including this one) as the plax binary
+// that loads it.
+func LoadGoPlugin(ctx *Ctx, filename string) error {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup("PlaxRegister")
+	if err != nil {
+		// No PlaxRegister, so presumably the plugin's init
+		// functions did the work.
+		return nil
+	}
+	f, is := sym.(func(ChanRegistry, ChanDocs) error)
+	if !is {
+		return fmt.Errorf("%s: PlaxRegister is a %T and not a func(ChanRegistry, ChanDocs) error", filename, sym)
+	}
+	return f(TheChanRegistry, TheChanDocs)
+}
+
+// LoadPlugins loads the plugins (see PluginLoaders) in the given
+// directory in filename order and returns the channel types that
+// they registered.
+func LoadPlugins(ctx *Ctx, dir string) ([]ChanKind, error) {
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[ChanKind]bool, len(TheChanRegistry))
+	for kind := range TheChanRegistry {
+		before[kind] = true
+	}
+
+	for _, f := range fs {
+		if f.IsDir() {
+			continue
+		}
+		loader, have := PluginLoaders[filepath.Ext(f.Name())]
+		if !have {
+			continue
+		}
+		filename := filepath.Join(dir, f.Name())
+		ctx.Logf("Loading plugin %s", filename)
+		if err := loader(ctx, filename); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", filename, err)
+		}
+	}
+
+	var kinds []ChanKind
+	for kind := range TheChanRegistry {
+		if !before[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i] < kinds[j]
+	})
+
+	return kinds, nil
+}
+
+// LoadPluginsFromEnv calls LoadPlugins with the directory named by
+// PluginsEnv (if any).
+func LoadPluginsFromEnv(ctx *Ctx) ([]ChanKind, error) {
+	dir := os.Getenv(PluginsEnv)
+	if dir == "" {
+		return nil, nil
+	}
+	return LoadPlugins(ctx, dir)
+}
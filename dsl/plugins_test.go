@@ -0,0 +1,71 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.fake", "a.fake", "README"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var loaded []string
+	PluginLoaders[".fake"] = func(ctx *Ctx, filename string) error {
+		name := filepath.Base(filename)
+		loaded = append(loaded, name)
+		TheChanRegistry.Register(ctx, ChanKind("fake-"+name), NewMockChan)
+		return nil
+	}
+	defer func() {
+		delete(PluginLoaders, ".fake")
+		delete(TheChanRegistry, "fake-a.fake")
+		delete(TheChanRegistry, "fake-b.fake")
+	}()
+
+	kinds, err := LoadPlugins(NewCtx(nil), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, []string{"a.fake", "b.fake"}) {
+		t.Fatal(loaded)
+	}
+	if !reflect.DeepEqual(kinds, []ChanKind{"fake-a.fake", "fake-b.fake"}) {
+		t.Fatal(kinds)
+	}
+}
+
+func TestLoadGoPluginBad(t *testing.T) {
+	if err := LoadGoPlugin(NewCtx(nil), "nonexistent.so"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,240 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"sync"
+	"time"
+)
+
+func init() {
+	TheChanRegistry.Register(NewCtx(nil), "poller", NewPollerChan)
+	TheChanDocs.Register("poller", "Wraps another channel and repeats each pub on an interval until a kill.", PollerOpts{})
+}
+
+// PollerOpts configures a PollerChan.
+type PollerOpts struct {
+	// Kind is the type of the wrapped channel.
+	Kind ChanKind `doc:"The type of the wrapped channel."`
+
+	// Opts is the configuration for the wrapped channel.
+	Opts interface{} `json:",omitempty" yaml:",omitempty" doc:"The configuration for the wrapped channel."`
+
+	// Interval is the time (in Go syntax) between repetitions of
+	// a pub.
+	Interval string `json:",omitempty" yaml:",omitempty" doc:"Time (in Go syntax) between repetitions of a pub." default:"1s"`
+
+	// Limit, if positive, is the maximum number of times to
+	// publish each message.
+	Limit int `json:",omitempty" yaml:",omitempty" doc:"Maximum number of times to publish each message (if positive)."`
+
+	// Changes, when true, only delivers a received message if
+	// its payload differs from the previous message's payload
+	// (with the same topic).
+	Changes bool `json:",omitempty" yaml:",omitempty" doc:"Only deliver messages whose payloads differ from the previous ones."`
+}
+
+// PollerChan wraps another Chan and repeatedly publishes each message
+// given to Pub.
+//
+// A Pub publishes the message via the wrapped channel immediately and
+// then every Interval until a Kill (or Close).  A subsequent Pub with
+// the same topic replaces the message that's being repeated.  The
+// wrapped channel's messages (like HTTP responses) are delivered as
+// usual, so a test can Recv until it sees the state it wants and then
+// Kill the poller.
+type PollerChan struct {
+	opts     *PollerOpts
+	interval time.Duration
+	inner    Chan
+	c        chan Msg
+
+	sync.Mutex
+
+	// polls maps a topic to the control channel for its
+	// repetitions.
+	polls map[string]chan bool
+}
+
+// NewPollerChan makes a PollerChan and the Chan it wraps.
+func NewPollerChan(ctx *Ctx, cfg interface{}) (Chan, error) {
+	opts := PollerOpts{
+		Interval: "1s",
+	}
+	if err := As(cfg, &opts); err != nil {
+		return nil, NewBroken(err)
+	}
+
+	if opts.Kind == "" {
+		return nil, Brokenf("poller channel needs a Kind")
+	}
+
+	interval, err := time.ParseDuration(opts.Interval)
+	if err != nil {
+		return nil, Brokenf("bad poller Interval '%s': %s", opts.Interval, err)
+	}
+	if interval <= 0 {
+		return nil, Brokenf("poller Interval '%s' isn't positive", opts.Interval)
+	}
+
+	maker, have := TheChanRegistry[opts.Kind]
+	if !have {
+		return nil, Brokenf("unknown Chan kind: '%s'", opts.Kind)
+	}
+
+	inner, err := maker(ctx, opts.Opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PollerChan{
+		opts:     &opts,
+		interval: interval,
+		inner:    inner,
+		c:        make(chan Msg, 1024),
+		polls:    make(map[string]chan bool),
+	}, nil
+}
+
+func (c *PollerChan) Kind() ChanKind {
+	return "poller"
+}
+
+// Open opens the wrapped channel and starts forwarding its
+// messages.
+func (c *PollerChan) Open(ctx *Ctx) error {
+	if err := c.inner.Open(ctx); err != nil {
+		return err
+	}
+
+	in := c.inner.Recv(ctx)
+
+	go func() {
+		// previous maps a topic to the JSON of the previous
+		// payload for that topic (when Changes).
+		previous := make(map[string]string)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-in:
+				if c.opts.Changes {
+					js := JSON(m.Payload)
+					if was, have := previous[m.Topic]; have && was == js {
+						ctx.Logdf("PollerChan ignoring unchanged message on '%s'", m.Topic)
+						continue
+					}
+					previous[m.Topic] = js
+				}
+				select {
+				case <-ctx.Done():
+				case c.c <- m:
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// stop stops all repetitions.
+func (c *PollerChan) stop() {
+	c.Lock()
+	for topic, ctl := range c.polls {
+		close(ctl)
+		delete(c.polls, topic)
+	}
+	c.Unlock()
+}
+
+func (c *PollerChan) Close(ctx *Ctx) error {
+	c.stop()
+	return c.inner.Close(ctx)
+}
+
+// Kill stops all repetitions.  The wrapped channel remains open.
+func (c *PollerChan) Kill(ctx *Ctx) error {
+	ctx.Logf("PollerChan stopping")
+	c.stop()
+	return nil
+}
+
+func (c *PollerChan) Sub(ctx *Ctx, topic string) error {
+	return c.inner.Sub(ctx, topic)
+}
+
+// Pub publishes the message via the wrapped channel and then starts
+// repeating it.  See PollerChan.
+func (c *PollerChan) Pub(ctx *Ctx, m Msg) error {
+	ctl := make(chan bool)
+
+	c.Lock()
+	if was, have := c.polls[m.Topic]; have {
+		close(was)
+	}
+	c.polls[m.Topic] = ctl
+	c.Unlock()
+
+	// The first publication reports any error.
+	if err := c.inner.Pub(ctx, m); err != nil {
+		c.Lock()
+		if c.polls[m.Topic] == ctl {
+			close(ctl)
+			delete(c.polls, m.Topic)
+		}
+		c.Unlock()
+		return err
+	}
+
+	go func() {
+		for n := 1; c.opts.Limit <= 0 || n < c.opts.Limit; n++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ctl:
+				return
+			case <-time.After(c.interval):
+			}
+			ctx.Logdf("PollerChan publishing on '%s' (%d)", m.Topic, n+1)
+			if err := c.inner.Pub(ctx, m); err != nil {
+				ctx.Warnf("warning: PollerChan publishing on '%s': %s", m.Topic, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *PollerChan) Recv(ctx *Ctx) chan Msg {
+	return c.c
+}
+
+// To sends the given message to the wrapped channel.
+func (c *PollerChan) To(ctx *Ctx, m Msg) error {
+	return c.inner.To(ctx, m)
+}
+
+// Overflow reports an overflow of the wrapped channel's Buffer (if
+// any).  See Overflower.
+func (c *PollerChan) Overflow() error {
+	if o, is := c.inner.(Overflower); is {
+		return o.Overflow()
+	}
+	return nil
+}
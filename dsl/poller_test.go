@@ -0,0 +1,151 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollerChan(t *testing.T) {
+	open := func(t *testing.T, opts *PollerOpts) (*Ctx, Chan) {
+		ctx, cancel := NewCtx(nil).WithCancel()
+		t.Cleanup(cancel)
+		c, err := NewPollerChan(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if "poller" != c.Kind() {
+			t.Fatal(c.Kind())
+		}
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			c.Close(ctx)
+		})
+		return ctx, c
+	}
+
+	recv := func(ctx *Ctx, c Chan) (Msg, bool) {
+		select {
+		case m := <-c.Recv(ctx):
+			return m, true
+		case <-time.After(200 * time.Millisecond):
+			return Msg{}, false
+		}
+	}
+
+	t.Run("repeat", func(t *testing.T) {
+		ctx, c := open(t, &PollerOpts{
+			Kind:     "mock",
+			Interval: "10ms",
+		})
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if m, ok := recv(ctx, c); !ok || m.Payload != "hi" {
+				t.Fatal(i, m)
+			}
+		}
+
+		// Replace the message.
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "bye"}); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			m, ok := recv(ctx, c)
+			if !ok {
+				t.Fatal("nothing received")
+			}
+			if m.Payload == "bye" {
+				break
+			}
+		}
+
+		if err := c.Kill(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// Drain anything that was in flight.
+		time.Sleep(50 * time.Millisecond)
+		for len(c.Recv(ctx)) > 0 {
+			<-c.Recv(ctx)
+		}
+		if m, ok := recv(ctx, c); ok {
+			t.Fatal(m)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		ctx, c := open(t, &PollerOpts{
+			Kind:     "mock",
+			Interval: "5ms",
+			Limit:    2,
+		})
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, ok := recv(ctx, c); !ok {
+				t.Fatal(i)
+			}
+		}
+		if m, ok := recv(ctx, c); ok {
+			t.Fatal(m)
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		ctx, c := open(t, &PollerOpts{
+			Kind:     "mock",
+			Interval: "5ms",
+			Changes:  true,
+		})
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := recv(ctx, c); !ok || m.Payload != "hi" {
+			t.Fatal(m)
+		}
+		if m, ok := recv(ctx, c); ok {
+			t.Fatal(m)
+		}
+		if err := c.Pub(ctx, Msg{Topic: "t", Payload: "bye"}); err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := recv(ctx, c); !ok || m.Payload != "bye" {
+			t.Fatal(m)
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		ctx := NewCtx(nil)
+		for _, opts := range []*PollerOpts{
+			{},
+			{Kind: "mock", Interval: "soon"},
+			{Kind: "mock", Interval: "-1s"},
+			{Kind: "nope"},
+		} {
+			if _, err := NewPollerChan(ctx, opts); err == nil {
+				t.Fatal(opts)
+			}
+		}
+	})
+}
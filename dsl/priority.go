@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"sort"
+	"strings"
+)
+
+// TopicMatches reports whether the topic matches the filter, which
+// can use MQTT-style wildcards: '+' matches a single level, and a
+// final '#' matches any remaining levels (including none).
+func TopicMatches(filter, topic string) bool {
+	var (
+		fs = strings.Split(filter, "/")
+		ts = strings.Split(topic, "/")
+	)
+	for i, f := range fs {
+		if f == "#" && i == len(fs)-1 {
+			return true
+		}
+		if len(ts) <= i {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// topicRank returns the index of the first of the Recv's Topics
+// that matches the given topic.  Without Topics, every topic has
+// rank zero.  A negative rank means the Recv doesn't consider the
+// topic.
+func (r *Recv) topicRank(topic string) int {
+	if len(r.Topics) == 0 {
+		return 0
+	}
+	for i, filter := range r.Topics {
+		if TopicMatches(filter, topic) {
+			return i
+		}
+	}
+	return -1
+}
+
+// candidates returns the indexes of the pending messages that the
+// Recv should consider, in the order it should consider them:
+// messages on earlier Topics come first, and otherwise messages are
+// in the order they arrived.
+func (r *Recv) candidates(pending []Msg) []int {
+	var (
+		acc   = make([]int, 0, len(pending))
+		ranks = make([]int, len(pending))
+	)
+	for i, m := range pending {
+		if ranks[i] = r.topicRank(m.Topic); 0 <= ranks[i] {
+			acc = append(acc, i)
+		}
+	}
+	sort.SliceStable(acc, func(i, j int) bool {
+		return ranks[acc[i]] < ranks[acc[j]]
+	})
+	return acc
+}
+
+// hold sets aside the given messages, which a Recv received on the
+// named channel but didn't consider, for subsequent Recvs.
+func (t *Test) hold(name string, ms []Msg) {
+	if len(ms) == 0 {
+		return
+	}
+	if t.held == nil {
+		t.held = make(map[string][]Msg)
+	}
+	t.held[name] = append(ms, t.held[name]...)
+}
+
+// unhold returns (and forgets) the messages held for the named
+// channel.
+func (t *Test) unhold(name string) []Msg {
+	ms := t.held[name]
+	delete(t.held, name)
+	return ms
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestTopicMatches(t *testing.T) {
+	for _, c := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"a/b/c", "a/b", false},
+		{"+/b", "a/b", true},
+	} {
+		if got := TopicMatches(c.filter, c.topic); got != c.want {
+			t.Errorf("%s %s: %v", c.filter, c.topic, got)
+		}
+	}
+}
+
+func TestRecvCandidates(t *testing.T) {
+	var (
+		r = &Recv{
+			Topics: []string{"control", "telemetry/#"},
+		}
+		pending = []Msg{
+			{Topic: "telemetry/temp"},
+			{Topic: "other"},
+			{Topic: "control"},
+			{Topic: "telemetry/humidity"},
+		}
+		got = JSON(r.candidates(pending))
+	)
+	if got != "[2,0,3]" {
+		t.Fatal(got)
+	}
+
+	r.Topics = nil
+	if got = JSON(r.candidates(pending)); got != "[0,1,2,3]" {
+		t.Fatal(got)
+	}
+}
+
+func TestHold(t *testing.T) {
+	tst := NewTest(NewCtx(nil), "", nil)
+	tst.hold("c", []Msg{{Topic: "b"}})
+	tst.hold("c", []Msg{{Topic: "a"}})
+	ms := tst.unhold("c")
+	if len(ms) != 2 || ms[0].Topic != "a" {
+		t.Fatal(JSON(ms))
+	}
+	if ms = tst.unhold("c"); len(ms) != 0 {
+		t.Fatal(JSON(ms))
+	}
+}
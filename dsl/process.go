@@ -21,32 +21,66 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 )
 
 // Process represents an external process run from a test.
 type Process struct {
 	// Name is an opaque string used is reports about this
 	// Process.
-	Name string `json:"name" yaml:"name"`
+	Name string `json:"name" yaml:"name" doc:"An opaque name used in reports about the process."`
 
 	// Command is the name of the program.
 	//
 	// Subject to expansion.
-	Command string `json:"command" yaml:"command"`
+	Command string `json:"command" yaml:"command" doc:"The name of the program."`
 
 	// Args is the list of command-line arguments for the program.
 	//
 	// Subject to expansion.
-	Args []string `json:"args" yaml:"args"`
+	Args []string `json:"args" yaml:"args" doc:"Command-line arguments for the program."`
 
-	// ToDo: Environment, dir.
+	// Env optionally gives environment variables, which are added
+	// to this process's environment.
+	//
+	// Subject to expansion.
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty" doc:"Environment variables added to the process's environment."`
+
+	// Dir is the optional working directory for the program.  A
+	// relative Dir is relative to the Ctx's Dir.
+	//
+	// Subject to expansion.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty" doc:"Working directory (relative to the test's directory)."`
 
 	cmd *exec.Cmd
 
 	Stdout chan string `json:"-"`
 	Stderr chan string `json:"-"`
-	Stdin  chan string `json:"-"`
+
+	// Stdin lines are written to the program's stdin.  Closing
+	// Stdin closes the program's stdin.
+	Stdin chan string `json:"-"`
+
+	// Exited receives the program's ProcessExit when the program
+	// terminates.
+	Exited chan *ProcessExit `json:"-"`
+}
+
+// ProcessExit reports how a Process terminated.
+type ProcessExit struct {
+	// Code is the exit code, which is -1 if the program was
+	// terminated by a signal.
+	Code int `json:"code"`
+
+	// Status is a description of the exit status (for example,
+	// "exit status 1" or "signal: killed").
+	Status string `json:"status"`
 }
 
 // Substitute the bindings into the Process
@@ -63,24 +97,58 @@ func (p *Process) Substitute(ctx *Ctx, bs *Bindings) (*Process, error) {
 		}
 		args[i] = s
 	}
+	var env map[string]string
+	if p.Env != nil {
+		env = make(map[string]string, len(p.Env))
+		for k, v := range p.Env {
+			if env[k], err = bs.StringSub(ctx, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	dir, err := bs.StringSub(ctx, p.Dir)
+	if err != nil {
+		return nil, err
+	}
 	return &Process{
 		Name:    p.Name,
 		Command: cmd,
 		Args:    args,
+		Env:     env,
+		Dir:     dir,
 	}, nil
 }
 
 // Start starts the program, which runs in the background (until the
 // test is complete).
 //
-// Stderr and stdout are logged via ctx.Logf.
+// Stderr and stdout lines are logged via ctx.Logf and sent to Stderr
+// and Stdout, which the caller should consume.  When the program
+// terminates (after its stdout and stderr are exhausted), its
+// ProcessExit is sent to Exited.
 func (p *Process) Start(ctx *Ctx) error {
 
 	p.Stdin = make(chan string)
 	p.Stderr = make(chan string)
 	p.Stdout = make(chan string)
+	p.Exited = make(chan *ProcessExit, 1)
 
 	p.cmd = exec.Command(p.Command, p.Args...)
+	p.cmd.Dir = p.Dir
+	if p.Dir != "" && !filepath.IsAbs(p.Dir) && ctx.Dir != "" {
+		p.cmd.Dir = filepath.Join(ctx.Dir, p.Dir)
+	}
+	if p.Env != nil || ctx.Env != nil {
+		// The Process's Env takes precedence over the Ctx's.
+		env := os.Environ()
+		for k, v := range ctx.Env {
+			env = append(env, k+"="+v)
+		}
+		for k, v := range p.Env {
+			env = append(env, k+"="+v)
+		}
+		p.cmd.Env = env
+	}
 
 	inPipe, err := p.cmd.StdinPipe()
 	if err != nil {
@@ -88,54 +156,83 @@ func (p *Process) Start(ctx *Ctx) error {
 	}
 
 	go func() {
-		select {
-		case <-ctx.Done():
-			return
-		case line := <-p.Stdin:
-			io.WriteString(inPipe, line)
+		defer inPipe.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-p.Stdin:
+				if !ok {
+					ctx.Logf("Process %s stdin closed", p.Name)
+					return
+				}
+				if _, err := io.WriteString(inPipe, line); err != nil {
+					ctx.Logf("Process %s stdin error %s", p.Name, err)
+				}
+			}
 		}
 	}()
 
-	errPipe, err := p.cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("Process %s Run error on StderrPipe: %s", p.Name, err)
-	}
-
-	go func() {
-		sc := bufio.NewScanner(errPipe)
+	// scan sends the pipe's lines to the given channel.
+	scan := func(pipe io.Reader, name string, lines chan string) {
+		sc := bufio.NewScanner(pipe)
 		for sc.Scan() {
-			ctx.Logf("Process %s stderr output: %s\n", p.Name, sc.Text())
+			line := sc.Text()
+			ctx.Logf("Process %s %s line: %s\n", p.Name, name, line)
+			select {
+			case <-ctx.Done():
+			case lines <- line:
+			}
 		}
 		if err := sc.Err(); err != nil {
-			ctx.Logf("Process %s stderr error %s", p.Name, err)
+			ctx.Logf("Process %s %s error %s", p.Name, name, err)
 		}
-	}()
+	}
+
+	errPipe, err := p.cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("Process %s Run error on StderrPipe: %s", p.Name, err)
+	}
 
 	outPipe, err := p.cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("Process %s Run error on StdoutPipe: %s", p.Name, err)
 	}
 
-	go func() {
-		sc := bufio.NewScanner(outPipe)
-		for sc.Scan() {
-			line := sc.Text()
-			ctx.Logf("Process %s stdout line: %s\n", p.Name, line)
-			select {
-			case <-ctx.Done():
-			case p.Stdout <- line:
-			}
-		}
-		if err := sc.Err(); err != nil {
-			ctx.Logf("Process %s Run stdout error %s", p.Name, err)
-		}
-	}()
-
 	if err := p.cmd.Start(); err != nil {
 		ctx.Logf("Process %s error on start: %s", p.Name, err)
 		return err
 	}
 
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		scan(errPipe, "stderr", p.Stderr)
+	}()
+	go func() {
+		defer wg.Done()
+		scan(outPipe, "stdout", p.Stdout)
+	}()
+
+	go func() {
+		// Wait requires that we have finished reading from
+		// the pipes.
+		wg.Wait()
+		err := p.cmd.Wait()
+		x := &ProcessExit{
+			Code: -1,
+		}
+		if ps := p.cmd.ProcessState; ps != nil {
+			x.Code = ps.ExitCode()
+			x.Status = ps.String()
+		} else if err != nil {
+			x.Status = err.Error()
+		}
+		ctx.Logf("Process %s exited: %s", p.Name, x.Status)
+		p.Exited <- x
+	}()
+
 	return nil
 }
 
@@ -144,3 +241,36 @@ func (p *Process) Stop(ctx *Ctx) error {
 	ctx.Logf("Process %s stopping", p.Name)
 	return p.cmd.Process.Kill()
 }
+
+// Signal sends the named signal (for example, "TERM" or "SIGTERM")
+// or numbered signal to the Process.
+func (p *Process) Signal(ctx *Ctx, name string) error {
+	sig, err := ParseSignal(name)
+	if err != nil {
+		return err
+	}
+	ctx.Logf("Process %s signal %s", p.Name, sig)
+	return p.cmd.Process.Signal(sig)
+}
+
+// ParseSignal returns the named (for example, "TERM" or "SIGTERM")
+// or numbered signal.  Only INT, TERM, KILL, HUP, and QUIT are known
+// by name.
+func ParseSignal(name string) (os.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return syscall.Signal(n), nil
+	}
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "INT":
+		return syscall.SIGINT, nil
+	case "TERM":
+		return syscall.SIGTERM, nil
+	case "KILL":
+		return syscall.SIGKILL, nil
+	case "HUP":
+		return syscall.SIGHUP, nil
+	case "QUIT":
+		return syscall.SIGQUIT, nil
+	}
+	return nil, Brokenf("unknown signal '%s'", name)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChanProfile is a named set of channel options (like an endpoint and
+// TLS settings for an environment) that a request to make a channel
+// can use by name.  See MotherMakeRequest.Profile.
+//
+// A profile can inherit the options of another profile, and its own
+// Config is merged over the other profile's.
+type ChanProfile struct {
+	Doc string `json:",omitempty" yaml:",omitempty"`
+
+	// Inherits is the name of a profile to extend.
+	Inherits string `json:",omitempty" yaml:",omitempty"`
+
+	// Type is the channel's type.  A profile that Inherits can
+	// omit its Type.
+	Type ChanKind `json:",omitempty" yaml:",omitempty"`
+
+	// Config is the channel's configuration.
+	Config interface{} `json:",omitempty" yaml:",omitempty"`
+}
+
+// ChanProfiles maps names to ChanProfiles.
+type ChanProfiles map[string]*ChanProfile
+
+// ReadChanProfiles reads profiles from a YAML (or JSON) file that
+// maps profile names to ChanProfiles.
+func ReadChanProfiles(filename string) (ChanProfiles, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var ps ChanProfiles
+	if err = yaml.Unmarshal(bs, &ps); err != nil {
+		return nil, fmt.Errorf("profiles %s: %w", filename, err)
+	}
+	return ps, nil
+}
+
+// Add adds the given profiles, which replace any existing profiles
+// with the same names.
+func (ps ChanProfiles) Add(more ChanProfiles) {
+	for name, p := range more {
+		ps[name] = p
+	}
+}
+
+// Resolve returns the type and configuration that the named profile
+// gives after following its inheritance.
+func (ps ChanProfiles) Resolve(name string) (ChanKind, interface{}, error) {
+	var (
+		kind   ChanKind
+		config interface{}
+		seen   = make(map[string]bool)
+		chain  = make([]*ChanProfile, 0, 2)
+	)
+
+	for at := name; at != ""; {
+		if seen[at] {
+			return "", nil, fmt.Errorf("profile '%s' inherits itself (via '%s')", name, at)
+		}
+		seen[at] = true
+		p, have := ps[at]
+		if !have || p == nil {
+			if at == name {
+				return "", nil, fmt.Errorf("no profile '%s'", name)
+			}
+			return "", nil, fmt.Errorf("profile '%s' inherits unknown profile '%s'", name, at)
+		}
+		chain = append(chain, p)
+		at = p.Inherits
+	}
+
+	// Start with the most distant ancestor.
+	for i := len(chain) - 1; 0 <= i; i-- {
+		p := chain[i]
+		if p.Type != "" {
+			kind = p.Type
+		}
+		config = MergeConfig(config, p.Config)
+	}
+
+	if kind == "" {
+		return "", nil, fmt.Errorf("profile '%s' has no Type", name)
+	}
+
+	return kind, config, nil
+}
+
+// MergeConfig returns the result of merging over onto base: Maps are
+// merged recursively, and any other value in over replaces the value
+// in base.  Neither argument is modified.
+//
+// Keys are matched case-insensitively (as As decodes them), and a key
+// in over replaces any base key that differs from it only in case.
+func MergeConfig(base, over interface{}) interface{} {
+	if over == nil {
+		return base
+	}
+	bm, is := base.(map[string]interface{})
+	if !is {
+		return over
+	}
+	om, is := over.(map[string]interface{})
+	if !is {
+		return over
+	}
+	acc := make(map[string]interface{}, len(bm)+len(om))
+	for k, v := range bm {
+		acc[k] = v
+	}
+	for k, v := range om {
+		b, have := bm[k]
+		for bk, bv := range bm {
+			if bk != k && strings.EqualFold(bk, k) {
+				if !have {
+					b, have = bv, true
+				}
+				delete(acc, bk)
+			}
+		}
+		acc[k] = MergeConfig(b, v)
+	}
+	return acc
+}
+
+// chanProfiles returns the test's profiles (see Spec.Profiles)
+// followed by the Ctx's.
+func (t *Test) chanProfiles(ctx *Ctx) ChanProfiles {
+	ps := make(ChanProfiles)
+	ps.Add(ctx.Profiles)
+	if t.Spec != nil {
+		ps.Add(t.Spec.Profiles)
+	}
+	return ps
+}
+
+// applyProfile updates the request's Type and Config according to its
+// Profile (if any).  The request's Config is merged over the
+// profile's.
+func (t *Test) applyProfile(ctx *Ctx, req *MotherMakeRequest) error {
+	if req.Profile == "" {
+		return nil
+	}
+	kind, config, err := t.chanProfiles(ctx).Resolve(req.Profile)
+	if err != nil {
+		return err
+	}
+	if req.Type != "" && req.Type != kind {
+		return fmt.Errorf("profile '%s' has type '%s' and not '%s'", req.Profile, kind, req.Type)
+	}
+	req.Type = kind
+	req.Config = MergeConfig(config, req.Config)
+	return nil
+}
+
+// applyOverlay merges the Ctx's overlay (if any) for the request's
+// Type over the request's Config.  See Ctx.ChanOverlays.
+func applyOverlay(ctx *Ctx, req *MotherMakeRequest) {
+	overlay, have := ctx.ChanOverlays[req.Type]
+	if !have {
+		return
+	}
+	ctx.Indf("    Applying %s overlay to %s", req.Type, req.Name)
+	req.Config = MergeConfig(req.Config, overlay)
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChanProfilesResolve(t *testing.T) {
+	ps := ChanProfiles{
+		"base": {
+			Type: "mqtt",
+			Config: map[string]interface{}{
+				"BrokerURL": "ssl://lab:8883",
+				"TLS": map[string]interface{}{
+					"CertFile": "lab.pem",
+					"Insecure": true,
+				},
+			},
+		},
+		"prod": {
+			Inherits: "base",
+			Config: map[string]interface{}{
+				"BrokerURL": "ssl://prod:8883",
+				"TLS": map[string]interface{}{
+					"Insecure": false,
+				},
+			},
+		},
+		"loop1":    {Inherits: "loop2"},
+		"loop2":    {Inherits: "loop1"},
+		"orphan":   {Inherits: "nope"},
+		"typeless": {},
+	}
+
+	kind, config, err := ps.Resolve("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != "mqtt" {
+		t.Fatal(kind)
+	}
+	if got, want := JSON(config), `{"BrokerURL":"ssl://prod:8883","TLS":{"CertFile":"lab.pem","Insecure":false}}`; got != want {
+		t.Fatal(got)
+	}
+
+	// The base profile is unchanged.
+	if got := JSON(ps["base"].Config); got != `{"BrokerURL":"ssl://lab:8883","TLS":{"CertFile":"lab.pem","Insecure":true}}` {
+		t.Fatal(got)
+	}
+
+	for _, name := range []string{"loop1", "orphan", "typeless", "missing"} {
+		if _, _, err := ps.Resolve(name); err == nil {
+			t.Fatalf("%s: expected protest", name)
+		}
+	}
+}
+
+func TestChanProfilesApply(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "profiles", NewSpec())
+	)
+	ctx.Profiles = ChanProfiles{
+		"shared": {
+			Type:   "dataset",
+			Config: map[string]interface{}{"Rate": 10, "Topic": "x"},
+		},
+	}
+	tst.Spec.Profiles = ChanProfiles{
+		"mine": {
+			Inherits: "shared",
+			Config:   map[string]interface{}{"Rate": 20},
+		},
+	}
+
+	req := &MotherMakeRequest{
+		Name:    "c",
+		Profile: "mine",
+		Config:  map[string]interface{}{"Limit": 3},
+	}
+	if err := tst.applyProfile(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Type != "dataset" || JSON(req.Config) != `{"Limit":3,"Rate":20,"Topic":"x"}` {
+		t.Fatal(JSON(req))
+	}
+
+	req = &MotherMakeRequest{
+		Name:    "c",
+		Type:    "mock",
+		Profile: "mine",
+	}
+	if err := tst.applyProfile(ctx, req); err == nil {
+		t.Fatal("expected protest")
+	}
+}
+
+func TestChanOverlays(t *testing.T) {
+	ctx := NewCtx(nil)
+	ctx.ChanOverlays = map[ChanKind]interface{}{
+		"dataset": map[string]interface{}{"Rate": 20},
+	}
+
+	req := &MotherMakeRequest{
+		Name:   "c",
+		Type:   "dataset",
+		Config: map[string]interface{}{"Rate": 10, "Limit": 3},
+	}
+	applyOverlay(ctx, req)
+	if JSON(req.Config) != `{"Limit":3,"Rate":20}` {
+		t.Fatal(JSON(req.Config))
+	}
+
+	req = &MotherMakeRequest{
+		Name:   "c",
+		Type:   "mock",
+		Config: map[string]interface{}{"Rate": 10},
+	}
+	applyOverlay(ctx, req)
+	if JSON(req.Config) != `{"Rate":10}` {
+		t.Fatal(JSON(req.Config))
+	}
+}
+
+func TestMergeConfigCase(t *testing.T) {
+	base := map[string]interface{}{
+		"brokerurl": "profile",
+		"tls": map[string]interface{}{
+			"certfile": "lab.pem",
+			"Insecure": true,
+		},
+	}
+	over := map[string]interface{}{
+		"BrokerURL": "override",
+		"TLS": map[string]interface{}{
+			"CertFile": "prod.pem",
+		},
+	}
+	merged := MergeConfig(base, over)
+	if JSON(merged) != `{"BrokerURL":"override","TLS":{"CertFile":"prod.pem","Insecure":true}}` {
+		t.Fatal(JSON(merged))
+	}
+	if JSON(base) != `{"brokerurl":"profile","tls":{"Insecure":true,"certfile":"lab.pem"}}` {
+		t.Fatal(JSON(base))
+	}
+
+	var opts struct {
+		BrokerURL string
+	}
+	if err := As(merged, &opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.BrokerURL != "override" {
+		t.Fatal(opts.BrokerURL)
+	}
+}
+
+func TestReadChanProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "profiles.yaml")
+	src := `
+lab:
+  type: mock
+  config:
+    x: 1
+`
+	if err = ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ps, err := ReadChanProfiles(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind, _, err := ps.Resolve("lab"); err != nil || kind != "mock" {
+		t.Fatal(kind, err)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Recording is a record of one message that went through a channel.
+//
+// A Recorder writes Recordings (as JSON, one per line), and a
+// ReplayChan reads them.
+type Recording struct {
+	// Test is the Id of the test that was running.
+	Test string `json:"test,omitempty"`
+
+	// Chan is the name of the channel.
+	Chan string `json:"chan"`
+
+	// Kind is the type of the channel.
+	Kind ChanKind `json:"kind"`
+
+	// Op is either "pub" or "recv".
+	Op string `json:"op"`
+
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload"`
+
+	// At is when the message went through the channel.
+	At time.Time `json:"at"`
+}
+
+// Recorder writes Recordings to a file.
+type Recorder struct {
+	sync.Mutex
+
+	// Test is the Id of the test that's running.
+	Test string
+
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewRecorder opens the given file for appending.
+//
+// A relative filename is resolved with respect to ctx.Dir.
+func NewRecorder(ctx *Ctx, filename string) (*Recorder, error) {
+	if !filepath.IsAbs(filename) && ctx.Dir != "" {
+		filename = filepath.Join(ctx.Dir, filename)
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, NewBroken(err)
+	}
+	ctx.Logf("Recording messages to %s", filename)
+	return &Recorder{
+		f:   f,
+		enc: json.NewEncoder(f),
+	}, nil
+}
+
+// Record writes a Recording for the given message.
+func (r *Recorder) Record(ctx *Ctx, name string, kind ChanKind, op string, m Msg) {
+	r.Lock()
+	defer r.Unlock()
+
+	rec := Recording{
+		Test:    r.Test,
+		Chan:    name,
+		Kind:    kind,
+		Op:      op,
+		Topic:   m.Topic,
+		Payload: m.Payload,
+		At:      time.Now().UTC(),
+	}
+	if err := r.enc.Encode(&rec); err != nil {
+		ctx.Warnf("Recorder failed to write: %s", err)
+	}
+}
+
+// Close closes the Recorder's file.
+func (r *Recorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.f.Close()
+}
+
+// Wrap returns a RecordingChan for the given Chan.
+func (r *Recorder) Wrap(name string, c Chan) Chan {
+	return &RecordingChan{
+		name:  name,
+		inner: c,
+		r:     r,
+		c:     make(chan Msg, 1024),
+	}
+}
+
+// RecordingChan wraps another Chan and records all the messages
+// published to or received from that Chan.
+type RecordingChan struct {
+	name  string
+	inner Chan
+	r     *Recorder
+	c     chan Msg
+}
+
+func (c *RecordingChan) Kind() ChanKind {
+	return c.inner.Kind()
+}
+
+// Open opens the wrapped channel and starts forwarding (and
+// recording) its messages.
+func (c *RecordingChan) Open(ctx *Ctx) error {
+	if err := c.inner.Open(ctx); err != nil {
+		return err
+	}
+
+	in := c.inner.Recv(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-in:
+				c.r.Record(ctx, c.name, c.inner.Kind(), "recv", m)
+				select {
+				case <-ctx.Done():
+				case c.c <- m:
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *RecordingChan) Close(ctx *Ctx) error {
+	return c.inner.Close(ctx)
+}
+
+// Healthy reports the health of the wrapped channel, which must be a
+// HealthChecker.
+func (c *RecordingChan) Healthy(ctx *Ctx) error {
+	hc, is := c.inner.(HealthChecker)
+	if !is {
+		return Brokenf("%s channels don't report their health", c.inner.Kind())
+	}
+	return hc.Healthy(ctx)
+}
+
+// Overflow reports an overflow of the wrapped channel's Buffer (if
+// any).  See Overflower.
+func (c *RecordingChan) Overflow() error {
+	if o, is := c.inner.(Overflower); is {
+		return o.Overflow()
+	}
+	return nil
+}
+
+func (c *RecordingChan) Kill(ctx *Ctx) error {
+	return c.inner.Kill(ctx)
+}
+
+func (c *RecordingChan) Sub(ctx *Ctx, topic string) error {
+	return c.inner.Sub(ctx, topic)
+}
+
+func (c *RecordingChan) Pub(ctx *Ctx, m Msg) error {
+	c.r.Record(ctx, c.name, c.inner.Kind(), "pub", m)
+	return c.inner.Pub(ctx, m)
+}
+
+func (c *RecordingChan) Recv(ctx *Ctx) chan Msg {
+	return c.c
+}
+
+func (c *RecordingChan) To(ctx *Ctx, m Msg) error {
+	return c.inner.To(ctx, m)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	var (
+		ctx      = NewCtx(nil)
+		filename = filepath.Join(dir, "recording.jsonl")
+	)
+
+	src := `
+record: ` + filename + `
+spec:
+  phases:
+    phase1:
+      steps:
+        - "$include<include/mock.yaml>"
+        - pub:
+            chan: mock
+            topic: tacos
+            payload: '{"want":"queso"}'
+        - recv:
+            chan: mock
+            pattern: '{"want":"?x"}'
+            timeout: 1s
+`
+
+	ctx.IncludeDirs = []string{"../demos"}
+	bs, err := IncludeYAML(ctx, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tst := NewTest(ctx, "recording", nil)
+	if err := yaml.Unmarshal(bs, &tst); err != nil {
+		t.Fatal(err)
+	}
+	testTest(t, tst)
+
+	bs, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bs), "\n"); n != 2 {
+		t.Fatalf("expected 2 recordings but got %d:\n%s", n, bs)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		c, err := NewReplayChan(ctx, &ReplayOpts{
+			File:      filename,
+			Chan:      "mock",
+			Immediate: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if "replay" != c.Kind() {
+			t.Fatal(c.Kind())
+		}
+		if err = c.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case m := <-c.Recv(ctx):
+			if m.Topic != "tacos" {
+				t.Fatal(m.Topic)
+			}
+			if m.Payload != `{"want":"queso"}` {
+				t.Fatal(m.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("nothing replayed")
+		}
+	})
+
+	t.Run("pub", func(t *testing.T) {
+		c, err := NewReplayChan(ctx, &ReplayOpts{
+			File: filename,
+			Op:   "pub",
+			Chan: "nope",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(c.(*ReplayChan).recs); n != 0 {
+			t.Fatal(n)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := NewReplayChan(ctx, &ReplayOpts{}); err == nil {
+			t.Fatal("should have complained")
+		}
+	})
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecvSeq is a step that receives messages that match a sequence of
+// patterns in order.
+//
+// Each pattern is substituted (like a Recv's pattern) just before
+// it's used, so a pattern can use the bindings from the matches of
+// the previous patterns.
+type RecvSeq struct {
+	Chan string
+
+	// Patterns is the sequence of patterns (see Recv.Pattern).
+	Patterns []interface{}
+
+	// Target is "payload" (the default) or "message" (see
+	// Recv.Target).
+	Target string `json:",omitempty" yaml:",omitempty"`
+
+	// Timeout is the limit for the entire sequence.  Like a
+	// Recv's Timeout, it can use bindings.
+	Timeout time.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// Interleaved allows messages that don't match the next
+	// pattern to arrive between the matching messages.  Without
+	// Interleaved, each message that arrives must match the next
+	// pattern, or the test fails.
+	Interleaved bool `json:",omitempty" yaml:",omitempty"`
+
+	ch Chan
+
+	// timeout is a Timeout that needs bindings substitution.
+	timeout string
+}
+
+// UnmarshalYAML allows a Timeout that uses bindings.
+func (s *RecvSeq) UnmarshalYAML(n *yaml.Node) error {
+	type recvSeq RecvSeq
+	return deferDurations(n, map[string]*string{"timeout": &s.timeout}).Decode((*recvSeq)(s))
+}
+
+func (s *RecvSeq) Substitute(ctx *Ctx, t *Test) (*RecvSeq, error) {
+	if len(s.Patterns) == 0 {
+		return nil, Brokenf("RecvSeq needs at least one pattern")
+	}
+
+	timeout, err := t.Bindings.durationSub(ctx, "RecvSeq Timeout", s.Timeout, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecvSeq{
+		Chan:        s.Chan,
+		Patterns:    s.Patterns,
+		Target:      s.Target,
+		Timeout:     timeout,
+		Interleaved: s.Interleaved,
+		ch:          s.ch,
+	}, nil
+}
+
+// recv returns the prepared Recv for the pattern at the given
+// index.
+func (s *RecvSeq) recv(ctx *Ctx, t *Test, i int) (*Recv, error) {
+	r := &Recv{
+		Chan:    s.Chan,
+		Pattern: s.Patterns[i],
+		Target:  s.Target,
+		ch:      s.ch,
+	}
+	r, err := r.Substitute(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.prepare(ctx, t); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *RecvSeq) Exec(ctx *Ctx, t *Test) error {
+	var (
+		timeout = s.Timeout
+		in      = t.inbound(ctx, s.ch)
+		name    = t.chanName(s.ch)
+	)
+
+	if timeout == 0 {
+		timeout = time.Second * 60 * 20 * 24
+	}
+
+	tm := time.NewTimer(timeout)
+	defer tm.Stop()
+
+	// Messages that a previous Recv set aside are considered
+	// first.
+	pending := t.unhold(name)
+
+	// Hold whatever we don't consider for subsequent Recvs.
+	defer func() {
+		t.hold(name, pending)
+	}()
+
+	for i := range s.Patterns {
+		r, err := s.recv(ctx, t, i)
+		if err != nil {
+			return err
+		}
+		ctx.Indf("    RecvSeq %d/%d", i+1, len(s.Patterns))
+
+		for {
+			if len(pending) == 0 {
+				select {
+				case <-ctx.Done():
+					ctx.Indf("    RecvSeq canceled")
+					return nil
+				case <-tm.C:
+					ctx.Indf("    RecvSeq timeout (%v)", timeout)
+					return Categorize(CategoryTimeout,
+						fmt.Errorf("timeout after %s waiting for pattern %d of %d %s",
+							timeout, i+1, len(s.Patterns), JSON(r.Pattern)))
+				case m := <-in:
+					admit, err := t.admit(ctx, name, &m)
+					if err != nil {
+						return err
+					}
+					if admit {
+						pending = append(pending, m)
+					}
+				}
+			}
+
+			m := pending[0]
+			pending = pending[1:]
+
+			satisfied, err := r.consider(ctx, t, &m)
+			t.history.Add(name, m)
+			if err != nil {
+				return err
+			}
+			if satisfied {
+				break
+			}
+			if !s.Interleaved {
+				return fmt.Errorf("message %s on '%s' doesn't match pattern %d of %d %s",
+					JSON(m.Payload), m.Topic, i+1, len(s.Patterns), JSON(r.Pattern))
+			}
+		}
+	}
+
+	ctx.Indf("    RecvSeq satisfied")
+
+	return nil
+}
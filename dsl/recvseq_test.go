@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecvSeq(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+	run(t, ctx, tst)
+
+	exec := func(step *Step) error {
+		_, err := step.exec(ctx, tst)
+		return err
+	}
+
+	seq := func(interleaved bool, msgs ...string) error {
+		for _, x := range msgs {
+			if err := exec(&Step{Pub: &Pub{Payload: dejson(x)}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return exec(&Step{
+			RecvSeq: &RecvSeq{
+				Patterns: []interface{}{
+					`{"op":"open","id":"?id"}`,
+					`{"op":"write","id":"?id"}`,
+					`{"op":"close","id":"?id"}`,
+				},
+				Timeout:     100 * time.Millisecond,
+				Interleaved: interleaved,
+			},
+		})
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		err := seq(false,
+			`{"op":"open","id":1}`,
+			`{"op":"write","id":1}`,
+			`{"op":"close","id":1}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x := tst.Bindings["?id"]; x != float64(1) {
+			t.Fatal(x)
+		}
+		delete(tst.Bindings, "?id")
+	})
+
+	t.Run("disordered", func(t *testing.T) {
+		err := seq(false,
+			`{"op":"open","id":2}`,
+			`{"op":"close","id":2}`,
+			`{"op":"write","id":2}`)
+		if err == nil {
+			t.Fatal("should have failed")
+		}
+		if _, broke := IsBroken(err); broke {
+			t.Fatal(err)
+		}
+		// Consume the leftover message.
+		err = exec(&Step{Recv: &Recv{Pattern: `{"op":"write"}`, Timeout: time.Second}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		delete(tst.Bindings, "?id")
+	})
+
+	t.Run("interleaved", func(t *testing.T) {
+		err := seq(true,
+			`{"op":"open","id":3}`,
+			`{"op":"write","id":4}`,
+			`{"op":"write","id":3}`,
+			`{"op":"ping"}`,
+			`{"op":"close","id":3}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		delete(tst.Bindings, "?id")
+	})
+
+	t.Run("interleaved-disordered", func(t *testing.T) {
+		err := seq(true,
+			`{"op":"open","id":5}`,
+			`{"op":"close","id":5}`,
+			`{"op":"write","id":5}`)
+		if err == nil {
+			t.Fatal("should have failed")
+		}
+		if c := CategoryOf(err); c != CategoryTimeout {
+			t.Fatal(c, err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		err := exec(&Step{RecvSeq: &RecvSeq{}})
+		if _, broke := IsBroken(err); !broke {
+			t.Fatal(err)
+		}
+	})
+}
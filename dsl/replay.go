@@ -0,0 +1,207 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func init() {
+	TheChanRegistry.Register(NewCtx(nil), "replay", NewReplayChan)
+	TheChanDocs.Register("replay", "Replays messages from a recording.", ReplayOpts{})
+}
+
+// ReplayOpts configures a ReplayChan.
+type ReplayOpts struct {
+	// File is the name of a file of Recordings (as written by a
+	// Recorder).
+	//
+	// A relative filename is resolved with respect to ctx.Dir.
+	File string `doc:"The recording file (relative to the test's directory)."`
+
+	// Chan, if not empty, selects only Recordings for the
+	// channel with this name.
+	Chan string `json:",omitempty" yaml:",omitempty" doc:"Only replay messages recorded for this channel."`
+
+	// Test, if not empty, selects only Recordings for the test
+	// with this Id.
+	Test string `json:",omitempty" yaml:",omitempty" doc:"Only replay messages recorded by the test with this id."`
+
+	// Op selects Recordings with this op ("recv" or "pub").  The
+	// default is "recv".
+	Op string `json:",omitempty" yaml:",omitempty" doc:"Replay messages with this op (recv or pub)." default:"recv"`
+
+	// Scale multiplies the original delays between messages.
+	// The default is 1, which gives the original timing.
+	Scale float64 `json:",omitempty" yaml:",omitempty" doc:"Multiplier for the original delays between messages." default:"1"`
+
+	// Immediate, when true, ignores the original timing and
+	// delivers all messages without delay.
+	Immediate bool `json:",omitempty" yaml:",omitempty" doc:"Deliver all messages without delay."`
+
+	// Overflow is the overflow policy of the channel's Buffer,
+	// which can hold all of the selected Recordings.
+	Overflow string `json:",omitempty" yaml:",omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// ReplayChan delivers previously recorded messages.
+//
+// Pub just logs and discards the given message.
+type ReplayChan struct {
+	opts *ReplayOpts
+	recs []*Recording
+	c    chan Msg
+	buf  *Buffer
+}
+
+// NewReplayChan reads the Recordings given by the options.
+func NewReplayChan(ctx *Ctx, cfg interface{}) (Chan, error) {
+	var opts ReplayOpts
+	if err := As(cfg, &opts); err != nil {
+		return nil, NewBroken(err)
+	}
+	if opts.File == "" {
+		return nil, Brokenf("replay channel needs a File")
+	}
+	if opts.Op == "" {
+		opts.Op = "recv"
+	}
+	if opts.Scale == 0 {
+		opts.Scale = 1
+	}
+
+	filename := opts.File
+	if !filepath.IsAbs(filename) && ctx.Dir != "" {
+		filename = filepath.Join(ctx.Dir, filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, NewBroken(err)
+	}
+	defer f.Close()
+
+	recs := make([]*Recording, 0, 32)
+	in := bufio.NewScanner(f)
+	in.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for in.Scan() {
+		if len(in.Bytes()) == 0 {
+			continue
+		}
+		var rec Recording
+		if err := json.Unmarshal(in.Bytes(), &rec); err != nil {
+			return nil, Brokenf("replay file %s: %s", filename, err)
+		}
+		if opts.Op != rec.Op {
+			continue
+		}
+		if opts.Chan != "" && opts.Chan != rec.Chan {
+			continue
+		}
+		if opts.Test != "" && opts.Test != rec.Test {
+			continue
+		}
+		recs = append(recs, &rec)
+	}
+	if err := in.Err(); err != nil {
+		return nil, NewBroken(err)
+	}
+
+	size := len(recs)
+	if size < 1024 {
+		size = 1024
+	}
+
+	buf, err := NewBuffer("replay", size, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayChan{
+		opts: &opts,
+		recs: recs,
+		c:    buf.C,
+		buf:  buf,
+	}, nil
+}
+
+func (c *ReplayChan) Kind() ChanKind {
+	return "replay"
+}
+
+// Open starts delivering the recorded messages.
+func (c *ReplayChan) Open(ctx *Ctx) error {
+	ctx.Logf("ReplayChan replaying %d messages", len(c.recs))
+	go func() {
+		var then time.Time
+		for i, rec := range c.recs {
+			if !c.opts.Immediate && 0 < i {
+				d := time.Duration(float64(rec.At.Sub(then)) * c.opts.Scale)
+				if 0 < d {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(d):
+					}
+				}
+			}
+			then = rec.At
+			c.To(ctx, Msg{
+				Topic:   rec.Topic,
+				Payload: rec.Payload,
+			})
+		}
+	}()
+	return nil
+}
+
+func (c *ReplayChan) Close(ctx *Ctx) error {
+	return nil
+}
+
+func (c *ReplayChan) Kill(ctx *Ctx) error {
+	return Brokenf("Kill is not supported by a %T", c)
+}
+
+func (c *ReplayChan) Sub(ctx *Ctx, topic string) error {
+	ctx.Logf("ReplayChan Sub %s (ignored)", topic)
+	return nil
+}
+
+func (c *ReplayChan) Pub(ctx *Ctx, m Msg) error {
+	ctx.Logf("ReplayChan Pub topic %s (discarded)", m.Topic)
+	return nil
+}
+
+func (c *ReplayChan) Recv(ctx *Ctx) chan Msg {
+	return c.c
+}
+
+func (c *ReplayChan) To(ctx *Ctx, m Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of the channel's Buffer.  See
+// Overflower.
+func (c *ReplayChan) Overflow() error {
+	return c.buf.Overflow()
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// MaxSubtestDepth limits how deeply RunTests can nest, which stops a
+// test that (perhaps indirectly) runs itself.
+var MaxSubtestDepth = 8
+
+// RunTest is a Step that runs another test as a subtest.
+//
+// The subtest gets its own channels (including its own Mother), and
+// its bindings start with its own bindings plus the RunTest's
+// Bindings.  After the subtest runs, its Results are bound in this
+// test.  A subtest that fails (or is broken) fails (or breaks) the
+// step.
+type RunTest struct {
+	// Filename names the subtest's spec, which is relative to
+	// the test's directory.
+	//
+	// Subject to bindings substitution.
+	Filename string
+
+	// Bindings are initial bindings for the subtest.
+	//
+	// Each value is computed like a Set's value, so
+	// '"?item": "?item"' passes this test's binding for ?item to
+	// the subtest.
+	Bindings map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Results maps variables of this test to variables of the
+	// subtest.  After the subtest runs, each variable is bound to
+	// the value of its subtest variable.  A subtest variable that
+	// isn't bound is an error.
+	Results map[string]string `json:",omitempty" yaml:",omitempty"`
+}
+
+// SubtestResult reports the outcome of a RunTest.
+type SubtestResult struct {
+	Phase string
+
+	// Step is the index of the RunTest in its Phase.
+	Step int
+
+	// Test is the subtest's Id.
+	Test string
+
+	// Error is the subtest's failure (if any).
+	Error string `json:",omitempty"`
+
+	// Broken reports whether the Error means the subtest was
+	// broken.
+	Broken bool `json:",omitempty"`
+
+	// Skipped reports whether the subtest was skipped.
+	Skipped bool `json:",omitempty"`
+
+	Duration time.Duration
+
+	// Subtests are the results of the subtest's own RunTests.
+	Subtests []SubtestResult `json:",omitempty"`
+}
+
+func (r SubtestResult) String() string {
+	acc := fmt.Sprintf("phase %s step %d %s: ", r.Phase, r.Step, r.Test)
+	switch {
+	case r.Skipped:
+		return acc + "skipped"
+	case r.Broken:
+		return acc + "broken: " + r.Error
+	case r.Error != "":
+		return acc + "failed: " + r.Error
+	}
+	return acc + "passed"
+}
+
+// Flatten returns the result followed by the results of its
+// Subtests (recursively).  The Test of a nested result is the path
+// of Test Ids from the outermost subtest (separated by '/').
+func (r SubtestResult) Flatten() []SubtestResult {
+	acc := []SubtestResult{r}
+	for _, s := range r.Subtests {
+		for _, n := range s.Flatten() {
+			n.Test = r.Test + "/" + n.Test
+			acc = append(acc, n)
+		}
+	}
+	acc[0].Subtests = nil
+	return acc
+}
+
+func (r *RunTest) Substitute(ctx *Ctx, t *Test) (*RunTest, error) {
+	filename, err := t.Bindings.StringSub(ctx, r.Filename)
+	if err != nil {
+		return nil, err
+	}
+	bs := make(map[string]interface{}, len(r.Bindings))
+	for p, v := range r.Bindings {
+		if bs[p], err = t.setValue(ctx, v); err != nil {
+			return nil, err
+		}
+	}
+	return &RunTest{
+		Filename: filename,
+		Bindings: bs,
+		Results:  r.Results,
+	}, nil
+}
+
+// load reads and parses the subtest's spec.
+func (r *RunTest) load(ctx *Ctx, t *Test) (*Test, error) {
+	if r.Filename == "" {
+		return nil, Brokenf("RunTest needs a Filename")
+	}
+	filename := t.testFile(r.Filename)
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, NewBroken(err)
+	}
+
+	// The subtest's includes can come from its own directory or
+	// from this test's.
+	dir := filepath.Dir(filename)
+	c := *ctx
+	c.IncludeDirs = append([]string{}, ctx.IncludeDirs...)
+	if t.Dir != "" {
+		c.IncludeDirs = append(c.IncludeDirs, t.Dir)
+	}
+	c.IncludeDirs = append(c.IncludeDirs, dir)
+
+	sub, err := ParseTest(&c, r.Filename, bs)
+	if err != nil {
+		return nil, err
+	}
+	sub.Dir = dir
+	sub.Registry = t.Registry
+	sub.depth = t.depth + 1
+	for p, v := range r.Bindings {
+		sub.Bindings[p] = v
+	}
+	return sub, nil
+}
+
+func (r *RunTest) Exec(ctx *Ctx, t *Test) error {
+	if MaxSubtestDepth <= t.depth {
+		return Brokenf("RunTest %s exceeds the maximum subtest depth (%d)",
+			r.Filename, MaxSubtestDepth)
+	}
+
+	sub, err := r.load(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	var (
+		then   = time.Now()
+		result = SubtestResult{
+			Phase: t.phase,
+			Step:  t.step,
+			Test:  sub.Id,
+		}
+	)
+
+	if err = sub.Init(ctx); err == nil {
+		if errs := sub.Validate(ctx); errs != nil {
+			err = Categorize(CategorySchema, Brokenf("subtest %s validation: %v", sub.Id, errs))
+		}
+	}
+	if err == nil {
+		if errs := sub.Run(ctx); errs != nil {
+			err = errs
+		}
+		if cerr := sub.Close(ctx); err == nil && cerr != nil {
+			err = cerr
+		}
+	}
+	sub.Finalize(ctx)
+
+	result.Duration = time.Now().Sub(then)
+	result.Subtests = sub.Subtests
+	result.Skipped, _ = sub.IsSkipped()
+	if err != nil {
+		result.Error = err.Error()
+		_, result.Broken = IsBroken(err)
+	}
+	t.Subtests = append(t.Subtests, result)
+	t.Assertions += sub.Assertions
+
+	ctx.Indf("    RunTest %s", result)
+
+	if err != nil {
+		if result.Broken {
+			return Brokenf("subtest %s: %w", sub.Id, err)
+		}
+		return fmt.Errorf("subtest %s: %w", sub.Id, err)
+	}
+
+	for p, q := range r.Results {
+		v, have := sub.Bindings[q]
+		if !have {
+			return fmt.Errorf("subtest %s didn't bind %s", sub.Id, q)
+		}
+		ctx.Indf("    RunTest binding %s from %s", p, q)
+		t.Bindings[p] = v
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-runtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, src := range map[string]string{
+		"double.yaml": `
+spec:
+  phases:
+    phase1:
+      steps:
+        - set:
+            "?y": "!!2*bs['?x']"
+`,
+		"fails.yaml": `
+spec:
+  phases:
+    phase1:
+      steps:
+        - run: throw new Error("nope");
+`,
+		"self.yaml": `
+spec:
+  phases:
+    phase1:
+      steps:
+        - runtest:
+            filename: self.yaml
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(rt *RunTest) (*Test, error) {
+		ctx := NewCtx(context.Background())
+		tst := NewTest(ctx, "parent", &Spec{
+			Phases: map[string]*Phase{
+				"phase1": {
+					Steps: []*Step{{RunTest: rt}},
+				},
+			},
+		})
+		tst.Dir = dir
+		tst.Bindings["?n"] = 21
+		if errs := tst.Run(ctx); errs != nil {
+			return tst, errs
+		}
+		return tst, nil
+	}
+
+	t.Run("results", func(t *testing.T) {
+		tst, err := run(&RunTest{
+			Filename: "double.yaml",
+			Bindings: map[string]interface{}{"?x": "?n"},
+			Results:  map[string]string{"?doubled": "?y"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x := tst.Bindings["?doubled"]; x != float64(42) && x != int64(42) {
+			t.Fatalf("%T %v", x, x)
+		}
+		if len(tst.Subtests) != 1 || tst.Subtests[0].String() != "phase phase1 step 0 double.yaml: passed" {
+			t.Fatal(tst.Subtests)
+		}
+	})
+
+	t.Run("unbound", func(t *testing.T) {
+		_, err := run(&RunTest{
+			Filename: "double.yaml",
+			Bindings: map[string]interface{}{"?x": 1},
+			Results:  map[string]string{"?z": "?nope"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "didn't bind ?nope") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		tst, err := run(&RunTest{
+			Filename: "fails.yaml",
+		})
+		if err == nil {
+			t.Fatal("wanted an error")
+		}
+		if len(tst.Subtests) != 1 || !strings.Contains(tst.Subtests[0].Error, "nope") {
+			t.Fatal(tst.Subtests)
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		tst, err := run(&RunTest{
+			Filename: "self.yaml",
+		})
+		if _, broken := IsBroken(err); !broken {
+			t.Fatal(err)
+		}
+		var depth int
+		for _, r := range tst.Subtests[0].Flatten() {
+			if !r.Broken {
+				t.Fatal(r)
+			}
+			depth++
+		}
+		if depth != MaxSubtestDepth {
+			t.Fatal(depth)
+		}
+	})
+}
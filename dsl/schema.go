@@ -0,0 +1,288 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SchemaDraft is the JSON Schema version for JSONSchema().
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// IncludeSchema describes a string that (YAML-)includes another
+// file.  See Include().
+var IncludeSchema = map[string]interface{}{
+	"type":        "string",
+	"pattern":     `^[#$]include<.*>$`,
+	"description": "Include the YAML in the given file",
+}
+
+// JSONSchema generates a JSON Schema for the YAML representation of
+// the given value's type.
+//
+// Property names follow yaml.v3: a field's yaml tag name if given or
+// else the field's name in lowercase.  Since Include() processes
+// YAML before it's parsed, objects may have 'include' and
+// 'includes' properties, and an object or an array element can be a
+// '#include<FILENAME>' or '$include<FILENAME>' string.  Since specs
+// conventionally document things with 'doc' properties, every
+// object can have a 'doc' string.
+func JSONSchema(x interface{}, title string) map[string]interface{} {
+	g := &schemaGen{
+		defs: map[string]interface{}{
+			"include": IncludeSchema,
+		},
+	}
+
+	t := reflect.TypeOf(x)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var s map[string]interface{}
+	if t.Kind() == reflect.Struct {
+		s = g.object(t)
+	} else {
+		s = g.gen(t)
+	}
+	s["$schema"] = SchemaDraft
+	s["title"] = title
+	s["definitions"] = g.defs
+
+	return s
+}
+
+type schemaGen struct {
+	defs map[string]interface{}
+}
+
+// schemaAlternatives is implemented by types with custom YAML
+// unmarshalling that accept representations other than an object.
+type schemaAlternatives interface {
+	SchemaAlternatives() []interface{}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func (g *schemaGen) gen(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{
+			"type":   "string",
+			"format": "date-time",
+		}
+	}
+
+	if t == durationType {
+		// YAML can represent a duration in Go syntax (e.g.,
+		// "1s") or in nanoseconds.
+		return map[string]interface{}{
+			"type": []interface{}{"string", "integer"},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"anyOf": []interface{}{
+					g.gen(t.Elem()),
+					map[string]interface{}{"$ref": "#/definitions/include"},
+				},
+			},
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.gen(t.Elem()),
+		}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return g.object(t)
+		}
+		if _, have := g.defs[name]; !have {
+			// Placeholder to terminate recursion.
+			g.defs[name] = nil
+			g.defs[name] = g.object(t)
+		}
+		alts := []interface{}{
+			map[string]interface{}{"$ref": "#/definitions/" + name},
+			map[string]interface{}{"$ref": "#/definitions/include"},
+		}
+		if x, is := reflect.New(t).Interface().(schemaAlternatives); is {
+			alts = append(alts, x.SchemaAlternatives()...)
+		}
+		return map[string]interface{}{
+			"anyOf": alts,
+		}
+	}
+
+	// Interfaces can be anything.
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{
+		"include": map[string]interface{}{"type": "string"},
+		"includes": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+		},
+		"doc": map[string]interface{}{"type": "string"},
+	}
+	for name, ft := range YAMLFields(t) {
+		props[name] = g.gen(ft)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// YAMLFields returns the YAML property names for the fields of the
+// given struct type (following yaml.v3) mapped to the fields' types.
+//
+// Fields that can't be usefully represented in YAML (functions,
+// channels, maps of functions) are excluded.
+func YAMLFields(t reflect.Type) map[string]reflect.Type {
+	acc := make(map[string]reflect.Type)
+	yamlFields(t, acc)
+	return acc
+}
+
+func yamlFields(t reflect.Type, acc map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			// Unexported
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Func, reflect.Chan:
+			continue
+		case reflect.Map:
+			if f.Type.Elem().Kind() == reflect.Func {
+				// Like a ChanRegistry.
+				continue
+			}
+		}
+
+		var (
+			tag     = f.Tag.Get("yaml")
+			opts    = strings.Split(tag, ",")
+			name    = opts[0]
+			inlined = false
+		)
+		if name == "-" {
+			continue
+		}
+		for _, opt := range opts[1:] {
+			if opt == "inline" {
+				inlined = true
+			}
+		}
+
+		if inlined {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				yamlFields(ft, acc)
+				continue
+			}
+		}
+
+		if f.Anonymous && f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		acc[name] = f.Type
+	}
+}
+
+var (
+	testSchema     *gojsonschema.Schema
+	testSchemaErr  error
+	testSchemaOnce sync.Once
+)
+
+// CheckTestSchema validates the given (YAML-included and parsed)
+// test against the JSON Schema for a Test (see JSONSchema), which
+// finds problems like misspelled properties that parsing ignores.
+func CheckTestSchema(x interface{}) []error {
+	testSchemaOnce.Do(func() {
+		loader := gojsonschema.NewGoLoader(JSONSchema(Test{}, "Plax test"))
+		testSchema, testSchemaErr = gojsonschema.NewSchema(loader)
+	})
+	if testSchemaErr != nil {
+		return []error{testSchemaErr}
+	}
+
+	// The YAML parser can give maps with non-string keys, which
+	// the JSON Schema library can't handle.
+	result, err := testSchema.Validate(gojsonschema.NewGoLoader(Canon(x)))
+	if err != nil {
+		return []error{err}
+	}
+
+	// Every failure below an anyOf (which the schema uses for
+	// includes) also reports that anyOf, so those reports are
+	// just noise unless they're all we have.
+	var errs, anyOfs []error
+	for _, e := range result.Errors() {
+		err := fmt.Errorf("schema: %s", e)
+		if e.Type() == "number_any_of" {
+			anyOfs = append(anyOfs, err)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return anyOfs
+	}
+	return errs
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s := JSONSchema(Test{}, "test")
+
+	props, is := s["properties"].(map[string]interface{})
+	if !is {
+		t.Fatal(s)
+	}
+	for _, p := range []string{"spec", "labels", "negative", "include"} {
+		if _, have := props[p]; !have {
+			t.Fatal(p)
+		}
+	}
+	if _, have := props["registry"]; have {
+		t.Fatal("registry shouldn't be a property")
+	}
+
+	defs := s["definitions"].(map[string]interface{})
+	step, is := defs["Step"].(map[string]interface{})
+	if !is {
+		t.Fatal(defs)
+	}
+	stepProps := step["properties"].(map[string]interface{})
+	for _, p := range []string{"pub", "recv", "goto", "wait"} {
+		if _, have := stepProps[p]; !have {
+			t.Fatal(p)
+		}
+	}
+
+	recv := defs["Recv"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, have := recv["clearbindings"]; !have {
+		t.Fatal("Recv should have clearbindings")
+	}
+}
+
+// TestCheckTestSchemaDemos checks that the schema, which is supposed
+// to be authoritative, accepts all of the demos.
+func TestCheckTestSchemaDemos(t *testing.T) {
+	filenames, err := filepath.Glob("../demos/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range filenames {
+		t.Run(filename, func(t *testing.T) {
+			bs, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := NewCtx(nil)
+			ctx.IncludeDirs = []string{"../demos"}
+			if bs, err = IncludeYAML(ctx, bs); err != nil {
+				t.Fatal(err)
+			}
+			var x interface{}
+			if err = yaml.Unmarshal(bs, &x); err != nil {
+				t.Fatal(err)
+			}
+			for _, err := range CheckTestSchema(x) {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckTestSchemaTypo(t *testing.T) {
+	src := `
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            doc: Typo below
+            paylod: hello
+`
+	var x interface{}
+	if err := yaml.Unmarshal([]byte(src), &x); err != nil {
+		t.Fatal(err)
+	}
+	errs := CheckTestSchema(x)
+	if len(errs) != 1 {
+		t.Fatal(errs)
+	}
+	if !strings.Contains(errs[0].Error(), "paylod") {
+		t.Fatal(errs[0])
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+)
+
+const (
+	// ScopeTest, the default Phase Scope, keeps the bindings
+	// that a phase makes for the rest of the test.
+	ScopeTest = "test"
+
+	// ScopePhase discards the bindings that a phase makes (or
+	// changes) when the phase ends, except for those that the
+	// phase Exports.
+	ScopePhase = "phase"
+)
+
+// checkScope checks a Phase's Scope.
+func checkScope(scope string) error {
+	switch scope {
+	case "", ScopeTest, ScopePhase:
+		return nil
+	}
+	return fmt.Errorf("unknown Scope '%s' (want %s or %s)", scope, ScopeTest, ScopePhase)
+}
+
+// bindingsScope is the state of a phase with ScopePhase.
+type bindingsScope struct {
+	// saved is the test's bindings when the phase started.
+	saved map[string]interface{}
+
+	// exported maps the names of exported variables to their
+	// values when they were exported.
+	exported map[string]interface{}
+}
+
+// enterScope starts a phase-local bindings scope and returns the
+// function that ends it.  That function restores the bindings that
+// the phase started with plus the exported bindings.
+func (t *Test) enterScope(ctx *Ctx) func() {
+	s := &bindingsScope{
+		saved:    CopyBindings(t.Bindings),
+		exported: make(map[string]interface{}),
+	}
+	outer := t.scope
+	t.scope = s
+
+	return func() {
+		t.scope = outer
+		bs := s.saved
+		for name, v := range s.exported {
+			// Use the current value if there is one,
+			// since the phase might have updated the
+			// variable after exporting it.
+			if x, have := t.Bindings[name]; have {
+				v = x
+			}
+			bs[name] = v
+		}
+		ctx.Indf("    Ending phase scope (%d exported)", len(s.exported))
+		t.Bindings = bs
+	}
+}
+
+// Export is a Step that promotes variables that are bound in a
+// phase with ScopePhase to test scope, so the bindings survive the
+// end of the phase.
+//
+// In a phase with ScopeTest, all bindings are already in test
+// scope, so an Export has no effect.
+type Export []string
+
+func (e Export) Exec(ctx *Ctx, t *Test) error {
+	for _, name := range e {
+		v, have := t.Bindings[name]
+		if !have {
+			return fmt.Errorf("can't export %s, which isn't bound", name)
+		}
+		if t.scope == nil {
+			ctx.Indf("    Export %s (already in test scope)", name)
+			continue
+		}
+		ctx.Indf("    Export %s", name)
+		t.scope.exported[name] = v
+	}
+	return nil
+}
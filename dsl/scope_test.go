@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	run := func(t *testing.T, phases map[string]*Phase) *Test {
+		t.Helper()
+		tst := NewTest(ctx, "a", &Spec{
+			Phases: phases,
+		})
+		if errs := tst.Validate(ctx); 0 < len(errs) {
+			t.Fatal(errs)
+		}
+		if err := tst.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return tst
+	}
+
+	t.Run("phase", func(t *testing.T) {
+		tst := run(t, map[string]*Phase{
+			"phase1": {
+				Steps: []*Step{
+					{Set: Set{"?x": 1, "?y": 1}},
+					{Goto: "local"},
+				},
+			},
+			"local": {
+				Scope: ScopePhase,
+				Steps: []*Step{
+					{Set: Set{"?x": 2, "?z": 2, "?w": 2}},
+					{Export: Export{"?w"}},
+					{Set: Set{"?w": 3}},
+				},
+			},
+		})
+		want := map[string]interface{}{
+			"?x": 1,
+			"?y": 1,
+			"?w": 3,
+		}
+		if got := JSON(tst.Bindings); got != JSON(want) {
+			t.Fatalf("got %s; wanted %s", got, JSON(want))
+		}
+		if tst.scope != nil {
+			t.Fatal("scope remains")
+		}
+	})
+
+	t.Run("test", func(t *testing.T) {
+		tst := run(t, map[string]*Phase{
+			"phase1": {
+				Scope: ScopeTest,
+				Steps: []*Step{
+					{Set: Set{"?x": 1}},
+					{Export: Export{"?x"}},
+				},
+			},
+		})
+		if _, have := tst.Bindings["?x"]; !have {
+			t.Fatal("?x is gone")
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		tst := run(t, map[string]*Phase{
+			"phase1": {
+				Scope: ScopePhase,
+				Table: &Table{
+					Rows: []interface{}{
+						map[string]interface{}{"?n": 1},
+						map[string]interface{}{"?n": 2},
+					},
+				},
+				Steps: []*Step{
+					{Set: Set{"?last": "?n"}},
+					{Export: Export{"?last"}},
+				},
+			},
+		})
+		if got := tst.Bindings["?last"]; got != float64(2) {
+			t.Fatalf("got %#v", got)
+		}
+		if _, have := tst.Bindings["?n"]; have {
+			t.Fatal("?n remains")
+		}
+	})
+
+	t.Run("unbound", func(t *testing.T) {
+		tst := NewTest(ctx, "a", &Spec{})
+		if err := (Export{"?nope"}).Exec(ctx, tst); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		tst := NewTest(ctx, "a", &Spec{
+			Phases: map[string]*Phase{
+				"phase1": {
+					Scope: "global",
+					Steps: []*Step{
+						{Doc: "nothing"},
+					},
+				},
+			},
+		})
+		if errs := tst.Validate(ctx); len(errs) == 0 {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in logs and reports.
+var Redacted = "<redacted>"
+
+// IsSecretBinding reports whether the binding with the given name
+// holds a secret.
+//
+// After removing any leading '?', '!', and '*' characters, a secret
+// binding's name starts with "secret" (case-insensitive).  Examples:
+// "?!secret_token", "?SECRET_PASSWORD".
+func IsSecretBinding(name string) bool {
+	s := strings.TrimLeft(name, "?!*")
+	return strings.HasPrefix(strings.ToLower(s), "secret")
+}
+
+// Redactor removes secret values from strings.
+type Redactor struct {
+	sync.RWMutex
+
+	secrets  map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewRedactor makes an empty Redactor.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		secrets: make(map[string]bool),
+	}
+}
+
+// DefaultRedactor is the Redactor that NewCtx uses.
+//
+// Secrets are process-wide, so this Redactor is shared.
+var DefaultRedactor = NewRedactor()
+
+// Add a secret value.
+func (r *Redactor) Add(secret string) {
+	if r == nil || secret == "" {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.secrets[secret] {
+		return
+	}
+	r.secrets[secret] = true
+
+	// The secret might also appear in JSON.
+	if js, err := json.Marshal(secret); err == nil {
+		if s := string(js[1 : len(js)-1]); s != secret {
+			r.secrets[s] = true
+		}
+	}
+
+	// Replace longer secrets first.
+	ss := make([]string, 0, len(r.secrets))
+	for s := range r.secrets {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return len(ss[i]) > len(ss[j])
+	})
+
+	olds := make([]string, 0, 2*len(ss))
+	for _, s := range ss {
+		olds = append(olds, s, Redacted)
+	}
+	r.replacer = strings.NewReplacer(olds...)
+}
+
+// AddBindings adds the values of secret bindings.
+//
+// See IsSecretBinding().
+func (r *Redactor) AddBindings(bs Bindings) {
+	for name, x := range bs {
+		if !IsSecretBinding(name) {
+			continue
+		}
+		s, is := x.(string)
+		if !is {
+			s = JSON(x)
+		}
+		r.Add(s)
+	}
+}
+
+// Redact replaces all secrets in the given string.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// SecretRef refers to a secret in a SecretProvider.
+type SecretRef struct {
+	// Provider is the name of a registered SecretProvider.
+	Provider string `json:"provider" yaml:"provider"`
+
+	// Name identifies the secret.  The interpretation depends
+	// on the provider.  For example, "env" uses an environment
+	// variable with this name.
+	Name string `json:"name" yaml:"name"`
+
+	// Key, if not empty, is the property of the secret (as a
+	// JSON object) to use.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+
+	// Opts are provider-specific options (like an authentication
+	// method).  See each provider's documentation.
+	Opts map[string]interface{} `json:"opts,omitempty" yaml:"opts,omitempty"`
+}
+
+// Opt returns the string representation of the named option (or ""
+// if there's no such option).
+func (ref *SecretRef) Opt(name string) string {
+	x, have := ref.Opts[name]
+	if !have || x == nil {
+		return ""
+	}
+	if s, is := x.(string); is {
+		return s
+	}
+	return fmt.Sprintf("%v", x)
+}
+
+// SecretProvider resolves a reference to a secret value.
+type SecretProvider func(ctx *Ctx, ref *SecretRef) (string, error)
+
+// SecretProviders maps names to SecretProviders.
+type SecretProviders map[string]SecretProvider
+
+// Register a SecretProvider.
+func (ps SecretProviders) Register(ctx *Ctx, name string, p SecretProvider) {
+	ps[name] = p
+}
+
+// TheSecretProviders is the global, well-known registry of
+// SecretProviders.
+var TheSecretProviders = make(SecretProviders)
+
+func init() {
+	TheSecretProviders.Register(NewCtx(nil), "env", EnvSecretProvider)
+	TheSecretProviders.Register(NewCtx(nil), "file", FileSecretProvider)
+}
+
+// Resolve gets the value of the referenced secret and then adds
+// that value to the Ctx's Redactor.
+func (ps SecretProviders) Resolve(ctx *Ctx, ref *SecretRef) (string, error) {
+	p, have := ps[ref.Provider]
+	if !have {
+		return "", fmt.Errorf("unknown secret provider '%s'", ref.Provider)
+	}
+
+	s, err := p(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("secret provider %s: %w", ref.Provider, err)
+	}
+
+	if ref.Key != "" {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			return "", fmt.Errorf("secret %s isn't a JSON object", ref.Name)
+		}
+		x, have := m[ref.Key]
+		if !have {
+			return "", fmt.Errorf("secret %s has no key '%s'", ref.Name, ref.Key)
+		}
+		if s, have = x.(string); !have {
+			s = JSON(x)
+		}
+	}
+
+	ctx.Redactor.Add(s)
+
+	return s, nil
+}
+
+// EnvSecretProvider gets the value of the environment variable
+// given by the ref's Name.
+func EnvSecretProvider(ctx *Ctx, ref *SecretRef) (string, error) {
+	s, have := os.LookupEnv(ref.Name)
+	if !have {
+		return "", fmt.Errorf("no environment variable '%s'", ref.Name)
+	}
+	return s, nil
+}
+
+// FileSecretProvider reads the file given by the ref's Name.
+//
+// A trailing newline is removed.
+func FileSecretProvider(ctx *Ctx, ref *SecretRef) (string, error) {
+	bs, err := ioutil.ReadFile(ref.Name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(bs), "\n"), nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+type bufLogger struct {
+	acc []string
+}
+
+func (l *bufLogger) Printf(format string, args ...interface{}) {
+	l.acc = append(l.acc, fmt.Sprintf(format, args...))
+}
+
+func TestSecrets(t *testing.T) {
+	for name, want := range map[string]bool{
+		"?!secret_token": true,
+		"?SECRET":        true,
+		"?*secretly":     true,
+		"?token":         false,
+		"?!not_secret":   false,
+	} {
+		if got := IsSecretBinding(name); got != want {
+			t.Fatal(name)
+		}
+	}
+
+	t.Run("redact", func(t *testing.T) {
+		var (
+			l   = &bufLogger{}
+			ctx = NewCtx(nil)
+		)
+		ctx.Logger = l
+		ctx.Redactor = NewRedactor()
+		ctx.Redactor.AddBindings(Bindings{
+			"?!secret_token": `sh"h`,
+			"?x":             "tacos",
+		})
+
+		ctx.Logf("token %s and %s", `sh"h`, JSON(`sh"h`))
+		ctx.Logf("want tacos")
+
+		if strings.Contains(l.acc[0], "sh") {
+			t.Fatal(l.acc[0])
+		}
+		if l.acc[1] != "> want tacos" {
+			t.Fatal(l.acc[1])
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("PLAX_TEST_SECRET", `{"password":"queso"}`)
+		defer os.Unsetenv("PLAX_TEST_SECRET")
+
+		ctx := NewCtx(nil)
+		ctx.Redactor = NewRedactor()
+		s, err := TheSecretProviders.Resolve(ctx, &SecretRef{
+			Provider: "env",
+			Name:     "PLAX_TEST_SECRET",
+			Key:      "password",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != "queso" {
+			t.Fatal(s)
+		}
+		if got := ctx.Redactor.Redact("queso"); got != Redacted {
+			t.Fatal(got)
+		}
+
+		if _, err = TheSecretProviders.Resolve(ctx, &SecretRef{
+			Provider: "tacos",
+		}); err == nil {
+			t.Fatal("should have complained")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"sort"
+	"strings"
+)
+
+// Set is a step that binds variables directly.
+//
+// Each value is subject to bindings substitution.  A string value
+// that starts with "!!" is instead a Javascript expression, which is
+// evaluated in the test's Javascript environment (so bindings,
+// history(), and libraries are available).  Unlike "!!" elsewhere,
+// the expression's value isn't converted to a string.
+//
+// All values are computed before any variables are bound, so one
+// value can't refer to a variable bound by the same Set.
+type Set map[string]interface{}
+
+// Exec computes the values and then binds them.
+func (s Set) Exec(ctx *Ctx, t *Test) error {
+	// Sort for deterministic logging and errors.
+	ps := make([]string, 0, len(s))
+	for p := range s {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+
+	acc := make(map[string]interface{}, len(s))
+	for _, p := range ps {
+		x, err := t.setValue(ctx, s[p])
+		if err != nil {
+			return err
+		}
+		acc[p] = x
+	}
+
+	if t.Bindings == nil {
+		t.Bindings = make(map[string]interface{})
+	}
+	for _, p := range ps {
+		ctx.Indf("    Set %s", p)
+		t.Bindings[p] = acc[p]
+	}
+	ctx.Redactor.AddBindings(t.Bindings)
+
+	return nil
+}
+
+func (t *Test) setValue(ctx *Ctx, v interface{}) (interface{}, error) {
+	if s, is := v.(string); is && strings.HasPrefix(s, "!!") {
+		src, err := t.Bindings.StringSub(ctx, s[2:])
+		if err != nil {
+			return nil, err
+		}
+		x, err := t.JSExec(ctx, src, t.jsEnv(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return Canon(x), nil
+	}
+
+	var x interface{}
+	if err := t.Bindings.Sub(ctx, v, &x, false); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
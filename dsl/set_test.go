@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	var (
+		ctx = NewCtx(nil)
+		tst = NewTest(ctx, "", nil)
+	)
+	tst.Bindings = map[string]interface{}{
+		"?want": "tacos",
+		"?n":    2,
+	}
+
+	s := Set{
+		"?order": map[string]interface{}{"want": "?want"},
+		"?twice": `!!2*bs["?n"]`,
+		"?obj":   `!!({"n":bs["?n"]})`,
+		"?n":     3,
+	}
+	if err := s.Exec(ctx, tst); err != nil {
+		t.Fatal(err)
+	}
+
+	if js := JSON(tst.Bindings["?order"]); js != `{"want":"tacos"}` {
+		t.Fatal(js)
+	}
+	// Values are computed before any are bound.
+	if js := JSON(tst.Bindings["?twice"]); js != `4` {
+		t.Fatal(js)
+	}
+	if js := JSON(tst.Bindings["?obj"]); js != `{"n":2}` {
+		t.Fatal(js)
+	}
+	if js := JSON(tst.Bindings["?n"]); js != `3` {
+		t.Fatal(js)
+	}
+
+	if err := (Set{"?x": "!!nope("}).Exec(ctx, tst); err == nil {
+		t.Fatal("should have complained")
+	}
+}
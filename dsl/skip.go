@@ -0,0 +1,198 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Skip specifies whether (and why) to skip a Step or a Test.
+//
+// In YAML, a Skip can be a boolean (the old form), a string (the
+// reason), or an object with the fields below.  An object without a
+// condition (neither If nor Platforms) always skips.  When both
+// conditions are given, both must hold.
+type Skip struct {
+	// Reason is an optional explanation for the report.
+	//
+	// Subject to bindings substitution.
+	Reason string `json:",omitempty" yaml:",omitempty"`
+
+	// If is optional Javascript that should return a boolean.
+	// When given, skip only if the code returns true.
+	//
+	// Subject to bindings substitution.
+	If string `json:",omitempty" yaml:",omitempty"`
+
+	// Platforms, when not empty, restricts skipping to these
+	// platforms, which have the form GOOS (e.g., "windows") or
+	// GOOS/GOARCH (e.g., "linux/arm64").
+	Platforms []string `json:",omitempty" yaml:",omitempty"`
+
+	// off is true for 'skip: false'.
+	off bool
+}
+
+// UnmarshalYAML accepts a boolean, a string (the Reason), or an
+// object.
+func (s *Skip) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		var b bool
+		if n.Tag == "!!bool" && n.Decode(&b) == nil {
+			s.off = !b
+			return nil
+		}
+		s.Reason = n.Value
+		return nil
+	}
+	type skip Skip
+	return n.Decode((*skip)(s))
+}
+
+// MarshalYAML gives false for a Skip that's off.
+func (s *Skip) MarshalYAML() (interface{}, error) {
+	if s.off {
+		return false, nil
+	}
+	type skip Skip
+	return (*skip)(s), nil
+}
+
+// UnmarshalJSON accepts a boolean, a string (the Reason), or an
+// object.
+func (s *Skip) UnmarshalJSON(js []byte) error {
+	var x interface{}
+	if err := json.Unmarshal(js, &x); err != nil {
+		return err
+	}
+	switch vv := x.(type) {
+	case bool:
+		s.off = !vv
+		return nil
+	case string:
+		s.Reason = vv
+		return nil
+	}
+	type skip Skip
+	return json.Unmarshal(js, (*skip)(s))
+}
+
+// MarshalJSON gives false for a Skip that's off.
+func (s *Skip) MarshalJSON() ([]byte, error) {
+	if s.off {
+		return []byte("false"), nil
+	}
+	type skip Skip
+	return json.Marshal((*skip)(s))
+}
+
+// SchemaAlternatives gives the YAML representations other than an
+// object for JSONSchema().
+func (s *Skip) SchemaAlternatives() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"type": "boolean"},
+		map[string]interface{}{"type": "string"},
+	}
+}
+
+// Platform returns the current platform as GOOS/GOARCH.
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// onPlatform reports whether the current platform matches one of the
+// given platforms.
+func onPlatform(platforms []string) bool {
+	for _, p := range platforms {
+		if p == runtime.GOOS || p == Platform() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports whether to skip and, if so, why.
+//
+// A nil Skip never skips.
+func (s *Skip) Check(ctx *Ctx, t *Test) (bool, string, error) {
+	if s == nil || s.off {
+		return false, "", nil
+	}
+
+	if 0 < len(s.Platforms) && !onPlatform(s.Platforms) {
+		return false, "", nil
+	}
+
+	if s.If != "" {
+		code, err := t.Bindings.StringSub(ctx, s.If)
+		if err != nil {
+			return false, "", err
+		}
+		src, err := t.prepareSource(ctx, code)
+		if err != nil {
+			return false, "", err
+		}
+		x, err := t.JSExec(ctx, src, t.jsEnv(ctx))
+		if err != nil {
+			return false, "", err
+		}
+		b, is := x.(bool)
+		if !is {
+			return false, "", Brokenf("Skip If Javascript returned a %T (%v) and not a bool", x, x)
+		}
+		if !b {
+			return false, "", nil
+		}
+	}
+
+	reason, err := t.Bindings.StringSub(ctx, s.Reason)
+	if err != nil {
+		return false, "", err
+	}
+
+	return true, reason, nil
+}
+
+// Skipped reports a skipped Test or Step.
+type Skipped struct {
+	// Phase is the phase of a skipped Step.
+	Phase string `json:",omitempty"`
+
+	// Step is the index of a skipped Step in its Phase.
+	Step int `json:",omitempty"`
+
+	// Reason is the Skip's Reason (if any).
+	Reason string `json:",omitempty"`
+}
+
+func (s Skipped) String() string {
+	var acc string
+	if s.Phase == "" {
+		acc = "test"
+	} else {
+		acc = fmt.Sprintf("phase %s step %d", s.Phase, s.Step)
+	}
+	if s.Reason != "" {
+		acc += ": " + s.Reason
+	}
+	return acc
+}
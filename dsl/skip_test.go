@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSkipYAML(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", nil)
+
+	for src, want := range map[string]bool{
+		"skip: true":                                true,
+		"skip: false":                               false,
+		"skip: not today":                           true,
+		"skip: {reason: later}":                     true,
+		"skip: {if: 'return 1 < 2;'}":               true,
+		"skip: {if: 'return 2 < 1;'}":               false,
+		"skip: {platforms: [plan9/mips]}":           false,
+		"skip: {platforms: [" + runtime.GOOS + "]}": true,
+	} {
+		var s struct {
+			Skip *Skip
+		}
+		if err := yaml.Unmarshal([]byte(src), &s); err != nil {
+			t.Fatal(err)
+		}
+		skip, _, err := s.Skip.Check(ctx, tst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skip != want {
+			t.Fatalf("%s: wanted %v", src, want)
+		}
+
+		// JSON round trip
+		js, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Skip = nil
+		if err = json.Unmarshal(js, &s); err != nil {
+			t.Fatal(err)
+		}
+		if skip, _, _ = s.Skip.Check(ctx, tst); skip != want {
+			t.Fatalf("%s: JSON %s: wanted %v", src, js, want)
+		}
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	tst := NewTest(ctx, "a", nil)
+	tst.Bindings["?env"] = "staging"
+
+	s := &Skip{
+		Reason: "not in {?env}",
+		If:     `return "{?env}" == "staging";`,
+	}
+	skip, reason, err := s.Check(ctx, tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !skip || reason != "not in staging" {
+		t.Fatal(skip, reason)
+	}
+
+	s.If = "return 42;"
+	if _, _, err = s.Check(ctx, tst); err == nil {
+		t.Fatal("expected an error for a non-boolean If")
+	}
+}
+
+func TestSkipRun(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	t.Run("step", func(t *testing.T) {
+		tst := NewTest(ctx, "a", &Spec{
+			Phases: map[string]*Phase{
+				"phase1": {
+					Steps: []*Step{
+						{
+							Run: "test.State.ran = true;",
+							Skip: &Skip{
+								Reason: "later",
+							},
+						},
+					},
+				},
+			},
+		})
+		if err := tst.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, have := tst.State["ran"]; have {
+			t.Fatal("skipped step ran")
+		}
+		if len(tst.Skipped) != 1 || tst.Skipped[0].String() != "phase phase1 step 0: later" {
+			t.Fatal(tst.Skipped)
+		}
+		if skipped, _ := tst.IsSkipped(); skipped {
+			t.Fatal("test shouldn't be skipped")
+		}
+	})
+
+	t.Run("test", func(t *testing.T) {
+		tst := NewTest(ctx, "a", &Spec{
+			Phases: map[string]*Phase{
+				"phase1": {
+					Steps: []*Step{
+						{
+							Run: "test.State.ran = true;",
+						},
+					},
+				},
+			},
+		})
+		tst.Skip = &Skip{
+			Reason: "broken",
+		}
+		if err := tst.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, have := tst.State["ran"]; have {
+			t.Fatal("skipped test ran")
+		}
+		if skipped, reason := tst.IsSkipped(); !skipped || reason != "broken" {
+			t.Fatal(skipped, reason)
+		}
+	})
+}
@@ -23,13 +23,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Comcast/plax/metrics"
 	"github.com/Comcast/sheens/match"
+	"gopkg.in/yaml.v3"
 )
 
 var DefaultInitialPhase = "phase1"
 
 // Spec represents a set of named test Phases.
 type Spec struct {
+	// Metadata optionally describes the test for reports and
+	// filters.  See Test.ApplyMetadata.
+	Metadata *Metadata `json:",omitempty" yaml:",omitempty"`
+
 	// InitialPhase is the starting phase, which defaults to
 	// DefaultInitialPhase.
 	InitialPhase string
@@ -42,6 +48,33 @@ type Spec struct {
 	//
 	// Each Phase is subject to bindings substitution.
 	Phases map[string]*Phase
+
+	// Params optionally declares the bindings (by name) that
+	// this test expects.  See Spec.CheckParams().
+	Params map[string]*Param `json:",omitempty" yaml:",omitempty"`
+
+	// Fixtures maps names to payload (or pattern) templates,
+	// which a Pub or Recv can use (via its Fixture) instead of
+	// its own Payload or Pattern.
+	Fixtures map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Schemas maps names to JSON Schemas, which a Pub or Recv
+	// can use (via its Schema) by name.  A named schema can
+	// refer to another by name ("$ref": "NAME").
+	Schemas map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Profiles are channel profiles for this test, which take
+	// precedence over (and can inherit from) the profiles in
+	// Ctx.Profiles.  See ChanProfile.
+	Profiles ChanProfiles `json:",omitempty" yaml:",omitempty"`
+
+	// MinAssertions, when positive, is the minimum number of
+	// assertions (successful Recv and RecvSeq steps on channels
+	// other than Mother) that a Run
+	// must execute.  A Run that executes fewer (perhaps because a
+	// Branch bypassed the checks) is broken.  See
+	// Test.Assertions.
+	MinAssertions int `json:",omitempty" yaml:",omitempty"`
 }
 
 func NewSpec() *Spec {
@@ -60,6 +93,15 @@ type Phase struct {
 	//
 	// Each Step is subject to bindings substitution.
 	Steps []*Step
+
+	// Table optionally runs the Steps once per row with the
+	// row's columns bound as variables.  See Table.
+	Table *Table `json:",omitempty" yaml:",omitempty"`
+
+	// Scope is ScopeTest (the default) or ScopePhase, which makes
+	// the phase's bindings local to the phase.  An Export step
+	// promotes phase-local bindings to test scope.
+	Scope string `json:",omitempty" yaml:",omitempty"`
 }
 
 func (p *Phase) AddStep(ctx *Ctx, s *Step) {
@@ -71,6 +113,16 @@ func (p *Phase) AddStep(ctx *Ctx, s *Step) {
 }
 
 func (p *Phase) Exec(ctx *Ctx, t *Test) (string, error) {
+	if p.Scope == ScopePhase {
+		defer t.enterScope(ctx)()
+	}
+	if p.Table != nil {
+		return p.execTable(ctx, t)
+	}
+	return p.execSteps(ctx, t)
+}
+
+func (p *Phase) execSteps(ctx *Ctx, t *Test) (string, error) {
 	var (
 		next string
 		err  error
@@ -78,9 +130,42 @@ func (p *Phase) Exec(ctx *Ctx, t *Test) (string, error) {
 	)
 	for i, s := range p.Steps {
 		ctx.Indf("  Step %d", i)
+		t.step = i
 		ctx.Inddf("    Bindings: %s", JSON(t.Bindings))
 
-		if next, err = s.exec(ctx, t); err != nil {
+		var (
+			skipped bool
+			err     error
+		)
+		breakpoint, err := s.Breakpoint.Check(ctx, t)
+		if err == nil {
+			if t.Debugger != nil {
+				skipped, err = t.Debugger.BeforeStep(ctx, t, i, s, breakpoint)
+			} else if breakpoint {
+				ctx.Logf("Breakpoint snapshot: %s",
+					ctx.Redactor.Redact(JSON(t.Snapshot(ctx, i))))
+			}
+		}
+		if err == nil && !skipped {
+			skipped, err = t.skipStep(ctx, s, i)
+		}
+		if err == nil && !skipped {
+			var holds bool
+			if holds, err = s.conditionsHold(ctx, t); err == nil && !holds {
+				ctx.Indf("    Condition doesn't hold")
+				skipped = true
+			}
+		}
+		if err == nil && skipped {
+			t.startTrace(ctx, i, s)
+			t.finishTrace(ctx, TraceSkipped, "", nil)
+		}
+		if err == nil && !skipped {
+			if next, err = t.execStep(ctx, i, s); err == nil {
+				err = t.checkTypes(ctx)
+			}
+		}
+		if err != nil {
 			_, broke := IsBroken(err)
 			err := fmt.Errorf("step %d: %w", i, err)
 			if broke {
@@ -99,6 +184,94 @@ func (p *Phase) Exec(ctx *Ctx, t *Test) (string, error) {
 	return next, err
 }
 
+// execStep executes the step and records its latency.  With a
+// Debugger, a failed step can be retried.
+func (t *Test) execStep(ctx *Ctx, i int, s *Step) (string, error) {
+	for {
+		then := time.Now()
+		t.startTrace(ctx, i, s)
+		next, err := s.exec(ctx, t)
+		t.finishTrace(ctx, TraceOK, next, err)
+		if err == nil {
+			t.Latencies = append(t.Latencies, StepLatency{
+				Phase:   t.phase,
+				Step:    i,
+				Latency: time.Now().Sub(then),
+			})
+			return next, nil
+		}
+		if t.Debugger == nil {
+			return "", err
+		}
+		retry, err := t.Debugger.StepFailed(ctx, t, i, s, err)
+		if !retry {
+			return "", err
+		}
+	}
+}
+
+// execPub substitutes bindings in the Pub and executes it.
+func (t *Test) execPub(ctx *Ctx, p *Pub) error {
+	ctx.Indf("    Pub to %s", p.Chan)
+
+	e, err := p.Substitute(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+		return err
+	}
+
+	t.traceOp(e.ch, e.Topic, e.Payload, nil)
+
+	return e.Exec(ctx, t)
+}
+
+// execSub substitutes bindings in the Sub and executes it.
+func (t *Test) execSub(ctx *Ctx, s *Sub) error {
+	ctx.Indf("    Sub %s", s.Chan)
+
+	e, err := s.Substitute(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+		return err
+	}
+
+	t.traceOp(e.ch, e.Topic, nil, nil)
+
+	return e.Exec(ctx, t)
+}
+
+// execRecv substitutes bindings in the Recv and executes it.
+func (t *Test) execRecv(ctx *Ctx, r *Recv) error {
+	ctx.Indf("    Recv %s", r.Chan)
+
+	e, err := r.Substitute(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+		return err
+	}
+
+	t.traceOp(e.ch, e.Topic, nil, e.Pattern)
+
+	then := time.Now()
+	if err := e.Exec(ctx, t); err != nil {
+		return err
+	}
+	ctx.Metrics.ObserveDuration(metrics.RecvWait, metrics.Labels{"chan": e.Chan},
+		metrics.DefaultBuckets, time.Now().Sub(then))
+	t.assertion(e.ch)
+
+	return nil
+}
+
 // Step represents a single action.
 type Step struct {
 	// Doc is an optional documentation string.
@@ -108,14 +281,33 @@ type Step struct {
 	// currently means returning an error from exec.
 	Fails bool `yaml:",omitempty"`
 
-	// Skip will make the test execution skip this step.
-	Skip bool `yaml:",omitempty"`
+	// Skip will make the test execution skip this step, perhaps
+	// conditionally.  See Skip.
+	Skip *Skip `yaml:",omitempty"`
+
+	// Breakpoint, perhaps conditionally, makes a Debugger pause
+	// before this step even after 'continue'.  Without a Debugger
+	// (the usual case), the Breakpoint logs a Snapshot instead.
+	// See Breakpoint.
+	Breakpoint *Breakpoint `yaml:",omitempty"`
+
+	// If is an optional condition that must hold for this Step
+	// to execute.  The condition is either a binding name (like
+	// "?ready") or Javascript.  See Test.condition.
+	If string `yaml:",omitempty"`
+
+	// Unless is an optional condition that must not hold for
+	// this Step to execute.
+	Unless string `yaml:",omitempty"`
 
 	Pub       *Pub       `yaml:",omitempty"`
 	Sub       *Sub       `yaml:",omitempty"`
 	Recv      *Recv      `yaml:",omitempty"`
+	RecvSeq   *RecvSeq   `yaml:",omitempty"`
 	Kill      *Kill      `yaml:",omitempty"`
 	Reconnect *Reconnect `yaml:",omitempty"`
+	Pause     *Pause     `yaml:",omitempty"`
+	Resume    *Resume    `yaml:",omitempty"`
 	Run       string     `yaml:",omitempty"`
 
 	// Wait is wait time in milliseconds as a string.
@@ -126,6 +318,28 @@ type Step struct {
 	Branch string `yaml:",omitempty"`
 
 	Ingest *Ingest `yaml:",omitempty"`
+
+	// Inspect checks recently received messages.  See Inspect.
+	Inspect *Inspect `yaml:",omitempty"`
+
+	// Set binds variables directly.  See Set.
+	Set Set `yaml:",omitempty"`
+
+	// WaitFor repeats an attempt until it succeeds.  See WaitFor.
+	WaitFor *WaitFor `yaml:",omitempty"`
+
+	// RunTest runs another test as a subtest.  See RunTest.
+	RunTest *RunTest `yaml:",omitempty"`
+
+	// MakeChan makes a channel.  See MakeChan.
+	MakeChan *MakeChan `yaml:",omitempty"`
+
+	// Health checks a channel's health.  See Health.
+	Health *Health `yaml:",omitempty"`
+
+	// Export promotes phase-local bindings to test scope.  See
+	// Export.
+	Export Export `yaml:",omitempty"`
 }
 
 func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
@@ -133,15 +347,33 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 
 	t.Tick(ctx)
 
-	if s.Skip {
-		ctx.Indf("    Skip")
-		return "", nil
-	}
-
 	if s.Pub != nil {
-		ctx.Indf("    Pub to %s", s.Pub.Chan)
+		if err := t.fanOut(ctx, s.Pub.Chan, s.Pub.Chans, func(name string) error {
+			p := *s.Pub
+			p.Chan, p.Chans = name, nil
+			return t.execPub(ctx, &p)
+		}); err != nil {
+			return "", err
+		}
+	}
+	if s.Sub != nil {
+		if err := t.fanOut(ctx, s.Sub.Chan, s.Sub.Chans, func(name string) error {
+			sub := *s.Sub
+			sub.Chan, sub.Chans = name, nil
+			return t.execSub(ctx, &sub)
+		}); err != nil {
+			return "", err
+		}
+	}
+	if s.Recv != nil {
+		if err := t.execRecvs(ctx, s.Recv); err != nil {
+			return "", err
+		}
+	}
+	if s.RecvSeq != nil {
+		ctx.Indf("    RecvSeq %s", s.RecvSeq.Chan)
 
-		e, err := s.Pub.Substitute(ctx, t)
+		e, err := s.RecvSeq.Substitute(ctx, t)
 		if err != nil {
 			return "", err
 		}
@@ -150,14 +382,17 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 			return "", err
 		}
 
+		t.traceOp(e.ch, "", nil, e.Patterns)
+
 		if err := e.Exec(ctx, t); err != nil {
 			return "", err
 		}
+		t.assertion(e.ch)
 	}
-	if s.Sub != nil {
-		ctx.Indf("    Sub %s", s.Sub.Chan)
+	if s.Reconnect != nil {
+		ctx.Indf("    Reconnect %s", s.Reconnect.Chan)
 
-		e, err := s.Sub.Substitute(ctx, t)
+		e, err := s.Reconnect.Substitute(ctx, t)
 		if err != nil {
 			return "", err
 		}
@@ -170,10 +405,10 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 			return "", err
 		}
 	}
-	if s.Recv != nil {
-		ctx.Indf("    Recv %s", s.Recv.Chan)
+	if s.Pause != nil {
+		ctx.Indf("    Pause %s", s.Pause.Chan)
 
-		e, err := s.Recv.Substitute(ctx, t)
+		e, err := s.Pause.Substitute(ctx, t)
 		if err != nil {
 			return "", err
 		}
@@ -186,10 +421,10 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 			return "", err
 		}
 	}
-	if s.Reconnect != nil {
-		ctx.Indf("    Reconnect %s", s.Reconnect.Chan)
+	if s.Resume != nil {
+		ctx.Indf("    Resume %s", s.Resume.Chan)
 
-		e, err := s.Reconnect.Substitute(ctx, t)
+		e, err := s.Resume.Substitute(ctx, t)
 		if err != nil {
 			return "", err
 		}
@@ -214,6 +449,24 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 			return "", err
 		}
 
+		t.traceOp(e.ch, e.Topic, e.Payload, nil)
+
+		if err := e.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+	if s.Inspect != nil {
+		ctx.Indf("    Inspect %s", s.Inspect.Chan)
+
+		e, err := s.Inspect.Substitute(ctx, t)
+		if err != nil {
+			return "", err
+		}
+
+		if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+			return "", err
+		}
+
 		if err := e.Exec(ctx, t); err != nil {
 			return "", err
 		}
@@ -236,6 +489,60 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 		}
 	}
 
+	if s.Set != nil {
+		if err := s.Set.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+
+	if s.Export != nil {
+		if err := s.Export.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+
+	if s.WaitFor != nil {
+		ctx.Indf("    WaitFor")
+
+		if err := s.WaitFor.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+
+	if s.MakeChan != nil {
+		if err := s.MakeChan.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+
+	if s.Health != nil {
+		e, err := s.Health.Substitute(ctx, t)
+		if err != nil {
+			return "", err
+		}
+
+		if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+			return "", err
+		}
+
+		if err := e.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+
+	if s.RunTest != nil {
+		ctx.Indf("    RunTest %s", s.RunTest.Filename)
+
+		e, err := s.RunTest.Substitute(ctx, t)
+		if err != nil {
+			return "", err
+		}
+
+		if err := e.Exec(ctx, t); err != nil {
+			return "", err
+		}
+	}
+
 	if s.Branch != "" {
 		ctx.Indf("    Branch %s", short(s.Branch))
 
@@ -248,7 +555,7 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 			return "", err
 		}
 
-		x, err := JSExec(ctx, src, t.jsEnv(ctx))
+		x, err := t.JSExec(ctx, src, t.jsEnv(ctx))
 		if err != nil {
 			return "", err
 		}
@@ -275,7 +582,7 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 			return "", err
 		}
 
-		_, err = JSExec(ctx, src, t.jsEnv(ctx))
+		_, err = t.JSExec(ctx, src, t.jsEnv(ctx))
 
 		ctx.Inddf("    Bindings: %s", JSON(t.Bindings))
 
@@ -285,14 +592,12 @@ func (s *Step) exec(ctx *Ctx, t *Test) (string, error) {
 	if s.Wait != "" {
 		ctx.Indf("    Wait %s", s.Wait)
 
-		duration, err := t.Bindings.StringSub(ctx, s.Wait)
+		d, err := t.Bindings.DurationSub(ctx, "Wait", s.Wait)
 		if err != nil {
 			return "", err
 		}
 
-		if err := Wait(ctx, duration); err != nil {
-			return "", err
-		}
+		t.wait(ctx, d)
 
 		return "", nil
 	}
@@ -313,11 +618,56 @@ func Wait(ctx *Ctx, durationString string) error {
 }
 
 type Pub struct {
-	Chan    string
+	Chan string
+
+	// Chans optionally publishes to each of these channels (in
+	// order) instead of to Chan.  See Test.chanNames.
+	Chans []string `json:",omitempty" yaml:",omitempty"`
+
 	Topic   string
 	Payload interface{}
 	Run     string `json:",omitempty" yaml:",omitempty"`
 
+	// Crypto optionally specifies payload signing and/or
+	// encryption, which is performed after bindings substitution.
+	Crypto *Crypto `json:",omitempty" yaml:",omitempty"`
+
+	// PayloadFormat is "json" (the default), "xml", "protobuf",
+	// or "avro".  With "xml", a structured payload is serialized
+	// as XML (see FormatXML), and a string payload is used as is.
+	// With "protobuf", the payload (structured or a JSON string)
+	// is encoded as the protobuf message that Proto specifies.
+	// With "avro", the payload (structured or a JSON string in
+	// the Avro JSON encoding) is encoded with the schema that
+	// Avro specifies.
+	PayloadFormat string `json:",omitempty" yaml:",omitempty"`
+
+	// Proto specifies the message type for PayloadFormat
+	// "protobuf".
+	Proto *ProtoSpec `json:",omitempty" yaml:",omitempty"`
+
+	// Avro specifies the schema for PayloadFormat "avro".
+	Avro *AvroSpec `json:",omitempty" yaml:",omitempty"`
+
+	// PayloadEncoding "base64" means that the Payload is the
+	// base64 representation of raw bytes, which are published
+	// as is.
+	PayloadEncoding string `json:",omitempty" yaml:",omitempty"`
+
+	// Schema is an optional JSON Schema (a name in the Spec's
+	// Schemas, a URI, a filename relative to the test's
+	// directory, or the schema itself) that the payload (after
+	// substitution) must satisfy.
+	Schema interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Fixture optionally names a Spec Fixture to use as the
+	// Payload.
+	Fixture string `json:",omitempty" yaml:",omitempty"`
+
+	// With optionally gives bindings that apply only to the
+	// Fixture (and take precedence over the test's bindings).
+	With map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
 	ch Chan
 }
 
@@ -329,14 +679,41 @@ func (p *Pub) Substitute(ctx *Ctx, t *Test) (*Pub, error) {
 	ctx.Inddf("    Effective topic: %s", topic)
 
 	var pay interface{}
-	if err := t.Bindings.Sub(ctx, p.Payload, &pay, true); err != nil {
+	if err := t.subFixture(ctx, p.Fixture, p.With, p.Payload, &pay); err != nil {
+		return nil, err
+	}
+
+	avro, err := p.Avro.Substitute(ctx, &t.Bindings)
+	if err != nil {
 		return nil, err
 	}
 
+	codec, err := t.codec(ctx, p.PayloadFormat, p.PayloadEncoding, p.Proto, avro)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := t.subSchema(ctx, p.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if schema != nil {
+		if err := t.validateSchema(ctx, schema, pay); err != nil {
+			return nil, err
+		}
+	}
+
 	payjs, err := json.Marshal(&pay)
 	if err != nil {
 		return nil, err
 	}
+	if codec != nil {
+		s, err := codec.Encode(pay)
+		if err != nil {
+			return nil, err
+		}
+		payjs = []byte(s)
+	}
 	ctx.Inddf("    Effective payload: %s", payjs)
 
 	run, err := t.Bindings.StringSub(ctx, p.Run)
@@ -347,12 +724,25 @@ func (p *Pub) Substitute(ctx *Ctx, t *Test) (*Pub, error) {
 		ctx.Inddf("    Effective code (run): %s", run)
 	}
 
+	cry, err := p.Crypto.Substitute(ctx, &t.Bindings)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Pub{
-		Chan:    p.Chan,
-		Topic:   topic,
-		Payload: string(payjs),
-		Run:     run,
-		ch:      p.ch,
+		Chan:          p.Chan,
+		Topic:         topic,
+		Payload:       string(payjs),
+		Run:           run,
+		Crypto:        cry,
+		PayloadFormat: p.PayloadFormat,
+		Proto:         p.Proto,
+		Avro:          avro,
+
+		PayloadEncoding: p.PayloadEncoding,
+		Schema:          schema,
+
+		ch: p.ch,
 	}, nil
 
 }
@@ -361,13 +751,27 @@ func (p *Pub) Exec(ctx *Ctx, t *Test) error {
 	ctx.Indf("    Pub topic '%s'", p.Topic)
 	ctx.Inddf("        payload %s", p.Payload)
 
+	payload := p.Payload
+	if p.Crypto != nil {
+		s, err := p.Crypto.Protect(ctx, payload)
+		if err != nil {
+			return err
+		}
+		ctx.Inddf("        protected payload %s", s)
+		payload = s
+	}
+
 	err := p.ch.Pub(ctx, Msg{
-		Topic:   p.Topic,
-		Payload: p.Payload,
+		Topic:   t.outboundTopic(ctx, t.chanName(p.ch), p.Topic),
+		Payload: payload,
 	})
 
 	if err != nil {
-		return err
+		return Categorize(CategoryChannel, err)
+	}
+
+	if ctx.Metrics != nil {
+		ctx.Metrics.Add(metrics.ChanPublished, t.chanLabels(p.ch), 1)
 	}
 
 	if p.Run != "" {
@@ -376,11 +780,7 @@ func (p *Pub) Exec(ctx *Ctx, t *Test) error {
 			return err
 		}
 
-		env := map[string]interface{}{
-			"test":    t,
-			"elapsed": float64(t.elapsed) / 1000 / 1000, // Milliseconds
-		}
-		if _, err = JSExec(ctx, src, env); err != nil {
+		if _, err = t.JSExec(ctx, src, t.jsEnv(ctx)); err != nil {
 			return err
 		}
 	}
@@ -390,7 +790,12 @@ func (p *Pub) Exec(ctx *Ctx, t *Test) error {
 }
 
 type Sub struct {
-	Chan  string
+	Chan string
+
+	// Chans optionally subscribes on each of these channels (in
+	// order) instead of on Chan.  See Test.chanNames.
+	Chans []string `json:",omitempty" yaml:",omitempty"`
+
 	Topic string
 
 	// Pattern, which is deprecated, is really 'Topic'.
@@ -423,13 +828,32 @@ func (s *Sub) Substitute(ctx *Ctx, t *Test) (*Sub, error) {
 
 func (s *Sub) Exec(ctx *Ctx, t *Test) error {
 	ctx.Indf("    Sub %s", s.Topic)
-	return s.ch.Sub(ctx, s.Topic)
+	name := t.chanName(s.ch)
+	topic := t.outboundTopic(ctx, name, s.Topic)
+	if err := s.ch.Sub(ctx, topic); err != nil {
+		return Categorize(CategoryChannel, err)
+	}
+	t.subscribed(name, topic)
+	return nil
 }
 
 type Recv struct {
-	Chan    string
+	Chan string
+
+	// Chans optionally receives on these channels instead of on
+	// Chan.  See Test.chanNames and ChanPolicy.
+	Chans []string `json:",omitempty" yaml:",omitempty"`
+
+	// ChanPolicy says which of the Chans must satisfy the Recv:
+	// "all" (the default) or "any".  See Test.execRecvs.
+	ChanPolicy string `json:",omitempty" yaml:",omitempty"`
+
 	Topic   string
 	Pattern interface{}
+
+	// Timeout is a duration (in Go syntax).  In YAML, the value
+	// can also use bindings (like "{?delay}" or just "?delay").
+	// See Bindings.DurationSub.
 	Timeout time.Duration
 
 	// Target is an optional switch to specify what part of the
@@ -469,7 +893,157 @@ type Recv struct {
 
 	Run string `json:",omitempty" yaml:",omitempty"`
 
+	// Crypto optionally specifies payload decryption and/or
+	// signature verification, which is performed before
+	// matching.  A message that can't be decrypted or verified
+	// is ignored.
+	Crypto *Crypto `json:",omitempty" yaml:",omitempty"`
+
+	// Multiple is the strategy for a match that returns multiple
+	// sets of bindings, which patterns over arrays can do.
+	//
+	//   unique (the default): Require that all sets are the same.
+	//
+	//   first: Use the first set.
+	//
+	//   all: Bind each variable to an array of its values (with
+	//   null for a set that lacks the variable).
+	//
+	// The guard's 'bindingss' has all of the sets regardless.
+	Multiple string `json:",omitempty" yaml:",omitempty"`
+
+	// Topics optionally restricts this Recv to messages with
+	// topics that match these filters, which can use MQTT-style
+	// wildcards ('+' and a final '#').  The order gives
+	// precedence: Among messages that have already arrived,
+	// those matching earlier filters are considered first.
+	//
+	// Messages on other topics are held (not consumed) for
+	// subsequent Recvs on the same channel, so a Recv for one
+	// topic can't consume a message that a later Recv needs.
+	Topics []string `json:",omitempty" yaml:",omitempty"`
+
+	// Extract optionally maps variables to JSONPath or JMESPath
+	// expressions (see the function Extract), which are
+	// evaluated against the target after a successful match.
+	// The results are bound along with the match's bindings.
+	//
+	// If an expression doesn't find anything, the message
+	// doesn't satisfy this Recv.  Without a Pattern, only
+	// extraction determines whether a message satisfies the
+	// Recv.
+	Extract map[string]string `json:",omitempty" yaml:",omitempty"`
+
+	// PayloadFormat is "json" (the default), "xml", "protobuf",
+	// or "avro".  With "xml", a payload is parsed as XML (see
+	// ParseXML) before matching.  With "protobuf", a payload is
+	// decoded as the protobuf message that Proto specifies and
+	// then matched as that message's JSON representation (using
+	// the field names from the .proto file).  With "avro", a
+	// payload is decoded with the writer's schema (by the
+	// payload's schema ID) and then matched as its Avro JSON
+	// encoding.  A payload that can't be decoded is ignored.
+	PayloadFormat string `json:",omitempty" yaml:",omitempty"`
+
+	// Proto specifies the message type for PayloadFormat
+	// "protobuf".
+	Proto *ProtoSpec `json:",omitempty" yaml:",omitempty"`
+
+	// Avro specifies how to find schemas for PayloadFormat
+	// "avro".
+	Avro *AvroSpec `json:",omitempty" yaml:",omitempty"`
+
+	// PayloadEncoding "base64" means that a message's payload is
+	// raw bytes, which are matched as their (standard) base64
+	// representation.
+	PayloadEncoding string `json:",omitempty" yaml:",omitempty"`
+
+	// Schema is an optional JSON Schema (a name in the Spec's
+	// Schemas, a URI, a filename relative to the test's
+	// directory, or the schema itself).
+	// The (decoded) payload of a message that otherwise
+	// satisfies the Recv must validate against this schema, or
+	// the test fails.
+	Schema interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Fixture optionally names a Spec Fixture to use as the
+	// Pattern.
+	Fixture string `json:",omitempty" yaml:",omitempty"`
+
+	// With optionally gives bindings that apply only to the
+	// Fixture (and take precedence over the test's bindings).
+	With map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Canon optionally specifies normalization (number
+	// precision, timestamps, and key case) for messages and the
+	// pattern before matching.  Without a Canon, a Recv uses the
+	// Canon (if any) given when its channel was made.
+	Canon *CanonSpec `json:",omitempty" yaml:",omitempty"`
+
+	// Window optionally makes this Recv collect all of the
+	// messages that arrive during a fixed duration and then check
+	// the whole batch.  See Window.
+	Window *Window `json:",omitempty" yaml:",omitempty"`
+
 	ch Chan
+
+	// codec is the Codec (if any) for the PayloadFormat.
+	codec Codec
+
+	// canon is the effective CanonSpec (if any).
+	canon *CanonSpec
+
+	// timeout is a Timeout that needs bindings substitution.
+	timeout string
+}
+
+// UnmarshalYAML allows a Timeout that uses bindings.
+func (r *Recv) UnmarshalYAML(n *yaml.Node) error {
+	type recv Recv
+	return deferDurations(n, map[string]*string{"timeout": &r.timeout}).Decode((*recv)(r))
+}
+
+// Strategies for Recv.Multiple.
+const (
+	MultipleUnique = "unique"
+	MultipleFirst  = "first"
+	MultipleAll    = "all"
+)
+
+// resolveBindingss returns the bindings to use according to the
+// given Recv.Multiple strategy.
+func resolveBindingss(strategy string, bss []match.Bindings) (match.Bindings, error) {
+	if len(bss) == 1 {
+		return bss[0], nil
+	}
+
+	switch strategy {
+	case MultipleUnique, "":
+		js := JSON(bss[0])
+		for _, bs := range bss[1:] {
+			if JSON(bs) != js {
+				return nil, fmt.Errorf("multiple bindings sets: %s", JSON(bss))
+			}
+		}
+		return bss[0], nil
+	case MultipleFirst:
+		return bss[0], nil
+	case MultipleAll:
+		acc := match.NewBindings()
+		for i, bs := range bss {
+			for p, v := range bs {
+				vs, have := acc[p].([]interface{})
+				if !have {
+					vs = make([]interface{}, len(bss))
+				}
+				vs[i] = v
+				acc[p] = vs
+			}
+		}
+		return acc, nil
+	}
+
+	return nil, Brokenf("bad Recv Multiple '%s'", strategy)
 }
 
 func (r *Recv) Substitute(ctx *Ctx, t *Test) (*Recv, error) {
@@ -503,7 +1077,7 @@ func (r *Recv) Substitute(ctx *Ctx, t *Test) (*Recv, error) {
 
 	ctx.Inddf("    Given pattern: %s", JSON(r.Pattern))
 	var pat interface{}
-	if err := t.Bindings.Sub(ctx, r.Pattern, &pat, true); err != nil {
+	if err := t.subFixture(ctx, r.Fixture, r.With, r.Pattern, &pat); err != nil {
 		return nil, err
 	}
 	ctx.Inddf("    Effective pattern: %s", JSON(pat))
@@ -518,23 +1092,121 @@ func (r *Recv) Substitute(ctx *Ctx, t *Test) (*Recv, error) {
 		return nil, err
 	}
 
+	cry, err := r.Crypto.Substitute(ctx, &t.Bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	avro, err := r.Avro.Substitute(ctx, &t.Bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := t.subSchema(ctx, r.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var topics []string
+	for _, filter := range r.Topics {
+		s, err := t.Bindings.StringSub(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, s)
+	}
+
+	window, err := r.Window.Substitute(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := t.Bindings.durationSub(ctx, "Recv Timeout", r.Timeout, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var extract map[string]string
+	if r.Extract != nil {
+		extract = make(map[string]string, len(r.Extract))
+		for p, expr := range r.Extract {
+			if extract[p], err = t.Bindings.StringSub(ctx, expr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return &Recv{
-		Chan:    r.Chan,
-		Topic:   topic,
-		Pattern: pat,
-		Timeout: r.Timeout,
-		Target:  r.Target,
-		Guard:   guard,
-		Run:     run,
-		ch:      r.ch,
+		Chan:     r.Chan,
+		Topic:    topic,
+		Pattern:  pat,
+		Timeout:  timeout,
+		Target:   r.Target,
+		Guard:    guard,
+		Run:      run,
+		Crypto:   cry,
+		Multiple: r.Multiple,
+		Topics:   topics,
+		Extract:  extract,
+
+		PayloadFormat: r.PayloadFormat,
+		Proto:         r.Proto,
+		Avro:          avro,
+		Canon:         r.Canon,
+
+		PayloadEncoding: r.PayloadEncoding,
+		Schema:          schema,
+		Window:          window,
+
+		ch: r.ch,
 	}, nil
 }
 
+// prepare checks the Target and sets up the codec and the
+// normalization (if any) for the Recv's channel.
+func (r *Recv) prepare(ctx *Ctx, t *Test) error {
+	switch r.Target {
+	case "payload", "Payload", "":
+		r.Target = "payload"
+	case "msg", "message", "Message":
+		r.Target = "msg"
+	default:
+		return NewBroken(fmt.Errorf("Bad Recv Target: '%s'", r.Target))
+	}
+
+	ctx.Inddf("    Recv pattern %s", JSON(r.Pattern))
+	ctx.Inddf("    Recv target %s", r.Target)
+
+	codec, err := t.codec(ctx, r.PayloadFormat, r.PayloadEncoding, r.Proto, r.Avro)
+	if err != nil {
+		return err
+	}
+	r.codec = codec
+
+	// Messages and the pattern get the same normalization.
+	r.canon = r.Canon
+	if r.canon == nil {
+		r.canon = t.canons[t.chanName(r.ch)]
+	}
+	if r.canon != nil {
+		if err := r.canon.Check(); err != nil {
+			return err
+		}
+		pat, err := r.canon.Normalize(Canon(r.Pattern))
+		if err != nil {
+			return NewBroken(fmt.Errorf("Canon pattern: %w", err))
+		}
+		r.Pattern = pat
+		ctx.Inddf("    Recv normalized pattern %s", JSON(pat))
+	}
+
+	return nil
+}
+
 func (r *Recv) Exec(ctx *Ctx, t *Test) error {
 	var (
 		timeout = r.Timeout
-		in      = r.ch.Recv(ctx)
-		pat     = r.Pattern
+		in      = t.inbound(ctx, r.ch)
 	)
 
 	if timeout == 0 {
@@ -543,190 +1215,346 @@ func (r *Recv) Exec(ctx *Ctx, t *Test) error {
 
 	tm := time.NewTimer(timeout)
 
-	switch r.Target {
-	case "payload", "Payload", "":
-		r.Target = "payload"
-	case "msg", "message", "Message":
-		r.Target = "msg"
-	default:
-		return NewBroken(fmt.Errorf("Bad Recv Target: '%s'", r.Target))
+	if err := r.prepare(ctx, t); err != nil {
+		return err
 	}
 
-	ctx.Inddf("    Recv pattern %s", JSON(pat))
-	ctx.Inddf("    Recv target %s", r.Target)
+	if r.Window != nil {
+		return r.window(ctx, t)
+	}
+
+	var (
+		name = t.chanName(r.ch)
+		pat  = r.Pattern
+	)
+
+	// Messages that a previous Recv set aside are considered
+	// first.
+	pending := t.unhold(name)
+
+	// With a ReconnectPolicy, check the channel's health
+	// periodically so that a lost connection doesn't just stall
+	// this Recv until its timeout.
+	checks, stop := t.healthChecks(r.ch)
+	defer stop()
+
 	for {
+		// With Topics, consider everything that's already
+		// available so that the preferred topics come first.
+		if 0 < len(r.Topics) {
+		DRAIN:
+			for {
+				select {
+				case m := <-in:
+					admit, err := t.admit(ctx, name, &m)
+					if err != nil {
+						return err
+					}
+					if admit {
+						pending = append(pending, m)
+					}
+				default:
+					break DRAIN
+				}
+			}
+		}
+
+		var (
+			considered = make(map[int]bool, len(pending))
+			satisfied  bool
+			err        error
+		)
+		for _, i := range r.candidates(pending) {
+			considered[i] = true
+			satisfied, err = r.consider(ctx, t, &pending[i])
+			// Remember each message in the history after
+			// considering it, so a guard sees only prior
+			// messages.
+			t.history.Add(name, pending[i])
+			if satisfied || err != nil {
+				break
+			}
+		}
+
+		// Hold the remaining messages for subsequent Recvs.
+		var rest []Msg
+		for i, m := range pending {
+			if !considered[i] {
+				ctx.Indf("    Recv holding '%s'", m.Topic)
+				rest = append(rest, m)
+			}
+		}
+		t.hold(name, rest)
+		pending = nil
+
+		if satisfied || err != nil {
+			return err
+		}
+
+		// A Buffer that overflowed with OverflowFailTest
+		// lost a message that this Recv might have wanted.
+		if err := t.overflowed(r.ch); err != nil {
+			return err
+		}
+
 		select {
 		case <-ctx.Done():
 			ctx.Indf("    Recv canceled")
 			return nil
 		case <-tm.C:
 			ctx.Indf("    Recv timeout (%v)", timeout)
-			return fmt.Errorf("timeout after %s waiting for %s", timeout, JSON(pat))
+			return Categorize(CategoryTimeout, fmt.Errorf("timeout after %s waiting for %s", timeout, JSON(pat)))
+		case <-checks:
+			if err := t.ensureHealthy(ctx, r.ch); err != nil {
+				return err
+			}
 		case m := <-in:
-			ctx.Indf("    Recv dequeuing '%s'", m.Topic)
-			ctx.Inddf("                   %s", JSON(m.Payload))
+			admit, err := t.admit(ctx, name, &m)
+			if err != nil {
+				return err
+			}
+			if admit {
+				pending = append(pending, m)
+			}
+		}
+	}
+}
+
+// consider reports whether the given message satisfies the Recv.
+//
+// The message's payload is updated with its parsed (and maybe
+// decrypted) version.
+func (r *Recv) consider(ctx *Ctx, t *Test, m *Msg) (bool, error) {
+	pat := r.Pattern
+
+	ctx.Indf("    Recv dequeuing '%s'", m.Topic)
+	if ctx.Metrics != nil {
+		ctx.Metrics.Add(metrics.ChanReceived, t.chanLabels(r.ch), 1)
+	}
+	ctx.Inddf("                   %s", JSON(m.Payload))
+
+	target, ok, err := r.decode(ctx, m)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	ctx.Inddf("    Recv considering %s", JSON(m))
+	var bss []match.Bindings
+	if pat != nil {
+
+		// We are giving empty bindings to
+		// 'Match' because we have already
+		// substituted bindings in pat as part of
+		// our recursive, fancy substitution
+		// logic (that includes '!!' and '@@'
+		// substitutions along with bindings
+		// substitions, which can occur in
+		// string contexts in additional to
+		// structural contexts.
+		//
+		// If we waited to structural bindings
+		// substitution until now, then
+		// string-context bindings substitution
+		// would be inconsistent with that
+		// late use of bindings here.
+		//
+		// ToDo: Reconsider.
+
+		var err error
+		if bss, err = match.Match(pat, Canon(target), match.NewBindings()); err != nil {
+			return false, err
+		}
+		ctx.Indf("    Recv match:")
+		ctx.Inddf("      pattern: %s", JSON(pat))
+		ctx.Inddf("      msg:     %s", JSON(m))
+		ctx.Indf("      result: %v", 0 < len(bss))
+		ctx.Inddf("      bss: %s", JSON(bss))
+	} else if 0 < len(r.Extract) {
+		// Extraction without matching.
+		bss = []match.Bindings{match.NewBindings()}
+	}
+
+	if 0 < len(bss) {
+
+		// By default, let's protest if we
+		// get multiple, different sets of
+		// bindings.  Otherwise we might
+		// not notice unintended behavior.
+		bs, err := resolveBindingss(r.Multiple, bss)
+		if err != nil {
+			return false, err
+		}
+
+		if 0 < len(r.Extract) {
+			xs, err := r.extract(ctx, target)
+			if err != nil {
+				return false, err
+			}
+			if xs == nil {
+				return false, nil
+			}
+			for p, x := range xs {
+				bs[p] = x
+			}
+		}
+
+		// Extend rather than replace
+		// t.Bindings.  Note that we have to
+		// extend t.Bindings rather than replace
+		// it due to the bindings substitution
+		// logic.  See the comments above
+		// 'Match' above.
+		//
+		// ToDo: Contemplate possibility for
+		// inconsistencies.
+		//
+		// Thanks, Carlos, for this fix!
+		if t.Bindings == nil {
+			// Some unit tests might not
+			// have initialized t.Bindings.
+			t.Bindings = make(map[string]interface{})
+		}
+		for p, v := range bs {
+			if x, have := t.Bindings[p]; have {
+				// Let's see if we are
+				// changing an existing
+				// binding.  If so, note
+				// that.
+				js0 := JSON(v)
+				js1 := JSON(x)
+				if js0 != js1 {
+					ctx.Indf("    Updating binding for %s", p)
+				}
+			}
+			t.Bindings[p] = v
+		}
+		ctx.Redactor.AddBindings(t.Bindings)
 
-			m.Payload = MaybeParseJSON(m.Payload)
-			var target interface{} = map[string]interface{}{
-				"Topic":   m.Topic,
-				"Payload": m.Payload,
+		if r.Guard != "" {
+			ctx.Indf("    Recv guard")
+			src, err := t.prepareSource(ctx, r.Guard)
+			if err != nil {
+				return false, err
 			}
 
-			switch r.Target {
-			case "payload":
-				target = m.Payload
-			case "msg":
-			default:
-				return NewBroken(fmt.Errorf("Bad Recv Target: '%s'", r.Target))
+			// Convert bss to a stripped representation ...
+			js, _ := json.Marshal(&bss)
+			var bindingss interface{}
+			json.Unmarshal(js, &bindingss)
+			// And again ...
+			var bs interface{}
+			js, _ = json.Marshal(&bss[0])
+			json.Unmarshal(js, &bs)
+
+			env := t.jsEnv(ctx)
+			env["bindingss"] = bindingss
+			env["msg"] = *m
+
+			x, err := t.JSExec(ctx, src, env)
+			if f, is := IsFailure(x); is {
+				return false, Categorize(CategoryGuard, f)
+			}
+			if f, is := IsFailure(err); is {
+				return false, Categorize(CategoryGuard, f)
+			}
+			if err != nil {
+				return false, err
 			}
 
-			ctx.Inddf("    Recv considering %s", JSON(m))
-			if pat != nil {
-
-				// We are giving empty bindings to
-				// 'Match' because we have already
-				// substituted bindings in pat as part of
-				// our recursive, fancy substitution
-				// logic (that includes '!!' and '@@'
-				// substitutions along with bindings
-				// substitions, which can occur in
-				// string contexts in additional to
-				// structural contexts.
-				//
-				// If we waited to structural bindings
-				// substitution until now, then
-				// string-context bindings substitution
-				// would be inconsistent with that
-				// late use of bindings here.
-				//
-				// ToDo: Reconsider.
-
-				bss, err := match.Match(pat, Canon(target), match.NewBindings())
-				if err != nil {
-					return err
+			switch vv := x.(type) {
+			case bool:
+				if !vv {
+					ctx.Indf("    Recv guard not pleased")
+					return false, nil
 				}
-				ctx.Indf("    Recv match:")
-				ctx.Inddf("      pattern: %s", JSON(pat))
-				ctx.Inddf("      msg:     %s", JSON(m))
-				ctx.Indf("      result: %v", 0 < len(bss))
-				ctx.Inddf("      bss: %s", JSON(bss))
-				if 0 < len(bss) {
-
-					if 1 < len(bss) {
-						// Let's protest if we get
-						// multiple sets of bindings.
-						//
-						// Better safe than sorry?  If
-						// we start running into this
-						// situation, let's figure out
-						// the best way to proceed.
-						// Otherwise we might not notice
-						// unintended behavior.
-						return fmt.Errorf("multiple bindings sets: %s", JSON(bss))
-					}
+				ctx.Indf("    Recv guard satisfied")
+			default:
+				return false, Brokenf("Guard Javascript returned a %T (%v) and not a bool", x, x)
+			}
+		}
 
-					// Extend rather than replace
-					// t.Bindings.  Note that we have to
-					// extend t.Bindings rather than replace
-					// it due to the bindings substitution
-					// logic.  See the comments above
-					// 'Match' above.
-					//
-					// ToDo: Contemplate possibility for
-					// inconsistencies.
-					//
-					// Thanks, Carlos, for this fix!
-					if t.Bindings == nil {
-						// Some unit tests might not
-						// have initialized t.Bindings.
-						t.Bindings = make(map[string]interface{})
-					}
-					for p, v := range bss[0] {
-						if x, have := t.Bindings[p]; have {
-							// Let's see if we are
-							// changing an existing
-							// binding.  If so, note
-							// that.
-							js0 := JSON(v)
-							js1 := JSON(x)
-							if js0 != js1 {
-								ctx.Indf("    Updating binding for %s", p)
-							}
-						}
-						t.Bindings[p] = v
-					}
+		if r.Schema != nil {
+			if err := t.validateSchema(ctx, r.Schema, m.Payload); err != nil {
+				return false, err
+			}
+		}
 
-					if r.Guard != "" {
-						ctx.Indf("    Recv guard")
-						src, err := t.prepareSource(ctx, r.Guard)
-						if err != nil {
-							return err
-						}
-
-						// Convert bss to a stripped representation ...
-						js, _ := json.Marshal(&bss)
-						var bindingss interface{}
-						json.Unmarshal(js, &bindingss)
-						// And again ...
-						var bs interface{}
-						js, _ = json.Marshal(&bss[0])
-						json.Unmarshal(js, &bs)
-
-						env := t.jsEnv(ctx)
-						env["bindingss"] = bindingss
-						env["msg"] = m
-
-						x, err := JSExec(ctx, src, env)
-						if f, is := IsFailure(x); is {
-							return f
-						}
-						if f, is := IsFailure(err); is {
-							return f
-						}
-						if err != nil {
-							return err
-						}
-
-						switch vv := x.(type) {
-						case bool:
-							if !vv {
-								ctx.Indf("    Recv guard not pleased")
-								continue
-							}
-							ctx.Indf("    Recv guard satisfied")
-						default:
-							return Brokenf("Guard Javascript returned a %T (%v) and not a bool", x, x)
-						}
-					}
+		ctx.Indf("    Recv satisfied")
+		t.traceMatched(*m)
+		ctx.Inddf("      t.Bindings: %s", JSON(t.Bindings))
 
-					ctx.Indf("    Recv satisfied")
-					ctx.Inddf("      t.Bindings: %s", JSON(t.Bindings))
-
-					if r.Run != "" {
-						src, err := t.prepareSource(ctx, r.Run)
-						if err != nil {
-							return err
-						}
-
-						// Convert bss to a stripped representation ...
-						env := t.jsEnv(ctx)
-						can := Canon(&bss)
-						env["bindingss"] = can
-						env["bss"] = can
-						env["msg"] = m
-
-						if _, err = JSExec(ctx, src, env); err != nil {
-							return err
-						}
-					}
+		if r.Run != "" {
+			src, err := t.prepareSource(ctx, r.Run)
+			if err != nil {
+				return false, err
+			}
 
-					return nil
-				}
+			// Convert bss to a stripped representation ...
+			env := t.jsEnv(ctx)
+			can := Canon(&bss)
+			env["bindingss"] = can
+			env["bss"] = can
+			env["msg"] = *m
+
+			if _, err = t.JSExec(ctx, src, env); err != nil {
+				return false, err
 			}
 		}
+
+		return true, nil
 	}
+	return false, nil
+}
 
-	return fmt.Errorf("impossible!")
+// decode updates the message's payload with its parsed (and maybe
+// decrypted) version and returns the (normalized) target for
+// matching.  The result is false if the message should be ignored.
+func (r *Recv) decode(ctx *Ctx, m *Msg) (interface{}, bool, error) {
+	if r.codec == nil {
+		m.Payload = MaybeParseJSON(m.Payload)
+	}
+	if r.Crypto != nil {
+		x, err := r.Crypto.Unprotect(ctx, m.Payload)
+		if err != nil {
+			if _, is := IsBroken(err); is {
+				return nil, false, err
+			}
+			ctx.Indf("    Recv ignoring message: %s", err)
+			return nil, false, nil
+		}
+		m.Payload = x
+	}
+	if r.codec != nil {
+		x, err := r.codec.Decode(m.Payload)
+		if err != nil {
+			ctx.Indf("    Recv ignoring message: %s", err)
+			return nil, false, nil
+		}
+		m.Payload = x
+	}
+	var target interface{} = map[string]interface{}{
+		"Topic":   m.Topic,
+		"Payload": m.Payload,
+	}
+
+	switch r.Target {
+	case "payload":
+		target = m.Payload
+	case "msg":
+	default:
+		return nil, false, NewBroken(fmt.Errorf("Bad Recv Target: '%s'", r.Target))
+	}
+
+	if r.canon != nil {
+		x, err := r.canon.Normalize(Canon(target))
+		if err != nil {
+			ctx.Indf("    Recv ignoring message: %s", err)
+			return nil, false, nil
+		}
+		target = x
+	}
+
+	return target, true, nil
 }
 
 type Kill struct {
@@ -742,7 +1570,7 @@ func (p *Kill) Substitute(ctx *Ctx, t *Test) (*Kill, error) {
 func (p *Kill) Exec(ctx *Ctx, t *Test) error {
 	ctx.Indf("    Kill %s", JSON(p))
 
-	return p.ch.Kill(ctx)
+	return Categorize(CategoryChannel, p.ch.Kill(ctx))
 }
 
 type Reconnect struct {
@@ -758,7 +1586,7 @@ func (p *Reconnect) Substitute(ctx *Ctx, t *Test) (*Reconnect, error) {
 func (p *Reconnect) Exec(ctx *Ctx, t *Test) error {
 	ctx.Indf("    Reconnect %s", JSON(p))
 
-	return p.ch.Open(ctx)
+	return Categorize(CategoryChannel, p.ch.Open(ctx))
 }
 
 type Ingest struct {
@@ -821,10 +1649,19 @@ func CopyBindings(bs map[string]interface{}) map[string]interface{} {
 
 func (t *Test) jsEnv(ctx *Ctx) map[string]interface{} {
 	bs := CopyBindings(t.Bindings)
-	return map[string]interface{}{
+	env := map[string]interface{}{
 		"bindings": bs,
 		"bs":       bs,
 		"test":     t,
 		"elapsed":  float64(t.elapsed) / 1000 / 1000, // Milliseconds
+		"fetch":    t.fetch(ctx),
+		"history":  t.jsHistory(ctx),
+		"makeChan": t.jsMakeChan(ctx),
+
+		"idempotencyKey": t.IdempotencyKey,
+	}
+	for k, f := range t.jsClockFuncs(ctx) {
+		env[k] = f
 	}
+	return env
 }
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/Comcast/sheens/match"
 )
 
 var dejson = MustParseJSON
@@ -137,3 +139,56 @@ func MustParseJSON(js string) interface{} {
 	}
 	return x
 }
+
+func TestRecvMultiple(t *testing.T) {
+	bss, err := match.Match([]interface{}{"?x"}, []interface{}{"a", "b"}, match.NewBindings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bss) != 2 {
+		t.Fatalf("wanted 2 bindings sets but got %s", JSON(bss))
+	}
+
+	t.Run("unique", func(t *testing.T) {
+		if _, err := resolveBindingss("", bss); err == nil {
+			t.Fatal("should have complained")
+		}
+		same := []match.Bindings{bss[0], bss[0]}
+		bs, err := resolveBindingss(MultipleUnique, same)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bs["?x"] != bss[0]["?x"] {
+			t.Fatal(JSON(bs))
+		}
+	})
+
+	t.Run("first", func(t *testing.T) {
+		bs, err := resolveBindingss(MultipleFirst, bss)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bs["?x"] != bss[0]["?x"] {
+			t.Fatal(JSON(bs))
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		bs, err := resolveBindingss(MultipleAll, []match.Bindings{
+			{"?x": "a", "?y": 1},
+			{"?x": "b"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if js := JSON(bs); js != `{"?x":["a","b"],"?y":[1,null]}` {
+			t.Fatal(js)
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		if _, err := resolveBindingss("some", bss); err == nil {
+			t.Fatal("should have complained")
+		}
+	})
+}
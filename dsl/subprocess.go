@@ -0,0 +1,265 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func init() {
+	TheChanRegistry.Register(NewCtx(nil), "subprocess", NewSubprocessChan)
+	TheChanDocs.Register("subprocess", "A program that implements a channel by exchanging JSON lines (BridgeMsgs) over stdin and stdout.", SubprocessOpts{})
+}
+
+// SubprocessOpts configures a SubprocessChan.
+type SubprocessOpts struct {
+	Process
+
+	// Config, which is optional, is sent to the program in the
+	// initial "open" BridgeMsg.
+	Config interface{} `json:"config,omitempty" yaml:"config,omitempty" doc:"Configuration sent to the program in the open message."`
+
+	// BufferSize is the capacity of the channel's Buffer.
+	BufferSize int `json:"buffersize,omitempty" yaml:"buffersize,omitempty" doc:"Capacity of the internal buffer." default:"1024"`
+
+	// Overflow is the Buffer's overflow policy.
+	Overflow string `json:"overflow,omitempty" yaml:"overflow,omitempty" doc:"What to do with a message when the buffer is full (block, drop-oldest, drop-new, or fail-test)." default:"fail-test"`
+}
+
+// BridgeMsg is a line of JSON exchanged between a SubprocessChan and
+// its program.
+//
+// Plax writes these ops to the program's stdin:
+//
+//	open: Sent first with the channel's Config.
+//	pub: A message (Topic and Payload) published to the channel.
+//	sub: A subscription to Topic.
+//	kill: A request to ungracefully close any underlying connection.
+//	close: Sent before the program's stdin is closed.
+//
+// The program writes these ops to its stdout:
+//
+//	pub: A message (Topic and Payload) for Recvs.
+//	error: A problem (Error), which the next Pub or Sub reports.
+//	log: Text (Payload) for the log.
+//
+// Plax ignores other ops (so 'cat' is a loopback channel) and lines
+// that aren't JSON.
+type BridgeMsg struct {
+	Op      string      `json:"op"`
+	Topic   string      `json:"topic,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Config  interface{} `json:"config,omitempty"`
+}
+
+// SubprocessChan is a channel implemented by a program that speaks
+// the BridgeMsg protocol.
+type SubprocessChan struct {
+	p      *Process
+	config interface{}
+	c      chan Msg
+	buf    *Buffer
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// err is the program's most recent error (if any) that
+	// hasn't been reported.
+	err error
+
+	// exit is the program's ProcessExit after it terminated.
+	exit *ProcessExit
+
+	// closed reports whether the program's stdin is closed.
+	closed bool
+}
+
+// NewSubprocessChan makes a SubprocessChan.  The cfg should represent
+// a SubprocessOpts.
+func NewSubprocessChan(ctx *Ctx, cfg interface{}) (Chan, error) {
+	var opts SubprocessOpts
+	if err := As(cfg, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Command == "" {
+		return nil, fmt.Errorf("subprocess channel needs a command")
+	}
+	buf, err := NewBuffer("subprocess", opts.BufferSize, opts.Overflow)
+	if err != nil {
+		return nil, err
+	}
+	return &SubprocessChan{
+		p:      &opts.Process,
+		config: opts.Config,
+		c:      buf.C,
+		buf:    buf,
+	}, nil
+}
+
+func (c *SubprocessChan) Kind() ChanKind {
+	return "subprocess"
+}
+
+// Open starts the program and sends it an "open" BridgeMsg.
+func (c *SubprocessChan) Open(ctx *Ctx) error {
+	if err := c.p.Start(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line := <-c.p.Stdout:
+				c.read(ctx, line)
+			case <-c.p.Stderr:
+				// Already logged by the Process.
+			case x := <-c.p.Exited:
+				ctx.Logf("SubprocessChan %s exited: %s", c.p.Name, x.Status)
+				c.mu.Lock()
+				c.exit = x
+				c.mu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return c.send(ctx, &BridgeMsg{
+		Op:     "open",
+		Config: c.config,
+	})
+}
+
+// read handles a line from the program's stdout.
+func (c *SubprocessChan) read(ctx *Ctx, line string) {
+	var m BridgeMsg
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		ctx.Logdf("SubprocessChan %s ignoring non-JSON line", c.p.Name)
+		return
+	}
+	switch m.Op {
+	case "pub":
+		c.To(ctx, Msg{
+			Topic:   m.Topic,
+			Payload: m.Payload,
+		})
+	case "error":
+		ctx.Logf("SubprocessChan %s error: %s", c.p.Name, m.Error)
+		c.mu.Lock()
+		c.err = fmt.Errorf("subprocess %s: %s", c.p.Name, m.Error)
+		c.mu.Unlock()
+	case "log":
+		ctx.Logf("SubprocessChan %s: %v", c.p.Name, m.Payload)
+	default:
+		ctx.Logdf("SubprocessChan %s ignoring op '%s'", c.p.Name, m.Op)
+	}
+}
+
+// send writes the BridgeMsg to the program's stdin.  If the program
+// has reported an error (or has exited), send returns that error
+// instead.
+func (c *SubprocessChan) send(ctx *Ctx, m *BridgeMsg) error {
+	js, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.err; err != nil {
+		c.err = nil
+		return err
+	}
+	if c.exit != nil {
+		return fmt.Errorf("subprocess %s exited: %s", c.p.Name, c.exit.Status)
+	}
+	if c.closed {
+		return fmt.Errorf("subprocess %s: stdin is closed", c.p.Name)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case c.p.Stdin <- string(js) + "\n":
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("subprocess %s: timeout writing to stdin", c.p.Name)
+	}
+	return nil
+}
+
+// Close sends a "close" BridgeMsg and then closes the program's
+// stdin.
+func (c *SubprocessChan) Close(ctx *Ctx) error {
+	ctx.Logf("SubprocessChan %s Close", c.p.Name)
+	if err := c.send(ctx, &BridgeMsg{Op: "close"}); err != nil {
+		ctx.Logf("SubprocessChan %s Close: %s", c.p.Name, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed && c.p.Stdin != nil {
+		c.closed = true
+		close(c.p.Stdin)
+	}
+	return nil
+}
+
+func (c *SubprocessChan) Sub(ctx *Ctx, topic string) error {
+	ctx.Logf("SubprocessChan %s Sub %s", c.p.Name, topic)
+	return c.send(ctx, &BridgeMsg{
+		Op:    "sub",
+		Topic: topic,
+	})
+}
+
+func (c *SubprocessChan) Pub(ctx *Ctx, m Msg) error {
+	ctx.Logf("SubprocessChan %s Pub %s", c.p.Name, m.Topic)
+	return c.send(ctx, &BridgeMsg{
+		Op:      "pub",
+		Topic:   m.Topic,
+		Payload: m.Payload,
+	})
+}
+
+// Kill sends a "kill" BridgeMsg.
+func (c *SubprocessChan) Kill(ctx *Ctx) error {
+	return c.send(ctx, &BridgeMsg{Op: "kill"})
+}
+
+func (c *SubprocessChan) Recv(ctx *Ctx) chan Msg {
+	ctx.Logf("SubprocessChan %s Recv", c.p.Name)
+	return c.c
+}
+
+// To delivers the given message as if it came from the program.
+func (c *SubprocessChan) To(ctx *Ctx, m Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	return c.buf.Put(ctx, m)
+}
+
+// Overflow reports an overflow of the channel's Buffer.  See
+// Overflower.
+func (c *SubprocessChan) Overflow() error {
+	return c.buf.Overflow()
+}
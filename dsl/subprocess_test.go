@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubprocessChan(t *testing.T) {
+	ctx0, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx := NewCtx(ctx0)
+
+	script := `
+read line
+echo "{\"op\":\"pub\",\"topic\":\"open\",\"payload\":$line}"
+echo 'not json'
+echo '{"op":"log","payload":"hello"}'
+read line
+echo '{"op":"error","error":"nope"}'
+cat > /dev/null
+`
+	c, err := NewSubprocessChan(ctx, map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", script},
+		"config": map[string]interface{}{
+			"x": 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	select {
+	case m := <-c.Recv(ctx):
+		if m.Topic != "open" {
+			t.Fatal(m.Topic)
+		}
+		if js := JSON(m.Payload); !strings.Contains(js, `"op":"open"`) || !strings.Contains(js, `"config":{"x":1}`) {
+			t.Fatal(js)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	if err = c.Pub(ctx, Msg{Topic: "t", Payload: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The program's error is reported by a subsequent Pub.
+	for i := 0; i < 100; i++ {
+		if err = c.Pub(ctx, Msg{Topic: "t", Payload: "y"}); err != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Fatal(err)
+	}
+}
+
+func TestSubprocessChanNoCommand(t *testing.T) {
+	if _, err := NewSubprocessChan(NewCtx(nil), map[string]interface{}{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
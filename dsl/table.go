@@ -0,0 +1,217 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Table makes a Phase run once per row with the row's columns bound
+// as variables.  A column name that doesn't start with '?' gets one,
+// so the column "dish" binds "?dish".
+//
+// The rows are given inline (Rows) or in a CSV file (CSV).
+type Table struct {
+	// Columns optionally names the columns for Rows that are
+	// lists of values.
+	Columns []string `json:",omitempty" yaml:",omitempty"`
+
+	// Rows are maps from column names to values or, with
+	// Columns, lists of values.
+	Rows []interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// CSV is the filename of a CSV file whose first record has
+	// the column names.  A relative filename is resolved with
+	// respect to the test's Dir.  A value that's JSON (like 42 or true)
+	// is bound to that value, and other values are bound as
+	// strings.
+	CSV string `json:",omitempty" yaml:",omitempty"`
+}
+
+// RowResult reports the outcome of one row of a Phase's Table.
+type RowResult struct {
+	Phase string
+
+	// Row is the index of the row.
+	Row int
+
+	// Bindings are the row's bindings.
+	Bindings Bindings
+
+	// Error is the row's failure (if any).
+	Error string `json:",omitempty"`
+}
+
+func (r RowResult) String() string {
+	acc := fmt.Sprintf("phase %s row %d %s: ", r.Phase, r.Row, JSON(r.Bindings))
+	if r.Error == "" {
+		return acc + "passed"
+	}
+	return acc + "failed: " + r.Error
+}
+
+// columnVar returns the variable for the column name.
+func columnVar(name string) string {
+	if strings.HasPrefix(name, "?") {
+		return name
+	}
+	return "?" + name
+}
+
+// Check reports problems with an inline Table.
+func (tb *Table) Check() error {
+	if tb.CSV != "" {
+		if 0 < len(tb.Rows) || 0 < len(tb.Columns) {
+			return fmt.Errorf("Table has both a CSV and Rows or Columns")
+		}
+		return nil
+	}
+	if len(tb.Rows) == 0 {
+		return fmt.Errorf("Table has no Rows or CSV")
+	}
+	for i, row := range tb.Rows {
+		switch vs := row.(type) {
+		case map[string]interface{}:
+		case []interface{}:
+			if len(vs) != len(tb.Columns) {
+				return fmt.Errorf("Table row %d has %d values for %d Columns", i, len(vs), len(tb.Columns))
+			}
+		default:
+			return fmt.Errorf("Table row %d is a %T and not a map or list", i, row)
+		}
+	}
+	return nil
+}
+
+// bindings returns the bindings for each row.
+func (tb *Table) bindings(ctx *Ctx, t *Test) ([]Bindings, error) {
+	if err := tb.Check(); err != nil {
+		return nil, err
+	}
+
+	if tb.CSV != "" {
+		return tb.csv(t.testFile(tb.CSV))
+	}
+
+	acc := make([]Bindings, len(tb.Rows))
+	for i, row := range tb.Rows {
+		bs := make(Bindings)
+		switch vs := row.(type) {
+		case map[string]interface{}:
+			for k, v := range vs {
+				bs[columnVar(k)] = v
+			}
+		case []interface{}:
+			for j, v := range vs {
+				bs[columnVar(tb.Columns[j])] = v
+			}
+		}
+		acc[i] = bs
+	}
+	return acc, nil
+}
+
+func (tb *Table) csv(filename string) ([]Bindings, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Table CSV %s: %w", tb.CSV, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("Table CSV %s has no rows", tb.CSV)
+	}
+
+	var (
+		columns = records[0]
+		acc     = make([]Bindings, 0, len(records)-1)
+	)
+	for _, record := range records[1:] {
+		bs := make(Bindings, len(columns))
+		for j, s := range record {
+			bs[columnVar(columns[j])] = csvValue(s)
+		}
+		acc = append(acc, bs)
+	}
+	return acc, nil
+}
+
+// execTable executes the Phase once for each row of its Table.  Each
+// row starts with the bindings from before the Phase plus the row's
+// bindings, and the bindings from before the Phase are restored
+// afterwards.
+//
+// A failed row doesn't stop the remaining rows, but the Phase fails
+// if any row failed.  Each row's outcome is added to t.Rows.
+func (p *Phase) execTable(ctx *Ctx, t *Test) (string, error) {
+	rows, err := p.Table.bindings(ctx, t)
+	if err != nil {
+		return "", NewBroken(err)
+	}
+
+	var (
+		saved  = CopyBindings(t.Bindings)
+		failed int
+		first  error
+		next   string
+	)
+	defer func() {
+		t.Bindings = saved
+	}()
+
+	for i, row := range rows {
+		ctx.Indf("  Row %d %s", i, JSON(row))
+
+		t.Bindings = CopyBindings(saved)
+		for k, v := range row {
+			t.Bindings[k] = v
+		}
+
+		r := RowResult{
+			Phase:    t.phase,
+			Row:      i,
+			Bindings: row,
+		}
+		next, err = p.execSteps(ctx, t)
+		if err != nil {
+			r.Error = err.Error()
+			if failed++; first == nil {
+				first = fmt.Errorf("row %d: %w", i, err)
+			}
+		}
+		t.Rows = append(t.Rows, r)
+
+		if _, broke := IsBroken(err); broke {
+			return "", first
+		}
+	}
+
+	if first != nil {
+		return "", fmt.Errorf("%d of %d table rows failed (first %w)", failed, len(rows), first)
+	}
+
+	return next, nil
+}
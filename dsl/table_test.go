@@ -0,0 +1,165 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tableTest returns a test whose phase1 makes a mock channel and
+// whose phase2 has the given Table and echoes '?dish' and '?n' via
+// the mock channel.
+func tableTest(t *testing.T, table *Table) (*Ctx, *Test) {
+	ctx, s, tst := newTest(t)
+
+	p1 := &Phase{}
+	s.Phases["phase1"] = p1
+	addMock(t, ctx, p1)
+	p1.AddStep(ctx, &Step{Goto: "phase2"})
+
+	p2 := &Phase{Table: table}
+	s.Phases["phase2"] = p2
+	p2.AddStep(ctx, &Step{
+		Pub: &Pub{
+			Payload: dejson(`{"dish":"?dish","n":"?n"}`),
+		},
+	})
+	p2.AddStep(ctx, &Step{
+		Recv: &Recv{
+			Pattern: dejson(`{"dish":"?dish","n":"?got"}`),
+			Guard:   `return bs["?got"] < 3`,
+			Timeout: 50 * time.Millisecond,
+		},
+	})
+
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx, tst
+}
+
+func TestTable(t *testing.T) {
+	var table Table
+	err := yaml.Unmarshal([]byte(`
+columns: [dish, "?n"]
+rows:
+  - [tacos, 1]
+  - [queso, 2]
+`), &table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, tst := tableTest(t, &table)
+	tst.Bindings["?before"] = "yes"
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+
+	if len(tst.Rows) != 2 {
+		t.Fatal(JSON(tst.Rows))
+	}
+	if r := tst.Rows[1]; r.Phase != "phase2" || r.Row != 1 || r.Bindings["?dish"] != "queso" || r.Error != "" {
+		t.Fatal(JSON(r))
+	}
+	if !strings.HasSuffix(tst.Rows[0].String(), ": passed") {
+		t.Fatal(tst.Rows[0].String())
+	}
+
+	// Rows' bindings don't leak.
+	if _, have := tst.Bindings["?dish"]; have {
+		t.Fatal(JSON(tst.Bindings))
+	}
+	if tst.Bindings["?before"] != "yes" {
+		t.Fatal(JSON(tst.Bindings))
+	}
+}
+
+func TestTableFailures(t *testing.T) {
+	ctx, tst := tableTest(t, &Table{
+		Rows: []interface{}{
+			map[string]interface{}{"dish": "tacos", "n": 5},
+			map[string]interface{}{"dish": "queso", "n": 1},
+			map[string]interface{}{"dish": "chips", "n": 7},
+		},
+	})
+
+	errs := tst.Run(ctx)
+	if errs == nil {
+		t.Fatal("should have failed")
+	}
+	if err := errs.Err.Error(); !strings.Contains(err, "2 of 3 table rows failed (first row 0:") {
+		t.Fatal(err)
+	}
+	if CategoryOf(errs.Err) != CategoryTimeout {
+		t.Fatal(CategoryOf(errs.Err))
+	}
+
+	// All of the rows ran.
+	if len(tst.Rows) != 3 || tst.Rows[0].Error == "" || tst.Rows[1].Error != "" || tst.Rows[2].Error == "" {
+		t.Fatal(JSON(tst.Rows))
+	}
+}
+
+func TestTableCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := "dish,n\ntacos,1\n\"queso, blanco\",2\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "dishes.csv"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, tst := tableTest(t, &Table{CSV: "dishes.csv"})
+	tst.Dir = dir
+	if errs := tst.Run(ctx); errs != nil {
+		t.Fatal(errs)
+	}
+	if len(tst.Rows) != 2 {
+		t.Fatal(JSON(tst.Rows))
+	}
+	// JSON values are parsed.
+	if r := tst.Rows[1]; r.Bindings["?dish"] != "queso, blanco" || r.Bindings["?n"] != 2.0 {
+		t.Fatal(JSON(r))
+	}
+}
+
+func TestTableCheck(t *testing.T) {
+	for _, tb := range []*Table{
+		{},
+		{CSV: "x.csv", Rows: []interface{}{map[string]interface{}{}}},
+		{Columns: []string{"a"}, Rows: []interface{}{[]interface{}{1, 2}}},
+		{Rows: []interface{}{"tacos"}},
+	} {
+		if err := tb.Check(); err == nil {
+			t.Fatalf("%s should have been rejected", JSON(tb))
+		}
+	}
+}
@@ -20,8 +20,14 @@ package dsl
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/dop251/goja"
+	"github.com/xeipuuv/gojsonschema"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 var (
@@ -30,6 +36,10 @@ var (
 
 // Test is the top-level type for a complete test.
 type Test struct {
+	// Version is the version of the test format that the test
+	// uses, which defaults to DefaultVersion.  See CheckVersion.
+	Version int `json:",omitempty" yaml:",omitempty"`
+
 	// Id usually comes from the filename that defines the test.
 	Id string `json:",omitempty" yaml:",omitempty"`
 
@@ -39,6 +49,11 @@ type Test struct {
 	// Labels is an optional set of labels (e.g., "cpe", "app").
 	Labels []string `json:",omitempty" yaml:",omitempty"`
 
+	// Owners optionally names the teams (or people) responsible
+	// for the test.  Reports include them so that failures can be
+	// routed to their owners.
+	Owners []string `json:",omitempty" yaml:",omitempty"`
+
 	// Priority 0 is the highest priority.
 	Priority int
 
@@ -77,12 +92,18 @@ type Test struct {
 	// Javascript.  This source is loaded into each Javascript
 	// environment.
 	//
-	// Warning: These files are loaded for each Javascript
-	// invocation (because re-using the Javascript environment is
-	// not a safe thing to do -- and I don't think I can "seal"
-	// one environment and extend it per-invocation).
+	// These files are loaded once per Run into the test's
+	// Javascript environment, which persists across steps.  See
+	// Test.JSExec().
 	Libraries []string
 
+	// Packages are references ("NAME@VERSION" or just "NAME") to
+	// shared libraries and fixtures.  See Package.
+	Packages []string `json:",omitempty" yaml:",omitempty"`
+
+	// packages are the resolved Packages.
+	packages []*Package
+
 	// Negative indicates that a reported failure (but not error)
 	// should be interpreted as a success.
 	Negative bool
@@ -102,6 +123,142 @@ type Test struct {
 	// by invoke.Run().
 	Retries *Retries
 
+	// Instances, when greater than one, is the number of
+	// concurrent copies of this test to run.
+	//
+	// Each copy gets its own channels, state, and bindings.  See
+	// invoke.RunInstances().
+	Instances int `json:",omitempty" yaml:",omitempty"`
+
+	// Record, when not empty, is the name of a file to which all
+	// messages published to or received from channels (other
+	// than Mother) are appended.  See Recorder and ReplayChan.
+	Record string `json:",omitempty" yaml:",omitempty"`
+
+	// FailOnLeaks, when true, fails a test that otherwise passes
+	// but leaks channels or goroutines.  See Finalize and Leaks.
+	FailOnLeaks bool `json:",omitempty" yaml:",omitempty"`
+
+	// Skip, if given, can skip the entire test.  See Skip.
+	Skip *Skip `json:",omitempty" yaml:",omitempty"`
+
+	// Skipped reports the test (if skipped) or the steps that
+	// were skipped by the last Run.
+	Skipped []Skipped `json:",omitempty" yaml:"-"`
+
+	// Latencies reports how long each step (that didn't fail or
+	// skip) took during the last Run.
+	Latencies []StepLatency `json:",omitempty" yaml:"-"`
+
+	// Rows reports the outcome of each row of each Phase with a
+	// Table during the last Run.
+	Rows []RowResult `json:",omitempty" yaml:"-"`
+
+	// Subtests reports the outcome of each RunTest during the
+	// last Run.
+	Subtests []SubtestResult `json:",omitempty" yaml:"-"`
+
+	// Leaks reports the channels that the last Finalize couldn't
+	// close and any goroutines that outlived the test.
+	Leaks []string `json:",omitempty" yaml:"-"`
+
+	// Assertions reports the number of assertions (successful
+	// Recv and RecvSeq steps on channels other than Mother) that
+	// the last Run executed.  See
+	// Spec.MinAssertions.
+	Assertions int `json:",omitempty" yaml:"-"`
+
+	// js is the Javascript environment for the current Run.
+	js *goja.Runtime
+
+	// jsMu protects js.
+	jsMu sync.Mutex
+
+	// phase is the current phase.
+	phase string
+
+	// step is the index of the current step in the current phase.
+	step int
+
+	// depth is the number of RunTests that led to this test.
+	depth int
+
+	// History is the number of received messages per channel
+	// that Javascript can access via history(CHAN, N).
+	//
+	// Zero means DefaultHistory, and a negative value disables
+	// the history.
+	History int `json:",omitempty" yaml:",omitempty"`
+
+	// Clock optionally configures a fake clock.  See ClockSpec.
+	Clock *ClockSpec `json:",omitempty" yaml:",omitempty"`
+
+	// clock is the fake clock (if any) for the current Run.
+	clock *FakeClock
+
+	// history remembers received messages for the current Run.
+	history *History
+
+	// held has messages, by channel name, that Recvs with Topics
+	// set aside.
+	held map[string][]Msg
+
+	// paused has the buffers, by channel name, of the paused
+	// channels.  See Pause.
+	paused map[string]*pauseBuffer
+
+	// scope is the bindings scope of the current phase if that
+	// phase has ScopePhase.
+	scope *bindingsScope
+
+	// tracing is the TraceEvent for the current step (if
+	// tracing).
+	tracing *TraceEvent
+
+	// protoFiles caches protobuf descriptors by filename.
+	protoFiles map[string]*protoregistry.Files
+
+	// registries caches Avro SchemaRegistries by URL.
+	registries map[string]*SchemaRegistry
+
+	// schemas caches JSON Schemas.  See jsonSchema.
+	schemas map[string]*gojsonschema.Schema
+
+	// canons has the CanonSpecs, by channel name, that were given
+	// when channels were made.
+	canons map[string]*CanonSpec
+
+	// reconnects has the ReconnectPolicies, by channel name, that
+	// were given when the channels were made.
+	reconnects map[string]*ReconnectPolicy
+
+	// subs has the topics, by channel name, that Subs subscribed
+	// to, so that a reconnection can renew those subscriptions.
+	subs map[string][]string
+
+	// filters has the inbound filtering state, by channel name,
+	// for channels made with an InboundFilter or a Dedupe.
+	filters map[string]*chanFilter
+
+	// topicRules has the TopicRules, by channel name, for
+	// channels made with them.
+	topicRules map[string]*TopicRules
+
+	// closed has the names of the channels that have been closed.
+	// See closeChan.
+	closed map[string]bool
+
+	// idempotencySeed is the secret for IdempotencyKey.  It
+	// survives Runs so that retries get the same keys.
+	idempotencySeed string
+
+	// recorder is the Recorder for Record.
+	recorder *Recorder
+
+	// Debugger, when not nil, pauses before each step.  See
+	// Debugger.
+	Debugger *Debugger `json:"-" yaml:"-"`
+
 	// Registry is the channel (type) registry for this test.
 	//
 	// Defaults to TheChanRegistry.
@@ -121,29 +278,49 @@ func NewTest(ctx *Ctx, id string, s *Spec) *Test {
 }
 
 // Wanted reports whether a test meets the given requirments.
+//
+// See LabelsMatch for the interpretation of labels.
 func (t *Test) Wanted(ctx *Ctx, lowestPriority int, labels []string) bool {
 	if 0 <= lowestPriority && t.Priority > lowestPriority {
 		return false
 	}
-LABELS:
-	for _, label := range labels {
-		if label == "" {
-			continue
-		}
-		for _, have := range t.Labels {
-			if label == have {
-				continue LABELS
+	return LabelsMatch(t.Labels, labels)
+}
+
+// LabelsMatch reports whether the given labels meet the requirements
+// in wanted.  A required label like "!slow" means that the label
+// "slow" must be absent.  Every other (non-empty) required label must
+// be present.
+func LabelsMatch(have []string, wanted []string) bool {
+	has := func(label string) bool {
+		for _, h := range have {
+			if h == label {
+				return true
 			}
 		}
 		return false
 	}
 
+	for _, label := range wanted {
+		switch {
+		case label == "":
+		case strings.HasPrefix(label, "!"):
+			if has(label[1:]) {
+				return false
+			}
+		default:
+			if !has(label) {
+				return false
+			}
+		}
+	}
+
 	return true
 }
 
 // Tick returns the duration since the last Tick.
 func (t *Test) Tick(ctx *Ctx) time.Duration {
-	now := time.Now().UTC()
+	now := t.Now()
 	t.elapsed = now.Sub(t.T)
 	t.T = now
 	return t.elapsed
@@ -228,14 +405,14 @@ func (es *Errors) IsBroken() (*Broken, bool) {
 func (es *Errors) Error() string {
 	var acc string
 	if es.InitErr != nil {
-		acc = "InitErr: " + es.Err.Error()
+		acc = "InitErr: " + es.InitErr.Error()
 	}
 
 	if es.Err != nil {
 		if 0 < len(acc) {
 			acc += "; "
 		}
-		acc = "Err: " + es.Err.Error()
+		acc += "Err: " + es.Err.Error()
 	}
 
 	for phase, err := range es.FinalErrors {
@@ -255,8 +432,57 @@ func (es *Errors) Error() string {
 // phases (if any).
 func (t *Test) Run(ctx *Ctx) *Errors {
 
+	ctx = ctx.WithFields(map[string]interface{}{
+		"test": t.Id,
+	})
+
 	errs := NewErrors()
 
+	if err := t.Spec.CheckParams(ctx, t.Bindings); err != nil {
+		errs.InitErr = err
+		return errs
+	}
+
+	if err := t.checkTypes(ctx); err != nil {
+		errs.InitErr = err
+		return errs
+	}
+
+	ctx.Redactor.AddBindings(t.Bindings)
+
+	t.Skipped = nil
+	t.Latencies = nil
+	t.Rows = nil
+	t.Subtests = nil
+	t.Assertions = 0
+	t.js = nil
+	t.held = nil
+	t.scope = nil
+	t.unpause()
+
+	if err := t.initClock(); err != nil {
+		errs.InitErr = err
+		return errs
+	}
+
+	t.history = NewHistory(t.History)
+	if t.History == 0 {
+		t.history.Max = DefaultHistory
+	}
+
+	skip, reason, err := t.Skip.Check(ctx, t)
+	if err != nil {
+		errs.InitErr = err
+		return errs
+	}
+	if skip {
+		ctx.Indf("Skipping test %s %s", t.Id, reason)
+		t.Skipped = append(t.Skipped, Skipped{
+			Reason: reason,
+		})
+		return nil
+	}
+
 	if err := t.InitChans(ctx); err != nil {
 		errs.InitErr = err
 		return errs
@@ -279,6 +505,10 @@ func (t *Test) Run(ctx *Ctx) *Errors {
 		}
 	}
 
+	if errs.IsFine() {
+		errs.Err = t.checkAssertions(ctx)
+	}
+
 	if !errs.IsFine() {
 		return errs
 	}
@@ -286,6 +516,31 @@ func (t *Test) Run(ctx *Ctx) *Errors {
 	return nil
 }
 
+// assertion counts a successful Recv (or RecvSeq) on the given
+// channel as an assertion unless the channel is Mother, whose
+// replies are just setup.
+func (t *Test) assertion(c Chan) {
+	if c != nil && c.Kind() == "mother" {
+		return
+	}
+	t.Assertions++
+}
+
+// checkAssertions returns a broken error if the Run executed fewer
+// than Spec.MinAssertions assertions.
+func (t *Test) checkAssertions(ctx *Ctx) error {
+	min := t.Spec.MinAssertions
+	if min <= 0 {
+		return nil
+	}
+	ctx.Indf("Assertions: %d (minimum %d)", t.Assertions, min)
+	if t.Assertions < min {
+		return Categorize(CategoryCoverage,
+			Brokenf("executed %d assertions but the minimum is %d", t.Assertions, min))
+	}
+	return nil
+}
+
 // RunFrom begins test execution starting at the given phase.
 func (t *Test) RunFrom(ctx *Ctx, from string) error {
 	stepsTaken := 0
@@ -295,6 +550,7 @@ func (t *Test) RunFrom(ctx *Ctx, from string) error {
 			return fmt.Errorf("No phase '%s'", from)
 		}
 		ctx.Indf("Phase %s", from)
+		t.phase = from
 
 		next, err := p.Exec(ctx, t)
 		if err != nil {
@@ -335,6 +591,14 @@ func (t *Test) makeChan(ctx *Ctx, kind ChanKind, opts interface{}) (Chan, error)
 		return nil, err
 	}
 
+	// Channels (like replay) resolve relative filenames with
+	// respect to ctx.Dir, which should be the test's Dir.
+	if t.Dir != "" && t.Dir != ctx.Dir {
+		c := *ctx
+		c.Dir = t.Dir
+		ctx = &c
+	}
+
 	return maker(ctx, x)
 }
 
@@ -357,12 +621,18 @@ func (t *Test) Validate(ctx *Ctx) []error {
 			if s.Recv != nil {
 				ops++
 			}
+			if s.RecvSeq != nil {
+				ops++
+			}
 			if s.Goto != "" {
 				ops++
 			}
 			if s.Ingest != nil {
 				ops++
 			}
+			if s.Inspect != nil {
+				ops++
+			}
 			if s.Kill != nil {
 				ops++
 			}
@@ -372,12 +642,36 @@ func (t *Test) Validate(ctx *Ctx) []error {
 			if s.Reconnect != nil {
 				ops++
 			}
+			if s.Pause != nil {
+				ops++
+			}
+			if s.Resume != nil {
+				ops++
+			}
 			if s.Wait != "" {
 				ops++
 			}
 			if s.Branch != "" {
 				ops++
 			}
+			if s.Set != nil {
+				ops++
+			}
+			if s.WaitFor != nil {
+				ops++
+			}
+			if s.RunTest != nil {
+				ops++
+			}
+			if s.MakeChan != nil {
+				ops++
+			}
+			if s.Health != nil {
+				ops++
+			}
+			if s.Export != nil {
+				ops++
+			}
 			if s.Doc != "" {
 				ops++
 			}
@@ -389,35 +683,133 @@ func (t *Test) Validate(ctx *Ctx) []error {
 		}
 	}
 
-	// Check that any Goto Step is the last step in a Phase.
-	//
-	// ToDo: Maybe require all Phases to have Goto.
+	// Check Scopes.
 	for name, p := range t.Spec.Phases {
-		for i := 0; i < len(p.Steps)-1; i++ {
-			s := p.Steps[i]
-			if s.Goto != "" {
-				fmt.Errorf("Goto step %d in phase '%s' is not the last step",
-					i, name)
+		if err := checkScope(p.Scope); err != nil {
+			errs = append(errs, fmt.Errorf("phase %s: %w", name, err))
+		}
+	}
+
+	// Check Tables.
+	for name, p := range t.Spec.Phases {
+		if p.Table == nil {
+			continue
+		}
+		if err := p.Table.Check(); err != nil {
+			errs = append(errs, fmt.Errorf("phase %s: %w", name, err))
+		}
+	}
+
+	// Check Gotos, Branches, reachability, and channel names.
+	errs = append(errs, t.Lint(ctx)...)
+
+	// Check that no step has both a Chan and Chans.
+	for phaseName, p := range t.Spec.Phases {
+		for i, s := range p.Steps {
+			var ambiguous bool
+			switch {
+			case s.Pub != nil:
+				ambiguous = s.Pub.Chan != "" && 0 < len(s.Pub.Chans)
+			case s.Sub != nil:
+				ambiguous = s.Sub.Chan != "" && 0 < len(s.Sub.Chans)
+			case s.Recv != nil:
+				ambiguous = s.Recv.Chan != "" && 0 < len(s.Recv.Chans)
+			}
+			if ambiguous {
+				errs = append(errs,
+					fmt.Errorf("step %d in phase '%s' has both a Chan and Chans",
+						i, phaseName))
 			}
 		}
 	}
 
-	// Check that each Goto Step has a defined Phase.
+	// Check that each Recv has a known Multiple strategy.
 	for phaseName, p := range t.Spec.Phases {
 		for i, s := range p.Steps {
-			if s.Goto == "" {
+			if s.Recv == nil {
 				continue
 			}
-			if HappyTerminalPhase(s.Goto) {
-				continue
+			switch s.Recv.Multiple {
+			case "", MultipleUnique, MultipleFirst, MultipleAll:
+			default:
+				errs = append(errs,
+					fmt.Errorf("Recv step %d in phase '%s' has unknown Multiple '%s'",
+						i, phaseName, s.Recv.Multiple))
 			}
-			if _, have := t.Spec.Phases[s.Goto]; !have {
+			switch s.Recv.ChanPolicy {
+			case "", ChanPolicyAll, ChanPolicyAny:
+			default:
 				errs = append(errs,
-					fmt.Errorf("No phase '%s', which is targeted by step %d in phase '%s'",
-						s.Goto, i, phaseName))
+					fmt.Errorf("Recv step %d in phase '%s' has unknown ChanPolicy '%s'",
+						i, phaseName, s.Recv.ChanPolicy))
+			}
+		}
+	}
+
+	// Check PayloadFormats, Canons, and Fixtures.
+	for phaseName, p := range t.Spec.Phases {
+		for i, s := range p.Steps {
+			var (
+				format, encoding string
+				proto            *ProtoSpec
+				avro             *AvroSpec
+			)
+			switch {
+			case s.Pub != nil:
+				format, encoding = s.Pub.PayloadFormat, s.Pub.PayloadEncoding
+				proto, avro = s.Pub.Proto, s.Pub.Avro
+			case s.Recv != nil:
+				format, encoding = s.Recv.PayloadFormat, s.Recv.PayloadEncoding
+				proto, avro = s.Recv.Proto, s.Recv.Avro
+			}
+			if err := checkCodecSpecs(format, encoding, proto, avro); err != nil {
+				errs = append(errs,
+					fmt.Errorf("step %d in phase '%s': %s", i, phaseName, err))
+			}
+			if s.Recv != nil {
+				if err := s.Recv.Canon.Check(); err != nil {
+					errs = append(errs,
+						fmt.Errorf("step %d in phase '%s': %s", i, phaseName, err))
+				}
+			}
+
+			var err error
+			switch {
+			case s.Pub != nil:
+				err = t.Spec.checkFixture(s.Pub.Fixture, s.Pub.With, s.Pub.Payload)
+			case s.Recv != nil:
+				err = t.Spec.checkFixture(s.Recv.Fixture, s.Recv.With, s.Recv.Pattern)
+			}
+			if err != nil {
+				errs = append(errs,
+					fmt.Errorf("step %d in phase '%s': %s", i, phaseName, err))
+			}
+		}
+	}
+
+	// Check that each named schema compiles.
+	if t.Spec.Schemas != nil {
+		names := make([]string, 0, len(t.Spec.Schemas))
+		for name := range t.Spec.Schemas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, err := t.jsonSchema(name); err != nil {
+				errs = append(errs, err)
 			}
 		}
 	}
+
+	// Check that each Param has a legal Type.
+	for name, p := range t.Spec.Params {
+		if p != nil && !p.validType() {
+			errs = append(errs,
+				fmt.Errorf("Param '%s' has unknown type '%s' (want one of %s)",
+					name, p.Type, strings.Join(ParamTypes, ", ")))
+		}
+	}
+
 	if len(errs) == 0 {
 		return nil
 	}
@@ -431,7 +823,7 @@ func (t *Test) Init(ctx *Ctx) error {
 	// subsitution.  So we delay parsing until Wait execution
 	// time.
 
-	return nil
+	return t.loadPackages(ctx)
 }
 
 func (t *Test) InitChans(ctx *Ctx) error {
@@ -447,6 +839,13 @@ func (t *Test) InitChans(ctx *Ctx) error {
 	}
 	t.Chans["mother"] = m
 
+	if t.Record != "" && t.recorder == nil {
+		if t.recorder, err = NewRecorder(ctx, t.Record); err != nil {
+			return err
+		}
+		t.recorder.Test = t.Id
+	}
+
 	return nil
 }
 
@@ -495,11 +894,24 @@ func (t *Test) ensureChan(ctx *Ctx, name string, dst *Chan) error {
 	return nil
 }
 
+// Close closes every channel even if closing one of them fails, and
+// it returns the first error.  See Finalize.
 func (t *Test) Close(ctx *Ctx) error {
-	for _, c := range t.Chans {
-		if err := c.Close(ctx); err != nil {
+	t.unpause()
+	var first error
+	for _, name := range t.sortedChanNames() {
+		if err := t.closeChan(ctx, name, t.Chans[name]); err != nil && first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return first
+	}
+	if t.recorder != nil {
+		if err := t.recorder.Close(); err != nil {
 			return err
 		}
+		t.recorder = nil
 	}
 	return nil
 }
@@ -516,6 +928,9 @@ func TestIdFromPathname(s string) string {
 
 func (t *Test) getLibraries(ctx *Ctx) (string, error) {
 	var src string
+	for _, p := range t.packages {
+		src += p.src
+	}
 	for _, filename := range t.Libraries {
 		filename = t.Dir + "/" + filename
 		js, err := ioutil.ReadFile(filename)
@@ -528,12 +943,33 @@ func (t *Test) getLibraries(ctx *Ctx) (string, error) {
 }
 
 func (t *Test) prepareSource(ctx *Ctx, code string) (string, error) {
-	libs, err := t.getLibraries(ctx)
-	if err != nil {
-		return "", err
+	return fmt.Sprintf("(function()\n{\n%s\n})()", code), nil
+}
+
+// IsSkipped reports whether the last Run skipped the entire test and,
+// if so, why.
+func (t *Test) IsSkipped() (bool, string) {
+	for _, s := range t.Skipped {
+		if s.Phase == "" {
+			return true, s.Reason
+		}
 	}
-	src := libs + "\n" + fmt.Sprintf("(function()\n{\n%s\n})()", code)
-	return src, nil
+	return false, ""
+}
+
+// skipStep checks the Step's Skip and records the Step if skipped.
+func (t *Test) skipStep(ctx *Ctx, s *Step, i int) (bool, error) {
+	skip, reason, err := s.Skip.Check(ctx, t)
+	if err != nil || !skip {
+		return false, err
+	}
+	ctx.Indf("    Skip %s", reason)
+	t.Skipped = append(t.Skipped, Skipped{
+		Phase:  t.phase,
+		Step:   i,
+		Reason: reason,
+	})
+	return true, nil
 }
 
 // Bind replaces all bindings in the given (structured) thing.
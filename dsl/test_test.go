@@ -22,6 +22,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -48,6 +50,23 @@ func TestWanted(t *testing.T) {
 			t.Fatal(1)
 		}
 	})
+
+	tst.Labels = []string{"smoke", "mqtt"}
+	for _, c := range []struct {
+		labels []string
+		want   bool
+	}{
+		{[]string{""}, true},
+		{[]string{"smoke"}, true},
+		{[]string{"smoke", "mqtt"}, true},
+		{[]string{"smoke", "slow"}, false},
+		{[]string{"smoke", "!slow"}, true},
+		{[]string{"!mqtt"}, false},
+	} {
+		if got := tst.Wanted(ctx, -1, c.labels); got != c.want {
+			t.Fatalf("%v: %v", c.labels, got)
+		}
+	}
 }
 
 func TestSubstitute(t *testing.T) {
@@ -191,11 +210,18 @@ func TestSubstituteOnce(t *testing.T) {
 }
 
 func testFromFile(t *testing.T, filename string) (*Test, *Errors) {
+	return testFromFileWith(t, filename, nil)
+}
+
+// testFromFileWith runs the test in the given file with the given
+// additional bindings.
+func testFromFileWith(t *testing.T, filename string, more Bindings) (*Test, *Errors) {
 	var (
 		ctx0, cancel = context.WithCancel(context.Background())
 		ctx          = NewCtx(ctx0)
 	)
 	defer cancel()
+	ctx.IncludeDirs = []string{filepath.Dir(filename)}
 
 	bs, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -218,6 +244,10 @@ func testFromFile(t *testing.T, filename string) (*Test, *Errors) {
 		t.Fatal(err)
 	}
 
+	for p, v := range more {
+		tst.Bindings[p] = v
+	}
+
 	if errs := tst.Validate(ctx); errs != nil {
 		var acc string
 		for i, err := range errs {
@@ -251,3 +281,185 @@ func TestFinally(t *testing.T) {
 		t.Fatal(n)
 	}
 }
+
+func TestErrorsError(t *testing.T) {
+	es := NewErrors()
+	es.InitErr = fmt.Errorf("no chans")
+	if s := es.Error(); s != "InitErr: no chans" {
+		t.Fatal(s)
+	}
+
+	es.Err = fmt.Errorf("timeout")
+	if s := es.Error(); s != "InitErr: no chans; Err: timeout" {
+		t.Fatal(s)
+	}
+
+	es = NewErrors()
+	es.Err = fmt.Errorf("timeout")
+	es.FinalErrors["cleanup"] = fmt.Errorf("gone")
+	if s := es.Error(); s != "Err: timeout; final cleanup: gone" {
+		t.Fatal(s)
+	}
+}
+
+func TestBindingsExpand(t *testing.T) {
+	ctx := NewCtx(nil)
+	bs := Bindings{
+		"?x": 42,
+		"?y": "{?z}",
+		"?z": "zee",
+	}
+	x := map[string]interface{}{
+		"a": "?x",
+		"b": []interface{}{"say {?y}", "!!'untouched {?x}'"},
+		"c": "?unbound",
+		"d": "{?x}",
+	}
+	y, err := bs.Expand(ctx, x, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": 42,
+		"b": []interface{}{"say zee", "!!'untouched 42'"},
+		"c": "?unbound",
+		"d": 42,
+	}
+	if !reflect.DeepEqual(y, want) {
+		t.Fatal(y)
+	}
+
+	t.Run("eval", func(t *testing.T) {
+		y, err := bs.Expand(ctx, x, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want["b"] = []interface{}{"say zee", "untouched 42"}
+		if !reflect.DeepEqual(y, want) {
+			t.Fatal(y)
+		}
+	})
+}
+
+func TestSplice(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	bs := Bindings{
+		"?obj":  map[string]interface{}{"a": 1.0, "b": []interface{}{true}},
+		"?n":    42.0,
+		"?ref":  "{?obj}",
+		"?name": `say "hi"`,
+	}
+	want := map[string]interface{}{
+		"x": map[string]interface{}{"a": 1.0, "b": []interface{}{true}},
+		"y": 42.0,
+		"z": "n=42",
+		"r": map[string]interface{}{"a": 1.0, "b": []interface{}{true}},
+		"q": `say "hi"`,
+		"j": "!!'untouched'",
+	}
+
+	for _, src := range []interface{}{
+		map[string]interface{}{
+			"x": "{?obj}",
+			"y": "{?n}",
+			"z": "n={?n}",
+			"r": "{?ref}",
+			"q": "{?name}",
+			"j": "!!'untouched'",
+		},
+		`{"x":"{?obj}","y":"{?n}","z":"n={?n}","r":"{?ref}","q":"{?name}","j":"!!'untouched'"}`,
+	} {
+		var y interface{}
+		if err := bs.Sub(ctx, src, &y, true); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(y, want) {
+			t.Fatalf("%T: got %s", src, JSON(y))
+		}
+	}
+
+	t.Run("string", func(t *testing.T) {
+		// A string that isn't JSON structure still gets
+		// textual substitution.
+		var y interface{}
+		if err := bs.Sub(ctx, "{?n}", &y, false); err != nil {
+			t.Fatal(err)
+		}
+		if y != "42" {
+			t.Fatalf("%#v", y)
+		}
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		bs := Bindings{
+			"?k": "deviceId",
+			"?v": "abc",
+		}
+		want := map[string]interface{}{
+			"deviceId": "abc",
+			"nested":   map[string]interface{}{"id-deviceId": "abc"},
+		}
+		for _, src := range []interface{}{
+			`{"{?k}":"{?v}","nested":{"id-{?k}":"{?v}"}}`,
+			map[string]interface{}{
+				"{?k}":   "{?v}",
+				"nested": map[string]interface{}{"id-{?k}": "{?v}"},
+			},
+		} {
+			var y interface{}
+			if err := bs.Sub(ctx, src, &y, true); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(y, want) {
+				t.Fatalf("%T: got %s", src, JSON(y))
+			}
+		}
+	})
+
+	t.Run("key-collision", func(t *testing.T) {
+		bs := Bindings{
+			"?k": "deviceId",
+		}
+		var y interface{}
+		src := `{"{?k}":1,"deviceId":2}`
+		if err := bs.Sub(ctx, src, &y, true); err == nil {
+			t.Fatal(JSON(y))
+		}
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		bs := Bindings{
+			"?a": []interface{}{"{?a}"},
+		}
+		var y interface{}
+		if err := bs.Sub(ctx, map[string]interface{}{"a": "{?a}"}, &y, true); err == nil {
+			t.Fatal(JSON(y))
+		}
+	})
+}
+
+func TestMinAssertions(t *testing.T) {
+	tst, errs := testFromFile(t, "../demos/min-assertions.yaml")
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if tst.Assertions != 2 {
+		t.Fatal(tst.Assertions)
+	}
+
+	tst, errs = testFromFileWith(t, "../demos/min-assertions.yaml", Bindings{
+		"?skip": true,
+	})
+	if errs == nil {
+		t.Fatal("expected an error")
+	}
+	if _, is := IsBroken(errs); !is {
+		t.Fatal(errs)
+	}
+	if c := CategoryOf(errs); c != CategoryCoverage {
+		t.Fatal(c)
+	}
+	if tst.Assertions != 0 {
+		t.Fatal(tst.Assertions)
+	}
+}
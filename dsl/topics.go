@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TopicRules rewrite a channel's topics so that the same spec can
+// run against environments that use different topic namespaces.
+//
+// A Pub or Sub topic is rewritten by each of the Rewrites (in order)
+// and then gets the Prefix.  An inbound message's topic loses the
+// Prefix (if present) and is then rewritten by each of the Inbound
+// rewrites, so Recvs see topics as the spec wrote them.
+type TopicRules struct {
+	// Prefix, which is subject to bindings substitution, is
+	// prepended to outbound topics and removed from inbound
+	// topics.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Rewrites are applied to Pub and Sub topics.
+	Rewrites []*TopicRewrite `json:"rewrites,omitempty"`
+
+	// Inbound rewrites are applied to the topics of inbound
+	// messages, typically to undo the Rewrites.
+	Inbound []*TopicRewrite `json:"inbound,omitempty"`
+}
+
+// TopicRewrite replaces the parts of a topic that match a regular
+// expression.
+type TopicRewrite struct {
+	// Match is a (Go) regular expression.
+	Match string `json:"match"`
+
+	// Replace is the replacement, which can refer to Match's
+	// submatches as '$1' or '${name}'.
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+func (r *TopicRewrite) compile() error {
+	re, err := regexp.Compile(r.Match)
+	if err != nil {
+		return Brokenf("bad topic rewrite Match '%s': %s", r.Match, err)
+	}
+	r.re = re
+	return nil
+}
+
+func (r *TopicRewrite) rewrite(topic string) string {
+	return r.re.ReplaceAllString(topic, r.Replace)
+}
+
+// Substitute returns a copy of the rules with the Prefix subject to
+// bindings substitution.
+func (rs *TopicRules) Substitute(ctx *Ctx, t *Test) (*TopicRules, error) {
+	if rs == nil {
+		return nil, nil
+	}
+	prefix, err := t.Bindings.StringSub(ctx, rs.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	acc := *rs
+	acc.Prefix = prefix
+	return &acc, nil
+}
+
+func (rs *TopicRules) compile() error {
+	for _, r := range rs.Rewrites {
+		if err := r.compile(); err != nil {
+			return err
+		}
+	}
+	for _, r := range rs.Inbound {
+		if err := r.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outbound returns the topic as rewritten for a Pub or Sub.
+func (rs *TopicRules) outbound(topic string) string {
+	for _, r := range rs.Rewrites {
+		topic = r.rewrite(topic)
+	}
+	return rs.Prefix + topic
+}
+
+// inbound returns an inbound message's topic as rewritten for Recvs.
+func (rs *TopicRules) inbound(topic string) string {
+	topic = strings.TrimPrefix(topic, rs.Prefix)
+	for _, r := range rs.Inbound {
+		topic = r.rewrite(topic)
+	}
+	return topic
+}
+
+// addTopicRules prepares and registers the given channel's
+// TopicRules (if any).
+func (t *Test) addTopicRules(name string, rs *TopicRules) error {
+	if rs == nil {
+		return nil
+	}
+	if err := rs.compile(); err != nil {
+		return err
+	}
+	if t.topicRules == nil {
+		t.topicRules = make(map[string]*TopicRules)
+	}
+	t.topicRules[name] = rs
+	return nil
+}
+
+// outboundTopic returns the given Pub or Sub topic as rewritten by
+// the named channel's TopicRules (if any).
+func (t *Test) outboundTopic(ctx *Ctx, name, topic string) string {
+	rs, have := t.topicRules[name]
+	if !have {
+		return topic
+	}
+	rewritten := rs.outbound(topic)
+	if rewritten != topic {
+		ctx.Indf("    Channel %s topic '%s' rewritten as '%s'", name, topic, rewritten)
+	}
+	return rewritten
+}
+
+// inboundTopic rewrites the topic of a message that arrived on the
+// named channel according to the channel's TopicRules (if any).
+func (t *Test) inboundTopic(name string, m *Msg) {
+	if rs, have := t.topicRules[name]; have {
+		m.Topic = rs.inbound(m.Topic)
+	}
+}
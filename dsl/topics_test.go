@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTopicRules(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	rs := &TopicRules{
+		Prefix: "{?ns}/",
+		Rewrites: []*TopicRewrite{
+			{
+				Match:   `^device/([^/]+)/`,
+				Replace: "things/$1/",
+			},
+		},
+		Inbound: []*TopicRewrite{
+			{
+				Match:   `^things/`,
+				Replace: "device/",
+			},
+		},
+	}
+
+	tst := NewTest(ctx, "a", &Spec{})
+	tst.Bindings["?ns"] = "staging"
+	rs, err := rs.Substitute(ctx, tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tst.addTopicRules("c", rs); err != nil {
+		t.Fatal(err)
+	}
+
+	for topic, want := range map[string]string{
+		"device/d1/state": "staging/things/d1/state",
+		"device/+/state":  "staging/things/+/state",
+		"other":           "staging/other",
+	} {
+		if got := tst.outboundTopic(ctx, "c", topic); got != want {
+			t.Fatalf("outbound %s: got %s; wanted %s", topic, got, want)
+		}
+	}
+
+	// Unruled channels keep their topics.
+	if got := tst.outboundTopic(ctx, "d", "device/d1/state"); got != "device/d1/state" {
+		t.Fatal(got)
+	}
+
+	for topic, want := range map[string]string{
+		"staging/things/d1/state": "device/d1/state",
+		"staging/other":           "other",
+		"elsewhere/things/x":      "elsewhere/things/x",
+	} {
+		m := Msg{Topic: topic}
+		tst.inboundTopic("c", &m)
+		if m.Topic != want {
+			t.Fatalf("inbound %s: got %s; wanted %s", topic, m.Topic, want)
+		}
+	}
+
+	t.Run("bad", func(t *testing.T) {
+		err := tst.addTopicRules("e", &TopicRules{
+			Rewrites: []*TopicRewrite{
+				{
+					Match: "(",
+				},
+			},
+		})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, is := IsBroken(err); !is {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tracer writes a structured trace of step executions as JSON Lines:
+// one TraceEvent per line.  A Tracer is safe for concurrent use (by
+// test Instances, for example).
+//
+// Secrets are redacted.
+type Tracer struct {
+	sync.Mutex
+
+	// Next, when not nil, also gets every event.
+	Next *Tracer
+
+	w io.Writer
+}
+
+// NewTracer makes a Tracer that writes to the given Writer.
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{
+		w: w,
+	}
+}
+
+// Trace writes the event.  A nil Tracer does nothing.
+func (tr *Tracer) Trace(ctx *Ctx, e *TraceEvent) error {
+	if tr == nil {
+		return nil
+	}
+	js, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line := ctx.Redactor.Redact(string(js))
+
+	tr.Lock()
+	_, err = fmt.Fprintf(tr.w, "%s\n", line)
+	tr.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return tr.Next.Trace(ctx, e)
+}
+
+// Trace event outcomes.
+const (
+	TraceOK      = "ok"
+	TraceFailed  = "failed"
+	TraceSkipped = "skipped"
+)
+
+// TraceEvent describes one execution of a step.
+type TraceEvent struct {
+	// Time is when the step started.
+	Time time.Time `json:"time"`
+
+	// Elapsed is the step's duration in nanoseconds.
+	Elapsed time.Duration `json:"elapsed"`
+
+	Test  string `json:"test"`
+	Phase string `json:"phase"`
+	Step  int    `json:"step"`
+
+	// Type is the step's operation (like "pub" or "recv").
+	Type string `json:"type"`
+
+	Chan  string `json:"chan,omitempty"`
+	Topic string `json:"topic,omitempty"`
+
+	// Payload is a Pub's payload after substitution.
+	Payload interface{} `json:"payload,omitempty"`
+
+	// Pattern is a Recv's pattern (or a RecvSeq's patterns)
+	// after substitution.
+	Pattern interface{} `json:"pattern,omitempty"`
+
+	// Matched are the messages that a Recv (or RecvSeq)
+	// matched.
+	Matched []Msg `json:"matched,omitempty"`
+
+	// Bindings are the changes that the step made to the test's
+	// bindings.
+	Bindings *BindingsDelta `json:"bindings,omitempty"`
+
+	// Next is the next phase (from a Goto or Branch) if any.
+	Next string `json:"next,omitempty"`
+
+	// Outcome is TraceOK, TraceFailed, or TraceSkipped.
+	Outcome string `json:"outcome"`
+
+	// Error and its Category describe a failure.
+	Error    string   `json:"error,omitempty"`
+	Category Category `json:"category,omitempty"`
+
+	// before are the bindings before the step.
+	before Bindings
+}
+
+// BindingsDelta is the difference between two sets of bindings.
+type BindingsDelta struct {
+	// Set are the new and changed bindings.
+	Set map[string]interface{} `json:"set,omitempty"`
+
+	// Unset are the names of the removed bindings.
+	Unset []string `json:"unset,omitempty"`
+}
+
+// DiffBindings returns the changes from the first bindings to the
+// second, which is nil if there aren't any.  Secret bindings (see
+// IsSecretBinding) are Redacted.
+func DiffBindings(before, after Bindings) *BindingsDelta {
+	d := &BindingsDelta{}
+	for k, v := range after {
+		if x, have := before[k]; have && reflect.DeepEqual(x, v) {
+			continue
+		}
+		if d.Set == nil {
+			d.Set = make(map[string]interface{})
+		}
+		if IsSecretBinding(k) {
+			v = Redacted
+		}
+		d.Set[k] = v
+	}
+	for k := range before {
+		if _, have := after[k]; !have {
+			d.Unset = append(d.Unset, k)
+		}
+	}
+	if d.Set == nil && d.Unset == nil {
+		return nil
+	}
+	sort.Strings(d.Unset)
+	return d
+}
+
+// op returns the name of the step's operation.
+func (s *Step) op() string {
+	switch {
+	case s.Pub != nil:
+		return "pub"
+	case s.Sub != nil:
+		return "sub"
+	case s.Recv != nil:
+		return "recv"
+	case s.RecvSeq != nil:
+		return "recvseq"
+	case s.Kill != nil:
+		return "kill"
+	case s.Reconnect != nil:
+		return "reconnect"
+	case s.Pause != nil:
+		return "pause"
+	case s.Resume != nil:
+		return "resume"
+	case s.Run != "":
+		return "run"
+	case s.Wait != "":
+		return "wait"
+	case s.Goto != "":
+		return "goto"
+	case s.Branch != "":
+		return "branch"
+	case s.Ingest != nil:
+		return "ingest"
+	case s.Inspect != nil:
+		return "inspect"
+	case s.Set != nil:
+		return "set"
+	case s.WaitFor != nil:
+		return "waitfor"
+	case s.RunTest != nil:
+		return "runtest"
+	case s.MakeChan != nil:
+		return "makechan"
+	case s.Health != nil:
+		return "health"
+	case s.Export != nil:
+		return "export"
+	case s.Doc != "":
+		return "doc"
+	}
+	return ""
+}
+
+// startTrace begins the TraceEvent (if the Ctx has a Tracer) for
+// step i.
+func (t *Test) startTrace(ctx *Ctx, i int, s *Step) {
+	t.tracing = nil
+	if ctx.Tracer == nil {
+		return
+	}
+	var c string
+	if cs := s.chans(); 0 < len(cs) {
+		c = cs[0]
+	}
+	t.tracing = &TraceEvent{
+		Time:   time.Now().UTC(),
+		Test:   t.Id,
+		Phase:  t.phase,
+		Step:   i,
+		Type:   s.op(),
+		Chan:   c,
+		before: CopyBindings(t.Bindings),
+	}
+}
+
+// finishTrace completes and writes the current TraceEvent (if any).
+func (t *Test) finishTrace(ctx *Ctx, outcome, next string, err error) {
+	e := t.tracing
+	if e == nil {
+		return
+	}
+	t.tracing = nil
+
+	e.Elapsed = time.Now().Sub(e.Time)
+	e.Outcome = outcome
+	e.Next = next
+	e.Bindings = DiffBindings(e.before, t.Bindings)
+	if err != nil {
+		e.Outcome = TraceFailed
+		e.Error = err.Error()
+		e.Category = CategoryOf(err)
+	}
+
+	if err := ctx.Tracer.Trace(ctx, e); err != nil {
+		ctx.Warnf("Trace error: %s", err)
+	}
+}
+
+// traceOp notes the step's channel, topic, and payload or pattern
+// (after substitution) in the current TraceEvent (if any).
+func (t *Test) traceOp(c Chan, topic string, payload, pattern interface{}) {
+	e := t.tracing
+	if e == nil {
+		return
+	}
+	if name := t.chanName(c); name != "" {
+		e.Chan = name
+	}
+	e.Topic = topic
+	e.Payload = payload
+	e.Pattern = pattern
+}
+
+// traceMatched notes a matched message in the current TraceEvent
+// (if any).
+func (t *Test) traceMatched(m Msg) {
+	if e := t.tracing; e != nil {
+		e.Matched = append(e.Matched, m)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	var buf, next bytes.Buffer
+	ctx.Tracer = NewTracer(&buf)
+	ctx.Tracer.Next = NewTracer(&next)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+	p.AddStep(ctx, &Step{
+		Pub: &Pub{
+			Topic:   "orders",
+			Payload: dejson(`{"want":"?dish"}`),
+		},
+	})
+	p.AddStep(ctx, &Step{
+		Recv: &Recv{
+			Pattern: dejson(`{"want":"?want"}`),
+		},
+	})
+	p.AddStep(ctx, &Step{
+		Skip: &Skip{Reason: "not today"},
+		Run:  `throw "should have been skipped"`,
+	})
+	p.AddStep(ctx, &Step{
+		Recv: &Recv{
+			Pattern: dejson(`{"want":"?want"}`),
+			Timeout: 10 * time.Millisecond,
+		},
+	})
+
+	tst.Bindings["?dish"] = "tacos"
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if errs := tst.Run(ctx); errs == nil {
+		t.Fatal("should have failed")
+	}
+
+	if buf.String() != next.String() {
+		t.Fatalf("next tracer got %s", next.String())
+	}
+
+	var (
+		es []*TraceEvent
+		in = bufio.NewScanner(&buf)
+	)
+	for in.Scan() {
+		var e TraceEvent
+		if err := json.Unmarshal(in.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		es = append(es, &e)
+	}
+	if len(es) != 6 {
+		t.Fatalf("%d events: %s", len(es), JSON(es))
+	}
+
+	pub := es[2]
+	if pub.Type != "pub" || pub.Chan != "mock1" || pub.Topic != "orders" || pub.Outcome != TraceOK {
+		t.Fatal(JSON(pub))
+	}
+	if pub.Payload != `{"want":"tacos"}` {
+		t.Fatal(JSON(pub.Payload))
+	}
+
+	recv := es[3]
+	if recv.Type != "recv" || len(recv.Matched) != 1 || recv.Bindings == nil || recv.Bindings.Set["?want"] != "tacos" {
+		t.Fatal(JSON(recv))
+	}
+
+	if skipped := es[4]; skipped.Type != "run" || skipped.Outcome != TraceSkipped {
+		t.Fatal(JSON(skipped))
+	}
+
+	failed := es[5]
+	if failed.Outcome != TraceFailed || failed.Category != CategoryTimeout || failed.Error == "" {
+		t.Fatal(JSON(failed))
+	}
+}
+
+func TestDiffBindings(t *testing.T) {
+	if d := DiffBindings(Bindings{"?x": 1}, Bindings{"?x": 1}); d != nil {
+		t.Fatal(JSON(d))
+	}
+	d := DiffBindings(
+		Bindings{"?x": 1, "?y": 2, "?z": 3},
+		Bindings{"?x": 1, "?y": 3, "?secret_token": "shh", "?w": []interface{}{1}},
+	)
+	if len(d.Set) != 3 || d.Set["?y"] != 3 || d.Set["?secret_token"] != Redacted {
+		t.Fatal(JSON(d))
+	}
+	if len(d.Unset) != 1 || d.Unset[0] != "?z" {
+		t.Fatal(JSON(d))
+	}
+}
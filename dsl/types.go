@@ -0,0 +1,258 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// typeAliases maps alternate type names to ParamTypes.
+var typeAliases = map[string]string{
+	"int":  "integer",
+	"bool": "boolean",
+}
+
+// canonicalType returns the ParamType for the given type name, which
+// might be an alias (like "int").
+func canonicalType(typ string) string {
+	if t, have := typeAliases[typ]; have {
+		return t
+	}
+	return typ
+}
+
+// validType reports whether the given type name is a ParamType or
+// an alias for one.
+func validType(typ string) bool {
+	typ = canonicalType(typ)
+	for _, t := range ParamTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// coerce returns the given value as a value of the given type (see
+// ParamTypes).  A string can represent a number, integer, boolean,
+// object, or array (as JSON).  The result is false if the value
+// doesn't have and can't be converted to the type.
+func coerce(typ string, x interface{}) (interface{}, bool) {
+	switch canonicalType(typ) {
+	case "":
+		return x, true
+	case "string":
+		_, is := x.(string)
+		return x, is
+	case "number":
+		switch vv := x.(type) {
+		case float64, float32, int, int64, int32:
+			return x, true
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(vv), 64); err == nil {
+				return f, true
+			}
+		}
+	case "integer":
+		switch vv := x.(type) {
+		case int, int64, int32:
+			return x, true
+		case float64:
+			return x, vv == math.Trunc(vv)
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(vv), 10, 64); err == nil {
+				return float64(n), true
+			}
+		}
+	case "boolean":
+		switch vv := x.(type) {
+		case bool:
+			return x, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(vv)); err == nil {
+				return b, true
+			}
+		}
+	case "object":
+		x = maybeJSON(x)
+		_, is := x.(map[string]interface{})
+		return x, is
+	case "array":
+		x = maybeJSON(x)
+		_, is := x.([]interface{})
+		return x, is
+	case "duration":
+		if s, is := x.(string); is {
+			_, err := time.ParseDuration(s)
+			return x, err == nil
+		}
+	}
+	return x, false
+}
+
+// maybeJSON parses the given value if it's a string that's JSON.
+func maybeJSON(x interface{}) interface{} {
+	if s, is := x.(string); is {
+		var y interface{}
+		if err := json.Unmarshal([]byte(s), &y); err == nil {
+			return y
+		}
+	}
+	return x
+}
+
+// TypedSub substitutes bindings in the given string for a context
+// (described by 'what') that needs a value of the given type (see
+// ParamTypes).
+//
+// If the string is just the name of a bound variable (like
+// "?timeout"), the result is that variable's value.  The result is
+// coerced to the type (so "42" can be an integer), and a result that
+// can't be coerced is a Broken error that names the bindings
+// involved.
+func (bs *Bindings) TypedSub(ctx *Ctx, what, typ, s string) (interface{}, error) {
+	var x interface{}
+	if v, have := (*bs)[s]; have && strings.HasPrefix(s, "?") {
+		x = v
+	} else {
+		sub, err := bs.StringSub(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		x = sub
+	}
+	y, ok := coerce(typ, x)
+	if !ok {
+		var using string
+		if names := bs.usedIn(s); 0 < len(names) {
+			using = fmt.Sprintf(" (using %s)", strings.Join(names, ", "))
+		}
+		return nil, Brokenf("%s should have type %s, but '%s'%s is %s",
+			what, canonicalType(typ), s, using, JSON(x))
+	}
+	return y, nil
+}
+
+// DurationSub is TypedSub for a duration (in Go syntax).
+func (bs *Bindings) DurationSub(ctx *Ctx, what, s string) (time.Duration, error) {
+	x, err := bs.TypedSub(ctx, what, "duration", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(x.(string))
+}
+
+// deferDurations returns the mapping node without the values of the
+// given duration fields that aren't durations yet (like "?delay" or
+// "{D}ms").  Those values go to the given strings so that Substitute
+// can give them to DurationSub.
+func deferDurations(n *yaml.Node, fields map[string]*string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return n
+	}
+	m := *n
+	m.Content = make([]*yaml.Node, 0, len(n.Content))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if dst, have := fields[k.Value]; have && v.Kind == yaml.ScalarNode && v.Tag == "!!str" {
+			if _, err := time.ParseDuration(v.Value); err != nil {
+				*dst = v.Value
+				continue
+			}
+		}
+		m.Content = append(m.Content, k, v)
+	}
+	return &m
+}
+
+// durationSub returns the given duration or, if s isn't empty, the
+// result of DurationSub on s.
+func (bs *Bindings) durationSub(ctx *Ctx, what string, d time.Duration, s string) (time.Duration, error) {
+	if s == "" {
+		return d, nil
+	}
+	return bs.DurationSub(ctx, what, s)
+}
+
+// usedIn returns the sorted names of the bound variables that the
+// given string uses (either as '{NAME}' or as the entire string).
+func (bs *Bindings) usedIn(s string) []string {
+	var acc []string
+	for name := range *bs {
+		if s == name || strings.Contains(s, "{"+name+"}") {
+			acc = append(acc, name)
+		}
+	}
+	sort.Strings(acc)
+	return acc
+}
+
+// bindingTypes returns the Params' declared types by variable name.
+func (s *Spec) bindingTypes() map[string]string {
+	if s == nil {
+		return nil
+	}
+	acc := make(map[string]string, len(s.Params))
+	for name, p := range s.Params {
+		if p != nil && p.Type != "" {
+			acc[name] = p.Type
+		}
+	}
+	return acc
+}
+
+// checkTypes checks the test's bindings that have declared types.
+// A value that isn't of its declared type but can be coerced to that
+// type (like "42" for an integer) is replaced with the coerced
+// value.  A value that can't be coerced is a Broken error.
+func (t *Test) checkTypes(ctx *Ctx) error {
+	types := t.Spec.bindingTypes()
+	if len(types) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		x, have := t.Bindings[name]
+		if !have {
+			continue
+		}
+		typ := types[name]
+		y, ok := coerce(typ, x)
+		if !ok {
+			return Brokenf("binding %s should have type %s but is %s", name, canonicalType(typ), JSON(x))
+		}
+		if JSON(x) != JSON(y) {
+			ctx.Indf("    Coerced %s to type %s", name, canonicalType(typ))
+			t.Bindings[name] = y
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCoerce(t *testing.T) {
+	for _, c := range []struct {
+		typ  string
+		x    interface{}
+		want interface{}
+		ok   bool
+	}{
+		{"integer", 42.0, 42.0, true},
+		{"int", "42", 42.0, true},
+		{"integer", 4.2, nil, false},
+		{"integer", "tacos", nil, false},
+		{"number", " 4.2", 4.2, true},
+		{"bool", "true", true, true},
+		{"boolean", "yes", nil, false},
+		{"string", "tacos", "tacos", true},
+		{"string", 42.0, nil, false},
+		{"object", `{"a":1}`, map[string]interface{}{"a": 1.0}, true},
+		{"object", `[1]`, nil, false},
+		{"array", `[1]`, []interface{}{1.0}, true},
+		{"duration", "1m30s", "1m30s", true},
+		{"duration", "90", nil, false},
+		{"duration", 90.0, nil, false},
+		{"", 90.0, 90.0, true},
+	} {
+		got, ok := coerce(c.typ, c.x)
+		if ok != c.ok {
+			t.Fatalf("coerce(%s, %#v): got %v; wanted %v", c.typ, c.x, ok, c.ok)
+		}
+		if ok && JSON(got) != JSON(c.want) {
+			t.Fatalf("coerce(%s, %#v): got %s; wanted %s", c.typ, c.x, JSON(got), JSON(c.want))
+		}
+	}
+}
+
+func TestTypedSub(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	bs := Bindings{
+		"?timeout": "2s",
+		"?n":       "tacos",
+	}
+
+	for _, s := range []string{"?timeout", "{?timeout}", "1s"} {
+		d, err := bs.DurationSub(ctx, "Timeout", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != 2*time.Second && s != "1s" {
+			t.Fatal(d)
+		}
+	}
+
+	_, err := bs.TypedSub(ctx, "Count", "int", "{?n}")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, is := IsBroken(err); !is {
+		t.Fatal(err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "Count should have type integer") || !strings.Contains(msg, "using ?n") {
+		t.Fatal(msg)
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	newTest := func(steps ...*Step) *Test {
+		return NewTest(ctx, "a", &Spec{
+			Params: map[string]*Param{
+				"?n":     {Type: "int"},
+				"?delay": {Type: "duration"},
+			},
+			Phases: map[string]*Phase{
+				"phase1": {
+					Steps: steps,
+				},
+			},
+		})
+	}
+
+	t.Run("coerced", func(t *testing.T) {
+		tst := newTest(
+			&Step{Set: Set{"?n": "42", "?delay": "1ms"}},
+			&Step{Wait: "?delay"},
+		)
+		if err := tst.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := tst.Bindings["?n"]; n != 42.0 {
+			t.Fatalf("%#v", n)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		tst := newTest(
+			&Step{Set: Set{"?delay": "soon"}},
+		)
+		err := tst.Run(ctx)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if !strings.Contains(err.Error(), "?delay should have type duration") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		tst := newTest(&Step{Doc: "nothing"})
+		tst.Spec.Params["?x"] = &Param{Type: "date"}
+		if errs := tst.Validate(ctx); len(errs) == 0 {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestBoundDurations(t *testing.T) {
+	ctx := NewCtx(context.Background())
+
+	var steps []*Step
+	err := yaml.Unmarshal([]byte(`
+- recv:
+    chan: mock
+    pattern: "?x"
+    timeout: "?timeout"
+    window:
+      duration: "{?ms}ms"
+- recvseq:
+    chan: mock
+    patterns: ["?x"]
+    timeout: 1s
+- recv:
+    chan: mock
+    pattern: "?x"
+    timeout: "?n"
+`), &steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tst := NewTest(ctx, "a", nil)
+	tst.Bindings = Bindings{
+		"?timeout": "2s",
+		"?ms":      50,
+		"?n":       "tacos",
+	}
+
+	r, err := steps[0].Recv.Substitute(ctx, tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Timeout != 2*time.Second {
+		t.Fatal(r.Timeout)
+	}
+	if r.Window.Duration != 50*time.Millisecond {
+		t.Fatal(r.Window.Duration)
+	}
+
+	s, err := steps[1].RecvSeq.Substitute(ctx, tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Timeout != time.Second {
+		t.Fatal(s.Timeout)
+	}
+
+	_, err = steps[2].Recv.Substitute(ctx, tst)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "Recv Timeout should have type duration") {
+		t.Fatal(msg)
+	}
+}
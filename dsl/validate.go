@@ -0,0 +1,183 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// jsonSchema returns the (cached) JSON Schema for the given schema
+// specification, which is one of
+//
+//  1. The name of a schema in the Spec's Schemas.
+//  2. A URI (like "https://example.com/order.json").
+//  3. A filename, which is relative to the test's directory.
+//  4. A JSON string (which starts with "{").
+//  5. The schema itself (usually given in YAML).
+//
+// Relative references in a schema file are resolved against that
+// file's location.
+func (t *Test) jsonSchema(spec interface{}) (*gojsonschema.Schema, error) {
+	var (
+		key    string
+		loader gojsonschema.JSONLoader
+	)
+	switch vv := spec.(type) {
+	case string:
+		s := strings.TrimSpace(vv)
+		switch {
+		case t.Spec != nil && t.Spec.Schemas[s] != nil:
+			key = "schemas:" + s
+		case strings.HasPrefix(s, "{"):
+			key = "inline:" + s
+			loader = gojsonschema.NewStringLoader(s)
+		case strings.Contains(s, "://"):
+			key = s
+			loader = gojsonschema.NewReferenceLoader(s)
+		default:
+			filename, err := filepath.Abs(t.testFile(s))
+			if err != nil {
+				return nil, err
+			}
+			key = "file://" + filepath.ToSlash(filename)
+			loader = gojsonschema.NewReferenceLoader(key)
+		}
+	default:
+		key = "inline:" + JSON(vv)
+		loader = gojsonschema.NewGoLoader(Canon(vv))
+	}
+
+	if s, have := t.schemas[key]; have {
+		return s, nil
+	}
+
+	var (
+		s   *gojsonschema.Schema
+		err error
+	)
+	if loader == nil {
+		s, err = t.namedSchema(strings.TrimPrefix(key, "schemas:"))
+	} else {
+		s, err = gojsonschema.NewSchema(loader)
+	}
+	if err != nil {
+		return nil, Categorize(CategorySchema, Brokenf("JSON Schema %s: %s", short(key), err))
+	}
+	if t.schemas == nil {
+		t.schemas = make(map[string]*gojsonschema.Schema)
+	}
+	t.schemas[key] = s
+	return s, nil
+}
+
+// schemaURI returns the URI for the named schema in the Spec's
+// Schemas.
+//
+// These URIs are in the test's directory, so a relative "$ref" in a
+// named schema refers to another named schema or to a local file.
+func (t *Test) schemaURI(name string) (string, error) {
+	dir, err := filepath.Abs(t.Dir)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(dir) + "/" + name,
+	}
+	return u.String(), nil
+}
+
+// namedSchema compiles the named schema in the Spec's Schemas with
+// all of the named schemas available for "$ref" resolution.
+func (t *Test) namedSchema(name string) (*gojsonschema.Schema, error) {
+	sl := gojsonschema.NewSchemaLoader()
+
+	names := make([]string, 0, len(t.Spec.Schemas))
+	for n := range t.Spec.Schemas {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		var loader gojsonschema.JSONLoader
+		switch vv := t.Spec.Schemas[n].(type) {
+		case string:
+			if !strings.HasPrefix(strings.TrimSpace(vv), "{") {
+				return nil, fmt.Errorf("Schema '%s' isn't a JSON object", n)
+			}
+			loader = gojsonschema.NewStringLoader(vv)
+		default:
+			loader = gojsonschema.NewGoLoader(Canon(vv))
+		}
+		uri, err := t.schemaURI(n)
+		if err != nil {
+			return nil, err
+		}
+		if err := sl.AddSchema(uri, loader); err != nil {
+			return nil, fmt.Errorf("Schema '%s': %w", n, err)
+		}
+	}
+
+	uri, err := t.schemaURI(name)
+	if err != nil {
+		return nil, err
+	}
+	return sl.Compile(gojsonschema.NewReferenceLoader(uri))
+}
+
+// subSchema performs bindings substitution on a schema
+// specification that's a string (a URI or filename).
+func (t *Test) subSchema(ctx *Ctx, spec interface{}) (interface{}, error) {
+	if s, is := spec.(string); is {
+		return t.Bindings.StringSub(ctx, s)
+	}
+	return spec, nil
+}
+
+// validateSchema checks the given value against the JSON Schema
+// that the specification (see jsonSchema) gives.
+//
+// A value that doesn't validate results in a CategorySchema failure.
+func (t *Test) validateSchema(ctx *Ctx, spec interface{}, x interface{}) error {
+	s, err := t.jsonSchema(spec)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.Validate(gojsonschema.NewGoLoader(Canon(x)))
+	if err != nil {
+		return Categorize(CategorySchema, fmt.Errorf("JSON Schema validation: %w", err))
+	}
+	if result.Valid() {
+		ctx.Inddf("    Payload validated against JSON Schema")
+		return nil
+	}
+
+	problems := make([]string, 0, len(result.Errors()))
+	for _, e := range result.Errors() {
+		problems = append(problems, e.String())
+	}
+	return Categorize(CategorySchema, fmt.Errorf("payload doesn't validate against JSON Schema: %s",
+		strings.Join(problems, "; ")))
+}
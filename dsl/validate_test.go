@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	var (
+		ctx  = NewCtx(nil)
+		spec = NewSpec()
+		tst  = NewTest(ctx, "", spec)
+	)
+	tst.Dir = "../demos"
+
+	order := map[string]interface{}{"id": 1, "dish": "tacos", "price": 3.5}
+	bad := map[string]interface{}{"id": 1, "dish": "tacos", "price": -1}
+
+	inline := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"id"},
+	}
+
+	t.Run("inline", func(t *testing.T) {
+		if err := tst.validateSchema(ctx, inline, order); err != nil {
+			t.Fatal(err)
+		}
+		if err := tst.validateSchema(ctx, inline, map[string]interface{}{}); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		s := `{"type":"object","required":["dish"]}`
+		if err := tst.validateSchema(ctx, s, order); err != nil {
+			t.Fatal(err)
+		}
+		if err := tst.validateSchema(ctx, s, "tacos"); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		if err := tst.validateSchema(ctx, "schemas/order.json", order); err != nil {
+			t.Fatal(err)
+		}
+		// The price's schema is a $ref to a neighbouring file.
+		err := tst.validateSchema(ctx, "schemas/order.json", bad)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if c := CategoryOf(err); c != CategorySchema {
+			t.Fatal(c)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		err := tst.validateSchema(ctx, "schemas/nope.json", order)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		var broken *Broken
+		if !errors.As(err, &broken) {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		s1, err := tst.jsonSchema("schemas/order.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s2, err := tst.jsonSchema("schemas/order.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s1 != s2 {
+			t.Fatal("schema not cached")
+		}
+	})
+}
+
+func TestNamedSchemas(t *testing.T) {
+	var (
+		ctx  = NewCtx(nil)
+		spec = NewSpec()
+		tst  = NewTest(ctx, "", spec)
+	)
+	tst.Dir = "../demos"
+	spec.Schemas = map[string]interface{}{
+		"order": map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"id", "price"},
+			"properties": map[string]interface{}{
+				"price": map[string]interface{}{"$ref": "price"},
+				"dish":  map[string]interface{}{"$ref": "schemas/defs.json#/definitions/dish"},
+			},
+		},
+		"price": `{"type":"number","minimum":0}`,
+	}
+
+	if err := tst.validateSchema(ctx, "order", map[string]interface{}{"id": 1, "price": 3}); err != nil {
+		t.Fatal(err)
+	}
+	// Via the "price" schema.
+	if err := tst.validateSchema(ctx, "order", map[string]interface{}{"id": 1, "price": -3}); err == nil {
+		t.Fatal("expected an error")
+	}
+	// Via the local file.
+	if err := tst.validateSchema(ctx, "order", map[string]interface{}{"id": 1, "price": 3, "dish": 42}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := tst.validateSchema(ctx, "price", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tst.Validate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A schema that refers to an unknown schema doesn't validate.
+	tst = NewTest(ctx, "", spec)
+	spec.Schemas["bad"] = map[string]interface{}{"$ref": "nope"}
+	if err := tst.Validate(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+}
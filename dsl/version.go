@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// DefaultVersion is the version of the test format for a
+	// test that doesn't declare its Version.
+	DefaultVersion = 1
+
+	// CurrentVersion is the latest version of the test format.
+	CurrentVersion = 2
+)
+
+// Migration describes a construct that a version of the test format
+// no longer accepts.
+//
+// A test that declares an earlier version can still use the
+// construct, but loading the test warns about it.
+type Migration struct {
+	// Construct names the construct (e.g., "Sub.Pattern").
+	Construct string
+
+	// Version is the first version that refuses the construct.
+	Version int
+
+	// Advice says what to do instead.
+	Advice string
+
+	// uses reports whether the step uses the construct.
+	uses func(s *Step) bool
+}
+
+// Migrations are the constructs that later versions of the test
+// format refuse.
+var Migrations = []*Migration{
+	{
+		Construct: "Sub.Pattern",
+		Version:   2,
+		Advice:    "Sub.Pattern is deprecated; use Sub.Topic instead",
+		uses: func(s *Step) bool {
+			return s.Sub != nil && s.Sub.Pattern != ""
+		},
+	},
+	{
+		Construct: "Recv.Topic with Recv.Topics",
+		Version:   2,
+		Advice:    "Recv.Topic doesn't restrict the messages a Recv considers; use only Recv.Topics",
+		uses: func(s *Step) bool {
+			return s.Recv != nil && s.Recv.Topic != "" && 0 < len(s.Recv.Topics)
+		},
+	},
+}
+
+// version returns the test's declared Version, which defaults to
+// DefaultVersion.
+func (t *Test) version() int {
+	if t.Version == 0 {
+		return DefaultVersion
+	}
+	return t.Version
+}
+
+// CheckVersion validates the test's Spec against its declared
+// Version.
+//
+// A Version that this plax doesn't know is an error, and so is any
+// construct that's ambiguous in every version (like a Sub with both
+// a Topic and a Pattern).  A construct that the declared Version
+// refuses (see Migrations) is an error, and a construct that only a
+// later version refuses gets a warning.
+func (t *Test) CheckVersion(ctx *Ctx) error {
+	v := t.version()
+	if v < DefaultVersion || CurrentVersion < v {
+		return fmt.Errorf("unsupported version %d (this plax supports versions %d through %d)",
+			t.Version, DefaultVersion, CurrentVersion)
+	}
+	if t.Spec == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(t.Spec.Phases))
+	for name := range t.Spec.Phases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for i, s := range t.Spec.Phases[name].Steps {
+			if s.Sub != nil && s.Sub.Pattern != "" && s.Sub.Topic != "" {
+				return fmt.Errorf("step %d in phase '%s': just specify Sub.Topic (and not Sub.Pattern, which is deprecated)",
+					i, name)
+			}
+			for _, m := range Migrations {
+				if !m.uses(s) {
+					continue
+				}
+				if m.Version <= v {
+					return fmt.Errorf("step %d in phase '%s': version %d doesn't allow %s: %s",
+						i, name, v, m.Construct, m.Advice)
+				}
+				ctx.Warnf("warning: step %d in phase '%s': %s (version %d won't allow %s)",
+					i, name, m.Advice, m.Version, m.Construct)
+			}
+		}
+	}
+
+	return nil
+}
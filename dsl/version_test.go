@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckVersion(t *testing.T) {
+	check := func(src string) ([]string, error) {
+		var (
+			l   = &bufLogger{}
+			ctx = NewCtx(nil)
+			tst = NewTest(ctx, "", nil)
+		)
+		ctx.Logger = l
+		if err := yaml.Unmarshal([]byte(src), &tst); err != nil {
+			t.Fatal(err)
+		}
+		return l.acc, tst.CheckVersion(ctx)
+	}
+
+	const sub = `
+spec:
+  phases:
+    phase1:
+      steps:
+        - sub:
+            pattern: tacos
+`
+
+	t.Run("default", func(t *testing.T) {
+		warnings, err := check(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "Sub.Pattern") {
+			t.Fatal(warnings)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		_, err := check("version: 2\n" + sub)
+		if err == nil || !strings.Contains(err.Error(), "doesn't allow Sub.Pattern") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		_, err := check(sub + "            topic: queso\n")
+		if err == nil || !strings.Contains(err.Error(), "just specify Sub.Topic") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("topics", func(t *testing.T) {
+		_, err := check(`
+version: 2
+spec:
+  phases:
+    phase1:
+      steps:
+        - recv:
+            topic: a
+            topics: [a, b]
+`)
+		if err == nil || !strings.Contains(err.Error(), "Recv.Topics") {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		warnings, err := check("version: 2\nspec:\n  phases:\n    phase1:\n      steps:\n        - sub:\n            topic: tacos\n")
+		if err != nil || len(warnings) != 0 {
+			t.Fatal(warnings, err)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := check("version: 99\n"); err == nil {
+			t.Fatal("wanted an error")
+		}
+	})
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"time"
+)
+
+// WaitFor is a step that repeats an attempt until it succeeds or a
+// deadline passes.
+//
+// An attempt publishes the Pub (if any), receives a message that
+// matches the Recv (if any), and evaluates the Condition (if any).
+// The attempt succeeds if the Recv matched and the Condition
+// returned true.  A WaitFor needs a Recv or a Condition (or both).
+//
+// Only a Recv timeout or a false Condition leads to another attempt.
+// Any other error (like a broken Pub) ends the WaitFor.
+type WaitFor struct {
+	// Condition is optional Javascript (like a Branch) that
+	// returns true when the wait is over.
+	Condition string `json:",omitempty" yaml:",omitempty"`
+
+	// Pub is an optional message to publish at the start of each
+	// attempt (like a request for the current state).
+	Pub *Pub `json:",omitempty" yaml:",omitempty"`
+
+	// Recv is an optional Recv for each attempt.  Its Timeout,
+	// which defaults to the Interval, bounds the attempt.
+	Recv *Recv `json:",omitempty" yaml:",omitempty"`
+
+	// Interval is the time (in Go syntax) between attempts.  The
+	// default is 1s.
+	Interval string `json:",omitempty" yaml:",omitempty"`
+
+	// Timeout is the total time (in Go syntax) to try.  The
+	// default is 30s.
+	Timeout string `json:",omitempty" yaml:",omitempty"`
+}
+
+// duration parses a duration (after bindings substitution) with the
+// given default.
+func (w *WaitFor) duration(ctx *Ctx, t *Test, what, s, def string) (time.Duration, error) {
+	if s == "" {
+		s = def
+	}
+	d, err := t.Bindings.DurationSub(ctx, "WaitFor "+what, s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, Brokenf("WaitFor %s '%s' isn't positive", what, s)
+	}
+	return d, nil
+}
+
+func (w *WaitFor) Exec(ctx *Ctx, t *Test) error {
+	if w.Recv == nil && w.Condition == "" {
+		return Brokenf("WaitFor needs a Condition or a Recv")
+	}
+
+	interval, err := w.duration(ctx, t, "Interval", w.Interval, "1s")
+	if err != nil {
+		return err
+	}
+	timeout, err := w.duration(ctx, t, "Timeout", w.Timeout, "30s")
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		ctx.Indf("    WaitFor attempt %d", attempt)
+		ok, err := w.attempt(ctx, t, interval)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ctx.Indf("    WaitFor satisfied after %d attempts", attempt)
+			return nil
+		}
+		if deadline.Before(time.Now().Add(interval)) {
+			return Categorize(CategoryTimeout,
+				fmt.Errorf("WaitFor not satisfied after %d attempts in %s", attempt, timeout))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// attempt reports whether the attempt succeeded.
+func (w *WaitFor) attempt(ctx *Ctx, t *Test, interval time.Duration) (bool, error) {
+	if w.Pub != nil {
+		e, err := w.Pub.Substitute(ctx, t)
+		if err != nil {
+			return false, err
+		}
+		if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+			return false, err
+		}
+		t.traceOp(e.ch, e.Topic, e.Payload, nil)
+		if err := e.Exec(ctx, t); err != nil {
+			return false, err
+		}
+	}
+
+	if w.Recv != nil {
+		r := *w.Recv
+		if r.Timeout == 0 && r.timeout == "" {
+			r.Timeout = interval
+		}
+		e, err := r.Substitute(ctx, t)
+		if err != nil {
+			return false, err
+		}
+		if err := t.ensureChan(ctx, e.Chan, &e.ch); err != nil {
+			return false, err
+		}
+		t.traceOp(e.ch, e.Topic, nil, e.Pattern)
+		if err := e.Exec(ctx, t); err != nil {
+			if CategoryOf(err) == CategoryTimeout {
+				return false, nil
+			}
+			return false, err
+		}
+		t.assertion(e.ch)
+	}
+
+	if w.Condition != "" {
+		src, err := t.Bindings.StringSub(ctx, w.Condition)
+		if err != nil {
+			return false, err
+		}
+		if src, err = t.prepareSource(ctx, src); err != nil {
+			return false, err
+		}
+		x, err := t.JSExec(ctx, src, t.jsEnv(ctx))
+		if err != nil {
+			return false, err
+		}
+		b, is := x.(bool)
+		if !is {
+			return false, Brokenf("WaitFor Condition returned a %T (%#v) and not a %T", x, x, b)
+		}
+		ctx.Indf("    WaitFor Condition returned %v", b)
+		return b, nil
+	}
+
+	return true, nil
+}
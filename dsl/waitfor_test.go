@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package dsl
+
+import (
+	"testing"
+)
+
+func TestWaitForCondition(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	p.AddStep(ctx, &Step{
+		WaitFor: &WaitFor{
+			Condition: `
+var n = (test.Bindings["?n"] || 0) + 1;
+test.Bindings["?n"] = n;
+return 3 <= n;
+`,
+			Interval: "10ms",
+			Timeout:  "5s",
+		},
+	})
+
+	run(t, ctx, tst)
+
+	if JSON(tst.Bindings["?n"]) != "3" {
+		t.Fatal(tst.Bindings["?n"])
+	}
+}
+
+func TestWaitForPubRecv(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+
+	// Each attempt publishes the current number, which the mock
+	// echoes, and the Condition increments the number.
+	tst.Bindings["?k"] = 1
+	p.AddStep(ctx, &Step{
+		WaitFor: &WaitFor{
+			Pub: &Pub{
+				Payload: dejson(`{"n":"?k"}`),
+			},
+			Recv: &Recv{
+				Pattern: dejson(`{"n":"?*n"}`),
+			},
+			Condition: `
+test.Bindings["?k"] = bs["?k"] + 1;
+return 3 <= bs["?*n"];
+`,
+			Interval: "10ms",
+		},
+	})
+
+	run(t, ctx, tst)
+
+	if JSON(tst.Bindings["?k"]) != "4" {
+		t.Fatal(tst.Bindings["?k"])
+	}
+	if tst.Assertions != 3 {
+		t.Fatal(tst.Assertions)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+	p.AddStep(ctx, &Step{
+		WaitFor: &WaitFor{
+			Recv: &Recv{
+				Pattern: dejson(`{"never":true}`),
+			},
+			Interval: "10ms",
+			Timeout:  "50ms",
+		},
+	})
+
+	if err := tst.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err := tst.Run(ctx)
+	if err == nil {
+		t.Fatal("should have timed out")
+	}
+	if c := CategoryOf(err); c != CategoryTimeout {
+		t.Fatal(c, err)
+	}
+}
+
+func TestWaitForBroken(t *testing.T) {
+	for _, w := range []*WaitFor{
+		{},
+		{Condition: "return true", Interval: "soon"},
+		{Condition: "return true", Timeout: "-1s"},
+		{Condition: "return 42"},
+	} {
+		ctx, s, tst := newTest(t)
+		p := &Phase{}
+		s.Phases["phase1"] = p
+		p.AddStep(ctx, &Step{
+			WaitFor: w,
+		})
+		if err := tst.Init(ctx); err != nil {
+			t.Fatal(err)
+		}
+		err := tst.Run(ctx)
+		if _, is := IsBroken(err); !is {
+			t.Fatal(w, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Comcast/sheens/match"
+	"gopkg.in/yaml.v3"
+)
+
+// Window makes a Recv collect all of the messages that arrive during
+// a fixed duration and then check the whole batch.  Such a Recv
+// can express invariants like "exactly three orders and no
+// cancellations within 5s".
+//
+// If the Recv has a Pattern, only messages that match it are in the
+// batch.  (A window doesn't bind any variables.)
+type Window struct {
+	// Duration is how long to collect messages.  Like a Recv's
+	// Timeout, it can use bindings.
+	Duration time.Duration
+
+	// Counts optionally gives requirements for the numbers of
+	// messages in the batch that match patterns.
+	Counts []*WindowCount `json:",omitempty" yaml:",omitempty"`
+
+	// Reduce is optional Javascript that should return a boolean
+	// to indicate whether the batch is acceptable.  The messages
+	// are bound to 'msgs'.  The code can also return a Failure.
+	Reduce string `json:",omitempty" yaml:",omitempty"`
+
+	// duration is a Duration that needs bindings substitution.
+	duration string
+}
+
+// UnmarshalYAML allows a Duration that uses bindings.
+func (w *Window) UnmarshalYAML(n *yaml.Node) error {
+	type window Window
+	return deferDurations(n, map[string]*string{"duration": &w.duration}).Decode((*window)(w))
+}
+
+// WindowCount is a requirement for the number of messages in a
+// Window's batch that match the Pattern.
+type WindowCount struct {
+	Pattern interface{}
+
+	// Count, if given, is the exact number of matching
+	// messages.  Zero means none.
+	Count *int `json:",omitempty" yaml:",omitempty"`
+
+	// Min is the minimum number of matching messages.
+	Min int `json:",omitempty" yaml:",omitempty"`
+
+	// Max, if given, is the maximum number of matching
+	// messages.
+	Max *int `json:",omitempty" yaml:",omitempty"`
+}
+
+func (w *Window) Substitute(ctx *Ctx, t *Test) (*Window, error) {
+	if w == nil {
+		return nil, nil
+	}
+
+	d, err := t.Bindings.durationSub(ctx, "Window Duration", w.Duration, w.duration)
+	if err != nil {
+		return nil, err
+	}
+	if d <= 0 {
+		return nil, Brokenf("Window needs a positive Duration")
+	}
+
+	counts := make([]*WindowCount, len(w.Counts))
+	for i, c := range w.Counts {
+		var pat interface{}
+		if err := t.Bindings.Sub(ctx, c.Pattern, &pat, true); err != nil {
+			return nil, err
+		}
+		counts[i] = &WindowCount{
+			Pattern: pat,
+			Count:   c.Count,
+			Min:     c.Min,
+			Max:     c.Max,
+		}
+	}
+
+	reduce, err := t.Bindings.StringSub(ctx, w.Reduce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Window{
+		Duration: d,
+		Counts:   counts,
+		Reduce:   reduce,
+	}, nil
+}
+
+// check returns an error if the number of targets that match the
+// pattern doesn't satisfy the requirements.
+func (c *WindowCount) check(targets []interface{}) error {
+	n := 0
+	for _, x := range targets {
+		bss, err := match.Match(c.Pattern, Canon(x), match.NewBindings())
+		if err != nil {
+			return err
+		}
+		if 0 < len(bss) {
+			n++
+		}
+	}
+
+	switch {
+	case c.Count != nil && n != *c.Count:
+		return fmt.Errorf("Window got %d messages matching %s (want %d)", n, JSON(c.Pattern), *c.Count)
+	case n < c.Min:
+		return fmt.Errorf("Window got %d messages matching %s (want at least %d)", n, JSON(c.Pattern), c.Min)
+	case c.Max != nil && *c.Max < n:
+		return fmt.Errorf("Window got %d messages matching %s (want at most %d)", n, JSON(c.Pattern), *c.Max)
+	}
+
+	return nil
+}
+
+// window collects messages for the Window's duration and then checks
+// the batch.
+func (r *Recv) window(ctx *Ctx, t *Test) error {
+	var (
+		w    = r.Window
+		in   = t.inbound(ctx, r.ch)
+		name = t.chanName(r.ch)
+		tm   = time.NewTimer(w.Duration)
+
+		msgs    = make([]Msg, 0, 16)
+		targets = make([]interface{}, 0, 16)
+	)
+	defer tm.Stop()
+
+	ctx.Indf("    Recv window %v", w.Duration)
+
+	// Count patterns get the same normalization as the messages.
+	counts := w.Counts
+	if r.canon != nil {
+		counts = make([]*WindowCount, len(w.Counts))
+		for i, c := range w.Counts {
+			pat, err := r.canon.Normalize(Canon(c.Pattern))
+			if err != nil {
+				return NewBroken(fmt.Errorf("Canon pattern: %w", err))
+			}
+			counts[i] = &WindowCount{
+				Pattern: pat,
+				Count:   c.Count,
+				Min:     c.Min,
+				Max:     c.Max,
+			}
+		}
+	}
+
+	// Messages that a previous Recv set aside are in the batch,
+	// too.
+	pending := t.unhold(name)
+
+	add := func(m Msg) error {
+		target, ok, err := r.decode(ctx, &m)
+		t.history.Add(name, m)
+		if !ok || err != nil {
+			return err
+		}
+		if r.Pattern != nil {
+			bss, err := match.Match(r.Pattern, Canon(target), match.NewBindings())
+			if err != nil {
+				return err
+			}
+			if len(bss) == 0 {
+				return nil
+			}
+		}
+		msgs = append(msgs, m)
+		targets = append(targets, target)
+		return nil
+	}
+
+	for _, m := range pending {
+		if err := add(m); err != nil {
+			return err
+		}
+	}
+
+COLLECT:
+	for {
+		select {
+		case <-ctx.Done():
+			ctx.Indf("    Recv canceled")
+			return nil
+		case <-tm.C:
+			break COLLECT
+		case m := <-in:
+			admit, err := t.admit(ctx, name, &m)
+			if err != nil {
+				return err
+			}
+			if !admit {
+				continue
+			}
+			if err := add(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx.Indf("    Recv window collected %d messages", len(msgs))
+
+	for _, c := range counts {
+		if err := c.check(targets); err != nil {
+			return err
+		}
+	}
+
+	if w.Reduce != "" {
+		src, err := t.prepareSource(ctx, w.Reduce)
+		if err != nil {
+			return err
+		}
+		env := t.jsEnv(ctx)
+		env["msgs"] = Canon(msgs)
+
+		x, err := t.JSExec(ctx, src, env)
+		if f, is := IsFailure(x); is {
+			return f
+		}
+		if f, is := IsFailure(err); is {
+			return f
+		}
+		if err != nil {
+			return err
+		}
+		switch vv := x.(type) {
+		case bool:
+			if !vv {
+				return fmt.Errorf("Window Reduce rejected %d messages", len(msgs))
+			}
+		default:
+			return Brokenf("Window Reduce Javascript returned a %T (%v) and not a bool", x, x)
+		}
+	}
+
+	ctx.Indf("    Recv window satisfied")
+
+	return nil
+}
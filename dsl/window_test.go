@@ -0,0 +1,116 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecvWindow(t *testing.T) {
+	ctx, s, tst := newTest(t)
+
+	p := &Phase{}
+	s.Phases["phase1"] = p
+	addMock(t, ctx, p)
+	run(t, ctx, tst)
+
+	exec := func(step *Step) error {
+		_, err := step.exec(ctx, tst)
+		return err
+	}
+
+	n := func(x int) *int {
+		return &x
+	}
+
+	window := func(w *Window, pattern interface{}, msgs ...string) error {
+		for _, x := range msgs {
+			if err := exec(&Step{Pub: &Pub{Payload: dejson(x)}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return exec(&Step{
+			Recv: &Recv{
+				Pattern: pattern,
+				Window:  w,
+			},
+		})
+	}
+
+	msgs := []string{
+		`{"type":"A","n":1}`,
+		`{"type":"A","n":2}`,
+		`{"type":"C","n":3}`,
+		`{"type":"A","n":4}`,
+	}
+
+	t.Run("counts", func(t *testing.T) {
+		err := window(&Window{
+			Duration: 50 * time.Millisecond,
+			Counts: []*WindowCount{
+				{Pattern: `{"type":"A"}`, Count: n(3)},
+				{Pattern: `{"type":"B"}`, Count: n(0)},
+				{Pattern: `{"type":"C"}`, Min: 1, Max: n(1)},
+			},
+			Reduce: `return msgs.length == 4;`,
+		}, nil, msgs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("pattern", func(t *testing.T) {
+		err := window(&Window{
+			Duration: 50 * time.Millisecond,
+			Reduce: `
+var sum = 0;
+for (var i = 0; i < msgs.length; i++) { sum += msgs[i].payload.n; }
+return sum == 7;`,
+		}, `{"type":"A"}`, msgs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	fails := func(w *Window) {
+		err := window(w, nil, msgs...)
+		if err == nil {
+			t.Fatalf("%s should have failed", JSON(w))
+		}
+		if _, broke := IsBroken(err); broke {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("failures", func(t *testing.T) {
+		d := 50 * time.Millisecond
+		fails(&Window{Duration: d, Counts: []*WindowCount{{Pattern: `{"type":"A"}`, Count: n(2)}}})
+		fails(&Window{Duration: d, Counts: []*WindowCount{{Pattern: `{"type":"A"}`, Min: 4}}})
+		fails(&Window{Duration: d, Counts: []*WindowCount{{Pattern: `{"type":"A"}`, Max: n(2)}}})
+		fails(&Window{Duration: d, Reduce: `return false;`})
+		fails(&Window{Duration: d, Reduce: `return Failure("nope");`})
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		err := exec(&Step{Recv: &Recv{Window: &Window{}}})
+		if _, broke := IsBroken(err); !broke {
+			t.Fatal(err)
+		}
+	})
+}
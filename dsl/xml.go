@@ -0,0 +1,209 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ParseXML parses an XML document into a structural form for
+// pattern matching.
+//
+// The root element becomes a map with one property (the element's
+// local name).  Within an element, an attribute becomes a property
+// named '@NAME', child elements become properties named by their
+// local names (with an array for repeated elements), and any
+// non-whitespace text becomes the property '#text'.  An element
+// with only text (and no attributes) is just that string.
+//
+// Example:
+//
+//	<order id="1"><item>taco</item><item>queso</item></order>
+//
+// becomes
+//
+//	{"order":{"@id":"1","item":["taco","queso"]}}
+func ParseXML(s string) (interface{}, error) {
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no XML element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, is := tok.(xml.StartElement); is {
+			x, err := parseXMLElement(d, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				start.Name.Local: x,
+			}, nil
+		}
+	}
+}
+
+func parseXMLElement(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	var (
+		acc  = make(map[string]interface{})
+		text strings.Builder
+	)
+
+	for _, a := range start.Attr {
+		name := a.Name.Local
+		if a.Name.Space == "xmlns" {
+			name = "xmlns:" + name
+		}
+		acc["@"+name] = a.Value
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch vv := tok.(type) {
+		case xml.StartElement:
+			x, err := parseXMLElement(d, vv)
+			if err != nil {
+				return nil, err
+			}
+			name := vv.Name.Local
+			switch y := acc[name].(type) {
+			case nil:
+				acc[name] = x
+			case []interface{}:
+				acc[name] = append(y, x)
+			default:
+				acc[name] = []interface{}{y, x}
+			}
+		case xml.CharData:
+			text.Write(vv)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(acc) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				acc["#text"] = s
+			}
+			return acc, nil
+		}
+	}
+}
+
+// FormatXML serializes a structural form (see ParseXML) as XML.
+//
+// The given value should be a map with one property, which names
+// the root element.  Properties are written in sorted order, and
+// values other than strings, maps, and arrays are written as JSON.
+func FormatXML(x interface{}) (string, error) {
+	m, is := x.(map[string]interface{})
+	if !is || len(m) != 1 {
+		return "", fmt.Errorf("XML payload should be a map with one property (the root element), not %s", JSON(x))
+	}
+
+	var (
+		buf bytes.Buffer
+		e   = xml.NewEncoder(&buf)
+	)
+	for name, y := range m {
+		if err := formatXMLElement(e, name, y); err != nil {
+			return "", err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func formatXMLElement(e *xml.Encoder, name string, x interface{}) error {
+	if xs, is := x.([]interface{}); is {
+		for _, y := range xs {
+			if err := formatXMLElement(e, name, y); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{
+		Name: xml.Name{Local: name},
+	}
+
+	m, is := x.(map[string]interface{})
+	if !is {
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		if x != nil {
+			if err := e.EncodeToken(xml.CharData(xmlText(x))); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	}
+
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	for _, k := range ks {
+		if strings.HasPrefix(k, "@") {
+			start.Attr = append(start.Attr, xml.Attr{
+				Name:  xml.Name{Local: k[1:]},
+				Value: xmlText(m[k]),
+			})
+		}
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if text, have := m["#text"]; have {
+		if err := e.EncodeToken(xml.CharData(xmlText(text))); err != nil {
+			return err
+		}
+	}
+	for _, k := range ks {
+		if strings.HasPrefix(k, "@") || k == "#text" {
+			continue
+		}
+		if err := formatXMLElement(e, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// xmlText returns a string as is and anything else as JSON.
+func xmlText(x interface{}) string {
+	if s, is := x.(string); is {
+		return s
+	}
+	return JSON(x)
+}
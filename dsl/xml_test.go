@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package dsl
+
+import (
+	"testing"
+)
+
+func TestParseXML(t *testing.T) {
+	for _, c := range []struct {
+		xml  string
+		want string
+	}{
+		{`<a>hi</a>`, `{"a":"hi"}`},
+		{`<a/>`, `{"a":""}`},
+		{`<?xml version="1.0"?><a x="1">hi<b>2</b></a>`, `{"a":{"#text":"hi","@x":"1","b":"2"}}`},
+		{`<order id="1"><item>taco</item><item>queso</item><item>chips</item></order>`,
+			`{"order":{"@id":"1","item":["taco","queso","chips"]}}`},
+		{`<s:E xmlns:s="urn:s"><s:B/></s:E>`, `{"E":{"@xmlns:s":"urn:s","B":""}}`},
+	} {
+		x, err := ParseXML(c.xml)
+		if err != nil {
+			t.Fatalf("%s: %s", c.xml, err)
+		}
+		if js := JSON(x); js != c.want {
+			t.Fatalf("%s: %s", c.xml, js)
+		}
+	}
+
+	for _, s := range []string{``, `<a>`, `nope`} {
+		if _, err := ParseXML(s); err == nil {
+			t.Fatalf("%s: should have complained", s)
+		}
+	}
+}
+
+func TestFormatXML(t *testing.T) {
+	x := dejson(`{"order":{"@id":"1","item":["taco","queso"],"n":2,"note":{"#text":"hot","@lang":"en"}}}`)
+	s, err := FormatXML(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<order id="1"><item>taco</item><item>queso</item><n>2</n><note lang="en">hot</note></order>`
+	if s != want {
+		t.Fatal(s)
+	}
+
+	// Round trip (modulo the number).
+	y, err := ParseXML(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if js := JSON(y); js != `{"order":{"@id":"1","item":["taco","queso"],"n":"2","note":{"#text":"hot","@lang":"en"}}}` {
+		t.Fatal(js)
+	}
+
+	if _, err = FormatXML(dejson(`{"a":1,"b":2}`)); err == nil {
+		t.Fatal("should have complained")
+	}
+}
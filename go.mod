@@ -10,6 +10,12 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dop251/goja v0.0.0-20210114204047-983fa61a23a8
 	github.com/eclipse/paho.mqtt.golang v1.3.1
+	github.com/golang/snappy v0.0.1
 	github.com/harlow/kinesis-consumer v0.3.4
+	github.com/jmespath/go-jmespath v0.4.0
+	github.com/linkedin/goavro/v2 v2.10.0
+	github.com/xeipuuv/gojsonschema v1.2.0
+	golang.org/x/net v0.0.0-20201224014010-6772e930b67b
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,304 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A bundle is a gzipped tar archive of a suite (its specs, includes,
+// fixtures, and Javascript libraries) that can run without a source
+// checkout.
+//
+// The archive has a BundleManifestName entry, the suite's directory
+// under BundleSuiteDir, and each include directory under
+// BundleIncludeDir/N.  A bundle can also be appended to a copy of the
+// plax executable (see EmbedBundle), which can then run the suite
+// by itself.
+
+const (
+	// BundleManifestName is the name of the manifest in a bundle.
+	BundleManifestName = "manifest.json"
+
+	// BundleSuiteDir is the directory in a bundle for the
+	// suite's files.
+	BundleSuiteDir = "suite"
+
+	// BundleIncludeDir is the directory in a bundle for include
+	// directories.
+	BundleIncludeDir = "include"
+
+	// bundleMagic ends an executable with an embedded bundle.
+	bundleMagic = "PLAXBNDL"
+)
+
+// BundleManifest describes a bundle.
+type BundleManifest struct {
+	// Plax is the version of plax that made the bundle.
+	Plax string `json:"plax"`
+
+	// Created is when the bundle was made.
+	Created time.Time `json:"created"`
+
+	// Test, when not empty, is the spec (relative to
+	// BundleSuiteDir) to run.  Otherwise every spec in
+	// BundleSuiteDir runs.
+	Test string `json:"test,omitempty"`
+
+	// IncludeDirs are the bundle's include directories (relative
+	// to the bundle's root).
+	IncludeDirs []string `json:"includeDirs,omitempty"`
+
+	// Files is the number of files in the bundle.
+	Files int `json:"files"`
+}
+
+// Bundle says what goes into a bundle.
+type Bundle struct {
+	// Dir is the suite's directory.
+	Dir string
+
+	// Test, when not empty, is the one spec (relative to Dir) to
+	// run.
+	Test string
+
+	// IncludeDirs are the directories for YAML includes (and
+	// other files) outside of Dir.
+	IncludeDirs []string
+
+	// Version is the plax version for the manifest.
+	Version string
+}
+
+// Write writes the bundle as a gzipped tar archive.
+//
+// Hidden files and directories (like .git) are omitted.
+func (b *Bundle) Write(w io.Writer) (*BundleManifest, error) {
+	var (
+		zw = gzip.NewWriter(w)
+		tw = tar.NewWriter(zw)
+		m  = &BundleManifest{
+			Plax:    b.Version,
+			Created: time.Now().UTC(),
+			Test:    filepath.ToSlash(b.Test),
+		}
+	)
+
+	if err := addBundleDir(tw, b.Dir, BundleSuiteDir, m); err != nil {
+		return nil, err
+	}
+	for i, dir := range b.IncludeDirs {
+		name := path.Join(BundleIncludeDir, fmt.Sprintf("%d", i))
+		if err := addBundleDir(tw, dir, name, m); err != nil {
+			return nil, err
+		}
+		m.IncludeDirs = append(m.IncludeDirs, name)
+	}
+
+	js, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := addBundleFile(tw, BundleManifestName, js); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func addBundleDir(tw *tar.Writer, dir, prefix string, m *BundleManifest) error {
+	return filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		if rel != "." && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		bs, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		m.Files++
+		return addBundleFile(tw, path.Join(prefix, filepath.ToSlash(rel)), bs)
+	})
+}
+
+func addBundleFile(tw *tar.Writer, name string, bs []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(bs)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(bs)
+	return err
+}
+
+// ExtractBundle extracts a bundle into the given directory and
+// returns its manifest.
+func ExtractBundle(r io.Reader, dir string) (*BundleManifest, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a bundle: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	var m *BundleManifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("bundle has bad filename '%s'", hdr.Name)
+		}
+		bs, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if name == BundleManifestName {
+			m = &BundleManifest{}
+			if err := json.Unmarshal(bs, m); err != nil {
+				return nil, fmt.Errorf("bad bundle manifest: %w", err)
+			}
+			continue
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filename, bs, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("bundle has no %s", BundleManifestName)
+	}
+	return m, nil
+}
+
+// Invocation returns an Invocation (based on the given one) that
+// runs an extracted bundle in the given directory.
+func (m *BundleManifest) Invocation(dir string, inv Invocation) *Invocation {
+	suite := filepath.Join(dir, BundleSuiteDir)
+	if m.Test != "" {
+		inv.Filename = filepath.Join(suite, filepath.FromSlash(m.Test))
+		inv.Dir = ""
+	} else {
+		inv.Dir = suite
+	}
+	for _, d := range m.IncludeDirs {
+		inv.IncludeDirs = append(inv.IncludeDirs, filepath.Join(dir, filepath.FromSlash(d)))
+	}
+	return &inv
+}
+
+// EmbedBundle writes a copy of the executable followed by the bundle
+// and a trailer so that EmbeddedBundle can find the bundle.
+func EmbedBundle(w io.Writer, exe string, bundle []byte) error {
+	bs, err := ioutil.ReadFile(exe)
+	if err != nil {
+		return err
+	}
+	if b, _ := embeddedBundle(bs); b != nil {
+		// Don't embed a bundle in a bundle.
+		bs = bs[:len(bs)-len(b)-8-len(bundleMagic)]
+	}
+	if _, err = w.Write(bs); err != nil {
+		return err
+	}
+	if _, err = w.Write(bundle); err != nil {
+		return err
+	}
+	n := make([]byte, 8)
+	binary.BigEndian.PutUint64(n, uint64(len(bundle)))
+	if _, err = w.Write(n); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(bundleMagic))
+	return err
+}
+
+// EmbeddedBundle returns the bundle embedded in the given executable
+// (or nil if there isn't one).
+func EmbeddedBundle(exe string) (io.Reader, error) {
+	bs, err := ioutil.ReadFile(exe)
+	if err != nil {
+		return nil, err
+	}
+	b, err := embeddedBundle(bs)
+	if b == nil || err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+func embeddedBundle(bs []byte) ([]byte, error) {
+	if !bytes.HasSuffix(bs, []byte(bundleMagic)) {
+		return nil, nil
+	}
+	end := len(bs) - len(bundleMagic)
+	if end < 8 {
+		return nil, fmt.Errorf("truncated bundle trailer")
+	}
+	n := binary.BigEndian.Uint64(bs[end-8 : end])
+	if uint64(end-8) < n {
+		return nil, fmt.Errorf("bad bundle length %d", n)
+	}
+	return bs[end-8-int(n) : end-8], nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Bundle{
+		Dir:     "../demos",
+		Test:    "mock.yaml",
+		Version: "test",
+	}
+	var buf bytes.Buffer
+	m, err := b.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Files == 0 {
+		t.Fatal(m.Files)
+	}
+
+	got, err := ExtractBundle(bytes.NewReader(buf.Bytes()), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Test != "mock.yaml" || got.Files != m.Files || got.Plax != "test" {
+		t.Fatal(got)
+	}
+
+	inv := got.Invocation(dir, Invocation{
+		SuiteName: "test:bundle",
+	})
+	if inv.Filename != filepath.Join(dir, BundleSuiteDir, "mock.yaml") {
+		t.Fatal(inv.Filename)
+	}
+	if err = inv.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBundleEmbed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "exe")
+	if err = ioutil.WriteFile(exe, []byte("not really an executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := EmbeddedBundle(exe); r != nil || err != nil {
+		t.Fatal(r, err)
+	}
+
+	for _, bundle := range []string{"first", "second"} {
+		var buf bytes.Buffer
+		if err = EmbedBundle(&buf, exe, []byte(bundle)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(exe, buf.Bytes(), 0755); err != nil {
+			t.Fatal(err)
+		}
+		r, err := EmbeddedBundle(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := ioutil.ReadAll(r)
+		if string(got) != bundle {
+			t.Fatal(string(got))
+		}
+	}
+
+	bs, _ := ioutil.ReadFile(exe)
+	if !bytes.HasPrefix(bs, []byte("not really an executable")) {
+		t.Fatal(string(bs))
+	}
+}
+
+func TestBundleBad(t *testing.T) {
+	if _, err := ExtractBundle(bytes.NewReader([]byte("tacos")), "."); err == nil {
+		t.Fatal("expected protest")
+	}
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+// CloudEvents types for test lifecycle events.  See Emitter.
+const (
+	EventSuiteStarted  = "com.github.comcast.plax.suite.started"
+	EventSuiteFinished = "com.github.comcast.plax.suite.finished"
+	EventTestStarted   = "com.github.comcast.plax.test.started"
+	EventTestFinished  = "com.github.comcast.plax.test.finished"
+
+	// DefaultEventSource is the default CloudEvents source.
+	DefaultEventSource = "plax"
+)
+
+// Event is a CloudEvent (https://cloudevents.io/) in its JSON
+// representation (version 1.0).
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	Id              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Time            time.Time   `json:"time"`
+	Subject         string      `json:"subject,omitempty"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// SuiteEventData is the data for EventSuiteStarted and
+// EventSuiteFinished.  The counts are zero for EventSuiteStarted.
+type SuiteEventData struct {
+	Suite   string `json:"suite"`
+	Tests   int    `json:"tests"`
+	Passed  int    `json:"passed"`
+	Failed  int    `json:"failed"`
+	Errors  int    `json:"errors"`
+	Skipped int    `json:"skipped"`
+}
+
+// TestEventData is the data for EventTestStarted and
+// EventTestFinished.  Result, Message, and Duration are empty for
+// EventTestStarted.
+type TestEventData struct {
+	Suite    string   `json:"suite"`
+	Test     string   `json:"test"`
+	Name     string   `json:"name,omitempty"`
+	Filename string   `json:"filename"`
+	Labels   []string `json:"labels,omitempty"`
+	Owners   []string `json:"owners,omitempty"`
+	Tickets  []string `json:"tickets,omitempty"`
+	Priority int      `json:"priority"`
+	Result   string   `json:"result,omitempty"`
+	Message  string   `json:"message,omitempty"`
+
+	// Duration is in seconds.
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// EventSink sends CloudEvents somewhere.
+type EventSink interface {
+	Send(e *Event) error
+	Close() error
+}
+
+// EventSinkMaker makes an EventSink for a URL.
+type EventSinkMaker func(u *url.URL) (EventSink, error)
+
+// EventSinks maps URL schemes to EventSinkMakers.
+//
+// "http" and "https" POST each event in CloudEvents' structured
+// content mode.  "kafka" (kafka://HOST:PORT/TOPIC) produces each
+// event to TOPIC via a Kafka REST Proxy at HOST:PORT, and "file"
+// (file:FILENAME) appends each event as a JSON line.
+var EventSinks = map[string]EventSinkMaker{
+	"http":  newHTTPEventSink,
+	"https": newHTTPEventSink,
+	"kafka": newKafkaEventSink,
+	"file":  newFileEventSink,
+}
+
+// OpenEventSink makes an EventSink for the given URL.  See
+// EventSinks.
+func OpenEventSink(s string) (EventSink, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	maker, have := EventSinks[u.Scheme]
+	if !have {
+		return nil, fmt.Errorf("unknown event sink scheme '%s' in '%s'", u.Scheme, s)
+	}
+	return maker(u)
+}
+
+// EventTimeout is the timeout for sending an event to an HTTP (or
+// Kafka REST Proxy) sink.
+var EventTimeout = 10 * time.Second
+
+type httpEventSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPEventSink(u *url.URL) (EventSink, error) {
+	return &httpEventSink{
+		url: u.String(),
+		client: &http.Client{
+			Timeout: EventTimeout,
+		},
+	}, nil
+}
+
+func (s *httpEventSink) post(contentType string, x interface{}) error {
+	js, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, contentType, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("event sink %s: %s: %s", s.url, resp.Status, body)
+	}
+	return nil
+}
+
+func (s *httpEventSink) Send(e *Event) error {
+	return s.post("application/cloudevents+json; charset=UTF-8", e)
+}
+
+func (s *httpEventSink) Close() error {
+	return nil
+}
+
+// kafkaEventSink produces events via a Kafka REST Proxy (API v2)
+// since Plax doesn't have a native Kafka client.
+type kafkaEventSink struct {
+	*httpEventSink
+}
+
+func newKafkaEventSink(u *url.URL) (EventSink, error) {
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" {
+		return nil, fmt.Errorf("no topic in '%s'", u)
+	}
+	scheme := "http"
+	if u.Query().Get("tls") == "true" {
+		scheme = "https"
+	}
+	proxy := url.URL{
+		Scheme: scheme,
+		User:   u.User,
+		Host:   u.Host,
+		Path:   "/topics/" + topic,
+	}
+	s, _ := newHTTPEventSink(&proxy)
+	return &kafkaEventSink{
+		httpEventSink: s.(*httpEventSink),
+	}, nil
+}
+
+func (s *kafkaEventSink) Send(e *Event) error {
+	// The record's key is the event's subject, so a test's events
+	// go to the same partition.
+	records := map[string]interface{}{
+		"records": []interface{}{
+			map[string]interface{}{
+				"key":   e.Subject,
+				"value": e,
+			},
+		},
+	}
+	return s.post("application/vnd.kafka.json.v2+json", records)
+}
+
+type fileEventSink struct {
+	f *os.File
+}
+
+func newFileEventSink(u *url.URL) (EventSink, error) {
+	filename := u.Opaque
+	if filename == "" {
+		filename = u.Path
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileEventSink{
+		f: f,
+	}, nil
+}
+
+func (s *fileEventSink) Send(e *Event) error {
+	js, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(js, '\n'))
+	return err
+}
+
+func (s *fileEventSink) Close() error {
+	return s.f.Close()
+}
+
+// Emitter sends test lifecycle events to an EventSink.  An Emitter
+// can be shared by concurrent Invocations, and a nil Emitter does
+// nothing.
+//
+// Failures to send events are logged rather than reported as test
+// problems.
+type Emitter struct {
+	Sink EventSink
+
+	// Source is the CloudEvents source, which defaults to
+	// DefaultEventSource.
+	Source string
+
+	sync.Mutex
+	prefix string
+	n      int
+}
+
+// NewEmitter makes an Emitter for the given sink.
+func NewEmitter(sink EventSink, source string) *Emitter {
+	if source == "" {
+		source = DefaultEventSource
+	}
+	bs := make([]byte, 8)
+	rand.Read(bs)
+	return &Emitter{
+		Sink:   sink,
+		Source: source,
+		prefix: hex.EncodeToString(bs),
+	}
+}
+
+// Emit sends an event with the given type, subject, and data.
+func (e *Emitter) Emit(typ, subject string, data interface{}) {
+	if e == nil {
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.n++
+	ev := &Event{
+		SpecVersion:     "1.0",
+		Id:              fmt.Sprintf("%s-%d", e.prefix, e.n),
+		Source:          e.Source,
+		Type:            typ,
+		Time:            time.Now().UTC(),
+		Subject:         subject,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	if err := e.Sink.Send(ev); err != nil {
+		log.Printf("event %s (%s) not sent: %s", ev.Id, typ, err)
+	}
+}
+
+// Close closes the Emitter's sink.
+func (e *Emitter) Close() error {
+	if e == nil {
+		return nil
+	}
+	return e.Sink.Close()
+}
+
+// testEventData makes the data for a test's event.  The test case
+// is nil for EventTestStarted.
+func (inv *Invocation) testEventData(suite, filename string, t *dsl.Test, tc *junit.TestCase, d time.Duration) *TestEventData {
+	data := &TestEventData{
+		Suite:    suite,
+		Test:     t.Id,
+		Filename: filename,
+		Labels:   t.Labels,
+		Owners:   t.Owners,
+		Tickets:  t.Tickets(),
+		Priority: t.Priority,
+	}
+	if name := t.Name(); name != t.Id {
+		data.Name = name
+	}
+	if tc != nil {
+		data.Result = testResult(tc)
+		data.Duration = d.Seconds()
+		switch {
+		case tc.Error != nil:
+			data.Message = tc.Error.Message
+		case tc.Failure != nil:
+			data.Message = tc.Failure.Message
+		case tc.Skipped != nil:
+			data.Message = tc.Skipped.Message
+		}
+	}
+	return data
+}
+
+// suiteEventData makes the data for EventSuiteFinished.
+func suiteEventData(ts *junit.TestSuite) *SuiteEventData {
+	data := &SuiteEventData{
+		Suite: ts.Name,
+		Tests: len(ts.TestCases),
+	}
+	for i := range ts.TestCases {
+		switch testResult(&ts.TestCases[i]) {
+		case "error":
+			data.Errors++
+		case "failed":
+			data.Failed++
+		case "skipped":
+			data.Skipped++
+		default:
+			data.Passed++
+		}
+	}
+	return data
+}
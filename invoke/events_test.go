@@ -0,0 +1,125 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+type memEventSink struct {
+	events []*Event
+}
+
+func (s *memEventSink) Send(e *Event) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memEventSink) Close() error {
+	return nil
+}
+
+func TestInvocationEvents(t *testing.T) {
+	sink := &memEventSink{}
+	i := &Invocation{
+		SuiteName: "test:events",
+		Filename:  "../demos/mock.yaml",
+		Events:    NewEmitter(sink, ""),
+	}
+	if err := i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, e := range sink.events {
+		types = append(types, e.Type)
+		if e.SpecVersion != "1.0" || e.Source != DefaultEventSource || e.Id == "" {
+			t.Fatal(e)
+		}
+	}
+	want := []string{EventSuiteStarted, EventTestStarted, EventTestFinished, EventSuiteFinished}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatal(types)
+	}
+
+	if d := sink.events[2].Data.(*TestEventData); d.Result != "passed" || d.Suite != "test:events" {
+		t.Fatal(d)
+	}
+	if d := sink.events[3].Data.(*SuiteEventData); d.Tests != 1 || d.Passed != 1 {
+		t.Fatal(d)
+	}
+}
+
+func TestEventSinks(t *testing.T) {
+	var (
+		contentType, path string
+		body              []byte
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		path = r.URL.Path
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer s.Close()
+
+	t.Run("http", func(t *testing.T) {
+		sink, err := OpenEventSink(s.URL + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewEmitter(sink, "here").Emit(EventTestStarted, "x", nil)
+		if !strings.HasPrefix(contentType, "application/cloudevents+json") || path != "/events" {
+			t.Fatal(contentType, path)
+		}
+		var e Event
+		if err = json.Unmarshal(body, &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != EventTestStarted || e.Source != "here" || e.Subject != "x" {
+			t.Fatal(string(body))
+		}
+	})
+
+	t.Run("kafka", func(t *testing.T) {
+		sink, err := OpenEventSink(strings.Replace(s.URL, "http:", "kafka:", 1) + "/plax")
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewEmitter(sink, "").Emit(EventTestStarted, "x", nil)
+		if contentType != "application/vnd.kafka.json.v2+json" || path != "/topics/plax" {
+			t.Fatal(contentType, path)
+		}
+		if !strings.Contains(string(body), `"key":"x"`) {
+			t.Fatal(string(body))
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := OpenEventSink("carrier-pigeon://coop"); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,425 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+// HTMLReport collects tests' results, step traces, and logs, and it
+// writes them as a self-contained HTML page for people who'd rather
+// not read raw logs.  An HTMLReport is safe for concurrent use, so
+// several invocations (like plaxrun's groups) can share one.
+type HTMLReport struct {
+	sync.Mutex
+
+	Title string
+
+	// Time is when the report started.
+	Time time.Time
+
+	Tests []*HTMLTest
+}
+
+// HTMLTest is a test in an HTMLReport.
+type HTMLTest struct {
+	Suite    string
+	Test     string
+	Filename string
+
+	// Name, Owners, and Tickets come from the test's Metadata.
+	// See dsl.Metadata.
+	Name    string
+	Owners  []string
+	Tickets []string
+
+	// Result is "passed", "failed", "error", or "skipped".
+	Result  string
+	Message string
+
+	Start    time.Time
+	Duration time.Duration
+
+	// Steps are the trace events for the test's steps.  See
+	// dsl.Tracer.
+	Steps []*dsl.TraceEvent
+
+	// Log is the test's log (when the test had its own log).
+	// See Invocation.LogDir.
+	Log string
+}
+
+// NewHTMLReport makes an empty HTMLReport.
+func NewHTMLReport(title string) *HTMLReport {
+	return &HTMLReport{
+		Title: title,
+		Time:  time.Now().UTC(),
+	}
+}
+
+// Add adds a test to the report.  A nil HTMLReport does nothing.
+func (r *HTMLReport) Add(t *HTMLTest) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	r.Tests = append(r.Tests, t)
+	r.Unlock()
+}
+
+// WriteFile writes the report to the given file.
+func (r *HTMLReport) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = r.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the report as HTML.
+func (r *HTMLReport) Write(w io.Writer) error {
+	r.Lock()
+	defer r.Unlock()
+
+	v := &htmlView{
+		Title:  r.Title,
+		Time:   r.Time.Format(time.RFC3339),
+		Counts: make(map[string]int),
+	}
+	if v.Title == "" {
+		v.Title = "Plax test report"
+	}
+	for _, t := range r.Tests {
+		v.Counts[t.Result]++
+		v.Tests = append(v.Tests, newHTMLTestView(t))
+	}
+	v.Total = len(r.Tests)
+
+	return htmlTemplate.Execute(w, v)
+}
+
+// readTraceEvents parses a JSON Lines trace.  See dsl.Tracer.
+func readTraceEvents(bs []byte) ([]*dsl.TraceEvent, error) {
+	var (
+		acc []*dsl.TraceEvent
+		in  = bufio.NewScanner(bytes.NewReader(bs))
+	)
+	in.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for in.Scan() {
+		var e dsl.TraceEvent
+		if err := json.Unmarshal(in.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		acc = append(acc, &e)
+	}
+	return acc, in.Err()
+}
+
+// htmlView is what the template renders.
+type htmlView struct {
+	Title  string
+	Time   string
+	Total  int
+	Counts map[string]int
+	Tests  []*htmlTestView
+}
+
+type htmlTestView struct {
+	*HTMLTest
+	Elapsed string
+	Phases  []*htmlPhaseView
+}
+
+type htmlPhaseView struct {
+	Name  string
+	Bar   htmlBar
+	Steps []*htmlStepView
+}
+
+type htmlStepView struct {
+	*dsl.TraceEvent
+	Bar    htmlBar
+	Detail string
+}
+
+// htmlBar is a bar in a waterfall.  Left and Width are percentages
+// of the test's span.
+type htmlBar struct {
+	Left    float64
+	Width   float64
+	Elapsed string
+}
+
+// newHTMLTestView lays out the test's steps as waterfalls, one for
+// each phase (in the order that the phases started).
+func newHTMLTestView(t *HTMLTest) *htmlTestView {
+	v := &htmlTestView{
+		HTMLTest: t,
+		Elapsed:  t.Duration.Round(time.Millisecond).String(),
+	}
+	if len(t.Steps) == 0 {
+		return v
+	}
+
+	start := t.Steps[0].Time
+	end := start
+	for _, e := range t.Steps {
+		if e.Time.Before(start) {
+			start = e.Time
+		}
+		if x := e.Time.Add(e.Elapsed); end.Before(x) {
+			end = x
+		}
+	}
+	span := end.Sub(start)
+
+	bar := func(from time.Time, d time.Duration) htmlBar {
+		b := htmlBar{
+			Elapsed: d.Round(time.Microsecond).String(),
+			Width:   100,
+		}
+		if 0 < span {
+			b.Left = 100 * float64(from.Sub(start)) / float64(span)
+			b.Width = 100 * float64(d) / float64(span)
+		}
+		// Keep even instantaneous steps visible.
+		if b.Width < 0.5 {
+			b.Width = 0.5
+		}
+		if 100 < b.Left+b.Width {
+			b.Left = 100 - b.Width
+		}
+		return b
+	}
+
+	var (
+		phases = make(map[string]*htmlPhaseView)
+		ends   = make(map[string]time.Time)
+		starts = make(map[string]time.Time)
+	)
+	for _, e := range t.Steps {
+		p, have := phases[e.Phase]
+		if !have {
+			p = &htmlPhaseView{
+				Name: e.Phase,
+			}
+			phases[e.Phase] = p
+			starts[e.Phase] = e.Time
+			v.Phases = append(v.Phases, p)
+		}
+		if x := e.Time.Add(e.Elapsed); ends[e.Phase].Before(x) {
+			ends[e.Phase] = x
+		}
+		p.Steps = append(p.Steps, &htmlStepView{
+			TraceEvent: e,
+			Bar:        bar(e.Time, e.Elapsed),
+			Detail:     traceDetail(e),
+		})
+	}
+	for name, p := range phases {
+		p.Bar = bar(starts[name], ends[name].Sub(starts[name]))
+	}
+	sort.SliceStable(v.Phases, func(i, j int) bool {
+		return starts[v.Phases[i].Name].Before(starts[v.Phases[j].Name])
+	})
+
+	return v
+}
+
+// traceDetail renders the interesting parts of a step's trace event
+// (like its payload after substitution) as indented JSON.
+func traceDetail(e *dsl.TraceEvent) string {
+	d := make(map[string]interface{})
+	if e.Topic != "" {
+		d["topic"] = e.Topic
+	}
+	if e.Payload != nil {
+		d["payload"] = displayJSON(e.Payload)
+	}
+	if e.Pattern != nil {
+		d["pattern"] = displayJSON(e.Pattern)
+	}
+	if 0 < len(e.Matched) {
+		d["matched"] = e.Matched
+	}
+	if e.Bindings != nil {
+		d["bindings"] = e.Bindings
+	}
+	if e.Next != "" {
+		d["next"] = e.Next
+	}
+	if len(d) == 0 {
+		return ""
+	}
+	js, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", d)
+	}
+	return string(js)
+}
+
+// displayJSON returns the parsed value of a string that's a JSON
+// object or array (so that it's indented), and otherwise returns the
+// given value.
+func displayJSON(x interface{}) interface{} {
+	s, is := x.(string)
+	if !is {
+		return x
+	}
+	t := strings.TrimSpace(s)
+	if t == "" || (t[0] != '{' && t[0] != '[') {
+		return x
+	}
+	var y interface{}
+	if err := json.Unmarshal([]byte(t), &y); err != nil {
+		return x
+	}
+	return y
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"join": strings.Join}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { margin-bottom: 0; }
+.time { color: #666; }
+.summary span { margin-right: 1em; }
+.badge { display: inline-block; min-width: 4.5em; padding: 0.1em 0.5em; border-radius: 0.8em; color: white; font-size: 0.8em; text-align: center; text-transform: uppercase; }
+.passed { background: #2e7d32; }
+.failed { background: #c62828; }
+.error { background: #6a1b9a; }
+.skipped { background: #757575; }
+details.test { border: 1px solid #ddd; border-radius: 4px; margin: 0.5em 0; padding: 0.5em; }
+details.test > summary { cursor: pointer; }
+.suite, .elapsed { color: #666; font-size: 0.9em; }
+.message { white-space: pre-wrap; background: #fff3f3; padding: 0.5em; }
+.waterfall { margin: 0.5em 0; }
+.phase { font-weight: bold; margin-top: 0.5em; }
+.row { display: flex; align-items: center; }
+.row .label { width: 22em; flex: none; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; font-size: 0.9em; }
+.row .track { flex: auto; position: relative; height: 1em; background: #f4f4f4; }
+.row .bar { position: absolute; top: 0; bottom: 0; background: #1976d2; }
+.row .bar.phasebar { background: #90caf9; }
+.row .bar.failed { background: #c62828; }
+.row .bar.skipped { background: #bdbdbd; }
+.row .ms { width: 7em; flex: none; text-align: right; font-size: 0.8em; color: #666; }
+details.step { margin-left: 1em; }
+.meta { font-size: 0.9em; color: #555; margin: 0.3em 0; }
+pre { background: #f8f8f8; padding: 0.5em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="time">{{.Time}}</div>
+<p class="summary">
+<span>{{.Total}} tests</span>
+<span class="badge passed">{{index .Counts "passed"}} passed</span>
+<span class="badge failed">{{index .Counts "failed"}} failed</span>
+<span class="badge error">{{index .Counts "error"}} errors</span>
+<span class="badge skipped">{{index .Counts "skipped"}} skipped</span>
+</p>
+{{range .Tests}}
+<details class="test">
+<summary><span class="badge {{.Result}}">{{.Result}}</span> {{if .Name}}{{.Name}} <span class="suite">{{.Test}}</span>{{else}}{{.Test}}{{end}} <span class="suite">{{.Suite}}</span> <span class="elapsed">{{.Elapsed}}</span></summary>
+{{if or .Owners .Tickets}}<div class="meta">{{if .Owners}}Owners: {{join .Owners ", "}}{{end}}{{if and .Owners .Tickets}} &middot; {{end}}{{if .Tickets}}Tickets: {{join .Tickets ", "}}{{end}}</div>{{end}}
+{{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+{{if .Phases}}<div class="waterfall">
+{{range .Phases}}
+<div class="row phase"><div class="label">{{.Name}}</div><div class="track"><div class="bar phasebar" style="left: {{printf "%.2f" .Bar.Left}}%; width: {{printf "%.2f" .Bar.Width}}%"></div></div><div class="ms">{{.Bar.Elapsed}}</div></div>
+{{range .Steps}}
+<details class="step">
+<summary class="row"><div class="label">{{.Step}}: {{.Type}}{{if .Chan}} {{.Chan}}{{end}}</div><div class="track"><div class="bar {{.Outcome}}" style="left: {{printf "%.2f" .Bar.Left}}%; width: {{printf "%.2f" .Bar.Width}}%"></div></div><div class="ms">{{.Bar.Elapsed}}</div></summary>
+{{if .Error}}<div class="message">{{.Error}}</div>{{end}}
+{{if .Detail}}<pre>{{.Detail}}</pre>{{end}}
+</details>
+{{end}}
+{{end}}
+</div>{{end}}
+{{if .Log}}<details><summary>Log</summary><pre>{{.Log}}</pre></details>{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`))
+
+// traceTest returns a copy of the Ctx whose Tracer also writes the
+// test's trace to the returned buffer.
+func traceTest(ctx *dsl.Ctx) (*dsl.Ctx, *bytes.Buffer) {
+	var (
+		buf = &bytes.Buffer{}
+		c   = *ctx
+	)
+	c.Tracer = dsl.NewTracer(buf)
+	c.Tracer.Next = ctx.Tracer
+	return &c, buf
+}
+
+// addHTML adds the test to the HTMLReport.  The trace and the log can
+// be nil.
+func (inv *Invocation) addHTML(suite, filename string, t *dsl.Test, tc *junit.TestCase, then time.Time, trace *bytes.Buffer, tl *testLog) {
+	data := inv.testEventData(suite, filename, t, tc, time.Now().Sub(then))
+	ht := &HTMLTest{
+		Suite:    suite,
+		Test:     t.Id,
+		Filename: filename,
+		Name:     data.Name,
+		Owners:   data.Owners,
+		Tickets:  data.Tickets,
+		Result:   data.Result,
+		Message:  data.Message,
+		Start:    then,
+		Duration: time.Now().Sub(then),
+	}
+	if trace != nil {
+		steps, err := readTraceEvents(trace.Bytes())
+		if err != nil {
+			log.Printf("HTML report for %s: %s", filename, err)
+		}
+		ht.Steps = steps
+	}
+	if tl != nil {
+		if bs, err := ioutil.ReadFile(filepath.Join(inv.LogDir, tl.name)); err == nil {
+			ht.Log = string(bs)
+		}
+	}
+	inv.HTML.Add(ht)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestInvocationHTML(t *testing.T) {
+	r := NewHTMLReport("test:html")
+	i := &Invocation{
+		SuiteName: "test:html",
+		Filename:  "../demos/mock.yaml",
+		HTML:      r,
+	}
+	if err := i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Tests) != 1 {
+		t.Fatal(r.Tests)
+	}
+	ht := r.Tests[0]
+	if ht.Result != "passed" || ht.Suite != "test:html" || len(ht.Steps) == 0 {
+		t.Fatal(ht)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		"<title>test:html</title>",
+		`<span class="badge passed">1 passed</span>`,
+		`<span class="badge passed">passed</span>`,
+		`<div class="label">sub-and-pub</div>`,
+		`0: pub mother`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("no %s in %s", want, html)
+		}
+	}
+}
+
+func TestHTMLWaterfall(t *testing.T) {
+	var (
+		t0   = time.Now()
+		step = func(phase string, i int, at, d time.Duration) *dsl.TraceEvent {
+			return &dsl.TraceEvent{
+				Time:    t0.Add(at),
+				Elapsed: d,
+				Phase:   phase,
+				Step:    i,
+				Outcome: dsl.TraceOK,
+			}
+		}
+		v = newHTMLTestView(&HTMLTest{
+			Steps: []*dsl.TraceEvent{
+				step("phase1", 0, 0, 10*time.Millisecond),
+				step("phase1", 1, 10*time.Millisecond, 40*time.Millisecond),
+				step("phase2", 0, 50*time.Millisecond, 50*time.Millisecond),
+			},
+		})
+	)
+
+	if len(v.Phases) != 2 || v.Phases[0].Name != "phase1" || v.Phases[1].Name != "phase2" {
+		t.Fatal(v.Phases)
+	}
+	if b := v.Phases[0].Bar; b.Left != 0 || b.Width != 50 {
+		t.Fatal(b)
+	}
+	if b := v.Phases[0].Steps[1].Bar; b.Left != 10 || b.Width != 40 {
+		t.Fatal(b)
+	}
+	if b := v.Phases[1].Bar; b.Left != 50 || b.Width != 50 {
+		t.Fatal(b)
+	}
+}
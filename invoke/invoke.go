@@ -18,23 +18,25 @@
 package invoke
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Comcast/plax/dsl"
 	"github.com/Comcast/plax/junit"
-
-	"gopkg.in/yaml.v3"
+	"github.com/Comcast/plax/metrics"
 )
 
 // Invocation struct for execution of a suite of tests
@@ -44,19 +46,98 @@ type Invocation struct {
 	Filename  string
 	// Dir will be added to ctx.IncludeDirs to resolve YAML (and
 	// perhaps other) includes.
-	Dir               string
-	IncludeDirs       []string
-	Env               map[string]string
-	Seed              int64
-	Priority          int
-	Labels            string
-	LogLevel          string
-	Verbose           bool
-	List              bool
+	Dir         string
+	IncludeDirs []string
+	// Env optionally gives environment variables for the
+	// subprocesses that tests start.  See dsl.Ctx.Env.
+	Env map[string]string
+	// Registries are directories or base URLs for resolving
+	// tests' Packages.  See dsl.Package.
+	Registries []string
+	// Profiles are files of channel profiles for every test.
+	// See dsl.ChanProfile.
+	Profiles []string
+	// ChanOverlays are channel configurations by channel type
+	// for every test.  See dsl.Ctx.ChanOverlays.
+	ChanOverlays map[dsl.ChanKind]interface{}
+	Seed         int64
+	Priority     int
+	Labels       string
+	// KeepGoing, when true, reports a test that doesn't load
+	// (for example, because it doesn't parse) as an error
+	// instead of exiting.
+	KeepGoing bool
+	// ExtraLabels are labels that every test gets in addition to
+	// its own.  See dsl.Test.Labels.
+	ExtraLabels []string
+	// Owners are the owners of tests that don't specify their
+	// own.  See dsl.Test.Owners.
+	Owners   []string
+	LogLevel string
+	Verbose  bool
+	List     bool
+	// Lint, when true, only checks each test against the JSON
+	// Schema for tests (see dsl.CheckTestSchema), validates it
+	// (see dsl.Test.Validate and dsl.Test.Lint), and reports its
+	// problems.
+	Lint bool
+	// DryRun, when true, lints (see Lint) each test and then
+	// prints its spec after substituting the Bindings.  No
+	// channels are opened.
+	DryRun bool
+	// Expand, when true, prints each test's spec after complete
+	// substitution (including '@@' files and '!!' Javascript)
+	// with the Bindings and the test's params' defaults.  No
+	// channels are opened.
+	Expand bool
+	// Redact, when true, redacts secrets (see
+	// dsl.IsSecretBinding) in the output of Expand.
+	Redact            bool
 	EmitJSON          bool
 	NonzeroOnAnyError bool
 	// Retry will override a test's retry policy (if any).
-	Retry   string
+	Retry string
+	// Instances, when positive, will override a test's Instances
+	// (if any).
+	Instances int
+	// Record, when not empty, will override a test's Record
+	// file (if any).
+	Record string
+	// HTML, when not nil, gets every test's result, step trace,
+	// and log (see LogDir).
+	HTML *HTMLReport
+
+	// Trace, when not empty, is the file for a JSON Lines trace
+	// of every step execution.  See dsl.Tracer.
+	Trace string
+	// EmitParams, when true, adds the Bindings to each test case
+	// as properties.
+	EmitParams bool
+	// Debug, when true, runs each test with an interactive
+	// dsl.Debugger (using stdin and stderr).
+	Debug bool
+	// FailOnLeaks, when true, fails tests that leak channels or
+	// goroutines.  See dsl.Test.FailOnLeaks.
+	FailOnLeaks bool
+	// Soak, when not nil, runs the tests repeatedly and reports
+	// periodically.  See Soak.
+	Soak *Soak
+	// Latency, when not nil, gates step latencies against their
+	// recent history.  See LatencyGate.
+	Latency *LatencyGate
+	// Metrics, when not nil, gets counts of tests by result,
+	// test durations, and channel metrics.  See dsl.Ctx.Metrics.
+	Metrics *metrics.Registry
+	// LogDir, when not empty, is a directory for a log file for
+	// each test (instead of the usual log) along with an index
+	// (see LogIndex).
+	LogDir string
+	// LogFormat is the format (see dsl.NewLogger) for the logs
+	// in LogDir.
+	LogFormat string
+	// Events, when not nil, gets CloudEvents for the suite's and
+	// each test's start and finish.  See Emitter.
+	Events  *Emitter
 	retries *dsl.Retries
 }
 
@@ -70,6 +151,23 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 		}
 	}
 
+	// Subprocesses get the Invocation's environment variables.
+	dslCtx.Env = inv.Env
+	dslCtx.Registries = inv.Registries
+	dslCtx.Metrics = inv.Metrics
+	dslCtx.ChanOverlays = inv.ChanOverlays
+
+	if 0 < len(inv.Profiles) {
+		dslCtx.Profiles = make(dsl.ChanProfiles)
+		for _, filename := range inv.Profiles {
+			ps, err := dsl.ReadChanProfiles(filename)
+			if err != nil {
+				log.Fatal(err)
+			}
+			dslCtx.Profiles.Add(ps)
+		}
+	}
+
 	inv.retries = dsl.NewRetries()
 
 	wd, err := os.Getwd()
@@ -99,9 +197,25 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 	var (
 		ts        = junit.NewTestSuite()
 		filenames = make([]string, 0, 8)
-		problem   bool
+		problems  = &Problems{}
 	)
 
+	if inv.Trace != "" && !inv.examining() {
+		f, err := os.Create(inv.Trace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		dslCtx.Tracer = dsl.NewTracer(f)
+	}
+
+	var latencies *LatencyDB
+	if inv.Latency != nil && inv.Soak == nil && !inv.examining() {
+		if latencies, err = ReadLatencyDB(inv.Latency.Filename); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	ts.Name = strings.ReplaceAll(inv.SuiteName,
 		"{TS}",
 		time.Now().UTC().Format(time.RFC3339Nano))
@@ -151,12 +265,28 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 		filenames = append(filenames, filename)
 	}
 
+	if inv.Soak != nil && !inv.examining() {
+		return inv.soak(dslCtx, filenames)
+	}
+
+	if !inv.List && !inv.examining() {
+		inv.Events.Emit(EventSuiteStarted, ts.Name, &SuiteEventData{
+			Suite: ts.Name,
+		})
+	}
+
 	// Run tests.
 	i := 0
 	for _, filename := range filenames {
 		t, err := inv.Load(dslCtx, filename)
 		if err != nil {
-			log.Fatalf("Invocation of %s broken: %s", filename, err)
+			if !inv.KeepGoing {
+				log.Fatalf("Invocation of %s broken: %s", filename, err)
+			}
+			log.Printf("Invocation of %s broken: %s", filename, err)
+			inv.broken(dslCtx, ts, problems, i, filename, err)
+			i++
+			continue
 		}
 
 		if !t.Wanted(dslCtx, inv.Priority, strings.Split(inv.Labels, ",")) {
@@ -170,6 +300,21 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 			continue
 		}
 
+		if inv.Lint || inv.DryRun {
+			if inv.lint(dslCtx, filename, t) {
+				problems.Add(dsl.CategorySchema)
+			}
+			continue
+		}
+
+		if inv.Expand {
+			if err := inv.expand(dslCtx, filename, t); err != nil {
+				problems.Add(dsl.CategoryOf(err))
+				fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			}
+			continue
+		}
+
 		tc := junit.NewTestCase(filename)
 		tc.N = i
 		i++
@@ -178,27 +323,54 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 
 		log.Printf("Running test %s", filename)
 
-		if err := inv.Run(dslCtx, t); err != nil {
+		inv.Events.Emit(EventTestStarted, t.Id, inv.testEventData(ts.Name, filename, t, nil, 0))
+
+		var (
+			then   = time.Now()
+			tctx   = dslCtx
+			tlog   *testLog
+			tTrace *bytes.Buffer
+		)
+		if inv.LogDir != "" {
+			if tctx, tlog, err = inv.openTestLog(dslCtx, filename); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if inv.HTML != nil {
+			tctx, tTrace = traceTest(tctx)
+		}
+
+		if err := inv.RunInstances(tctx, filename, t); err != nil {
+			category := dsl.CategoryOf(err)
 			if b, is := dsl.IsBroken(err); is {
-				problem = true
+				problems.Add(category)
 				tc.Error = &junit.Error{
-					Message: b.Err.Error(),
+					Message: dslCtx.Redactor.Redact(b.Err.Error()),
+					Type:    string(category),
 				}
 			} else {
 				if !t.Negative {
-					problem = true
-					log.Printf("Test %s failed: %s", filename, err)
+					problems.Add(category)
+					msg := dslCtx.Redactor.Redact(err.Error())
+					log.Printf("Test %s failed (%s): %s", filename, category, msg)
 					tc.Failure = &junit.Failure{
-						Message: err.Error(),
+						Message: msg,
+						Type:    string(category),
 					}
 				}
 			}
+		} else if skipped, reason := t.IsSkipped(); skipped {
+			log.Printf("Test %s skipped %s", filename, reason)
+			tc.Skipped = &junit.Skipped{
+				Message: dslCtx.Redactor.Redact(reason),
+			}
 		} else { // err nil
 			if t.Negative {
-				problem = true
+				problems.Add(dsl.CategoryFailure)
 				log.Printf("Test %s (negative) failed (no error)", filename)
 				tc.Failure = &junit.Failure{
 					Message: "expected error for Negative test",
+					Type:    string(dsl.CategoryFailure),
 				}
 			} else {
 				log.Printf("Test %s passed", filename)
@@ -209,7 +381,40 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 			tc.State = t.State
 		}
 
-		tc.Finish("executed")
+		if inv.EmitParams {
+			tc.Properties = inv.properties(dslCtx)
+		}
+		tc.Properties = append(tc.Properties, skippedSteps(dslCtx, t)...)
+		tc.Properties = append(tc.Properties, tableRows(dslCtx, t)...)
+		tc.Properties = append(tc.Properties, subtests(dslCtx, t)...)
+		tc.Properties = append(tc.Properties, assertions(t)...)
+		tc.Properties = append(tc.Properties, leaks(t)...)
+		tc.Properties = append(tc.Properties, inv.owners(t)...)
+		tc.Properties = append(tc.Properties, metadata(t)...)
+
+		if latencies != nil && tc.Failure == nil && tc.Error == nil && tc.Skipped == nil && !t.Negative {
+			inv.gateLatencies(latencies, problems, filename, t, tc)
+		}
+
+		inv.measure(t, tc, time.Now().Sub(then))
+
+		inv.Events.Emit(EventTestFinished, t.Id, inv.testEventData(ts.Name, filename, t, tc, time.Now().Sub(then)))
+
+		if tlog != nil {
+			if err := inv.closeTestLog(tlog, t, tc); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if inv.HTML != nil {
+			inv.addHTML(ts.Name, filename, t, tc, then, tTrace, tlog)
+		}
+
+		status := "executed"
+		if tc.Skipped != nil {
+			status = "skipped"
+		}
+		tc.Finish(status)
 		ts.Add(*tc)
 	}
 
@@ -218,54 +423,197 @@ func (inv *Invocation) Exec(ctx context.Context) error {
 		return nil
 	}
 
-	if inv.EmitJSON {
-		// We'll emit some JSON that represents an array of
-		// objects suitable of indexing
-		acc := make([]interface{}, 0, len(ts.TestCases)+1)
+	if inv.examining() {
+		if problems.First != "" {
+			return problems
+		}
+		return nil
+	}
+
+	inv.Events.Emit(EventSuiteFinished, ts.Name, suiteEventData(ts))
 
-		// Our first "doc" represents the suite of tests we
-		// just range.
-		jts := JSONTestSuite{
-			Time:   ts.Time,
-			Tests:  len(ts.TestCases),
-			Errors: ts.Errors,
-			Failed: ts.Failures,
-			Type:   "suite",
+	if latencies != nil {
+		if err := latencies.Write(inv.Latency.Filename); err != nil {
+			log.Fatal(err)
 		}
-		jts.Passed = jts.Tests - jts.Errors - jts.Failed
+	}
+
+	if err := WriteReport(os.Stdout, ts, problems.Categories, inv.EmitJSON); err != nil {
+		log.Fatal(err)
+	}
+
+	if inv.NonzeroOnAnyError && problems.First != "" {
+		return problems
+	}
+
+	return nil
+}
+
+// broken adds an error test case for a test that didn't load.  See
+// KeepGoing.
+func (inv *Invocation) broken(ctx *dsl.Ctx, ts *junit.TestSuite, problems *Problems, i int, filename string, err error) {
+	category := dsl.CategoryOf(err)
+	problems.Add(category)
+
+	tc := junit.NewTestCase(filename)
+	tc.N = i
+	tc.Suite = ts.Name
+	tc.Type = "case"
+	tc.Error = &junit.Error{
+		Message: ctx.Redactor.Redact(err.Error()),
+		Type:    string(category),
+	}
+	tc.Finish("executed")
+
+	t := dsl.NewTest(ctx, filename, nil)
+	inv.Events.Emit(EventTestFinished, t.Id, inv.testEventData(ts.Name, filename, t, tc, 0))
+
+	if inv.HTML != nil {
+		inv.addHTML(ts.Name, filename, t, tc, time.Now(), nil, nil)
+	}
+
+	ts.Add(*tc)
+}
+
+// measure adds the test's result and duration to the Metrics (if
+// any).
+func (inv *Invocation) measure(t *dsl.Test, tc *junit.TestCase, d time.Duration) {
+	inv.Metrics.Add(metrics.TestsTotal, metrics.Labels{
+		"suite":  inv.SuiteName,
+		"result": testResult(tc),
+	}, 1)
+	inv.Metrics.ObserveDuration(metrics.TestDuration, metrics.Labels{
+		"test": t.Id,
+	}, metrics.TestBuckets, d)
+}
+
+// Problems summarizes the categories of the problems (failures and
+// errors) in a suite, and a Problems is the error that Exec returns
+// when NonzeroOnAnyError and there was a problem.
+type Problems struct {
+	// First is the Category of the first problem.
+	First dsl.Category
 
-		acc = append(acc, jts)
+	// Categories counts the problems by category.
+	Categories map[dsl.Category]int
+}
+
+// Add counts a problem with the given Category.
+func (ps *Problems) Add(c dsl.Category) {
+	if ps.First == "" {
+		ps.First = c
+	}
+	if ps.Categories == nil {
+		ps.Categories = make(map[dsl.Category]int)
+	}
+	ps.Categories[c]++
+}
 
-		// The remaining "docs" are the test cases themselves.
-		for i, tc := range ts.TestCases {
-			tc.N = i
-			tc.Suite = ts.Name
-			tc.Type = "case"
-			acc = append(acc, tc)
+func (ps *Problems) Error() string {
+	n := 0
+	for _, count := range ps.Categories {
+		n += count
+	}
+	return fmt.Sprintf("%d problem(s) (first: %s)", n, ps.First)
+}
+
+// ExitCode returns the exit code for the first problem.
+func (ps *Problems) ExitCode() int {
+	return ps.First.ExitCode()
+}
+
+// properties returns the Bindings as JUnit properties sorted by name.
+//
+// Secrets are redacted.
+func (inv *Invocation) properties(ctx *dsl.Ctx) junit.Properties {
+	ps := make(junit.Properties, 0, len(inv.Bindings))
+	for k, v := range inv.Bindings {
+		s, is := v.(string)
+		if !is {
+			s = dsl.JSON(v)
 		}
+		if dsl.IsSecretBinding(k) {
+			s = dsl.Redacted
+		}
+		ps = append(ps, junit.Property{
+			Name:  k,
+			Value: ctx.Redactor.Redact(s),
+		})
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].Name < ps[j].Name
+	})
+	return ps
+}
 
-		// Write the JSON.
-		js, err := json.Marshal(&acc)
-		if err != nil {
-			log.Fatal(err)
+// skippedSteps returns JUnit properties for the steps (if any) that
+// the test skipped.
+func skippedSteps(ctx *dsl.Ctx, t *dsl.Test) []junit.Property {
+	var ps []junit.Property
+	for _, s := range t.Skipped {
+		if s.Phase == "" {
+			continue
 		}
+		ps = append(ps, junit.Property{
+			Name:  "skipped",
+			Value: ctx.Redactor.Redact(s.String()),
+		})
+	}
+	return ps
+}
 
-		fmt.Printf("%s\n", js)
-		return nil
+// tableRows returns JUnit properties for the outcomes of the rows
+// (if any) of the test's phases with Tables.
+func tableRows(ctx *dsl.Ctx, t *dsl.Test) []junit.Property {
+	ps := make([]junit.Property, 0, len(t.Rows))
+	for _, r := range t.Rows {
+		ps = append(ps, junit.Property{
+			Name:  "row",
+			Value: ctx.Redactor.Redact(r.String()),
+		})
 	}
+	return ps
+}
 
-	// Wire the XML representation of the JUnit test suite.
-	bs, err := xml.MarshalIndent(ts, "", "  ")
-	if err != nil {
-		log.Fatal(err)
+// subtests returns JUnit properties for the outcomes of the test's
+// subtests (see dsl.RunTest), including nested subtests.
+func subtests(ctx *dsl.Ctx, t *dsl.Test) []junit.Property {
+	ps := make([]junit.Property, 0, len(t.Subtests))
+	for _, s := range t.Subtests {
+		for _, r := range s.Flatten() {
+			ps = append(ps, junit.Property{
+				Name:  "subtest",
+				Value: ctx.Redactor.Redact(r.String()),
+			})
+		}
 	}
-	fmt.Printf("%s\n", bs)
+	return ps
+}
 
-	if inv.NonzeroOnAnyError && problem {
-		return fmt.Errorf("Prolem")
+// leaks returns JUnit properties for the test's leaks (see
+// dsl.Test.Finalize).
+func leaks(t *dsl.Test) []junit.Property {
+	ps := make([]junit.Property, 0, len(t.Leaks))
+	for _, leak := range t.Leaks {
+		ps = append(ps, junit.Property{
+			Name:  "leak",
+			Value: leak,
+		})
 	}
+	return ps
+}
 
-	return nil
+// assertions returns a JUnit property with the number of assertions
+// that the test executed if the test declares a minimum (see
+// dsl.Spec.MinAssertions) or executed any.
+func assertions(t *dsl.Test) []junit.Property {
+	if t.Assertions == 0 && (t.Spec == nil || t.Spec.MinAssertions <= 0) {
+		return nil
+	}
+	return []junit.Property{{
+		Name:  "assertions",
+		Value: strconv.Itoa(t.Assertions),
+	}}
 }
 
 // Load a test
@@ -278,26 +626,47 @@ func (inv *Invocation) Load(ctx *dsl.Ctx, filename string) (*dsl.Test, error) {
 	if ctx.IncludeDirs == nil {
 		ctx.IncludeDirs = make([]string, 0, 4)
 	}
-	if inv.Dir == "" {
-		ctx.IncludeDirs = append(ctx.IncludeDirs, ".")
-	} else {
-		ctx.IncludeDirs = append(ctx.IncludeDirs, inv.Dir)
+	dir := inv.Dir
+	if dir == "" {
+		dir = "."
+	}
+	// Don't grow IncludeDirs when loading the same test
+	// repeatedly (see RunInstances and Soak).
+	if n := len(ctx.IncludeDirs); n == 0 || ctx.IncludeDirs[n-1] != dir {
+		ctx.IncludeDirs = append(ctx.IncludeDirs, dir)
 	}
 
-	t := dsl.NewTest(ctx, filename, nil)
-	t.Dir = inv.Dir
-
-	if bs, err = dsl.IncludeYAML(ctx, bs); err != nil {
-		return nil, dsl.NewBroken(fmt.Errorf("spec parse: %w", err))
+	t, err := dsl.ParseTest(ctx, filename, bs)
+	if err != nil {
+		return nil, err
 	}
+	t.Dir = inv.Dir
 
-	if err := yaml.Unmarshal(bs, &t); err != nil {
-		return nil, dsl.NewBroken(fmt.Errorf("spec parse: %w", err))
+	for _, label := range inv.ExtraLabels {
+		if !dsl.LabelsMatch(t.Labels, []string{label}) {
+			t.Labels = append(t.Labels, label)
+		}
 	}
 
 	return t, nil
 }
 
+// examining reports whether the Invocation only examines tests
+// rather than running them.
+func (inv *Invocation) examining() bool {
+	return inv.List || inv.Lint || inv.DryRun || inv.Expand
+}
+
+// include processes the YAML includes (see dsl.IncludeYAML) in the
+// given spec source.
+func (inv *Invocation) include(ctx *dsl.Ctx, bs []byte) ([]byte, error) {
+	bs, err := dsl.IncludeYAML(ctx, bs)
+	if err != nil {
+		return nil, dsl.Categorize(dsl.CategorySchema, dsl.Brokenf("spec parse: %w", err))
+	}
+	return bs, nil
+}
+
 // Run executes the test with possible retries.
 func (inv *Invocation) Run(ctx *dsl.Ctx, t *dsl.Test) error {
 	if t == nil {
@@ -318,7 +687,7 @@ func (inv *Invocation) Run(ctx *dsl.Ctx, t *dsl.Test) error {
 	for j := 0; j <= retries.N; j++ {
 		if 0 < j {
 			delay = retries.NextDelay(delay)
-			log.Printf("Retry %d (%v delay) on error '%v'\n", j, delay, err)
+			log.Printf("Retry %d (%v delay) on error '%s'\n", j, delay, ctx.Redactor.Redact(err.Error()))
 			time.Sleep(delay)
 		}
 		err = inv.RunOnce(ctx, t)
@@ -334,16 +703,136 @@ func (inv *Invocation) Run(ctx *dsl.Ctx, t *dsl.Test) error {
 	return err
 }
 
-// RunOnce executes the test at most one time.
-func (inv *Invocation) RunOnce(ctx *dsl.Ctx, t *dsl.Test) error {
+// RunInstances executes the test, or, if the test (or the
+// Invocation) specifies multiple Instances, runs that many
+// concurrent copies of the test.
+//
+// Each copy is loaded again from the given filename.  Copy i gets
+// the Id "ID[i]", and its bindings include "?!instance" (i) and
+// "?!instanceId" (that Id), which a test can use to give each copy a
+// distinct identity (e.g., an MQTT ClientID).
+//
+// If any copy is broken, the result is broken.  Otherwise, if any
+// copy failed, the result is a failure.  A Negative test expects
+// every copy to fail, so a mix of passes and failures results in no
+// error (which the caller then reports as a failed Negative test).
+func (inv *Invocation) RunInstances(ctx *dsl.Ctx, filename string, t *dsl.Test) error {
+	if t == nil {
+		return dsl.Brokenf("test is nil")
+	}
 
-	ctx, cancel := ctx.WithCancel()
-	defer cancel()
+	n := t.Instances
+	if 0 < inv.Instances {
+		n = inv.Instances
+	}
+	if n <= 1 {
+		return inv.Run(ctx, t)
+	}
+
+	ts := make([]*dsl.Test, n)
+	for i := range ts {
+		c, err := inv.Load(ctx, filename)
+		if err != nil {
+			return err
+		}
+		c.Id = fmt.Sprintf("%s[%d]", t.Id, i)
+		if c.Bindings == nil {
+			c.Bindings = make(dsl.Bindings)
+		}
+		c.Bindings["?!instance"] = i
+		c.Bindings["?!instanceId"] = c.Id
+		ts[i] = c
+	}
+
+	log.Printf("Running %d instances of test %s", n, t.Id)
 
+	var (
+		errs = make([]error, n)
+		wg   sync.WaitGroup
+	)
+	for i, c := range ts {
+		wg.Add(1)
+		go func(i int, c *dsl.Test) {
+			defer wg.Done()
+			errs[i] = inv.Run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	var (
+		broken, failed []string
+	)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		msg := fmt.Sprintf("%s: %s", ts[i].Id, err)
+		if _, is := dsl.IsBroken(err); is {
+			broken = append(broken, msg)
+		} else {
+			failed = append(failed, msg)
+		}
+	}
+
+	// Report the state of the first copy.
+	t.State = ts[0].State
+	t.Skipped = ts[0].Skipped
+	t.Latencies = ts[0].Latencies
+	t.Assertions = ts[0].Assertions
+	t.Subtests = ts[0].Subtests
+	t.Leaks = ts[0].Leaks
+
+	if 0 < len(broken) {
+		return dsl.Brokenf("%d of %d instances broken: %s",
+			len(broken), n, strings.Join(broken, "; "))
+	}
+	if 0 < len(failed) {
+		if t.Negative && len(failed) < n {
+			return nil
+		}
+		return fmt.Errorf("%d of %d instances failed: %s",
+			len(failed), n, strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// RunOnce executes the test at most one time.
+//
+// However the execution ends (even with a panic), RunOnce finalizes
+// the test (see dsl.Test.Finalize) so that the test's channels don't
+// outlive it.  With FailOnLeaks, a test that otherwise passes fails
+// if it leaked channels or goroutines.
+func (inv *Invocation) RunOnce(ctx *dsl.Ctx, t *dsl.Test) (err error) {
 	if t == nil {
 		return dsl.Brokenf("test is nil")
 	}
 
+	if inv.FailOnLeaks {
+		t.FailOnLeaks = true
+	}
+
+	goroutines := runtime.NumGoroutine()
+	defer func() {
+		r := recover()
+		t.Finalize(ctx)
+		if r != nil {
+			panic(r)
+		}
+		if err == nil {
+			err = t.CheckLeaks(ctx, goroutines)
+		}
+	}()
+
+	return inv.runOnce(ctx, t)
+}
+
+// runOnce does the work for RunOnce.
+func (inv *Invocation) runOnce(ctx *dsl.Ctx, t *dsl.Test) error {
+
+	ctx, cancel := ctx.WithCancel()
+	defer cancel()
+
 	if t.Seed != 0 {
 		log.Printf("Setting pseudo-random number generator seed: %v", t.Seed)
 		rand.Seed(t.Seed)
@@ -356,6 +845,20 @@ func (inv *Invocation) RunOnce(ctx *dsl.Ctx, t *dsl.Test) error {
 		t.Bindings[p] = v
 	}
 
+	if inv.Debug {
+		t.Debugger = dsl.NewDebugger(os.Stdin, os.Stderr)
+	}
+
+	if inv.Record != "" {
+		// Relative to the working directory rather than the
+		// test's directory.
+		filename, err := filepath.Abs(inv.Record)
+		if err != nil {
+			return dsl.NewBroken(err)
+		}
+		t.Record = filename
+	}
+
 	if err := t.Init(ctx); err != nil {
 		return err
 	}
@@ -365,7 +868,7 @@ func (inv *Invocation) RunOnce(ctx *dsl.Ctx, t *dsl.Test) error {
 		for i, err := range errs {
 			acc += fmt.Sprintf("  %02d. %s\n", i, err)
 		}
-		return dsl.Brokenf("Validation failed:\n\n%s\n", acc)
+		return dsl.Categorize(dsl.CategorySchema, dsl.Brokenf("Validation failed:\n\n%s\n", acc))
 	}
 	if err := t.Run(ctx); err != nil {
 		return err
@@ -380,10 +883,14 @@ func (inv *Invocation) RunOnce(ctx *dsl.Ctx, t *dsl.Test) error {
 
 // JSONTestSuite test results
 type JSONTestSuite struct {
-	Type   string
-	Time   time.Time
-	Tests  int
-	Passed int
-	Failed int
-	Errors int
+	Type    string
+	Time    time.Time
+	Tests   int
+	Passed  int
+	Failed  int
+	Errors  int
+	Skipped int
+
+	// Categories counts failures and errors by category.
+	Categories map[dsl.Category]int `json:",omitempty"`
 }
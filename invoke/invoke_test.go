@@ -18,9 +18,16 @@
 package invoke
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/metrics"
 )
 
 func TestNilTest(t *testing.T) {
@@ -53,3 +60,347 @@ func TestInvocationBasic(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestInvocationTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	i := &Invocation{
+		SuiteName: "test:trace",
+		Filename:  "../demos/mock.yaml",
+		Trace:     filepath.Join(dir, "trace.jsonl"),
+	}
+	if err = i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(i.Trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("trace: %s", bs)
+	}
+	var e dsl.TraceEvent
+	if err = json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != "pub" || e.Outcome != dsl.TraceOK {
+		t.Fatal(lines[0])
+	}
+}
+
+func TestInvocationMetrics(t *testing.T) {
+	i := &Invocation{
+		SuiteName: "test:metrics",
+		Filename:  "../demos/mock.yaml",
+		Metrics:   metrics.NewRegistry(),
+	}
+	if err := i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := i.Metrics.Counter(metrics.TestsTotal, metrics.Labels{
+		"suite":  "test:metrics",
+		"result": "passed",
+	}); n != 1 {
+		t.Fatal(n)
+	}
+	if n := i.Metrics.Counter(metrics.ChanPublished, metrics.Labels{
+		"chan": "mock",
+		"kind": "mock",
+	}); n == 0 {
+		t.Fatal(n)
+	}
+
+	var buf bytes.Buffer
+	if err := i.Metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		metrics.TestDuration + "_count",
+		metrics.RecvWait + "_count",
+		metrics.ChanReceived,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %s in\n%s", want, &buf)
+		}
+	}
+}
+
+func TestInvocationInstances(t *testing.T) {
+	i := &Invocation{
+		SuiteName: "test:instances",
+		Filename:  "../demos/instances.yaml",
+	}
+
+	ctx := dsl.NewCtx(nil)
+	if err := i.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("override", func(t *testing.T) {
+		i.Instances = 2
+		tst, err := i.Load(ctx, i.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = i.RunInstances(ctx, i.Filename, tst); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInvocationExtraLabels(t *testing.T) {
+	i := &Invocation{
+		Filename:    "../demos/basic.yaml",
+		ExtraLabels: []string{"selftest", "smoke"},
+	}
+
+	tst, err := i.Load(dsl.NewCtx(nil), i.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(tst.Labels, ","); got != "selftest,smoke" {
+		t.Fatal(got)
+	}
+}
+
+func TestInvocationProperties(t *testing.T) {
+	i := &Invocation{
+		Bindings: map[string]interface{}{
+			"?b": "queso",
+			"?a": 42,
+		},
+		EmitParams: true,
+	}
+
+	ps := i.properties(dsl.NewCtx(nil))
+	if len(ps) != 2 {
+		t.Fatal(ps)
+	}
+	if ps[0].Name != "?a" || ps[0].Value != "42" {
+		t.Fatal(ps[0])
+	}
+	if ps[1].Name != "?b" || ps[1].Value != "queso" {
+		t.Fatal(ps[1])
+	}
+}
+
+func TestInvocationProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "timeout.yaml")
+	spec := `
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            chan: mother
+            payload:
+              make:
+                name: mock
+                type: mock
+        - recv:
+            chan: mother
+            pattern:
+              success: true
+        - recv:
+            chan: mock
+            pattern: never
+            timeout: 10ms
+`
+	if err = ioutil.WriteFile(filename, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &Invocation{
+		SuiteName:         "test:problems",
+		Filename:          filename,
+		NonzeroOnAnyError: true,
+	}
+
+	err = i.Exec(dsl.NewCtx(nil))
+	ps, is := err.(*Problems)
+	if !is {
+		t.Fatalf("wanted Problems but got %#v", err)
+	}
+	if ps.First != dsl.CategoryTimeout {
+		t.Fatal(ps.First)
+	}
+	if n := ps.ExitCode(); n != dsl.ExitCodes[dsl.CategoryTimeout] {
+		t.Fatal(n)
+	}
+}
+
+func TestInvocationKeepGoing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "broken.yaml")
+	if err = ioutil.WriteFile(filename, []byte("spec: ["), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &memEventSink{}
+	i := &Invocation{
+		SuiteName:         "test:keepgoing",
+		Filename:          filename,
+		NonzeroOnAnyError: true,
+		KeepGoing:         true,
+		Events:            NewEmitter(sink, ""),
+	}
+
+	err = i.Exec(dsl.NewCtx(nil))
+	ps, is := err.(*Problems)
+	if !is {
+		t.Fatalf("wanted Problems but got %#v", err)
+	}
+	if ps.First != dsl.CategorySchema {
+		t.Fatal(ps.First)
+	}
+
+	var found bool
+	for _, e := range sink.events {
+		if e.Type != EventTestFinished {
+			continue
+		}
+		found = true
+		if d := e.Data.(*TestEventData); d.Result != "error" || d.Test != filename {
+			t.Fatal(d)
+		}
+	}
+	if !found {
+		t.Fatal("no test finished")
+	}
+}
+
+func TestInvocationDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "typo.yaml")
+	spec := `
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            chan: mother
+            paylod: '{?x}'
+`
+	if err = ioutil.WriteFile(filename, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &Invocation{
+		SuiteName: "test:dryrun",
+		Filename:  filename,
+		Bindings: map[string]interface{}{
+			"?x": "queso",
+		},
+		DryRun: true,
+	}
+
+	err = i.Exec(dsl.NewCtx(nil))
+	ps, is := err.(*Problems)
+	if !is {
+		t.Fatalf("wanted Problems but got %#v", err)
+	}
+	if ps.First != dsl.CategorySchema {
+		t.Fatal(ps.First)
+	}
+
+	t.Run("fixed", func(t *testing.T) {
+		fixed := strings.Replace(spec, "paylod", "payload", 1)
+		if err = ioutil.WriteFile(filename, []byte(fixed), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = i.Exec(dsl.NewCtx(nil)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInvocationExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "expand.yaml")
+	spec := `
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            chan: mother
+            payload: '!!"{?x}".toUpperCase() + " {?!secret}"'
+`
+	if err = ioutil.WriteFile(filename, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &Invocation{
+		SuiteName: "test:expand",
+		Filename:  filename,
+		Bindings: map[string]interface{}{
+			"?x":       "queso",
+			"?!secret": "hunter2",
+		},
+		Expand: true,
+		Redact: true,
+	}
+
+	if err = i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("write", func(t *testing.T) {
+		r := dsl.NewRedactor()
+		r.Add("hunter2")
+		var buf bytes.Buffer
+		x := map[string]interface{}{
+			"payload": "QUESO hunter2",
+		}
+		if err := writeSpec(&buf, "expand.yaml", x, r); err != nil {
+			t.Fatal(err)
+		}
+		want := "---\n# expand.yaml\npayload: QUESO " + dsl.Redacted + "\n"
+		if buf.String() != want {
+			t.Fatal(buf.String())
+		}
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		bad := strings.Replace(spec, "toUpperCase()", "toUpperCase(", 1)
+		if err = ioutil.WriteFile(filename, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err = i.Exec(dsl.NewCtx(nil))
+		ps, is := err.(*Problems)
+		if !is {
+			t.Fatalf("wanted Problems but got %#v", err)
+		}
+		if ps.First != dsl.CategoryJavascript {
+			t.Fatal(ps.First)
+		}
+	})
+}
@@ -0,0 +1,285 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+var (
+	// DefaultLatencyWindow is the default number of trailing
+	// runs in a latency baseline.
+	DefaultLatencyWindow = 10
+
+	// DefaultLatencyMinRuns is the default number of previous
+	// runs that a step needs before its latency is gated.
+	DefaultLatencyMinRuns = 3
+
+	// DefaultLatencyFloor is the default baseline below which a
+	// step's latency isn't gated (since small latencies are
+	// noisy).
+	DefaultLatencyFloor = 10 * time.Millisecond
+)
+
+// LatencyGate fails (or warns about) tests whose step latencies have
+// regressed beyond a percentage of their trailing baselines, which
+// are recorded in a LatencyDB.
+type LatencyGate struct {
+	// Filename is the LatencyDB's file, which is created if
+	// necessary.
+	Filename string
+
+	// Threshold is the percentage over the baseline that's a
+	// regression.  For example, 50 means that a step that takes
+	// more than 1.5 times its baseline has regressed.
+	Threshold float64
+
+	// Window is the number of trailing runs in a baseline, which
+	// is the median of their latencies.  Defaults to
+	// DefaultLatencyWindow.
+	Window int
+
+	// MinRuns is the number of previous runs that a step needs
+	// before its latency is gated.  Defaults to
+	// DefaultLatencyMinRuns.
+	MinRuns int
+
+	// Floor is the baseline below which a step's latency isn't
+	// gated.  Defaults to DefaultLatencyFloor.
+	Floor time.Duration
+
+	// Warn, when true, only reports regressions rather than
+	// failing the tests that have them.
+	Warn bool
+}
+
+func (g *LatencyGate) window() int {
+	if g.Window <= 0 {
+		return DefaultLatencyWindow
+	}
+	return g.Window
+}
+
+func (g *LatencyGate) minRuns() int {
+	if g.MinRuns <= 0 {
+		return DefaultLatencyMinRuns
+	}
+	return g.MinRuns
+}
+
+func (g *LatencyGate) floor() time.Duration {
+	if g.Floor <= 0 {
+		return DefaultLatencyFloor
+	}
+	return g.Floor
+}
+
+// LatencyDB is the history of step latencies for tests.
+type LatencyDB struct {
+	// Tests maps a test to its steps (see dsl.StepLatency.Key)
+	// to their latencies (in milliseconds) from recent runs
+	// (oldest first).
+	Tests map[string]map[string][]float64
+}
+
+// ReadLatencyDB reads a LatencyDB from the given file.  If the file
+// doesn't exist, the result is an empty LatencyDB.
+func ReadLatencyDB(filename string) (*LatencyDB, error) {
+	db := &LatencyDB{
+		Tests: make(map[string]map[string][]float64),
+	}
+	js, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(js, db); err != nil {
+		return nil, fmt.Errorf("latency DB %s: %w", filename, err)
+	}
+	if db.Tests == nil {
+		db.Tests = make(map[string]map[string][]float64)
+	}
+	return db, nil
+}
+
+// Write writes the LatencyDB to the given file.
+func (db *LatencyDB) Write(filename string) error {
+	js, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, js, 0644)
+}
+
+// stepLatencies returns the (maximum) latency in milliseconds for
+// each step.  A step that executed more than once (due to a Goto,
+// for example) gets its maximum latency.
+func stepLatencies(ls []dsl.StepLatency) map[string]float64 {
+	acc := make(map[string]float64, len(ls))
+	for _, l := range ls {
+		ms := float64(l.Latency) / float64(time.Millisecond)
+		if x, have := acc[l.Key()]; !have || x < ms {
+			acc[l.Key()] = ms
+		}
+	}
+	return acc
+}
+
+// Add records the latencies from a test's run and keeps the given
+// number of recent runs for each step.
+func (db *LatencyDB) Add(test string, ls []dsl.StepLatency, window int) {
+	steps, have := db.Tests[test]
+	if !have {
+		steps = make(map[string][]float64)
+		db.Tests[test] = steps
+	}
+	for key, ms := range stepLatencies(ls) {
+		xs := append(steps[key], ms)
+		if window < len(xs) {
+			xs = xs[len(xs)-window:]
+		}
+		steps[key] = xs
+	}
+}
+
+// LatencyRegression is a step latency that exceeded the threshold.
+type LatencyRegression struct {
+	Step     string
+	Latency  time.Duration
+	Baseline time.Duration
+}
+
+func (r LatencyRegression) String() string {
+	return fmt.Sprintf("step %s took %v (baseline %v, +%.0f%%)",
+		r.Step, r.Latency, r.Baseline,
+		100*(float64(r.Latency)/float64(r.Baseline)-1))
+}
+
+// median returns the median of the given numbers.
+func median(xs []float64) float64 {
+	ys := make([]float64, len(xs))
+	copy(ys, xs)
+	sort.Float64s(ys)
+	n := len(ys)
+	if n%2 == 1 {
+		return ys[n/2]
+	}
+	return (ys[n/2-1] + ys[n/2]) / 2
+}
+
+// Regressions returns the test's step latencies that exceed their
+// baselines by more than the LatencyGate's threshold.
+func (g *LatencyGate) Regressions(db *LatencyDB, test string, ls []dsl.StepLatency) []LatencyRegression {
+	var (
+		acc   []LatencyRegression
+		steps = db.Tests[test]
+		ms    = stepLatencies(ls)
+		keys  = make([]string, 0, len(ms))
+	)
+	for key := range ms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		xs := steps[key]
+		if len(xs) < g.minRuns() {
+			continue
+		}
+		if w := g.window(); w < len(xs) {
+			xs = xs[len(xs)-w:]
+		}
+		var (
+			baseline = time.Duration(median(xs) * float64(time.Millisecond))
+			latency  = time.Duration(ms[key] * float64(time.Millisecond))
+		)
+		if baseline < g.floor() {
+			continue
+		}
+		if float64(baseline)*(1+g.Threshold/100) < float64(latency) {
+			acc = append(acc, LatencyRegression{
+				Step:     key,
+				Latency:  latency,
+				Baseline: baseline,
+			})
+		}
+	}
+
+	return acc
+}
+
+// latencyKey identifies the test in a LatencyDB by the (unexpanded)
+// suite name and the filename relative to the working directory.
+func (inv *Invocation) latencyKey(filename string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, filename); err == nil {
+			filename = rel
+		}
+	}
+	if inv.SuiteName == "" {
+		return filename
+	}
+	return inv.SuiteName + ":" + filename
+}
+
+// gateLatencies checks the latencies of a test that passed and then
+// records them.  Regressions are failures (or, with Warn, test case
+// properties).
+func (inv *Invocation) gateLatencies(db *LatencyDB, problems *Problems, filename string, t *dsl.Test, tc *junit.TestCase) {
+	var (
+		g   = inv.Latency
+		key = inv.latencyKey(filename)
+	)
+
+	if regs := g.Regressions(db, key, t.Latencies); 0 < len(regs) {
+		msgs := make([]string, len(regs))
+		for i, r := range regs {
+			msgs[i] = r.String()
+			log.Printf("Test %s latency regression: %s", filename, msgs[i])
+		}
+		if g.Warn {
+			for _, msg := range msgs {
+				tc.Properties = append(tc.Properties, junit.Property{
+					Name:  "latency-regression",
+					Value: msg,
+				})
+			}
+		} else {
+			problems.Add(dsl.CategoryLatency)
+			tc.Failure = &junit.Failure{
+				Message: fmt.Sprintf("latency regression: %s", strings.Join(msgs, "; ")),
+				Type:    string(dsl.CategoryLatency),
+			}
+		}
+	}
+
+	db.Add(key, t.Latencies, g.window())
+}
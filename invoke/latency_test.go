@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func latencies(ms ...int) []dsl.StepLatency {
+	acc := make([]dsl.StepLatency, len(ms))
+	for i, n := range ms {
+		acc[i] = dsl.StepLatency{
+			Phase:   "phase1",
+			Step:    i,
+			Latency: time.Duration(n) * time.Millisecond,
+		}
+	}
+	return acc
+}
+
+func TestLatencyGate(t *testing.T) {
+	var (
+		db = &LatencyDB{
+			Tests: make(map[string]map[string][]float64),
+		}
+		g = &LatencyGate{
+			Threshold: 50,
+			Window:    4,
+		}
+	)
+
+	// Not enough history yet.
+	for i := 0; i < g.minRuns(); i++ {
+		if regs := g.Regressions(db, "test", latencies(100, 1000)); 0 < len(regs) {
+			t.Fatal(regs)
+		}
+		db.Add("test", latencies(100, 1), g.window())
+	}
+
+	if regs := g.Regressions(db, "test", latencies(140, 1)); 0 < len(regs) {
+		t.Fatal(regs)
+	}
+
+	// The second step's baseline is below the floor.
+	regs := g.Regressions(db, "test", latencies(160, 1000))
+	if len(regs) != 1 {
+		t.Fatal(regs)
+	}
+	if r := regs[0]; r.Step != "phase1/0" || r.Baseline != 100*time.Millisecond {
+		t.Fatal(r)
+	}
+
+	// The window trims old runs.
+	for i := 0; i < 10; i++ {
+		db.Add("test", latencies(200), g.window())
+	}
+	if n := len(db.Tests["test"]["phase1/0"]); n != g.window() {
+		t.Fatal(n)
+	}
+	if regs := g.Regressions(db, "test", latencies(250)); 0 < len(regs) {
+		t.Fatal(regs)
+	}
+}
+
+func TestLatencyDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "latency.json")
+
+	db, err := ReadLatencyDB(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Add("test", latencies(10, 20), 3)
+	db.Add("test", latencies(30, 40), 3)
+	if err := db.Write(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = ReadLatencyDB(filename); err != nil {
+		t.Fatal(err)
+	}
+	if xs := db.Tests["test"]["phase1/1"]; len(xs) != 2 || xs[1] != 40 {
+		t.Fatal(xs)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	if x := median([]float64{3, 1, 2}); x != 2 {
+		t.Fatal(x)
+	}
+	if x := median([]float64{4, 1, 2, 3}); x != 2.5 {
+		t.Fatal(x)
+	}
+}
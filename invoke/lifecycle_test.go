@@ -0,0 +1,71 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestRunOnceFinalizes(t *testing.T) {
+	ctx := dsl.NewCtx(nil)
+
+	test := dsl.NewTest(ctx, "a", &dsl.Spec{
+		Phases: map[string]*dsl.Phase{
+			"phase1": {
+				Steps: []*dsl.Step{
+					{
+						MakeChan: &dsl.MakeChan{
+							Name: "c",
+							Type: "mock",
+						},
+					},
+					{
+						Recv: &dsl.Recv{
+							Chan:    "c",
+							Timeout: 10 * time.Millisecond,
+						},
+					},
+				},
+			},
+		},
+	})
+
+	inv := &Invocation{
+		FailOnLeaks: true,
+	}
+
+	// The Recv times out, so the test doesn't Close its channels.
+	if err := inv.RunOnce(ctx, test); dsl.CategoryOf(err) != dsl.CategoryTimeout {
+		t.Fatal(err)
+	}
+	if test.Chans != nil || 0 < len(test.Leaks) {
+		t.Fatal(test.Chans, test.Leaks)
+	}
+
+	// Since RunOnce forgot the channels, a retry can make them
+	// again.
+	if err := inv.RunOnce(ctx, test); dsl.CategoryOf(err) != dsl.CategoryTimeout {
+		t.Fatal(err)
+	}
+	if !test.FailOnLeaks {
+		t.Fatal("FailOnLeaks")
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Comcast/plax/dsl"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lint checks the test's source against the JSON Schema for tests
+// (see dsl.CheckTestSchema), which finds typos like 'paylod' that
+// parsing ignores, and then validates the test (see
+// dsl.Test.Validate).  Problems are printed.  For a DryRun without
+// problems, the test's effective spec is printed instead.
+//
+// Returns true if there were any problems.
+func (inv *Invocation) lint(ctx *dsl.Ctx, filename string, t *dsl.Test) bool {
+	for p, v := range inv.Bindings {
+		t.Bindings[p] = v
+	}
+
+	var errs []error
+
+	src, err := inv.source(ctx, filename)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, dsl.CheckTestSchema(src)...)
+	}
+
+	if err := t.Init(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, t.Validate(ctx)...)
+	}
+
+	if 0 < len(errs) {
+		for _, err := range errs {
+			fmt.Printf("%s: %s\n", filename, err)
+		}
+		return true
+	}
+
+	if !inv.DryRun {
+		fmt.Printf("%s: ok\n", filename)
+		return false
+	}
+
+	x, err := t.Bindings.Expand(ctx, src, false)
+	if err == nil {
+		err = writeSpec(os.Stdout, filename, x, nil)
+	}
+	if err != nil {
+		fmt.Printf("%s: %s\n", filename, err)
+		return true
+	}
+	return false
+}
+
+// expand writes the test's fully substituted spec (see Expand).
+func (inv *Invocation) expand(ctx *dsl.Ctx, filename string, t *dsl.Test) error {
+	for p, v := range inv.Bindings {
+		t.Bindings[p] = v
+	}
+
+	if err := t.Init(ctx); err != nil {
+		return err
+	}
+
+	if err := t.Spec.CheckParams(ctx, t.Bindings); err != nil {
+		return err
+	}
+
+	src, err := inv.source(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	x, err := t.Bindings.Expand(ctx, src, true)
+	if err != nil {
+		return err
+	}
+
+	var r *dsl.Redactor
+	if inv.Redact {
+		r = ctx.Redactor
+		r.AddBindings(t.Bindings)
+	}
+
+	return writeSpec(os.Stdout, filename, x, r)
+}
+
+// writeSpec writes the given spec as a YAML document (preceded by a
+// comment with the filename).  A non-nil Redactor redacts secrets.
+func writeSpec(w io.Writer, filename string, x interface{}, r *dsl.Redactor) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(x); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "---\n# %s\n%s", filename, r.Redact(buf.String()))
+	return err
+}
+
+// source returns the test's parsed YAML after processing includes.
+func (inv *Invocation) source(ctx *dsl.Ctx, filename string) (interface{}, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if bs, err = inv.include(ctx, bs); err != nil {
+		return nil, err
+	}
+	var x interface{}
+	if err = yaml.Unmarshal(bs, &x); err != nil {
+		return nil, dsl.Categorize(dsl.CategorySchema, dsl.Brokenf("spec parse: %w", err))
+	}
+	return x, nil
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+const (
+	// LogProperty is the name of the JUnit property that gives
+	// the filename of a test case's log.  See Invocation.LogDir.
+	LogProperty = "log"
+
+	// LogIndex is the name of the file (in Invocation.LogDir)
+	// that has a JSON line (a LogIndexEntry) for each test's log.
+	LogIndex = "index.jsonl"
+)
+
+// LogIndexEntry describes one test's log in the LogIndex.
+type LogIndexEntry struct {
+	Suite    string        `json:"suite"`
+	Test     string        `json:"test"`
+	File     string        `json:"file"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Result   string        `json:"result"`
+}
+
+// testLog is a test's own log file.
+type testLog struct {
+	f     *os.File
+	name  string
+	start time.Time
+}
+
+// openTestLog creates the log file for the test (named by the
+// test's filename and the time) and returns a copy of the Ctx that
+// logs to that file.
+func (inv *Invocation) openTestLog(ctx *dsl.Ctx, filename string) (*dsl.Ctx, *testLog, error) {
+	if err := os.MkdirAll(inv.LogDir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		now  = time.Now().UTC()
+		base = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		name = unsafeFilenameChars.ReplaceAllString(base, "_") + "-" +
+			now.Format("20060102T150405.000000000Z") + ".log"
+	)
+
+	f, err := os.Create(filepath.Join(inv.LogDir, name))
+	if err != nil {
+		return nil, nil, err
+	}
+	l, err := dsl.NewLogger(f, inv.LogFormat)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	c := *ctx
+	c.Logger = l
+
+	return &c, &testLog{
+		f:     f,
+		name:  name,
+		start: now,
+	}, nil
+}
+
+// closeTestLog closes the test's log, adds a LogProperty to the
+// test case, and appends an entry to the LogIndex.
+func (inv *Invocation) closeTestLog(tl *testLog, t *dsl.Test, tc *junit.TestCase) error {
+	tl.f.Close()
+
+	tc.Properties = append(tc.Properties, junit.Property{
+		Name:  LogProperty,
+		Value: filepath.Join(inv.LogDir, tl.name),
+	})
+
+	e := LogIndexEntry{
+		Suite:    inv.SuiteName,
+		Test:     t.Id,
+		File:     tl.name,
+		Start:    tl.start,
+		Duration: time.Now().Sub(tl.start),
+		Result:   testResult(tc),
+	}
+	js, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+
+	// Each entry is one write to a file opened for appending,
+	// so concurrent invocations (like plaxrun's groups) can share
+	// a LogDir.
+	f, err := os.OpenFile(filepath.Join(inv.LogDir, LogIndex), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(js, '\n'))
+	return err
+}
+
+// testResult returns "passed", "failed", "error", or "skipped".
+func testResult(tc *junit.TestCase) string {
+	switch {
+	case tc.Error != nil:
+		return "error"
+	case tc.Failure != nil:
+		return "failed"
+	case tc.Skipped != nil:
+		return "skipped"
+	default:
+		return "passed"
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestInvocationLogDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	i := &Invocation{
+		SuiteName: "test:logs",
+		Filename:  "../demos/mock.yaml",
+		LogDir:    dir,
+		LogFormat: "json",
+	}
+	if err = i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, LogIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e LogIndexEntry
+	if err = json.Unmarshal(bs, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Suite != "test:logs" || e.Result != "passed" || !strings.HasPrefix(e.File, "mock-") {
+		t.Fatal(string(bs))
+	}
+
+	if bs, err = ioutil.ReadFile(filepath.Join(dir, e.File)); err != nil {
+		t.Fatal(err)
+	}
+	line := strings.SplitN(string(bs), "\n", 2)[0]
+	var r dsl.LogRecord
+	if err = json.Unmarshal([]byte(line), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Msg != "InitChans" {
+		t.Fatal(line)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+const (
+	// NameProperty is the name of the JUnit property that gives
+	// a test case's name from its Spec's Metadata.  See
+	// dsl.Metadata.Name.
+	NameProperty = "name"
+
+	// TicketProperty is the name of the JUnit property that
+	// links a test case to a ticket.  See dsl.Metadata.Tickets.
+	TicketProperty = "ticket"
+)
+
+// metadata returns the test's Metadata name (when it has one) and
+// tickets as JUnit properties.
+func metadata(t *dsl.Test) []junit.Property {
+	var ps []junit.Property
+	if name := t.Name(); name != t.Id {
+		ps = append(ps, junit.Property{
+			Name:  NameProperty,
+			Value: name,
+		})
+	}
+	for _, ticket := range t.Tickets() {
+		ps = append(ps, junit.Property{
+			Name:  TicketProperty,
+			Value: ticket,
+		})
+	}
+	return ps
+}
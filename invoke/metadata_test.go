@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestMetadata(t *testing.T) {
+	inv := &Invocation{
+		Dir: "../demos",
+	}
+	ctx := dsl.NewCtx(nil)
+	test, err := inv.Load(ctx, "../demos/metadata.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if test.Name() != "Order shipping" || test.Priority != 1 {
+		t.Fatal(test.Name(), test.Priority)
+	}
+	if !dsl.LabelsMatch(test.Labels, []string{"selftest", "orders"}) {
+		t.Fatal(test.Labels)
+	}
+	if len(test.Owners) != 1 || test.Owners[0] != "fulfillment" {
+		t.Fatal(test.Owners)
+	}
+	if !test.Wanted(ctx, 1, []string{"orders"}) || test.Wanted(ctx, 0, nil) {
+		t.Fatal("Wanted")
+	}
+
+	ps := metadata(test)
+	if len(ps) != 2 {
+		t.Fatal(ps)
+	}
+	if ps[0].Name != NameProperty || ps[0].Value != "Order shipping" {
+		t.Fatal(ps[0])
+	}
+	if ps[1].Name != TicketProperty || ps[1].Value != "PLAX-42" {
+		t.Fatal(ps[1])
+	}
+
+	data := inv.testEventData("suite", "metadata.yaml", test, nil, 0)
+	if data.Name != "Order shipping" || len(data.Tickets) != 1 {
+		t.Fatal(data)
+	}
+
+	if ps := metadata(&dsl.Test{Id: "plain"}); len(ps) != 0 {
+		t.Fatal(ps)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+const (
+	// OwnerProperty is the name of the JUnit property that names
+	// an owner of a test case.  See dsl.Test.Owners.
+	OwnerProperty = "owner"
+
+	// Unowned is the owner of test cases that don't have any
+	// owners.
+	Unowned = "unowned"
+)
+
+// OwnerFailure is a failure (or error) of a test case as reported to
+// the test's owners.
+type OwnerFailure struct {
+	Test     string       `json:"test"`
+	Category dsl.Category `json:"category"`
+	Message  string       `json:"message"`
+}
+
+// OwnerNotification is the notification payload for one owner's
+// failures in a suite.
+//
+// Text is a one-line summary, which is convenient for chat webhooks.
+type OwnerNotification struct {
+	Owner    string         `json:"owner"`
+	Suite    string         `json:"suite"`
+	Time     time.Time      `json:"time"`
+	Text     string         `json:"text"`
+	Failures []OwnerFailure `json:"failures"`
+}
+
+// owners returns the owners of the test (or, if the test doesn't
+// have any, the Invocation's Owners) as JUnit properties.
+func (inv *Invocation) owners(t *dsl.Test) []junit.Property {
+	owners := inv.Owners
+	if t != nil && 0 < len(t.Owners) {
+		owners = t.Owners
+	}
+	ps := make([]junit.Property, 0, len(owners))
+	for _, owner := range owners {
+		ps = append(ps, junit.Property{
+			Name:  OwnerProperty,
+			Value: owner,
+		})
+	}
+	return ps
+}
+
+// OwnersOf returns the owners of the test case, which defaults to
+// just Unowned.
+func OwnersOf(tc junit.TestCase) []string {
+	var owners []string
+	for _, p := range tc.Properties {
+		if p.Name == OwnerProperty {
+			owners = append(owners, p.Value)
+		}
+	}
+	if len(owners) == 0 {
+		owners = []string{Unowned}
+	}
+	return owners
+}
+
+// FailuresByOwner groups the failures and errors in the test suite
+// by owner.  A test case with more than one owner is reported to
+// each of them.
+func FailuresByOwner(ts *junit.TestSuite) map[string][]OwnerFailure {
+	acc := make(map[string][]OwnerFailure)
+	for _, tc := range ts.TestCases {
+		f := OwnerFailure{
+			Test: tc.Name,
+		}
+		switch {
+		case tc.Error != nil:
+			if f.Category = dsl.Category(tc.Error.Type); f.Category == "" {
+				f.Category = dsl.CategoryBroken
+			}
+			f.Message = tc.Error.Message
+		case tc.Failure != nil:
+			if f.Category = dsl.Category(tc.Failure.Type); f.Category == "" {
+				f.Category = dsl.CategoryFailure
+			}
+			f.Message = tc.Failure.Message
+		default:
+			continue
+		}
+		for _, owner := range OwnersOf(tc) {
+			acc[owner] = append(acc[owner], f)
+		}
+	}
+	return acc
+}
+
+// OwnerNotifications returns a notification for each owner with
+// failures in the test suite.  The notifications are sorted by
+// owner.
+func OwnerNotifications(ts *junit.TestSuite) []*OwnerNotification {
+	var (
+		byOwner = FailuresByOwner(ts)
+		acc     = make([]*OwnerNotification, 0, len(byOwner))
+		now     = time.Now().UTC()
+	)
+	for owner, fs := range byOwner {
+		tests := make([]string, len(fs))
+		for i, f := range fs {
+			tests[i] = f.Test
+		}
+		acc = append(acc, &OwnerNotification{
+			Owner: owner,
+			Suite: ts.Name,
+			Time:  now,
+			Text: fmt.Sprintf("%s: %d failure(s) for %s: %s",
+				ts.Name, len(fs), owner, strings.Join(tests, ", ")),
+			Failures: fs,
+		})
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		return acc[i].Owner < acc[j].Owner
+	})
+	return acc
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// WriteOwnerNotifications writes each notification as JSON to the
+// file OWNER.json in the given directory, which is created if
+// necessary.  Characters in the owner that aren't safe in a filename
+// are replaced by '_'.
+func WriteOwnerNotifications(dir string, ns []*OwnerNotification) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, n := range ns {
+		js, err := json.MarshalIndent(n, "", "  ")
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(dir, unsafeFilenameChars.ReplaceAllString(n.Owner, "_")+".json")
+		if err = ioutil.WriteFile(filename, js, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
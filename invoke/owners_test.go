@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+func TestOwners(t *testing.T) {
+	owned := func(tc junit.TestCase, owners ...string) junit.TestCase {
+		for _, owner := range owners {
+			tc.Properties = append(tc.Properties, junit.Property{Name: OwnerProperty, Value: owner})
+		}
+		return tc
+	}
+
+	ts := junit.NewTestSuite()
+	ts.Name = "nightly"
+	ts.Add(owned(junit.TestCase{Name: "a"}, "team-a"))
+	ts.Add(owned(junit.TestCase{Name: "b", Failure: &junit.Failure{Message: "nope", Type: "timeout"}}, "team-a", "team/b"))
+	ts.Add(owned(junit.TestCase{Name: "c", Error: &junit.Error{Message: "broken"}}, "team/b"))
+	ts.Add(junit.TestCase{Name: "d", Failure: &junit.Failure{Message: "who knows"}})
+
+	// Owners survive both report formats.
+	for _, emitJSON := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteReport(&buf, ts, nil, emitJSON); err != nil {
+			t.Fatal(err)
+		}
+		tss, err := ReadReports(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		byOwner := FailuresByOwner(tss[0])
+		if len(byOwner) != 3 {
+			t.Fatalf("json %v: %#v", emitJSON, byOwner)
+		}
+		if fs := byOwner["team-a"]; len(fs) != 1 || fs[0].Test != "b" || fs[0].Category != dsl.CategoryTimeout {
+			t.Fatalf("json %v: %#v", emitJSON, fs)
+		}
+		if fs := byOwner["team/b"]; len(fs) != 2 || fs[1].Category != dsl.CategoryBroken {
+			t.Fatalf("json %v: %#v", emitJSON, fs)
+		}
+		if fs := byOwner[Unowned]; len(fs) != 1 || fs[0].Category != dsl.CategoryFailure {
+			t.Fatalf("json %v: %#v", emitJSON, fs)
+		}
+	}
+
+	ns := OwnerNotifications(ts)
+	if len(ns) != 3 || ns[0].Owner != "team-a" || ns[2].Owner != Unowned {
+		t.Fatal(dsl.JSON(ns))
+	}
+	if ns[1].Text != "nightly: 2 failure(s) for team/b: b, c" {
+		t.Fatal(ns[1].Text)
+	}
+
+	dir, err := ioutil.TempDir("", "plax-owners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = WriteOwnerNotifications(filepath.Join(dir, "notify"), ns); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "notify", "team_b.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n OwnerNotification
+	if err = json.Unmarshal(bs, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Owner != "team/b" || len(n.Failures) != 2 || !strings.HasPrefix(n.Text, "nightly:") {
+		t.Fatal(string(bs))
+	}
+}
+
+func TestInvocationOwners(t *testing.T) {
+	inv := &Invocation{
+		Owners: []string{"default"},
+	}
+	if ps := inv.owners(&dsl.Test{}); len(ps) != 1 || ps[0].Value != "default" {
+		t.Fatal(ps)
+	}
+	if ps := inv.owners(&dsl.Test{Owners: []string{"x", "y"}}); len(ps) != 2 || ps[1].Value != "y" {
+		t.Fatal(ps)
+	}
+}
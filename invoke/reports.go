@@ -0,0 +1,186 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+// WriteReport writes the test suite as JUnit XML or, if emitJSON, as
+// a JSON array whose first element is a JSONTestSuite and whose
+// remaining elements are the test cases.
+func WriteReport(w io.Writer, ts *junit.TestSuite, categories map[dsl.Category]int, emitJSON bool) error {
+	if !emitJSON {
+		bs, err := xml.MarshalIndent(ts, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", bs)
+		return err
+	}
+
+	// We'll emit some JSON that represents an array of
+	// objects suitable of indexing
+	acc := make([]interface{}, 0, len(ts.TestCases)+1)
+
+	// Our first "doc" represents the suite of tests we
+	// just range.
+	jts := JSONTestSuite{
+		Time:       ts.Time,
+		Tests:      len(ts.TestCases),
+		Errors:     ts.Errors,
+		Failed:     ts.Failures,
+		Skipped:    ts.Skipped,
+		Type:       "suite",
+		Categories: categories,
+	}
+	jts.Passed = jts.Tests - jts.Errors - jts.Failed - jts.Skipped
+
+	acc = append(acc, jts)
+
+	// The remaining "docs" are the test cases themselves.
+	for i, tc := range ts.TestCases {
+		tc.N = i
+		tc.Suite = ts.Name
+		tc.Type = "case"
+		acc = append(acc, tc)
+	}
+
+	js, err := json.Marshal(&acc)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", js)
+	return err
+}
+
+// ReadReports reads the test suites in a report that WriteReport (or
+// a sequence of WriteReport calls) wrote.  The format (JSON or JUnit
+// XML) is detected from the first non-space character.
+func ReadReports(r io.Reader) ([]*junit.TestSuite, error) {
+	in := bufio.NewReader(r)
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.IndexByte([]byte(" \t\r\n"), b) < 0 {
+			if err = in.UnreadByte(); err != nil {
+				return nil, err
+			}
+			if b == '[' {
+				return readJSONReports(in)
+			}
+			return readXMLReports(in)
+		}
+	}
+}
+
+func readJSONReports(r io.Reader) ([]*junit.TestSuite, error) {
+	var (
+		acc []*junit.TestSuite
+		dec = json.NewDecoder(r)
+	)
+	for {
+		var docs []json.RawMessage
+		if err := dec.Decode(&docs); err == io.EOF {
+			return acc, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		ts := junit.NewTestSuite()
+		for _, doc := range docs {
+			var kind struct {
+				Type string
+			}
+			if err := json.Unmarshal(doc, &kind); err != nil {
+				return nil, err
+			}
+			switch kind.Type {
+			case "suite":
+				var jts JSONTestSuite
+				if err := json.Unmarshal(doc, &jts); err != nil {
+					return nil, err
+				}
+				ts.Time = jts.Time
+			case "case":
+				var tc junit.TestCase
+				if err := json.Unmarshal(doc, &tc); err != nil {
+					return nil, err
+				}
+				ts.Name = tc.Suite
+				ts.Add(tc)
+			default:
+				return nil, fmt.Errorf("unknown report doc Type '%s'", kind.Type)
+			}
+		}
+		acc = append(acc, ts)
+	}
+}
+
+func readXMLReports(r io.Reader) ([]*junit.TestSuite, error) {
+	var (
+		acc []*junit.TestSuite
+		dec = xml.NewDecoder(r)
+	)
+	for {
+		var ts junit.TestSuite
+		if err := dec.Decode(&ts); err == io.EOF {
+			return acc, nil
+		} else if err != nil {
+			return nil, err
+		}
+		acc = append(acc, &ts)
+	}
+}
+
+// ProblemsOf returns the Problems, by category, of the failures and
+// errors in the test suite.  A failure (or error) without a Type is
+// a CategoryFailure (or CategoryBroken).
+func ProblemsOf(ts *junit.TestSuite) *Problems {
+	ps := &Problems{}
+	for _, tc := range ts.TestCases {
+		var c dsl.Category
+		switch {
+		case tc.Error != nil:
+			if c = dsl.Category(tc.Error.Type); c == "" {
+				c = dsl.CategoryBroken
+			}
+		case tc.Failure != nil:
+			if c = dsl.Category(tc.Failure.Type); c == "" {
+				c = dsl.CategoryFailure
+			}
+		default:
+			continue
+		}
+		ps.Add(c)
+	}
+	return ps
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package invoke
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+	"github.com/Comcast/plax/junit"
+)
+
+func TestReports(t *testing.T) {
+	ts := junit.NewTestSuite()
+	ts.Name = "shard"
+	ts.Add(junit.TestCase{Name: "a"})
+	ts.Add(junit.TestCase{Name: "b", Failure: &junit.Failure{Message: "nope", Type: "timeout"}})
+	ts.Add(junit.TestCase{Name: "c", Error: &junit.Error{Message: "broken"}})
+
+	for _, emitJSON := range []bool{false, true} {
+		// Two reports in one stream.
+		var buf bytes.Buffer
+		for i := 0; i < 2; i++ {
+			if err := WriteReport(&buf, ts, nil, emitJSON); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tss, err := ReadReports(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tss) != 2 {
+			t.Fatalf("json %v: %d suites", emitJSON, len(tss))
+		}
+		got := tss[1]
+		if got.Name != "shard" || got.Tests != 3 || got.Failures != 1 || got.Errors != 1 {
+			t.Fatalf("json %v: %#v", emitJSON, got)
+		}
+
+		ps := ProblemsOf(got)
+		if ps.First != dsl.CategoryTimeout || ps.Categories[dsl.CategoryBroken] != 1 {
+			t.Fatalf("json %v: %#v", emitJSON, ps)
+		}
+	}
+
+	if tss, err := ReadReports(bytes.NewBufferString("  \n")); err != nil || tss != nil {
+		t.Fatal(tss, err)
+	}
+	if _, err := ReadReports(bytes.NewBufferString(`[{"Type":"other"}]`)); err == nil {
+		t.Fatal("should have complained")
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// DefaultSoakInterval is the default time between a Soak's interim
+// reports.
+var DefaultSoakInterval = time.Minute
+
+// Soak runs tests repeatedly, for a duration or until the context is
+// canceled, and periodically writes SoakReports.  The intention is
+// overnight stability testing.
+type Soak struct {
+	// Duration limits the soak.  Zero means that the soak runs
+	// until the context is canceled (by an interrupt, for
+	// example).
+	Duration time.Duration
+
+	// Interval is the time between interim reports.  Defaults to
+	// DefaultSoakInterval.
+	Interval time.Duration
+
+	// Out receives the reports as lines of JSON.  Defaults to
+	// stdout.
+	Out io.Writer
+}
+
+// SoakReport is an interim (Type "soak") or final (Type
+// "soak-final") report from a Soak.
+//
+// Counts are cumulative, but latencies are only for the runs since
+// the previous report, so that drift over time is visible.
+type SoakReport struct {
+	Type       string
+	Time       time.Time
+	Elapsed    float64 // Seconds
+	Iterations int
+	Runs       int
+	SoakCounts
+	Tests map[string]*SoakCounts
+
+	// Latency summarizes the durations of test runs.
+	Latency Percentiles
+
+	// StepLatency summarizes the durations of steps.  See
+	// dsl.StepLatency.
+	StepLatency Percentiles
+
+	Memory SoakMemory
+}
+
+// SoakCounts are the outcomes of test runs.
+type SoakCounts struct {
+	Passed  int
+	Failed  int
+	Errors  int
+	Skipped int
+}
+
+// Percentiles summarizes a sample of durations (in milliseconds).
+type Percentiles struct {
+	N   int
+	P50 float64
+	P90 float64
+	P99 float64
+	Max float64
+}
+
+// SoakMemory reports the process's memory use (see runtime.MemStats)
+// and its number of goroutines.
+type SoakMemory struct {
+	HeapAlloc  uint64
+	Sys        uint64
+	NumGC      uint32
+	Goroutines int
+}
+
+// NewPercentiles summarizes the given samples, which it sorts.
+func NewPercentiles(xs []float64) Percentiles {
+	n := len(xs)
+	if n == 0 {
+		return Percentiles{}
+	}
+	sort.Float64s(xs)
+	rank := func(p float64) float64 {
+		// Nearest-rank method.
+		return xs[int(math.Ceil(p*float64(n)))-1]
+	}
+	return Percentiles{
+		N:   n,
+		P50: rank(0.50),
+		P90: rank(0.90),
+		P99: rank(0.99),
+		Max: xs[n-1],
+	}
+}
+
+// soakStats accumulates a Soak's results.
+type soakStats struct {
+	SoakReport
+
+	// Samples (in milliseconds) since the last report.
+	latencies, stepLatencies []float64
+}
+
+func (s *soakStats) add(filename string, t *dsl.Test, err error, elapsed time.Duration) dsl.Category {
+	tc, have := s.Tests[filename]
+	if !have {
+		tc = &SoakCounts{}
+		s.Tests[filename] = tc
+	}
+	s.Runs++
+
+	c, broken := soakOutcome(t, err)
+	switch {
+	case broken:
+		s.Errors++
+		tc.Errors++
+		return c
+	case c != "":
+		s.Failed++
+		tc.Failed++
+		return c
+	}
+	if skipped, _ := t.IsSkipped(); skipped {
+		s.Skipped++
+		tc.Skipped++
+		return ""
+	}
+	s.Passed++
+	tc.Passed++
+
+	s.latencies = append(s.latencies, ms(elapsed))
+	for _, l := range t.Latencies {
+		s.stepLatencies = append(s.stepLatencies, ms(l.Latency))
+	}
+
+	return ""
+}
+
+// soakOutcome returns the category of the test run's problem (if
+// any), taking Negative tests into account, and whether the test
+// was broken.
+func soakOutcome(t *dsl.Test, err error) (dsl.Category, bool) {
+	if err == nil {
+		if t.Negative {
+			return dsl.CategoryFailure, false
+		}
+		return "", false
+	}
+	if _, is := dsl.IsBroken(err); is {
+		return dsl.CategoryOf(err), true
+	}
+	if t.Negative {
+		return "", false
+	}
+	return dsl.CategoryOf(err), false
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// report writes a SoakReport and resets the latency samples.
+func (s *soakStats) report(w io.Writer, typ string, start time.Time) error {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	r := s.SoakReport
+	r.Type = typ
+	r.Time = time.Now().UTC()
+	r.Elapsed = time.Since(start).Seconds()
+	r.Latency = NewPercentiles(s.latencies)
+	r.StepLatency = NewPercentiles(s.stepLatencies)
+	r.Memory = SoakMemory{
+		HeapAlloc:  m.HeapAlloc,
+		Sys:        m.Sys,
+		NumGC:      m.NumGC,
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	s.latencies = s.latencies[:0]
+	s.stepLatencies = s.stepLatencies[:0]
+
+	js, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", js)
+	return err
+}
+
+// soak runs the tests in the given files repeatedly.  See Soak.
+func (inv *Invocation) soak(ctx *dsl.Ctx, filenames []string) error {
+	var (
+		out      = inv.Soak.Out
+		interval = inv.Soak.Interval
+		start    = time.Now()
+		problems = &Problems{}
+		stats    = &soakStats{
+			SoakReport: SoakReport{
+				Tests: make(map[string]*SoakCounts),
+			},
+		}
+	)
+
+	if out == nil {
+		out = os.Stdout
+	}
+	if interval <= 0 {
+		interval = DefaultSoakInterval
+	}
+	next := start.Add(interval)
+
+	done := func() bool {
+		if ctx.Err() != nil {
+			return true
+		}
+		return 0 < inv.Soak.Duration && inv.Soak.Duration <= time.Since(start)
+	}
+
+	log.Printf("Soaking %d test file(s)", len(filenames))
+
+	for !done() {
+		ran := false
+		for _, filename := range filenames {
+			if done() {
+				break
+			}
+
+			t, err := inv.Load(ctx, filename)
+			if err != nil {
+				return err
+			}
+			if !t.Wanted(ctx, inv.Priority, strings.Split(inv.Labels, ",")) {
+				continue
+			}
+			ran = true
+
+			then := time.Now()
+			err = inv.RunInstances(ctx, filename, t)
+			if ctx.Err() != nil {
+				// Interrupted, so this run doesn't count.
+				break
+			}
+			if c := stats.add(filename, t, err, time.Since(then)); c != "" {
+				problems.Add(c)
+				msg := "expected error for Negative test"
+				if err != nil {
+					msg = ctx.Redactor.Redact(err.Error())
+				}
+				log.Printf("Test %s failed (%s): %s", filename, c, msg)
+			}
+
+			if now := time.Now(); !now.Before(next) {
+				if err := stats.report(out, "soak", start); err != nil {
+					return err
+				}
+				next = now.Add(interval)
+			}
+		}
+		if !ran {
+			return fmt.Errorf("no tests to soak")
+		}
+		stats.Iterations++
+	}
+
+	if err := stats.report(out, "soak-final", start); err != nil {
+		return err
+	}
+
+	if inv.NonzeroOnAnyError && problems.First != "" {
+		return problems
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestSoak(t *testing.T) {
+	var buf bytes.Buffer
+	i := &Invocation{
+		SuiteName: "test:soak",
+		Filename:  "../demos/mock.yaml",
+		Soak: &Soak{
+			Duration: 300 * time.Millisecond,
+			Interval: 100 * time.Millisecond,
+			Out:      &buf,
+		},
+	}
+
+	if err := i.Exec(dsl.NewCtx(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var rs []SoakReport
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		var r SoakReport
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	if len(rs) < 2 {
+		t.Fatalf("wanted interim reports: %#v", rs)
+	}
+
+	if rs[0].Type != "soak" {
+		t.Fatal(rs[0].Type)
+	}
+	final := rs[len(rs)-1]
+	if final.Type != "soak-final" {
+		t.Fatal(final.Type)
+	}
+	if final.Passed == 0 || final.Failed != 0 || final.Errors != 0 {
+		t.Fatalf("%#v", final.SoakCounts)
+	}
+	if final.Passed != final.Runs {
+		t.Fatal(final.Runs)
+	}
+	if final.Memory.HeapAlloc == 0 {
+		t.Fatal(final.Memory)
+	}
+
+	// Latencies are only for the runs since the previous report.
+	n := 0
+	for _, r := range rs {
+		n += r.Latency.N
+	}
+	if n != final.Passed {
+		t.Fatal(n)
+	}
+}
+
+func TestSoakCanceled(t *testing.T) {
+	var buf bytes.Buffer
+	i := &Invocation{
+		SuiteName: "test:soak",
+		Filename:  "../demos/mock.yaml",
+		Soak: &Soak{
+			Out: &buf,
+		},
+	}
+
+	ctx, cancel := dsl.NewCtx(nil).WithCancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if err := i.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var r SoakReport
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Type != "soak-final" || r.Passed == 0 {
+		t.Fatalf("%#v", r)
+	}
+}
+
+func TestNewPercentiles(t *testing.T) {
+	xs := make([]float64, 0, 100)
+	for i := 100; 0 < i; i-- {
+		xs = append(xs, float64(i))
+	}
+	p := NewPercentiles(xs)
+	if p.N != 100 || p.P50 != 50 || p.P90 != 90 || p.P99 != 99 || p.Max != 100 {
+		t.Fatalf("%#v", p)
+	}
+
+	if p = NewPercentiles(nil); p.N != 0 {
+		t.Fatalf("%#v", p)
+	}
+}
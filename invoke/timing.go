@@ -0,0 +1,315 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	// DefaultTimingWindow is the default number of recent runs
+	// that a TimingDB keeps for each test.
+	DefaultTimingWindow = 50
+
+	// DefaultTimingMinRuns is the default number of previous
+	// (passing) runs that a test needs before a TimingReport
+	// considers its duration for a regression.
+	DefaultTimingMinRuns = 3
+
+	// DefaultTimingFloor is the default baseline below which a
+	// test's duration isn't considered for a regression.
+	DefaultTimingFloor = 100 * time.Millisecond
+)
+
+// TimingRun is one run of a test in a TimingDB.
+type TimingRun struct {
+	Time time.Time
+
+	// Duration is in seconds.
+	Duration float64
+
+	// Result is "passed", "failed", "error", or "skipped".
+	Result string
+}
+
+// TimingDB is the history of tests' durations and results across
+// runs, which a TimingReport summarizes.
+type TimingDB struct {
+	// Tests maps a test to its recent runs (oldest first).
+	Tests map[string][]TimingRun
+}
+
+// ReadTimingDB reads a TimingDB from the given file.  If the file
+// doesn't exist, the result is an empty TimingDB.
+func ReadTimingDB(filename string) (*TimingDB, error) {
+	db := &TimingDB{
+		Tests: make(map[string][]TimingRun),
+	}
+	js, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(js, db); err != nil {
+		return nil, fmt.Errorf("timing DB %s: %w", filename, err)
+	}
+	if db.Tests == nil {
+		db.Tests = make(map[string][]TimingRun)
+	}
+	return db, nil
+}
+
+// Write writes the TimingDB to the given file.  The file is replaced
+// (rather than rewritten), so a reader never sees a partial DB.
+func (db *TimingDB) Write(filename string) error {
+	js, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".timing-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(js); err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Add records a test's run and keeps the given number of recent runs
+// for the test.
+func (db *TimingDB) Add(test string, r TimingRun, window int) {
+	if window <= 0 {
+		window = DefaultTimingWindow
+	}
+	rs := append(db.Tests[test], r)
+	if window < len(rs) {
+		rs = rs[len(rs)-window:]
+	}
+	db.Tests[test] = rs
+}
+
+// TimingReport summarizes a TimingDB.
+type TimingReport struct {
+	// Slowest are the tests with the longest median durations
+	// (longest first).
+	Slowest []TimingSummary `json:"slowest"`
+
+	// Regressions are the tests whose most recent (passing)
+	// durations exceeded their baselines by more than the
+	// threshold (worst first).
+	Regressions []TimingSummary `json:"regressions"`
+
+	// Flaky are the tests that both passed and failed (most
+	// flips first).
+	Flaky []TimingSummary `json:"flaky"`
+}
+
+// TimingSummary is a test's history.  Durations are in seconds.
+type TimingSummary struct {
+	Test string `json:"test"`
+	Runs int    `json:"runs"`
+
+	// Median is the median duration of the runs that weren't
+	// skipped.
+	Median float64 `json:"median"`
+
+	// Last is the most recent run's duration.
+	Last float64 `json:"last"`
+
+	// Baseline is the median duration of the previous passing
+	// runs.  Only for regressions.
+	Baseline float64 `json:"baseline,omitempty"`
+
+	// FailRate is the fraction of the runs (that weren't
+	// skipped) that failed or had errors.
+	FailRate float64 `json:"failRate"`
+
+	// FlipRate is the fraction of consecutive runs (that weren't
+	// skipped) with different outcomes.
+	FlipRate float64 `json:"flipRate"`
+}
+
+// TimingReportParams configure a TimingReport.
+type TimingReportParams struct {
+	// Top is the maximum number of tests in each of the report's
+	// lists.  Zero means no limit.
+	Top int
+
+	// Threshold is the percentage over a test's baseline that's
+	// a regression.
+	Threshold float64
+
+	// MinRuns defaults to DefaultTimingMinRuns.
+	MinRuns int
+
+	// Floor defaults to DefaultTimingFloor.
+	Floor time.Duration
+}
+
+// Report summarizes the TimingDB.
+func (db *TimingDB) Report(ps TimingReportParams) *TimingReport {
+	if ps.MinRuns <= 0 {
+		ps.MinRuns = DefaultTimingMinRuns
+	}
+	if ps.Floor <= 0 {
+		ps.Floor = DefaultTimingFloor
+	}
+
+	r := &TimingReport{
+		Slowest:     []TimingSummary{},
+		Regressions: []TimingSummary{},
+		Flaky:       []TimingSummary{},
+	}
+
+	for test, rs := range db.Tests {
+		var (
+			ds     []float64
+			passed []float64
+			fails  int
+			flips  int
+			prev   string
+		)
+		for _, run := range rs {
+			if run.Result == "skipped" {
+				continue
+			}
+			ds = append(ds, run.Duration)
+			ok := run.Result == "passed"
+			if ok {
+				passed = append(passed, run.Duration)
+			} else {
+				fails++
+			}
+			outcome := "ok"
+			if !ok {
+				outcome = "not ok"
+			}
+			if prev != "" && prev != outcome {
+				flips++
+			}
+			prev = outcome
+		}
+		if len(ds) == 0 {
+			continue
+		}
+
+		s := TimingSummary{
+			Test:     test,
+			Runs:     len(ds),
+			Median:   median(ds),
+			Last:     ds[len(ds)-1],
+			FailRate: float64(fails) / float64(len(ds)),
+		}
+		if 1 < len(ds) {
+			s.FlipRate = float64(flips) / float64(len(ds)-1)
+		}
+
+		r.Slowest = append(r.Slowest, s)
+
+		if 0 < fails && fails < len(ds) {
+			r.Flaky = append(r.Flaky, s)
+		}
+
+		last := rs[len(rs)-1]
+		if last.Result == "passed" && ps.MinRuns < len(passed) {
+			s.Baseline = median(passed[:len(passed)-1])
+			floor := ps.Floor.Seconds()
+			if floor <= s.Baseline && s.Baseline*(1+ps.Threshold/100) < last.Duration {
+				r.Regressions = append(r.Regressions, s)
+			}
+		}
+	}
+
+	sortTimings(r.Slowest, func(s TimingSummary) float64 { return s.Median })
+	sortTimings(r.Regressions, func(s TimingSummary) float64 { return s.Last / s.Baseline })
+	sortTimings(r.Flaky, func(s TimingSummary) float64 { return s.FlipRate })
+
+	if 0 < ps.Top {
+		r.Slowest = topTimings(r.Slowest, ps.Top)
+		r.Regressions = topTimings(r.Regressions, ps.Top)
+		r.Flaky = topTimings(r.Flaky, ps.Top)
+	}
+
+	return r
+}
+
+// sortTimings sorts by the given value (largest first) and then by
+// test.
+func sortTimings(ss []TimingSummary, by func(TimingSummary) float64) {
+	sort.Slice(ss, func(i, j int) bool {
+		if x, y := by(ss[i]), by(ss[j]); x != y {
+			return x > y
+		}
+		return ss[i].Test < ss[j].Test
+	})
+}
+
+func topTimings(ss []TimingSummary, n int) []TimingSummary {
+	if n < len(ss) {
+		return ss[:n]
+	}
+	return ss
+}
+
+// WriteText writes the TimingReport as plain text.
+func (r *TimingReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Slowest tests (median, last, runs)\n")
+	if len(r.Slowest) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for _, s := range r.Slowest {
+		fmt.Fprintf(w, "  %8.3fs %8.3fs %4d  %s\n", s.Median, s.Last, s.Runs, s.Test)
+	}
+
+	fmt.Fprintf(w, "\nDuration regressions (last, baseline, change)\n")
+	if len(r.Regressions) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for _, s := range r.Regressions {
+		fmt.Fprintf(w, "  %8.3fs %8.3fs %+5.0f%%  %s\n", s.Last, s.Baseline,
+			100*(s.Last/s.Baseline-1), s.Test)
+	}
+
+	fmt.Fprintf(w, "\nFlaky tests (flip rate, fail rate, runs)\n")
+	if len(r.Flaky) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for _, s := range r.Flaky {
+		fmt.Fprintf(w, "  %5.0f%% %5.0f%% %4d  %s\n", 100*s.FlipRate, 100*s.FailRate, s.Runs, s.Test)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package invoke
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTimingDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "timing.json")
+	db, err := ReadTimingDB(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(test string, d float64, result string) {
+		db.Add(test, TimingRun{
+			Duration: d,
+			Result:   result,
+		}, 6)
+	}
+
+	// steady: Fast and always passes.
+	// slow: Slow and steady.
+	// regressed: Its last run took twice its baseline.
+	// flaky: Alternates.
+	for i := 0; i < 8; i++ {
+		add("steady", 0.5, "passed")
+		add("slow", 10, "passed")
+		if i < 7 {
+			add("regressed", 1, "passed")
+		} else {
+			add("regressed", 2, "passed")
+		}
+		if i%2 == 0 {
+			add("flaky", 1, "passed")
+		} else {
+			add("flaky", 1, "failed")
+		}
+	}
+	add("skipped", 0, "skipped")
+
+	if n := len(db.Tests["steady"]); n != 6 {
+		t.Fatal(n)
+	}
+
+	if err = db.Write(filename); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = ReadTimingDB(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	r := db.Report(TimingReportParams{
+		Top:       2,
+		Threshold: 50,
+	})
+
+	names := func(ss []TimingSummary) string {
+		acc := make([]string, len(ss))
+		for i, s := range ss {
+			acc[i] = s.Test
+		}
+		return strings.Join(acc, ",")
+	}
+
+	if got := names(r.Slowest); got != "slow,flaky" {
+		t.Fatal(got)
+	}
+	if got := names(r.Regressions); got != "regressed" {
+		t.Fatal(got)
+	}
+	if s := r.Regressions[0]; s.Baseline != 1 || s.Last != 2 {
+		t.Fatal(s)
+	}
+	if got := names(r.Flaky); got != "flaky" {
+		t.Fatal(got)
+	}
+	if s := r.Flaky[0]; s.FlipRate != 1 || s.FailRate != 0.5 {
+		t.Fatal(s)
+	}
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	if !strings.Contains(buf.String(), "+100%  regressed") {
+		t.Fatal(buf.String())
+	}
+}
@@ -20,6 +20,7 @@ package junit
 // https://llg.cubic.org/docs/junit/
 
 import (
+	"encoding/xml"
 	"time"
 )
 
@@ -39,13 +40,45 @@ type Failure struct {
 	Description string `xml:"description,omitempty"`
 }
 
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Properties is a list of Property elements, which is omitted from
+// XML when empty.
+type Properties []Property
+
+func (ps Properties) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(ps) == 0 {
+		return nil
+	}
+	return e.EncodeElement(struct {
+		Property []Property `xml:"property"`
+	}{ps}, start)
+}
+
+// UnmarshalXML reads the property elements inside a properties
+// element.
+func (ps *Properties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var x struct {
+		Property []Property `xml:"property"`
+	}
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+	*ps = append(*ps, x.Property...)
+	return nil
+}
+
 type TestCase struct {
-	Name    string   `xml:"name,attr"`
-	Status  string   `xml:"status,attr"`
-	Time    int64    `xml:"time,attr" json:"-"`
-	Skipped *Skipped `xml:"skipped,omitempty"`
-	Error   *Error   `xml:"error,omitempty"`
-	Failure *Failure `xml:"failure,omitempty"`
+	Name       string     `xml:"name,attr"`
+	Status     string     `xml:"status,attr"`
+	Time       int64      `xml:"time,attr" json:"-"`
+	Properties Properties `xml:"properties,omitempty" json:",omitempty"`
+	Skipped    *Skipped   `xml:"skipped,omitempty"`
+	Error      *Error     `xml:"error,omitempty"`
+	Failure    *Failure   `xml:"failure,omitempty"`
 
 	Timestamp time.Time `xml:"-"`
 	Suite     string    `xml:"-"`
@@ -81,6 +114,7 @@ type TestSuite struct {
 	Tests     int        `xml:"tests,attr"`
 	Failures  int        `xml:"failures,attr"`
 	Errors    int        `xml:"errors,attr"`
+	Skipped   int        `xml:"skipped,attr"`
 	TestCases []TestCase `xml:"testcase"`
 
 	Time time.Time `xml:"-"`
@@ -102,4 +136,7 @@ func (ts *TestSuite) Add(tc TestCase) {
 	if tc.Error != nil {
 		ts.Errors++
 	}
+	if tc.Skipped != nil {
+		ts.Skipped++
+	}
 }
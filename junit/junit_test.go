@@ -20,6 +20,7 @@ package junit
 import (
 	"encoding/xml"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -47,3 +48,33 @@ func TestJUnit(t *testing.T) {
 	}
 	fmt.Printf("%s\n", bs)
 }
+
+func TestProperties(t *testing.T) {
+	tc := TestCase{
+		Name: "queso",
+	}
+
+	bs, err := xml.Marshal(&tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bs), "properties") {
+		t.Fatalf("unexpected properties: %s", bs)
+	}
+
+	tc.Properties = Properties{{Name: "want", Value: "tacos"}}
+	if bs, err = xml.Marshal(&tc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `<properties><property name="want" value="tacos"></property></properties>`) {
+		t.Fatalf("missing properties: %s", bs)
+	}
+
+	var tc2 TestCase
+	if err = xml.Unmarshal(bs, &tc2); err != nil {
+		t.Fatal(err)
+	}
+	if len(tc2.Properties) != 1 || tc2.Properties[0] != tc.Properties[0] {
+		t.Fatalf("didn't read properties: %#v", tc2.Properties)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package junit
+
+import (
+	"time"
+)
+
+// Merge combines test suites into one suite with the given name.
+//
+// Test cases with the same name are duplicates, and the last one
+// wins (at the position of the first one).  So a report from a rerun
+// can override an earlier report by appearing later.  The counts are
+// computed from the remaining test cases, and the merged suite's
+// Time is the earliest (non-zero) Time of the given suites (or now).
+func Merge(name string, suites ...*TestSuite) *TestSuite {
+	var (
+		merged = NewTestSuite()
+		cases  = make([]TestCase, 0, 32)
+		index  = make(map[string]int)
+
+		earliest time.Time
+	)
+	merged.Name = name
+
+	for _, ts := range suites {
+		if ts == nil {
+			continue
+		}
+		if !ts.Time.IsZero() && (earliest.IsZero() || ts.Time.Before(earliest)) {
+			earliest = ts.Time
+		}
+		for _, tc := range ts.TestCases {
+			if j, have := index[tc.Name]; have {
+				cases[j] = tc
+				continue
+			}
+			index[tc.Name] = len(cases)
+			cases = append(cases, tc)
+		}
+	}
+
+	if !earliest.IsZero() {
+		merged.Time = earliest
+	}
+	for _, tc := range cases {
+		merged.Add(tc)
+	}
+
+	return merged
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package junit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	var (
+		then = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+		a    = NewTestSuite()
+		b    = NewTestSuite()
+	)
+	a.Time = then.Add(time.Minute)
+	a.Add(TestCase{Name: "one"})
+	a.Add(TestCase{Name: "two", Failure: &Failure{Message: "nope"}})
+
+	b.Time = then
+	b.Add(TestCase{Name: "three", Error: &Error{Message: "broken"}})
+	b.Add(TestCase{Name: "two"})
+	b.Add(TestCase{Name: "four", Skipped: &Skipped{Message: "later"}})
+
+	m := Merge("all", &TestSuite{}, a, nil, b)
+
+	if m.Name != "all" {
+		t.Fatal(m.Name)
+	}
+	if !m.Time.Equal(then) {
+		t.Fatal(m.Time)
+	}
+	if m.Tests != 4 || m.Failures != 0 || m.Errors != 1 || m.Skipped != 1 {
+		t.Fatalf("%d %d %d %d", m.Tests, m.Failures, m.Errors, m.Skipped)
+	}
+	var names []string
+	for _, tc := range m.TestCases {
+		names = append(names, tc.Name)
+	}
+	if got := fmt.Sprint(names); got != "[one two three four]" {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Prefix is the URL path prefix for keys.
+const Prefix = "/kv/"
+
+// Handler serves a Store:
+//
+//   GET    /kv/KEY             returns the Entry (404 if absent)
+//   GET    /kv/?prefix=PREFIX  returns an array of Entries
+//   PUT    /kv/KEY?ttl=TTL     sets the value to the (JSON) body
+//   DELETE /kv/KEY             removes the entry
+//
+// A TTL is in Go syntax (e.g., "1m").
+func Handler(s *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, Prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, Prefix)
+
+		reply := func(x interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(x)
+		}
+
+		switch r.Method {
+		case "GET":
+			if key == "" {
+				reply(s.List(r.URL.Query().Get("prefix")))
+				return
+			}
+			e, have := s.Get(key)
+			if !have {
+				http.NotFound(w, r)
+				return
+			}
+			reply(e)
+		case "PUT", "POST":
+			var ttl time.Duration
+			if t := r.URL.Query().Get("ttl"); t != "" {
+				d, err := time.ParseDuration(t)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				ttl = d
+			}
+			var x interface{}
+			if err := json.NewDecoder(r.Body).Decode(&x); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			reply(s.Put(key, x, ttl))
+		case "DELETE":
+			if !s.Delete(key) {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// KV is the interface for a Store or a Client.
+type KV interface {
+	Put(key string, value interface{}, ttl time.Duration) (*Entry, error)
+	Get(key string) (*Entry, bool, error)
+	Delete(key string) (bool, error)
+	List(prefix string) ([]*Entry, error)
+}
+
+// Local adapts a Store to KV.
+type Local struct {
+	*Store
+}
+
+func (l Local) Put(key string, value interface{}, ttl time.Duration) (*Entry, error) {
+	return l.Store.Put(key, value, ttl), nil
+}
+
+func (l Local) Get(key string) (*Entry, bool, error) {
+	e, have := l.Store.Get(key)
+	return e, have, nil
+}
+
+func (l Local) Delete(key string) (bool, error) {
+	return l.Store.Delete(key), nil
+}
+
+func (l Local) List(prefix string) ([]*Entry, error) {
+	return l.Store.List(prefix), nil
+}
+
+// Client is a KV for a Store served by Handler.
+type Client struct {
+	// URL is the server's base URL (e.g., "http://host:8080").
+	URL string
+
+	HTTP *http.Client
+}
+
+// NewClient makes a Client for the server at the given base URL.
+func NewClient(u string) *Client {
+	return &Client{
+		URL: strings.TrimSuffix(u, "/"),
+		HTTP: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c *Client) do(method, key string, q url.Values, body interface{}) (*http.Response, []byte, error) {
+	u := c.URL + Prefix + url.PathEscape(key)
+	if 0 < len(q) {
+		u += "?" + q.Encode()
+	}
+	var bs []byte
+	if body != nil {
+		js, err := json.Marshal(&body)
+		if err != nil {
+			return nil, nil, err
+		}
+		bs = js
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(bs))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if bs, err = ioutil.ReadAll(resp.Body); err != nil {
+		return nil, nil, err
+	}
+	if 400 <= resp.StatusCode && resp.StatusCode != http.StatusNotFound {
+		return nil, nil, fmt.Errorf("kv %s %s: %s: %s", method, key, resp.Status, bs)
+	}
+	return resp, bs, nil
+}
+
+func (c *Client) Put(key string, value interface{}, ttl time.Duration) (*Entry, error) {
+	q := url.Values{}
+	if 0 < ttl {
+		q.Set("ttl", ttl.String())
+	}
+	if value == nil {
+		// Make sure we send a JSON null.
+		value = json.RawMessage("null")
+	}
+	_, bs, err := c.do("PUT", key, q, value)
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err = json.Unmarshal(bs, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (c *Client) Get(key string) (*Entry, bool, error) {
+	resp, bs, err := c.do("GET", key, nil, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	var e Entry
+	if err = json.Unmarshal(bs, &e); err != nil {
+		return nil, false, err
+	}
+	return &e, true, nil
+}
+
+func (c *Client) Delete(key string) (bool, error) {
+	resp, _, err := c.do("DELETE", key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return resp.StatusCode != http.StatusNotFound, nil
+}
+
+func (c *Client) List(prefix string) ([]*Entry, error) {
+	_, bs, err := c.do("GET", "", url.Values{"prefix": {prefix}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var es []*Entry
+	if err = json.Unmarshal(bs, &es); err != nil {
+		return nil, err
+	}
+	return es, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package kv is a small key-value store with TTLs that tests can use
+// to coordinate with each other, even when they run on different
+// agents.
+//
+// 'plaxrun -serve ADDR' serves a Store via HTTP (see Handler), and
+// the 'kv' channel (see chans/kv.go) uses a Client for a remote Store
+// or, by default, the in-process Default Store.
+package kv
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a value with an optional expiration.
+type Entry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+
+	// Expires is nil for an entry that doesn't expire.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return e.Expires != nil && !now.Before(*e.Expires)
+}
+
+// Store is an in-memory key-value store with TTLs.
+type Store struct {
+	sync.Mutex
+
+	entries map[string]*Entry
+
+	// now is the clock (for testing).
+	now func() time.Time
+}
+
+// NewStore makes an empty Store.
+func NewStore() *Store {
+	return &Store{
+		entries: make(map[string]*Entry),
+		now:     time.Now,
+	}
+}
+
+// Default is the in-process Store.
+var Default = NewStore()
+
+// Put sets the value for the key.  A positive TTL makes the entry
+// expire after that duration.
+func (s *Store) Put(key string, value interface{}, ttl time.Duration) *Entry {
+	s.Lock()
+	defer s.Unlock()
+	e := &Entry{
+		Key:   key,
+		Value: value,
+	}
+	if 0 < ttl {
+		t := s.now().Add(ttl).UTC()
+		e.Expires = &t
+	}
+	s.entries[key] = e
+	return e
+}
+
+// Get returns the entry (if any) for the key.
+func (s *Store) Get(key string) (*Entry, bool) {
+	s.Lock()
+	defer s.Unlock()
+	e, have := s.entries[key]
+	if !have {
+		return nil, false
+	}
+	if e.expired(s.now()) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// Delete removes the key and reports whether the key was present.
+func (s *Store) Delete(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+	e, have := s.entries[key]
+	delete(s.entries, key)
+	return have && !e.expired(s.now())
+}
+
+// List returns the unexpired entries whose keys have the given
+// prefix sorted by key.
+func (s *Store) List(prefix string) []*Entry {
+	s.Lock()
+	defer s.Unlock()
+	now := s.now()
+	acc := make([]*Entry, 0, len(s.entries))
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+			continue
+		}
+		if strings.HasPrefix(k, prefix) {
+			acc = append(acc, e)
+		}
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		return acc[i].Key < acc[j].Key
+	})
+	return acc
+}
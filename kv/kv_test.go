@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package kv
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStoreTTL(t *testing.T) {
+	var (
+		s   = NewStore()
+		now = time.Now()
+	)
+	s.now = func() time.Time { return now }
+
+	s.Put("a", 1, time.Second)
+	s.Put("b", 2, 0)
+
+	if e, have := s.Get("a"); !have || e.Value != 1 {
+		t.Fatal(e, have)
+	}
+
+	now = now.Add(2 * time.Second)
+
+	if _, have := s.Get("a"); have {
+		t.Fatal("a should have expired")
+	}
+	if es := s.List(""); len(es) != 1 || es[0].Key != "b" {
+		t.Fatal(es)
+	}
+	if !s.Delete("b") {
+		t.Fatal("b should have been deleted")
+	}
+	if s.Delete("b") {
+		t.Fatal("b shouldn't exist")
+	}
+}
+
+func testKV(t *testing.T, x KV) {
+	if _, err := x.Put("runs/1", map[string]interface{}{"want": "tacos"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.Put("runs/2", "chips", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	e, have, err := x.Get("runs/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !have || e.Expires == nil {
+		t.Fatal(e, have)
+	}
+	if m, is := e.Value.(map[string]interface{}); !is || m["want"] != "tacos" {
+		t.Fatal(e.Value)
+	}
+
+	if _, have, err = x.Get("runs/3"); err != nil || have {
+		t.Fatal(have, err)
+	}
+
+	es, err := x.List("runs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 || es[1].Value != "chips" {
+		t.Fatal(es)
+	}
+
+	if found, err := x.Delete("runs/2"); err != nil || !found {
+		t.Fatal(found, err)
+	}
+	if found, err := x.Delete("runs/2"); err != nil || found {
+		t.Fatal(found, err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	testKV(t, Local{NewStore()})
+}
+
+func TestClient(t *testing.T) {
+	s := httptest.NewServer(Handler(NewStore()))
+	defer s.Close()
+	testKV(t, NewClient(s.URL))
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package lsp is a minimal Language Server Protocol server for Plax
+// test specifications.
+//
+// The server offers diagnostics (YAML errors, unknown fields, bad
+// goto targets, and Javascript syntax errors) and hover
+// documentation.
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Comcast/plax/dsl"
+
+	"github.com/dop251/goja"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity of a Diagnostic.
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+)
+
+// Position is a zero-based line and character.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a range in a document.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is a problem in a document.
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// nodeRange returns the Range for a (scalar) node.
+func nodeRange(n *yaml.Node) Range {
+	line, col := n.Line-1, n.Column-1
+	if line < 0 {
+		line = 0
+	}
+	if col < 0 {
+		col = 0
+	}
+	return Range{
+		Start: Position{line, col},
+		End:   Position{line, col + len(n.Value)},
+	}
+}
+
+func newDiagnostic(r Range, severity int, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Range:    r,
+		Severity: severity,
+		Source:   "plax",
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// jsKeys are the properties whose values are Javascript.
+var jsKeys = map[string]bool{
+	"run":    true,
+	"guard":  true,
+	"branch": true,
+	"if":     true,
+}
+
+// isInclude reports whether the node is a '#include<...>' or
+// '$include<...>' string.
+func isInclude(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode &&
+		(strings.HasPrefix(n.Value, "#include") || strings.HasPrefix(n.Value, "$include"))
+}
+
+// Diagnose checks the given test specification source.
+func Diagnose(src []byte) []Diagnostic {
+	ds := make([]Diagnostic, 0, 8)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		line := 0
+		if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			line--
+		}
+		return append(ds, newDiagnostic(Range{
+			Start: Position{line, 0},
+			End:   Position{line, 1000},
+		}, SeverityError, "%s", err))
+	}
+
+	if len(doc.Content) == 0 {
+		return ds
+	}
+
+	c := &checker{
+		ds: ds,
+	}
+	c.check(doc.Content[0], reflect.TypeOf(dsl.Test{}))
+	c.gotos(doc.Content[0])
+
+	return c.ds
+}
+
+var (
+	yamlLine = regexp.MustCompile(`line ([0-9]+)`)
+	jsLine   = regexp.MustCompile(`Line ([0-9]+):([0-9]+)`)
+)
+
+type checker struct {
+	ds []Diagnostic
+}
+
+func (c *checker) add(d Diagnostic) {
+	c.ds = append(c.ds, d)
+}
+
+// check looks for unknown fields and Javascript syntax errors.
+func (c *checker) check(n *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if n.Kind == yaml.AliasNode || isInclude(n) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		fields := dsl.YAMLFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			switch k.Value {
+			case "include", "includes":
+				continue
+			}
+			ft, have := fields[k.Value]
+			if !have {
+				msg := fmt.Sprintf("unknown field '%s'", k.Value)
+				if _, have := fields[strings.ToLower(k.Value)]; have {
+					msg += fmt.Sprintf(" (field names are lowercase: '%s')",
+						strings.ToLower(k.Value))
+				}
+				c.add(newDiagnostic(nodeRange(k), SeverityError, "%s", msg))
+				continue
+			}
+			if jsKeys[k.Value] && v.Kind == yaml.ScalarNode {
+				c.js(v)
+				continue
+			}
+			c.check(v, ft)
+		}
+	case reflect.Slice, reflect.Array:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, x := range n.Content {
+			c.check(x, t.Elem())
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			c.check(n.Content[i+1], t.Elem())
+		}
+	}
+}
+
+// js reports a Javascript syntax error (if any).
+func (c *checker) js(n *yaml.Node) {
+	if strings.HasPrefix(n.Value, "@@") || strings.HasPrefix(n.Value, "!!") {
+		// A file or a command: See Bindings.StringSubOnce().
+		return
+	}
+	// See Test.prepareSource(), which adds two lines before the
+	// code.
+	src := fmt.Sprintf("(function()\n{\n%s\n})()", n.Value)
+	if _, err := goja.Compile("", src, false); err != nil {
+		line := n.Line - 1
+		switch n.Style {
+		case yaml.LiteralStyle, yaml.FoldedStyle:
+			// The code starts on the next line.
+			line++
+		}
+		r := Range{
+			Start: Position{line, 0},
+			End:   Position{line, 1000},
+		}
+		if m := jsLine.FindStringSubmatch(err.Error()); m != nil {
+			l, _ := strconv.Atoi(m[1])
+			if l -= 3; 0 <= l {
+				r.Start.Line += l
+				r.End.Line += l
+			}
+		}
+		c.add(newDiagnostic(r, SeverityError, "Javascript: %s", err))
+	}
+}
+
+// gotos checks that goto targets are phases.
+func (c *checker) gotos(root *yaml.Node) {
+	phases := get(get(root, "spec"), "phases")
+	if phases == nil || phases.Kind != yaml.MappingNode {
+		return
+	}
+
+	names := make(map[string]bool)
+	for i := 0; i+1 < len(phases.Content); i += 2 {
+		names[phases.Content[i].Value] = true
+	}
+
+	for i := 0; i+1 < len(phases.Content); i += 2 {
+		steps := get(phases.Content[i+1], "steps")
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, step := range steps.Content {
+			target := get(step, "goto")
+			if target == nil || target.Kind != yaml.ScalarNode {
+				continue
+			}
+			if names[target.Value] || dsl.HappyTerminalPhase(target.Value) {
+				continue
+			}
+			c.add(newDiagnostic(nodeRange(target), SeverityError,
+				"goto target '%s' isn't a phase", target.Value))
+		}
+	}
+}
+
+// get returns the value for the given key in a mapping node.
+func get(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
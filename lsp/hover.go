@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package lsp
+
+import (
+	"strings"
+)
+
+// HoverDocs maps property names (and channel types) to brief
+// documentation.  See doc/manual.md for the full story.
+var HoverDocs = map[string]string{
+	// Test
+	"doc":       "An optional documentation string.",
+	"labels":    "Optional labels (e.g., `selftest`) used to select tests (`plax -labels`).",
+	"owners":    "Optional teams (or people) responsible for the test.  Reports carry them so `plaxrun merge-reports -owners` can route failures.",
+	"priority":  "Priority 0 is the highest priority.  `plax -priority N` runs tests with priority at most N.",
+	"spec":      "The test specification: `phases` (and optionally `initialphase`, `finalphases`, and `params`).",
+	"bindings":  "Initial bindings.  Usually bindings come from the command line (`-p`).",
+	"negative":  "When true, a failure is interpreted as a success (but errors are still errors).",
+	"retries":   "Retry policy: `n`, `delay`, and `delayfactor`.",
+	"instances": "Run this many concurrent copies of the test.  Each copy gets `?!instance` and `?!instanceId`.",
+	"record":    "Append all channel messages to this file for a later `replay` channel.",
+	"libraries": "Javascript files loaded into each Javascript environment.",
+	"packages":  "Shared packages of libraries and fixtures (`NAME@VERSION` or `NAME`).",
+	"maxsteps":  "Maximum number of phases to execute (a circuit breaker for loops).",
+	"history":   "Number of received messages per channel available to Javascript's `history(chan, n)` (default 100; negative disables).",
+	"clock":     "Optional fake clock (`fake`, `start`) for now(), elapsed, and wait steps.",
+	"seed":      "Seed for the pseudo-random number generator.",
+
+	// Spec
+	"initialphase":  "The phase to start with (default `phase1`).",
+	"finalphases":   "Phases to execute after the main sequence terminates (even on failure).",
+	"phases":        "A map from phase names to phases.  Each phase has `steps`.",
+	"params":        "Declarations of expected bindings: `type`, `default`, `required`, and `doc`.",
+	"steps":         "A sequence of steps, which are attempted in order.",
+	"table":         "Run the phase once per row with the columns bound as variables: `rows` (maps or lists with `columns`) or `csv` (a filename).",
+	"rows":          "A table's rows: maps from column names to values or, with `columns`, lists of values.",
+	"columns":       "Column names for a table's `rows` that are lists of values.",
+	"csv":           "A CSV file of table rows whose first record has the column names.",
+	"minassertions": "The minimum number of assertions (successful `recv` and `recvseq` steps) a run must execute.  Fewer is a `coverage` error.",
+
+	// Step
+	"pub":         "Publish a message: `chan`, `topic`, `payload`, and optionally `run` and `crypto`.",
+	"sub":         "Subscribe to a topic (filter): `chan` and `topic`.",
+	"recv":        "Wait for a message that matches a `pattern` (with optional `topic`, `timeout`, `guard`, `target`, `run`, and `crypto`).",
+	"kill":        "Ungracefully close the channel's underlying connection (if supported).",
+	"reconnect":   "Reconnect the channel (if supported).",
+	"pause":       "Stop delivering the channel's (`chan`) inbound messages to Recvs and buffer them until a `resume`.",
+	"resume":      "Deliver a paused channel's (`chan`) buffered messages (in order) and resume delivery.",
+	"run":         "Javascript to execute.  `bs` (the bindings), `test`, `elapsed`, and `fetch(url, opts)` are available.",
+	"wait":        "Pause for the given duration (in Go syntax, like `1s`).",
+	"waitfor":     "Repeat an attempt (optional `pub`, `recv`, and `condition`) every `interval` until it succeeds or the `timeout` passes.",
+	"condition":   "Javascript that returns true when a `waitfor` is done.",
+	"goto":        "Go to the given phase.  Must be the last step in a phase.",
+	"branch":      "Javascript that returns the name of the next phase (or the empty string to continue).",
+	"ingest":      "Send a message into a channel's incoming queue (`chan`, `topic`, `payload`).",
+	"window":      "Collect messages for a `duration` and then check the batch with `counts` (`pattern` with `count`, `min`, or `max`) and `reduce` (Javascript with `msgs`).",
+	"recvseq":     "Receive messages that match a sequence of `patterns` in order (with optional `chan`, `target`, `timeout`, and `interleaved`).",
+	"patterns":    "The sequence of patterns for a `recvseq`.",
+	"interleaved": "When true, a `recvseq` ignores messages that don't match the next pattern.",
+	"inspect":     "Check recently received messages: `chan`, `last`, `min`, `unique`, `ordered`, and `run` (with `msgs`).",
+	"fails":       "When true, this step is expected to fail.",
+	"skip":        "Skip this step (or test): `true`, a reason, or an object with `reason`, `if`, and `platforms`.",
+	"reason":      "Why a step or test is skipped.",
+	"if":          "Javascript that returns a boolean: skip only if true.",
+	"platforms":   "Skip only on these platforms (`GOOS` or `GOOS/GOARCH`).",
+
+	// Pub, Recv
+	"chan":             "The name of the channel.  Can be omitted when the test has only one channel (other than `mother`).",
+	"topic":            "The topic.  Bindings substitution applies.",
+	"payload":          "The message payload.  Bindings substitution applies.",
+	"pattern":          "A pattern the message must match.  Variables (like `?x`) bind to values.",
+	"timeout":          "How long to wait (in Go syntax, like `2s`).",
+	"guard":            "Javascript that must return true for the match to be accepted.  `bs` has the bindings.",
+	"target":           "What to match against: `payload` (default), `msg`, or `bodyjson`.",
+	"topics":           "Recv topic filters in order of precedence.  Messages on other topics are held for later Recvs.",
+	"set":              "Step that binds variables directly.  Values get substitution, and `!!` values are Javascript expressions.",
+	"extract":          "Recv map from variables to JSONPath (`$...`) or JMESPath expressions to bind.",
+	"payloadformat":    "Pub or Recv payload format: `json` (default), `xml`, `protobuf`, or `avro`.",
+	"fixtures":         "Spec map from names to payload (or pattern) templates that a Pub or Recv can use via `fixture`.",
+	"fixture":          "Name of a Spec fixture to use as a Pub's payload or a Recv's pattern.",
+	"with":             "Bindings that apply only to the `fixture` (and take precedence over the test's bindings).",
+	"payloadencoding":  "Pub or Recv payload encoding: `base64` for raw bytes represented as base64.",
+	"breakpoint":       "`true` or Javascript returning a boolean: `plax -debug` pauses before this step even after `continue`.  Without `-debug`, logs a snapshot of bindings and pending messages.",
+	"schemas":          "Spec map from names to JSON Schemas that a Pub or Recv can use by name via `schema`.  A named schema can `$ref` another by name.",
+	"schema":           "JSON Schema (a `schemas` name, filename, URI, or the schema itself) that a Pub's or Recv's payload must satisfy.",
+	"canon":            "Normalization before matching for a Recv (or a channel's `make`): `precision`, `timestamps`, and `keys` (`lower` or `upper`).",
+	"connectionevents": "In a `make` request: Report the channel's connection events (connected, disconnected, reconnected) as messages on the topic `plax/connection`.",
+	"profile":          "In a `make` request: The name of a channel profile, which gives the `type` and a `config` (merged under this `config`).",
+	"profiles":         "Spec map from names to channel profiles (`type`, `config`, `inherits`, `doc`).  These take precedence over `plax -profiles FILE`.",
+	"inherits":         "A channel profile's parent profile, whose `config` this profile's `config` is merged over.",
+	"avro":             "Avro schemas for `payloadformat: avro`: `registry` (Schema Registry URL), `subject`, `version`, `id`, and `schema`.",
+	"proto":            "Protobuf message type for `payloadformat: protobuf`: `descriptors` (a FileDescriptorSet file) and `message` (full name).",
+	"multiple":         "Strategy for multiple sets of bindings from a match: `unique` (default), `first`, or `all`.",
+	"clearbindings":    "When true, remove all bindings (except `?!` bindings) before matching.",
+	"crypto":           "Sign/encrypt (pub) or decrypt/verify (recv) payloads: `format`, `sign`, and `encrypt`.",
+
+	// Channel types
+	"mother":     "The channel that makes other channels: `pub` a `make` request with `name`, `type`, and `config`.",
+	"mock":       "A channel that echoes what's published to it.",
+	"cmd":        "A subprocess that receives messages via stdin and emits stdout, stderr, and exit messages.  Options: command, args, env, dir, killsignal.",
+	"mqttbroker": "An MQTT broker that runs inside plax.  The channel first delivers its `url` on topic `plax/broker`, observes routed messages on `sub`scribed topics, and `pub`lishes to the broker's clients.  Options: addr, qos, retain, buffersize.",
+	"subprocess": "A program that implements a channel by exchanging JSON lines (`op`, `topic`, `payload`) over stdin and stdout.  Options: command, args, env, dir, config.",
+	"awsiot":     "An AWS IoT Core MQTT client with SigV4 (WebSocket) or X.509 certificate auth.  With a `thing`, topics starting with `$shadow/` abbreviate its shadow topics.  Options: endpoint, region, auth, port, certfile, keyfile, thing, shadowname, clientid.",
+	"servicebus": "An Azure Service Bus client (REST API) that sends to a queue or topic and receives from the queue or a subscription.  Auth: connectionstring, or tenantid, clientid, clientsecret, and namespace.",
+	"eventhubs":  "An Azure Event Hubs publisher (REST API).  A pub's topic is the partition key.  Auth: connectionstring, or tenantid, clientid, clientsecret, and namespace.",
+	"nats":       "A NATS client.  With `requests`, a pub is a request whose reply the channel receives.  With a JetStream `stream`, each sub creates a consumer (see `durable`, `ackpolicy`, and `deliverpolicy`).",
+	"ssh":        "An SSH session (via the ssh program).  A pub writes to the remote shell; topic `exec` runs a remote command whose result arrives with topic `exec`.  Options: host, port, user, keyfile, password, noshell.",
+	"docker":     "A Docker container whose logs are received messages.  Topic `ready` reports readiness (see `readypattern` and `readyhealthcheck`) and ports.  Pub topics: stop, start, restart, pause, unpause, exec.",
+	"k8s":        "A Kubernetes client (via kubectl).  Pub topics: apply, delete, exec, logs.  A sub to KIND[/NAME] watches resources; a sub to logs/POD[/CONTAINER] follows logs.  Options: kubeconfig, context, namespace.",
+	"s3":         "An S3 client.  A pub writes an object (topic KEY or s3://BUCKET/KEY).  A sub to a prefix polls and reports created, changed, and deleted objects.  Options: bucket, region, endpoint, pathstyle, pollinterval, existing, fetch.",
+	"fswatch":    "Watches files by polling.  A sub to a glob pattern or directory reports created, modified, and deleted files.  A pub writes a file.  Options: dir, pollinterval, existing, fetch.",
+	"email":      "Sends email via SMTP (pub to, subject, text, html) and polls an IMAP mailbox (sub MAILBOX) for new emails.  Options: smtp, imap, from, to, pollinterval, existing.",
+	"mqtt":       "An MQTT client.  See `BrokerURL`, `ClientID`, and friends.",
+	"sqs":        "An SQS consumer and publisher.  See `QueueURL`.",
+	"kds":        "A Kinesis stream consumer.  See `StreamName`.",
+	"httpclient": "An HTTP client.  `pub` a request (`method`, `url`, `headers`, `body`), and `recv` the response.",
+	"faulty":     "Wraps another channel (`Kind`, `Opts`) and injects faults: `Delay`, `Jitter`, `Drop`, `Duplicate`, `Reorder`.",
+	"poller":     "Wraps another channel (`Kind`, `Opts`) and repeats each pub every `Interval` until a kill: `Limit`, `Changes`.",
+	"kv":         "A shared key-value store with TTLs (`URL`, `Namespace`).  Pub `op` put, get, delete, list, or wait.",
+	"replay":     "Replays recorded messages: `File`, `Chan`, `Test`, `Op`, `Scale`, `Immediate`.",
+	"dataset":    "Streams CSV or JSON Lines records as messages: `File`, `Format`, `Topic`, `TopicField`, `Rate`, `Limit`, `Output`.",
+}
+
+// wordAt returns the word at the given (zero-based) position.
+func wordAt(src string, pos Position) string {
+	lines := strings.Split(src, "\n")
+	if pos.Line < 0 || len(lines) <= pos.Line {
+		return ""
+	}
+	line := lines[pos.Line]
+	if pos.Character < 0 || len(line) < pos.Character {
+		return ""
+	}
+
+	isWord := func(c byte) bool {
+		return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+
+	i, j := pos.Character, pos.Character
+	for 0 < i && isWord(line[i-1]) {
+		i--
+	}
+	for j < len(line) && isWord(line[j]) {
+		j++
+	}
+	return line[i:j]
+}
+
+// Hover returns the documentation (if any) for the word at the given
+// position.
+func Hover(src string, pos Position) string {
+	w := wordAt(src, pos)
+	if doc, have := HoverDocs[strings.ToLower(w)]; have {
+		return "**" + w + "**: " + doc
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a Language Server Protocol server that communicates via
+// JSON-RPC with Content-Length headers (usually over stdio).
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// mu protects out.
+	mu sync.Mutex
+
+	// docs maps document URIs to their current text.
+	docs map[string]string
+
+	// Logf, if not nil, logs.
+	Logf func(format string, args ...interface{})
+}
+
+// NewServer makes a Server.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]string),
+	}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type textDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type textDocumentPosition struct {
+	TextDocument textDocument `json:"textDocument"`
+	Position     Position     `json:"position"`
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// read reads one message.
+func (s *Server) read() (*request, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length: %w", err)
+	}
+	bs := make([]byte, n)
+	if _, err = io.ReadFull(s.in, bs); err != nil {
+		return nil, err
+	}
+	var req request
+	if err = json.Unmarshal(bs, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// write writes one message.
+func (s *Server) write(x interface{}) error {
+	js, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(js)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(js)
+	return err
+}
+
+func (s *Server) reply(req *request, result interface{}) error {
+	return s.write(&response{
+		JSONRPC: "2.0",
+		Id:      req.Id,
+		Result:  result,
+	})
+}
+
+func (s *Server) publish(uri string) error {
+	ds := Diagnose([]byte(s.docs[uri]))
+	return s.write(&notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: map[string]interface{}{
+			"uri":         uri,
+			"diagnostics": ds,
+		},
+	})
+}
+
+// Serve handles messages until an 'exit' notification or the end of
+// input.
+func (s *Server) Serve() error {
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.logf("lsp %s", req.Method)
+		if err = s.handle(req); err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) error {
+	switch req.Method {
+	case "initialize":
+		return s.reply(req, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// Full document sync
+				"textDocumentSync": 1,
+				"hoverProvider":    true,
+			},
+			"serverInfo": map[string]interface{}{
+				"name": "plax",
+			},
+		})
+	case "shutdown":
+		return s.reply(req, nil)
+	case "exit":
+		return io.EOF
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument textDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		s.docs[params.TextDocument.URI] = params.TextDocument.Text
+		return s.publish(params.TextDocument.URI)
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   textDocument `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		if n := len(params.ContentChanges); 0 < n {
+			s.docs[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+		}
+		return s.publish(params.TextDocument.URI)
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument textDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return s.write(&notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params: map[string]interface{}{
+				"uri":         params.TextDocument.URI,
+				"diagnostics": []Diagnostic{},
+			},
+		})
+	case "textDocument/hover":
+		var params textDocumentPosition
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		doc := Hover(s.docs[params.TextDocument.URI], params.Position)
+		if doc == "" {
+			return s.reply(req, nil)
+		}
+		return s.reply(req, map[string]interface{}{
+			"contents": map[string]interface{}{
+				"kind":  "markdown",
+				"value": doc,
+			},
+		})
+	}
+
+	if len(req.Id) == 0 || strings.HasPrefix(req.Method, "$/") {
+		// Ignore other notifications.
+		return nil
+	}
+
+	return s.write(&response{
+		JSONRPC: "2.0",
+		Id:      req.Id,
+		Error: &responseError{
+			Code:    -32601,
+			Message: "method not found: " + req.Method,
+		},
+	})
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func diagnose(t *testing.T, src string, wants ...string) {
+	ds := Diagnose([]byte(src))
+	if len(ds) != len(wants) {
+		t.Fatalf("wanted %d diagnostics but got %#v", len(wants), ds)
+	}
+	for i, want := range wants {
+		if !strings.Contains(ds[i].Message, want) {
+			t.Fatalf("diagnostic %d '%s' doesn't contain '%s'", i, ds[i].Message, want)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		diagnose(t, `
+doc: Fine
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            payload: hi
+        - recv:
+            pattern: hi
+            guard: |
+              return true;
+        - goto: phase2
+    phase2:
+      steps:
+        - run: "@@foo.js"
+`)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		diagnose(t, `
+doc: Nope
+spec:
+  phases:
+    phase1:
+      steps:
+        - pub:
+            payloud: hi
+`, "unknown field 'payloud'")
+	})
+
+	t.Run("lowercase", func(t *testing.T) {
+		diagnose(t, `
+Doc: Nope
+`, "'doc'")
+	})
+
+	t.Run("goto", func(t *testing.T) {
+		ds := Diagnose([]byte(`
+spec:
+  phases:
+    phase1:
+      steps:
+        - goto: phase2
+`))
+		if len(ds) != 1 {
+			t.Fatal(ds)
+		}
+		if !strings.Contains(ds[0].Message, "phase2") {
+			t.Fatal(ds[0].Message)
+		}
+		if ds[0].Range.Start.Line != 5 {
+			t.Fatal(ds[0].Range)
+		}
+	})
+
+	t.Run("js", func(t *testing.T) {
+		ds := Diagnose([]byte(`
+spec:
+  phases:
+    phase1:
+      steps:
+        - run: |
+            var x = 1;
+            return x +;
+`))
+		if len(ds) != 1 {
+			t.Fatal(ds)
+		}
+		if !strings.Contains(ds[0].Message, "Javascript") {
+			t.Fatal(ds[0].Message)
+		}
+		if ds[0].Range.Start.Line != 7 {
+			t.Fatal(ds[0].Range)
+		}
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		diagnose(t, "doc: [\n", "")
+	})
+}
+
+func TestHover(t *testing.T) {
+	src := "spec:\n  phases:\n    phase1:\n      steps:\n        - recv:\n"
+	if doc := Hover(src, Position{4, 12}); !strings.Contains(doc, "pattern") {
+		t.Fatal(doc)
+	}
+	if doc := Hover(src, Position{4, 0}); doc != "" {
+		t.Fatal(doc)
+	}
+}
+
+func frame(x interface{}) string {
+	js, err := json.Marshal(x)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(js), js)
+}
+
+func TestServe(t *testing.T) {
+	in := frame(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+		"params":  map[string]interface{}{},
+	}) + frame(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri":  "file:///test.yaml",
+				"text": "dok: typo\n",
+			},
+		},
+	}) + frame(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "textDocument/hover",
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri": "file:///test.yaml",
+			},
+			"position": map[string]interface{}{
+				"line":      0,
+				"character": 1,
+			},
+		},
+	}) + frame(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      3,
+		"method":  "bogus",
+	}) + frame(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "exit",
+	})
+
+	var out bytes.Buffer
+	if err := NewServer(strings.NewReader(in), &out).Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the responses with a Server's reader.
+	r := NewServer(&out, ioutil.Discard)
+
+	var msgs []map[string]interface{}
+	for {
+		req, err := r.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		js, _ := json.Marshal(req)
+		var m map[string]interface{}
+		if err := json.Unmarshal(js, &m); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+
+	if len(msgs) != 4 {
+		t.Fatalf("wanted 4 messages but got %d", len(msgs))
+	}
+	if msgs[1]["method"] != "textDocument/publishDiagnostics" {
+		t.Fatal(msgs[1])
+	}
+	if !strings.Contains(string(must(json.Marshal(msgs[1]["params"]))), "dok") {
+		t.Fatal(msgs[1])
+	}
+}
+
+func must(js []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return js
+}
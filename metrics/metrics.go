@@ -0,0 +1,315 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package metrics is a small registry of counters and histograms
+// that can be exposed in the Prometheus text format.
+//
+// 'plaxrun -metrics ADDR' serves a Registry (see Handler), and
+// 'plaxrun -metrics-push URL' pushes one to a Prometheus Pushgateway
+// (see Push) when the run finishes.  A nil *Registry is valid and
+// ignores everything, so instrumented code doesn't need to check.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metrics that Plax reports.
+const (
+	// TestsTotal counts tests by suite and result ("passed",
+	// "failed", "error", or "skipped").
+	TestsTotal = "plax_tests_total"
+
+	// TestDuration is a histogram of each test's duration in
+	// seconds.
+	TestDuration = "plax_test_duration_seconds"
+
+	// ChanPublished counts messages published by channel name
+	// and kind.
+	ChanPublished = "plax_chan_published_total"
+
+	// ChanReceived counts messages that Recvs consumed by
+	// channel name and kind.
+	ChanReceived = "plax_chan_received_total"
+
+	// ChanDropped counts inbound messages that channels
+	// discarded because their buffers were full by channel kind
+	// and overflow policy.
+	ChanDropped = "plax_chan_dropped_total"
+
+	// RecvWait is a histogram of the time in seconds that a
+	// successful Recv waited.
+	RecvWait = "plax_recv_wait_seconds"
+)
+
+var help = map[string]string{
+	TestsTotal:    "Tests run by suite and result.",
+	TestDuration:  "Test durations in seconds.",
+	ChanPublished: "Messages published by channel.",
+	ChanReceived:  "Messages consumed by Recv steps by channel.",
+	ChanDropped:   "Inbound messages dropped by full channel buffers.",
+	RecvWait:      "Time in seconds that successful Recv steps waited.",
+}
+
+var (
+	// DefaultBuckets are the upper bounds for histograms of
+	// short durations (like Recv waits).
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+	// TestBuckets are the upper bounds for histograms of test
+	// durations.
+	TestBuckets = []float64{.1, .5, 1, 5, 10, 30, 60, 120, 300, 600, 1800}
+)
+
+// Labels are a metric's label names and values.
+type Labels map[string]string
+
+// key renders the labels in the exposition format: {a="1",b="2"}.
+func (ls Labels) key() string {
+	if len(ls) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(ls))
+	for name := range ls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(ls[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Registry holds counters and histograms.
+type Registry struct {
+	sync.Mutex
+
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+// NewRegistry makes an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// Add increments the named counter with the given labels.
+func (r *Registry) Add(name string, ls Labels, delta float64) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	m, have := r.counters[name]
+	if !have {
+		m = make(map[string]float64)
+		r.counters[name] = m
+	}
+	m[ls.key()] += delta
+}
+
+// Observe adds a value to the named histogram with the given
+// labels.  The buckets are only used when the histogram is new.
+func (r *Registry) Observe(name string, ls Labels, buckets []float64, x float64) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	m, have := r.histograms[name]
+	if !have {
+		m = make(map[string]*histogram)
+		r.histograms[name] = m
+	}
+	k := ls.key()
+	h, have := m[k]
+	if !have {
+		h = &histogram{
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+		m[k] = h
+	}
+	for i, le := range h.buckets {
+		if x <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += x
+	h.count++
+}
+
+// ObserveDuration is Observe for a time.Duration in seconds.
+func (r *Registry) ObserveDuration(name string, ls Labels, buckets []float64, d time.Duration) {
+	r.Observe(name, ls, buckets, d.Seconds())
+}
+
+// Counter returns the current value of the named counter with the
+// given labels.
+func (r *Registry) Counter(name string, ls Labels) float64 {
+	if r == nil {
+		return 0
+	}
+	r.Lock()
+	defer r.Unlock()
+	return r.counters[name][ls.key()]
+}
+
+// Write writes the metrics in the Prometheus text exposition
+// format.
+func (r *Registry) Write(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	var buf bytes.Buffer
+
+	header := func(name, typ string) {
+		if s, have := help[name]; have {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", name, s)
+		}
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, typ)
+	}
+
+	for _, name := range sortedKeys(r.counters) {
+		header(name, "counter")
+		m := r.counters[name]
+		ks := make([]string, 0, len(m))
+		for k := range m {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			fmt.Fprintf(&buf, "%s%s %s\n", name, k, formatFloat(m[k]))
+		}
+	}
+
+	for _, name := range sortedKeys(r.histograms) {
+		header(name, "histogram")
+		m := r.histograms[name]
+		ks := make([]string, 0, len(m))
+		for k := range m {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			h := m[k]
+			for i, le := range h.buckets {
+				fmt.Fprintf(&buf, "%s_bucket%s %d\n", name, withLe(k, formatFloat(le)), h.counts[i])
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", name, withLe(k, "+Inf"), h.count)
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", name, k, formatFloat(h.sum))
+			fmt.Fprintf(&buf, "%s_count%s %d\n", name, k, h.count)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Handler serves the Registry in the Prometheus text format.
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.Write(w)
+	})
+}
+
+// Push sends the Registry to a Prometheus Pushgateway at the given
+// base URL (like "http://localhost:9091") under the given job name.
+// The push replaces the job's previous metrics.
+func Push(r *Registry, url, job string) error {
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		return err
+	}
+
+	url = strings.TrimSuffix(url, "/") + "/metrics/job/" + job
+	req, err := http.NewRequest("PUT", url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("metrics push to %s failed: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func sortedKeys(m interface{}) []string {
+	var ks []string
+	switch vv := m.(type) {
+	case map[string]map[string]float64:
+		for k := range vv {
+			ks = append(ks, k)
+		}
+	case map[string]map[string]*histogram:
+		for k := range vv {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// withLe adds an "le" label to the rendered labels.
+func withLe(k, le string) string {
+	l := "le=" + strconv.Quote(le)
+	if k == "" {
+		return "{" + l + "}"
+	}
+	return k[:len(k)-1] + "," + l + "}"
+}
+
+func formatFloat(x float64) string {
+	if math.IsInf(x, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	r.Add(TestsTotal, Labels{"suite": "s", "result": "passed"}, 1)
+	r.Add(TestsTotal, Labels{"suite": "s", "result": "passed"}, 1)
+	r.Add(TestsTotal, Labels{"suite": "s", "result": "failed"}, 1)
+	r.Observe(RecvWait, Labels{"chan": "mock"}, []float64{.1, 1}, .5)
+
+	if n := r.Counter(TestsTotal, Labels{"result": "passed", "suite": "s"}); n != 2 {
+		t.Fatal(n)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"# TYPE plax_tests_total counter\n",
+		`plax_tests_total{result="failed",suite="s"} 1` + "\n",
+		`plax_tests_total{result="passed",suite="s"} 2` + "\n",
+		"# TYPE plax_recv_wait_seconds histogram\n",
+		`plax_recv_wait_seconds_bucket{chan="mock",le="0.1"} 0` + "\n",
+		`plax_recv_wait_seconds_bucket{chan="mock",le="1"} 1` + "\n",
+		`plax_recv_wait_seconds_bucket{chan="mock",le="+Inf"} 1` + "\n",
+		`plax_recv_wait_seconds_sum{chan="mock"} 0.5` + "\n",
+		`plax_recv_wait_seconds_count{chan="mock"} 1` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestRegistryNil(t *testing.T) {
+	var r *Registry
+	r.Add(TestsTotal, nil, 1)
+	r.Observe(RecvWait, nil, DefaultBuckets, 1)
+	if n := r.Counter(TestsTotal, nil); n != 0 {
+		t.Fatal(n)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var path, body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.Method + " " + req.URL.Path
+		bs, _ := ioutil.ReadAll(req.Body)
+		body = string(bs)
+	}))
+	defer s.Close()
+
+	r := NewRegistry()
+	r.Add(ChanPublished, Labels{"chan": "mock", "kind": "mock"}, 3)
+	if err := Push(r, s.URL+"/", "plaxrun"); err != nil {
+		t.Fatal(err)
+	}
+	if path != "PUT /metrics/job/plaxrun" {
+		t.Fatal(path)
+	}
+	if !strings.Contains(body, `plax_chan_published_total{chan="mock",kind="mock"} 3`) {
+		t.Fatal(body)
+	}
+}
@@ -0,0 +1,759 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package mqttbroker is a small, in-process MQTT 3.1.1 broker for
+// self-contained tests.
+//
+// The broker supports QoS 0 and 1 (and accepts QoS 2 publishes, which
+// it delivers with QoS 1), retained messages, wildcard
+// subscriptions, persistent sessions (without CleanSession), and
+// Last Will and Testament messages.  It doesn't support TLS,
+// WebSockets, authentication, or redelivery of unacknowledged
+// messages.
+//
+// The 'mqttbroker' channel (see chans/mqttbroker.go) runs a Broker.
+package mqttbroker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message that the broker routes.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// Broker is an MQTT broker.
+type Broker struct {
+	// Observe, when not nil, is called (synchronously) with each
+	// message that the broker routes.
+	Observe func(m *Message)
+
+	// Logf, when not nil, logs the broker's activity.
+	Logf func(format string, args ...interface{})
+
+	mu       sync.Mutex
+	ln       net.Listener
+	sessions map[string]*session
+	retained map[string]*Message
+	closed   bool
+	n        int
+}
+
+// NewBroker makes a Broker, which doesn't do anything until Listen.
+func NewBroker() *Broker {
+	return &Broker{
+		sessions: make(map[string]*session),
+		retained: make(map[string]*Message),
+	}
+}
+
+func (b *Broker) logf(format string, args ...interface{}) {
+	if b.Logf != nil {
+		b.Logf(format, args...)
+	}
+}
+
+// Listen starts accepting connections at the given address (like
+// "127.0.0.1:0" for an unused port).
+func (b *Broker) Listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.ln = ln
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				b.mu.Lock()
+				closed := b.closed
+				b.mu.Unlock()
+				if !closed {
+					log.Printf("mqttbroker accept: %s", err)
+				}
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address that the broker is listening on.
+func (b *Broker) Addr() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ln == nil {
+		return ""
+	}
+	return b.ln.Addr().String()
+}
+
+// URL returns the broker's URL (like "tcp://127.0.0.1:1883").
+func (b *Broker) URL() string {
+	return "tcp://" + b.Addr()
+}
+
+// Close stops listening and disconnects every client.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	ln := b.ln
+	b.mu.Unlock()
+
+	b.Drop(true)
+
+	if ln != nil {
+		return ln.Close()
+	}
+	return nil
+}
+
+// Drop ungracefully disconnects every client, which causes their
+// wills (if any) to be published unless discardWills.
+func (b *Broker) Drop(discardWills bool) {
+	b.mu.Lock()
+	var cs []*client
+	for _, s := range b.sessions {
+		if s.client != nil {
+			cs = append(cs, s.client)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, c := range cs {
+		c.drop(discardWills)
+	}
+}
+
+// DropClient ungracefully disconnects the client with the given id
+// (if it's connected), which causes its will (if any) to be
+// published unless discardWill.  The result reports whether the
+// client was connected.
+func (b *Broker) DropClient(id string, discardWill bool) bool {
+	b.mu.Lock()
+	s, have := b.sessions[id]
+	var c *client
+	if have {
+		c = s.client
+	}
+	b.mu.Unlock()
+
+	if c == nil {
+		return false
+	}
+	c.drop(discardWill)
+	return true
+}
+
+// drop closes the client's connection.
+func (c *client) drop(discardWill bool) {
+	if discardWill {
+		c.mu.Lock()
+		c.will = nil
+		c.mu.Unlock()
+	}
+	c.conn.Close()
+}
+
+// Publish routes the message to subscribers (and retains it if
+// requested).
+func (b *Broker) Publish(m *Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.route(m)
+}
+
+// route delivers the message.  The caller holds b.mu.
+func (b *Broker) route(m *Message) {
+	b.logf("mqttbroker routing %s (%d bytes)", m.Topic, len(m.Payload))
+
+	if b.Observe != nil {
+		b.Observe(m)
+	}
+
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+
+	for _, s := range b.sessions {
+		qos, matched := s.match(m.Topic)
+		if !matched {
+			continue
+		}
+		if m.QoS < qos {
+			qos = m.QoS
+		}
+		// Only retained messages sent because of a new
+		// subscription have the retain flag.
+		out := &Message{
+			Topic:   m.Topic,
+			Payload: m.Payload,
+			QoS:     qos,
+		}
+		if s.client == nil {
+			if 0 < qos && len(s.pending) < MaxPending {
+				s.pending = append(s.pending, out)
+			}
+			continue
+		}
+		s.client.publish(out)
+	}
+}
+
+// MaxPending is the maximum number of QoS 1 messages that a
+// disconnected persistent session queues.
+var MaxPending = 1024
+
+// session has a client's subscriptions.
+type session struct {
+	id      string
+	subs    map[string]byte
+	pending []*Message
+
+	// persistent reports whether the session survives its
+	// client's disconnection (because the client didn't request a
+	// clean session).
+	persistent bool
+
+	// client is the session's connected client (if any).
+	client *client
+}
+
+// match returns the maximum QoS of the subscriptions that match the
+// topic.
+func (s *session) match(topic string) (byte, bool) {
+	var (
+		qos     byte
+		matched bool
+	)
+	for filter, q := range s.subs {
+		if Match(filter, topic) {
+			matched = true
+			if qos < q {
+				qos = q
+			}
+		}
+	}
+	return qos, matched
+}
+
+// Match reports whether the topic filter (which can have the
+// wildcards '+' and '#') matches the topic.
+func Match(filter, topic string) bool {
+	// Wildcards don't match topics that start with '$'.
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if len(ts) <= i {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// Packet types.
+const (
+	CONNECT     = 1
+	CONNACK     = 2
+	PUBLISH     = 3
+	PUBACK      = 4
+	PUBREC      = 5
+	PUBREL      = 6
+	PUBCOMP     = 7
+	SUBSCRIBE   = 8
+	SUBACK      = 9
+	UNSUBSCRIBE = 10
+	UNSUBACK    = 11
+	PINGREQ     = 12
+	PINGRESP    = 13
+	DISCONNECT  = 14
+)
+
+// client is a connection.
+type client struct {
+	b    *Broker
+	conn net.Conn
+	out  chan []byte
+	done chan struct{}
+
+	// mu protects will and nextId.
+	mu     sync.Mutex
+	will   *Message
+	nextId uint16
+
+	session *session
+}
+
+// publish sends the message to the client.
+func (c *client) publish(m *Message) {
+	var body []byte
+	body = appendString(body, m.Topic)
+	flags := m.QoS << 1
+	if m.Retain {
+		flags |= 1
+	}
+	if 0 < m.QoS {
+		c.mu.Lock()
+		c.nextId++
+		if c.nextId == 0 {
+			c.nextId = 1
+		}
+		id := c.nextId
+		c.mu.Unlock()
+		body = append(body, byte(id>>8), byte(id))
+	}
+	body = append(body, m.Payload...)
+	c.send(PUBLISH, flags, body)
+}
+
+// send queues a packet for the client.
+func (c *client) send(typ, flags byte, body []byte) {
+	select {
+	case c.out <- encodePacket(typ, flags, body):
+	case <-c.done:
+	}
+}
+
+var errProtocol = errors.New("protocol violation")
+
+func (b *Broker) serve(conn net.Conn) {
+	c := &client{
+		b:    b,
+		conn: conn,
+		out:  make(chan []byte, 1024),
+		done: make(chan struct{}),
+	}
+
+	// The writer.
+	go func() {
+		for {
+			select {
+			case <-c.done:
+				return
+			case p := <-c.out:
+				if _, err := conn.Write(p); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	graceful, err := c.run()
+	if err != nil && err != io.EOF {
+		b.logf("mqttbroker client %s: %s", conn.RemoteAddr(), err)
+	}
+	conn.Close()
+
+	b.mu.Lock()
+	if s := c.session; s != nil && s.client == c {
+		s.client = nil
+		if !s.persistent {
+			delete(b.sessions, s.id)
+		}
+	}
+	c.mu.Lock()
+	will := c.will
+	c.mu.Unlock()
+	if !graceful && will != nil {
+		b.route(will)
+	}
+	b.mu.Unlock()
+
+	close(c.done)
+}
+
+// run reads and handles packets until the connection ends.  The
+// result reports whether the client sent DISCONNECT.
+func (c *client) run() (bool, error) {
+	r := bufio.NewReader(c.conn)
+
+	// The first packet must be a CONNECT.
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	typ, _, body, err := readPacket(r)
+	if err != nil {
+		return false, err
+	}
+	if typ != CONNECT {
+		return false, errProtocol
+	}
+	keepAlive, err := c.connect(body)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		if 0 < keepAlive {
+			c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		} else {
+			c.conn.SetReadDeadline(time.Time{})
+		}
+		typ, flags, body, err := readPacket(r)
+		if err != nil {
+			return false, err
+		}
+		switch typ {
+		case PUBLISH:
+			if err := c.handlePublish(flags, body); err != nil {
+				return false, err
+			}
+		case PUBACK, PUBCOMP, PUBREC:
+			// No redelivery, so nothing to do.
+		case PUBREL:
+			c.send(PUBCOMP, 0, body)
+		case SUBSCRIBE:
+			if err := c.subscribe(body); err != nil {
+				return false, err
+			}
+		case UNSUBSCRIBE:
+			if err := c.unsubscribe(body); err != nil {
+				return false, err
+			}
+		case PINGREQ:
+			c.send(PINGRESP, 0, nil)
+		case DISCONNECT:
+			return true, nil
+		default:
+			return false, fmt.Errorf("unexpected packet type %d", typ)
+		}
+	}
+}
+
+// connect handles a CONNECT and returns the keep-alive interval.
+func (c *client) connect(body []byte) (time.Duration, error) {
+	d := &decoder{bs: body}
+	proto := d.string()
+	level := d.byte()
+	flags := d.byte()
+	keepAlive := time.Duration(d.uint16()) * time.Second
+	id := d.string()
+	var will *Message
+	if flags&0x04 != 0 {
+		will = &Message{
+			Topic:   d.string(),
+			Payload: d.bytes(),
+			QoS:     (flags >> 3) & 0x03,
+			Retain:  flags&0x20 != 0,
+		}
+		if 1 < will.QoS {
+			will.QoS = 1
+		}
+	}
+	if flags&0x80 != 0 {
+		d.string() // Username
+	}
+	if flags&0x40 != 0 {
+		d.bytes() // Password
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	if !(proto == "MQTT" && level == 4) && !(proto == "MQIsdp" && level == 3) {
+		c.send(CONNACK, 0, []byte{0, 1})
+		return 0, fmt.Errorf("unsupported protocol %s %d", proto, level)
+	}
+
+	clean := flags&0x02 != 0
+	if id == "" {
+		if !clean {
+			c.send(CONNACK, 0, []byte{0, 2})
+			return 0, fmt.Errorf("empty client id without clean session")
+		}
+		c.b.mu.Lock()
+		c.b.n++
+		id = fmt.Sprintf("mqttbroker-%d", c.b.n)
+		c.b.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.will = will
+	c.mu.Unlock()
+
+	b := c.b
+	b.mu.Lock()
+	s, have := b.sessions[id]
+	if have && s.client != nil {
+		// Take over from the existing connection.
+		s.client.conn.Close()
+	}
+	present := have && !clean && s.persistent
+	if !present {
+		s = &session{
+			id:         id,
+			subs:       make(map[string]byte),
+			persistent: !clean,
+		}
+		b.sessions[id] = s
+	}
+	s.client = c
+	c.session = s
+	pending := s.pending
+	s.pending = nil
+	b.mu.Unlock()
+
+	b.logf("mqttbroker client %s connected (clean %v)", id, clean)
+
+	ack := byte(0)
+	if present {
+		ack = 1
+	}
+	c.send(CONNACK, 0, []byte{ack, 0})
+
+	for _, m := range pending {
+		c.publish(m)
+	}
+
+	return keepAlive, nil
+}
+
+func (c *client) handlePublish(flags byte, body []byte) error {
+	d := &decoder{bs: body}
+	m := &Message{
+		Topic:  d.string(),
+		QoS:    (flags >> 1) & 0x03,
+		Retain: flags&0x01 != 0,
+	}
+	var id []byte
+	if 0 < m.QoS {
+		id = d.next(2)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if strings.ContainsAny(m.Topic, "+#") {
+		return fmt.Errorf("wildcard in PUBLISH topic '%s'", m.Topic)
+	}
+	m.Payload = append([]byte(nil), d.rest()...)
+	if 1 < m.QoS {
+		m.QoS = 1
+		c.b.Publish(m)
+		c.send(PUBREC, 0, id)
+		return nil
+	}
+	c.b.Publish(m)
+	if m.QoS == 1 {
+		c.send(PUBACK, 0, id)
+	}
+	return nil
+}
+
+func (c *client) subscribe(body []byte) error {
+	d := &decoder{bs: body}
+	id := d.next(2)
+	var (
+		codes   []byte
+		filters []string
+	)
+	for d.err == nil && 0 < len(d.bs) {
+		filter := d.string()
+		qos := d.byte()
+		if 1 < qos {
+			qos = 1
+		}
+		filters = append(filters, filter)
+		codes = append(codes, qos)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(filters) == 0 {
+		return errProtocol
+	}
+
+	b := c.b
+	b.mu.Lock()
+	var retained []*Message
+	for i, filter := range filters {
+		c.session.subs[filter] = codes[i]
+		for _, m := range b.retained {
+			if Match(filter, m.Topic) {
+				qos := m.QoS
+				if codes[i] < qos {
+					qos = codes[i]
+				}
+				retained = append(retained, &Message{
+					Topic:   m.Topic,
+					Payload: m.Payload,
+					QoS:     qos,
+					Retain:  true,
+				})
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	c.send(SUBACK, 0, append(id, codes...))
+	for _, m := range retained {
+		c.publish(m)
+	}
+	return nil
+}
+
+func (c *client) unsubscribe(body []byte) error {
+	d := &decoder{bs: body}
+	id := d.next(2)
+	var filters []string
+	for d.err == nil && 0 < len(d.bs) {
+		filters = append(filters, d.string())
+	}
+	if d.err != nil {
+		return d.err
+	}
+	c.b.mu.Lock()
+	for _, filter := range filters {
+		delete(c.session.subs, filter)
+	}
+	c.b.mu.Unlock()
+	c.send(UNSUBACK, 0, id)
+	return nil
+}
+
+// readPacket reads an MQTT control packet.
+func readPacket(r *bufio.Reader) (byte, byte, []byte, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var (
+		n     int
+		shift uint
+	)
+	for i := 0; ; i++ {
+		if 4 <= i {
+			return 0, 0, nil, fmt.Errorf("bad remaining length")
+		}
+		x, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n |= int(x&0x7f) << shift
+		if x&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return h >> 4, h & 0x0f, body, nil
+}
+
+// encodePacket makes an MQTT control packet.
+func encodePacket(typ, flags byte, body []byte) []byte {
+	p := []byte{typ<<4 | flags}
+	n := len(body)
+	for {
+		x := byte(n % 128)
+		n /= 128
+		if 0 < n {
+			x |= 0x80
+		}
+		p = append(p, x)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+func appendString(bs []byte, s string) []byte {
+	bs = append(bs, byte(len(s)>>8), byte(len(s)))
+	return append(bs, s...)
+}
+
+// decoder reads the fields of a packet's body.  The first problem
+// is recorded in err, after which the results are zero values.
+type decoder struct {
+	bs  []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.bs) < n {
+		d.err = fmt.Errorf("packet too short")
+		return nil
+	}
+	x := d.bs[:n]
+	d.bs = d.bs[n:]
+	return append([]byte(nil), x...)
+}
+
+func (d *decoder) byte() byte {
+	x := d.next(1)
+	if x == nil {
+		return 0
+	}
+	return x[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	x := d.next(2)
+	if x == nil {
+		return 0
+	}
+	return uint16(x[0])<<8 | uint16(x[1])
+}
+
+func (d *decoder) bytes() []byte {
+	return d.next(int(d.uint16()))
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) rest() []byte {
+	x := d.bs
+	d.bs = nil
+	return x
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mqttbroker
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "a/b", true},
+		{"+/b", "a/b", true},
+		{"#", "$SYS/x", false},
+		{"a/b/c", "a/b", false},
+	} {
+		if got := Match(c.filter, c.topic); got != c.want {
+			t.Errorf("Match(%q, %q) = %v", c.filter, c.topic, got)
+		}
+	}
+}
+
+func testClient(t *testing.T, b *Broker, id string, will bool) (mqtt.Client, chan mqtt.Message) {
+	msgs := make(chan mqtt.Message, 16)
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.URL()).
+		SetClientID(id).
+		SetAutoReconnect(false).
+		SetDefaultPublishHandler(func(_ mqtt.Client, m mqtt.Message) {
+			msgs <- m
+		})
+	if will {
+		opts.SetWill("wills/"+id, "gone", 1, false)
+	}
+	c := mqtt.NewClient(opts)
+	if tok := c.Connect(); !tok.WaitTimeout(5*time.Second) || tok.Error() != nil {
+		t.Fatal("connect", tok.Error())
+	}
+	return c, msgs
+}
+
+func wait(t *testing.T, tok mqtt.Token) {
+	if !tok.WaitTimeout(5*time.Second) || tok.Error() != nil {
+		t.Fatal(tok.Error())
+	}
+}
+
+func recv(t *testing.T, msgs chan mqtt.Message) mqtt.Message {
+	select {
+	case m := <-msgs:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	var observed []string
+	b.Observe = func(m *Message) {
+		observed = append(observed, m.Topic)
+	}
+	if err := b.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	sub, msgs := testClient(t, b, "sub", false)
+	defer sub.Disconnect(0)
+	pub, _ := testClient(t, b, "pub", true)
+
+	wait(t, sub.Subscribe("a/+", 1, nil))
+	wait(t, sub.Subscribe("wills/#", 1, nil))
+
+	wait(t, pub.Publish("a/b", 1, false, "hello"))
+	if m := recv(t, msgs); m.Topic() != "a/b" || string(m.Payload()) != "hello" || m.Qos() != 1 {
+		t.Fatal(m.Topic(), string(m.Payload()), m.Qos())
+	}
+
+	// Retained.
+	wait(t, pub.Publish("r/x", 0, true, "kept"))
+	late, lateMsgs := testClient(t, b, "late", false)
+	defer late.Disconnect(0)
+	wait(t, late.Subscribe("r/#", 0, nil))
+	if m := recv(t, lateMsgs); m.Topic() != "r/x" || !m.Retained() {
+		t.Fatal(m.Topic(), m.Retained())
+	}
+
+	// Injected.
+	b.Publish(&Message{
+		Topic:   "a/c",
+		Payload: []byte("injected"),
+	})
+	if m := recv(t, msgs); string(m.Payload()) != "injected" {
+		t.Fatal(string(m.Payload()))
+	}
+
+	// Will.
+	if !b.DropClient("pub", false) {
+		t.Fatal("pub not connected")
+	}
+	found := false
+	for i := 0; i < 3 && !found; i++ {
+		select {
+		case m := <-msgs:
+			found = m.Topic() == "wills/pub"
+		case <-time.After(5 * time.Second):
+		}
+	}
+	if !found {
+		t.Fatal("no will")
+	}
+
+	if len(observed) < 3 || observed[0] != "a/b" {
+		t.Fatal(observed)
+	}
+}
+
+func TestBrokerPersistentSession(t *testing.T) {
+	b := NewBroker()
+	if err := b.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.URL()).
+		SetClientID("persistent").
+		SetCleanSession(false).
+		SetAutoReconnect(false)
+	c := mqtt.NewClient(opts)
+	wait(t, c.Connect())
+	wait(t, c.Subscribe("p/#", 1, nil))
+	c.Disconnect(0)
+
+	pub, _ := testClient(t, b, "pub", false)
+	defer pub.Disconnect(0)
+	wait(t, pub.Publish("p/1", 1, false, "queued"))
+
+	msgs := make(chan mqtt.Message, 4)
+	opts.SetDefaultPublishHandler(func(_ mqtt.Client, m mqtt.Message) {
+		msgs <- m
+	})
+	c = mqtt.NewClient(opts)
+	tok := c.Connect()
+	wait(t, tok)
+	defer c.Disconnect(0)
+	if !tok.(*mqtt.ConnectToken).SessionPresent() {
+		t.Fatal("no session present")
+	}
+	if m := recv(t, msgs); string(m.Payload()) != "queued" {
+		t.Fatal(string(m.Payload()))
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package main is an example gRPC channel plugin.
+//
+// Build it with
+//
+//	go build -o plugins/plax-reverse ./plugins/reverse
+//
+// and then run plax with '-plugins plugins' (or PLAX_PLUGINS=plugins)
+// to get the 'reverse' channel type, which echoes what's published to
+// it after reversing strings.
+//
+// Unlike a Go plugin (see plugins/upper), this program runs in its
+// own process, so it doesn't need to be built with the same versions
+// of Go and packages as plax.
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+// ReverseOpts configures a ReverseChan.
+type ReverseOpts struct {
+	// Topic, when not empty, is the topic for every echoed
+	// message.
+	Topic string `json:",omitempty" yaml:",omitempty" doc:"Topic for every echoed message (the published topic if empty)."`
+}
+
+// ReverseChan echoes published messages with strings reversed.
+type ReverseChan struct {
+	opts ReverseOpts
+	buf  *dsl.Buffer
+}
+
+// NewReverseChan makes a ReverseChan.
+func NewReverseChan(ctx *dsl.Ctx, o interface{}) (dsl.Chan, error) {
+	var opts ReverseOpts
+	if err := dsl.As(o, &opts); err != nil {
+		return nil, err
+	}
+	buf, err := dsl.NewBuffer("reverse", 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return &ReverseChan{
+		opts: opts,
+		buf:  buf,
+	}, nil
+}
+
+func (c *ReverseChan) Kind() dsl.ChanKind {
+	return "reverse"
+}
+
+func (c *ReverseChan) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *ReverseChan) Close(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *ReverseChan) Kill(ctx *dsl.Ctx) error {
+	return dsl.Brokenf("Kill is not supported by a %T", c)
+}
+
+func (c *ReverseChan) Sub(ctx *dsl.Ctx, topic string) error {
+	return nil
+}
+
+func (c *ReverseChan) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.buf.C
+}
+
+func (c *ReverseChan) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	m.Payload = reverse(m.Payload)
+	if c.opts.Topic != "" {
+		m.Topic = c.opts.Topic
+	}
+	return c.To(ctx, m)
+}
+
+func (c *ReverseChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	return c.buf.Put(ctx, m)
+}
+
+// reverse reverses every string in x.
+func reverse(x interface{}) interface{} {
+	switch vv := x.(type) {
+	case string:
+		rs := []rune(vv)
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+		return string(rs)
+	case map[string]interface{}:
+		acc := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			acc[k] = reverse(v)
+		}
+		return acc
+	case []interface{}:
+		acc := make([]interface{}, len(vv))
+		for i, v := range vv {
+			acc[i] = reverse(v)
+		}
+		return acc
+	default:
+		return x
+	}
+}
+
+func main() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "reverse", NewReverseChan)
+	dsl.TheChanDocs.Register("reverse", "An example gRPC plugin channel that echoes messages with strings reversed.", ReverseOpts{})
+
+	if err := dsl.ServeChanPlugin("reverse"); err != nil {
+		log.Fatal(err)
+	}
+}
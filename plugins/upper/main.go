@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package main is an example channel plugin.
+//
+// Build it with
+//
+//	go build -buildmode=plugin -o plugins/upper.so ./plugins/upper
+//
+// and then run plax with '-plugins plugins' (or PLAX_PLUGINS=plugins)
+// to get the 'upper' channel type, which echoes what's published to
+// it after converting strings to upper case.
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheChanRegistry.Register(dsl.NewCtx(nil), "upper", NewUpperChan)
+	dsl.TheChanDocs.Register("upper", "An example plugin channel that echoes messages with strings in upper case.", UpperOpts{})
+}
+
+// UpperOpts configures an UpperChan.
+type UpperOpts struct {
+	// Topic, when not empty, is the topic for every echoed
+	// message.
+	Topic string `json:",omitempty" yaml:",omitempty" doc:"Topic for every echoed message (the published topic if empty)."`
+}
+
+// UpperChan echoes published messages with strings in upper case.
+type UpperChan struct {
+	opts UpperOpts
+	c    chan dsl.Msg
+}
+
+// NewUpperChan makes an UpperChan.
+func NewUpperChan(ctx *dsl.Ctx, o interface{}) (dsl.Chan, error) {
+	var opts UpperOpts
+	if err := dsl.As(o, &opts); err != nil {
+		return nil, err
+	}
+	return &UpperChan{
+		opts: opts,
+		c:    make(chan dsl.Msg, 1024),
+	}, nil
+}
+
+func (c *UpperChan) Kind() dsl.ChanKind {
+	return "upper"
+}
+
+func (c *UpperChan) Open(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *UpperChan) Close(ctx *dsl.Ctx) error {
+	return nil
+}
+
+func (c *UpperChan) Kill(ctx *dsl.Ctx) error {
+	return dsl.Brokenf("Kill is not supported by a %T", c)
+}
+
+func (c *UpperChan) Sub(ctx *dsl.Ctx, topic string) error {
+	return nil
+}
+
+func (c *UpperChan) Recv(ctx *dsl.Ctx) chan dsl.Msg {
+	return c.c
+}
+
+func (c *UpperChan) Pub(ctx *dsl.Ctx, m dsl.Msg) error {
+	m.Payload = upper(m.Payload)
+	if c.opts.Topic != "" {
+		m.Topic = c.opts.Topic
+	}
+	return c.To(ctx, m)
+}
+
+func (c *UpperChan) To(ctx *dsl.Ctx, m dsl.Msg) error {
+	m.ReceivedAt = time.Now().UTC()
+	select {
+	case <-ctx.Done():
+	case c.c <- m:
+	}
+	return nil
+}
+
+// upper converts every string in x to upper case.
+func upper(x interface{}) interface{} {
+	switch vv := x.(type) {
+	case string:
+		return strings.ToUpper(vv)
+	case map[string]interface{}:
+		acc := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			acc[k] = upper(v)
+		}
+		return acc
+	case []interface{}:
+		acc := make([]interface{}, len(vv))
+		for i, v := range vv {
+			acc[i] = upper(v)
+		}
+		return acc
+	default:
+		return x
+	}
+}
+
+func main() {
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestAWSProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Decrypt":
+			ec, _ := body["EncryptionContext"].(map[string]interface{})
+			if body["CiphertextBlob"] != base64.StdEncoding.EncodeToString([]byte("sealed")) || ec["app"] != "plax" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"InvalidCiphertextException","message":"bad"}`))
+				return
+			}
+			w.Write([]byte(`{"KeyId":"k","Plaintext":"` + base64.StdEncoding.EncodeToString([]byte("tacos")) + `"}`))
+		case "secretsmanager.GetSecretValue":
+			if body["SecretId"] != "plax" || body["VersionStage"] != "AWSPREVIOUS" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"nope"}`))
+				return
+			}
+			w.Write([]byte(`{"Name":"plax","SecretString":"{\"password\":\"queso\"}"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "SECRET",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	ctx := dsl.NewCtx(nil)
+	ctx.Redactor = dsl.NewRedactor()
+
+	opts := func(more map[string]interface{}) map[string]interface{} {
+		more["region"] = "us-west-2"
+		more["endpoint"] = srv.URL
+		return more
+	}
+
+	s, err := dsl.TheSecretProviders.Resolve(ctx, &dsl.SecretRef{
+		Provider: "awskms",
+		Name:     base64.StdEncoding.EncodeToString([]byte("sealed")),
+		Opts: opts(map[string]interface{}{
+			"context": map[string]interface{}{"app": "plax"},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "tacos" {
+		t.Fatal(s)
+	}
+
+	if _, err = dsl.TheSecretProviders.Resolve(ctx, &dsl.SecretRef{
+		Provider: "awskms",
+		Name:     base64.StdEncoding.EncodeToString([]byte("sealed")),
+		Opts:     opts(map[string]interface{}{}),
+	}); err == nil {
+		t.Fatal("should have complained")
+	}
+
+	s, err = dsl.TheSecretProviders.Resolve(ctx, &dsl.SecretRef{
+		Provider: "awssm",
+		Name:     "plax",
+		Key:      "password",
+		Opts: opts(map[string]interface{}{
+			"versionStage": "AWSPREVIOUS",
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "queso" {
+		t.Fatal(s)
+	}
+
+	if got := ctx.Redactor.Redact("tacos and queso"); got != dsl.Redacted+" and "+dsl.Redacted {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package secrets
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/Comcast/plax/dsl"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+func init() {
+	dsl.TheSecretProviders.Register(dsl.NewCtx(nil), "awskms", AWSKMSProvider)
+}
+
+// AWSKMSProvider decrypts the ref's Name (a base64-encoded KMS
+// ciphertext) with AWS KMS.
+//
+// The option "keyId" optionally specifies the KMS key, and the option
+// "context" (a map) gives the encryption context (if any) that was
+// used to encrypt the ciphertext.  See awsSession for the AWS
+// configuration.
+func AWSKMSProvider(ctx *dsl.Ctx, ref *dsl.SecretRef) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("ciphertext isn't base64: %w", err)
+	}
+
+	sess, err := awsSession(ref)
+	if err != nil {
+		return "", err
+	}
+
+	in := &kms.DecryptInput{
+		CiphertextBlob: blob,
+	}
+	if id := ref.Opt("keyId"); id != "" {
+		in.KeyId = aws.String(id)
+	}
+	if x, have := ref.Opts["context"]; have {
+		m, is := x.(map[string]interface{})
+		if !is {
+			return "", fmt.Errorf("context is a %T and not a map", x)
+		}
+		in.EncryptionContext = make(map[string]*string, len(m))
+		for k, v := range m {
+			in.EncryptionContext[k] = aws.String(fmt.Sprintf("%v", v))
+		}
+	}
+
+	out, err := kms.New(sess).DecryptWithContext(ctx, in)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out.Plaintext), nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package secrets provides SecretProviders (see dsl.SecretProvider)
+// for external secret stores.
+//
+// Import this package to register these providers.
+package secrets
+
+import (
+	"github.com/Comcast/plax/dsl"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+func init() {
+	dsl.TheSecretProviders.Register(dsl.NewCtx(nil), "awssm", AWSSecretsManagerProvider)
+}
+
+// awsSession makes an AWS session.  The configuration (region,
+// credentials) comes from the usual environment and shared
+// configuration, and the ref's options "region", "profile", and
+// "endpoint" (for example, for LocalStack) override it.
+func awsSession(ref *dsl.SecretRef) (*session.Session, error) {
+	opts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           ref.Opt("profile"),
+	}
+	if region := ref.Opt("region"); region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+	if endpoint := ref.Opt("endpoint"); endpoint != "" {
+		opts.Config.Endpoint = aws.String(endpoint)
+	}
+	return session.NewSessionWithOptions(opts)
+}
+
+// AWSSecretsManagerProvider gets the secret with the ref's Name (a
+// secret name or ARN) from AWS Secrets Manager.
+//
+// The options "versionStage" and "versionId" select a version of the
+// secret.  See awsSession for the AWS configuration.
+func AWSSecretsManagerProvider(ctx *dsl.Ctx, ref *dsl.SecretRef) (string, error) {
+	sess, err := awsSession(ref)
+	if err != nil {
+		return "", err
+	}
+
+	svc := secretsmanager.New(sess)
+
+	in := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(ref.Name),
+	}
+	if stage := ref.Opt("versionStage"); stage != "" {
+		in.VersionStage = aws.String(stage)
+	}
+	if id := ref.Opt("versionId"); id != "" {
+		in.VersionId = aws.String(id)
+	}
+
+	out, err := svc.GetSecretValueWithContext(ctx, in)
+	if err != nil {
+		return "", err
+	}
+
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+
+	return string(out.SecretBinary), nil
+}
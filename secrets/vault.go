@@ -0,0 +1,290 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func init() {
+	dsl.TheSecretProviders.Register(dsl.NewCtx(nil), "vault", VaultProvider)
+}
+
+// DefaultVaultJWTFile is the default file for a Kubernetes service
+// account's token for the "kubernetes" Vault auth method.
+var DefaultVaultJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultProvider reads the secret at the ref's Name (a path like
+// "secret/data/plax") from HashiCorp Vault.
+//
+// The Vault address comes from the option "addr" or else the
+// environment variable VAULT_ADDR.  The option "namespace" (or else
+// VAULT_NAMESPACE) gives an optional Vault Enterprise namespace.
+//
+// The option "auth" specifies the authentication method.  The
+// default method "token" uses the option "token" or else VAULT_TOKEN.
+// The method "approle" uses the options "roleId" and "secretId" (or
+// else VAULT_ROLE_ID and VAULT_SECRET_ID).  The method "kubernetes"
+// uses the option "role" and the service account token in the file
+// given by the option "jwtFile" (default DefaultVaultJWTFile).  The
+// method "userpass" uses the options "username" and "password".
+//
+// Except for "token", the option "mount" gives the auth method's
+// mount path, which defaults to the name of the method.  A login's
+// token is reused until its lease is almost over, and it's redacted
+// from logs.
+//
+// The value is the JSON representation of the secret's data.  For
+// the KV version 2 secrets engine, that's the inner 'data'.  Use the
+// ref's Key to select one property.
+func VaultProvider(ctx *dsl.Ctx, ref *dsl.SecretRef) (string, error) {
+	v := &vault{
+		addr:      optOrEnv(ref, "addr", "VAULT_ADDR"),
+		namespace: optOrEnv(ref, "namespace", "VAULT_NAMESPACE"),
+	}
+	if v.addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR isn't set")
+	}
+
+	token, err := v.token(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	bs, err := v.do(ctx, "GET", strings.TrimPrefix(ref.Name, "/"), token, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref.Name, err)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(bs, &secret); err != nil {
+		return "", err
+	}
+
+	data := secret.Data
+	// KV version 2 nests the secret in data.data.
+	if inner, is := data["data"].(map[string]interface{}); is {
+		if _, has := data["metadata"]; has {
+			data = inner
+		}
+	}
+
+	js, err := json.Marshal(&data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(js), nil
+}
+
+// optOrEnv returns the named option or else the value of the
+// environment variable.
+func optOrEnv(ref *dsl.SecretRef, opt, env string) string {
+	if s := ref.Opt(opt); s != "" {
+		return s
+	}
+	return os.Getenv(env)
+}
+
+// vault is a Vault server (and namespace).
+type vault struct {
+	addr      string
+	namespace string
+}
+
+// do makes a request to the Vault API at the given path (without the
+// "/v1/" prefix) and returns the response body.
+func (v *vault) do(ctx *dsl.Ctx, method, path, token string, body interface{}) ([]byte, error) {
+	var in *bytes.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		in = bytes.NewReader(js)
+	} else {
+		in = bytes.NewReader(nil)
+	}
+
+	url := strings.TrimSuffix(v.addr, "/") + "/v1/" + path
+
+	req, err := http.NewRequestWithContext(ctx, method, url, in)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	return bs, nil
+}
+
+// vaultLogin is a token from a login.
+type vaultLogin struct {
+	token   string
+	expires time.Time
+}
+
+// vaultLogins has the tokens from logins by server, method, and
+// credentials.
+var vaultLogins = struct {
+	sync.Mutex
+	m map[string]*vaultLogin
+}{
+	m: make(map[string]*vaultLogin),
+}
+
+// token returns the Vault token for the ref's auth method.
+func (v *vault) token(ctx *dsl.Ctx, ref *dsl.SecretRef) (string, error) {
+	var (
+		auth  = ref.Opt("auth")
+		mount = ref.Opt("mount")
+		path  string
+		body  map[string]interface{}
+	)
+
+	if mount == "" {
+		mount = auth
+	}
+
+	switch auth {
+	case "", "token":
+		token := optOrEnv(ref, "token", "VAULT_TOKEN")
+		if token == "" {
+			return "", fmt.Errorf("VAULT_TOKEN isn't set")
+		}
+		return token, nil
+
+	case "approle":
+		path = "auth/" + mount + "/login"
+		body = map[string]interface{}{
+			"role_id":   optOrEnv(ref, "roleId", "VAULT_ROLE_ID"),
+			"secret_id": optOrEnv(ref, "secretId", "VAULT_SECRET_ID"),
+		}
+
+	case "kubernetes":
+		filename := ref.Opt("jwtFile")
+		if filename == "" {
+			filename = DefaultVaultJWTFile
+		}
+		jwt, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		path = "auth/" + mount + "/login"
+		body = map[string]interface{}{
+			"role": ref.Opt("role"),
+			"jwt":  strings.TrimSpace(string(jwt)),
+		}
+
+	case "userpass":
+		username := ref.Opt("username")
+		if username == "" {
+			return "", fmt.Errorf("userpass auth needs a username")
+		}
+		path = "auth/" + mount + "/login/" + username
+		body = map[string]interface{}{
+			"password": ref.Opt("password"),
+		}
+
+	default:
+		return "", fmt.Errorf("unknown vault auth method '%s'", auth)
+	}
+
+	// Credentials are as secret as the secrets.
+	for _, k := range []string{"secret_id", "password", "jwt"} {
+		if s, _ := body[k].(string); s != "" {
+			ctx.Redactor.Add(s)
+		}
+	}
+
+	key := v.addr + "|" + v.namespace + "|" + path + "|" + dsl.JSON(body)
+
+	vaultLogins.Lock()
+	defer vaultLogins.Unlock()
+
+	if l, have := vaultLogins.m[key]; have {
+		if l.expires.IsZero() || time.Now().Before(l.expires) {
+			return l.token, nil
+		}
+	}
+
+	ctx.Logdf("Logging in to vault via %s", path)
+
+	bs, err := v.do(ctx, "POST", path, "", body)
+	if err != nil {
+		return "", fmt.Errorf("vault %s login: %w", auth, err)
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(bs, &resp); err != nil {
+		return "", err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault %s login returned no token", auth)
+	}
+
+	ctx.Redactor.Add(resp.Auth.ClientToken)
+
+	l := &vaultLogin{
+		token: resp.Auth.ClientToken,
+	}
+	if d := resp.Auth.LeaseDuration; 0 < d {
+		// Log in again when 90% of the lease is over.
+		l.expires = time.Now().Add(time.Duration(d) * time.Second * 9 / 10)
+	}
+	vaultLogins.m[key] = l
+
+	return l.token, nil
+}
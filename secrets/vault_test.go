@@ -0,0 +1,171 @@
+/*
+ * Copyright 2021 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Comcast/plax/dsl"
+)
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/plax" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"tacos"},"metadata":{"version":1}}}`))
+	}))
+	defer srv.Close()
+
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "root")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	ctx := dsl.NewCtx(nil)
+	ctx.Redactor = dsl.NewRedactor()
+
+	s, err := dsl.TheSecretProviders.Resolve(ctx, &dsl.SecretRef{
+		Provider: "vault",
+		Name:     "secret/data/plax",
+		Key:      "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "tacos" {
+		t.Fatal(s)
+	}
+	if got := ctx.Redactor.Redact("want tacos"); got != "want "+dsl.Redacted {
+		t.Fatal(got)
+	}
+
+	if _, err = dsl.TheSecretProviders.Resolve(ctx, &dsl.SecretRef{
+		Provider: "vault",
+		Name:     "secret/data/nope",
+	}); err == nil {
+		t.Fatal("should have complained")
+	}
+}
+
+func TestVaultAuth(t *testing.T) {
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		login := func(ok bool) {
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			logins++
+			w.Write([]byte(`{"auth":{"client_token":"s.login","lease_duration":3600}}`))
+		}
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			login(body["role_id"] == "r" && body["secret_id"] == "s3cr3t")
+		case "/v1/auth/users/login/homer":
+			login(body["password"] == "donuts")
+		case "/v1/auth/kubernetes/login":
+			login(body["role"] == "plax" && body["jwt"] == "eyJ")
+		case "/v1/secret/data/plax":
+			if r.Header.Get("X-Vault-Token") != "s.login" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"data":{"data":{"password":"tacos"},"metadata":{"version":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jwtFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(jwtFile, []byte("eyJ\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsl.NewCtx(nil)
+	ctx.Redactor = dsl.NewRedactor()
+
+	resolve := func(opts map[string]interface{}) (string, error) {
+		opts["addr"] = srv.URL
+		opts["namespace"] = "team"
+		return dsl.TheSecretProviders.Resolve(ctx, &dsl.SecretRef{
+			Provider: "vault",
+			Name:     "secret/data/plax",
+			Key:      "password",
+			Opts:     opts,
+		})
+	}
+
+	for _, opts := range []map[string]interface{}{
+		{"auth": "approle", "roleId": "r", "secretId": "s3cr3t"},
+		// The same login again.
+		{"auth": "approle", "roleId": "r", "secretId": "s3cr3t"},
+		{"auth": "userpass", "mount": "users", "username": "homer", "password": "donuts"},
+		{"auth": "kubernetes", "role": "plax", "jwtFile": jwtFile},
+	} {
+		s, err := resolve(opts)
+		if err != nil {
+			t.Fatalf("%v: %s", opts, err)
+		}
+		if s != "tacos" {
+			t.Fatal(s)
+		}
+	}
+	if logins != 3 {
+		t.Fatal(logins)
+	}
+
+	for _, s := range []string{"s.login", "s3cr3t", "donuts"} {
+		if got := ctx.Redactor.Redact(s); got != dsl.Redacted {
+			t.Fatal(got)
+		}
+	}
+
+	for _, opts := range []map[string]interface{}{
+		{"auth": "approle", "roleId": "r", "secretId": "wrong"},
+		{"auth": "userpass"},
+		{"auth": "ldap"},
+	} {
+		if _, err := resolve(opts); err == nil {
+			t.Fatalf("%v: should have complained", opts)
+		}
+	}
+}